@@ -1,561 +1,509 @@
 package main
 
 import (
-	"encoding/json"
-	"fmt"
-	"html/template"
-	"io/ioutil"
-	"log"
+	"context"
+	"log/slog"
 	"net/http"
+	"net/url"
 	"os"
-	"path/filepath"
-	"strings"
-	"sync"
 	"time"
+
+	"OpTrack/internal/api"
+	"OpTrack/internal/clock"
+	"OpTrack/internal/middleware"
+	"OpTrack/internal/oci"
+	"OpTrack/internal/registry"
+	"OpTrack/internal/router"
+	"OpTrack/internal/scheduler"
+	"OpTrack/internal/store"
 )
 
-// JiraTicket represents a JIRA ticket and its associated operators
-type JiraTicket struct {
-	ID        string    `json:"id"`
-	Operators []string  `json:"operators"`
-	Added     time.Time `json:"added"` //Is this needed anymore?
-}
+// The server is split into packages under internal/: store persists tickets,
+// registry talks to Quay.io, api and web serve HTTP and scheduler runs the
+// background work. This file wires them together.
+
+type (
+	// JiraTicket represents a JIRA ticket and its associated operators
+	JiraTicket = store.Ticket
+	// OperatorStatus represents the status of an operator in Quay.io
+	OperatorStatus = registry.Status
+	// QuayClient handles communication with Quay.io API
+	QuayClient = registry.Client
+)
 
-// QuayTagInfo represents a single tag in the Quay.io API response
-type QuayTagInfo struct {
-	Name           string `json:"name"`
-	LastModified   string `json:"last_modified"`
-	ManifestDigest string `json:"manifest_digest"`
-}
+// Quay.io circuit breaker settings: after quayBreakerThreshold consecutive
+// failures, lookups fail fast for quayBreakerCooldown
+const (
+	quayBreakerThreshold = 5
+	quayBreakerCooldown  = 30 * time.Second
+)
 
-// QuayTagResponse represents the Quay.io API response
-type QuayTagResponse struct {
-	Tags []QuayTagInfo `json:"tags"`
+// defaultQuayRequestsPerMinute keeps a poll of hundreds of operators, with
+// the page views meanwhile, within the few requests a second Quay.io allows
+// one address
+const defaultQuayRequestsPerMinute = 300
+
+// NewQuayClient looks operators up on Quay.io, or through the registry plugin
+// when one is configured, attaching the build of each latest image when
+// builds is set, its signature and provenance verdicts when signatures and
+// provenance are set, its base image when bases is set and its
+// vulnerabilities when scanning has a scanner. Its requests share traffic
+// with the other clients of Quay.io.
+func NewQuayClient(cfg QuayConfig, traffic quayTraffic, source PluginConfig, builds registry.BuildLookup, signatures registry.SignatureVerifier, provenance registry.ProvenanceVerifier, bases registry.BaseImageChecker, scanning registry.Scanning) *QuayClient {
+	opts := registry.Options{
+		URL:              cfg.URL,
+		Timeout:          time.Duration(cfg.Timeout),
+		CacheTTL:         time.Duration(cfg.CacheTTL),
+		StaleTTL:         time.Duration(cfg.StaleTTL),
+		BreakerThreshold: quayBreakerThreshold,
+		BreakerCooldown:  quayBreakerCooldown,
+		Builds:           builds,
+		Signatures:       signatures,
+		Provenance:       provenance,
+		BaseImages:       bases,
+		Scanner:          scanning,
+
+		MaxIdleConnsPerHost: cfg.MaxIdleConnsPerHost,
+		TLSHandshakeTimeout: time.Duration(cfg.TLSHandshakeTimeout),
+		KeepAlive:           time.Duration(cfg.KeepAlive),
+		Budget:              traffic.budget,
+		Transport:           traffic.transport,
+	}
+	if source.Command != "" {
+		opts.Source = registryPlugin{cmd: source.command()}
+	}
+	return registry.New(opts, quayObserver{})
 }
 
-// OperatorStatus represents the status of an operator in Quay.io
-type OperatorStatus struct {
-	Name        string    `json:"name"`
-	LastUpdated time.Time `json:"lastUpdated"`
-	SHA256      string    `json:"sha256"`
-	Status      string    `json:"status"`
+// quayTraffic is shared by every client of Quay.io, so the registry requests
+// pulling signatures, base images and bundles count against the same budget,
+// and slow down on the same 429s, as the API lookups, over the same
+// connections
+type quayTraffic struct {
+	host      string // Of quay.url
+	budget    *registry.Budget
+	transport http.RoundTripper
 }
 
-// AppState maintains the application's state in memory
-type AppState struct {
-	Tickets map[string]JiraTicket
-	mu      sync.RWMutex
-	dataDir string 
+func newQuayTraffic(cfg QuayConfig, clk clock.Clock) quayTraffic {
+	traffic := quayTraffic{
+		budget: registry.NewBudget(cfg.RequestsPerMinute, quayObserver{}.BudgetRate, clk),
+		transport: registry.NewTransport(registry.Options{
+			MaxIdleConnsPerHost: cfg.MaxIdleConnsPerHost,
+			TLSHandshakeTimeout: time.Duration(cfg.TLSHandshakeTimeout),
+			KeepAlive:           time.Duration(cfg.KeepAlive),
+		}),
+	}
+	if u, err := url.Parse(cfg.URL); err == nil {
+		traffic.host = u.Host
+	}
+	return traffic
 }
 
-func NewAppState(dataDir string) (*AppState, error) {
-	// Create data directory if it doesn't exist
-	absPath, err := filepath.Abs(dataDir)
-	if err != nil {
-		return nil, fmt.Errorf("failed to resolve data directory path: %v", err)
+// ociClient pulls images from registries, pacing the requests to Quay.io
+func (t quayTraffic) ociClient(username, password string, timeout Duration) *oci.Client {
+	opts := oci.Options{Username: username, Password: password, Timeout: time.Duration(timeout), Transport: t.transport}
+	if t.budget != nil && t.host != "" {
+		opts.Pacers = map[string]oci.Pacer{t.host: t.budget}
 	}
+	return oci.NewClient(opts)
+}
 
-	log.Printf("Initializing data directory at: %s", absPath)
+// quayObserver feeds the Quay.io client's activity to the metrics and the
+// dependency SLO tracker
+type quayObserver struct{}
 
-	if err := os.MkdirAll(absPath, 0755); err != nil {
-		switch {
-		case os.IsPermission(err):
-			return nil, fmt.Errorf("insufficient permissions to create data directory at %s\nPlease run with appropriate permissions or choose a different location", absPath)
-		case os.IsExist(err):
-			return nil, fmt.Errorf("data directory exists but is not accessible: %s", absPath)
-		default:
-			return nil, fmt.Errorf("failed to create data directory at %s: %v", absPath, err)
-		}
+func (quayObserver) CacheLookup(hit bool) {
+	if hit {
+		quayCacheRequestsTotal.Inc("hit")
+	} else {
+		quayCacheRequestsTotal.Inc("miss")
 	}
+}
 
-	// Verify the directory is writable by attempting to create a test file
-	testFile := filepath.Join(absPath, "test.tmp")
-	if err := ioutil.WriteFile(testFile, []byte("test"), 0644); err != nil {
-		return nil, fmt.Errorf("data directory exists but is not writable at %s: %v", absPath, err)
-	}
-	os.Remove(testFile) 
+func (quayObserver) SharedLookup() {
+	quayCacheRequestsTotal.Inc("shared")
+}
 
-	log.Printf("Data directory initialized successfully at: %s", absPath)
+func (quayObserver) StaleLookup() {
+	quayCacheRequestsTotal.Inc("stale")
+}
 
-	state := &AppState{
-		Tickets: make(map[string]JiraTicket),
-		dataDir: dataDir,
-	}
+func (quayObserver) Request(start time.Time, duration time.Duration, result string, ok bool) {
+	quayRequestDuration.Observe(duration.Seconds())
+	quayRequestsTotal.Inc(result)
+	quaySLO.Record(start, duration, ok)
+}
 
-	if err := state.loadTickets(); err != nil {
-		return nil, fmt.Errorf("failed to load tickets: %v", err)
+func (quayObserver) BreakerState(state string) {
+	open := 0.0
+	if state == registry.BreakerOpen {
+		open = 1
 	}
-
-	return state, nil
+	quayCircuitOpen.Set(open)
 }
 
-func (s *AppState) loadTickets() error {
-	files, err := ioutil.ReadDir(s.dataDir)
-	if err != nil {
-		return err
-	}
+func (quayObserver) BudgetRate(perMinute float64) {
+	quayBudgetRate.Set(perMinute)
+}
 
-	for _, file := range files {
-		if !file.IsDir() && strings.HasSuffix(file.Name(), ".json") {
-			ticketID := strings.TrimSuffix(file.Name(), ".json")
-			if err := s.loadTicket(ticketID); err != nil {
-				log.Printf("Error loading ticket %s: %v", ticketID, err)
-				continue
-			}
-		}
+func main() {
+	if err := newRootCommand().Execute(); err != nil {
+		os.Exit(1)
 	}
-	return nil
 }
 
-func (s *AppState) loadTicket(ticketID string) error {
-	data, err := ioutil.ReadFile(filepath.Join(s.dataDir, ticketID+".json"))
+// runServer starts the poller and serves the web UI and API until the server
+// fails. reload re-reads the configuration for SIGHUP and /api/admin/reload.
+func runServer(cfg *Config, reload func() (*Config, error)) {
+	slog.Info("Starting Operator Update Tracker")
+	logBuildInfo()
+
+	// Listen first so a port that is already taken fails before any work starts
+	listener, err := listen(cfg.Listen)
 	if err != nil {
-		return err
+		fatal("Failed to listen", "addr", cfg.Listen, "error", err)
 	}
 
-	var ticket JiraTicket
-	if err := json.Unmarshal(data, &ticket); err != nil {
-		return err
+	// Create a new AppState with data directory
+	state, err := NewAppState(cfg.DataDir, clock.System)
+	if err != nil {
+		fatal("Failed to initialize application state", "error", err)
 	}
-
-	s.Tickets[ticketID] = ticket
-	return nil
-}
-
-func (s *AppState) saveTicket(ticket JiraTicket) error {
-	data, err := json.MarshalIndent(ticket, "", "    ")
+	slog.Info("Application state initialized successfully", "tickets", state.Len())
+	owners, err := readOwnersFile(cfg.Owners.File)
 	if err != nil {
-		return err
+		fatal("Failed to read the owners file", "error", err)
 	}
-
-	filename := filepath.Join(s.dataDir, ticket.ID+".json")
-	return ioutil.WriteFile(filename, data, 0644)
-}
-
-func (s *AppState) deleteTicket(ticketID string) error {
-	filename := filepath.Join(s.dataDir, ticketID+".json")
-	if err := os.Remove(filename); err != nil && !os.IsNotExist(err) {
-		return err
+	if err := importOwnersFile(state.inventory, cfg.Owners.File, owners); err != nil {
+		fatal("Failed to import the owners file", "error", err)
 	}
 
-	delete(s.Tickets, ticketID)
-	return nil
-}
-
-// QuayClient handles communication with Quay.io API
-type QuayClient struct {
-	HTTPClient *http.Client
-}
-
-func NewQuayClient() *QuayClient {
-	return &QuayClient{
-		HTTPClient: &http.Client{Timeout: 10 * time.Second},
+	traffic := newQuayTraffic(cfg.Quay, state.clock)
+	buildLookup, err := newBuildLookup(cfg.Builds)
+	if err != nil {
+		fatal("Failed to configure build systems", "error", err)
 	}
-}
-
-func (qc *QuayClient) GetOperatorStatus(operator string) (*OperatorStatus, error) {
-	parts := strings.Split(operator, "/")
-	if len(parts) != 2 {
-		return &OperatorStatus{
-			Name:   operator,
-			Status: "Invalid format. Expected: namespace/repository",
-		}, nil
+	signatures, provenance, err := newSignatureVerifier(cfg.Signatures, cfg.Quay, traffic)
+	if err != nil {
+		fatal("Failed to configure signature verification", "error", err)
 	}
-
-	namespace, repository := parts[0], parts[1]
-	url := fmt.Sprintf("https://quay.io/api/v1/repository/%s/%s/tag/", namespace, repository)
-
-	resp, err := qc.HTTPClient.Get(url)
+	if signatures != nil {
+		slog.Info("Signature verification enabled", "keys", len(cfg.Signatures.Keys), "identities", len(cfg.Signatures.Keyless.Identities), "provenance", provenance != nil)
+	}
+	bases, err := newBaseImageChecker(cfg.BaseImages, cfg.Quay, traffic)
 	if err != nil {
-		return &OperatorStatus{
-			Name:   operator,
-			Status: "Failed to connect to Quay.io",
-		}, nil
+		fatal("Failed to configure base image checks", "error", err)
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return &OperatorStatus{
-			Name:   operator,
-			Status: fmt.Sprintf("Quay.io error: %d", resp.StatusCode),
-		}, nil
+	if bases != nil {
+		slog.Info("Base image checks enabled", "images", len(cfg.BaseImages.Images), "history", cfg.BaseImages.History)
 	}
-
-	body, err := ioutil.ReadAll(resp.Body)
+	scanning, err := newScanning(cfg.Scans, cfg.Quay, state.clock)
 	if err != nil {
-		return &OperatorStatus{
-			Name:   operator,
-			Status: "Failed to read response",
-		}, nil
+		fatal("Failed to configure vulnerability scans", "error", err)
 	}
-
-	// Debug logging
-	log.Printf("Raw Quay.io response for %s: %s", operator, string(body))
-
-	var tagResponse QuayTagResponse
-	if err := json.Unmarshal(body, &tagResponse); err != nil {
-		log.Printf("Failed to parse JSON: %v", err)
-		return &OperatorStatus{
-			Name:   operator,
-			Status: fmt.Sprintf("Parse error: %v", err),
-		}, nil
+	if scanning.Scanner != nil {
+		slog.Info("Vulnerability scans enabled", "scanner", cfg.Scans.Scanner, "server", cfg.Scans.Server, "interval", time.Duration(cfg.Scans.Interval))
 	}
-
-	if len(tagResponse.Tags) == 0 {
-		return &OperatorStatus{
-			Name:   operator,
-			Status: "No tags found",
-		}, nil
+	quayClient := NewQuayClient(cfg.Quay, traffic, cfg.Plugins.Registry, buildLookup, signatures, provenance, bases, scanning)
+	statusCache, err := newStatusCache(state.dataDir, cfg.Quay, quayClient)
+	if err != nil {
+		fatal("Failed to load the status cache", "error", err)
 	}
-
-	// Find the most recent tag
-	var latestTag QuayTagInfo
-	latestTime := time.Time{}
-
-	for _, tag := range tagResponse.Tags {
-		tagTime, err := time.Parse(time.RFC1123Z, tag.LastModified)
+	var controller *Controller
+	if cfg.Controller.Enabled {
+		controller, err = newController(cfg.Controller, state, quayClient)
 		if err != nil {
-			log.Printf("Failed to parse time %s: %v", tag.LastModified, err)
-			continue
-		}
-		if tagTime.After(latestTime) {
-			latestTime = tagTime
-			latestTag = tag
+			fatal("Failed to configure the controller", "error", err)
 		}
+		state.readOnly = errControllerManaged
 	}
-
-	if latestTime.IsZero() {
-		return &OperatorStatus{
-			Name:   operator,
-			Status: "No valid timestamps found",
-		}, nil
+	driftMonitor, err := newDriftMonitor(cfg.Clusters, quayClient, state.clock)
+	if err != nil {
+		fatal("Failed to configure clusters", "error", err)
 	}
 
-	return &OperatorStatus{
-		Name:        operator,
-		LastUpdated: latestTime,
-		SHA256:      strings.TrimPrefix(latestTag.ManifestDigest, "sha256:"),
-		Status:      "OK",
-	}, nil
-}
-
-func main() {
-
-	log.Println("Starting Operator Update Tracker...")
-
-	// Create a new AppState with data directory
-	state, err := NewAppState("./data")
+	rules, err := NewRuleStore(state.dataDir, state.audit)
 	if err != nil {
-		log.Fatalf("Failed to initialize application state: %v", err)
+		fatal("Failed to load notification rules", "error", err)
 	}
-	log.Println("Application state initialized successfully")
-
-	quayClient := NewQuayClient()
+	dedup, err := NewDedupStore(state.dataDir)
+	if err != nil {
+		fatal("Failed to load notification dedup state", "error", err)
+	}
+	digestWindow, err := DigestWindowFromEnv()
+	if err != nil {
+		fatal("Invalid digest configuration", "error", err)
+	}
+	dispatcher := NewDispatcher(rules, dedup, digestWindow, state.clock)
 
-	fs := http.FileServer(http.Dir("static"))
-	http.Handle("/static/", http.StripPrefix("/static/", fs))
+	optOuts, err := NewOptOutStore(state.dataDir, state.audit)
+	if err != nil {
+		fatal("Failed to initialize email opt-outs", "error", err)
+	}
+	subscriptions, err := NewSubscriptionStore(state.dataDir, state.audit)
+	if err != nil {
+		fatal("Failed to load subscriptions", "error", err)
+	}
+	dispatcher.SetNotifiers(buildNotifiers(cfg.Notifications, cfg.Plugins.Notifiers, optOuts, subscriptions, state.inventory))
+	events := NewEventStream()
+
+	// Everything that acts on what the poller finds subscribes to the bus
+	bus := NewEventBus()
+	bus.SubscribeEvents("notifications", dispatcher.Dispatch)
+	bus.SubscribeEvents("event-stream", events.Publish)
+	bus.SubscribeCycles("metrics", recordPollMetrics)
+	dash := newDashboard(state, quayClient)
+	bus.SubscribeCycles("dashboard", dash.recordCycle)
+	shares, err := NewShareStore(state.dataDir, state.audit, state.clock)
+	if err != nil {
+		fatal("Failed to load share links", "error", err)
+	}
+	feed, err := NewFeedStore(state.dataDir)
+	if err != nil {
+		fatal("Failed to load the updates feed", "error", err)
+	}
+	bus.SubscribeEvents("feed", feed.Record)
+	if statusCache != nil {
+		bus.SubscribeCycles("status-cache", func(PollCycle) { statusCache.save() })
+	}
 
-	http.HandleFunc("/api/tickets", state.handleTickets)
-	http.HandleFunc("/api/status", func(w http.ResponseWriter, r *http.Request) {
-		state.handleStatus(w, r, quayClient)
-	})
-	http.HandleFunc("/", serveTemplate)
+	if driftMonitor != nil {
+		bus.SubscribeCycles("cluster-drift", newClusterWatcher(driftMonitor, bus, state.clock).checkCycle)
+	}
+	if cfg.Plugins.Registry.Command == "" {
+		bus.SubscribeCycles("pins", newPinWatcher(quayClient, bus, state.clock).checkCycle)
+	}
 
-	log.Println("Server starting on :8080")
-	log.Fatal(http.ListenAndServe(":8080", nil))
-}
+	pollInterval := time.Duration(cfg.PollInterval)
+	poller := NewPoller(state, quayClient, bus, pollInterval)
+	alertSender, err := AlertmanagerSenderFromEnv(4*pollInterval, state.clock)
+	if err != nil {
+		fatal("Invalid Alertmanager configuration", "error", err)
+	}
+	if alertSender != nil {
+		bus.SubscribeCycles("alertmanager", syncStaleAlerts(alertSender))
+		slog.Info("Alertmanager output enabled")
+	}
+	elector, err := newElector(cfg.LeaderElection, cfg.DataDir, state.clock)
+	if err != nil {
+		fatal("Failed to configure leader election", "error", err)
+	}
+	var pollerTask, reloadTask *scheduler.Task
+	if elector != nil {
+		// Only the leader polls, so only it notifies. Every replica reloads
+		// the tickets the others save to the shared data directory.
+		leaderGauge.Set(0)
+		pollerTask = scheduler.Start(elector.Run(poller.Run))
+		reloadTask = scheduler.Start(scheduler.Every(state.clock, time.Duration(cfg.LeaderElection.LeaseDuration), reloadTickets(state)))
+		slog.Info("Leader election enabled", "identity", elector.Status().Identity, "lock", elector.Status().Lock)
+	} else {
+		pollerTask = scheduler.Start(poller.Run)
+		leaderGauge.Set(1)
+	}
+	var controllerTask *scheduler.Task
+	if controller != nil {
+		bus.SubscribeCycles("controller", controller.checkCycle)
+		controllerTask = scheduler.Start(scheduler.Every(state.clock, time.Duration(cfg.Controller.Resync), controller.sync))
+		slog.Info("Controller mode enabled, tickets are read-only", "namespace", cfg.Controller.Namespace, "resync", cfg.Controller.Resync)
+	}
 
-func serveTemplate(w http.ResponseWriter, r *http.Request) {
-	tmpl := `
-<!DOCTYPE html>
-<html>
-<head>
-    <title>Operator Update Tracker</title>
-    <style>
-        .container { display: flex; }
-        .nav { width: 250px; padding: 20px; border-right: 1px solid #ccc; }
-        .content { flex: 1; padding: 20px; }
-        .ticket-item { 
-            display: flex; 
-            justify-content: space-between;
-            align-items: center;
-            padding: 10px;
-            margin-bottom: 5px;
-            border: 1px solid #eee;
-        }
-        .ticket-item:hover { background-color: #f0f0f0; }
-        .ticket-name { cursor: pointer; flex-grow: 1; }
-        .delete-btn {
-            color: red;
-            cursor: pointer;
-            padding: 0 5px;
-        }
-        .add-button { font-size: 24px; cursor: pointer; margin-bottom: 20px; }
-        .form-group { margin-bottom: 15px; }
-        .hidden { display: none; }
-        .error { color: red; }
-        .ok { color: green; }
-        .warning { color: #ff9900; }
-        .operator-input {
-            width: 100%;
-            min-height: 100px;
-            padding: 8px;
-            margin-top: 5px;
-            font-family: monospace;
-            resize: vertical;
-            box-sizing: border-box;
-        }
-        .form-label {
-            display: block;
-            margin-bottom: 5px;
-            font-weight: bold;
-        }
-        .jira-input {
-            width: 100%;
-            padding: 8px;
-            margin-top: 5px;
-            box-sizing: border-box;
-        }
-        .submit-button {
-            margin-top: 10px;
-            padding: 8px 16px;
-            background-color: #4CAF50;
-            color: white;
-            border: none;
-            border-radius: 4px;
-            cursor: pointer;
-        }
-        .submit-button:hover {
-            background-color: #45a049;
-        }
-    </style>
-</head>
-<body>
-    <div class="container">
-        <div class="nav">
-            <div class="add-button" onclick="showAddForm()">+ New Ticket</div>
-            <div id="ticketList"></div>
-        </div>
-        <div class="content">
-            <div id="addForm" class="hidden">
-                <h2>Add New Ticket</h2>
-                <div class="form-group">
-                    <label class="form-label">JIRA Ticket #:</label>
-                    <input type="text" id="jiraId" class="jira-input">
-                </div>
-                <div class="form-group">
-                    <label class="form-label">Operators:</label>
-                    <textarea 
-                        id="operators" 
-                        class="operator-input" 
-                        placeholder="Enter operators (one per line or comma-separated)&#10;Example:&#10;app-sre/splunk-audit-exporter&#10;app-sre/another-operator"
-                    ></textarea>
-                </div>
-                <button class="submit-button" onclick="addTicket()">Add Ticket</button>
-            </div>
-            <div id="statusDisplay"></div>
-        </div>
-    </div>
-    
-    <script>
-    function showAddForm() {
-        document.getElementById('addForm').classList.remove('hidden');
-        document.getElementById('statusDisplay').classList.add('hidden');
-    }
-    
-    function addTicket() {
-        const jiraId = document.getElementById('jiraId').value;
-        const operatorsText = document.getElementById('operators').value;
-        
-        // Split by either commas or newlines and clean up the results
-        const operatorsList = operatorsText
-            .split(/[,\n]/)  // Split by comma or newline
-            .map(op => op.trim())  // Remove whitespace
-            .filter(op => op.length > 0);  // Remove empty entries
-        
-        fetch('/api/tickets', {
-            method: 'POST',
-            headers: {'Content-Type': 'application/json'},
-            body: JSON.stringify({
-                id: jiraId,
-                operators: operatorsList
-            })
-        })
-        .then(response => response.json())
-        .then(data => {
-            loadTickets();
-            document.getElementById('jiraId').value = '';
-            document.getElementById('operators').value = '';
-        });
-    }
-    
-    function deleteTicket(event, ticketId) {
-        event.stopPropagation();
-        if (confirm('Are you sure you want to delete this ticket?')) {
-            fetch('/api/tickets?id=' + encodeURIComponent(ticketId), {
-                method: 'DELETE'
-            })
-            .then(response => {
-                if (response.ok) {
-                    loadTickets();
-                    document.getElementById('statusDisplay').innerHTML = '';
-                }
-            });
-        }
-    }
-    
-    function loadTickets() {
-        fetch('/api/tickets')
-        .then(response => response.json())
-        .then(tickets => {
-            const list = document.getElementById('ticketList');
-            list.innerHTML = '';
-            Object.entries(tickets).forEach(([id, ticket]) => {
-                const div = document.createElement('div');
-                div.className = 'ticket-item';
-                
-                const nameSpan = document.createElement('span');
-                nameSpan.className = 'ticket-name';
-                nameSpan.textContent = id;
-                nameSpan.onclick = () => loadStatus(id);
-                
-                const deleteBtn = document.createElement('span');
-                deleteBtn.className = 'delete-btn';
-                deleteBtn.textContent = '×';
-                deleteBtn.onclick = (e) => deleteTicket(e, id);
-                
-                div.appendChild(nameSpan);
-                div.appendChild(deleteBtn);
-                list.appendChild(div);
-            });
-        });
-    }
-    
-    function loadStatus(ticketId) {
-        document.getElementById('addForm').classList.add('hidden');
-        const statusDisplay = document.getElementById('statusDisplay');
-        statusDisplay.classList.remove('hidden');
-        statusDisplay.innerHTML = '<div>Loading...</div>';
-        
-        fetch('/api/status?ticket=' + encodeURIComponent(ticketId))
-        .then(response => response.json())
-        .then(statuses => {
-            let html = '<h2>Status for ' + ticketId + '</h2>';
-            html += '<table border="1" style="width: 100%; border-collapse: collapse;">';
-            html += '<tr><th>Operator</th><th>Last Updated</th><th>Days Old</th><th>SHA256</th><th>Status</th></tr>';
-            
-            statuses.forEach(status => {
-                const statusClass = status.status === 'OK' ? 'ok' : 'error';
-                const lastUpdated = status.lastUpdated ? new Date(status.lastUpdated) : null;
-                const daysOld = lastUpdated ? 
-                    Math.floor((new Date() - lastUpdated) / (1000 * 60 * 60 * 24)) : 
-                    'N/A';
-                
-                const daysOldClass = daysOld >= 30 ? 'error' : 
-                                   daysOld >= 14 ? 'warning' : 
-                                   'ok';
-                
-                const daysOldText = daysOld === 'N/A' ? 'N/A' : 
-                                   daysOld === 1 ? '1 day old' :
-                                   daysOld + ' days old';
-                
-                html += '<tr>';
-                html += '<td>' + status.name + '</td>';
-                html += '<td>' + (lastUpdated ? lastUpdated.toLocaleString() : 'N/A') + '</td>';
-                html += '<td class="' + daysOldClass + '">' + daysOldText + '</td>';
-                html += '<td style="font-family: monospace; word-break: break-all;">' + (status.sha256 || 'N/A') + '</td>';
-                html += '<td class="' + statusClass + '">' + status.status + '</td>';
-                html += '</tr>';
-            });
-            
-            html += '</table>';
-            statusDisplay.innerHTML = html;
-        });
-    }
-    
-    // Load tickets on page load
-    loadTickets();
-    </script>
-</body>
-</html>`
-
-	t := template.Must(template.New("index").Parse(tmpl))
-	t.Execute(w, nil)
-}
+	mux := projectRouter{Router: router.New(routeError), state: state}
+	mux.Handle("/static/", http.StripPrefix("/static/", webAssets.StaticHandler()))
+
+	tickets := &api.Handler{
+		Tickets:     state,
+		Registry:    quayClient,
+		Audit:       state.audit,
+		RequestID:   requestID,
+		Logger:      requestLogger,
+		Clock:       state.clock,
+		Location:    displayTimezone.Get,
+		Bundles:     newBundleClient(cfg.Bundles, traffic),
+		Order:       statusOrder{clock: state.clock},
+		Preferences: state.prefs,
+		Access:      ticketAccess{},
+	}
+	if driftMonitor != nil {
+		tickets.Drift = driftMonitor
+		slog.Info("Cluster drift detection enabled", "clusters", driftMonitor.Clusters())
+	}
+	if catalogs := newCatalogMonitor(cfg.Catalogs, quayClient, state.clock); catalogs != nil {
+		tickets.Catalog = catalogs
+		slog.Info("Catalog comparison enabled", "catalogs", catalogs.Catalogs())
+	}
+	if argo := newArgoCDMonitor(cfg.ArgoCD, quayClient); argo != nil {
+		tickets.ArgoCD = argo
+		slog.Info("ArgoCD application status enabled", "url", cfg.ArgoCD.URL)
+	}
+	if promotion := newPromotionMonitor(cfg.SaasFiles, quayClient, state.clock); promotion != nil {
+		tickets.Promotion = promotion
+		slog.Info("SaaS file promotion checks enabled", "sources", promotion.Sources())
+	}
+	pipelines, err := newPipelineMonitor(cfg.CI, state.clock)
+	if err != nil {
+		fatal("Failed to configure build pipelines", "error", err)
+	}
+	if pipelines != nil {
+		tickets.Pipelines = pipelines
+		slog.Info("Build pipeline status enabled", "pipelines", len(cfg.CI.Pipelines))
+	}
+	if commits := newCommitsMonitor(cfg.GitHub, quayClient, state.clock); commits != nil {
+		tickets.Commits = commits
+		slog.Info("Source repository comparison enabled", "url", cfg.GitHub.URL, "repositories", commits.Repositories())
+	}
+	compliance, err := newComplianceChecker(cfg.Policy, cfg.Quay, quayClient, state.clock)
+	if err != nil {
+		fatal("Failed to load the policy", "error", err)
+	}
+	if compliance != nil {
+		tickets.Policy = compliance
+		slog.Info("Compliance policy enabled", "file", cfg.Policy.File, "rules", compliance.Rules())
+	}
+	mux.HandleFunc("/api/tickets", tickets.HandleTickets)
+	mux.HandleFunc("/api/status", tickets.HandleStatus)
+	mux.HandleFunc("/api/operator", tickets.HandleOperator)
+	tickets.Routes(mux)
+	mux.HandleFunc("/api/notifications/optout", optOuts.handleOptOut)
+	mux.HandleFunc("/api/notifications/rules", rules.handleRules)
+	mux.HandleFunc("/api/subscriptions", subscriptions.handleSubscriptions)
+	mux.HandleFunc("/api/events", events.handleEvents)
+	slackCommands := NewSlackCommandHandler(state, quayClient)
+	slackCommands.SetSigningSecret(cfg.Notifications.Slack.SigningSecret)
+	mux.Handle("/api/slack/command", slackCommands)
+	if cfg.Notifications.Slack.SigningSecret != "" {
+		slog.Info("Slack slash command enabled", "path", "/api/slack/command")
+	}
 
-func (s *AppState) handleTickets(w http.ResponseWriter, r *http.Request) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	reloader := &Reloader{
+		load:          reload,
+		current:       cfg,
+		audit:         state.audit,
+		rules:         rules,
+		policy:        compliance,
+		dispatcher:    dispatcher,
+		optOuts:       optOuts,
+		subscriptions: subscriptions,
+		inventory:     state.inventory,
+		slackCommands: slackCommands,
+	}
+	go reloader.WatchSignals()
+	mux.Handle("/api/admin/reload", requireAdminToken(reloader.adminToken)(http.HandlerFunc(reloader.handleReload)))
+	statsd, err := StatsdEmitterFromEnv(defaultRegistry)
+	if err != nil {
+		fatal("Invalid statsd configuration", "error", err)
+	}
+	var statsdTask *scheduler.Task
+	if statsd != nil {
+		statsdTask = scheduler.Start(statsd.Run)
+		slog.Info("Statsd metrics enabled", "addr", os.Getenv("OPTRACK_STATSD_ADDR"))
+	}
 
-	switch r.Method {
-	case "GET":
-		json.NewEncoder(w).Encode(s.Tickets)
+	system := NewSystemHandler(state, quayClient, poller, dispatcher, elector)
+	mux.HandleFunc("/api/version", handleVersion)
+	mux.HandleFunc("/api/system", system.handleSystemAPI)
+	mux.HandleFunc("/system", system.handleSystemPage)
+	mux.HandleFunc("/api/audit", state.audit.handleAudit(state))
+	mux.HandleFunc("/audit", state.audit.handleAuditPage(state))
+	mux.HandleFunc("GET /ticket/{id}", handleTicketPage(state, quayClient))
+	mux.HandleFunc("GET /api/v1/tickets/{id}/report", handleTicketReport(state, quayClient, compliance))
+	mux.HandleFunc("GET /api/v1/tickets/{id}/table", handleStatusTable(state, quayClient))
+	mux.HandleFunc("GET /api/v1/tickets/{id}/shares", shares.handleShares(state))
+	mux.HandleFunc("POST /api/v1/tickets/{id}/shares", shares.handleShares(state))
+	mux.HandleFunc("DELETE /api/v1/tickets/{id}/shares/{share}", shares.handleRevoke)
+	mux.HandleFunc("GET /api/v1/tickets/{id}/comments", state.comments.handleComments(state))
+	mux.HandleFunc("POST /api/v1/tickets/{id}/comments", state.comments.handleComments(state))
+	mux.HandleFunc("DELETE /api/v1/tickets/{id}/comments/{comment}", state.comments.handleDeleteComment(state))
+	mux.HandleFunc("GET /share/{token}", shares.handleView(state, quayClient))
+	mux.HandleFunc("GET /api/v1/groups", state.groups.handleList)
+	mux.HandleFunc("GET /api/v1/groups/{name}", state.groups.handleGet)
+	mux.Handle("PUT /api/v1/groups/{name}", requireAdminToken(reloader.adminToken)(http.HandlerFunc(state.groups.handlePut)))
+	mux.Handle("DELETE /api/v1/groups/{name}", requireAdminToken(reloader.adminToken)(state.groups.handleDelete(state)))
+	mux.HandleFunc("GET /api/v1/inventory", state.inventory.handleList(state))
+	mux.HandleFunc("GET /api/v1/inventory/{namespace}/{repository}", state.inventory.handleGet(state))
+	mux.Handle("PUT /api/v1/inventory/{namespace}/{repository}", requireAdminToken(reloader.adminToken)(state.inventory.handlePut(state)))
+	mux.Handle("POST /api/v1/inventory/owners", requireAdminToken(reloader.adminToken)(http.HandlerFunc(state.inventory.handleImportOwners)))
+	mux.Handle("POST /api/v1/operators/rename", requireAdminToken(reloader.adminToken)(handleRenameOperator(state, quayClient)))
+	mux.HandleFunc("GET /api/v1/operators/{namespace}/{repository}/digests", state.annotations.handleList)
+	mux.HandleFunc("PUT /api/v1/operators/{namespace}/{repository}/digests/{digest}", state.annotations.handlePut(state))
+	mux.HandleFunc("DELETE /api/v1/operators/{namespace}/{repository}/digests/{digest}", state.annotations.handleDelete(state))
+	mux.HandleFunc("GET /api/v1/templates", state.templates.handleList)
+	mux.HandleFunc("GET /api/v1/templates/{name}", state.templates.handleGet)
+	mux.Handle("PUT /api/v1/templates/{name}", requireAdminToken(reloader.adminToken)(state.templates.handlePut(state)))
+	mux.Handle("DELETE /api/v1/templates/{name}", requireAdminToken(reloader.adminToken)(http.HandlerFunc(state.templates.handleDelete)))
+	mux.HandleFunc("POST /api/v1/templates/{name}/tickets", state.templates.handleCreateTicket(state, rules))
+	mux.HandleFunc("GET /api/v1/projects", handleProjects(state))
+	mux.HandleFunc("GET /api/v1/projects/{project}", handleProject(state))
+	mux.HandleFunc("GET /api/v1/me/preferences", state.prefs.handleGet)
+	mux.HandleFunc("PUT /api/v1/me/preferences", state.prefs.handlePutView)
+	mux.HandleFunc("PUT /api/v1/me/favorites/{id}", state.prefs.handleStar(state, true))
+	mux.HandleFunc("DELETE /api/v1/me/favorites/{id}", state.prefs.handleStar(state, false))
+	mux.HandleFunc("GET /embed/{ticket}", handleEmbed(state, quayClient, cfg.HTTP.EmbedAncestors))
+	mux.HandleFunc("GET /api/v1/dashboard", dash.handleAPI)
+	mux.HandleFunc("GET /dashboard", dash.handlePage)
+	mux.HandleFunc("GET /feeds/updates.atom", feed.handleFeed(state))
+	mux.HandleFunc("GET /feeds/{ticket}/updates.atom", feed.handleFeed(state))
+	mux.HandleFunc("GET /feeds/deadlines.ics", handleCalendar(state, quayClient))
+	mux.HandleFunc("GET /feeds/{ticket}/deadlines.ics", handleCalendar(state, quayClient))
+	mux.Handle("/metrics", defaultRegistry)
+	mux.HandleFunc("GET /{$}", serveTemplate(state.readOnly != nil))
+
+	sentry, err := SentryReporterFromEnv()
+	if err != nil {
+		fatal("Invalid Sentry configuration", "error", err)
+	}
+	if sentry != nil {
+		slog.Info("Panic reporting to Sentry enabled")
+	}
 
-	case "POST":
-		var ticket JiraTicket
-		if err := json.NewDecoder(r.Body).Decode(&ticket); err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
+	basePath = normalizeBasePath(cfg.BasePath)
+	slog.Info("Server starting", "addr", listener.Addr().String(), "base_path", basePath)
+	handler := middleware.Chain(mux, serverMiddleware(cfg, mux, sentry, state.clock)...)
+	srv := &http.Server{Handler: handler}
+	srv.RegisterOnShutdown(events.Close)
+	serve(srv, listener, time.Duration(cfg.ShutdownTimeout), func(ctx context.Context) {
+		if err := pollerTask.Stop(ctx); err != nil {
+			slog.Warn("Poller did not stop before the shutdown timeout", "error", err)
 		}
-
-		ticket.Added = time.Now()
-		s.Tickets[ticket.ID] = ticket
-
-		// Save to file
-		if err := s.saveTicket(ticket); err != nil {
-			log.Printf("Error saving ticket: %v", err)
-			http.Error(w, "Failed to save ticket", http.StatusInternalServerError)
-			return
+		if reloadTask != nil {
+			reloadTask.Stop(ctx)
 		}
-
-		json.NewEncoder(w).Encode(ticket)
-
-	case "DELETE":
-		ticketID := r.URL.Query().Get("id")
-		if ticketID == "" {
-			http.Error(w, "Ticket ID required", http.StatusBadRequest)
-			return
+		if controllerTask != nil {
+			if err := controllerTask.Stop(ctx); err != nil {
+				slog.Warn("Controller did not stop before the shutdown timeout", "error", err)
+			}
 		}
-
-		if err := s.deleteTicket(ticketID); err != nil {
-			log.Printf("Error deleting ticket: %v", err)
-			http.Error(w, "Failed to delete ticket", http.StatusInternalServerError)
-			return
+		// Only once the tasks using it have stopped, so that they aren't cut
+		// short in the middle of a cycle; a poll cycle still running after
+		// the timeout sees the client closed and gives up
+		quayClient.Close()
+		if err := bus.Close(ctx); err != nil {
+			slog.Warn("Event bus subscribers did not finish before the shutdown timeout", "error", err)
 		}
-
-		w.WriteHeader(http.StatusOK)
-	}
+		dispatcher.FlushPending()
+		if statusCache != nil {
+			statusCache.save()
+		}
+		if statsdTask != nil {
+			statsdTask.Stop(ctx)
+		}
+	})
 }
 
-func (s *AppState) handleStatus(w http.ResponseWriter, r *http.Request, qc *QuayClient) {
-	if r.Method != "GET" {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
-	ticketID := r.URL.Query().Get("ticket")
-
-	s.mu.RLock()
-	ticket, exists := s.Tickets[ticketID]
-	s.mu.RUnlock()
-
-	if !exists {
-		http.Error(w, "Ticket not found", http.StatusNotFound)
-		return
-	}
-
-	statuses := make([]OperatorStatus, 0, len(ticket.Operators))
-	for _, operator := range ticket.Operators {
-		status, err := qc.GetOperatorStatus(operator)
-		if err != nil {
-			log.Printf("Error getting status for operator %s: %v", operator, err)
-			status = &OperatorStatus{
-				Name:   operator,
-				Status: fmt.Sprintf("Error: %v", err),
-			}
+// serveTemplate serves the main page, without the controls that change
+// tickets when readOnly is set
+func serveTemplate(readOnly bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		data := struct {
+			StaleDays, WarningDays int
+			Timezone               string
+			ReadOnly               bool
+		}{
+			StaleDays:   int(staleThreshold.Get().Hours() / 24),
+			WarningDays: int(warningThreshold.Get().Hours() / 24),
+			Timezone:    requestLocation(r).String(),
+			ReadOnly:    readOnly,
 		}
-		statuses = append(statuses, *status)
+		renderPage(w, r, "index.html", data)
 	}
-
-	json.NewEncoder(w).Encode(statuses)
 }
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"OpTrack/internal/clock"
+)
+
+// Alert is a Prometheus-style alert for an operator that has gone stale
+type Alert struct {
+	Status       string            `json:"status,omitempty"` // Only used in webhook payloads
+	Labels       map[string]string `json:"labels"`
+	Annotations  map[string]string `json:"annotations"`
+	StartsAt     time.Time         `json:"startsAt"`
+	EndsAt       time.Time         `json:"endsAt,omitempty"`
+	GeneratorURL string            `json:"generatorURL,omitempty"`
+	Fingerprint  string            `json:"fingerprint,omitempty"`
+}
+
+// fingerprint identifies an alert by its sorted label set
+func (a Alert) fingerprint() string {
+	keys := make([]string, 0, len(a.Labels))
+	for k := range a.Labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	h := sha256.New()
+	for _, k := range keys {
+		fmt.Fprintf(h, "%s=%s\xff", k, a.Labels[k])
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// AlertSink receives the complete set of currently firing alerts after every
+// poll cycle. Alerts missing from a later set are considered resolved, except
+// the unchecked ones: those of operators that couldn't be looked up, which
+// keep firing if they were.
+type AlertSink interface {
+	Sync(alerts, unchecked []Alert) error
+}
+
+// syncStaleAlerts returns a poll cycle subscriber that hands the cycle's
+// stale operators to sink
+func syncStaleAlerts(sink AlertSink) func(PollCycle) {
+	return func(cycle PollCycle) {
+		externalURL := os.Getenv("OPTRACK_EXTERNAL_URL")
+		var alerts, unchecked []Alert
+		for _, check := range cycle.Tickets {
+			for _, status := range check.Statuses {
+				switch {
+				case status.Status != "OK":
+					unchecked = append(unchecked, staleAlert(check.Ticket, status, externalURL))
+				case isStale(check.Ticket, status, cycle.End):
+					alerts = append(alerts, staleAlert(check.Ticket, status, externalURL))
+				}
+			}
+		}
+		if err := sink.Sync(alerts, unchecked); err != nil {
+			slog.Error("Failed to send stale operator alerts", "alerts", len(alerts), "error", err)
+		}
+	}
+}
+
+// staleAlert builds the alert for a stale operator on a ticket
+func staleAlert(ticket JiraTicket, status OperatorStatus, externalURL string) Alert {
+	_, stale := ticketThresholds(ticket)
+	alert := Alert{
+		Labels: map[string]string{
+			"alertname": "OperatorStale",
+			"severity":  alertSeverity(status.Criticality),
+			"ticket":    ticket.ID,
+			"operator":  status.Name,
+			"service":   "optrack",
+		},
+		Annotations: map[string]string{
+			"summary":     fmt.Sprintf("%s on %s is stale", status.Name, ticket.ID),
+			"description": fmt.Sprintf("%s has not been updated since %s", status.Name, localTime(status.LastUpdated).Format(time.RFC1123)),
+			"sha256":      status.SHA256,
+		},
+		StartsAt: status.LastUpdated.Add(stale),
+	}
+	if status.Criticality != "" {
+		alert.Labels["criticality"] = status.Criticality
+	}
+	if externalURL != "" {
+		// Accept the external URL with or without the base path
+		alert.GeneratorURL = withBasePath(externalURL) + "/?ticket=" + ticket.ID
+	}
+	return alert
+}
+
+// AlertmanagerSender pushes alerts either to the Alertmanager v2 API or to a
+// generic receiver in Alertmanager webhook format
+type AlertmanagerSender struct {
+	url      string
+	webhook  bool
+	validFor time.Duration // How long a firing alert stays active without a refresh
+	client   *http.Client
+	clock    clock.Clock
+
+	mu     sync.Mutex
+	active map[string]Alert // fingerprint -> last sent firing alert
+}
+
+func NewAlertmanagerSender(url string, webhook bool, validFor time.Duration, clk clock.Clock) *AlertmanagerSender {
+	if !webhook {
+		url = strings.TrimSuffix(url, "/") + "/api/v2/alerts"
+	}
+	return &AlertmanagerSender{
+		url:      url,
+		webhook:  webhook,
+		validFor: validFor,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		clock:    clock.Or(clk),
+		active:   make(map[string]Alert),
+	}
+}
+
+// AlertmanagerSenderFromEnv reads OPTRACK_ALERTMANAGER_URL (Alertmanager API)
+// or OPTRACK_ALERT_WEBHOOK_URL (webhook format). It returns nil if neither is set.
+func AlertmanagerSenderFromEnv(validFor time.Duration, clk clock.Clock) (*AlertmanagerSender, error) {
+	apiURL := os.Getenv("OPTRACK_ALERTMANAGER_URL")
+	webhookURL := os.Getenv("OPTRACK_ALERT_WEBHOOK_URL")
+
+	switch {
+	case apiURL != "" && webhookURL != "":
+		return nil, fmt.Errorf("set only one of OPTRACK_ALERTMANAGER_URL and OPTRACK_ALERT_WEBHOOK_URL")
+	case apiURL != "":
+		return NewAlertmanagerSender(apiURL, false, validFor, clk), nil
+	case webhookURL != "":
+		return NewAlertmanagerSender(webhookURL, true, validFor, clk), nil
+	}
+	return nil, nil
+}
+
+func (s *AlertmanagerSender) Sync(alerts, unchecked []Alert) error {
+	now := s.clock.Now()
+
+	s.mu.Lock()
+	current := make(map[string]Alert, len(alerts))
+	batch := make([]Alert, 0, len(alerts)+len(s.active))
+	for _, alert := range alerts {
+		alert.Fingerprint = alert.fingerprint()
+		alert.Status = "firing"
+		alert.EndsAt = now.Add(s.validFor)
+		current[alert.Fingerprint] = alert
+		batch = append(batch, alert)
+	}
+	// An operator that couldn't be looked up may well still be stale, so its
+	// last alert is refreshed rather than resolved
+	for _, alert := range unchecked {
+		last, ok := s.active[alert.fingerprint()]
+		if !ok {
+			continue
+		}
+		last.EndsAt = now.Add(s.validFor)
+		current[last.Fingerprint] = last
+		batch = append(batch, last)
+	}
+	for fp, alert := range s.active {
+		if _, ok := current[fp]; !ok {
+			alert.Status = "resolved"
+			alert.EndsAt = now
+			batch = append(batch, alert)
+		}
+	}
+	s.mu.Unlock()
+
+	if len(batch) == 0 {
+		return nil
+	}
+
+	var payload interface{} = batch
+	if s.webhook {
+		payload = webhookPayload(batch)
+	} else {
+		// The API infers status from endsAt
+		for i := range batch {
+			batch[i].Status = ""
+			batch[i].Fingerprint = ""
+		}
+	}
+
+	if err := postJSON(s.client, s.url, payload); err != nil {
+		return err
+	}
+
+	// Only forget resolved alerts once the resolution has been delivered
+	s.mu.Lock()
+	s.active = current
+	s.mu.Unlock()
+	return nil
+}
+
+// webhookPayload wraps alerts in the Alertmanager webhook (version 4) envelope
+func webhookPayload(alerts []Alert) map[string]interface{} {
+	status := "resolved"
+	for _, alert := range alerts {
+		if alert.Status == "firing" {
+			status = "firing"
+			break
+		}
+	}
+
+	return map[string]interface{}{
+		"version":           "4",
+		"groupKey":          `{}:{alertname="OperatorStale"}`,
+		"status":            status,
+		"receiver":          "optrack",
+		"groupLabels":       map[string]string{"alertname": "OperatorStale"},
+		"commonLabels":      map[string]string{"alertname": "OperatorStale", "service": "optrack"},
+		"commonAnnotations": map[string]string{},
+		"externalURL":       os.Getenv("OPTRACK_EXTERNAL_URL"),
+		"truncatedAlerts":   0,
+		"alerts":            alerts,
+	}
+}
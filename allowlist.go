@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+	"sync/atomic"
+
+	"OpTrack/internal/store"
+)
+
+// operatorAllowList is the operators tickets may track: glob patterns of
+// registry/namespace/repository, with operators on the registry of quay.url
+type operatorAllowList struct {
+	host     string
+	patterns []string // Any operator when empty
+}
+
+// allowedOperators is replaced by config reloads; nil allows any operator
+var allowedOperators atomic.Pointer[operatorAllowList]
+
+// check fails with store.ErrOperatorNotAllowed naming the operators that
+// match no pattern
+func (l *operatorAllowList) check(operators []string) error {
+	if l == nil || len(l.patterns) == 0 {
+		return nil
+	}
+	var denied []string
+	for _, operator := range operators {
+		if !l.allows(operator) {
+			denied = append(denied, l.host+"/"+operator)
+		}
+	}
+	if len(denied) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w: %s; operators must match %s", store.ErrOperatorNotAllowed,
+		strings.Join(denied, ", "), strings.Join(l.patterns, ", "))
+}
+
+func (l *operatorAllowList) allows(operator string) bool {
+	for _, pattern := range l.patterns {
+		if ok, _ := path.Match(pattern, l.host+"/"+operator); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// checkNewOperators checks the operators of a ticket that old, the ticket it
+// replaces, didn't have, so operators tracked before the allow-list was
+// tightened don't block other changes
+func checkNewOperators(ticket JiraTicket, old *JiraTicket) error {
+	operators := ticket.OperatorNames()
+	if old != nil {
+		operators = nil
+		for _, operator := range ticket.OperatorNames() {
+			if !slices.Contains(old.OperatorNames(), operator) {
+				operators = append(operators, operator)
+			}
+		}
+	}
+	return allowedOperators.Load().check(operators)
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"OpTrack/internal/api"
+	"OpTrack/internal/clock"
+	"OpTrack/internal/registry"
+	"OpTrack/internal/store"
+)
+
+// maxReasonLength is the longest reason for an image, in characters
+const maxReasonLength = 500
+
+// maxAnnotationPage is the most reasons a request lists, from the given offset
+const maxAnnotationPage = 1000
+
+var errAnnotationNotFound = errors.New("digest has no reason")
+
+// DigestAnnotation is why an image of an operator was built, such as
+// "CVE-2024-1234 rebuild" or "routine base refresh"
+type DigestAnnotation struct {
+	Operator string    `json:"operator"`
+	Digest   string    `json:"digest"` // sha256 hex
+	Reason   string    `json:"reason"`
+	Author   string    `json:"author"`
+	Time     time.Time `json:"time"`
+}
+
+// AnnotationStore keeps the reasons given for images in the settings
+// directory. A reason can be given before the poller sees the image, e.g. by
+// the CI job that pushes it, or afterwards; it applies to the image on every
+// ticket.
+type AnnotationStore struct {
+	mu          sync.RWMutex
+	path        string
+	annotations map[string]DigestAnnotation // By lower-case operator + "@" + digest
+	audit       *AuditLog
+	clock       clock.Clock
+}
+
+func NewAnnotationStore(dataDir string, audit *AuditLog, clk clock.Clock) (*AnnotationStore, error) {
+	dir, err := store.SettingsDir(dataDir)
+	if err != nil {
+		return nil, err
+	}
+	s := &AnnotationStore{
+		path:        filepath.Join(dir, "digest-annotations.json"),
+		annotations: make(map[string]DigestAnnotation),
+		audit:       audit,
+		clock:       clk,
+	}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// load reads the annotations file, picking up reasons other replicas saved
+func (s *AnnotationStore) load() error {
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var list []DigestAnnotation
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("failed to parse %s: %v", s.path, err)
+	}
+	annotations := make(map[string]DigestAnnotation, len(list))
+	for _, a := range list {
+		annotations[annotationKey(a.Operator, a.Digest)] = a
+	}
+	s.mu.Lock()
+	s.annotations = annotations
+	s.mu.Unlock()
+	return nil
+}
+
+func annotationKey(operator, digest string) string {
+	return strings.ToLower(operator) + "@" + digest
+}
+
+// Reason returns why an image of an operator was built, or "" when no
+// reason was given
+func (s *AnnotationStore) Reason(operator, digest string) string {
+	if s == nil {
+		return ""
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.annotations[annotationKey(operator, digest)].Reason
+}
+
+// List returns the reasons given for the images of an operator, newest first
+func (s *AnnotationStore) List(operator string) []DigestAnnotation {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	list := []DigestAnnotation{}
+	for _, a := range s.annotations {
+		if strings.EqualFold(a.Operator, operator) {
+			list = append(list, a)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Time.After(list[j].Time) })
+	return list
+}
+
+// Set gives the reason an image was built, replacing any earlier one
+func (s *AnnotationStore) Set(actor string, r *http.Request, operator, digest, reason string) (DigestAnnotation, error) {
+	a := DigestAnnotation{Operator: operator, Digest: digest, Reason: reason, Author: actor, Time: s.clock.Now()}
+	key := annotationKey(operator, digest)
+
+	s.mu.Lock()
+	old, existed := s.annotations[key]
+	s.annotations[key] = a
+	if err := s.save(); err != nil {
+		if existed {
+			s.annotations[key] = old
+		} else {
+			delete(s.annotations, key)
+		}
+		s.mu.Unlock()
+		return a, err
+	}
+	s.mu.Unlock()
+
+	s.audit.RecordAs(actor, r, "digest.annotate", "", map[string]interface{}{"operator": operator, "digest": digest, "reason": reason})
+	return a, nil
+}
+
+// Delete removes the reason given for an image
+func (s *AnnotationStore) Delete(actor string, r *http.Request, operator, digest string) error {
+	key := annotationKey(operator, digest)
+
+	s.mu.Lock()
+	old, ok := s.annotations[key]
+	if !ok {
+		s.mu.Unlock()
+		return errAnnotationNotFound
+	}
+	delete(s.annotations, key)
+	if err := s.save(); err != nil {
+		s.annotations[key] = old
+		s.mu.Unlock()
+		return err
+	}
+	s.mu.Unlock()
+
+	s.audit.RecordAs(actor, r, "digest.unannotate", "", map[string]interface{}{"operator": operator, "digest": digest, "reason": old.Reason})
+	return nil
+}
+
+// save writes the annotations file. The caller holds s.mu.
+func (s *AnnotationStore) save() error {
+	list := make([]DigestAnnotation, 0, len(s.annotations))
+	for _, a := range s.annotations {
+		list = append(list, a)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return annotationKey(list[i].Operator, list[i].Digest) < annotationKey(list[j].Operator, list[j].Digest)
+	})
+	data, err := json.MarshalIndent(list, "", "    ")
+	if err != nil {
+		return err
+	}
+	if err := store.WriteFileAtomic(s.path, data, 0644); err != nil {
+		return fmt.Errorf("%w: failed to save digest annotations: %v", store.ErrStorage, err)
+	}
+	return nil
+}
+
+// checkReason trims a reason and checks it isn't empty, too long or more
+// than one line
+func checkReason(reason string) (string, error) {
+	reason = strings.TrimSpace(reason)
+	switch {
+	case reason == "":
+		return "", errors.New("a reason is required")
+	case utf8.RuneCountInString(reason) > maxReasonLength:
+		return "", fmt.Errorf("reasons are at most %d characters", maxReasonLength)
+	case strings.ContainsAny(reason, "\r\n"):
+		return "", errors.New("reasons are a single line")
+	}
+	return reason, nil
+}
+
+// annotationRequest is the body of
+// PUT /api/v1/operators/{namespace}/{repository}/digests/{digest}
+type annotationRequest struct {
+	Reason string `json:"reason"`
+}
+
+// handleList lists the reasons given for the images of an operator, newest
+// first, at GET /api/v1/operators/{namespace}/{repository}/digests
+func (s *AnnotationStore) handleList(w http.ResponseWriter, r *http.Request) {
+	operator := r.PathValue("namespace") + "/" + r.PathValue("repository")
+	page, err := parsePage(r, maxAnnotationPage, maxAnnotationPage)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	all := s.List(operator)
+	setPageHeaders(w, r, page, len(all))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(pageOf(all, page))
+}
+
+// handlePut gives the reason an image was built, and handleDelete removes
+// it, at PUT and DELETE /api/v1/operators/{namespace}/{repository}/digests/{digest}.
+// The digest is sha256 hex, with or without "sha256:".
+func (s *AnnotationStore) handlePut(state *AppState) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		operator, digest, ok := annotatedImage(state, w, r)
+		if !ok {
+			return
+		}
+		actor, status, message := annotationAuthor(state, r, operator)
+		if status != http.StatusOK {
+			httpError(w, r, message, status)
+			return
+		}
+		var req annotationRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			httpError(w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
+		reason, err := checkReason(req.Reason)
+		if err != nil {
+			httpError(w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
+		a, err := s.Set(actor, r, operator, digest, reason)
+		if err != nil {
+			requestLogger(r).Error("Failed to save digest annotation", "error", err)
+			api.WriteError(w, requestID(r), err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(a)
+	}
+}
+
+func (s *AnnotationStore) handleDelete(state *AppState) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		operator, digest, ok := annotatedImage(state, w, r)
+		if !ok {
+			return
+		}
+		actor, status, message := annotationAuthor(state, r, operator)
+		if status != http.StatusOK {
+			httpError(w, r, message, status)
+			return
+		}
+		err := s.Delete(actor, r, operator, digest)
+		switch {
+		case errors.Is(err, errAnnotationNotFound):
+			httpError(w, r, err.Error(), http.StatusNotFound)
+		case err != nil:
+			requestLogger(r).Error("Failed to delete digest annotation", "error", err)
+			api.WriteError(w, requestID(r), err)
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}
+}
+
+// annotationAuthor returns who changes the reason given for an image of an
+// operator. Reasons show wherever the operator is tracked, in every project,
+// so changing them takes the admin token, or a user who may change a ticket
+// tracking the operator. Otherwise it returns the error message and status
+// to answer with.
+func annotationAuthor(state *AppState, r *http.Request, operator string) (actor string, status int, message string) {
+	actor = requestActor(r)
+	if projectAccess.Load().isAdmin(r) {
+		return actor, http.StatusOK, ""
+	}
+	if actor == anonymousActor {
+		return "", http.StatusUnauthorized, "A user is required, from the auth.actorHeaders set by the reverse proxy"
+	}
+	for _, id := range state.Tracking(operator) {
+		if ticket, ok := state.Get(id); ok && canEdit(r, ticket.Project) {
+			return actor, http.StatusOK, ""
+		}
+	}
+	return "", http.StatusForbidden, "Reasons can only be given by those who may change a ticket tracking the operator, or with the admin token"
+}
+
+// annotatedImage returns the operator, spelled as in the inventory, and the
+// digest a request names, answering 400 when the digest isn't sha256
+func annotatedImage(state *AppState, w http.ResponseWriter, r *http.Request) (string, string, bool) {
+	operator := state.inventory.canonical(r.PathValue("namespace") + "/" + r.PathValue("repository"))
+	digest, err := parseDigest(r.PathValue("digest"))
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return "", "", false
+	}
+	return operator, digest, true
+}
+
+// parseDigest returns a sha256 digest as hex, given with or without "sha256:"
+func parseDigest(digest string) (string, error) {
+	_, pins, err := registry.SplitPins([]string{"image@" + digest}, nil)
+	if err != nil {
+		return "", fmt.Errorf("%q is not a sha256 digest", digest)
+	}
+	return pins["image"], nil
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"log/slog"
+	"time"
+)
+
+// archiveAfter is how long a ticket may go unchanged before it is archived,
+// 0 to never archive tickets automatically
+var archiveAfter = newDurationSetting(0)
+
+// archiveUntouched archives the tickets that haven't changed or been
+// commented on for archive.after. The poller calls it before every cycle, so only the leader
+// archives tickets.
+func archiveUntouched(state *AppState, now time.Time) {
+	after := archiveAfter.Get()
+	if after <= 0 || state.readOnly != nil {
+		return
+	}
+	for _, ticket := range sortedTickets(state.List()) {
+		lastChanged := ticket.LastChanged()
+		if latest := state.comments.Latest(ticket.ID); latest.After(lastChanged) {
+			lastChanged = latest
+		}
+		if ticket.Archived != nil || now.Sub(lastChanged) < after {
+			continue
+		}
+		_, changed, err := state.Archive(ticket.ID, true)
+		if err != nil {
+			slog.Error("Failed to archive untouched ticket", "ticket", ticket.ID, "error", err)
+			continue
+		}
+		if changed {
+			slog.Info("Archived untouched ticket", "ticket", ticket.ID, "last_changed", lastChanged)
+			state.audit.RecordAs("archiver", nil, "ticket.archive", ticket.ID, map[string]interface{}{"untouchedFor": Duration(after).String()})
+		}
+	}
+}
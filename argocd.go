@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"OpTrack/internal/argocd"
+)
+
+// TicketApplication is an ArgoCD application linked to a ticket
+type TicketApplication = argocd.Result
+
+// ArgoCDConfig is the ArgoCD server that tickets' applications are read from
+type ArgoCDConfig struct {
+	URL                   string   `yaml:"url"`   // e.g. https://argocd.example.com
+	Token                 string   `yaml:"token"` // An API token with get on the applications
+	Timeout               Duration `yaml:"timeout"`
+	InsecureSkipTLSVerify bool     `yaml:"insecureSkipTLSVerify"`
+}
+
+// newArgoCDMonitor returns nil when no ArgoCD server is configured
+func newArgoCDMonitor(cfg ArgoCDConfig, quay *QuayClient) *argocd.Monitor {
+	if cfg.URL == "" {
+		return nil
+	}
+	return argocd.New(argocd.NewClient(cfg.URL, cfg.Token, time.Duration(cfg.Timeout), cfg.InsecureSkipTLSVerify), quay)
+}
+
+func newArgoCDCommand(opts *cliOptions) *cobra.Command {
+	return &cobra.Command{
+		Use:   "argocd <ticket>",
+		Short: "Show the ArgoCD applications linked to a ticket and whether they deploy the latest images",
+		Long: `Show the ArgoCD applications linked to a ticket and whether they deploy the latest images.
+
+Every application's sync and health status is shown together with each of the
+ticket's operators: whether the images of the application's live resources
+include the operator's latest image on Quay.io. Link applications with
+"optrack ticket add --app". The server is set under argocd: in the config file.`,
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeFirstTicket(opts),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			backend, err := opts.backend()
+			if err != nil {
+				return err
+			}
+			apps, err := backend.TicketApplications(args[0])
+			if err != nil {
+				return fmt.Errorf("failed to get the applications of %s: %v", args[0], err)
+			}
+			return opts.printer(cmd).print(apps, func(wide bool) {
+				printApplications(cmd.OutOrStdout(), apps, wide)
+			})
+		},
+	}
+}
+
+// printApplications prints one row per application and operator, with full
+// digests and revisions when wide is set
+func printApplications(out io.Writer, apps []TicketApplication, wide bool) {
+	short := shortDigest
+	if wide {
+		short = func(digest string) string { return digest }
+	}
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "APPLICATION\tSYNC\tHEALTH\tREVISION\tOPERATOR\tSTATE\tLATEST\tIMAGE")
+	for _, app := range apps {
+		if app.Error != "" {
+			fmt.Fprintf(tw, "%s\t\t\t\t\t\t\t(%s)\n", app.Application, app.Error)
+			continue
+		}
+		revision := short(app.Revision)
+		if len(app.Operators) == 0 {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t\t\t\t\n", app.Application, app.Sync, app.Health, revision)
+		}
+		for _, op := range app.Operators {
+			image := op.Image
+			if op.Error != "" {
+				image = strings.TrimSpace(image + " (" + op.Error + ")")
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", app.Application, app.Sync, app.Health, revision, op.Operator, op.State, short(op.Latest), image)
+		}
+	}
+	tw.Flush()
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"html/template"
+	"net/http"
+	"time"
+
+	"OpTrack/internal/markdown"
+	"OpTrack/internal/web"
+)
+
+// devAssetsDir is where --dev serves the web UI from, relative to the repository root
+const devAssetsDir = "internal/web"
+
+// templateFuncs are available to every page template
+var templateFuncs = template.FuncMap{
+	"percent":  func(v *float64) float64 { return *v * 100 },
+	"millis":   func(v *float64) float64 { return *v * 1000 },
+	"url":      appURL,
+	"local":    localTime, // Replaced by the request's timezone in renderPage
+	"markdown": markdown.ToHTML,
+}
+
+// webAssets are the assets used by the page handlers
+var webAssets = web.New(web.Options{}, templateFuncs)
+
+// renderPage executes a page template, showing times in the request's
+// timezone and logging failures against the request
+func renderPage(w http.ResponseWriter, r *http.Request, name string, data interface{}) {
+	loc := requestLocation(r)
+	t, err := webAssets.Page(name, template.FuncMap{"local": func(t time.Time) time.Time { return t.In(loc) }})
+	if err != nil {
+		requestLogger(r).Error("Failed to load template", "template", name, "error", err)
+		httpError(w, r, "Failed to render page", http.StatusInternalServerError)
+		return
+	}
+	rememberTimezone(w, r)
+
+	if err := t.Execute(w, data); err != nil {
+		requestLogger(r).Error("Failed to render page", "template", name, "error", err)
+	}
+}
@@ -0,0 +1,336 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"OpTrack/internal/clock"
+)
+
+// Audit queries answer defaultAuditLimit entries unless asked otherwise, and
+// at most maxAuditLimit; the rest are on the following pages
+const (
+	defaultAuditLimit = 500
+	maxAuditLimit     = 5000
+)
+
+// AuditEntry records a single change made through OpTrack
+type AuditEntry struct {
+	Time      time.Time              `json:"time"`
+	Actor     string                 `json:"actor"`
+	Action    string                 `json:"action"`
+	Ticket    string                 `json:"ticket,omitempty"`
+	RequestID string                 `json:"requestId,omitempty"`
+	Details   map[string]interface{} `json:"details,omitempty"`
+}
+
+// AuditLog is an append-only JSON lines file of audit entries
+type AuditLog struct {
+	mu    sync.Mutex
+	path  string
+	clock clock.Clock
+}
+
+func NewAuditLog(dataDir string, clk clock.Clock) (*AuditLog, error) {
+	dir := filepath.Join(dataDir, "audit")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create audit directory: %v", err)
+	}
+	return &AuditLog{path: filepath.Join(dir, "audit.jsonl"), clock: clk}, nil
+}
+
+// actorHeaders are the request headers naming the user, in order of preference.
+// Set from the configuration at startup and on reload.
+var actorHeaders = newListSetting([]string{"X-Forwarded-User", "X-Forwarded-Email", "X-Remote-User"})
+
+// anonymousActor is the actor of requests without user headers
+const anonymousActor = "anonymous"
+
+// requestActor identifies who made a request. OpTrack has no login of its own,
+// so it relies on the user headers set by an authenticating reverse proxy.
+func requestActor(r *http.Request) string {
+	for _, header := range actorHeaders.Get() {
+		if user := r.Header.Get(header); user != "" {
+			return user
+		}
+	}
+	return anonymousActor
+}
+
+// actingUser returns the user a request acts for: the actor of the request,
+// which named must be empty or match, or with the admin token anyone named.
+// Otherwise it returns the error message and status to answer with.
+func actingUser(r *http.Request, named string) (user string, status int, message string) {
+	if projectAccess.Load().isAdmin(r) {
+		if named == "" {
+			return "", http.StatusBadRequest, "User required"
+		}
+		return named, http.StatusOK, ""
+	}
+	actor := requestActor(r)
+	if actor == anonymousActor {
+		return "", http.StatusUnauthorized, "A user is required, from the auth.actorHeaders set by the reverse proxy"
+	}
+	if named != "" && normalizeEmail(named) != normalizeEmail(actor) {
+		return "", http.StatusForbidden, "Other users need the admin token"
+	}
+	return actor, http.StatusOK, ""
+}
+
+// Record appends an entry attributed to the request's actor
+func (a *AuditLog) Record(r *http.Request, action, ticket string, details map[string]interface{}) {
+	a.RecordAs(requestActor(r), r, action, ticket, details)
+}
+
+// RecordAs appends an entry attributed to an explicit actor, e.g. a Slack user.
+// Failures are logged rather than failing the change being audited.
+func (a *AuditLog) RecordAs(actor string, r *http.Request, action, ticket string, details map[string]interface{}) {
+	if a == nil {
+		return
+	}
+
+	entry := AuditEntry{
+		Time:      a.clock.Now().UTC(),
+		Actor:     actor,
+		Action:    action,
+		Ticket:    ticket,
+		RequestID: requestID(r),
+		Details:   details,
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		slog.Error("Failed to encode audit entry", "action", action, "error", err)
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	f, err := os.OpenFile(a.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		slog.Error("Failed to open audit log", "error", err)
+		return
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		slog.Error("Failed to write audit entry", "action", action, "error", err)
+	}
+}
+
+// AuditFilter selects audit entries. Zero values match everything.
+type AuditFilter struct {
+	Actor  string
+	Ticket string
+	Action string
+	Since  time.Time
+	Until  time.Time
+	Limit  int // Entries returned after skipping Offset, 0 for all of them, which only CSV exports ask for
+	Offset int
+	// Visible, when set, leaves out entries the user may not see
+	Visible func(AuditEntry) bool
+}
+
+func (f AuditFilter) matches(e AuditEntry) bool {
+	switch {
+	case f.Actor != "" && e.Actor != f.Actor:
+		return false
+	case f.Ticket != "" && e.Ticket != f.Ticket:
+		return false
+	case f.Action != "" && e.Action != f.Action:
+		return false
+	case !f.Since.IsZero() && e.Time.Before(f.Since):
+		return false
+	case !f.Until.IsZero() && !e.Time.Before(f.Until):
+		return false
+	case f.Visible != nil && !f.Visible(e):
+		return false
+	}
+	return true
+}
+
+// Query returns the page of matching entries the filter asks for, newest
+// first, and how many entries match in all
+func (a *AuditLog) Query(filter AuditFilter) ([]AuditEntry, int, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	f, err := os.Open(a.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []AuditEntry{}, 0, nil
+		}
+		return nil, 0, err
+	}
+	defer f.Close()
+
+	var matches []AuditEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var entry AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			slog.Warn("Skipping malformed audit entry", "error", err)
+			continue
+		}
+		if filter.matches(entry) {
+			matches = append(matches, entry)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	for i, j := 0, len(matches)-1; i < j; i, j = i+1, j-1 {
+		matches[i], matches[j] = matches[j], matches[i]
+	}
+	total := len(matches)
+	if filter.Limit > 0 {
+		matches = pageOf(matches, listPage{Limit: filter.Limit, Offset: filter.Offset})
+	} else {
+		matches = matches[min(filter.Offset, total):]
+	}
+	if len(matches) == 0 {
+		matches = []AuditEntry{}
+	}
+	return matches, total, nil
+}
+
+// parseAuditFilter reads actor, ticket, action, since, until, limit and offset
+// query parameters. Times are RFC 3339 or YYYY-MM-DD.
+func parseAuditFilter(r *http.Request) (AuditFilter, error) {
+	query := r.URL.Query()
+	filter := AuditFilter{
+		Actor:  query.Get("actor"),
+		Ticket: query.Get("ticket"),
+		Action: query.Get("action"),
+	}
+
+	parseTime := func(name string) (time.Time, error) {
+		value := query.Get(name)
+		if value == "" {
+			return time.Time{}, nil
+		}
+		if t, err := time.Parse(time.RFC3339, value); err == nil {
+			return t, nil
+		}
+		if t, err := time.Parse("2006-01-02", value); err == nil {
+			return t, nil
+		}
+		return time.Time{}, fmt.Errorf("invalid %s %q: use RFC 3339 or YYYY-MM-DD", name, value)
+	}
+
+	var err error
+	if filter.Since, err = parseTime("since"); err != nil {
+		return filter, err
+	}
+	if filter.Until, err = parseTime("until"); err != nil {
+		return filter, err
+	}
+
+	limit := defaultAuditLimit
+	if query.Get("format") == "csv" {
+		limit = 0 // Exports have every entry, as before the log was paged, unless they ask for a page
+	}
+	page, err := parsePage(r, limit, maxAuditLimit)
+	if err != nil {
+		return filter, err
+	}
+	filter.Limit, filter.Offset = page.Limit, page.Offset
+	return filter, nil
+}
+
+// auditVisible returns whether the user of a request may see an entry: entries
+// about a ticket only show to those who may see the ticket
+func auditVisible(r *http.Request, state *AppState) func(AuditEntry) bool {
+	return func(e AuditEntry) bool {
+		return e.Ticket == "" || canViewID(r, state, e.Ticket)
+	}
+}
+
+// handleAudit returns the matching audit entries the user may see
+func (a *AuditLog) handleAudit(state *AppState) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			httpError(w, r, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		filter, err := parseAuditFilter(r)
+		if err != nil {
+			httpError(w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
+		filter.Visible = auditVisible(r, state)
+		a.writeAudit(w, r, filter)
+	}
+}
+
+// writeAudit answers the entries a filter selects as JSON, or CSV with format=csv
+func (a *AuditLog) writeAudit(w http.ResponseWriter, r *http.Request, filter AuditFilter) {
+	entries, total, err := a.Query(filter)
+	if err != nil {
+		requestLogger(r).Error("Failed to query audit log", "error", err)
+		httpError(w, r, "Failed to query audit log", http.StatusInternalServerError)
+		return
+	}
+	setPageHeaders(w, r, listPage{Limit: filter.Limit, Offset: filter.Offset}, total)
+
+	if r.URL.Query().Get("format") != "csv" {
+		json.NewEncoder(w).Encode(entries)
+		return
+	}
+
+	loc := requestLocation(r)
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="optrack-audit-%s.csv"`, a.clock.Now().Format("20060102")))
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"time", "actor", "action", "ticket", "request_id", "details"})
+	for _, e := range entries {
+		details := ""
+		if len(e.Details) > 0 {
+			data, _ := json.Marshal(e.Details)
+			details = string(data)
+		}
+		cw.Write([]string{e.Time.In(loc).Format(time.RFC3339), e.Actor, e.Action, e.Ticket, e.RequestID, details})
+	}
+	cw.Flush()
+}
+
+// handleAuditPage renders a filterable view of the audit trail
+func (a *AuditLog) handleAuditPage(state *AppState) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		data := struct {
+			Query   url.Values
+			Entries []AuditEntry
+			Next    template.URL // Link to the page of older entries, if any
+			Error   string
+		}{Query: r.URL.Query()}
+
+		filter, err := parseAuditFilter(r)
+		if err == nil {
+			var total int
+			filter.Visible = auditVisible(r, state)
+			data.Entries, total, err = a.Query(filter)
+			if next := (listPage{Limit: filter.Limit, Offset: filter.Offset}).next(r, total); next != nil {
+				data.Next = template.URL("?" + next.Encode())
+			}
+		}
+		if err != nil {
+			data.Error = err.Error()
+		}
+
+		renderPage(w, r, "audit.html", data)
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"OpTrack/internal/baseimage"
+	"OpTrack/internal/kube"
+	"OpTrack/internal/registry"
+)
+
+// BaseImagesConfig is how the base image of the latest image of each
+// operator is identified and checked for a newer image. Nothing is checked
+// unless enabled.
+type BaseImagesConfig struct {
+	Enabled  bool     `yaml:"enabled"`
+	Images   []string `yaml:"images"`   // Bases to look for in images that don't record theirs, e.g. registry.access.redhat.com/ubi9/ubi-minimal; the tag, default latest, names the newest image
+	History  int      `yaml:"history"`  // How many older tags of each image are compared to tell which one an image is built on
+	Registry string   `yaml:"registry"` // Defaults to the host of quay.url
+	Username string   `yaml:"username"` // Only used for the operators' registry; bases elsewhere are pulled anonymously
+	Password string   `yaml:"password"`
+	Timeout  Duration `yaml:"timeout"`
+}
+
+// defaultBaseImageHistory is how many older tags of each base are compared
+const defaultBaseImageHistory = 20
+
+// newBaseImageChecker returns nil when base images aren't checked
+func newBaseImageChecker(cfg BaseImagesConfig, quay QuayConfig, traffic quayTraffic) (registry.BaseImageChecker, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	host, err := imageRegistry(cfg.Registry, quay)
+	if err != nil {
+		return nil, err
+	}
+	opts := baseimage.Options{Registry: host, History: cfg.History}
+	for _, image := range cfg.Images {
+		opts.Bases = append(opts.Bases, kube.ParseImage(image))
+	}
+	private := traffic.ociClient(cfg.Username, cfg.Password, cfg.Timeout)
+	public := traffic.ociClient("", "", cfg.Timeout)
+	return baseimage.NewChecker(private, public, opts), nil
+}
+
+// baseImageState is the base image column of an operator: its state and
+// base, or "" when base images aren't checked
+func baseImageState(b *registry.BaseImage) string {
+	switch {
+	case b == nil:
+		return ""
+	case b.Name == "":
+		return b.State
+	case b.Tag != "":
+		return b.State + " (" + b.Name + ", on " + b.Tag + ")"
+	}
+	return b.State + " (" + b.Name + ")"
+}
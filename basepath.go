@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"OpTrack/internal/middleware"
+)
+
+// basePath is the URL prefix OpTrack is served under behind a reverse proxy,
+// e.g. "/optrack", or empty when it is served from the root. Set at startup.
+var basePath string
+
+// normalizeBasePath turns "optrack/" or "/optrack/" into "/optrack", and "/" into ""
+func normalizeBasePath(p string) string {
+	p = strings.Trim(p, "/")
+	if p == "" {
+		return ""
+	}
+	return "/" + p
+}
+
+// validBasePath checks a basePath setting
+func validBasePath(p string) error {
+	if strings.ContainsAny(p, "?#% ") {
+		return fmt.Errorf("%q must be a plain URL path such as \"/optrack\"", p)
+	}
+	return nil
+}
+
+// appURL returns the path of an OpTrack page or endpoint as seen by the browser
+func appURL(path string) string {
+	return basePath + path
+}
+
+// withBasePath appends the base path to an external URL of OpTrack unless it
+// already ends with it
+func withBasePath(externalURL string) string {
+	base := strings.TrimSuffix(externalURL, "/")
+	if !strings.HasSuffix(base, basePath) {
+		base += basePath
+	}
+	return base
+}
+
+// externalBaseURL is the absolute URL OpTrack is served at: OPTRACK_EXTERNAL_URL
+// when set, or else the scheme and host the request came in on
+func externalBaseURL(r *http.Request) string {
+	if externalURL := os.Getenv("OPTRACK_EXTERNAL_URL"); externalURL != "" {
+		return withBasePath(externalURL)
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto == "http" || proto == "https" {
+		scheme = proto
+	}
+	return scheme + "://" + r.Host + basePath
+}
+
+// stripBasePath routes requests under prefix to h with the prefix removed.
+// Requests without the prefix are passed through unchanged, so it works both
+// with proxies that forward the full path and with ones that strip it.
+func stripBasePath(prefix string) middleware.Middleware {
+	return func(h http.Handler) http.Handler {
+		if prefix == "" {
+			return h
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == prefix {
+				// Relative links only resolve against the directory form
+				target := prefix + "/"
+				if r.URL.RawQuery != "" {
+					target += "?" + r.URL.RawQuery
+				}
+				http.Redirect(w, r, target, http.StatusMovedPermanently)
+				return
+			}
+			if !strings.HasPrefix(r.URL.Path, prefix+"/") {
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			r2 := new(http.Request)
+			*r2 = *r
+			r2.URL = new(url.URL)
+			*r2.URL = *r.URL
+			r2.URL.Path = strings.TrimPrefix(r.URL.Path, prefix)
+			r2.URL.RawPath = strings.TrimPrefix(r.URL.RawPath, prefix)
+			h.ServeHTTP(w, r2)
+		})
+	}
+}
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"slices"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"OpTrack/internal/api"
+	"OpTrack/internal/clock"
+	"OpTrack/internal/registry"
+	"OpTrack/internal/store"
+	"OpTrack/quaytest"
+)
+
+// benchResult is the outcome of `optrack bench`
+type benchResult struct {
+	Tickets   int          `json:"tickets"`
+	Operators int          `json:"operators"` // Per ticket
+	Pool      int          `json:"pool"`      // Distinct operators
+	Latency   string       `json:"latency"`   // Of every mock registry response
+	Phases    []benchPhase `json:"phases"`
+}
+
+// benchPhase measures one part of a bench run: a poll cycle or a burst of
+// page views
+type benchPhase struct {
+	Name         string  `json:"name"`
+	Checks       int     `json:"checks"`       // Tickets checked
+	Lookups      int     `json:"lookups"`      // Operator statuses looked up
+	QuayRequests int     `json:"quayRequests"` // Requests that reached the mock registry
+	Seconds      float64 `json:"seconds"`
+	PerSecond    float64 `json:"perSecond"` // Lookups per second
+	// Latencies of checking one ticket, in milliseconds
+	P50 float64 `json:"p50"`
+	P90 float64 `json:"p90"`
+	P99 float64 `json:"p99"`
+	Max float64 `json:"max"`
+}
+
+func newBenchCommand(opts *cliOptions) *cobra.Command {
+	var (
+		tickets     int
+		operators   int
+		pool        int
+		cycles      int
+		views       int
+		concurrency int
+		latency     time.Duration
+		failureRate float64
+		budget      int
+		seed        int64
+	)
+
+	cmd := &cobra.Command{
+		Use:   "bench",
+		Short: "Measure the poller and status cache against a mock registry",
+		Long: `Bench tracks --tickets tickets of --operators operators each, drawn from a
+pool of --pool operators, in a temporary data directory, and looks them up
+in a built-in mock Quay.io whose responses take --latency.
+
+It runs --cycles poll cycles, checking every ticket as the poller does, the
+first with an empty status cache, then --views page views of random tickets
+from --concurrency clients at once. With quay.staleTTL set, a restart phase
+then saves the status cache as it expires, loads it into a new client as
+the server does at startup, and runs the page views again: they should be
+answered from the expired cache without waiting for the registry, which
+should get one lookup of each operator, as in the first poll cycle. For
+each phase it reports the lookups per second, the requests that reached the
+registry and the percentiles of the time taken to check one ticket, so
+changes to the poller and cache can be compared. The quay settings of the
+config apply, except the URL and requestsPerMinute, which is --budget.`,
+		Example: "  optrack bench --tickets 500 --operators 10 --latency 50ms -o json",
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if tickets < 1 || operators < 1 || concurrency < 1 {
+				return fmt.Errorf("--tickets, --operators and --concurrency must be at least 1")
+			}
+			if cycles < 0 || views < 0 || budget < 0 {
+				return fmt.Errorf("--cycles, --views and --budget must not be negative")
+			}
+			if failureRate < 0 || failureRate > 1 {
+				return fmt.Errorf("--failure-rate must be between 0 and 1")
+			}
+			pool = max(pool, operators)
+
+			mock := quaytest.NewServer()
+			defer mock.Close()
+			mock.SetLatency(latency)
+			mock.SetFailureRate(failureRate, seed)
+
+			dataDir, err := os.MkdirTemp("", "optrack-bench-")
+			if err != nil {
+				return err
+			}
+			defer os.RemoveAll(dataDir)
+			state, err := NewAppState(dataDir, clock.System)
+			if err != nil {
+				return err
+			}
+			r := rand.New(rand.NewSource(seed))
+			list, err := benchTickets(state, r, tickets, operators, pool)
+			if err != nil {
+				return err
+			}
+
+			quayCfg := opts.cfg.Quay
+			quayCfg.URL, quayCfg.RequestsPerMinute = mock.URL, budget
+			quay := NewQuayClient(quayCfg, newQuayTraffic(quayCfg, state.clock), PluginConfig{}, nil, nil, nil, nil, registry.Scanning{})
+			defer quay.Close()
+			poller := NewPoller(state, quay, NewEventBus(), time.Duration(opts.cfg.PollInterval))
+
+			result := benchResult{Tickets: tickets, Operators: operators, Pool: pool, Latency: latency.String()}
+			for i := 0; i < cycles; i++ {
+				requests := mock.Requests()
+				phase := benchCycle(poller, state.List())
+				phase.Name = fmt.Sprintf("poll %d", i+1)
+				phase.QuayRequests = mock.Requests() - requests
+				result.Phases = append(result.Phases, phase)
+			}
+			if views > 0 {
+				requests := mock.Requests()
+				phase := benchViews(quay, list, views, concurrency, r.Int63())
+				phase.QuayRequests = mock.Requests() - requests
+				result.Phases = append(result.Phases, phase)
+			}
+			if views > 0 && quayCfg.CacheTTL > 0 && quayCfg.StaleTTL > 0 {
+				restarted, err := benchRestart(dataDir, quayCfg, quay, state.clock)
+				if err != nil {
+					return err
+				}
+				defer restarted.Close()
+				requests := mock.Requests()
+				phase := benchViews(restarted, list, views, concurrency, r.Int63())
+				phase.Name = "restart"
+				phase.QuayRequests = settledRequests(mock, latency) - requests
+				result.Phases = append(result.Phases, phase)
+			}
+			return opts.printer(cmd).print(result, func(bool) {
+				printBench(cmd.OutOrStdout(), result)
+			})
+		},
+	}
+
+	cmd.Flags().IntVar(&tickets, "tickets", 100, "Number of tickets")
+	cmd.Flags().IntVar(&operators, "operators", 5, "Operators per ticket")
+	cmd.Flags().IntVar(&pool, "pool", 200, "Number of distinct operators the tickets share, at least --operators")
+	cmd.Flags().IntVar(&cycles, "cycles", 2, "Poll cycles to run")
+	cmd.Flags().IntVar(&views, "views", 1000, "Page views to run after the poll cycles")
+	cmd.Flags().IntVar(&concurrency, "concurrency", 8, "Page views run at once")
+	cmd.Flags().DurationVar(&latency, "latency", 20*time.Millisecond, "Delay of every mock registry response")
+	cmd.Flags().Float64Var(&failureRate, "failure-rate", 0, "Fraction of mock registry requests, 0 to 1, that fail with a 503")
+	cmd.Flags().IntVar(&budget, "budget", 0, "Requests per minute to the mock registry, 0 for no limit")
+	cmd.Flags().Int64Var(&seed, "seed", 1, "Random seed")
+	return cmd
+}
+
+// benchTickets saves n tickets of operators operators each, drawn from a
+// pool of pool operators
+func benchTickets(state *AppState, r *rand.Rand, n, operators, pool int) ([]JiraTicket, error) {
+	names := seedOperators(r, pool)
+	list := make([]JiraTicket, 0, n)
+	for i := 0; i < n; i++ {
+		var ops []string
+		for _, j := range r.Perm(len(names))[:operators] {
+			ops = append(ops, names[j])
+		}
+		ticket := JiraTicket{ID: fmt.Sprintf("BENCH-%d", 1001+i), Operators: store.OperatorsNamed(ops)}
+		if _, err := state.Put(ticket); err != nil {
+			return nil, fmt.Errorf("failed to save %s: %v", ticket.ID, err)
+		}
+		list = append(list, ticket)
+	}
+	return list, nil
+}
+
+// benchCycle checks every ticket one after another, as a poll cycle does
+func benchCycle(p *Poller, tickets map[string]JiraTicket) benchPhase {
+	latencies := make([]time.Duration, 0, len(tickets))
+	lookups := 0
+	start := time.Now()
+	for _, ticket := range tickets {
+		checked := time.Now()
+		statuses := p.checkTicket(ticket)
+		p.state.setRollup(ticket, ticketRollup(ticket, statuses))
+		latencies = append(latencies, time.Since(checked))
+		lookups += len(statuses)
+	}
+	return newBenchPhase(latencies, lookups, time.Since(start))
+}
+
+// benchRestart saves the status cache of quay as it expires, and loads it
+// into a new client the way the server does at startup
+func benchRestart(dataDir string, cfg QuayConfig, quay *QuayClient, clk clock.Clock) (*QuayClient, error) {
+	entries := quay.CacheEntries()
+	now := time.Now()
+	for i := range entries {
+		entries[i].Expires = now
+	}
+	expired := NewQuayClient(cfg, newQuayTraffic(cfg, clk), PluginConfig{}, nil, nil, nil, nil, registry.Scanning{})
+	defer expired.Close()
+	expired.LoadCache(entries)
+	cache, err := newStatusCache(dataDir, cfg, expired)
+	if err != nil {
+		return nil, err
+	}
+	if err := cache.write(); err != nil {
+		return nil, err
+	}
+	restarted := NewQuayClient(cfg, newQuayTraffic(cfg, clk), PluginConfig{}, nil, nil, nil, nil, registry.Scanning{})
+	if _, err := newStatusCache(dataDir, cfg, restarted); err != nil {
+		restarted.Close()
+		return nil, err
+	}
+	return restarted, nil
+}
+
+// settledRequests waits for the lookups made in the background to finish,
+// until the mock registry gets no requests for a few of its responses, and
+// returns how many requests it got in all
+func settledRequests(mock *quaytest.Server, latency time.Duration) int {
+	requests := mock.Requests()
+	for {
+		time.Sleep(3*latency + 50*time.Millisecond)
+		n := mock.Requests()
+		if n == requests {
+			return n
+		}
+		requests = n
+	}
+}
+
+// benchViews looks up the statuses of random tickets from concurrency
+// clients, as pages showing them do
+func benchViews(quay *QuayClient, tickets []JiraTicket, views, concurrency int, seed int64) benchPhase {
+	var (
+		mu        sync.Mutex
+		latencies = make([]time.Duration, 0, views)
+		lookups   int
+		wg        sync.WaitGroup
+	)
+	r := rand.New(rand.NewSource(seed))
+	picks := make(chan JiraTicket)
+	start := time.Now()
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ticket := range picks {
+				viewed := time.Now()
+				statuses := api.TicketStatuses(quay, ticket, localTime(viewed))
+				elapsed := time.Since(viewed)
+				mu.Lock()
+				latencies = append(latencies, elapsed)
+				lookups += len(statuses)
+				mu.Unlock()
+			}
+		}()
+	}
+	for i := 0; i < views; i++ {
+		picks <- tickets[r.Intn(len(tickets))]
+	}
+	close(picks)
+	wg.Wait()
+	phase := newBenchPhase(latencies, lookups, time.Since(start))
+	phase.Name = "views"
+	return phase
+}
+
+func newBenchPhase(latencies []time.Duration, lookups int, elapsed time.Duration) benchPhase {
+	slices.Sort(latencies)
+	phase := benchPhase{
+		Checks:  len(latencies),
+		Lookups: lookups,
+		Seconds: elapsed.Seconds(),
+		P50:     milliseconds(benchPercentile(latencies, 0.5)),
+		P90:     milliseconds(benchPercentile(latencies, 0.9)),
+		P99:     milliseconds(benchPercentile(latencies, 0.99)),
+	}
+	if len(latencies) > 0 {
+		phase.Max = milliseconds(latencies[len(latencies)-1])
+	}
+	if elapsed > 0 {
+		phase.PerSecond = float64(lookups) / elapsed.Seconds()
+	}
+	return phase
+}
+
+// benchPercentile returns the p-th (0 to 1) of sorted durations, 0 for none
+func benchPercentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	return sorted[min(int(p*float64(len(sorted))), len(sorted)-1)]
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+func printBench(out io.Writer, result benchResult) {
+	fmt.Fprintf(out, "%d tickets of %d operators from a pool of %d, registry latency %s\n\n",
+		result.Tickets, result.Operators, result.Pool, result.Latency)
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "PHASE\tCHECKS\tLOOKUPS\tQUAY REQUESTS\tSECONDS\tLOOKUPS/S\tP50 MS\tP90 MS\tP99 MS\tMAX MS")
+	for _, p := range result.Phases {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%.2f\t%.0f\t%.2f\t%.2f\t%.2f\t%.2f\n",
+			p.Name, p.Checks, p.Lookups, p.QuayRequests, p.Seconds, p.PerSecond, p.P50, p.P90, p.P99, p.Max)
+	}
+	tw.Flush()
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"OpTrack/internal/clock"
+	"OpTrack/internal/registry"
+	"OpTrack/quaytest"
+)
+
+// newBench tracks 100 tickets of 5 operators each from a pool of 200, looked
+// up in a mock registry with the default quay settings and no request budget,
+// as `optrack bench` does with its default flags
+func newBench(b *testing.B) (*Poller, *QuayClient, []JiraTicket) {
+	b.Helper()
+	mock := quaytest.NewServer()
+	b.Cleanup(mock.Close)
+	state, err := NewAppState(b.TempDir(), clock.System)
+	if err != nil {
+		b.Fatal(err)
+	}
+	tickets, err := benchTickets(state, rand.New(rand.NewSource(1)), 100, 5, 200)
+	if err != nil {
+		b.Fatal(err)
+	}
+	cfg := defaultConfig().Quay
+	cfg.URL, cfg.RequestsPerMinute = mock.URL, 0
+	quay := NewQuayClient(cfg, newQuayTraffic(cfg, state.clock), PluginConfig{}, nil, nil, nil, nil, registry.Scanning{})
+	b.Cleanup(quay.Close)
+	return NewPoller(state, quay, NewEventBus(), time.Minute), quay, tickets
+}
+
+// BenchmarkPollCycle runs poll cycles after the first, which fills the
+// status cache
+func BenchmarkPollCycle(b *testing.B) {
+	poller, _, _ := newBench(b)
+	benchCycle(poller, poller.state.List())
+	b.ResetTimer()
+	var lookups int
+	for i := 0; i < b.N; i++ {
+		lookups += benchCycle(poller, poller.state.List()).Lookups
+	}
+	b.ReportMetric(float64(lookups)/b.Elapsed().Seconds(), "lookups/s")
+}
+
+// BenchmarkStatusViews runs page views of random tickets from 8 clients at
+// once, the first of each operator filling the status cache
+func BenchmarkStatusViews(b *testing.B) {
+	_, quay, tickets := newBench(b)
+	b.ResetTimer()
+	phase := benchViews(quay, tickets, b.N, 8, 1)
+	b.ReportMetric(phase.PerSecond, "lookups/s")
+	b.ReportMetric(phase.P99, "p99-ms")
+}
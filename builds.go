@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"OpTrack/internal/builds"
+	"OpTrack/internal/kube"
+	"OpTrack/internal/registry"
+)
+
+// BuildsConfig is the build systems asked which build produced the latest
+// image of each operator. The build is attached to the operator's status.
+type BuildsConfig struct {
+	Konflux KonfluxConfig `yaml:"konflux"`
+	OSBS    OSBSConfig    `yaml:"osbs"`
+}
+
+// KonfluxConfig is the Konflux tenant namespaces whose build PipelineRuns
+// are searched for images. The cluster is reached like the controller's.
+type KonfluxConfig struct {
+	Namespaces []string `yaml:"namespaces"`
+	Kubeconfig string   `yaml:"kubeconfig"`
+	Context    string   `yaml:"context"`
+}
+
+// kubeConfig returns how to reach the cluster the tenant namespaces are on
+func (k KonfluxConfig) kubeConfig() (*kube.Config, error) {
+	if k.Kubeconfig == "" && k.Context == "" && kube.InCluster() {
+		return kube.InClusterConfig()
+	}
+	path := k.Kubeconfig
+	if path == "" {
+		path = kube.DefaultKubeconfig()
+	}
+	return kube.LoadKubeconfig(path, k.Context)
+}
+
+// OSBSConfig is the Koji or Brew hub OSBS records container builds in
+type OSBSConfig struct {
+	Hub     string   `yaml:"hub"` // The XML-RPC hub URL, e.g. https://koji.example.com/kojihub
+	Web     string   `yaml:"web"` // The web UI, for build links
+	Timeout Duration `yaml:"timeout"`
+}
+
+// newBuildLookup returns nil when no build system is configured
+func newBuildLookup(cfg BuildsConfig) (registry.BuildLookup, error) {
+	var chain builds.Chain
+	if len(cfg.Konflux.Namespaces) > 0 {
+		kc, err := cfg.Konflux.kubeConfig()
+		if err != nil {
+			return nil, fmt.Errorf("konflux: %v", err)
+		}
+		chain = append(chain, builds.NewKonflux(kube.NewClient(kc), cfg.Konflux.Namespaces))
+	}
+	if cfg.OSBS.Hub != "" {
+		chain = append(chain, builds.NewOSBS(cfg.OSBS.Hub, cfg.OSBS.Web, time.Duration(cfg.OSBS.Timeout)))
+	}
+	if len(chain) == 0 {
+		return nil, nil
+	}
+	return chain, nil
+}
+
+// buildName names a build by its NVR, or by its build system and ID
+func buildName(b *registry.Build) string {
+	switch {
+	case b == nil:
+		return ""
+	case b.NVR != "":
+		return b.NVR
+	default:
+		return b.System + " " + b.ID
+	}
+}
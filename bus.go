@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// eventBusBuffer is how far a subscriber may fall behind before publishing
+// waits for it. Nothing is dropped, so a stuck subscriber eventually holds up
+// the poller rather than losing notifications.
+const eventBusBuffer = 256
+
+// PollCycle is the result of a poll cycle that checked every ticket
+type PollCycle struct {
+	Start   time.Time
+	End     time.Time
+	Tickets []TicketCheck
+}
+
+// TicketCheck is a ticket and the operator statuses a poll cycle found for it
+type TicketCheck struct {
+	Ticket   JiraTicket
+	Statuses []OperatorStatus
+}
+
+// EventBus carries what the poller finds to everything that acts on it, so
+// notifications, the event stream, metrics and alerting stay out of the
+// fetch path. Every subscriber runs on its own goroutine and sees messages in
+// the order they were published.
+type EventBus struct {
+	mu     sync.RWMutex
+	subs   []*busSubscriber
+	closed bool
+	wg     sync.WaitGroup
+}
+
+type busSubscriber struct {
+	name  string
+	event func(Event)     // nil if not subscribed to events
+	cycle func(PollCycle) // nil if not subscribed to poll cycles
+	queue chan func()
+}
+
+func NewEventBus() *EventBus {
+	return &EventBus{}
+}
+
+// SubscribeEvents calls handle with every ticket or operator state change
+func (b *EventBus) SubscribeEvents(name string, handle func(Event)) {
+	b.subscribe(&busSubscriber{name: name, event: handle})
+}
+
+// SubscribeCycles calls handle after every poll cycle that checked every ticket
+func (b *EventBus) SubscribeCycles(name string, handle func(PollCycle)) {
+	b.subscribe(&busSubscriber{name: name, cycle: handle})
+}
+
+func (b *EventBus) subscribe(sub *busSubscriber) {
+	sub.queue = make(chan func(), eventBusBuffer)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+	b.subs = append(b.subs, sub)
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		for deliver := range sub.queue {
+			sub.run(deliver)
+		}
+	}()
+}
+
+// run delivers one message, so a panicking subscriber loses that message
+// rather than every later one
+func (s *busSubscriber) run(deliver func()) {
+	defer func() {
+		if err := recover(); err != nil {
+			slog.Error("Event bus subscriber panicked", "subscriber", s.name, "panic", err)
+		}
+	}()
+	deliver()
+}
+
+// PublishEvent hands a state change to every event subscriber
+func (b *EventBus) PublishEvent(ev Event) {
+	b.publish(func(sub *busSubscriber) func() {
+		if sub.event == nil {
+			return nil
+		}
+		return func() { sub.event(ev) }
+	})
+}
+
+// PublishCycle hands a finished poll cycle to every cycle subscriber
+func (b *EventBus) PublishCycle(cycle PollCycle) {
+	b.publish(func(sub *busSubscriber) func() {
+		if sub.cycle == nil {
+			return nil
+		}
+		return func() { sub.cycle(cycle) }
+	})
+}
+
+func (b *EventBus) publish(message func(sub *busSubscriber) func()) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if b.closed {
+		return
+	}
+	for _, sub := range b.subs {
+		if deliver := message(sub); deliver != nil {
+			sub.queue <- deliver
+		}
+	}
+}
+
+// Close stops accepting messages and waits until ctx expires for the
+// subscribers to handle the ones already published
+func (b *EventBus) Close(ctx context.Context) error {
+	b.mu.Lock()
+	if !b.closed {
+		b.closed = true
+		for _, sub := range b.subs {
+			close(sub.queue)
+		}
+	}
+	b.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		b.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
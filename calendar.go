@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"OpTrack/internal/api"
+	"OpTrack/internal/store"
+)
+
+// icsLineLimit is the longest line RFC 5545 allows, in octets
+const icsLineLimit = 75
+
+// rebuildDeadline is a day an operator on a ticket is due: the day it goes
+// stale unless it is rebuilt before then, or its expected-by date
+type rebuildDeadline struct {
+	Ticket   JiraTicket
+	Operator OperatorStatus
+	Due      time.Time
+	Expected bool // Due is the expected-by date rather than the day it goes stale
+}
+
+// rebuildDeadlines returns the day every operator that has a status goes
+// stale, and the expected-by date of every operator not yet rebuilt, in the
+// order of the tickets and their operators
+func rebuildDeadlines(tickets []JiraTicket, quay *QuayClient, now time.Time) []rebuildDeadline {
+	var out []rebuildDeadline
+	for _, ticket := range tickets {
+		_, stale := ticketThresholds(ticket)
+		for _, status := range api.TicketStatuses(quay, ticket, now) {
+			if status.Status == "OK" {
+				out = append(out, rebuildDeadline{Ticket: ticket, Operator: status, Due: status.LastUpdated.Add(stale)})
+			}
+			// DaysLeft is only set until the operator is rebuilt
+			if status.DaysLeft != nil {
+				if due, err := time.Parse(store.DateLayout, status.ExpectedBy); err == nil {
+					out = append(out, rebuildDeadline{Ticket: ticket, Operator: status, Due: due, Expected: true})
+				}
+			}
+		}
+	}
+	return out
+}
+
+// handleCalendar serves the rebuild deadlines of every ticket at
+// /feeds/deadlines.ics, and of one ticket at /feeds/{ticket}/deadlines.ics,
+// as an iCalendar feed with an all-day event per deadline
+func handleCalendar(state *AppState, quay *QuayClient) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var tickets []JiraTicket
+		name := "OpTrack rebuild deadlines"
+		if id := r.PathValue("ticket"); id != "" {
+			ticket, ok := state.Get(id)
+			if !ok {
+				httpError(w, r, store.ErrTicketNotFound.Error(), http.StatusNotFound)
+				return
+			}
+			tickets = []JiraTicket{ticket}
+			name += " for " + id
+		} else {
+			for _, ticket := range sortedTickets(visibleTickets(r, state.List())) {
+				if ticket.Archived == nil {
+					tickets = append(tickets, ticket)
+				}
+			}
+		}
+
+		now := state.clock.Now()
+		w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+		writeCalendar(w, name, externalBaseURL(r), rebuildDeadlines(tickets, quay, now), now)
+	}
+}
+
+// writeCalendar writes the deadlines as an RFC 5545 calendar. The UIDs of
+// stale events include the digest, so a rebuild replaces the event rather
+// than moving it.
+func writeCalendar(w io.Writer, name, base string, deadlines []rebuildDeadline, now time.Time) {
+	host := strings.TrimPrefix(strings.TrimPrefix(base, "https://"), "http://")
+	host, _, _ = strings.Cut(host, "/")
+	stamp := now.UTC().Format("20060102T150405Z")
+
+	lines := []string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//OpTrack//Rebuild deadlines//EN",
+		"CALSCALE:GREGORIAN",
+		"METHOD:PUBLISH",
+		"X-WR-CALNAME:" + icsEscape(name),
+	}
+	for _, d := range deadlines {
+		var uid, summary, description string
+		if d.Expected {
+			// Tied to the date, so changing it replaces the event
+			uid = fmt.Sprintf("%s/%s@expected-%s@%s", d.Ticket.ID, d.Operator.Name, d.Due.Format("20060102"), host)
+			summary = fmt.Sprintf("%s: %s expected", d.Ticket.ID, d.Operator.Name)
+			description = fmt.Sprintf("A fixed build of %s is expected by %s. The event goes once it is rebuilt.", d.Operator.Name, d.Operator.ExpectedBy)
+			if d.Operator.Owner != "" {
+				description += "\nOwner: " + d.Operator.Owner
+			}
+		} else {
+			uid = fmt.Sprintf("%s/%s@%s@%s", d.Ticket.ID, d.Operator.Name, shortDigest(d.Operator.SHA256), host)
+			summary = fmt.Sprintf("%s: %s goes stale", d.Ticket.ID, d.Operator.Name)
+			description = fmt.Sprintf("The latest image of %s was built on %s and goes stale after %d days unless it is rebuilt.\nDigest: %s",
+				d.Operator.Name, d.Operator.LastUpdated.UTC().Format("2006-01-02"), int(d.Due.Sub(d.Operator.LastUpdated).Hours()/24), d.Operator.SHA256)
+			if isRebuilt(d.Ticket, d.Operator) {
+				description += "\nRebuilt since the ticket was added."
+			}
+		}
+		lines = append(lines,
+			"BEGIN:VEVENT",
+			"UID:"+uid,
+			"DTSTAMP:"+stamp,
+			"DTSTART;VALUE=DATE:"+d.Due.UTC().Format("20060102"),
+			"DTEND;VALUE=DATE:"+d.Due.UTC().AddDate(0, 0, 1).Format("20060102"),
+			"SUMMARY:"+icsEscape(summary),
+			"DESCRIPTION:"+icsEscape(description),
+			"URL:"+base+"/ticket/"+d.Ticket.ID,
+			"TRANSP:TRANSPARENT",
+			"END:VEVENT",
+		)
+	}
+	lines = append(lines, "END:VCALENDAR")
+
+	for _, line := range lines {
+		io.WriteString(w, icsFold(line))
+	}
+}
+
+// icsEscape escapes a TEXT value
+func icsEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`).Replace(s)
+}
+
+// icsFold ends a content line with CRLF, folding it into continuation lines
+// of at most icsLineLimit octets without splitting UTF-8 sequences
+func icsFold(line string) string {
+	var b strings.Builder
+	limit := icsLineLimit
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && line[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		b.WriteString(line[:cut])
+		b.WriteString("\r\n ")
+		line = line[cut:]
+		limit = icsLineLimit - 1 // The leading space counts
+	}
+	b.WriteString(line)
+	b.WriteString("\r\n")
+	return b.String()
+}
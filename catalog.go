@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"OpTrack/internal/catalog"
+	"OpTrack/internal/clock"
+)
+
+// OperatorCatalog is whether a catalog publishes the latest image of an operator
+type OperatorCatalog = catalog.Result
+
+// CatalogConfig is a file-based OLM catalog, such as community-operators,
+// whose bundles are compared with the latest images on Quay.io. It is read
+// from url, or from a file or directory at path.
+type CatalogConfig struct {
+	Name string `yaml:"name"`
+	URL  string `yaml:"url"`  // e.g. the output of "opm render <index> -o json", served over http(s)
+	Path string `yaml:"path"` // A catalog file, or a directory of them such as a catalog/ checkout
+}
+
+// newCatalogMonitor returns nil when no catalogs are configured
+func newCatalogMonitor(catalogs []CatalogConfig, quay *QuayClient, clk clock.Clock) *catalog.Monitor {
+	if len(catalogs) == 0 {
+		return nil
+	}
+	var sources []catalog.Source
+	for _, c := range catalogs {
+		location := c.URL
+		if location == "" {
+			location = c.Path
+		}
+		sources = append(sources, catalog.Source{Name: c.Name, Location: location})
+	}
+	return catalog.New(sources, quay, clk, catalog.DefaultTTL)
+}
+
+func newCatalogCommand(opts *cliOptions) *cobra.Command {
+	return &cobra.Command{
+		Use:   "catalog <ticket>",
+		Short: "Show whether the configured catalogs publish the latest image of every operator on a ticket",
+		Long: `Show whether the configured catalogs publish the latest image of every operator on a ticket.
+
+The bundles of each file-based OLM catalog, such as community-operators, are
+matched to operators by the repositories of their related images. The newest
+bundle of an operator is compared with its latest image on Quay.io, so images
+that were built but never published to the catalog show up as "behind".
+Catalogs are set under catalogs: in the config file.`,
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeFirstTicket(opts),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			backend, err := opts.backend()
+			if err != nil {
+				return err
+			}
+			results, err := backend.TicketCatalog(args[0])
+			if err != nil {
+				return fmt.Errorf("failed to compare %s with the catalogs: %v", args[0], err)
+			}
+			return opts.printer(cmd).print(results, func(wide bool) {
+				printCatalog(cmd.OutOrStdout(), results, wide)
+			})
+		},
+	}
+}
+
+// printCatalog prints one row per operator and catalog, with full digests when wide is set
+func printCatalog(out io.Writer, results []OperatorCatalog, wide bool) {
+	short := shortDigest
+	if wide {
+		short = func(digest string) string { return digest }
+	}
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "CATALOG\tOPERATOR\tSTATE\tLATEST\tBUNDLE\tCHANNELS\tPUBLISHED")
+	for _, r := range results {
+		published := short(r.Digest)
+		if r.Digest == "" && r.Image != "" {
+			published = r.Image
+		}
+		if r.Error != "" {
+			published = strings.TrimSpace(published + " (" + r.Error + ")")
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", r.Catalog, r.Operator, r.State, short(r.Latest), r.Bundle, strings.Join(r.Channels, ","), published)
+	}
+	tw.Flush()
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"OpTrack/internal/registry"
+)
+
+// checkFailures are the policy violations `optrack check` can fail on
+var checkFailures = []string{"stale", "error", "unsigned", "unattested", "outdated-base"}
+
+// checkResult is the outcome of checking one operator against the policy
+type checkResult struct {
+	Ticket string         `json:"ticket"`
+	Status OperatorStatus `json:"status"`
+	Result string         `json:"result"` // "ok", "stale", "error", "unsigned", "unattested" or "outdated-base"
+}
+
+func newCheckCommand(opts *cliOptions) *cobra.Command {
+	var (
+		tickets     []string
+		maxAge      string
+		failOn      []string
+		junitPath   string
+		annotations bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "check",
+		Short: "Check operator freshness once and exit non-zero on policy violations",
+		Long: `Check looks up every operator on the given tickets (all tickets if none are
+given), prints a table and exits with status 1 if any operator violates the
+policy, so CI pipelines can gate on operator freshness.
+
+--junit writes a JUnit XML report for CI dashboards, and --github-annotations
+(on by default inside GitHub Actions) marks problems in the workflow run.
+
+An operator is "stale" when its latest image is older than --max-age, an
+"error" when its status could not be determined, "unsigned" when the server
+verifies signatures and its latest image has no trusted one,
+"unattested" when the server verifies provenance and the latest image has no
+trusted SLSA provenance, and "outdated-base" when the server checks base
+images and the latest image is built on an older image of its base.`,
+		Example: "  optrack check --ticket OSD-1234 --max-age 30d --fail-on stale,error",
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			age := staleThreshold.Get()
+			if maxAge != "" {
+				var err error
+				if age, err = parseAge(maxAge); err != nil {
+					return fmt.Errorf("invalid --max-age: %v", err)
+				}
+			}
+			fail := make(map[string]bool)
+			for _, f := range failOn {
+				if !slices.Contains(checkFailures, f) {
+					return fmt.Errorf("invalid --fail-on %q: use %s", f, strings.Join(checkFailures, ", "))
+				}
+				fail[f] = true
+			}
+
+			backend, err := opts.backend()
+			if err != nil {
+				return err
+			}
+
+			if len(tickets) == 0 {
+				all, err := backend.ListTickets()
+				if err != nil {
+					return err
+				}
+				for _, t := range all {
+					if t.Archived == nil {
+						tickets = append(tickets, t.ID)
+					}
+				}
+			}
+
+			now := opts.clock.Now()
+			var results []checkResult
+			for _, id := range tickets {
+				statuses, err := backend.TicketStatuses(id)
+				if err != nil {
+					return fmt.Errorf("failed to get status of %s: %v", id, err)
+				}
+				for _, status := range statuses {
+					results = append(results, checkOperator(id, status, age, now))
+				}
+			}
+
+			err = opts.printer(cmd).print(results, func(wide bool) {
+				printCheckResults(cmd.OutOrStdout(), results, now, wide)
+			})
+			if err != nil {
+				return err
+			}
+			if junitPath != "" {
+				var buf bytes.Buffer
+				if err := writeJUnit(&buf, results, fail, age, now); err != nil {
+					return err
+				}
+				if err := os.WriteFile(junitPath, buf.Bytes(), 0644); err != nil {
+					return fmt.Errorf("failed to write JUnit report: %v", err)
+				}
+			}
+			if annotations {
+				writeGitHubAnnotations(cmd.OutOrStdout(), results, fail, age, now)
+			}
+
+			violations := 0
+			for _, r := range results {
+				if fail[r.Result] {
+					violations++
+				}
+			}
+			if violations > 0 {
+				return fmt.Errorf("%d of %d operators failed the check", violations, len(results))
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringSliceVar(&tickets, "ticket", nil, "Ticket to check, may be repeated (default all tickets)")
+	cmd.Flags().StringVar(&maxAge, "max-age", "", "Age after which an operator is stale, e.g. 30d or 72h (default the configured stale threshold)")
+	cmd.Flags().StringSliceVar(&failOn, "fail-on", checkFailures, "Results that fail the check: stale, error, unsigned, unattested, outdated-base")
+	cmd.Flags().StringVar(&junitPath, "junit", "", "Also write a JUnit XML report to this file")
+	cmd.Flags().BoolVar(&annotations, "github-annotations", os.Getenv("GITHUB_ACTIONS") == "true", "Print GitHub Actions error and warning annotations")
+	cmd.RegisterFlagCompletionFunc("ticket", completeTickets(opts))
+	cmd.RegisterFlagCompletionFunc("fail-on", cobra.FixedCompletions(checkFailures, cobra.ShellCompDirectiveNoFileComp))
+	return cmd
+}
+
+func checkOperator(ticket string, status OperatorStatus, maxAge time.Duration, now time.Time) checkResult {
+	result := "ok"
+	switch {
+	case status.Status != "OK":
+		result = "error"
+	case status.Signature != nil && status.Signature.State != registry.Signed:
+		result = "unsigned"
+	case status.Provenance != nil && status.Provenance.State != registry.Verified:
+		result = "unattested"
+	case status.BaseImage != nil && status.BaseImage.State == registry.Outdated:
+		result = "outdated-base"
+	case now.Sub(status.LastUpdated) > maxAge:
+		result = "stale"
+	}
+	return checkResult{Ticket: ticket, Status: status, Result: result}
+}
+
+// parseAge accepts Go durations plus a "d" suffix for days
+func parseAge(value string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("%q is not a number of days", value)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(value)
+}
+
+// printCheckResults prints a table of results, adding the digests when wide is set
+func printCheckResults(out io.Writer, results []checkResult, now time.Time, wide bool) {
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	header := "TICKET\tOPERATOR\tLAST UPDATED\tAGE\tRESULT"
+	if wide {
+		header += "\tSHA256"
+	}
+	fmt.Fprintln(tw, header)
+	for _, r := range results {
+		if r.Result == "error" {
+			fmt.Fprintf(tw, "%s\t%s\t\t\t%s: %s\n", r.Ticket, r.Status.Name, r.Result, r.Status.Status)
+			continue
+		}
+		age := int(now.Sub(r.Status.LastUpdated).Hours() / 24)
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%dd\t%s", r.Ticket, r.Status.Name, r.Status.LastUpdated.Format("2006-01-02 15:04"), age, r.Result)
+		if wide {
+			fmt.Fprintf(tw, "\t%s", r.Status.SHA256)
+		}
+		fmt.Fprintln(tw)
+	}
+	tw.Flush()
+}
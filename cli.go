@@ -0,0 +1,815 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/user"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"OpTrack/internal/clock"
+	"OpTrack/internal/store"
+	"OpTrack/internal/web"
+)
+
+// cliOptions are the flags shared by every command
+type cliOptions struct {
+	server       string
+	configPath   string
+	dataDir      string
+	listen       string
+	basePath     string
+	quayURL      string
+	cacheTTL     string
+	output       string
+	dev          bool
+	templatesDir string
+	pidFile      string
+
+	mockRegistry    bool
+	mockLatency     time.Duration
+	mockFailureRate float64
+	mockURL         string // Set once the mock registry is running
+
+	cfg   *Config     // Loaded before any command runs
+	clock clock.Clock // The commands' notion of now
+}
+
+func newRootCommand() *cobra.Command {
+	opts := &cliOptions{clock: clock.System}
+
+	root := &cobra.Command{
+		Use:   "optrack",
+		Short: "Track version updates of OpenShift operators on quay.io",
+		Long: `OpTrack tracks version updates of OpenShift operators on quay.io.
+
+Run without a command to start the server. The other commands work on the
+local data directory, or on a running server when --server (or
+OPTRACK_SERVER) is set.
+
+Settings are read from the --config file, then OPTRACK_* environment
+variables, then flags, each overriding the previous.`,
+		SilenceUsage: true,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			if err := validOutputFormat(opts.output); err != nil {
+				return err
+			}
+
+			// Only the server logs progress; CLI commands keep stderr for problems
+			level := slog.LevelWarn
+			if cmd.Name() == "serve" || cmd.Name() == "optrack" {
+				level = slog.LevelInfo
+			}
+			if err := setupLogging(level); err != nil {
+				return fmt.Errorf("invalid logging configuration: %v", err)
+			}
+
+			if opts.mockRegistry {
+				url, err := startMockRegistry(opts.mockLatency, opts.mockFailureRate)
+				if err != nil {
+					return err
+				}
+				opts.mockURL = url
+			}
+
+			cfg, err := opts.loadConfig(cmd)
+			if err != nil {
+				return err
+			}
+			cfg.apply()
+			opts.cfg = cfg
+			return nil
+		},
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			opts.serve(cmd)
+		},
+	}
+
+	flags := root.PersistentFlags()
+	flags.StringVar(&opts.server, "server", os.Getenv("OPTRACK_SERVER"), "URL (or unix:PATH socket) of an OpTrack server to use instead of the local data directory")
+	flags.StringVar(&opts.configPath, "config", os.Getenv("OPTRACK_CONFIG"), "YAML config file")
+	flags.StringVar(&opts.dataDir, "data-dir", "./data", "Directory holding ticket data")
+	flags.StringVar(&opts.listen, "listen", ":8080", "Address the server listens on: host:port, unix:PATH or systemd")
+	flags.StringVar(&opts.basePath, "base-path", "", "URL path the server is reached under behind a reverse proxy, e.g. /optrack")
+	flags.StringVar(&opts.quayURL, "quay-url", "https://quay.io", "Base URL of the Quay API")
+	flags.StringVar(&opts.cacheTTL, "cache-ttl", "1m", "How long successful Quay lookups are cached, 0 to disable")
+
+	flags.BoolVar(&opts.mockRegistry, "mock-registry", false, "Look up operators in a built-in fake Quay.io with generated tags, for offline development and demos")
+	flags.DurationVar(&opts.mockLatency, "mock-latency", 0, "Delay every mock registry response by this long")
+	flags.Float64Var(&opts.mockFailureRate, "mock-failure-rate", 0, "Fraction of mock registry requests, 0 to 1, that fail with a 503")
+	flags.StringVarP(&opts.output, "output", "o", "table", "Output format: table, wide (with full digests), json or yaml")
+
+	root.RegisterFlagCompletionFunc("output", completeOutputFormats)
+
+	root.Flags().BoolVar(&opts.dev, "dev", false, "Serve templates and static files from ./internal/web, picking up edits without a rebuild")
+	root.Flags().StringVar(&opts.templatesDir, "templates-dir", "", "Directory of templates/ and static/ files that replace the built-in ones of the same name")
+	root.Flags().StringVar(&opts.pidFile, "pid-file", os.Getenv("OPTRACK_PID_FILE"), "Write the server's process ID to this file")
+
+	root.AddCommand(
+		newServeCommand(opts),
+		newTicketCommand(opts),
+		newStatusCommand(opts),
+		newDriftCommand(opts),
+		newDiscoverCommand(opts),
+		newCatalogCommand(opts),
+		newPromotionCommand(opts),
+		newPipelinesCommand(opts),
+		newCommitsCommand(opts),
+		newComplianceCommand(opts),
+		newCVEsCommand(opts),
+		newPinsCommand(opts),
+		newArgoCDCommand(opts),
+		newOperatorCommand(opts),
+		newProjectsCommand(opts),
+		newCheckCommand(opts),
+		newVersionCommand(opts),
+		newSeedCommand(opts),
+		newBenchCommand(opts),
+		newValidateCommand(opts),
+		newServiceCommand(opts),
+	)
+	return root
+}
+
+// loadConfig layers the flags that were set explicitly over the config file
+// and environment, then validates the result
+func (o *cliOptions) loadConfig(cmd *cobra.Command) (*Config, error) {
+	cfg, err := LoadConfig(o.configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if cmd.Flag("data-dir").Changed {
+		cfg.DataDir = o.dataDir
+	}
+	if cmd.Flag("listen").Changed {
+		cfg.Listen = o.listen
+	}
+	if cmd.Flag("base-path").Changed {
+		cfg.BasePath = o.basePath
+	}
+	if cmd.Flag("quay-url").Changed {
+		cfg.Quay.URL = o.quayURL
+	}
+	if o.mockURL != "" {
+		cfg.Quay.URL = o.mockURL
+	}
+	if flag := cmd.Flag("templates-dir"); flag != nil && flag.Changed {
+		cfg.TemplatesDir = o.templatesDir
+	}
+	if cmd.Flag("cache-ttl").Changed {
+		ttl, err := parseAge(o.cacheTTL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --cache-ttl %q", o.cacheTTL)
+		}
+		cfg.Quay.CacheTTL = Duration(ttl)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// serve runs the server, reloading the config file and environment with the
+// same flags on SIGHUP. Started by the Windows service manager, it runs as a service.
+func (o *cliOptions) serve(cmd *cobra.Command) {
+	assets := web.Options{Overrides: o.cfg.TemplatesDir, Reload: o.dev}
+	if o.dev {
+		assets.Dir = devAssetsDir
+		slog.Warn("Serving web assets from disk for development", "dir", devAssetsDir)
+	}
+	if assets.Overrides != "" {
+		slog.Info("Overriding web assets", "dir", assets.Overrides)
+	}
+	webAssets = web.New(assets, templateFuncs)
+	if err := webAssets.Check(); err != nil {
+		fatal("Invalid web templates", "error", err)
+	}
+	if o.pidFile != "" {
+		if err := writePIDFile(o.pidFile); err != nil {
+			fatal("Failed to start", "error", err)
+		}
+		defer removePIDFile(o.pidFile)
+	}
+
+	run := func() {
+		runServer(o.cfg, func() (*Config, error) {
+			return o.loadConfig(cmd)
+		})
+	}
+	if isWindowsService() {
+		if err := runWindowsService(run); err != nil {
+			fatal("Windows service failed", "error", err)
+		}
+		return
+	}
+	run()
+}
+
+// backend returns the API client when a server is configured, otherwise the local data directory
+func (o *cliOptions) backend() (Backend, error) {
+	if o.server != "" {
+		return NewAPIClient(o.server), nil
+	}
+	return newLocalBackend(o.cfg, cliActor(), o.clock)
+}
+
+// printer writes results in the --output format
+func (o *cliOptions) printer(cmd *cobra.Command) *printer {
+	return &printer{out: cmd.OutOrStdout(), format: o.output}
+}
+
+// cliActor names the local user in audit entries for changes made from the CLI
+func cliActor() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return "cli:" + u.Username
+	}
+	if name := os.Getenv("USER"); name != "" {
+		return "cli:" + name
+	}
+	return "cli"
+}
+
+func newServeCommand(opts *cliOptions) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "serve",
+		Short: "Start the web UI, API and poller",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			opts.serve(cmd)
+		},
+	}
+	cmd.Flags().BoolVar(&opts.dev, "dev", false, "Serve templates and static files from ./internal/web, picking up edits without a rebuild")
+	cmd.Flags().StringVar(&opts.templatesDir, "templates-dir", "", "Directory of templates/ and static/ files that replace the built-in ones of the same name")
+	cmd.Flags().StringVar(&opts.pidFile, "pid-file", os.Getenv("OPTRACK_PID_FILE"), "Write the server's process ID to this file")
+	return cmd
+}
+
+func newTicketCommand(opts *cliOptions) *cobra.Command {
+	ticket := &cobra.Command{
+		Use:   "ticket",
+		Short: "Manage tracked tickets",
+	}
+
+	var owner, description, template, project string
+	var apps, cves, labels, groups []string
+	var thresholds store.Thresholds
+	add := &cobra.Command{
+		Use:   "add <ticket> <namespace/repository>...",
+		Short: "Create a ticket, replacing any existing ticket with the same ID",
+		Long: `Create a ticket, replacing any existing ticket with the same ID.
+
+Operators given as namespace/repository@sha256:<digest> are pinned to that
+digest, as in a deploy config; optrack pins checks it is still tagged.
+The members of every --group are tracked too, as the group changes, so
+operators can be left out when a group is given.
+
+With --template the ticket is created from a ticket template, with the
+operators, labels and CVEs given added to the template's. It fails rather
+than replace an existing ticket.
+
+Run on a terminal without the ticket or operators to be prompted for them.`,
+		Args: cobra.ArbitraryArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 || (len(args) == 1 && len(groups) == 0 && template == "") {
+				var err error
+				if args, err = promptTicketAdd(cmd, args, &owner); err != nil {
+					return err
+				}
+			}
+
+			backend, err := opts.backend()
+			if err != nil {
+				return err
+			}
+			ticket := JiraTicket{ID: args[0], Operators: store.OperatorsNamed(args[1:]), Owner: owner, Project: project, Description: description, Labels: labels, Groups: groups, Applications: apps, CVEs: cves}
+			if thresholds != (store.Thresholds{}) {
+				ticket.Thresholds = &thresholds
+			}
+			_, report := store.NormalizeOperators(ticket.Operators)
+			printOperatorReport(cmd.ErrOrStderr(), report)
+			var saved JiraTicket
+			if template != "" {
+				saved, err = backend.CreateFromTemplate(template, ticket)
+			} else {
+				saved, err = backend.SaveTicket(ticket)
+			}
+			if err != nil {
+				return fmt.Errorf("failed to save ticket: %v", err)
+			}
+			return opts.printer(cmd).print(saved, func(bool) {
+				fmt.Fprintf(cmd.OutOrStdout(), "Saved %s with %d operators\n", saved.ID, len(saved.Operators))
+			})
+		},
+	}
+	add.Flags().StringVar(&owner, "owner", "", "Email address notified about the ticket")
+	add.Flags().StringVar(&project, "project", "", "Project the ticket belongs to (default the template's, or none)")
+	add.Flags().StringVar(&description, "description", "", "What the ticket is about")
+	add.Flags().StringSliceVar(&labels, "label", nil, "Label grouping the ticket, e.g. monthly; repeatable")
+	add.Flags().StringSliceVar(&groups, "group", nil, "Operator group whose members the ticket also tracks; repeatable")
+	add.Flags().StringSliceVar(&apps, "app", nil, "ArgoCD application that deploys the operators, as name or namespace/name; repeatable")
+	add.Flags().StringSliceVar(&cves, "cve", nil, "CVE ID the ticket is about, checked against scans of the operators' latest images; repeatable")
+	add.Flags().StringVar(&template, "template", "", "Ticket template to create the ticket from")
+	add.Flags().StringVar(&thresholds.Warning, "warn-after", "", "Age at which the ticket's operators are highlighted, e.g. 7d (default the configured warning threshold)")
+	add.Flags().StringVar(&thresholds.Stale, "stale-after", "", "Age after which the ticket's operators are stale, e.g. 14d (default the configured stale threshold)")
+
+	var filter store.Filter
+	var favorites bool
+	var sortBy string
+	list := &cobra.Command{
+		Use:   "list",
+		Short: "List tickets",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			backend, err := opts.backend()
+			if err != nil {
+				return err
+			}
+			all, err := backend.ListTickets()
+			if err != nil {
+				return err
+			}
+			if favorites {
+				ids, err := backend.Favorites()
+				if err != nil {
+					return fmt.Errorf("failed to get your favorites: %v", err)
+				}
+				filter.IDs = make(map[string]bool)
+				for _, id := range ids {
+					filter.IDs[id] = true
+				}
+			}
+			tickets := []JiraTicket{}
+			for _, t := range all {
+				if filter.Match(t) {
+					tickets = append(tickets, t)
+				}
+			}
+			switch sortBy {
+			case "id":
+			case "rollup":
+				sortByRollup(tickets, func(t JiraTicket) string { return t.Rollup })
+			default:
+				return fmt.Errorf("invalid --sort %q, use id or rollup", sortBy)
+			}
+			return opts.printer(cmd).print(tickets, func(bool) {
+				printTickets(cmd.OutOrStdout(), tickets)
+			})
+		},
+	}
+	list.Flags().StringVar(&filter.Owner, "owner", "", "Only list tickets with this owner")
+	list.Flags().StringVar(&filter.Project, "project", "", "Only list tickets in this project")
+	list.Flags().StringSliceVar(&filter.Labels, "label", nil, "Only list tickets with this label; repeatable, all must match")
+	list.Flags().BoolVar(&filter.Archived, "archived", false, "List archived tickets instead")
+	list.Flags().BoolVar(&filter.IncludeArchived, "all", false, "List archived tickets too")
+	list.Flags().BoolVar(&favorites, "favorites", false, "Only list the tickets you starred")
+	list.Flags().StringSliceVar(&filter.Rollups, "rollup", nil, "Only list tickets in this state: complete, in-progress, blocked or error; repeatable, any may match")
+	list.Flags().StringVar(&sortBy, "sort", "id", "Sort by id, or by rollup state with the most urgent first")
+
+	del := &cobra.Command{
+		Use:               "delete <ticket>",
+		Short:             "Stop tracking a ticket",
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeFirstTicket(opts),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			backend, err := opts.backend()
+			if err != nil {
+				return err
+			}
+			if err := backend.DeleteTicket(args[0]); err != nil {
+				return fmt.Errorf("failed to delete %s: %v", args[0], err)
+			}
+			deleted := struct {
+				ID      string `json:"id"`
+				Deleted bool   `json:"deleted"`
+			}{ID: args[0], Deleted: true}
+			return opts.printer(cmd).print(deleted, func(bool) {
+				fmt.Fprintf(cmd.OutOrStdout(), "Deleted %s\n", args[0])
+			})
+		},
+	}
+
+	ticket.AddCommand(add, list, del, newTicketArchiveCommand(opts, true), newTicketArchiveCommand(opts, false), newTicketImportCommand(opts), newTicketRelatedCommand(opts), newTicketCommentCommand(opts), newTicketCommentsCommand(opts), newTicketStarCommand(opts, true), newTicketStarCommand(opts, false))
+	return ticket
+}
+
+// promptTicketAdd asks for the ticket, operators and owner that were not
+// given on the command line, as long as stdin is a terminal
+func promptTicketAdd(cmd *cobra.Command, args []string, owner *string) ([]string, error) {
+	if !isTerminal(cmd.InOrStdin()) {
+		return nil, fmt.Errorf("requires a ticket and at least one operator")
+	}
+	p := newPrompter(cmd.InOrStdin(), cmd.ErrOrStderr())
+
+	if len(args) == 0 {
+		id, err := p.ask("Ticket", required)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, id)
+	}
+	operators, err := p.ask("Operators (namespace/repository, comma separated)", validOperatorList)
+	if err != nil {
+		return nil, err
+	}
+	args = append(args, splitOperators(operators)...)
+
+	if !cmd.Flag("owner").Changed {
+		if *owner, err = p.ask("Owner email (optional)", nil); err != nil {
+			return nil, err
+		}
+	}
+	return args, nil
+}
+
+func newStatusCommand(opts *cliOptions) *cobra.Command {
+	var (
+		watch    bool
+		interval time.Duration
+	)
+	cmd := &cobra.Command{
+		Use:               "status <ticket>",
+		Short:             "Show the latest image of every operator on a ticket",
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeFirstTicket(opts),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			backend, err := opts.backend()
+			if err != nil {
+				return err
+			}
+			if watch {
+				if opts.output != "table" && opts.output != "wide" {
+					return fmt.Errorf("--watch only supports table and wide output")
+				}
+				if interval < time.Second {
+					return fmt.Errorf("--interval must be at least 1s")
+				}
+				return watchStatuses(cmd.OutOrStdout(), backend, args[0], interval, opts.output == "wide", opts.clock)
+			}
+
+			statuses, err := backend.TicketStatuses(args[0])
+			if err != nil {
+				return fmt.Errorf("failed to get status of %s: %v", args[0], err)
+			}
+			// Failing builds explain stale images; servers without pipelines just have none
+			builds, _ := backend.TicketPipelines(args[0])
+			return opts.printer(cmd).print(statuses, func(wide bool) {
+				now := opts.clock.Now()
+				printStatuses(cmd.OutOrStdout(), statuses, now, wide)
+				printOperatorNotes(cmd.OutOrStdout(), statuses)
+				printBuildNotes(cmd.OutOrStdout(), builds, now)
+			})
+		},
+	}
+	cmd.Flags().BoolVarP(&watch, "watch", "w", false, "Keep refreshing the table, highlighting digests that change")
+	cmd.Flags().DurationVar(&interval, "interval", defaultWatchInterval, "How often --watch refreshes")
+	return cmd
+}
+
+// newTicketArchiveCommand archives tickets, or unarchives them
+func newTicketArchiveCommand(opts *cliOptions, archived bool) *cobra.Command {
+	use, short, verb := "archive <ticket>...", "Stop listing and polling tickets, keeping them", "Archived"
+	if !archived {
+		use, short, verb = "unarchive <ticket>...", "List and poll archived tickets again", "Unarchived"
+	}
+	return &cobra.Command{
+		Use:               use,
+		Short:             short,
+		Args:              cobra.MinimumNArgs(1),
+		ValidArgsFunction: completeTickets(opts),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			backend, err := opts.backend()
+			if err != nil {
+				return err
+			}
+			var tickets []JiraTicket
+			for _, id := range args {
+				ticket, err := backend.ArchiveTicket(id, archived)
+				if err != nil {
+					return fmt.Errorf("failed to %s %s: %v", strings.Fields(use)[0], id, err)
+				}
+				tickets = append(tickets, ticket)
+			}
+			return opts.printer(cmd).print(tickets, func(bool) {
+				for _, ticket := range tickets {
+					fmt.Fprintf(cmd.OutOrStdout(), "%s %s\n", verb, ticket.ID)
+				}
+			})
+		},
+	}
+}
+
+// newTicketStarCommand adds tickets to the user's favorites, or with starred
+// unset removes them
+func newTicketStarCommand(opts *cliOptions, starred bool) *cobra.Command {
+	use, short, verb := "star <ticket>...", "Add tickets to your favorites", "Starred"
+	if !starred {
+		use, short, verb = "unstar <ticket>...", "Remove tickets from your favorites", "Unstarred"
+	}
+	return &cobra.Command{
+		Use:               use,
+		Short:             short,
+		Args:              cobra.MinimumNArgs(1),
+		ValidArgsFunction: completeTickets(opts),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			backend, err := opts.backend()
+			if err != nil {
+				return err
+			}
+			var favorites []string
+			for _, id := range args {
+				if favorites, err = backend.StarTicket(id, starred); err != nil {
+					return fmt.Errorf("failed to %s %s: %v", strings.Fields(use)[0], id, err)
+				}
+			}
+			result := struct {
+				Favorites []string `json:"favorites"`
+			}{favorites}
+			return opts.printer(cmd).print(result, func(bool) {
+				for _, id := range args {
+					fmt.Fprintf(cmd.OutOrStdout(), "%s %s\n", verb, id)
+				}
+			})
+		},
+	}
+}
+
+// newTicketCommentCommand adds a comment to a ticket
+func newTicketCommentCommand(opts *cliOptions) *cobra.Command {
+	return &cobra.Command{
+		Use:               "comment <ticket> <text>...",
+		Short:             "Comment on a ticket, in Markdown",
+		Args:              cobra.MinimumNArgs(2),
+		ValidArgsFunction: completeTickets(opts),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			backend, err := opts.backend()
+			if err != nil {
+				return err
+			}
+			comment, err := backend.AddComment(args[0], strings.Join(args[1:], " "))
+			if err != nil {
+				return fmt.Errorf("failed to comment on %s: %v", args[0], err)
+			}
+			return opts.printer(cmd).print(comment, func(bool) {
+				fmt.Fprintf(cmd.OutOrStdout(), "Commented on %s\n", comment.Ticket)
+			})
+		},
+	}
+}
+
+// newTicketCommentsCommand shows the comment thread of a ticket
+func newTicketCommentsCommand(opts *cliOptions) *cobra.Command {
+	return &cobra.Command{
+		Use:               "comments <ticket>",
+		Short:             "Show the comments on a ticket",
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeTickets(opts),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			backend, err := opts.backend()
+			if err != nil {
+				return err
+			}
+			comments, err := backend.Comments(args[0])
+			if err != nil {
+				return fmt.Errorf("failed to list comments on %s: %v", args[0], err)
+			}
+			return opts.printer(cmd).print(comments, func(bool) {
+				out := cmd.OutOrStdout()
+				for i, c := range comments {
+					if i > 0 {
+						fmt.Fprintln(out)
+					}
+					fmt.Fprintf(out, "%s, %s:\n%s\n", c.Author, c.Created.Format("2006-01-02 15:04"), c.Body)
+				}
+			})
+		},
+	}
+}
+
+func newOperatorCommand(opts *cliOptions) *cobra.Command {
+	operator := &cobra.Command{
+		Use:   "operator",
+		Short: "Look up operators",
+	}
+
+	check := &cobra.Command{
+		Use:   "check <namespace/repository>...",
+		Short: "Show the latest image of operators, whether or not they are on a ticket",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			backend, err := opts.backend()
+			if err != nil {
+				return err
+			}
+
+			var statuses []OperatorStatus
+			failed := 0
+			for _, name := range args {
+				status, err := backend.OperatorStatus(name)
+				if err != nil {
+					return fmt.Errorf("failed to check %s: %v", name, err)
+				}
+				if status.Status != "OK" {
+					failed++
+				}
+				statuses = append(statuses, *status)
+			}
+
+			err = opts.printer(cmd).print(statuses, func(wide bool) {
+				printStatuses(cmd.OutOrStdout(), statuses, opts.clock.Now(), wide)
+			})
+			if err != nil {
+				return err
+			}
+			if failed > 0 {
+				return fmt.Errorf("%d of %d operators could not be checked", failed, len(statuses))
+			}
+			return nil
+		},
+	}
+
+	var filter inventoryFilter
+	list := &cobra.Command{
+		Use:   "list",
+		Short: "List every operator ever tracked, with its team and tickets",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			backend, err := opts.backend()
+			if err != nil {
+				return err
+			}
+			items, err := backend.Inventory()
+			if err != nil {
+				return fmt.Errorf("failed to list operators: %v", err)
+			}
+			items = filterInventory(items, filter)
+			return opts.printer(cmd).print(items, func(wide bool) {
+				printInventory(cmd.OutOrStdout(), items, wide)
+			})
+		},
+	}
+	list.Flags().StringVar(&filter.Team, "team", "", "Only list operators of this team")
+	list.Flags().StringVar(&filter.Criticality, "criticality", "", "Only list operators with this criticality: critical, normal or low")
+	list.Flags().BoolVar(&filter.Unused, "unused", false, "Only list operators no ticket tracks any more")
+
+	annotate := &cobra.Command{
+		Use:   "annotate <namespace/repository> <digest> <reason>...",
+		Short: "Give the reason an image of an operator was built, e.g. a CVE it fixes",
+		Args:  cobra.MinimumNArgs(3),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			backend, err := opts.backend()
+			if err != nil {
+				return err
+			}
+			a, err := backend.AnnotateDigest(args[0], args[1], strings.Join(args[2:], " "))
+			if err != nil {
+				return fmt.Errorf("failed to annotate %s@%s: %v", args[0], args[1], err)
+			}
+			return opts.printer(cmd).print(a, func(bool) {
+				fmt.Fprintf(cmd.OutOrStdout(), "Annotated the %s image %s\n", a.Operator, shortDigest(a.Digest))
+			})
+		},
+	}
+
+	operator.AddCommand(check, list, annotate)
+	return operator
+}
+
+func printInventory(out io.Writer, items []InventoryItem, wide bool) {
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	if wide {
+		fmt.Fprintln(tw, "OPERATOR\tTEAM\tCONTACT\tCRITICALITY\tTICKETS\tFIRST SEEN\tSOURCE")
+	} else {
+		fmt.Fprintln(tw, "OPERATOR\tTEAM\tCRITICALITY\tTICKETS")
+	}
+	for _, item := range items {
+		if wide {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", item.Name, item.Team, item.Contact, item.Criticality, strings.Join(item.Tickets, ","), item.FirstSeen.Format("2006-01-02"), item.SourceRepository)
+		} else {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", item.Name, item.Team, item.Criticality, strings.Join(item.Tickets, ","))
+		}
+	}
+	tw.Flush()
+}
+
+func printTickets(out io.Writer, tickets []JiraTicket) {
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TICKET\tSTATE\tOPERATORS\tOWNER\tLABELS\tADDED\tDESCRIPTION")
+	for _, t := range tickets {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", t.ID, cmp.Or(t.Rollup, "-"), strings.Join(t.OperatorNames(), ","), t.Owner, strings.Join(t.Labels, ","), t.Added.Format("2006-01-02"), t.Description)
+	}
+	tw.Flush()
+}
+
+// printOperatorReport prints the operators that will be merged into others
+// or look alike, as notes for whoever typed them
+func printOperatorReport(out io.Writer, report store.OperatorReport) {
+	for _, m := range report.Merged {
+		fmt.Fprintf(out, "Note: %s is the same operator as %s, tracking it once\n", m.Entry, m.Operator)
+	}
+	for _, pair := range report.Similar {
+		fmt.Fprintf(out, "Note: %s and %s look alike, is one of them a typo?\n", pair[0], pair[1])
+	}
+}
+
+// printStatuses prints a table of statuses, with full digests when wide is set
+func printStatuses(out io.Writer, statuses []OperatorStatus, now time.Time, wide bool) {
+	printStatusTable(out, statuses, now, wide, nil)
+}
+
+// printOperatorNotes prints the details the ticket gives its operators, one
+// line per operator that has any
+func printOperatorNotes(out io.Writer, statuses []OperatorStatus) {
+	for _, s := range statuses {
+		var details []string
+		if s.DisplayName != "" {
+			details = append(details, s.DisplayName)
+		}
+		if s.Owner != "" {
+			details = append(details, "owner "+s.Owner)
+		}
+		if s.Team != "" && s.Contact != "" {
+			details = append(details, fmt.Sprintf("team %s (%s)", s.Team, s.Contact))
+		} else if s.Team != "" {
+			details = append(details, "team "+s.Team)
+		}
+		if s.Note != "" {
+			details = append(details, s.Note)
+		}
+		if s.ExpectedBy != "" {
+			details = append(details, "expected by "+expectedByText(s))
+		}
+		if len(details) > 0 {
+			fmt.Fprintf(out, "%s: %s\n", s.Name, strings.Join(details, ", "))
+		}
+	}
+}
+
+// printStatusTable is printStatuses with an optional function to decorate the digest column
+func printStatusTable(out io.Writer, statuses []OperatorStatus, now time.Time, wide bool, mark func(OperatorStatus, string) string) {
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	header := "OPERATOR\tSTATUS\tLAST UPDATED\tAGE\tSHA256"
+	// Signatures, provenance, base images and vulnerabilities are only shown when the server checks them
+	signatures, provenance, bases, scans := false, false, false, false
+	for _, s := range statuses {
+		signatures = signatures || s.Signature != nil
+		provenance = provenance || s.Provenance != nil
+		bases = bases || s.BaseImage != nil
+		scans = scans || s.Scan != nil
+	}
+	if signatures {
+		header += "\tSIGNATURE"
+	}
+	if provenance {
+		header += "\tPROVENANCE"
+	}
+	if bases {
+		header += "\tBASE IMAGE"
+	}
+	if scans {
+		header += "\tVULNERABILITIES"
+	}
+	if wide {
+		header += "\tBUILD"
+	}
+	fmt.Fprintln(tw, header)
+	for _, s := range statuses {
+		if s.Status != "OK" {
+			fmt.Fprintf(tw, "%s\t%s\t\t\t\n", s.Name, s.Status)
+			continue
+		}
+		digest := shortDigest(s.SHA256)
+		if wide {
+			digest = s.SHA256
+		}
+		if mark != nil {
+			digest = mark(s, digest)
+		}
+		age := int(now.Sub(s.LastUpdated).Hours() / 24)
+		if signatures {
+			digest += "\t" + signatureState(s.Signature)
+		}
+		if provenance {
+			digest += "\t" + provenanceState(s.Provenance)
+		}
+		if bases {
+			digest += "\t" + baseImageState(s.BaseImage)
+		}
+		if scans {
+			digest += "\t" + scanSummary(s.Scan)
+		}
+		if wide {
+			digest += "\t" + buildName(s.Build)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%dd\t%s\n", s.Name, s.Status, s.LastUpdated.Format("2006-01-02 15:04"), age, digest)
+	}
+	tw.Flush()
+}
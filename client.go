@@ -0,0 +1,770 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"OpTrack/internal/api"
+	"OpTrack/internal/argocd"
+	"OpTrack/internal/catalog"
+	"OpTrack/internal/ci"
+	"OpTrack/internal/clock"
+	"OpTrack/internal/cve"
+	"OpTrack/internal/drift"
+	"OpTrack/internal/github"
+	"OpTrack/internal/policy"
+	"OpTrack/internal/registry"
+	"OpTrack/internal/saas"
+	"OpTrack/internal/store"
+	"OpTrack/pkg/client"
+)
+
+// Backend is the storage the CLI works against: the local data directory, or
+// a running OpTrack server
+type Backend interface {
+	ListTickets() ([]JiraTicket, error)
+	SaveTicket(ticket JiraTicket) (JiraTicket, error)
+	CreateFromTemplate(template string, ticket JiraTicket) (JiraTicket, error)
+	DeleteTicket(id string) error
+	ArchiveTicket(id string, archived bool) (JiraTicket, error)
+	TicketStatuses(id string) ([]OperatorStatus, error)
+	OperatorStatus(name string) (*OperatorStatus, error)
+	TicketDrift(id string) ([]OperatorDrift, error)
+	Discover(registries []string) (*ClusterDiscovery, error)
+	TicketCatalog(id string) ([]OperatorCatalog, error)
+	TicketApplications(id string) ([]TicketApplication, error)
+	TicketPromotion(id string) ([]OperatorPromotion, error)
+	TicketPipelines(id string) ([]OperatorPipeline, error)
+	TicketCommits(id string) ([]OperatorCommits, error)
+	TicketCompliance(id string) ([]OperatorCompliance, error)
+	TicketCVEs(id string) ([]CVEFix, error)
+	TicketPins(id string) ([]PinCheck, error)
+	Inventory() ([]InventoryItem, error)
+	Comments(id string) ([]Comment, error)
+	AddComment(id, body string) (Comment, error)
+	AnnotateDigest(operator, digest, reason string) (DigestAnnotation, error)
+	Projects() ([]projectInfo, error)
+	Favorites() ([]string, error)
+	StarTicket(id string, starred bool) ([]string, error)
+}
+
+// localBackend reads and writes the data directory directly and queries Quay.io itself
+type localBackend struct {
+	state    *AppState
+	quay     *QuayClient
+	clusters []ClusterConfig
+	catalogs []CatalogConfig
+	saas     []SaasFileConfig
+	ci       CIConfig
+	github   GitHubConfig
+	argocd   ArgoCDConfig
+	policy   PolicyConfig
+	scans    ScansConfig
+	quayCfg  QuayConfig
+	actor    string
+}
+
+func newLocalBackend(cfg *Config, actor string, clk clock.Clock) (*localBackend, error) {
+	state, err := NewAppState(cfg.DataDir, clk)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Controller.Enabled {
+		state.readOnly = errControllerManaged
+	}
+	builds, err := newBuildLookup(cfg.Builds)
+	if err != nil {
+		return nil, err
+	}
+	traffic := newQuayTraffic(cfg.Quay, clk)
+	signatures, provenance, err := newSignatureVerifier(cfg.Signatures, cfg.Quay, traffic)
+	if err != nil {
+		return nil, err
+	}
+	bases, err := newBaseImageChecker(cfg.BaseImages, cfg.Quay, traffic)
+	if err != nil {
+		return nil, err
+	}
+	// Scans run in the background, which a command doesn't wait for
+	quay := NewQuayClient(cfg.Quay, traffic, cfg.Plugins.Registry, builds, signatures, provenance, bases, registry.Scanning{})
+	return &localBackend{state: state, quay: quay, clusters: cfg.Clusters, catalogs: cfg.Catalogs, saas: cfg.SaasFiles, ci: cfg.CI, github: cfg.GitHub, argocd: cfg.ArgoCD, policy: cfg.Policy, scans: cfg.Scans, quayCfg: cfg.Quay, actor: actor}, nil
+}
+
+func (b *localBackend) ListTickets() ([]JiraTicket, error) {
+	return sortedTickets(b.state.List()), nil
+}
+
+func (b *localBackend) SaveTicket(ticket JiraTicket) (JiraTicket, error) {
+	ticket.Added, ticket.Baselines = b.state.clock.Now(), nil
+	if err := normalizeTicket(&ticket); err != nil {
+		return ticket, err
+	}
+	existed, err := b.state.Put(ticket)
+	if err != nil {
+		return ticket, err
+	}
+
+	action := "ticket.create"
+	if existed {
+		action = "ticket.replace"
+	}
+	b.state.audit.RecordAs(b.actor, nil, action, ticket.ID, map[string]interface{}{"operators": ticket.Operators, "owner": ticket.Owner, "labels": ticket.Labels, "groups": ticket.Groups, "applications": ticket.Applications, "cves": ticket.CVEs, "pins": ticket.Pins, "thresholds": ticket.Thresholds, "project": ticket.Project})
+	if stored, ok := b.state.Get(ticket.ID); ok {
+		ticket = stored // With the members of its groups
+	}
+	return ticket, nil
+}
+
+func (b *localBackend) CreateFromTemplate(template string, ticket JiraTicket) (JiraTicket, error) {
+	rules, err := NewRuleStore(b.state.dataDir, b.state.audit)
+	if err != nil {
+		return ticket, err
+	}
+	ticket, err = createFromTemplate(b.state, rules, template, ticket)
+	if err != nil {
+		return ticket, err
+	}
+	b.state.audit.RecordAs(b.actor, nil, "ticket.create", ticket.ID, map[string]interface{}{"template": template, "operators": ticket.Operators, "owner": ticket.Owner, "labels": ticket.Labels, "groups": ticket.Groups, "applications": ticket.Applications, "cves": ticket.CVEs, "thresholds": ticket.Thresholds, "project": ticket.Project})
+	return ticket, nil
+}
+
+func (b *localBackend) DeleteTicket(id string) error {
+	if err := b.state.Delete(id); err != nil {
+		return err
+	}
+	b.state.audit.RecordAs(b.actor, nil, "ticket.delete", id, nil)
+	return nil
+}
+
+func (b *localBackend) ArchiveTicket(id string, archived bool) (JiraTicket, error) {
+	ticket, changed, err := b.state.Archive(id, archived)
+	if err != nil {
+		return ticket, err
+	}
+	if changed {
+		action := "ticket.unarchive"
+		if archived {
+			action = "ticket.archive"
+		}
+		b.state.audit.RecordAs(b.actor, nil, action, id, nil)
+	}
+	return ticket, nil
+}
+
+func (b *localBackend) TicketStatuses(id string) ([]OperatorStatus, error) {
+	ticket, ok := b.state.Get(id)
+	if !ok {
+		return nil, store.ErrTicketNotFound
+	}
+	return api.TicketStatuses(b.quay, ticket, localTime(b.state.clock.Now())), nil
+}
+
+func (b *localBackend) OperatorStatus(name string) (*OperatorStatus, error) {
+	return b.quay.GetOperatorStatus(name)
+}
+
+func (b *localBackend) TicketDrift(id string) ([]OperatorDrift, error) {
+	ticket, ok := b.state.Get(id)
+	if !ok {
+		return nil, store.ErrTicketNotFound
+	}
+	monitor, err := newDriftMonitor(b.clusters, b.quay, b.state.clock)
+	if err != nil {
+		return nil, err
+	}
+	if monitor == nil {
+		return nil, drift.ErrNoClusters
+	}
+	return monitor.Check(context.Background(), ticket.OperatorNames()), nil
+}
+
+func (b *localBackend) Discover(registries []string) (*ClusterDiscovery, error) {
+	monitor, err := newDriftMonitor(b.clusters, b.quay, b.state.clock)
+	if err != nil {
+		return nil, err
+	}
+	if monitor == nil {
+		return nil, drift.ErrNoClusters
+	}
+	return monitor.Discover(context.Background(), registries), nil
+}
+
+func (b *localBackend) TicketCatalog(id string) ([]OperatorCatalog, error) {
+	ticket, ok := b.state.Get(id)
+	if !ok {
+		return nil, store.ErrTicketNotFound
+	}
+	monitor := newCatalogMonitor(b.catalogs, b.quay, b.state.clock)
+	if monitor == nil {
+		return nil, catalog.ErrNoCatalogs
+	}
+	return monitor.Check(context.Background(), ticket.OperatorNames()), nil
+}
+
+func (b *localBackend) TicketApplications(id string) ([]TicketApplication, error) {
+	ticket, ok := b.state.Get(id)
+	if !ok {
+		return nil, store.ErrTicketNotFound
+	}
+	monitor := newArgoCDMonitor(b.argocd, b.quay)
+	if monitor == nil {
+		return nil, argocd.ErrNotConfigured
+	}
+	return monitor.Check(context.Background(), ticket.Applications, ticket.OperatorNames()), nil
+}
+
+func (b *localBackend) TicketPromotion(id string) ([]OperatorPromotion, error) {
+	ticket, ok := b.state.Get(id)
+	if !ok {
+		return nil, store.ErrTicketNotFound
+	}
+	monitor := newPromotionMonitor(b.saas, b.quay, b.state.clock)
+	if monitor == nil {
+		return nil, saas.ErrNoSources
+	}
+	return monitor.Check(context.Background(), ticket.OperatorNames()), nil
+}
+
+func (b *localBackend) TicketPipelines(id string) ([]OperatorPipeline, error) {
+	ticket, ok := b.state.Get(id)
+	if !ok {
+		return nil, store.ErrTicketNotFound
+	}
+	monitor, err := newPipelineMonitor(b.ci, b.state.clock)
+	if err != nil {
+		return nil, err
+	}
+	if monitor == nil {
+		return nil, ci.ErrNotConfigured
+	}
+	return monitor.Check(context.Background(), ticket.OperatorNames()), nil
+}
+
+func (b *localBackend) TicketCommits(id string) ([]OperatorCommits, error) {
+	ticket, ok := b.state.Get(id)
+	if !ok {
+		return nil, store.ErrTicketNotFound
+	}
+	monitor := newCommitsMonitor(b.github, b.quay, b.state.clock)
+	if monitor == nil {
+		return nil, github.ErrNotConfigured
+	}
+	return monitor.Check(context.Background(), ticket.OperatorNames()), nil
+}
+
+func (b *localBackend) TicketCompliance(id string) ([]OperatorCompliance, error) {
+	ticket, ok := b.state.Get(id)
+	if !ok {
+		return nil, store.ErrTicketNotFound
+	}
+	checker, err := newComplianceChecker(b.policy, b.quayCfg, b.quay, b.state.clock)
+	if err != nil {
+		return nil, err
+	}
+	if checker == nil {
+		return nil, policy.ErrNotConfigured
+	}
+	return checker.Check(context.Background(), ticket.OperatorNames()), nil
+}
+
+// TicketCVEs scans the latest image of each operator now, as commands don't
+// scan in the background, when a scanner is configured
+func (b *localBackend) TicketCVEs(id string) ([]CVEFix, error) {
+	ticket, ok := b.state.Get(id)
+	if !ok {
+		return nil, store.ErrTicketNotFound
+	}
+	scanning, err := newScanning(b.scans, b.quayCfg, b.state.clock)
+	if err != nil {
+		return nil, err
+	}
+	statuses := api.TicketStatuses(b.quay, ticket, localTime(b.state.clock.Now()))
+	for i, s := range statuses {
+		if s.Status != "OK" || scanning.Scanner == nil || len(ticket.CVEs) == 0 {
+			continue
+		}
+		if statuses[i].Scan, err = scanning.Scanner.Scan(s.Name, s.SHA256); err != nil {
+			return nil, fmt.Errorf("failed to scan %s: %v", s.Name, err)
+		}
+	}
+	return cve.Check(statuses, ticket.CVEs), nil
+}
+
+func (b *localBackend) TicketPins(id string) ([]PinCheck, error) {
+	ticket, ok := b.state.Get(id)
+	if !ok {
+		return nil, store.ErrTicketNotFound
+	}
+	return b.quay.CheckPins(ticket.OperatorNames(), ticket.Pins), nil
+}
+
+func (b *localBackend) Inventory() ([]InventoryItem, error) {
+	return inventoryItems(nil, b.state.inventory.List(), b.state), nil
+}
+
+func (b *localBackend) Comments(id string) ([]Comment, error) {
+	if _, ok := b.state.Get(id); !ok {
+		return nil, store.ErrTicketNotFound
+	}
+	return b.state.comments.List(id), nil
+}
+
+func (b *localBackend) AddComment(id, body string) (Comment, error) {
+	if _, ok := b.state.Get(id); !ok {
+		return Comment{}, store.ErrTicketNotFound
+	}
+	body, err := checkComment(body)
+	if err != nil {
+		return Comment{}, err
+	}
+	comment, err := b.state.comments.Add(id, b.actor, body)
+	if err != nil {
+		return Comment{}, err
+	}
+	b.state.audit.RecordAs(b.actor, nil, "comment.create", id, map[string]interface{}{"id": comment.ID})
+	return comment, nil
+}
+
+func (b *localBackend) AnnotateDigest(operator, digest, reason string) (DigestAnnotation, error) {
+	reason, err := checkReason(reason)
+	if err != nil {
+		return DigestAnnotation{}, err
+	}
+	digest, err = parseDigest(digest)
+	if err != nil {
+		return DigestAnnotation{}, err
+	}
+	return b.state.annotations.Set(b.actor, nil, b.state.inventory.canonical(store.NormalizeOperator(operator)), digest, reason)
+}
+
+// Projects returns every configured project. The data directory gives access
+// to every ticket, so the CLI is an editor of all of them.
+func (b *localBackend) Projects() ([]projectInfo, error) {
+	return projectInfos(nil, b.state.List()), nil
+}
+
+// Favorites returns the tickets the CLI user starred. Their preferences are
+// kept under their CLI actor, apart from those they have in the web UI.
+func (b *localBackend) Favorites() ([]string, error) {
+	return b.state.prefs.Get(b.actor).Favorites, nil
+}
+
+func (b *localBackend) StarTicket(id string, starred bool) ([]string, error) {
+	if _, ok := b.state.Get(id); !ok && starred {
+		return nil, store.ErrTicketNotFound
+	}
+	prefs, err := b.state.prefs.Star(b.actor, id, starred)
+	return prefs.Favorites, err
+}
+
+// APIClient is the Backend for a running OpTrack server, on top of the
+// exported client package
+type APIClient struct {
+	client *client.Client
+}
+
+// NewAPIClient returns a client for an http(s) URL, or unix:PATH for a server
+// listening on a Unix domain socket
+func NewAPIClient(baseURL string) *APIClient {
+	return &APIClient{client: client.New(baseURL)}
+}
+
+func (c *APIClient) ListTickets() ([]JiraTicket, error) {
+	tickets, err := c.client.ListTickets(context.Background())
+	if err != nil {
+		return nil, backendError(err)
+	}
+	list := make([]JiraTicket, len(tickets))
+	for i, t := range tickets {
+		list[i] = ticketFromAPI(t)
+	}
+	return list, nil
+}
+
+func (c *APIClient) SaveTicket(ticket JiraTicket) (JiraTicket, error) {
+	saved, err := c.client.CreateTicket(context.Background(), apiTicket(ticket))
+	return ticketFromAPI(saved), backendError(err)
+}
+
+// ticketFromAPI converts a ticket of the client package, which has its own
+// Operator type
+func ticketFromAPI(t client.Ticket) JiraTicket {
+	ticket := JiraTicket{ID: t.ID, Added: t.Added, Owner: t.Owner, Project: t.Project, Description: t.Description, Labels: t.Labels, Groups: t.Groups, Applications: t.Applications, CVEs: t.CVEs, Pins: t.Pins, Baselines: t.Baselines, Updated: t.Updated, Archived: t.Archived, Rollup: t.Rollup}
+	if t.Thresholds != nil {
+		ticket.Thresholds = &store.Thresholds{Warning: t.Thresholds.Warning, Stale: t.Thresholds.Stale}
+	}
+	for _, op := range t.Operators {
+		ticket.Operators = append(ticket.Operators, store.Operator(op))
+	}
+	return ticket
+}
+
+// apiTicket is the reverse of ticketFromAPI
+func apiTicket(t JiraTicket) client.Ticket {
+	ticket := client.Ticket{ID: t.ID, Added: t.Added, Owner: t.Owner, Project: t.Project, Description: t.Description, Labels: t.Labels, Groups: t.Groups, Applications: t.Applications, CVEs: t.CVEs, Pins: t.Pins, Baselines: t.Baselines, Updated: t.Updated, Archived: t.Archived, Rollup: t.Rollup}
+	if t.Thresholds != nil {
+		ticket.Thresholds = &client.Thresholds{Warning: t.Thresholds.Warning, Stale: t.Thresholds.Stale}
+	}
+	for _, op := range t.Operators {
+		ticket.Operators = append(ticket.Operators, client.Operator(op))
+	}
+	return ticket
+}
+
+func (c *APIClient) CreateFromTemplate(template string, ticket JiraTicket) (JiraTicket, error) {
+	saved, err := c.client.CreateTicketFromTemplate(context.Background(), template, apiTicket(ticket))
+	return ticketFromAPI(saved), backendError(err)
+}
+
+func (c *APIClient) DeleteTicket(id string) error {
+	return backendError(c.client.DeleteTicket(context.Background(), id))
+}
+
+func (c *APIClient) ArchiveTicket(id string, archived bool) (JiraTicket, error) {
+	archive := c.client.UnarchiveTicket
+	if archived {
+		archive = c.client.ArchiveTicket
+	}
+	ticket, err := archive(context.Background(), id)
+	return ticketFromAPI(ticket), backendError(err)
+}
+
+func (c *APIClient) TicketStatuses(id string) ([]OperatorStatus, error) {
+	statuses, err := c.client.GetStatus(context.Background(), id)
+	if err != nil {
+		return nil, backendError(err)
+	}
+	list := make([]OperatorStatus, len(statuses))
+	for i, s := range statuses {
+		list[i] = statusFromAPI(s)
+	}
+	return list, nil
+}
+
+func (c *APIClient) OperatorStatus(name string) (*OperatorStatus, error) {
+	status, err := c.client.GetOperator(context.Background(), name)
+	if err != nil {
+		return nil, backendError(err)
+	}
+	s := statusFromAPI(*status)
+	return &s, nil
+}
+
+// statusFromAPI converts a status of the client package, which has its own
+// Build, Signature, Provenance, BaseImage and Scan types
+func statusFromAPI(s client.OperatorStatus) OperatorStatus {
+	status := OperatorStatus{Name: s.Name, LastUpdated: s.LastUpdated, SHA256: s.SHA256, Status: s.Status, Tags: s.Tags,
+		DisplayName: s.DisplayName, Owner: s.Owner, Note: s.Note, Criticality: s.Criticality, Team: s.Team, Contact: s.Contact, ExpectedBy: s.ExpectedBy, DaysLeft: s.DaysLeft, Overdue: s.Overdue}
+	if s.Build != nil {
+		build := registry.Build(*s.Build)
+		status.Build = &build
+	}
+	if s.Signature != nil {
+		signature := registry.Signature(*s.Signature)
+		status.Signature = &signature
+	}
+	if s.Provenance != nil {
+		provenance := registry.Provenance(*s.Provenance)
+		status.Provenance = &provenance
+	}
+	if s.BaseImage != nil {
+		base := registry.BaseImage(*s.BaseImage)
+		status.BaseImage = &base
+	}
+	if s.Scan != nil {
+		status.Scan = &registry.Scan{Scanner: s.Scan.Scanner, Completed: s.Scan.Completed, Counts: s.Scan.Counts}
+		for _, f := range s.Scan.Findings {
+			status.Scan.Findings = append(status.Scan.Findings, registry.Finding(f))
+		}
+	}
+	return status
+}
+
+// apiStatus is the reverse of statusFromAPI
+func apiStatus(s OperatorStatus) client.OperatorStatus {
+	status := client.OperatorStatus{Name: s.Name, LastUpdated: s.LastUpdated, SHA256: s.SHA256, Status: s.Status, Tags: s.Tags,
+		DisplayName: s.DisplayName, Owner: s.Owner, Note: s.Note, Criticality: s.Criticality, Team: s.Team, Contact: s.Contact, ExpectedBy: s.ExpectedBy, DaysLeft: s.DaysLeft, Overdue: s.Overdue}
+	if s.Build != nil {
+		build := client.Build(*s.Build)
+		status.Build = &build
+	}
+	if s.Signature != nil {
+		signature := client.Signature(*s.Signature)
+		status.Signature = &signature
+	}
+	if s.Provenance != nil {
+		provenance := client.Provenance(*s.Provenance)
+		status.Provenance = &provenance
+	}
+	if s.BaseImage != nil {
+		base := client.BaseImage(*s.BaseImage)
+		status.BaseImage = &base
+	}
+	if s.Scan != nil {
+		status.Scan = &client.Scan{Scanner: s.Scan.Scanner, Completed: s.Scan.Completed, Counts: s.Scan.Counts}
+		for _, f := range s.Scan.Findings {
+			status.Scan.Findings = append(status.Scan.Findings, client.Finding(f))
+		}
+	}
+	return status
+}
+
+func (c *APIClient) TicketDrift(id string) ([]OperatorDrift, error) {
+	results, err := c.client.GetDrift(context.Background(), id)
+	if err != nil {
+		return nil, backendError(err)
+	}
+	list := make([]OperatorDrift, len(results))
+	for i, r := range results {
+		list[i] = OperatorDrift{Cluster: r.Cluster, Labels: r.Labels, Operator: r.Operator, State: r.State, Latest: r.Latest, Error: r.Error}
+		for _, w := range r.Running {
+			list[i].Running = append(list[i].Running, drift.Running(w))
+		}
+		for _, in := range r.Installed {
+			list[i].Installed = append(list[i].Installed, drift.Installed(in))
+		}
+	}
+	return list, nil
+}
+
+func (c *APIClient) Discover(registries []string) (*ClusterDiscovery, error) {
+	d, err := c.client.Discover(context.Background(), registries)
+	if err != nil {
+		return nil, backendError(err)
+	}
+	discovery := &ClusterDiscovery{Operators: d.Operators, Workloads: make([]drift.Discovered, len(d.Workloads)), Errors: d.Errors}
+	for i, w := range d.Workloads {
+		discovery.Workloads[i] = drift.Discovered(w)
+	}
+	return discovery, nil
+}
+
+func (c *APIClient) TicketCatalog(id string) ([]OperatorCatalog, error) {
+	results, err := c.client.GetCatalog(context.Background(), id)
+	if err != nil {
+		return nil, backendError(err)
+	}
+	list := make([]OperatorCatalog, len(results))
+	for i, r := range results {
+		list[i] = OperatorCatalog(r)
+	}
+	return list, nil
+}
+
+func (c *APIClient) TicketApplications(id string) ([]TicketApplication, error) {
+	apps, err := c.client.GetApplications(context.Background(), id)
+	if err != nil {
+		return nil, backendError(err)
+	}
+	list := make([]TicketApplication, len(apps))
+	for i, a := range apps {
+		list[i] = TicketApplication{
+			Application: a.Application, Project: a.Project, Destination: a.Destination, Sync: a.Sync, Health: a.Health,
+			Revision: a.Revision, LastDeployed: a.LastDeployed, Images: a.Images, Error: a.Error, Operators: []argocd.Operator{},
+		}
+		for _, op := range a.Operators {
+			list[i].Operators = append(list[i].Operators, argocd.Operator(op))
+		}
+	}
+	return list, nil
+}
+
+func (c *APIClient) TicketPromotion(id string) ([]OperatorPromotion, error) {
+	results, err := c.client.GetPromotion(context.Background(), id)
+	if err != nil {
+		return nil, backendError(err)
+	}
+	list := make([]OperatorPromotion, len(results))
+	for i, r := range results {
+		list[i] = OperatorPromotion(r)
+	}
+	return list, nil
+}
+
+func (c *APIClient) TicketPipelines(id string) ([]OperatorPipeline, error) {
+	results, err := c.client.GetPipelines(context.Background(), id)
+	if err != nil {
+		return nil, backendError(err)
+	}
+	list := make([]OperatorPipeline, len(results))
+	for i, r := range results {
+		list[i] = OperatorPipeline{Operator: r.Operator, System: r.System, Pipeline: r.Pipeline, State: r.State, FailingSince: r.FailingSince, Error: r.Error}
+		if r.Last != nil {
+			run := ci.Run(*r.Last)
+			list[i].Last = &run
+		}
+	}
+	return list, nil
+}
+
+func (c *APIClient) TicketCommits(id string) ([]OperatorCommits, error) {
+	results, err := c.client.GetCommits(context.Background(), id)
+	if err != nil {
+		return nil, backendError(err)
+	}
+	list := make([]OperatorCommits, len(results))
+	for i, r := range results {
+		list[i] = OperatorCommits(r)
+	}
+	return list, nil
+}
+
+func (c *APIClient) TicketCompliance(id string) ([]OperatorCompliance, error) {
+	results, err := c.client.GetCompliance(context.Background(), id)
+	if err != nil {
+		return nil, backendError(err)
+	}
+	list := make([]OperatorCompliance, len(results))
+	for i, r := range results {
+		list[i] = OperatorCompliance{Operator: r.Operator, Compliant: r.Compliant, Latest: r.Latest, BaseImage: r.BaseImage, Rules: r.Rules}
+		for _, v := range r.Violations {
+			list[i].Violations = append(list[i].Violations, policy.Violation(v))
+		}
+	}
+	return list, nil
+}
+
+func (c *APIClient) TicketCVEs(id string) ([]CVEFix, error) {
+	results, err := c.client.GetCVEs(context.Background(), id)
+	if err != nil {
+		return nil, backendError(err)
+	}
+	list := make([]CVEFix, len(results))
+	for i, r := range results {
+		list[i] = CVEFix{Operator: r.Operator, Latest: r.Latest, Scanned: r.Scanned, Fixed: r.Fixed, Error: r.Error, CVEs: []cve.CVEStatus{}}
+		for _, c := range r.CVEs {
+			list[i].CVEs = append(list[i].CVEs, cve.CVEStatus(c))
+		}
+	}
+	return list, nil
+}
+
+func (c *APIClient) TicketPins(id string) ([]PinCheck, error) {
+	results, err := c.client.GetPins(context.Background(), id)
+	if err != nil {
+		return nil, backendError(err)
+	}
+	list := make([]PinCheck, len(results))
+	for i, r := range results {
+		list[i] = PinCheck(r)
+	}
+	return list, nil
+}
+
+// Version returns the build info of the server
+func (c *APIClient) Inventory() ([]InventoryItem, error) {
+	entries, err := c.client.ListInventory(context.Background(), client.InventoryFilter{})
+	if err != nil {
+		return nil, backendError(err)
+	}
+	items := make([]InventoryItem, len(entries))
+	for i, e := range entries {
+		items[i] = InventoryItem{
+			InventoryEntry: InventoryEntry{Name: e.Name, Team: e.Team, Contact: e.Contact, SourceRepository: e.SourceRepository, Criticality: e.Criticality, FirstSeen: e.FirstSeen, FirstTicket: e.FirstTicket, Updated: e.Updated, UpdatedBy: e.UpdatedBy},
+			Tickets:        e.Tickets,
+		}
+	}
+	return items, nil
+}
+
+func (c *APIClient) Comments(id string) ([]Comment, error) {
+	comments, err := c.client.ListComments(context.Background(), id)
+	if err != nil {
+		return nil, backendError(err)
+	}
+	list := make([]Comment, len(comments))
+	for i, cm := range comments {
+		list[i] = Comment(cm)
+	}
+	return list, nil
+}
+
+func (c *APIClient) AddComment(id, body string) (Comment, error) {
+	comment, err := c.client.AddComment(context.Background(), id, body)
+	if err != nil {
+		return Comment{}, backendError(err)
+	}
+	return Comment(*comment), nil
+}
+
+func (c *APIClient) AnnotateDigest(operator, digest, reason string) (DigestAnnotation, error) {
+	a, err := c.client.AnnotateDigest(context.Background(), store.NormalizeOperator(operator), digest, reason)
+	if err != nil {
+		return DigestAnnotation{}, backendError(err)
+	}
+	return DigestAnnotation(*a), nil
+}
+
+func (c *APIClient) Projects() ([]projectInfo, error) {
+	projects, err := c.client.ListProjects(context.Background())
+	if err != nil {
+		return nil, backendError(err)
+	}
+	infos := make([]projectInfo, len(projects))
+	for i, p := range projects {
+		infos[i] = projectInfo(p)
+	}
+	return infos, nil
+}
+
+func (c *APIClient) Favorites() ([]string, error) {
+	prefs, err := c.client.GetPreferences(context.Background())
+	if err != nil {
+		return nil, backendError(err)
+	}
+	return prefs.Favorites, nil
+}
+
+func (c *APIClient) StarTicket(id string, starred bool) ([]string, error) {
+	star := c.client.UnstarTicket
+	if starred {
+		star = c.client.StarTicket
+	}
+	prefs, err := star(context.Background(), id)
+	if err != nil {
+		return nil, backendError(err)
+	}
+	return prefs.Favorites, nil
+}
+
+func (c *APIClient) Version() (*BuildInfo, error) {
+	info, err := c.client.Version(context.Background())
+	if err != nil {
+		return nil, backendError(err)
+	}
+	b := BuildInfo(*info)
+	return &b, nil
+}
+
+// backendError turns an error response back into the server's error, so
+// callers can match it with errors.Is just like a local backend's
+func backendError(err error) error {
+	var apiErr *client.Error
+	if !errors.As(err, &apiErr) {
+		return err
+	}
+	if sentinel := api.CodeError(apiErr.Code); sentinel != nil {
+		return &serverError{msg: apiErr.Message, err: sentinel}
+	}
+	return err
+}
+
+// serverError keeps the server's message while matching its sentinel error
+type serverError struct {
+	msg string
+	err error
+}
+
+func (e *serverError) Error() string { return e.msg }
+func (e *serverError) Unwrap() error { return e.err }
+
+func sortedTickets(tickets map[string]JiraTicket) []JiraTicket {
+	list := make([]JiraTicket, 0, len(tickets))
+	for _, t := range tickets {
+		list = append(list, t)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list
+}
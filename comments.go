@@ -0,0 +1,276 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"OpTrack/internal/api"
+	"OpTrack/internal/clock"
+	"OpTrack/internal/ids"
+	"OpTrack/internal/markdown"
+	"OpTrack/internal/store"
+)
+
+// maxCommentLength is the longest comment body, in characters
+const maxCommentLength = 10000
+
+// maxCommentPage is the most comments a request lists, from the given offset
+const maxCommentPage = 500
+
+var (
+	errCommentNotFound  = errors.New("comment not found")
+	errCommentForbidden = errors.New("only the author can delete a comment")
+)
+
+// Comment is a note on a ticket, such as "waiting on CPaaS pipeline fix"
+type Comment struct {
+	ID      string    `json:"id"`
+	Ticket  string    `json:"ticket"`
+	Author  string    `json:"author"`
+	Created time.Time `json:"created"`
+	Body    string    `json:"body"`           // Markdown
+	HTML    string    `json:"html,omitempty"` // Body rendered, set in API responses
+}
+
+// CommentStore keeps the comments on every ticket in the settings directory
+type CommentStore struct {
+	mu       sync.RWMutex
+	path     string
+	comments map[string][]Comment // Ticket ID -> comments, oldest first
+	clock    clock.Clock
+}
+
+func NewCommentStore(dataDir string, clk clock.Clock) (*CommentStore, error) {
+	dir, err := store.SettingsDir(dataDir)
+	if err != nil {
+		return nil, err
+	}
+	s := &CommentStore{
+		path:     filepath.Join(dir, "ticket-comments.json"),
+		comments: make(map[string][]Comment),
+		clock:    clk,
+	}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// load reads the comments file, picking up comments other replicas added
+func (s *CommentStore) load() error {
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	comments := make(map[string][]Comment)
+	if err := json.Unmarshal(data, &comments); err != nil {
+		return fmt.Errorf("failed to parse %s: %v", s.path, err)
+	}
+	s.mu.Lock()
+	s.comments = comments
+	s.mu.Unlock()
+	return nil
+}
+
+// List returns the comments on a ticket, oldest first
+func (s *CommentStore) List(ticket string) []Comment {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return slices.Clone(s.comments[ticket])
+}
+
+// Latest returns when the newest comment on a ticket was written, or the
+// zero time for tickets without comments
+func (s *CommentStore) Latest(ticket string) time.Time {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if comments := s.comments[ticket]; len(comments) > 0 {
+		return comments[len(comments)-1].Created
+	}
+	return time.Time{}
+}
+
+// Add appends a comment to a ticket
+func (s *CommentStore) Add(ticket, author, body string) (Comment, error) {
+	comment := Comment{
+		ID:      ids.Random.New()[:16],
+		Ticket:  ticket,
+		Author:  author,
+		Created: s.clock.Now(),
+		Body:    body,
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old := s.comments[ticket]
+	s.comments[ticket] = append(slices.Clip(old), comment)
+	if err := s.save(); err != nil {
+		s.comments[ticket] = old
+		return Comment{}, err
+	}
+	return comment, nil
+}
+
+// Delete removes a comment on a ticket, as long as actor wrote it
+func (s *CommentStore) Delete(ticket, id, actor string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	old := s.comments[ticket]
+	i := slices.IndexFunc(old, func(c Comment) bool { return c.ID == id })
+	if i < 0 {
+		return errCommentNotFound
+	}
+	if old[i].Author != actor {
+		return errCommentForbidden
+	}
+	s.comments[ticket] = slices.Delete(slices.Clone(old), i, i+1)
+	if err := s.save(); err != nil {
+		s.comments[ticket] = old
+		return err
+	}
+	return nil
+}
+
+// deleteTicket removes the comments on a deleted ticket
+func (s *CommentStore) deleteTicket(ticket string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	old, ok := s.comments[ticket]
+	if !ok {
+		return nil
+	}
+	delete(s.comments, ticket)
+	if err := s.save(); err != nil {
+		s.comments[ticket] = old
+		return err
+	}
+	return nil
+}
+
+// save writes the comments file. The caller holds s.mu.
+func (s *CommentStore) save() error {
+	for ticket, comments := range s.comments {
+		if len(comments) == 0 {
+			delete(s.comments, ticket)
+		}
+	}
+	data, err := json.MarshalIndent(s.comments, "", "    ")
+	if err != nil {
+		return err
+	}
+	if err := store.WriteFileAtomic(s.path, data, 0644); err != nil {
+		return fmt.Errorf("%w: failed to save comments: %v", store.ErrStorage, err)
+	}
+	return nil
+}
+
+// checkComment trims a comment body and checks it isn't empty or too long
+func checkComment(body string) (string, error) {
+	body = strings.TrimSpace(body)
+	if body == "" {
+		return "", errors.New("a comment needs a body")
+	}
+	if utf8.RuneCountInString(body) > maxCommentLength {
+		return "", fmt.Errorf("comments are at most %d characters", maxCommentLength)
+	}
+	return body, nil
+}
+
+// withHTML sets the rendered body of a comment
+func withHTML(comment Comment) Comment {
+	comment.HTML = string(markdown.ToHTML(comment.Body))
+	return comment
+}
+
+// commentRequest is the body of POST /api/v1/tickets/{id}/comments
+type commentRequest struct {
+	Body string `json:"body"`
+}
+
+// handleComments lists the comments on a ticket and adds new ones at
+// /api/v1/tickets/{id}/comments
+func (s *CommentStore) handleComments(state *AppState) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ticket, ok := state.Get(r.PathValue("id"))
+		if !ok {
+			api.WriteError(w, requestID(r), store.ErrTicketNotFound)
+			return
+		}
+
+		if r.Method == "GET" {
+			page, err := parsePage(r, maxCommentPage, maxCommentPage)
+			if err != nil {
+				httpError(w, r, err.Error(), http.StatusBadRequest)
+				return
+			}
+			all := s.List(ticket.ID)
+			comments := pageOf(all, page)
+			for i := range comments {
+				comments[i] = withHTML(comments[i])
+			}
+			if comments == nil {
+				comments = []Comment{}
+			}
+			setPageHeaders(w, r, page, len(all))
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(comments)
+			return
+		}
+
+		var req commentRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			httpError(w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
+		body, err := checkComment(req.Body)
+		if err != nil {
+			httpError(w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
+		comment, err := s.Add(ticket.ID, requestActor(r), body)
+		if err != nil {
+			requestLogger(r).Error("Failed to save comment", "error", err)
+			api.WriteError(w, requestID(r), err)
+			return
+		}
+		state.audit.Record(r, "comment.create", ticket.ID, map[string]interface{}{"id": comment.ID})
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(withHTML(comment))
+	}
+}
+
+// handleDeleteComment removes a comment at
+// /api/v1/tickets/{id}/comments/{comment}, for its author only
+func (s *CommentStore) handleDeleteComment(state *AppState) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		err := s.Delete(id, r.PathValue("comment"), requestActor(r))
+		switch {
+		case errors.Is(err, errCommentNotFound):
+			httpError(w, r, err.Error(), http.StatusNotFound)
+		case errors.Is(err, errCommentForbidden):
+			httpError(w, r, err.Error(), http.StatusForbidden)
+		case err != nil:
+			requestLogger(r).Error("Failed to delete comment", "error", err)
+			api.WriteError(w, requestID(r), err)
+		default:
+			state.audit.Record(r, "comment.delete", id, map[string]interface{}{"id": r.PathValue("comment")})
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}
+}
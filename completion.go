@@ -0,0 +1,67 @@
+package main
+
+import (
+	"log/slog"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// Shell completion scripts come from cobra's built-in completion command:
+//
+//	source <(optrack completion bash)
+//	optrack completion zsh > "${fpath[1]}/_optrack"
+//	optrack completion fish > ~/.config/fish/completions/optrack.fish
+
+// completeTickets completes ticket IDs from the server, or the local data
+// directory when no server is set
+func completeTickets(opts *cliOptions) func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		tickets, err := completionTickets(opts, cmd)
+		if err != nil {
+			return nil, cobra.ShellCompDirectiveError
+		}
+
+		var ids []string
+		for _, t := range tickets {
+			if strings.HasPrefix(t.ID, toComplete) {
+				ids = append(ids, t.ID)
+			}
+		}
+		return ids, cobra.ShellCompDirectiveNoFileComp
+	}
+}
+
+// completeFirstTicket completes a ticket ID for the first argument only
+func completeFirstTicket(opts *cliOptions) func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+	complete := completeTickets(opts)
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		if len(args) > 0 {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		return complete(cmd, args, toComplete)
+	}
+}
+
+// completionTickets lists tickets for completion. Completion skips the root
+// command's setup, so the config is loaded here.
+func completionTickets(opts *cliOptions, cmd *cobra.Command) ([]JiraTicket, error) {
+	if opts.cfg == nil {
+		setupLogging(slog.LevelError)
+		cfg, err := opts.loadConfig(cmd)
+		if err != nil {
+			return nil, err
+		}
+		opts.cfg = cfg
+	}
+	backend, err := opts.backend()
+	if err != nil {
+		return nil, err
+	}
+	return backend.ListTickets()
+}
+
+// completeOutputFormats completes the -o flag
+func completeOutputFormats(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	return outputFormats, cobra.ShellCompDirectiveNoFileComp
+}
@@ -0,0 +1,884 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"OpTrack/internal/github"
+	"OpTrack/internal/kube"
+	"OpTrack/internal/scan"
+)
+
+// Config holds the core server settings. Values are layered: built-in
+// defaults, then the YAML config file, then OPTRACK_* environment variables,
+// then command line flags.
+type Config struct {
+	Listen           string               `yaml:"listen"`
+	BasePath         string               `yaml:"basePath"`
+	Timezone         string               `yaml:"timezone"`
+	DataDir          string               `yaml:"dataDir"`
+	TemplatesDir     string               `yaml:"templatesDir"` // Overrides for the built-in web templates and static files
+	PollInterval     Duration             `yaml:"pollInterval"`
+	ShutdownTimeout  Duration             `yaml:"shutdownTimeout"`
+	Thresholds       Thresholds           `yaml:"thresholds"`
+	Archive          ArchiveConfig        `yaml:"archive"`
+	Criticality      CriticalityConfig    `yaml:"criticality"`      // How much operators count towards completion, see criticality.go
+	AllowedOperators []string             `yaml:"allowedOperators"` // Glob patterns of registry/namespace/repository tickets may track; any when empty
+	Limits           LimitsConfig         `yaml:"limits"`           // How many operators and tickets may be tracked, see limits.go
+	Quay             QuayConfig           `yaml:"quay"`
+	Auth             AuthConfig           `yaml:"auth"`
+	Projects         []ProjectConfig      `yaml:"projects"` // Who may see and change the tickets of each project, see projects.go
+	Owners           OwnersConfig         `yaml:"owners"`   // Teams owning operators, see owners.go
+	HTTP             HTTPConfig           `yaml:"http"`
+	Notifications    NotificationsConfig  `yaml:"notifications"`
+	Plugins          PluginsConfig        `yaml:"plugins"`
+	Clusters         []ClusterConfig      `yaml:"clusters"`       // Compared with the latest images, see drift.go
+	Catalogs         []CatalogConfig      `yaml:"catalogs"`       // Compared with the latest images, see catalog.go
+	SaasFiles        []SaasFileConfig     `yaml:"saasFiles"`      // Compared with the latest images, see saas.go
+	CI               CIConfig             `yaml:"ci"`             // Build pipelines of operators, see pipelines.go
+	GitHub           GitHubConfig         `yaml:"github"`         // Source repositories of operators, see github.go
+	Builds           BuildsConfig         `yaml:"builds"`         // Build systems images are built with, see builds.go
+	Bundles          BundlesConfig        `yaml:"bundles"`        // How bundle images are pulled, see related.go
+	Signatures       SignaturesConfig     `yaml:"signatures"`     // Trusted signers of images, see signatures.go
+	BaseImages       BaseImagesConfig     `yaml:"baseImages"`     // Base image checks of images, see baseimages.go
+	Scans            ScansConfig          `yaml:"scans"`          // Vulnerability scans of images, see scans.go
+	Policy           PolicyConfig         `yaml:"policy"`         // Compliance rules operators are checked against, see policy.go
+	ArgoCD           ArgoCDConfig         `yaml:"argocd"`         // Where tickets' applications are read from, see argocd.go
+	Controller       ControllerConfig     `yaml:"controller"`     // Tickets from custom resources, see controller.go
+	LeaderElection   LeaderElectionConfig `yaml:"leaderElection"` // Which replica polls, see leader.go
+}
+
+// Thresholds are the operator ages used for highlighting and stale alerts
+type Thresholds struct {
+	Warning Duration `yaml:"warning"`
+	Stale   Duration `yaml:"stale"`
+}
+
+// ArchiveConfig is when tickets are archived automatically, see archive.go
+type ArchiveConfig struct {
+	After Duration `yaml:"after"` // How long a ticket may go unchanged, 0 to never archive tickets
+}
+
+// QuayConfig configures the Quay.io API client
+type QuayConfig struct {
+	URL      string   `yaml:"url"`
+	Timeout  Duration `yaml:"timeout"`
+	CacheTTL Duration `yaml:"cacheTTL"`
+	// StaleTTL is how long after CacheTTL a lookup is still answered while
+	// it is refreshed in the background, see statuscache.go
+	StaleTTL Duration `yaml:"staleTTL"`
+	// Connections to Quay.io, so refreshes of many operators reuse them. A
+	// MaxIdleConnsPerHost of 0 leaves Go's default of 2.
+	MaxIdleConnsPerHost int      `yaml:"maxIdleConnsPerHost"`
+	TLSHandshakeTimeout Duration `yaml:"tlsHandshakeTimeout"`
+	KeepAlive           Duration `yaml:"keepAlive"`
+	// RequestsPerMinute paces requests to Quay.io, slowing down further when
+	// it rate limits them, see registry.Budget; 0 for no limit
+	RequestsPerMinute int `yaml:"requestsPerMinute"`
+}
+
+// AuthConfig controls how users are identified. OpTrack has no login of its
+// own and trusts these headers from an authenticating reverse proxy.
+type AuthConfig struct {
+	ActorHeaders []string `yaml:"actorHeaders"`
+	GroupsHeader string   `yaml:"groupsHeader"` // Header with the user's comma separated groups, for project members
+	AdminToken   string   `yaml:"adminToken"`   // Bearer token for /api/admin endpoints, disabled when empty
+}
+
+// HTTPConfig configures the middleware every request passes through
+type HTTPConfig struct {
+	CORSOrigins []string `yaml:"corsOrigins"` // Origins allowed to call the API from a browser, "*" for any
+	RateLimit   float64  `yaml:"rateLimit"`   // Requests per second per client, 0 for no limit
+	RateBurst   int      `yaml:"rateBurst"`
+	// Reverse proxies, as addresses or CIDR ranges, whose actor headers tell
+	// clients apart for the rate limit; other clients are told apart by address
+	TrustedProxies []string `yaml:"trustedProxies"`
+	// Pages that may show the /embed widgets in a frame, as origins such as
+	// https://confluence.example.com or https://*.atlassian.net
+	EmbedAncestors []string `yaml:"embedAncestors"`
+}
+
+// NotificationsConfig holds the notification channel credentials
+type NotificationsConfig struct {
+	SMTP   SMTPConfig   `yaml:"smtp"`
+	Slack  SlackConfig  `yaml:"slack"`
+	Teams  TeamsConfig  `yaml:"teams"`
+	Matrix MatrixConfig `yaml:"matrix"`
+	// TeamChannels are where events about the operators of each team in
+	// the inventory go, by team name, see owners.go
+	TeamChannels map[string]TeamChannels `yaml:"teamChannels"`
+}
+
+// Duration is a time.Duration that also accepts a "d" suffix for days in the
+// config file, e.g. "30d"
+type Duration time.Duration
+
+func (d *Duration) UnmarshalYAML(node *yaml.Node) error {
+	value, err := parseAge(node.Value)
+	if err != nil {
+		return fmt.Errorf("line %d: invalid duration %q", node.Line, node.Value)
+	}
+	*d = Duration(value)
+	return nil
+}
+
+func (d Duration) MarshalYAML() (interface{}, error) {
+	return d.String(), nil
+}
+
+// String formats whole days as "30d" and anything else as a Go duration
+func (d Duration) String() string {
+	day := Duration(24 * time.Hour)
+	if d > 0 && d%day == 0 {
+		return fmt.Sprintf("%dd", d/day)
+	}
+	return time.Duration(d).String()
+}
+
+func defaultConfig() *Config {
+	return &Config{
+		Listen:          ":8080",
+		DataDir:         "./data",
+		Timezone:        "UTC",
+		PollInterval:    Duration(defaultPollInterval),
+		ShutdownTimeout: Duration(defaultShutdownTimeout),
+		Thresholds: Thresholds{
+			Warning: Duration(14 * 24 * time.Hour),
+			Stale:   Duration(30 * 24 * time.Hour),
+		},
+		Criticality: CriticalityConfig{
+			Weights: map[string]float64{"critical": 10, "normal": 1, "low": 0.25},
+		},
+		Limits: LimitsConfig{
+			MaxOperatorsPerTicket: defaultMaxOperatorsPerTicket,
+		},
+		Quay: QuayConfig{
+			URL:      "https://quay.io",
+			Timeout:  Duration(10 * time.Second),
+			CacheTTL: Duration(time.Minute),
+			StaleTTL: Duration(defaultStaleTTL),
+
+			MaxIdleConnsPerHost: 32,
+			TLSHandshakeTimeout: Duration(10 * time.Second),
+			KeepAlive:           Duration(30 * time.Second),
+			RequestsPerMinute:   defaultQuayRequestsPerMinute,
+		},
+		Auth: AuthConfig{
+			ActorHeaders: []string{"X-Forwarded-User", "X-Forwarded-Email", "X-Remote-User"},
+			GroupsHeader: "X-Forwarded-Groups",
+		},
+		HTTP: HTTPConfig{
+			RateBurst: 20,
+		},
+		Notifications: NotificationsConfig{
+			SMTP: SMTPConfig{Port: 587},
+		},
+		GitHub: GitHubConfig{
+			URL:     github.DefaultURL,
+			Timeout: Duration(10 * time.Second),
+		},
+		CI: CIConfig{
+			Jenkins: JenkinsConfig{Timeout: Duration(10 * time.Second)},
+		},
+		Builds: BuildsConfig{
+			OSBS: OSBSConfig{Timeout: Duration(10 * time.Second)},
+		},
+		Bundles: BundlesConfig{
+			Timeout: Duration(30 * time.Second),
+		},
+		Signatures: SignaturesConfig{
+			Timeout: Duration(30 * time.Second),
+		},
+		BaseImages: BaseImagesConfig{
+			History: defaultBaseImageHistory,
+			Timeout: Duration(30 * time.Second),
+		},
+		Scans: ScansConfig{
+			Timeout:     Duration(defaultScanTimeout),
+			Interval:    Duration(defaultScanInterval),
+			Concurrency: defaultScanConcurrency,
+			Findings:    defaultScanFindings,
+		},
+		ArgoCD: ArgoCDConfig{
+			Timeout: Duration(10 * time.Second),
+		},
+		Controller: ControllerConfig{
+			Resync: Duration(defaultControllerResync),
+		},
+		LeaderElection: LeaderElectionConfig{
+			Lock:          defaultLeaderLock,
+			LeaseDuration: Duration(defaultLeaderLeaseDuration),
+			Lease:         LeaseConfig{Name: defaultLeaseName},
+		},
+	}
+}
+
+// LoadConfig reads the config file at path, if any, and applies environment
+// variable overrides. The result is not validated yet so flags can still be
+// applied on top.
+func LoadConfig(path string) (*Config, error) {
+	cfg := defaultConfig()
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read config file: %v", err)
+		}
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true) // Catch misspelled keys rather than silently ignoring them
+		if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+		}
+	}
+
+	if err := cfg.applyEnv(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func (c *Config) applyEnv() error {
+	n := &c.Notifications
+	stringVars := map[string]*string{
+		"OPTRACK_LISTEN":               &c.Listen,
+		"OPTRACK_BASE_PATH":            &c.BasePath,
+		"OPTRACK_TIMEZONE":             &c.Timezone,
+		"OPTRACK_DATA_DIR":             &c.DataDir,
+		"OPTRACK_TEMPLATES_DIR":        &c.TemplatesDir,
+		"OPTRACK_QUAY_URL":             &c.Quay.URL,
+		"OPTRACK_ADMIN_TOKEN":          &c.Auth.AdminToken,
+		"OPTRACK_AUTH_GROUPS_HEADER":   &c.Auth.GroupsHeader,
+		"OPTRACK_SMTP_HOST":            &n.SMTP.Host,
+		"OPTRACK_SMTP_USERNAME":        &n.SMTP.Username,
+		"OPTRACK_SMTP_PASSWORD":        &n.SMTP.Password,
+		"OPTRACK_SMTP_FROM":            &n.SMTP.From,
+		"OPTRACK_SLACK_WEBHOOK_URL":    &n.Slack.WebhookURL,
+		"OPTRACK_SLACK_BOT_TOKEN":      &n.Slack.BotToken,
+		"OPTRACK_SLACK_SIGNING_SECRET": &n.Slack.SigningSecret,
+		"OPTRACK_TEAMS_WEBHOOK_URL":    &n.Teams.WebhookURL,
+		"OPTRACK_MATRIX_HOMESERVER":    &n.Matrix.Homeserver,
+		"OPTRACK_MATRIX_ACCESS_TOKEN":  &n.Matrix.AccessToken,
+		"OPTRACK_MATRIX_ROOM_ID":       &n.Matrix.RoomID,
+		"OPTRACK_ARGOCD_URL":           &c.ArgoCD.URL,
+		"OPTRACK_ARGOCD_TOKEN":         &c.ArgoCD.Token,
+		"OPTRACK_GITHUB_URL":           &c.GitHub.URL,
+		"OPTRACK_GITHUB_TOKEN":         &c.GitHub.Token,
+		"OPTRACK_JENKINS_USER":         &c.CI.Jenkins.User,
+		"OPTRACK_JENKINS_TOKEN":        &c.CI.Jenkins.Token,
+		"OPTRACK_BUNDLE_USERNAME":      &c.Bundles.Username,
+		"OPTRACK_BUNDLE_PASSWORD":      &c.Bundles.Password,
+		"OPTRACK_SIGNATURES_USERNAME":  &c.Signatures.Username,
+		"OPTRACK_SIGNATURES_PASSWORD":  &c.Signatures.Password,
+		"OPTRACK_BASE_IMAGES_USERNAME": &c.BaseImages.Username,
+		"OPTRACK_BASE_IMAGES_PASSWORD": &c.BaseImages.Password,
+		"OPTRACK_SCANS_USERNAME":       &c.Scans.Username,
+		"OPTRACK_SCANS_PASSWORD":       &c.Scans.Password,
+		"OPTRACK_POLICY_FILE":          &c.Policy.File,
+		"OPTRACK_OWNERS_FILE":          &c.Owners.File,
+		"OPTRACK_LEADER_IDENTITY":      &c.LeaderElection.Identity,
+	}
+	for name, field := range stringVars {
+		if value := os.Getenv(name); value != "" {
+			*field = value
+		}
+	}
+
+	durations := map[string]*Duration{
+		"OPTRACK_POLL_INTERVAL":    &c.PollInterval,
+		"OPTRACK_SHUTDOWN_TIMEOUT": &c.ShutdownTimeout,
+		"OPTRACK_WARN_AFTER":       &c.Thresholds.Warning,
+		"OPTRACK_STALE_AFTER":      &c.Thresholds.Stale,
+		"OPTRACK_ARCHIVE_AFTER":    &c.Archive.After,
+		"OPTRACK_QUAY_TIMEOUT":     &c.Quay.Timeout,
+		"OPTRACK_QUAY_CACHE_TTL":   &c.Quay.CacheTTL,
+		"OPTRACK_QUAY_STALE_TTL":   &c.Quay.StaleTTL,
+
+		"OPTRACK_QUAY_TLS_HANDSHAKE_TIMEOUT": &c.Quay.TLSHandshakeTimeout,
+		"OPTRACK_QUAY_KEEP_ALIVE":            &c.Quay.KeepAlive,
+	}
+	for name, field := range durations {
+		if value := os.Getenv(name); value != "" {
+			d, err := parseAge(value)
+			if err != nil {
+				return fmt.Errorf("invalid %s %q", name, value)
+			}
+			*field = Duration(d)
+		}
+	}
+
+	if value := os.Getenv("OPTRACK_AUTH_ACTOR_HEADERS"); value != "" {
+		c.Auth.ActorHeaders = splitList(value)
+	}
+	if value := os.Getenv("OPTRACK_ALLOWED_OPERATORS"); value != "" {
+		c.AllowedOperators = splitList(value)
+	}
+	if value := os.Getenv("OPTRACK_CORS_ORIGINS"); value != "" {
+		c.HTTP.CORSOrigins = splitList(value)
+	}
+	if value := os.Getenv("OPTRACK_EMBED_ANCESTORS"); value != "" {
+		c.HTTP.EmbedAncestors = splitList(value)
+	}
+	if value := os.Getenv("OPTRACK_TRUSTED_PROXIES"); value != "" {
+		c.HTTP.TrustedProxies = splitList(value)
+	}
+	if value := os.Getenv("OPTRACK_RATE_LIMIT"); value != "" {
+		rate, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("invalid OPTRACK_RATE_LIMIT %q", value)
+		}
+		c.HTTP.RateLimit = rate
+	}
+	if value := os.Getenv("OPTRACK_RATE_BURST"); value != "" {
+		burst, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("invalid OPTRACK_RATE_BURST %q", value)
+		}
+		c.HTTP.RateBurst = burst
+	}
+	if value := os.Getenv("OPTRACK_QUAY_MAX_IDLE_CONNS_PER_HOST"); value != "" {
+		conns, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("invalid OPTRACK_QUAY_MAX_IDLE_CONNS_PER_HOST %q", value)
+		}
+		c.Quay.MaxIdleConnsPerHost = conns
+	}
+	if value := os.Getenv("OPTRACK_QUAY_REQUESTS_PER_MINUTE"); value != "" {
+		budget, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("invalid OPTRACK_QUAY_REQUESTS_PER_MINUTE %q", value)
+		}
+		c.Quay.RequestsPerMinute = budget
+	}
+	if value := os.Getenv("OPTRACK_SMTP_PORT"); value != "" {
+		port, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("invalid OPTRACK_SMTP_PORT %q", value)
+		}
+		n.SMTP.Port = port
+	}
+	return nil
+}
+
+// Validate reports every problem with the configuration at once
+func (c *Config) Validate() error {
+	var problems []string
+	add := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if err := validListen(c.Listen); err != nil {
+		add("listen: %v", err)
+	}
+	if err := validBasePath(c.BasePath); err != nil {
+		add("basePath: %v", err)
+	}
+	if _, err := time.LoadLocation(c.Timezone); err != nil {
+		add("timezone: %q is not an IANA timezone such as \"Europe/Berlin\" or \"UTC\"", c.Timezone)
+	}
+	if c.DataDir == "" {
+		add("dataDir: must not be empty")
+	}
+	if c.TemplatesDir != "" {
+		if info, err := os.Stat(c.TemplatesDir); err != nil || !info.IsDir() {
+			add("templatesDir: %q is not a directory", c.TemplatesDir)
+		}
+	}
+	if c.PollInterval < Duration(time.Minute) {
+		add("pollInterval: must be at least 1m, got %s", c.PollInterval)
+	}
+	if c.ShutdownTimeout <= 0 {
+		add("shutdownTimeout: must be positive")
+	}
+	if c.Thresholds.Warning <= 0 || c.Thresholds.Stale <= 0 {
+		add("thresholds: warning and stale must be positive")
+	} else if c.Thresholds.Warning >= c.Thresholds.Stale {
+		add("thresholds: warning (%s) must be less than stale (%s)", c.Thresholds.Warning, c.Thresholds.Stale)
+	}
+	if c.Archive.After < 0 || (c.Archive.After > 0 && c.Archive.After < Duration(24*time.Hour)) {
+		add("archive.after: must be 0 or at least 1d, got %s", c.Archive.After)
+	}
+	for criticality, weight := range c.Criticality.Weights {
+		if !slices.Contains(criticalities, criticality) {
+			add("criticality.weights: unknown criticality %q, use one of %s", criticality, strings.Join(criticalities, ", "))
+		} else if weight <= 0 {
+			add("criticality.weights.%s: must be positive, got %g", criticality, weight)
+		}
+	}
+	for _, pattern := range c.AllowedOperators {
+		if _, err := path.Match(pattern, ""); err != nil {
+			add("allowedOperators: invalid pattern %q", pattern)
+		}
+	}
+	for _, limit := range []struct {
+		field string
+		value int
+	}{
+		{"maxOperatorsPerTicket", c.Limits.MaxOperatorsPerTicket},
+		{"maxTickets", c.Limits.MaxTickets},
+		{"maxTicketsPerOwner", c.Limits.MaxTicketsPerOwner},
+		{"maxTicketsPerProject", c.Limits.MaxTicketsPerProject},
+	} {
+		if limit.value < 0 {
+			add("limits.%s: must not be negative, 0 for no limit", limit.field)
+		}
+	}
+	if u, err := url.Parse(c.Quay.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		add("quay.url: %q is not an http(s) URL", c.Quay.URL)
+	}
+	if c.Quay.Timeout <= 0 {
+		add("quay.timeout: must be positive")
+	}
+	if c.Quay.CacheTTL < 0 {
+		add("quay.cacheTTL: must not be negative")
+	}
+	if c.Quay.StaleTTL < 0 {
+		add("quay.staleTTL: must not be negative")
+	}
+	if c.Quay.MaxIdleConnsPerHost < 0 {
+		add("quay.maxIdleConnsPerHost: must not be negative, 0 for Go's default of 2")
+	}
+	if c.Quay.TLSHandshakeTimeout <= 0 {
+		add("quay.tlsHandshakeTimeout: must be positive")
+	}
+	if c.Quay.KeepAlive <= 0 {
+		add("quay.keepAlive: must be positive")
+	}
+	if c.Quay.RequestsPerMinute < 0 {
+		add("quay.requestsPerMinute: must not be negative, 0 for no limit")
+	}
+	if len(c.Auth.ActorHeaders) == 0 {
+		add("auth.actorHeaders: at least one header is required")
+	}
+
+	for _, origin := range c.HTTP.CORSOrigins {
+		if u, err := url.Parse(origin); origin != "*" && (err != nil || u.Scheme == "" || u.Host == "" || strings.TrimSuffix(u.Path, "/") != "") {
+			add("http.corsOrigins: %q is not an origin such as https://dashboard.example.com, or *", origin)
+		}
+	}
+	for _, origin := range c.HTTP.EmbedAncestors {
+		if !validFrameAncestor(origin) {
+			add("http.embedAncestors: %q is not an origin such as https://confluence.example.com or https://*.atlassian.net", origin)
+		}
+	}
+	if c.HTTP.RateLimit < 0 {
+		add("http.rateLimit: must not be negative")
+	}
+	if c.HTTP.RateLimit > 0 && c.HTTP.RateBurst < 1 {
+		add("http.rateBurst: must be at least 1 when http.rateLimit is set")
+	}
+	if _, err := parseProxies(c.HTTP.TrustedProxies); err != nil {
+		add("http.trustedProxies: %v", err)
+	}
+
+	n := c.Notifications
+	if n.SMTP.Host != "" {
+		if n.SMTP.From == "" {
+			add("notifications.smtp.from: required when notifications.smtp.host is set")
+		} else if _, err := emailAddress(n.SMTP.From); err != nil {
+			add("notifications.smtp.from: %v", err)
+		}
+		if n.SMTP.Port < 1 || n.SMTP.Port > 65535 {
+			add("notifications.smtp.port: %d is not a valid port", n.SMTP.Port)
+		}
+	}
+	if n.Matrix.Homeserver != "" && (n.Matrix.AccessToken == "" || n.Matrix.RoomID == "") {
+		add("notifications.matrix: accessToken and roomID are required when homeserver is set")
+	}
+	for team, channels := range n.TeamChannels {
+		if channels.Email == "" && channels.SlackWebhookURL == "" && channels.TeamsWebhookURL == "" {
+			add("notifications.teamChannels.%s: email, slackWebhookURL or teamsWebhookURL is required", team)
+		}
+		if channels.Email != "" && n.SMTP.Host == "" {
+			add("notifications.teamChannels.%s.email: needs notifications.smtp.host", team)
+		}
+		for field, value := range map[string]string{"slackWebhookURL": channels.SlackWebhookURL, "teamsWebhookURL": channels.TeamsWebhookURL} {
+			if u, err := url.Parse(value); value != "" && (err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "") {
+				add("notifications.teamChannels.%s.%s: %q is not an http(s) URL", team, field, value)
+			}
+		}
+	}
+
+	if c.Plugins.Registry.Timeout < 0 {
+		add("plugins.registry.timeout: must not be negative")
+	}
+	channels := map[string]bool{"email": true, "slack": true, "teams": true, "matrix": true, "subscriptions": true, "owners": true}
+	for i, p := range c.Plugins.Notifiers {
+		switch {
+		case p.Name == "":
+			add("plugins.notifiers[%d].name: required", i)
+		case channels[p.Name]:
+			add("plugins.notifiers[%d].name: %q is already a channel name", i, p.Name)
+		}
+		channels[p.Name] = true
+		if p.Command == "" {
+			add("plugins.notifiers[%d].command: required", i)
+		}
+		if p.Timeout < 0 {
+			add("plugins.notifiers[%d].timeout: must not be negative", i)
+		}
+	}
+
+	projects := make(map[string]bool)
+	for i, project := range c.Projects {
+		switch {
+		case project.Name == "":
+			add("projects[%d].name: required", i)
+		case !namePattern.MatchString(project.Name):
+			add("projects[%d].name: %q must be lowercase letters, digits and dashes", i, project.Name)
+		case projects[project.Name]:
+			add("projects[%d].name: %q is used by another project", i, project.Name)
+		}
+		projects[project.Name] = true
+		for _, member := range append(slices.Clone(project.Viewers), project.Editors...) {
+			if name, isGroup := strings.CutPrefix(member, "group:"); member == "" || (isGroup && name == "") {
+				add("projects[%d]: %q is not a user, group:<name> or *", i, member)
+			}
+		}
+	}
+
+	clusters := make(map[string]bool)
+	for i, cluster := range c.Clusters {
+		switch {
+		case cluster.Name == "":
+			add("clusters[%d].name: required", i)
+		case clusters[cluster.Name]:
+			add("clusters[%d].name: %q is used by another cluster", i, cluster.Name)
+		}
+		clusters[cluster.Name] = true
+		if len(cluster.Namespaces) == 0 {
+			add("clusters[%d].namespaces: at least one namespace is required", i)
+		}
+		if cluster.Server != "" {
+			if u, err := url.Parse(cluster.Server); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				add("clusters[%d].server: %q is not an http(s) URL", i, cluster.Server)
+			}
+			if cluster.Token == "" && cluster.TokenFile == "" {
+				add("clusters[%d]: token or tokenFile is required when server is set", i)
+			}
+			if cluster.Kubeconfig != "" || cluster.Context != "" {
+				add("clusters[%d]: set either server or kubeconfig and context, not both", i)
+			}
+		} else if cluster.Token != "" || cluster.TokenFile != "" || cluster.CAFile != "" {
+			add("clusters[%d]: token, tokenFile and caFile need server", i)
+		}
+	}
+
+	catalogs := make(map[string]bool)
+	for i, cat := range c.Catalogs {
+		switch {
+		case cat.Name == "":
+			add("catalogs[%d].name: required", i)
+		case catalogs[cat.Name]:
+			add("catalogs[%d].name: %q is used by another catalog", i, cat.Name)
+		}
+		catalogs[cat.Name] = true
+		switch {
+		case (cat.URL == "") == (cat.Path == ""):
+			add("catalogs[%d]: set either url or path", i)
+		case cat.URL != "":
+			if u, err := url.Parse(cat.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				add("catalogs[%d].url: %q is not an http(s) URL", i, cat.URL)
+			}
+		default:
+			if _, err := os.Stat(cat.Path); err != nil {
+				add("catalogs[%d].path: %v", i, err)
+			}
+		}
+	}
+
+	saasFiles := make(map[string]bool)
+	for i, f := range c.SaasFiles {
+		switch {
+		case f.Name == "":
+			add("saasFiles[%d].name: required", i)
+		case saasFiles[f.Name]:
+			add("saasFiles[%d].name: %q is used by another entry", i, f.Name)
+		}
+		saasFiles[f.Name] = true
+		switch {
+		case (f.URL == "") == (f.Path == ""):
+			add("saasFiles[%d]: set either url or path", i)
+		case f.URL != "":
+			if u, err := url.Parse(f.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				add("saasFiles[%d].url: %q is not an http(s) URL", i, f.URL)
+			}
+		default:
+			if _, err := os.Stat(f.Path); err != nil {
+				add("saasFiles[%d].path: %v", i, err)
+			}
+			if f.Token != "" {
+				add("saasFiles[%d].token: only used with url", i)
+			}
+		}
+		if f.TagLength < 0 || f.TagLength > 40 {
+			add("saasFiles[%d].tagLength: must be between 0 and 40, got %d", i, f.TagLength)
+		}
+	}
+
+	if c.CI.Jenkins.Timeout <= 0 {
+		add("ci.jenkins.timeout: must be positive")
+	}
+	pipelines := make(map[string]bool)
+	for i, p := range c.CI.Pipelines {
+		switch {
+		case p.Operator == "":
+			add("ci.pipelines[%d].operator: required", i)
+		case len(strings.Split(p.Operator, "/")) != 2:
+			add("ci.pipelines[%d].operator: %q is not namespace/repository", i, p.Operator)
+		case pipelines[p.Operator]:
+			add("ci.pipelines[%d].operator: %s already has a pipeline", i, p.Operator)
+		}
+		pipelines[p.Operator] = true
+		switch {
+		case (p.Jenkins == "") == (p.Tekton == nil):
+			add("ci.pipelines[%d]: set either jenkins or tekton", i)
+		case p.Jenkins != "":
+			if u, err := url.Parse(p.Jenkins); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				add("ci.pipelines[%d].jenkins: %q is not an http(s) URL", i, p.Jenkins)
+			}
+		default:
+			if p.Tekton.Namespace == "" {
+				add("ci.pipelines[%d].tekton.namespace: required", i)
+			}
+			if p.Tekton.Selector == "" {
+				add("ci.pipelines[%d].tekton.selector: required", i)
+			}
+		}
+	}
+
+	if u, err := url.Parse(c.GitHub.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		add("github.url: %q is not an http(s) URL", c.GitHub.URL)
+	}
+	if c.GitHub.Timeout <= 0 {
+		add("github.timeout: must be positive")
+	}
+	sources := make(map[string]bool)
+	for i, r := range c.GitHub.Repositories {
+		switch {
+		case r.Operator == "":
+			add("github.repositories[%d].operator: required", i)
+		case len(strings.Split(r.Operator, "/")) != 2:
+			add("github.repositories[%d].operator: %q is not namespace/repository", i, r.Operator)
+		case sources[r.Operator]:
+			add("github.repositories[%d].operator: %s already has a repository", i, r.Operator)
+		}
+		sources[r.Operator] = true
+		if parts := strings.Split(r.Repo, "/"); len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			add("github.repositories[%d].repo: %q is not owner/name", i, r.Repo)
+		}
+	}
+
+	for i, ns := range c.Builds.Konflux.Namespaces {
+		if ns == "" {
+			add("builds.konflux.namespaces[%d]: must not be empty", i)
+		}
+	}
+	if c.Builds.OSBS.Hub != "" {
+		if u, err := url.Parse(c.Builds.OSBS.Hub); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			add("builds.osbs.hub: %q is not an http(s) URL", c.Builds.OSBS.Hub)
+		}
+		if c.Builds.OSBS.Timeout <= 0 {
+			add("builds.osbs.timeout: must be positive")
+		}
+	}
+	if c.Builds.OSBS.Web != "" {
+		if u, err := url.Parse(c.Builds.OSBS.Web); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			add("builds.osbs.web: %q is not an http(s) URL", c.Builds.OSBS.Web)
+		}
+		if c.Builds.OSBS.Hub == "" {
+			add("builds.osbs.web: set only with builds.osbs.hub")
+		}
+	}
+
+	if c.Bundles.Timeout <= 0 {
+		add("bundles.timeout: must be positive")
+	}
+	if c.Bundles.Password != "" && c.Bundles.Username == "" {
+		add("bundles.password: set only with bundles.username")
+	}
+
+	if sig := c.Signatures; sig.enabled() {
+		for i, k := range sig.Keys {
+			if k.Path == "" {
+				add("signatures.keys[%d].path: must not be empty", i)
+			}
+		}
+		if len(sig.Keyless.Identities) > 0 && sig.Keyless.Roots == "" {
+			add("signatures.keyless.roots: must be set to trust keyless identities")
+		}
+		for i, id := range sig.Keyless.Identities {
+			if (id.Subject == "") == (id.SubjectRegexp == "") {
+				add("signatures.keyless.identities[%d]: set either subject or subjectRegexp", i)
+			}
+			if id.SubjectRegexp != "" {
+				if _, err := regexp.Compile(id.SubjectRegexp); err != nil {
+					add("signatures.keyless.identities[%d].subjectRegexp: %v", i, err)
+				}
+			}
+			if id.Issuer == "" {
+				add("signatures.keyless.identities[%d].issuer: must not be empty", i)
+			}
+		}
+		if sig.Timeout <= 0 {
+			add("signatures.timeout: must be positive")
+		}
+		if sig.Password != "" && sig.Username == "" {
+			add("signatures.password: set only with signatures.username")
+		}
+	}
+	if sig := c.Signatures; sig.Provenance.Enabled && !sig.enabled() {
+		add("signatures.provenance.enabled: needs signatures.keys or signatures.keyless.identities to verify provenance with")
+	}
+	for i, b := range c.Signatures.Provenance.Builders {
+		if _, err := regexp.Compile(b); err != nil {
+			add("signatures.provenance.builders[%d]: %v", i, err)
+		}
+	}
+
+	if b := c.BaseImages; b.Enabled {
+		for i, image := range b.Images {
+			if ref := kube.ParseImage(image); ref.Repository == "" || ref.Digest != "" {
+				add("baseImages.images[%d]: %q must be a repository, optionally with a tag, e.g. registry.access.redhat.com/ubi9/ubi-minimal", i, image)
+			}
+		}
+		if b.History < 0 {
+			add("baseImages.history: must not be negative")
+		}
+		if b.Timeout <= 0 {
+			add("baseImages.timeout: must be positive")
+		}
+		if b.Password != "" && b.Username == "" {
+			add("baseImages.password: set only with baseImages.username")
+		}
+	}
+
+	if sc := c.Scans; sc.Scanner != "" {
+		if sc.Scanner != scan.Trivy && sc.Scanner != scan.Grype {
+			add("scans.scanner: must be %q or %q, got %q", scan.Trivy, scan.Grype, sc.Scanner)
+		}
+		if sc.Server != "" {
+			if sc.Scanner != scan.Trivy {
+				add("scans.server: only Trivy can scan with a server")
+			}
+			if u, err := url.Parse(sc.Server); err != nil || u.Scheme == "" || u.Host == "" {
+				add("scans.server: must be an absolute URL, got %q", sc.Server)
+			}
+		}
+		if sc.Timeout <= 0 {
+			add("scans.timeout: must be positive")
+		}
+		if sc.Interval <= 0 {
+			add("scans.interval: must be positive")
+		}
+		if sc.Concurrency < 1 {
+			add("scans.concurrency: must be at least 1")
+		}
+		if sc.Findings < 0 {
+			add("scans.findings: must not be negative")
+		}
+		if sc.Password != "" && sc.Username == "" {
+			add("scans.password: set only with scans.username")
+		}
+	}
+
+	if c.ArgoCD.URL != "" {
+		if u, err := url.Parse(c.ArgoCD.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			add("argocd.url: %q is not an http(s) URL", c.ArgoCD.URL)
+		}
+		if c.ArgoCD.Timeout <= 0 {
+			add("argocd.timeout: must be positive")
+		}
+	}
+
+	if c.Controller.Enabled && c.Controller.Resync < Duration(time.Second) {
+		add("controller.resync: must be at least 1s, got %s", c.Controller.Resync)
+	}
+
+	if le := c.LeaderElection; le.Enabled {
+		switch le.Lock {
+		case "file":
+		case "lease":
+			if le.Lease.Name == "" {
+				add("leaderElection.lease.name: must not be empty")
+			}
+		default:
+			add("leaderElection.lock: must be file or lease, got %q", le.Lock)
+		}
+		if le.LeaseDuration < Duration(3*time.Second) {
+			add("leaderElection.leaseDuration: must be at least 3s, got %s", le.LeaseDuration)
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid configuration:\n  - %s", strings.Join(problems, "\n  - "))
+	}
+	return nil
+}
+
+// apply sets the package-level settings that are read outside of the
+// components built from the config
+func (c *Config) apply() {
+	warningThreshold.Set(time.Duration(c.Thresholds.Warning))
+	staleThreshold.Set(time.Duration(c.Thresholds.Stale))
+	archiveAfter.Set(time.Duration(c.Archive.After))
+	criticalityWeights.Store(&c.Criticality.Weights)
+	actorHeaders.Set(c.Auth.ActorHeaders)
+	projectAccess.Store(newProjectList(c.Projects, c.Auth.GroupsHeader, c.Auth.AdminToken))
+	host, _ := imageRegistry("", c.Quay) // Checked by Validate
+	allowedOperators.Store(&operatorAllowList{host: host, patterns: c.AllowedOperators})
+	ticketLimits.Store(&c.Limits)
+	if loc, err := time.LoadLocation(c.Timezone); err == nil { // Checked by Validate
+		displayTimezone.Set(loc)
+	}
+}
+
+// durationSetting is a duration that a config reload can change while it is in use
+type durationSetting struct {
+	v atomic.Int64
+}
+
+func newDurationSetting(d time.Duration) *durationSetting {
+	s := &durationSetting{}
+	s.Set(d)
+	return s
+}
+
+func (s *durationSetting) Get() time.Duration  { return time.Duration(s.v.Load()) }
+func (s *durationSetting) Set(d time.Duration) { s.v.Store(int64(d)) }
+
+// listSetting is a list of strings that a config reload can replace while it is in use
+type listSetting struct {
+	v atomic.Pointer[[]string]
+}
+
+func newListSetting(list []string) *listSetting {
+	s := &listSetting{}
+	s.Set(list)
+	return s
+}
+
+func (s *listSetting) Get() []string     { return *s.v.Load() }
+func (s *listSetting) Set(list []string) { s.v.Store(&list) }
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,342 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"OpTrack/internal/api"
+	"OpTrack/internal/clock"
+	"OpTrack/internal/kube"
+	"OpTrack/internal/store"
+)
+
+// ControllerConfig turns on controller mode: tickets are defined by
+// OperatorTrackTicket custom resources instead of the UI, API and CLI
+type ControllerConfig struct {
+	Enabled    bool     `yaml:"enabled"`
+	Namespace  string   `yaml:"namespace"`  // Watch only this namespace; all namespaces when empty
+	Kubeconfig string   `yaml:"kubeconfig"` // Defaults to the pod's service account in a cluster, else $KUBECONFIG or ~/.kube/config
+	Context    string   `yaml:"context"`
+	Resync     Duration `yaml:"resync"` // How often the resources are listed
+}
+
+// defaultControllerResync is how often the controller lists the resources by default
+const defaultControllerResync = 30 * time.Second
+
+// errControllerManaged is returned for changes made outside of the
+// resources while the controller manages the tickets
+var errControllerManaged = fmt.Errorf("%w: manage them as OperatorTrackTicket resources", store.ErrReadOnly)
+
+// The OperatorTrackTicket resource, see deploy/operatortrackticket-crd.yaml
+const ticketResourcePath = "/apis/optrack.io/v1alpha1"
+
+// ticketResource is an OperatorTrackTicket
+type ticketResource struct {
+	Metadata kube.ObjectMeta `json:"metadata"`
+	Spec     struct {
+		Ticket    string   `json:"ticket"` // Defaults to the resource name in upper case
+		Operators []string `json:"operators"`
+		Owner     string   `json:"owner"`
+		// Description and Labels are as on a ticket
+		Description string   `json:"description"`
+		Labels      []string `json:"labels"`
+		// Applications are ArgoCD applications, as name or namespace/name
+		Applications []string `json:"applications"`
+		CVEs         []string `json:"cves"`
+	} `json:"spec"`
+	Status ticketResourceStatus `json:"status"`
+}
+
+// ticketResourceStatus is what the controller writes back to a resource
+type ticketResourceStatus struct {
+	ObservedGeneration int64             `json:"observedGeneration,omitempty"`
+	Ticket             string            `json:"ticket,omitempty"`
+	LastChecked        *time.Time        `json:"lastChecked,omitempty"`
+	Rebuilt            string            `json:"rebuilt,omitempty"` // e.g. "2/3", for kubectl get
+	Operators          []OperatorStatus  `json:"operators,omitempty"`
+	Conditions         []ticketCondition `json:"conditions,omitempty"`
+}
+
+// ticketCondition is a status condition in the usual Kubernetes form
+type ticketCondition struct {
+	Type               string    `json:"type"`
+	Status             string    `json:"status"` // "True" or "False"
+	Reason             string    `json:"reason"`
+	Message            string    `json:"message,omitempty"`
+	LastTransitionTime time.Time `json:"lastTransitionTime"`
+}
+
+// ticketID is the ticket the resource defines
+func (t ticketResource) ticketID() string {
+	if t.Spec.Ticket != "" {
+		return t.Spec.Ticket
+	}
+	return strings.ToUpper(t.Metadata.Name)
+}
+
+// path is the resource's API path
+func (t ticketResource) path() string {
+	return ticketResourcePath + "/namespaces/" + url.PathEscape(t.Metadata.Namespace) + "/operatortracktickets/" + url.PathEscape(t.Metadata.Name)
+}
+
+func (t ticketResource) String() string {
+	return t.Metadata.Namespace + "/" + t.Metadata.Name
+}
+
+// Controller keeps the tickets in line with the OperatorTrackTicket
+// resources and reports each ticket's statuses back as resource status
+type Controller struct {
+	client    *kube.Client
+	namespace string
+	state     *AppState
+	quay      *QuayClient
+	clock     clock.Clock
+
+	mu        sync.Mutex
+	resources map[string]ticketResource // Ticket ID -> the resource defining it, as of the last sync
+}
+
+// newController connects to the cluster holding the resources
+func newController(cfg ControllerConfig, state *AppState, quay *QuayClient) (*Controller, error) {
+	var kc *kube.Config
+	var err error
+	if cfg.Kubeconfig == "" && cfg.Context == "" && kube.InCluster() {
+		kc, err = kube.InClusterConfig()
+	} else {
+		path := cfg.Kubeconfig
+		if path == "" {
+			path = kube.DefaultKubeconfig()
+		}
+		kc, err = kube.LoadKubeconfig(path, cfg.Context)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Controller{
+		client:    kube.NewClient(kc),
+		namespace: cfg.Namespace,
+		state:     state,
+		quay:      quay,
+		clock:     state.clock,
+		resources: make(map[string]ticketResource),
+	}, nil
+}
+
+// sync lists the resources, creates, replaces and deletes tickets to match
+// them and writes the status of resources that changed since they were last
+// reported on. A failed list leaves the tickets alone.
+func (c *Controller) sync(stop <-chan struct{}) {
+	ctx := context.Background()
+	path := ticketResourcePath + "/operatortracktickets"
+	if c.namespace != "" {
+		path = ticketResourcePath + "/namespaces/" + url.PathEscape(c.namespace) + "/operatortracktickets"
+	}
+	list, err := kube.List[ticketResource](ctx, c.client, path, nil)
+	if err != nil {
+		slog.Error("Failed to list OperatorTrackTickets", "error", err)
+		return
+	}
+
+	// The oldest resource wins when several define the same ticket
+	sort.SliceStable(list, func(i, j int) bool {
+		a, b := list[i].Metadata, list[j].Metadata
+		if !a.CreationTimestamp.Equal(b.CreationTimestamp) {
+			return a.CreationTimestamp.Before(b.CreationTimestamp)
+		}
+		return a.Namespace+"/"+a.Name < b.Namespace+"/"+b.Name
+	})
+	resources := make(map[string]ticketResource, len(list))
+	var duplicates []ticketResource
+	for _, res := range list {
+		if _, ok := resources[res.ticketID()]; ok {
+			duplicates = append(duplicates, res)
+			continue
+		}
+		resources[res.ticketID()] = res
+	}
+
+	for id, res := range resources {
+		c.apply(id, res)
+	}
+	for id := range c.state.List() {
+		if _, ok := resources[id]; ok {
+			continue
+		}
+		if err := c.state.delete(id); err != nil {
+			slog.Error("Failed to delete ticket without an OperatorTrackTicket", "ticket", id, "error", err)
+			continue
+		}
+		slog.Info("Ticket deleted with its OperatorTrackTicket", "ticket", id)
+		c.state.audit.RecordAs("controller", nil, "ticket.delete", id, nil)
+	}
+
+	c.mu.Lock()
+	c.resources = resources
+	c.mu.Unlock()
+
+	now := c.clock.Now()
+	for id, res := range resources {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+		if res.Status.ObservedGeneration == res.Metadata.Generation {
+			continue // Reported on after every poll cycle
+		}
+		if ticket, ok := c.state.Get(id); ok {
+			c.writeStatus(ctx, res, ticket, api.TicketStatuses(c.quay, ticket, localTime(now)), now)
+		}
+	}
+	for _, dup := range duplicates {
+		if dup.Status.ObservedGeneration == dup.Metadata.Generation && conditionReason(dup.Status.Conditions, "Ready") == "DuplicateTicket" {
+			continue
+		}
+		owner := resources[dup.ticketID()]
+		c.patchStatus(ctx, dup, ticketResourceStatus{
+			ObservedGeneration: dup.Metadata.Generation,
+			Ticket:             dup.ticketID(),
+			Conditions: mergeConditions(dup.Status.Conditions, now, ticketCondition{
+				Type: "Ready", Status: "False", Reason: "DuplicateTicket",
+				Message: fmt.Sprintf("%s is already defined by %s", dup.ticketID(), owner),
+			}),
+		})
+	}
+}
+
+// apply creates or replaces the ticket a resource defines when it differs.
+// A new ticket counts as added when the resource was created, so that
+// rebuilt operators are judged the same after the data directory is lost.
+func (c *Controller) apply(id string, res ticketResource) {
+	ticket := JiraTicket{ID: id, Operators: store.OperatorsNamed(res.Spec.Operators), Owner: res.Spec.Owner, Description: res.Spec.Description, Labels: res.Spec.Labels, Applications: res.Spec.Applications, CVEs: res.Spec.CVEs, Added: res.Metadata.CreationTimestamp}
+	if normalized := ticket; normalizeTicket(&normalized) == nil {
+		ticket = normalized // Compared normalized, as saved; invalid ones fail to save below
+	}
+	existing, existed := c.state.Get(id)
+	if existed {
+		if reflect.DeepEqual(existing.Operators, ticket.Operators) && existing.Owner == ticket.Owner && existing.Description == ticket.Description && reflect.DeepEqual(existing.Labels, ticket.Labels) && reflect.DeepEqual(existing.Applications, ticket.Applications) && reflect.DeepEqual(existing.CVEs, ticket.CVEs) && reflect.DeepEqual(existing.Pins, ticket.Pins) {
+			return
+		}
+		ticket.Added, ticket.Baselines = existing.Added, existing.Baselines
+		if !reflect.DeepEqual(existing.Operators, ticket.Operators) {
+			ticket.Added, ticket.Baselines = c.clock.Now(), nil
+		}
+	}
+	if _, err := c.state.put(ticket); err != nil {
+		slog.Error("Failed to save ticket from OperatorTrackTicket", "ticket", id, "resource", res.String(), "error", err)
+		return
+	}
+
+	action := "ticket.create"
+	if existed {
+		action = "ticket.replace"
+	}
+	slog.Info("Ticket saved from OperatorTrackTicket", "ticket", id, "resource", res.String())
+	c.state.audit.RecordAs("controller", nil, action, id, map[string]interface{}{"operators": ticket.Operators, "owner": ticket.Owner, "labels": ticket.Labels, "applications": ticket.Applications, "cves": ticket.CVEs, "pins": ticket.Pins, "resource": res.String()})
+}
+
+// checkCycle reports the statuses of every ticket's operators to its resource
+func (c *Controller) checkCycle(cycle PollCycle) {
+	c.mu.Lock()
+	resources := c.resources
+	c.mu.Unlock()
+
+	for _, check := range cycle.Tickets {
+		res, ok := resources[check.Ticket.ID]
+		if !ok {
+			continue
+		}
+		c.writeStatus(context.Background(), res, check.Ticket, check.Statuses, cycle.End)
+	}
+}
+
+// writeStatus reports a ticket's operator statuses with the conditions:
+//
+//	Ready    every operator was looked up
+//	Rebuilt  every operator has been rebuilt since the ticket was added
+//	Stale    some operator's latest image is older than the stale threshold
+func (c *Controller) writeStatus(ctx context.Context, res ticketResource, ticket JiraTicket, statuses []OperatorStatus, now time.Time) {
+	var failed, stale []string
+	rebuilt := 0
+	for _, status := range statuses {
+		if status.Status != "OK" {
+			failed = append(failed, status.Name+": "+status.Status)
+		}
+		if isStale(ticket, status, now) {
+			stale = append(stale, status.Name)
+		}
+		if isRebuilt(ticket, status) {
+			rebuilt++
+		}
+	}
+
+	ready := ticketCondition{Type: "Ready", Status: "True", Reason: "Tracked", Message: fmt.Sprintf("Tracking %d operators", len(statuses))}
+	if len(failed) > 0 {
+		ready = ticketCondition{Type: "Ready", Status: "False", Reason: "LookupFailed", Message: strings.Join(failed, "; ")}
+	}
+	done := ticketCondition{Type: "Rebuilt", Status: "False", Reason: "Pending", Message: fmt.Sprintf("%d of %d operators rebuilt", rebuilt, len(statuses))}
+	if ticketRebuilt(ticket, statuses) {
+		done.Status, done.Reason = "True", "AllRebuilt"
+	}
+	fresh := ticketCondition{Type: "Stale", Status: "False", Reason: "Fresh"}
+	if len(stale) > 0 {
+		fresh = ticketCondition{Type: "Stale", Status: "True", Reason: "OperatorsStale", Message: strings.Join(stale, ", ")}
+	}
+
+	status := ticketResourceStatus{
+		ObservedGeneration: res.Metadata.Generation,
+		Ticket:             ticket.ID,
+		LastChecked:        &now,
+		Rebuilt:            fmt.Sprintf("%d/%d", rebuilt, len(statuses)),
+		Operators:          statuses,
+		Conditions:         mergeConditions(res.Status.Conditions, now, ready, done, fresh),
+	}
+	if c.patchStatus(ctx, res, status) {
+		c.mu.Lock()
+		if current, ok := c.resources[ticket.ID]; ok && current.Metadata.Name == res.Metadata.Name && current.Metadata.Namespace == res.Metadata.Namespace {
+			current.Status = status
+			c.resources[ticket.ID] = current
+		}
+		c.mu.Unlock()
+	}
+}
+
+// patchStatus writes a resource's status, logging failures
+func (c *Controller) patchStatus(ctx context.Context, res ticketResource, status ticketResourceStatus) bool {
+	if err := c.client.PatchStatus(ctx, res.path(), status); err != nil {
+		slog.Warn("Failed to update OperatorTrackTicket status", "resource", res.String(), "error", err)
+		return false
+	}
+	return true
+}
+
+// mergeConditions returns conditions, keeping the transition time of those
+// whose status didn't change since previous
+func mergeConditions(previous []ticketCondition, now time.Time, conditions ...ticketCondition) []ticketCondition {
+	for i := range conditions {
+		conditions[i].LastTransitionTime = now
+		for _, prev := range previous {
+			if prev.Type == conditions[i].Type && prev.Status == conditions[i].Status {
+				conditions[i].LastTransitionTime = prev.LastTransitionTime
+			}
+		}
+	}
+	return conditions
+}
+
+// conditionReason returns the reason of the condition of type typ, if any
+func conditionReason(conditions []ticketCondition, typ string) string {
+	for _, cond := range conditions {
+		if cond.Type == typ {
+			return cond.Reason
+		}
+	}
+	return ""
+}
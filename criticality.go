@@ -0,0 +1,70 @@
+package main
+
+import (
+	"slices"
+	"sync/atomic"
+)
+
+// CriticalityConfig is how much operators count towards a ticket's
+// completion by their criticality in the inventory, so a stale critical
+// operator isn't hidden by many trivial ones that were rebuilt
+type CriticalityConfig struct {
+	// Weights by criticality; operators without one count as normal
+	Weights map[string]float64 `yaml:"weights"`
+}
+
+// criticalityWeights is replaced by config reloads; nil weighs every operator alike
+var criticalityWeights atomic.Pointer[map[string]float64]
+
+// operatorWeight returns how much an operator of a criticality counts
+// towards completion
+func operatorWeight(criticality string) float64 {
+	if criticality == "" {
+		criticality = "normal"
+	}
+	if weights := criticalityWeights.Load(); weights != nil {
+		if weight, ok := (*weights)[criticality]; ok {
+			return weight
+		}
+	}
+	return 1
+}
+
+// criticalityRank orders criticalities from critical to low, operators
+// without one counting as normal
+func criticalityRank(criticality string) int {
+	if criticality == "" {
+		criticality = "normal"
+	}
+	return slices.Index(criticalities, criticality)
+}
+
+// completion returns the percentage of a ticket's operators that have been
+// rebuilt, weighted by their criticality. Operators whose latest image
+// couldn't be found count as not rebuilt.
+func completion(ticket JiraTicket, statuses []OperatorStatus) float64 {
+	var rebuilt, total float64
+	for _, status := range statuses {
+		weight := operatorWeight(status.Criticality)
+		total += weight
+		if isRebuilt(ticket, status) {
+			rebuilt += weight
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+	return rebuilt * 100 / total
+}
+
+// alertSeverity is the severity of the alert for a stale operator: critical
+// operators page, low ones only inform
+func alertSeverity(criticality string) string {
+	switch criticality {
+	case "critical":
+		return "critical"
+	case "low":
+		return "info"
+	}
+	return "warning"
+}
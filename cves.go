@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"OpTrack/internal/cve"
+)
+
+// CVEFix is whether the latest image of an operator still has the CVEs of its ticket
+type CVEFix = cve.Result
+
+func newCVEsCommand(opts *cliOptions) *cobra.Command {
+	return &cobra.Command{
+		Use:   "cves <ticket>",
+		Short: "Show whether the latest image of every operator on a ticket still has the ticket's CVEs",
+		Long: `Show whether the latest image of every operator on a ticket still has the
+CVEs listed on the ticket, set with ticket add --cve, according to the
+vulnerability scan of the image, and exit with status 1 unless every CVE is
+fixed in every operator.
+
+A CVE is "fixed" when the scan of the latest image didn't find it,
+"affected" when it did and "unscanned" before the image is scanned. Against a
+server the last background scan is used; without --server each image is
+scanned now, with the scanner set in scans: in the config file.`,
+		Example:           "  optrack cves OSD-1234",
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeFirstTicket(opts),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			backend, err := opts.backend()
+			if err != nil {
+				return err
+			}
+			results, err := backend.TicketCVEs(args[0])
+			if err != nil {
+				return fmt.Errorf("failed to check the CVEs of %s: %v", args[0], err)
+			}
+			if err := opts.printer(cmd).print(results, func(bool) {
+				printCVEs(cmd.OutOrStdout(), results)
+			}); err != nil {
+				return err
+			}
+			open := 0
+			for _, r := range results {
+				if !r.Fixed {
+					open++
+				}
+			}
+			if open > 0 {
+				return fmt.Errorf("%d of %d operators aren't fixed", open, len(results))
+			}
+			return nil
+		},
+	}
+}
+
+// printCVEs prints one row per operator and CVE
+func printCVEs(out io.Writer, results []CVEFix) {
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "OPERATOR\tCVE\tSTATE\tPACKAGE\tFIXED IN")
+	for _, r := range results {
+		if r.Error != "" {
+			fmt.Fprintf(tw, "%s\t\t%s\t\t\n", r.Operator, r.Error)
+			continue
+		}
+		for _, c := range r.CVEs {
+			pkg := c.Package
+			if c.Version != "" {
+				pkg += " " + c.Version
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", r.Operator, c.ID, c.State, pkg, c.FixedVersion)
+		}
+	}
+	tw.Flush()
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"slices"
+	"sync"
+	"time"
+
+	"OpTrack/internal/api"
+	"OpTrack/internal/store"
+)
+
+// Dashboard summarizes every ticket
+type Dashboard struct {
+	Tickets       []TicketSummary `json:"tickets"`
+	Complete      int             `json:"complete"`            // Tickets with every operator rebuilt
+	CriticalStale int             `json:"criticalStale"`       // Stale critical operators, across the tickets
+	Overdue       int             `json:"overdue"`             // Operators past their expected-by date, across the tickets
+	LastCycle     *time.Time      `json:"lastCycle,omitempty"` // When the poller last refreshed the statuses
+	Generated     time.Time       `json:"generated"`
+}
+
+// TicketSummary is how far along a ticket is
+type TicketSummary struct {
+	ID            string           `json:"id"`
+	Owner         string           `json:"owner,omitempty"`
+	Description   string           `json:"description,omitempty"`
+	Labels        []string         `json:"labels,omitempty"`
+	Added         time.Time        `json:"added"`
+	Rollup        string           `json:"rollup"` // The state of the ticket as a whole, see store.Rollups
+	Operators     int              `json:"operators"`
+	Rebuilt       int              `json:"rebuilt"`
+	Completion    float64          `json:"completion"` // Percentage of the operators rebuilt, weighted by criticality
+	Stale         int              `json:"stale"`
+	Critical      int              `json:"critical"`          // Operators that are critical in the inventory
+	CriticalStale int              `json:"criticalStale"`     // Of those, the ones that are stale
+	Overdue       int              `json:"overdue"`           // Operators past their expected-by date
+	Errors        int              `json:"errors"`            // Operators whose latest image couldn't be found
+	Stalest       *StalestOperator `json:"stalest,omitempty"` // The operator with the oldest latest image
+	Refreshed     time.Time        `json:"refreshed"`         // When the statuses were looked up
+}
+
+// StalestOperator is the operator of a ticket whose latest image is the oldest
+type StalestOperator struct {
+	Name        string    `json:"name"`
+	LastUpdated time.Time `json:"lastUpdated"`
+	Age         int       `json:"age"` // Days
+}
+
+// dashboard builds the Dashboard from the statuses of the last poll cycle,
+// looking up tickets the poller hasn't seen yet, or has seen with other
+// operators, on the spot
+type dashboard struct {
+	state *AppState
+	quay  *QuayClient
+
+	mu     sync.Mutex
+	checks map[string]TicketCheck // ticket ID -> last poll
+	end    time.Time
+}
+
+func newDashboard(state *AppState, quay *QuayClient) *dashboard {
+	return &dashboard{state: state, quay: quay, checks: make(map[string]TicketCheck)}
+}
+
+// recordCycle keeps the statuses a poll cycle found
+func (d *dashboard) recordCycle(cycle PollCycle) {
+	checks := make(map[string]TicketCheck, len(cycle.Tickets))
+	for _, check := range cycle.Tickets {
+		checks[check.Ticket.ID] = check
+	}
+	d.mu.Lock()
+	d.checks, d.end = checks, cycle.End
+	d.mu.Unlock()
+}
+
+// Build summarizes the tickets matching a filter that the user of r can see,
+// sorted by ID, or by rollup state with sort=rollup. Rollup states are
+// matched as of the statuses summarized, which can be newer than the poller's.
+func (d *dashboard) Build(r *http.Request, filter store.Filter) Dashboard {
+	d.mu.Lock()
+	checks, end := d.checks, d.end
+	d.mu.Unlock()
+
+	rollups := filter.Rollups
+	filter.Rollups = nil
+	now := d.state.clock.Now()
+	out := Dashboard{Tickets: []TicketSummary{}, Generated: now}
+	if !end.IsZero() {
+		out.LastCycle = &end
+	}
+	for _, ticket := range sortedTickets(d.state.List()) {
+		if !filter.Match(ticket) || !canView(r, ticket.Project) {
+			continue
+		}
+		check, ok := checks[ticket.ID]
+		refreshed := end
+		if !ok || !reflect.DeepEqual(check.Ticket.Operators, ticket.Operators) {
+			check, refreshed = TicketCheck{Ticket: ticket, Statuses: api.TicketStatuses(d.quay, ticket, localTime(now))}, now
+		}
+		summary := summarizeTicket(ticket, check.Statuses, now)
+		summary.Refreshed = refreshed
+		if len(rollups) > 0 && !slices.Contains(rollups, summary.Rollup) {
+			continue
+		}
+		if summary.Operators > 0 && summary.Rebuilt == summary.Operators {
+			out.Complete++
+		}
+		out.CriticalStale += summary.CriticalStale
+		out.Overdue += summary.Overdue
+		out.Tickets = append(out.Tickets, summary)
+	}
+	if r.URL.Query().Get("sort") == "rollup" {
+		sortByRollup(out.Tickets, func(s TicketSummary) string { return s.Rollup })
+	}
+	return out
+}
+
+func summarizeTicket(ticket JiraTicket, statuses []OperatorStatus, now time.Time) TicketSummary {
+	s := TicketSummary{ID: ticket.ID, Owner: ticket.Owner, Description: ticket.Description, Labels: ticket.Labels, Added: ticket.Added, Operators: len(statuses)}
+	for _, status := range statuses {
+		if status.Criticality == "critical" {
+			s.Critical++
+		}
+		if status.Overdue {
+			s.Overdue++
+		}
+		if status.Status != "OK" {
+			s.Errors++
+			continue
+		}
+		if isRebuilt(ticket, status) {
+			s.Rebuilt++
+		}
+		if isStale(ticket, status, now) {
+			s.Stale++
+			if status.Criticality == "critical" {
+				s.CriticalStale++
+			}
+		}
+		if s.Stalest == nil || status.LastUpdated.Before(s.Stalest.LastUpdated) {
+			s.Stalest = &StalestOperator{Name: status.Name, LastUpdated: status.LastUpdated, Age: int(now.Sub(status.LastUpdated).Hours() / 24)}
+		}
+	}
+	s.Completion = completion(ticket, statuses)
+	s.Rollup = ticketRollup(ticket, statuses)
+	return s
+}
+
+func (d *dashboard) handleAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(d.Build(r, api.TicketFilter(r.URL.Query())))
+}
+
+func (d *dashboard) handlePage(w http.ResponseWriter, r *http.Request) {
+	renderPage(w, r, "dashboard.html", d.Build(r, api.TicketFilter(r.URL.Query())))
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"OpTrack/internal/store"
+)
+
+// defaultDigestWindow is how long events for a ticket are batched per channel
+// before being sent as a single digest
+const defaultDigestWindow = time.Hour
+
+// dedupRetention is how long a sent alert is remembered. The same alert for
+// the same image is not sent again within this period, even across restarts.
+const dedupRetention = 30 * 24 * time.Hour
+
+// DigestWindowFromEnv reads OPTRACK_DIGEST_WINDOW (e.g. "1h", "0" to disable)
+func DigestWindowFromEnv() (time.Duration, error) {
+	value := os.Getenv("OPTRACK_DIGEST_WINDOW")
+	if value == "" {
+		return defaultDigestWindow, nil
+	}
+	if value == "0" {
+		return 0, nil
+	}
+
+	window, err := time.ParseDuration(value)
+	if err != nil || window < 0 {
+		return 0, fmt.Errorf("invalid OPTRACK_DIGEST_WINDOW %q", value)
+	}
+	return window, nil
+}
+
+// eventKey identifies an alert for deduplication. Operator and cluster events
+// include the image digest so a new image produces a new alert.
+func eventKey(ev Event) string {
+	switch ev.Type {
+	case EventTicketRebuilt:
+		return fmt.Sprintf("%s|%s|%d", ev.Type, ev.Ticket.ID, ev.Ticket.Added.Unix())
+	case EventOperatorStale, EventOperatorUpdated:
+		return fmt.Sprintf("%s|%s|%s|%s", ev.Type, ev.Ticket.ID, ev.Operator.Name, ev.Operator.SHA256)
+	case EventClusterOutdated, EventClusterUpdated:
+		return fmt.Sprintf("%s|%s|%s|%s|%s", ev.Type, ev.Ticket.ID, ev.Cluster.Cluster, ev.Operator.Name, ev.Operator.SHA256)
+	case EventPinUntagged, EventPinMissing:
+		return fmt.Sprintf("%s|%s|%s|%s", ev.Type, ev.Ticket.ID, ev.Pin.Operator, ev.Pin.Digest)
+	}
+	return ""
+}
+
+// DedupStore remembers which alerts have already been sent to each channel.
+// Keys saved before that, without a channel, still count for every channel
+type DedupStore struct {
+	mu   sync.Mutex
+	path string
+	sent map[string]time.Time
+}
+
+func NewDedupStore(dataDir string) (*DedupStore, error) {
+	dir, err := store.SettingsDir(dataDir)
+	if err != nil {
+		return nil, err
+	}
+
+	store := &DedupStore{
+		path: filepath.Join(dir, "notification-dedup.json"),
+		sent: make(map[string]time.Time),
+	}
+
+	data, err := os.ReadFile(store.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return store, nil
+		}
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &store.sent); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", store.path, err)
+	}
+	return store, nil
+}
+
+// Sent reports whether the event was sent to a channel within the retention
+// period
+func (s *DedupStore) Sent(channel string, ev Event) bool {
+	key := eventKey(ev)
+	if key == "" {
+		return false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, sent := s.sent[channel+"|"+key]
+	_, sentBefore := s.sent[key]
+	return sent || sentBefore
+}
+
+// Record remembers that events were sent to a channel, forgetting those sent
+// longer ago than the retention period
+func (s *DedupStore) Record(channel string, events ...Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	changed := false
+	for _, ev := range events {
+		if key := eventKey(ev); key != "" {
+			s.sent[channel+"|"+key] = ev.Time
+			changed = true
+		}
+	}
+	if !changed {
+		return
+	}
+	for k, sent := range s.sent {
+		if events[len(events)-1].Time.Sub(sent) > dedupRetention {
+			delete(s.sent, k)
+		}
+	}
+
+	if err := s.save(); err != nil {
+		slog.Error("Failed to save notification dedup state", "error", err)
+	}
+}
+
+func (s *DedupStore) save() error {
+	data, err := json.MarshalIndent(s.sent, "", "    ")
+	if err != nil {
+		return err
+	}
+	return store.WriteFileAtomic(s.path, data, 0644)
+}
+
+// digestBatch collects the events for one channel and ticket until the window closes
+type digestBatch struct {
+	ticket JiraTicket
+	events []Event
+}
+
+// PendingDigests returns the number of digest batches waiting to be sent
+func (d *Dispatcher) PendingDigests() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.pending)
+}
+
+// batch queues an event for a channel, starting the window on the first event
+func (d *Dispatcher) batch(channel string, ev Event) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	key := channel + "|" + ev.Ticket.ID
+	b, ok := d.pending[key]
+	if !ok {
+		b = &digestBatch{}
+		d.pending[key] = b
+		timer := d.clock.NewTimer(d.window)
+		go func() {
+			<-timer.C
+			d.flush(channel, key)
+		}()
+	}
+	evKey := eventKey(ev)
+	if evKey != "" && slices.ContainsFunc(b.events, func(queued Event) bool { return eventKey(queued) == evKey }) {
+		return // Already in this digest
+	}
+	b.ticket = ev.Ticket
+	b.events = append(b.events, ev)
+}
+
+// FlushPending sends every queued digest now instead of waiting for its
+// window to close, e.g. at shutdown
+func (d *Dispatcher) FlushPending() {
+	d.mu.Lock()
+	keys := make([]string, 0, len(d.pending))
+	for key := range d.pending {
+		keys = append(keys, key)
+	}
+	d.mu.Unlock()
+
+	for _, key := range keys {
+		channel, _, _ := strings.Cut(key, "|")
+		d.flush(channel, key)
+	}
+}
+
+func (d *Dispatcher) flush(channel, key string) {
+	d.mu.Lock()
+	b := d.pending[key]
+	delete(d.pending, key)
+	d.mu.Unlock()
+
+	if b == nil || len(b.events) == 0 {
+		return
+	}
+
+	ev := b.events[0]
+	if len(b.events) > 1 {
+		ev = Event{
+			Type:   EventDigest,
+			Ticket: b.ticket,
+			Events: b.events,
+			Time:   b.events[len(b.events)-1].Time,
+		}
+	}
+	d.send(channel, ev)
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"OpTrack/internal/clock"
+	"OpTrack/internal/drift"
+	"OpTrack/internal/kube"
+	"OpTrack/internal/store"
+)
+
+// OperatorDrift is whether a cluster runs the latest image of an operator
+type OperatorDrift = drift.Result
+
+// ClusterDiscovery is the operators running on the configured clusters
+type ClusterDiscovery = drift.Discovery
+
+// ClusterConfig is a cluster whose workloads are compared with the latest
+// images on Quay.io. It is reached through a kubeconfig context, or through
+// server and a service account token.
+type ClusterConfig struct {
+	Name       string            `yaml:"name"`
+	Labels     map[string]string `yaml:"labels"` // e.g. env: prod, matched by notification rules
+	Namespaces []string          `yaml:"namespaces"`
+
+	Kubeconfig string `yaml:"kubeconfig"` // Defaults to $KUBECONFIG or ~/.kube/config
+	Context    string `yaml:"context"`    // Defaults to the kubeconfig's current context
+
+	Server                string `yaml:"server"` // API server URL; replaces the kubeconfig when set
+	Token                 string `yaml:"token"`
+	TokenFile             string `yaml:"tokenFile"` // Re-read on every request, so rotated tokens are picked up
+	CAFile                string `yaml:"caFile"`
+	InsecureSkipTLSVerify bool   `yaml:"insecureSkipTLSVerify"`
+}
+
+// kubeConfig returns how to reach the cluster
+func (c ClusterConfig) kubeConfig() (*kube.Config, error) {
+	if c.Server != "" {
+		return kube.TokenConfig(c.Server, c.Token, c.TokenFile, c.CAFile, c.InsecureSkipTLSVerify)
+	}
+	path := c.Kubeconfig
+	if path == "" {
+		path = kube.DefaultKubeconfig()
+	}
+	return kube.LoadKubeconfig(path, c.Context)
+}
+
+// newDriftMonitor connects to the configured clusters, or returns nil when
+// there are none
+func newDriftMonitor(clusters []ClusterConfig, quay *QuayClient, clk clock.Clock) (*drift.Monitor, error) {
+	if len(clusters) == 0 {
+		return nil, nil
+	}
+	var list []drift.Cluster
+	for _, c := range clusters {
+		kc, err := c.kubeConfig()
+		if err != nil {
+			return nil, fmt.Errorf("cluster %s: %v", c.Name, err)
+		}
+		list = append(list, drift.Cluster{Name: c.Name, Labels: c.Labels, Client: kube.NewClient(kc), Namespaces: c.Namespaces})
+	}
+	return drift.New(list, quay, clk, drift.DefaultTTL), nil
+}
+
+// clusterWatcher turns the drift of every ticket's operators, checked after
+// each poll cycle, into cluster events
+type clusterWatcher struct {
+	monitor *drift.Monitor
+	bus     *EventBus
+	clock   clock.Clock
+	states  map[string]map[string]string // ticket ID -> cluster + "|" + operator -> state
+}
+
+func newClusterWatcher(monitor *drift.Monitor, bus *EventBus, clk clock.Clock) *clusterWatcher {
+	return &clusterWatcher{monitor: monitor, bus: bus, clock: clk, states: make(map[string]map[string]string)}
+}
+
+// checkCycle compares every cluster with the statuses the poll cycle found.
+// cluster_outdated fires when an operator becomes outdated on a cluster, and
+// cluster_updated when an outdated cluster catches up. Unknown states, such
+// as an unreachable cluster, keep the last known state.
+func (w *clusterWatcher) checkCycle(cycle PollCycle) {
+	seen := make(map[string]bool)
+	for _, check := range cycle.Tickets {
+		seen[check.Ticket.ID] = true
+		statuses := make(map[string]*OperatorStatus, len(check.Statuses))
+		for i := range check.Statuses {
+			statuses[check.Statuses[i].Name] = &check.Statuses[i]
+		}
+
+		prev := w.states[check.Ticket.ID]
+		states := make(map[string]string)
+		for _, res := range w.monitor.CheckStatuses(context.Background(), check.Statuses) {
+			key := res.Cluster + "|" + res.Operator
+			was := prev[key]
+			if res.State == drift.StateUnknown {
+				if was != "" {
+					states[key] = was
+				}
+				continue
+			}
+			states[key] = res.State
+
+			var typ EventType
+			switch {
+			case res.State == drift.StateOutdated && was != drift.StateOutdated:
+				typ = EventClusterOutdated
+			case res.State == drift.StateCurrent && was == drift.StateOutdated:
+				typ = EventClusterUpdated
+			default:
+				continue
+			}
+			w.bus.PublishEvent(Event{
+				Type:     typ,
+				Ticket:   check.Ticket,
+				Operator: statuses[res.Operator],
+				Cluster:  &res,
+				Statuses: check.Statuses,
+				Time:     w.clock.Now(),
+			})
+		}
+		w.states[check.Ticket.ID] = states
+	}
+
+	// Forget deleted tickets
+	for id := range w.states {
+		if !seen[id] {
+			delete(w.states, id)
+		}
+	}
+}
+
+func newDriftCommand(opts *cliOptions) *cobra.Command {
+	return &cobra.Command{
+		Use:   "drift <ticket>",
+		Short: "Show whether the configured clusters run the latest image of every operator on a ticket",
+		Long: `Show whether the configured clusters run the latest image of every operator on a ticket.
+
+Deployments and OLM ClusterServiceVersions in each cluster's namespaces are
+matched to operators by repository, and the digests they run are compared with
+the latest image on Quay.io. On clusters with OLM the installed CSV, the
+subscription's channel and any pending upgrade are shown too. Clusters are set
+under clusters: in the config file.`,
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeFirstTicket(opts),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			backend, err := opts.backend()
+			if err != nil {
+				return err
+			}
+			results, err := backend.TicketDrift(args[0])
+			if err != nil {
+				return fmt.Errorf("failed to get drift of %s: %v", args[0], err)
+			}
+			return opts.printer(cmd).print(results, func(wide bool) {
+				printDrift(cmd.OutOrStdout(), results, wide)
+			})
+		},
+	}
+}
+
+// installedVersions describes OLM installations as the CSV, its subscription's
+// channel and any pending upgrade, e.g. "foo.v1.2.0 (stable, upgrading to foo.v1.3.0)"
+func installedVersions(installed []drift.Installed) string {
+	var list []string
+	for _, in := range installed {
+		var notes []string
+		if in.Channel != "" {
+			notes = append(notes, in.Channel)
+		}
+		if in.CurrentCSV != "" {
+			notes = append(notes, "upgrading to "+in.CurrentCSV)
+		}
+		if in.Phase != "" && in.Phase != "Succeeded" {
+			notes = append(notes, in.Phase)
+		}
+		s := in.CSV
+		if len(notes) > 0 {
+			s += " (" + strings.Join(notes, ", ") + ")"
+		}
+		list = append(list, s)
+	}
+	return strings.Join(list, " ")
+}
+
+// printDrift prints one row per operator and cluster, with full digests when wide is set
+func printDrift(out io.Writer, results []OperatorDrift, wide bool) {
+	short := shortDigest
+	if wide {
+		short = func(digest string) string { return digest }
+	}
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "CLUSTER\tOPERATOR\tSTATE\tLATEST\tINSTALLED\tRUNNING")
+	for _, r := range results {
+		var running []string
+		for _, w := range r.Running {
+			digest := "?"
+			if w.Digest != "" {
+				digest = short(w.Digest)
+			}
+			running = append(running, fmt.Sprintf("%s/%s=%s", w.Namespace, w.Name, digest))
+		}
+		if r.Error != "" {
+			running = append(running, "("+r.Error+")")
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", r.Cluster, r.Operator, r.State, short(r.Latest), installedVersions(r.Installed), strings.Join(running, " "))
+	}
+	tw.Flush()
+}
+
+func newDiscoverCommand(opts *cliOptions) *cobra.Command {
+	var (
+		registries []string
+		create     string
+		owner      string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "discover",
+		Short: "Find the operators running in the configured clusters' namespaces and propose a ticket for them",
+		Long: `Find the operators running in the configured clusters' namespaces and
+propose a ticket for them.
+
+The images of the Deployments and OLM ClusterServiceVersions in each cluster's
+namespaces are mapped back to their namespace/repository on the --registry
+registries. The ticket is only printed, as an "optrack ticket add" command,
+unless --create names it. Clusters are set under clusters: in the config file.`,
+		Example: "  optrack discover\n  optrack discover --create OSD-1234 --owner me@example.com",
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			backend, err := opts.backend()
+			if err != nil {
+				return err
+			}
+			d, err := backend.Discover(registries)
+			if err != nil {
+				return fmt.Errorf("failed to discover operators: %v", err)
+			}
+			var failed []string
+			for cluster := range d.Errors {
+				failed = append(failed, cluster)
+			}
+			sort.Strings(failed)
+			for _, cluster := range failed {
+				fmt.Fprintf(cmd.ErrOrStderr(), "Warning: cluster %s was skipped: %s\n", cluster, d.Errors[cluster])
+			}
+			if len(d.Operators) == 0 {
+				return fmt.Errorf("no images on %s found in the clusters' namespaces", strings.Join(registries, ", "))
+			}
+
+			if create == "" {
+				return opts.printer(cmd).print(d, func(wide bool) {
+					out := cmd.OutOrStdout()
+					printDiscovery(out, d, wide)
+					fmt.Fprintf(out, "\nCreate a ticket for these %d operators with:\n  optrack ticket add <ticket> %s\n", len(d.Operators), strings.Join(d.Operators, " "))
+				})
+			}
+			saved, err := backend.SaveTicket(JiraTicket{ID: create, Operators: store.OperatorsNamed(d.Operators), Owner: owner})
+			if err != nil {
+				return fmt.Errorf("failed to save ticket: %v", err)
+			}
+			return opts.printer(cmd).print(saved, func(wide bool) {
+				printDiscovery(cmd.OutOrStdout(), d, wide)
+				fmt.Fprintf(cmd.OutOrStdout(), "\nSaved %s with %d operators\n", saved.ID, len(saved.Operators))
+			})
+		},
+	}
+
+	cmd.Flags().StringSliceVar(&registries, "registry", []string{drift.DefaultRegistry}, "Registry whose images are tracked; repeatable")
+	cmd.Flags().StringVar(&create, "create", "", "Save the proposed ticket under this ID, replacing any ticket with the same ID")
+	cmd.Flags().StringVar(&owner, "owner", "", "Email address notified about the created ticket")
+	return cmd
+}
+
+// printDiscovery prints one row per workload, with the image references when wide is set
+func printDiscovery(out io.Writer, d *ClusterDiscovery, wide bool) {
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	header := "OPERATOR\tCLUSTER\tNAMESPACE\tWORKLOAD\tCONTAINER"
+	if wide {
+		header += "\tIMAGE"
+	}
+	fmt.Fprintln(tw, header)
+	for _, w := range d.Workloads {
+		row := fmt.Sprintf("%s\t%s\t%s\t%s/%s\t%s", w.Operator, w.Cluster, w.Namespace, w.Kind, w.Name, w.Container)
+		if wide {
+			row += "\t" + w.Image
+		}
+		fmt.Fprintln(tw, row)
+	}
+	tw.Flush()
+}
@@ -0,0 +1,354 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	htmltemplate "html/template"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	texttemplate "text/template"
+	"time"
+
+	"OpTrack/internal/store"
+)
+
+// SMTPConfig holds the settings used to send notification emails. Email is
+// disabled when no host is set.
+type SMTPConfig struct {
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	From     string `yaml:"from"`
+}
+
+// emailTemplate is the subject, plain text and HTML body for one event type
+type emailTemplate struct {
+	subject *texttemplate.Template
+	text    *texttemplate.Template
+	html    *htmltemplate.Template
+}
+
+var emailFuncs = map[string]interface{}{
+	"title":   eventTitle,
+	"summary": eventSummary,
+	"local":   localTime,
+}
+
+func newEmailTemplate(name, subject, text, html string) emailTemplate {
+	return emailTemplate{
+		subject: texttemplate.Must(texttemplate.New(name + "-subject").Funcs(emailFuncs).Parse(subject)),
+		text:    texttemplate.Must(texttemplate.New(name + "-text").Funcs(emailFuncs).Parse(text)),
+		html:    htmltemplate.Must(htmltemplate.New(name + "-html").Funcs(emailFuncs).Parse(html)),
+	}
+}
+
+var emailTemplates = map[EventType]emailTemplate{
+	EventTicketRebuilt: newEmailTemplate("rebuilt",
+		`[OpTrack] {{.Ticket.ID}}: all operators rebuilt`,
+		`All {{len .Statuses}} operators on {{.Ticket.ID}} have been rebuilt since the ticket was added on {{(local .Ticket.Added).Format "2006-01-02"}}.
+
+{{range .Statuses}}- {{.Name}}: {{(local .LastUpdated).Format "2006-01-02 15:04 MST"}} ({{.SHA256}})
+{{end}}
+You are receiving this because you own {{.Ticket.ID}} in OpTrack.
+`,
+		`<p>All {{len .Statuses}} operators on <b>{{.Ticket.ID}}</b> have been rebuilt since the ticket was added on {{(local .Ticket.Added).Format "2006-01-02"}}.</p>
+<table border="1" style="border-collapse: collapse;">
+<tr><th>Operator</th><th>Last Updated</th><th>SHA256</th></tr>
+{{range .Statuses}}<tr><td>{{.Name}}</td><td>{{(local .LastUpdated).Format "2006-01-02 15:04 MST"}}</td><td style="font-family: monospace;">{{.SHA256}}</td></tr>
+{{end}}</table>
+<p style="color: #888;">You are receiving this because you own {{.Ticket.ID}} in OpTrack.</p>
+`),
+	EventOperatorStale: newEmailTemplate("stale",
+		`[OpTrack] {{.Ticket.ID}}: {{.Operator.Name}} is stale`,
+		`{{.Operator.Name}} on {{.Ticket.ID}} has not been updated since {{(local .Operator.LastUpdated).Format "2006-01-02 15:04 MST"}}.
+
+Latest digest: {{.Operator.SHA256}}
+
+You are receiving this because you own {{.Ticket.ID}} in OpTrack.
+`,
+		`<p><b>{{.Operator.Name}}</b> on <b>{{.Ticket.ID}}</b> has not been updated since {{(local .Operator.LastUpdated).Format "2006-01-02 15:04 MST"}}.</p>
+<p>Latest digest: <code>{{.Operator.SHA256}}</code></p>
+<p style="color: #888;">You are receiving this because you own {{.Ticket.ID}} in OpTrack.</p>
+`),
+	EventDigest: newEmailTemplate("digest",
+		`[OpTrack] {{.Ticket.ID}}: {{len .Events}} updates`,
+		`Recent changes for {{.Ticket.ID}}:
+
+{{range .Events}}- {{title .}}: {{summary .}}
+{{end}}
+You are receiving this because you own {{.Ticket.ID}} in OpTrack.
+`,
+		`<p>Recent changes for <b>{{.Ticket.ID}}</b>:</p>
+<ul>
+{{range .Events}}<li><b>{{title .}}</b>: {{summary .}}</li>
+{{end}}</ul>
+<p style="color: #888;">You are receiving this because you own {{.Ticket.ID}} in OpTrack.</p>
+`),
+}
+
+// EmailNotifier emails ticket owners about their tickets
+type EmailNotifier struct {
+	cfg     SMTPConfig
+	optOuts *OptOutStore
+	send    func(addr string, a smtp.Auth, from string, to []string, msg []byte) error
+}
+
+func NewEmailNotifier(cfg SMTPConfig, optOuts *OptOutStore) *EmailNotifier {
+	return &EmailNotifier{
+		cfg:     cfg,
+		optOuts: optOuts,
+		send:    smtp.SendMail,
+	}
+}
+
+func (n *EmailNotifier) Name() string {
+	return "email"
+}
+
+func (n *EmailNotifier) Notify(ev Event) error {
+	return n.SendTo(ev.Ticket.Owner, ev)
+}
+
+// SendTo emails the event to an arbitrary recipient unless they have opted out
+func (n *EmailNotifier) SendTo(to string, ev Event) error {
+	if to == "" {
+		return nil
+	}
+
+	tmpl, ok := emailTemplates[ev.Type]
+	if !ok {
+		return nil
+	}
+
+	// Opt-outs are of bare addresses, which to may give with a name
+	rcpt, err := emailAddress(to)
+	if err != nil {
+		return err
+	}
+	if n.optOuts.IsOptedOut(rcpt.Address) {
+		return nil
+	}
+	msg, err := buildEmail(tmpl, n.cfg.From, to, ev)
+	if err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if n.cfg.Username != "" {
+		auth = smtp.PlainAuth("", n.cfg.Username, n.cfg.Password, n.cfg.Host)
+	}
+
+	addr := fmt.Sprintf("%s:%d", n.cfg.Host, n.cfg.Port)
+	return n.send(addr, auth, n.cfg.From, []string{rcpt.Address}, msg)
+}
+
+// emailAddress parses a single address for a From or To header, refusing line
+// breaks that would start headers of their own
+func emailAddress(value string) (*mail.Address, error) {
+	if strings.ContainsAny(value, "\r\n") {
+		return nil, fmt.Errorf("invalid email address %q: contains a line break", value)
+	}
+	addr, err := mail.ParseAddress(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid email address %q: %v", value, err)
+	}
+	return addr, nil
+}
+
+// buildEmail renders a multipart/alternative message with text and HTML parts
+func buildEmail(tmpl emailTemplate, from, to string, ev Event) ([]byte, error) {
+	fromAddr, err := emailAddress(from)
+	if err != nil {
+		return nil, err
+	}
+	toAddr, err := emailAddress(to)
+	if err != nil {
+		return nil, err
+	}
+
+	var subject bytes.Buffer
+	if err := tmpl.subject.Execute(&subject, ev); err != nil {
+		return nil, fmt.Errorf("failed to render subject: %v", err)
+	}
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+
+	parts := []struct {
+		contentType string
+		render      func(w *quotedprintable.Writer) error
+	}{
+		{"text/plain; charset=UTF-8", func(w *quotedprintable.Writer) error { return tmpl.text.Execute(w, ev) }},
+		{"text/html; charset=UTF-8", func(w *quotedprintable.Writer) error { return tmpl.html.Execute(w, ev) }},
+	}
+
+	for _, p := range parts {
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Type", p.contentType)
+		header.Set("Content-Transfer-Encoding", "quoted-printable")
+		pw, err := mw.CreatePart(header)
+		if err != nil {
+			return nil, err
+		}
+		qw := quotedprintable.NewWriter(pw)
+		if err := p.render(qw); err != nil {
+			return nil, fmt.Errorf("failed to render email body: %v", err)
+		}
+		if err := qw.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", fromAddr)
+	fmt.Fprintf(&msg, "To: %s\r\n", toAddr)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", strings.Join(strings.Fields(subject.String()), " ")))
+	fmt.Fprintf(&msg, "Date: %s\r\n", ev.Time.Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&msg, "Content-Type: multipart/alternative; boundary=%s\r\n", mw.Boundary())
+	fmt.Fprintf(&msg, "\r\n")
+	msg.Write(body.Bytes())
+
+	return msg.Bytes(), nil
+}
+
+// OptOutStore persists the set of email addresses that do not want notifications
+type OptOutStore struct {
+	mu       sync.RWMutex
+	path     string
+	optedOut map[string]bool
+	audit    *AuditLog
+}
+
+func NewOptOutStore(dataDir string, audit *AuditLog) (*OptOutStore, error) {
+	dir, err := store.SettingsDir(dataDir)
+	if err != nil {
+		return nil, err
+	}
+
+	store := &OptOutStore{
+		path:     filepath.Join(dir, "email-optouts.json"),
+		optedOut: make(map[string]bool),
+		audit:    audit,
+	}
+
+	data, err := os.ReadFile(store.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return store, nil
+		}
+		return nil, err
+	}
+
+	var emails []string
+	if err := json.Unmarshal(data, &emails); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", store.path, err)
+	}
+	for _, email := range emails {
+		store.optedOut[normalizeEmail(email)] = true
+	}
+
+	return store, nil
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+func (s *OptOutStore) IsOptedOut(email string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.optedOut[normalizeEmail(email)]
+}
+
+func (s *OptOutStore) Set(email string, optOut bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if optOut {
+		s.optedOut[normalizeEmail(email)] = true
+	} else {
+		delete(s.optedOut, normalizeEmail(email))
+	}
+	return s.save()
+}
+
+func (s *OptOutStore) List() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	emails := make([]string, 0, len(s.optedOut))
+	for email := range s.optedOut {
+		emails = append(emails, email)
+	}
+	sort.Strings(emails)
+	return emails
+}
+
+func (s *OptOutStore) save() error {
+	emails := make([]string, 0, len(s.optedOut))
+	for email := range s.optedOut {
+		emails = append(emails, email)
+	}
+	sort.Strings(emails)
+
+	data, err := json.MarshalIndent(emails, "", "    ")
+	if err != nil {
+		return err
+	}
+	return store.WriteFileAtomic(s.path, data, 0644)
+}
+
+// handleOptOut lists, adds and removes email notification opt-outs. Users
+// see and change only their own; the admin token sees and changes every one.
+func (s *OptOutStore) handleOptOut(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		emails := s.List()
+		if !projectAccess.Load().isAdmin(r) {
+			actor := requestActor(r)
+			emails = slices.DeleteFunc(emails, func(email string) bool { return email != normalizeEmail(actor) })
+		}
+		json.NewEncoder(w).Encode(emails)
+
+	case "POST", "DELETE":
+		email, status, message := actingUser(r, r.URL.Query().Get("email"))
+		if message != "" {
+			httpError(w, r, message, status)
+			return
+		}
+
+		if err := s.Set(email, r.Method == "POST"); err != nil {
+			requestLogger(r).Error("Failed to update email opt-out", "error", err)
+			httpError(w, r, "Failed to update opt-out", http.StatusInternalServerError)
+			return
+		}
+
+		action := "notifications.optout"
+		if r.Method == "DELETE" {
+			action = "notifications.optin"
+		}
+		s.audit.Record(r, action, "", map[string]interface{}{"email": normalizeEmail(email)})
+
+		w.WriteHeader(http.StatusOK)
+
+	default:
+		httpError(w, r, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
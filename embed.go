@@ -0,0 +1,52 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"OpTrack/internal/api"
+	"OpTrack/internal/store"
+)
+
+// validFrameAncestor checks an http.embedAncestors entry: a scheme and host,
+// optionally with a port or a leading "*." wildcard, and nothing else
+func validFrameAncestor(origin string) bool {
+	if strings.ContainsAny(origin, " ;,'") {
+		return false
+	}
+	u, err := url.Parse(strings.Replace(origin, "://*.", "://wildcard.", 1))
+	return err == nil && (u.Scheme == "https" || u.Scheme == "http") && u.Host != "" &&
+		strings.TrimSuffix(u.Path, "/") == "" && u.RawQuery == "" && u.Fragment == "" && u.User == nil
+}
+
+// embedPolicy is the Content-Security-Policy of the widgets: no scripts or
+// external resources, and framing only by OpTrack itself and ancestors
+func embedPolicy(ancestors []string) string {
+	frame := append([]string{"'self'"}, ancestors...)
+	return "default-src 'none'; style-src 'unsafe-inline'; base-uri 'none'; form-action 'none'; frame-ancestors " + strings.Join(frame, " ")
+}
+
+// embedPage is the ticket page with the share of operators rebuilt, weighted
+// by criticality, for the progress bar
+type embedPage struct {
+	ticketPage
+	Percent int
+}
+
+// handleEmbed serves a compact, read-only status of a ticket at
+// /embed/{ticket}, for frames in runbooks and wiki pages on the ancestors
+func handleEmbed(state *AppState, quay *QuayClient, ancestors []string) http.HandlerFunc {
+	policy := embedPolicy(ancestors)
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Security-Policy", policy)
+		ticket, ok := state.Get(r.PathValue("ticket"))
+		if !ok {
+			httpError(w, r, store.ErrTicketNotFound.Error(), http.StatusNotFound)
+			return
+		}
+		statuses := api.TicketStatuses(quay, ticket, localTime(state.clock.Now()))
+		page := embedPage{ticketPage: newTicketPage(ticket, statuses, state.clock.Now()), Percent: int(completion(ticket, statuses))}
+		renderPage(w, r, "embed.html", page)
+	}
+}
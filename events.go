@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"OpTrack/pkg/client"
+)
+
+// eventStreamKeepAlive is how often an idle event stream gets a comment line,
+// so proxies don't close it
+const eventStreamKeepAlive = 30 * time.Second
+
+// eventStreamBuffer is how many events a slow subscriber may fall behind
+// before events are dropped for it
+const eventStreamBuffer = 64
+
+// EventStream fans the poller's events out to /api/events subscribers
+type EventStream struct {
+	mu     sync.Mutex
+	subs   map[chan streamEvent]bool
+	closed bool
+	done   chan struct{}
+}
+
+// streamEvent is an event with the project of its ticket, which decides the
+// subscribers that get it
+type streamEvent struct {
+	client.Event
+	project string
+}
+
+func NewEventStream() *EventStream {
+	return &EventStream{subs: make(map[chan streamEvent]bool), done: make(chan struct{})}
+}
+
+// Publish sends an event to every subscriber without waiting for any of them
+func (s *EventStream) Publish(ev Event) {
+	out := client.Event{
+		Type:     string(ev.Type),
+		Ticket:   ev.Ticket.ID,
+		Previous: ev.Previous,
+		Reason:   ev.Reason,
+		Time:     ev.Time,
+	}
+	if ev.Operator != nil {
+		op := apiStatus(*ev.Operator)
+		out.Operator = &op
+	}
+	if ev.Cluster != nil {
+		out.Cluster = ev.Cluster.Cluster
+	}
+	if ev.Pin != nil {
+		pin := client.Pin(*ev.Pin)
+		out.Pin = &pin
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for ch := range s.subs {
+		select {
+		case ch <- streamEvent{out, ev.Ticket.Project}:
+		default:
+			eventsDroppedTotal.Inc()
+		}
+	}
+}
+
+func (s *EventStream) subscribe() (chan streamEvent, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil, false
+	}
+	ch := make(chan streamEvent, eventStreamBuffer)
+	s.subs[ch] = true
+	return ch, true
+}
+
+func (s *EventStream) unsubscribe(ch chan streamEvent) {
+	s.mu.Lock()
+	delete(s.subs, ch)
+	s.mu.Unlock()
+}
+
+// Close ends every open stream, so server shutdown doesn't wait for them
+func (s *EventStream) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.closed {
+		s.closed = true
+		close(s.done)
+	}
+}
+
+// handleEvents streams events as server-sent events until the client goes away
+func (s *EventStream) handleEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		httpError(w, r, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	ch, ok := s.subscribe()
+	if !ok {
+		httpError(w, r, "Server is shutting down", http.StatusServiceUnavailable)
+		return
+	}
+	defer s.unsubscribe(ch)
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // Stop nginx from holding events back
+	w.WriteHeader(http.StatusOK)
+	rc.Flush()
+
+	keepAlive := time.NewTicker(eventStreamKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case ev := <-ch:
+			if !canView(r, ev.project) {
+				continue
+			}
+			data, err := json.Marshal(ev.Event)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Type, data)
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case <-r.Context().Done():
+			return
+		case <-s.done:
+			return
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
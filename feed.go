@@ -0,0 +1,227 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"OpTrack/internal/store"
+)
+
+// feedSize is how many updates the feed keeps, across every ticket
+const feedSize = 500
+
+// feedPageSize is how many entries a feed returns
+const feedPageSize = 50
+
+// FeedEntry is a new image seen for an operator on a ticket
+type FeedEntry struct {
+	Ticket      string    `json:"ticket"`
+	Operator    string    `json:"operator"`
+	Digest      string    `json:"digest"`
+	Previous    string    `json:"previous"`
+	Tags        []string  `json:"tags,omitempty"`
+	LastUpdated time.Time `json:"lastUpdated"`
+	Time        time.Time `json:"time"` // When the poller saw it
+	// Reason is why the image was built, looked up when the feed is served
+	// since it can be given after the poller saw the image
+	Reason string `json:"-"`
+}
+
+// FeedStore keeps the latest operator_updated events for the Atom feeds,
+// newest first, so they survive restarts
+type FeedStore struct {
+	mu      sync.Mutex
+	path    string
+	entries []FeedEntry
+}
+
+func NewFeedStore(dataDir string) (*FeedStore, error) {
+	dir, err := store.SettingsDir(dataDir)
+	if err != nil {
+		return nil, err
+	}
+
+	feed := &FeedStore{path: filepath.Join(dir, "updates-feed.json")}
+	data, err := os.ReadFile(feed.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return feed, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &feed.entries); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", feed.path, err)
+	}
+	return feed, nil
+}
+
+// Record adds operator_updated events to the feed and ignores the rest
+func (f *FeedStore) Record(ev Event) {
+	if ev.Type != EventOperatorUpdated || ev.Operator == nil {
+		return
+	}
+	entry := FeedEntry{
+		Ticket:      ev.Ticket.ID,
+		Operator:    ev.Operator.Name,
+		Digest:      ev.Operator.SHA256,
+		Previous:    ev.Previous,
+		Tags:        ev.Operator.Tags,
+		LastUpdated: ev.Operator.LastUpdated,
+		Time:        ev.Time,
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.entries = append([]FeedEntry{entry}, f.entries...)
+	if len(f.entries) > feedSize {
+		f.entries = f.entries[:feedSize]
+	}
+	if err := f.save(); err != nil {
+		slog.Error("Failed to save the updates feed", "error", err)
+	}
+}
+
+func (f *FeedStore) save() error {
+	data, err := json.MarshalIndent(f.entries, "", "    ")
+	if err != nil {
+		return err
+	}
+	return store.WriteFileAtomic(f.path, data, 0644)
+}
+
+// Entries returns the newest entries of the tickets match accepts
+func (f *FeedStore) Entries(match func(ticket string) bool, limit int) []FeedEntry {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var out []FeedEntry
+	for _, e := range f.entries {
+		if len(out) == limit {
+			break
+		}
+		if match(e.Ticket) {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// atomFeed and atomEntry are the parts of RFC 4287 the feeds use
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Author  atomAuthor  `xml:"author"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomEntry struct {
+	ID      string   `xml:"id"`
+	Title   string   `xml:"title"`
+	Updated string   `xml:"updated"`
+	Link    atomLink `xml:"link"`
+	Content atomText `xml:"content"`
+}
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomText struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+// handleFeed serves the updates of every ticket at /feeds/updates.atom, and
+// of one ticket at /feeds/{ticket}/updates.atom
+func (f *FeedStore) handleFeed(state *AppState) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("ticket")
+		if id != "" {
+			if _, ok := state.Get(id); !ok {
+				httpError(w, r, store.ErrTicketNotFound.Error(), http.StatusNotFound)
+				return
+			}
+		}
+
+		base := externalBaseURL(r)
+		self := base + "/feeds/updates.atom"
+		title := "OpTrack operator updates"
+		alternate := base + "/"
+		if id != "" {
+			self = base + "/feeds/" + id + "/updates.atom"
+			title = "OpTrack operator updates for " + id
+			alternate = base + "/ticket/" + id
+		}
+
+		feed := atomFeed{
+			ID:     self,
+			Title:  title,
+			Author: atomAuthor{Name: "OpTrack"},
+			Links: []atomLink{
+				{Rel: "self", Type: "application/atom+xml", Href: self},
+				{Rel: "alternate", Type: "text/html", Href: alternate},
+			},
+		}
+		// Entries of deleted tickets stay in the feed of all tickets
+		entries := f.Entries(func(ticket string) bool {
+			if id != "" {
+				return ticket == id
+			}
+			t, ok := state.Get(ticket)
+			return !ok || canView(r, t.Project)
+		}, feedPageSize)
+		updated := state.clock.Now()
+		if len(entries) > 0 {
+			updated = entries[0].Time
+		}
+		feed.Updated = updated.UTC().Format(time.RFC3339)
+		for _, e := range entries {
+			e.Reason = state.annotations.Reason(e.Operator, e.Digest)
+			feed.Entries = append(feed.Entries, feedEntry(base, e))
+		}
+
+		w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+		w.Write([]byte(xml.Header))
+		enc := xml.NewEncoder(w)
+		enc.Indent("", "  ")
+		if err := enc.Encode(feed); err != nil {
+			slog.Error("Failed to write the updates feed", "error", err)
+		}
+	}
+}
+
+func feedEntry(base string, e FeedEntry) atomEntry {
+	content := fmt.Sprintf("New image of %s, built %s.\nDigest: %s\nPrevious: %s",
+		e.Operator, e.LastUpdated.UTC().Format("2006-01-02 15:04 MST"), e.Digest, e.Previous)
+	if len(e.Tags) > 0 {
+		content += "\nTags: " + strings.Join(e.Tags, ", ")
+	}
+	if e.Reason != "" {
+		content += "\nReason: " + e.Reason
+	}
+	return atomEntry{
+		// The ticket, operator and digest identify an update for good
+		ID:      fmt.Sprintf("%s/ticket/%s#%s@%s", base, e.Ticket, e.Operator, e.Digest),
+		Title:   fmt.Sprintf("%s: %s has a new image (%s)", e.Ticket, e.Operator, shortDigest(e.Digest)),
+		Updated: e.Time.UTC().Format(time.RFC3339),
+		Link:    atomLink{Rel: "alternate", Type: "text/html", Href: base + "/ticket/" + e.Ticket},
+		Content: atomText{Type: "text", Body: content},
+	}
+}
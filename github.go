@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"OpTrack/internal/clock"
+	"OpTrack/internal/github"
+)
+
+// OperatorCommits is the latest image of an operator compared with its source repository
+type OperatorCommits = github.Result
+
+// GitHubConfig is the GitHub server that operators' source repositories are
+// read from
+type GitHubConfig struct {
+	URL          string             `yaml:"url"`   // https://api.github.com, or https://<host>/api/v3 for GitHub Enterprise
+	Token        string             `yaml:"token"` // Needs read access to the repositories' contents
+	Timeout      Duration           `yaml:"timeout"`
+	Repositories []SourceRepository `yaml:"repositories"`
+}
+
+// SourceRepository is the repository an operator is built from
+type SourceRepository struct {
+	Operator string `yaml:"operator"`
+	Repo     string `yaml:"repo"`   // owner/name
+	Branch   string `yaml:"branch"` // Defaults to the repository's default branch
+}
+
+// newCommitsMonitor returns nil when no source repositories are configured
+func newCommitsMonitor(cfg GitHubConfig, quay *QuayClient, clk clock.Clock) *github.Monitor {
+	if len(cfg.Repositories) == 0 {
+		return nil
+	}
+	var repos []github.Repository
+	for _, r := range cfg.Repositories {
+		repos = append(repos, github.Repository{Operator: r.Operator, Repo: r.Repo, Branch: r.Branch})
+	}
+	client := github.NewClient(cfg.URL, cfg.Token, time.Duration(cfg.Timeout))
+	return github.New(client, repos, quay, clk, github.DefaultTTL)
+}
+
+func newCommitsCommand(opts *cliOptions) *cobra.Command {
+	return &cobra.Command{
+		Use:   "commits <ticket>",
+		Short: "Show how many commits the latest image of every operator on a ticket is behind its source",
+		Long: `Show how many commits the latest image of every operator on a ticket is behind its source.
+
+The commit each image was built from is read from its vcs-ref label, or from a
+tag that is a commit SHA, and compared with the head of the source repository's
+branch and with its latest GitHub release. Source repositories are set under
+github.repositories: in the config file; operators without one are left out.`,
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeFirstTicket(opts),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			backend, err := opts.backend()
+			if err != nil {
+				return err
+			}
+			results, err := backend.TicketCommits(args[0])
+			if err != nil {
+				return fmt.Errorf("failed to compare %s with the source repositories: %v", args[0], err)
+			}
+			return opts.printer(cmd).print(results, func(wide bool) {
+				printCommits(cmd.OutOrStdout(), results, wide)
+			})
+		},
+	}
+}
+
+// printCommits prints one row per operator, with full commit SHAs when wide is set
+func printCommits(out io.Writer, results []OperatorCommits, wide bool) {
+	short := func(sha string) string {
+		if len(sha) > 7 && !wide {
+			return sha[:7]
+		}
+		return sha
+	}
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "OPERATOR\tREPOSITORY\tSTATE\tCOMMIT\tBRANCH\tBEHIND\tRELEASE\tVS RELEASE")
+	for _, r := range results {
+		var behind, release string
+		if r.State != github.StateUnknown {
+			behind = fmt.Sprint(r.Behind)
+		}
+		if r.Release != "" {
+			release = fmt.Sprintf("-%d +%d", r.BehindRelease, r.AheadOfRelease)
+		}
+		commit := short(r.Commit)
+		if r.Error != "" {
+			commit = strings.TrimSpace(commit + " (" + r.Error + ")")
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", r.Operator, r.Repository, r.State, commit, r.Branch, behind, r.Release, release)
+	}
+	tw.Flush()
+}
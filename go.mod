@@ -1,3 +1,15 @@
 module OpTrack
 
 go 1.22
+
+require (
+	github.com/spf13/cobra v1.10.2
+	golang.org/x/sync v0.11.0
+	golang.org/x/sys v0.30.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
+	github.com/inconshreveable/mousetrap v1.1.0 // indirect
+	github.com/spf13/pflag v1.0.9 // indirect
+)
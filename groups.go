@@ -0,0 +1,323 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"OpTrack/internal/api"
+	"OpTrack/internal/clock"
+	"OpTrack/internal/store"
+)
+
+// namePattern is what group and template names look like, so they fit in URLs
+var namePattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]*[a-z0-9])?$`)
+
+// OperatorGroup is a named list of operators that tickets include by
+// reference, so tickets for every monthly rebuild follow its membership
+type OperatorGroup struct {
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"` // e.g. "OSD core operators"
+	Operators   []string  `json:"operators"`
+	Updated     time.Time `json:"updated"`
+	UpdatedBy   string    `json:"updatedBy,omitempty"`
+}
+
+// GroupStore persists operator groups in the settings directory. The
+// tickets of the AppState it belongs to are expanded again after every change.
+type GroupStore struct {
+	mu     sync.RWMutex
+	path   string
+	groups map[string]OperatorGroup
+	audit  *AuditLog
+	clock  clock.Clock
+
+	// onChange is called after a group changes, without mu held
+	onChange func()
+}
+
+func NewGroupStore(dataDir string, audit *AuditLog, clk clock.Clock) (*GroupStore, error) {
+	dir, err := store.SettingsDir(dataDir)
+	if err != nil {
+		return nil, err
+	}
+	s := &GroupStore{
+		path:   filepath.Join(dir, "operator-groups.json"),
+		groups: make(map[string]OperatorGroup),
+		audit:  audit,
+		clock:  clk,
+	}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// load reads the groups file, picking up changes other replicas made
+func (s *GroupStore) load() error {
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	groups := make(map[string]OperatorGroup)
+	if err := json.Unmarshal(data, &groups); err != nil {
+		return fmt.Errorf("failed to parse %s: %v", s.path, err)
+	}
+	s.mu.Lock()
+	s.groups = groups
+	s.mu.Unlock()
+	return nil
+}
+
+// Members returns the operators of a group
+func (s *GroupStore) Members(name string) ([]string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	group, ok := s.groups[name]
+	return group.Operators, ok
+}
+
+// List returns every group, sorted by name
+func (s *GroupStore) List() []OperatorGroup {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	groups := make([]OperatorGroup, 0, len(s.groups))
+	for _, group := range s.groups {
+		groups = append(groups, group)
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Name < groups[j].Name })
+	return groups
+}
+
+// Get returns one group
+func (s *GroupStore) Get(name string) (OperatorGroup, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	group, ok := s.groups[name]
+	return group, ok
+}
+
+// Put creates or replaces a group, returning whether it existed
+func (s *GroupStore) Put(r *http.Request, group OperatorGroup) (bool, error) {
+	group.Updated = s.clock.Now()
+	group.UpdatedBy = requestActor(r)
+
+	s.mu.Lock()
+	old, existed := s.groups[group.Name]
+	s.groups[group.Name] = group
+	if err := s.save(); err != nil {
+		if existed {
+			s.groups[group.Name] = old
+		} else {
+			delete(s.groups, group.Name)
+		}
+		s.mu.Unlock()
+		return existed, err
+	}
+	s.mu.Unlock()
+
+	action := "group.create"
+	if existed {
+		action = "group.replace"
+	}
+	s.audit.Record(r, action, "", map[string]interface{}{"group": group.Name, "operators": group.Operators})
+	s.changed()
+	return existed, nil
+}
+
+// Delete removes a group
+func (s *GroupStore) Delete(r *http.Request, name string) error {
+	s.mu.Lock()
+	old, ok := s.groups[name]
+	if !ok {
+		s.mu.Unlock()
+		return store.ErrGroupNotFound
+	}
+	delete(s.groups, name)
+	if err := s.save(); err != nil {
+		s.groups[name] = old
+		s.mu.Unlock()
+		return err
+	}
+	s.mu.Unlock()
+
+	s.audit.Record(r, "group.delete", "", map[string]interface{}{"group": name})
+	s.changed()
+	return nil
+}
+
+// save writes the groups file. The caller holds s.mu.
+func (s *GroupStore) save() error {
+	data, err := json.MarshalIndent(s.groups, "", "    ")
+	if err != nil {
+		return err
+	}
+	if err := store.WriteFileAtomic(s.path, data, 0644); err != nil {
+		return fmt.Errorf("%w: failed to save operator groups: %v", store.ErrStorage, err)
+	}
+	return nil
+}
+
+func (s *GroupStore) changed() {
+	if s.onChange != nil {
+		s.onChange()
+	}
+}
+
+// expandGroups returns a ticket with the members of its groups added to its
+// operators, marked with their group. Operators the ticket lists itself, or
+// through an earlier group, aren't repeated.
+func expandGroups(ticket JiraTicket, groups *GroupStore) JiraTicket {
+	ticket.Operators = ownOperators(ticket.Operators)
+	if len(ticket.Groups) == 0 || groups == nil {
+		return ticket
+	}
+	for _, name := range ticket.Groups {
+		members, _ := groups.Members(name)
+		for _, member := range members {
+			if _, ok := ticket.Operator(member); !ok {
+				ticket.Operators = append(ticket.Operators, store.Operator{Name: member, Group: name})
+			}
+		}
+	}
+	return ticket
+}
+
+// ownOperators returns the operators a ticket lists itself, leaving out
+// those it has through groups, without the criticality and owners the
+// inventory gives them
+func ownOperators(operators []store.Operator) []store.Operator {
+	if !slices.ContainsFunc(operators, func(o store.Operator) bool {
+		return o.Group != "" || o.Criticality != "" || o.Team != "" || o.Contact != ""
+	}) {
+		return operators
+	}
+	own := slices.DeleteFunc(slices.Clone(operators), func(o store.Operator) bool { return o.Group != "" })
+	for i := range own {
+		own[i].Criticality, own[i].Team, own[i].Contact = "", "", ""
+	}
+	return own
+}
+
+// checkGroups checks the groups a ticket includes are defined
+func checkGroups(ticket JiraTicket, groups *GroupStore) error {
+	var unknown []string
+	for _, name := range ticket.Groups {
+		if _, ok := groups.Get(name); !ok {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		return fmt.Errorf("%w: %s", store.ErrUnknownGroup, strings.Join(unknown, ", "))
+	}
+	return nil
+}
+
+// groupRequest is the body of PUT /api/v1/groups/{name}
+type groupRequest struct {
+	Description string   `json:"description"`
+	Operators   []string `json:"operators"`
+}
+
+// handleList lists the groups at GET /api/v1/groups
+func (s *GroupStore) handleList(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.List())
+}
+
+// handleGet returns a group at GET /api/v1/groups/{name}
+func (s *GroupStore) handleGet(w http.ResponseWriter, r *http.Request) {
+	group, ok := s.Get(r.PathValue("name"))
+	if !ok {
+		api.WriteError(w, requestID(r), store.ErrGroupNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(group)
+}
+
+// handlePut creates or replaces a group at PUT /api/v1/groups/{name},
+// answering 201 for a new group. It is served behind requireAdminToken.
+func (s *GroupStore) handlePut(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if !namePattern.MatchString(name) {
+		httpError(w, r, fmt.Sprintf("Invalid group name %q: use lower case letters, digits and dashes", name), http.StatusBadRequest)
+		return
+	}
+	var req groupRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	group := OperatorGroup{Name: name, Description: strings.TrimSpace(req.Description)}
+	for _, op := range req.Operators {
+		op = strings.TrimSpace(op)
+		if parts := strings.Split(op, "/"); len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			httpError(w, r, fmt.Sprintf("%q is not in namespace/repository format", op), http.StatusBadRequest)
+			return
+		}
+		if !slices.Contains(group.Operators, op) {
+			group.Operators = append(group.Operators, op)
+		}
+	}
+	if len(group.Operators) == 0 {
+		httpError(w, r, "A group needs at least one operator", http.StatusBadRequest)
+		return
+	}
+	if err := allowedOperators.Load().check(group.Operators); err != nil {
+		api.WriteError(w, requestID(r), err)
+		return
+	}
+
+	existed, err := s.Put(r, group)
+	if err != nil {
+		api.WriteError(w, requestID(r), err)
+		return
+	}
+	group, _ = s.Get(name)
+	w.Header().Set("Content-Type", "application/json")
+	if !existed {
+		w.WriteHeader(http.StatusCreated)
+	}
+	json.NewEncoder(w).Encode(group)
+}
+
+// handleDelete removes a group at DELETE /api/v1/groups/{name}, unless a
+// ticket still includes it. It is served behind requireAdminToken.
+func (s *GroupStore) handleDelete(state *AppState) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("name")
+		var users []string
+		for _, ticket := range sortedTickets(state.List()) {
+			if slices.Contains(ticket.Groups, name) {
+				users = append(users, ticket.ID)
+			}
+		}
+		if len(users) > 0 {
+			httpError(w, r, fmt.Sprintf("%s is still included by %s", name, strings.Join(users, ", ")), http.StatusConflict)
+			return
+		}
+
+		if err := s.Delete(r, name); err != nil {
+			if !errors.Is(err, store.ErrGroupNotFound) {
+				requestLogger(r).Error("Failed to delete operator group", "group", name, "error", err)
+			}
+			api.WriteError(w, requestID(r), err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
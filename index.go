@@ -0,0 +1,134 @@
+package main
+
+import (
+	"hash/fnv"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// indexShards is how many maps the tickets and the operator index are each
+// split over, so that changing a ticket copies only the few that hold it and
+// its operators
+const indexShards = 64
+
+// operatorIndex maps lower-cased operators to the IDs of the tickets
+// tracking them, sorted, spread over shards by operator
+type operatorIndex [indexShards]map[string][]string
+
+// ticketShards holds tickets by ID, spread over shards by ID
+type ticketShards [indexShards]map[string]JiraTicket
+
+func indexShard(key string) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % indexShards)
+}
+
+// get returns the IDs of the tickets tracking a lower-cased operator
+func (x *operatorIndex) get(key string) []string {
+	return x[indexShard(key)][key]
+}
+
+// ticketSnapshot is a published set of tickets with an index of the tickets
+// tracking each operator, so finding them doesn't scan every ticket. It is
+// built with the tickets when they are loaded and changed with them, so it
+// can't disagree with them, and is never modified once published. The index
+// isn't saved: building it is one pass over tickets loaded anyway.
+type ticketSnapshot struct {
+	tickets    ticketShards
+	count      int
+	byOperator operatorIndex
+
+	// All the tickets in one map, for List, built on first use
+	listOnce sync.Once
+	list     map[string]JiraTicket
+}
+
+func newTicketSnapshot(tickets map[string]JiraTicket) *ticketSnapshot {
+	next := &ticketSnapshot{count: len(tickets)}
+	next.listOnce.Do(func() { next.list = tickets })
+	for i := range next.tickets {
+		next.tickets[i] = make(map[string]JiraTicket)
+		next.byOperator[i] = make(map[string][]string)
+	}
+	for _, ticket := range sortedTickets(tickets) {
+		next.tickets[indexShard(ticket.ID)][ticket.ID] = ticket
+		for _, key := range operatorKeys(ticket) {
+			shard := next.byOperator[indexShard(key)]
+			shard[key] = append(shard[key], ticket.ID)
+		}
+	}
+	return next
+}
+
+// get returns the ticket id
+func (s *ticketSnapshot) get(id string) (JiraTicket, bool) {
+	ticket, ok := s.tickets[indexShard(id)][id]
+	return ticket, ok
+}
+
+// all returns every ticket, keyed by ID, gathering them from their shards
+// the first time it is called
+func (s *ticketSnapshot) all() map[string]JiraTicket {
+	s.listOnce.Do(func() {
+		s.list = make(map[string]JiraTicket, s.count)
+		for _, shard := range s.tickets {
+			maps.Copy(s.list, shard)
+		}
+	})
+	return s.list
+}
+
+// with returns a snapshot with the ticket id set, or removed when ticket is
+// nil, copying only the shard of the ticket and re-indexing only the
+// operators of the old and new ticket. Other shards are shared with s.
+func (s *ticketSnapshot) with(id string, ticket *JiraTicket) *ticketSnapshot {
+	next := &ticketSnapshot{tickets: s.tickets, count: s.count, byOperator: s.byOperator}
+	tickets := maps.Clone(s.tickets[indexShard(id)])
+	next.tickets[indexShard(id)] = tickets
+	var copied [indexShards]bool
+	shard := func(key string) map[string][]string {
+		i := indexShard(key)
+		if !copied[i] {
+			next.byOperator[i], copied[i] = maps.Clone(s.byOperator[i]), true
+		}
+		return next.byOperator[i]
+	}
+
+	if old, ok := s.get(id); ok {
+		delete(tickets, id)
+		next.count--
+		for _, key := range operatorKeys(old) {
+			bucket := shard(key)
+			ids := slices.DeleteFunc(slices.Clone(bucket[key]), func(t string) bool { return t == id })
+			if len(ids) == 0 {
+				delete(bucket, key)
+			} else {
+				bucket[key] = ids
+			}
+		}
+	}
+	if ticket != nil {
+		tickets[id] = *ticket
+		next.count++
+		for _, key := range operatorKeys(*ticket) {
+			bucket := shard(key)
+			i, _ := slices.BinarySearch(bucket[key], id)
+			bucket[key] = slices.Insert(slices.Clone(bucket[key]), i, id)
+		}
+	}
+	return next
+}
+
+// operatorKeys returns the distinct lower-cased operators of a ticket
+func operatorKeys(ticket JiraTicket) []string {
+	keys := make([]string, 0, len(ticket.Operators))
+	for _, name := range ticket.OperatorNames() {
+		if key := strings.ToLower(name); !slices.Contains(keys, key) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
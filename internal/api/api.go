@@ -0,0 +1,512 @@
+// Package api serves the ticket and operator status JSON API
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"OpTrack/internal/argocd"
+	"OpTrack/internal/catalog"
+	"OpTrack/internal/ci"
+	"OpTrack/internal/clock"
+	"OpTrack/internal/cve"
+	"OpTrack/internal/drift"
+	"OpTrack/internal/github"
+	"OpTrack/internal/policy"
+	"OpTrack/internal/registry"
+	"OpTrack/internal/saas"
+	"OpTrack/internal/store"
+)
+
+// Tickets is the in-memory view of the tracked tickets
+type Tickets interface {
+	List() map[string]store.Ticket // Must not be modified
+	Get(id string) (store.Ticket, bool)
+	// Tracking returns the IDs of the tickets tracking an operator, in any
+	// spelling, without going through every ticket. Must not be modified.
+	Tracking(operator string) []string
+	// Put saves a ticket, replacing any ticket with the same ID
+	Put(ticket store.Ticket) (existed bool, err error)
+	Delete(id string) error
+	// Archive archives or unarchives a ticket, reporting whether that
+	// changed it
+	Archive(id string, archived bool) (ticket store.Ticket, changed bool, err error)
+}
+
+// Registry looks up operator statuses
+type Registry interface {
+	GetOperatorStatus(name string) (*registry.Status, error)
+	GetStatuses(operators []string) []registry.Status
+	CheckPins(operators []string, pins map[string]string) []registry.Pin
+}
+
+// Drift compares operators with the images running on clusters, and finds
+// the operators that run there
+type Drift interface {
+	Check(ctx context.Context, operators []string) []drift.Result
+	Discover(ctx context.Context, registries []string) *drift.Discovery
+}
+
+// Catalog compares operators with the bundles published in OLM catalogs
+type Catalog interface {
+	Check(ctx context.Context, operators []string) []catalog.Result
+}
+
+// ArgoCD reports the ArgoCD applications that deploy operators
+type ArgoCD interface {
+	Check(ctx context.Context, applications, operators []string) []argocd.Result
+}
+
+// Promotion compares operators with the commits app-interface SaaS files promote
+type Promotion interface {
+	Check(ctx context.Context, operators []string) []saas.Result
+}
+
+// Pipelines reads the build pipelines of operators
+type Pipelines interface {
+	Check(ctx context.Context, operators []string) []ci.Result
+}
+
+// Commits compares the latest images of operators with their source repositories
+type Commits interface {
+	Check(ctx context.Context, operators []string) []github.Result
+}
+
+// Compliance checks operators against the compliance policy
+type Compliance interface {
+	Check(ctx context.Context, operators []string) []policy.Result
+}
+
+// StatusOrder sorts the statuses of a ticket by a column of the status table,
+// failing with ErrInvalidColumn for unknown columns
+type StatusOrder interface {
+	Sort(ticket store.Ticket, statuses []registry.Status, column string, desc bool) error
+}
+
+// Bundles reads the ClusterServiceVersion of operator bundle images
+type Bundles interface {
+	CSV(ctx context.Context, image string) ([]byte, error)
+}
+
+// Preferences are what users have saved for themselves
+type Preferences interface {
+	// Favorites returns the tickets the request's user starred
+	Favorites(r *http.Request) []string
+	// DefaultView returns the query parameters of the request's user's
+	// default view, or nil
+	DefaultView(r *http.Request) url.Values
+}
+
+// Access decides which tickets the user of a request may see and change, by
+// the project they belong to
+type Access interface {
+	CanView(r *http.Request, project string) bool
+	// CheckEdit fails with store.ErrForbidden, or store.ErrUnknownProject
+	// for projects that don't exist, unless the user may change its tickets
+	CheckEdit(r *http.Request, project string) error
+}
+
+// Auditor records changes made through the API
+type Auditor interface {
+	Record(r *http.Request, action, ticket string, details map[string]interface{})
+}
+
+// Handler serves /api/tickets, /api/status and /api/operator, and the
+// /api/v1 resources registered by Routes
+type Handler struct {
+	Tickets   Tickets
+	Registry  Registry
+	Audit     Auditor
+	Drift     Drift      // Nil when no clusters are configured
+	Catalog   Catalog    // Nil when no catalogs are configured
+	ArgoCD    ArgoCD     // Nil when no ArgoCD server is configured
+	Promotion Promotion  // Nil when no SaaS files are configured
+	Pipelines Pipelines  // Nil when no build pipelines are configured
+	Commits   Commits    // Nil when no source repositories are configured
+	Policy    Compliance // Nil when no policy is configured
+	Bundles   Bundles
+	Order     StatusOrder // Nil leaves statuses in the order of the ticket
+	// Preferences apply users' favorites and default views; nil without users
+	Preferences Preferences
+	// Access hides and protects the tickets of projects; nil lets everyone
+	// see and change every ticket
+	Access Access
+
+	// RequestID returns the ID included in error responses; optional
+	RequestID func(r *http.Request) string
+	// Logger returns the logger for a request; defaults to slog.Default
+	Logger func(r *http.Request) *slog.Logger
+	// Clock dates saved tickets; defaults to the system clock
+	Clock clock.Clock
+	// Location is the timezone expected-by dates are in; defaults to UTC
+	Location func() *time.Location
+}
+
+// now returns the time in the timezone of expected-by dates
+func (h *Handler) now() time.Time {
+	now := clock.Or(h.Clock).Now()
+	if h.Location != nil {
+		return now.In(h.Location())
+	}
+	return now.UTC()
+}
+
+func (h *Handler) requestID(r *http.Request) string {
+	if h.RequestID != nil {
+		return h.RequestID(r)
+	}
+	return ""
+}
+
+// error writes an error response for err, logging it first unless it is an
+// expected outcome such as an unknown ticket
+func (h *Handler) error(w http.ResponseWriter, r *http.Request, msg string, err error) {
+	if status, _ := ErrorStatus(err); status >= http.StatusInternalServerError {
+		h.logger(r).Error(msg, "error", err)
+	}
+	WriteError(w, h.requestID(r), err)
+}
+
+func (h *Handler) errorMessage(w http.ResponseWriter, r *http.Request, msg string, status int) {
+	WriteErrorMessage(w, h.requestID(r), msg, status)
+}
+
+func (h *Handler) logger(r *http.Request) *slog.Logger {
+	if h.Logger != nil {
+		return h.Logger(r)
+	}
+	return slog.Default()
+}
+
+// HandleTickets lists, saves and deletes tickets
+func (h *Handler) HandleTickets(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		tickets := h.Tickets.List()
+		h.writeTickets(w, r, tickets, h.filteredIDs(r, tickets))
+
+	case "POST":
+		var ticket store.Ticket
+		if err := json.NewDecoder(r.Body).Decode(&ticket); err != nil {
+			h.errorMessage(w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if ticket, _, ok := h.saveTicket(w, r, ticket); ok {
+			json.NewEncoder(w).Encode(ticket)
+		}
+
+	case "DELETE":
+		ticketID := r.URL.Query().Get("id")
+		if ticketID == "" {
+			h.errorMessage(w, r, "Ticket ID required", http.StatusBadRequest)
+			return
+		}
+
+		if err := h.Tickets.Delete(ticketID); err != nil {
+			h.error(w, r, "Failed to delete ticket", err)
+			return
+		}
+		h.Audit.Record(r, "ticket.delete", ticketID, nil)
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// viewParameters are the query parameters a default view sets, in the groups
+// that are applied together: a request giving any parameter of a group gets
+// none of the view's parameters in that group
+var viewParameters = [][]string{
+	{"owner", "label", "archived", "favorites", "project", "rollup"},
+	{"sort", "order", "columns"},
+}
+
+// ApplyView returns the query parameters of a request with those of a default
+// view added, unless the request has view=none
+func ApplyView(q, view url.Values) url.Values {
+	if len(view) == 0 || q.Get("view") == "none" {
+		return q
+	}
+	merged := url.Values{}
+	for k, v := range q {
+		merged[k] = v
+	}
+	for _, group := range viewParameters {
+		given := false
+		for _, key := range group {
+			given = given || q.Has(key)
+		}
+		if given {
+			continue
+		}
+		for _, key := range group {
+			if v, ok := view[key]; ok {
+				merged[key] = v
+			}
+		}
+	}
+	return merged
+}
+
+// query returns the query parameters of a request with the default view of
+// its user applied
+func (h *Handler) query(r *http.Request) url.Values {
+	if h.Preferences == nil {
+		return r.URL.Query()
+	}
+	return ApplyView(r.URL.Query(), h.Preferences.DefaultView(r))
+}
+
+// TicketFilter reads the owner, label, project, rollup and archived query
+// parameters. Labels and rollups can be repeated or comma separated, and
+// archived is true for archived tickets only or all for every ticket.
+func TicketFilter(q url.Values) store.Filter {
+	filter := store.Filter{Owner: q.Get("owner"), Project: q.Get("project"), Archived: q.Get("archived") == "true", IncludeArchived: q.Get("archived") == "all"}
+	filter.Labels = listParameter(q, "label")
+	filter.Rollups = listParameter(q, "rollup")
+	return filter
+}
+
+// listParameter returns the values of a query parameter that can be repeated
+// or comma separated
+func listParameter(q url.Values, key string) []string {
+	var values []string
+	for _, list := range q[key] {
+		for _, value := range strings.Split(list, ",") {
+			if value = strings.TrimSpace(value); value != "" {
+				values = append(values, value)
+			}
+		}
+	}
+	return values
+}
+
+// filteredIDs returns the IDs, sorted, of the tickets the user can see
+// matching the query parameters read by TicketFilter, or the user's default
+// view, only the user's favorites with favorites=true, and only those
+// tracking one of the operator parameters when given. The tickets are
+// looked at where they are, without copying them.
+func (h *Handler) filteredIDs(r *http.Request, tickets map[string]store.Ticket) []string {
+	q := h.query(r)
+	filter := TicketFilter(q)
+	if q.Get("favorites") == "true" {
+		filter.IDs = make(map[string]bool)
+		if h.Preferences != nil {
+			for _, id := range h.Preferences.Favorites(r) {
+				filter.IDs[id] = true
+			}
+		}
+	}
+	var matched []string
+	match := func(id string) {
+		if ticket, ok := tickets[id]; ok && filter.Match(ticket) && h.canView(r, ticket) {
+			matched = append(matched, id)
+		}
+	}
+	if operators := listParameter(q, "operator"); len(operators) > 0 {
+		for _, operator := range operators {
+			for _, id := range h.Tickets.Tracking(store.NormalizeOperator(operator)) {
+				match(id)
+			}
+		}
+		slices.Sort(matched)
+		return slices.Compact(matched) // Tickets tracking more than one of them
+	}
+	for id := range tickets {
+		match(id)
+	}
+	slices.Sort(matched)
+	return matched
+}
+
+// savedTicket is a saved ticket as answered, with the operators that were
+// merged or look alike when there are any
+type savedTicket struct {
+	store.Ticket
+	Normalized *store.OperatorReport `json:"normalized,omitempty"`
+}
+
+// saveTicket stores and audits a ticket sent by a client, normalizing its
+// operators, and writes the error response if that fails
+func (h *Handler) saveTicket(w http.ResponseWriter, r *http.Request, ticket store.Ticket) (saved savedTicket, existed, ok bool) {
+	if err := h.checkEdit(r, ticket); err != nil {
+		h.error(w, r, "Not allowed to save ticket", err)
+		return saved, false, false
+	}
+	operators, report := store.NormalizeOperators(ticket.Operators)
+	ticket.Operators = operators
+	ticket.Added, ticket.Baselines = clock.Or(h.Clock).Now(), nil
+	cves, err := cve.Normalize(ticket.CVEs)
+	if err != nil {
+		h.error(w, r, "Invalid CVEs", err)
+		return saved, false, false
+	}
+	ticket.CVEs = cves
+	if ticket.Labels, err = store.NormalizeLabels(ticket.Labels); err != nil {
+		h.error(w, r, "Invalid labels", err)
+		return saved, false, false
+	}
+	ticket.Description = strings.TrimSpace(ticket.Description)
+	names, pins, err := registry.SplitPins(ticket.OperatorNames(), ticket.Pins)
+	if err != nil {
+		h.error(w, r, "Invalid pinned digests", err)
+		return saved, false, false
+	}
+	ticket.SetOperatorNames(names)
+	ticket.Pins = pins
+	existed, err = h.Tickets.Put(ticket)
+	if err != nil {
+		h.error(w, r, "Failed to save ticket", err)
+		return saved, false, false
+	}
+	if stored, ok := h.Tickets.Get(ticket.ID); ok {
+		ticket = stored // With the members of its groups
+	}
+
+	action := "ticket.create"
+	if existed {
+		action = "ticket.replace"
+	}
+	h.Audit.Record(r, action, ticket.ID, map[string]interface{}{"operators": ticket.Operators, "owner": ticket.Owner, "labels": ticket.Labels, "groups": ticket.Groups, "applications": ticket.Applications, "cves": ticket.CVEs, "pins": ticket.Pins, "thresholds": ticket.Thresholds, "project": ticket.Project})
+	saved.Ticket = ticket
+	if !report.Empty() {
+		saved.Normalized = &report
+	}
+	return saved, existed, true
+}
+
+// canView reports whether the user of a request may see a ticket
+func (h *Handler) canView(r *http.Request, ticket store.Ticket) bool {
+	return h.Access == nil || h.Access.CanView(r, ticket.Project)
+}
+
+// checkEdit checks the user of a request may save a ticket in its project
+// and change the ticket it replaces, whose project it keeps when it has
+// none. Replacing a ticket the user can't see fails with
+// store.ErrTicketNotFound, so its ID gives nothing away.
+func (h *Handler) checkEdit(r *http.Request, ticket store.Ticket) error {
+	if h.Access == nil {
+		return nil
+	}
+	project := ticket.Project
+	if old, ok := h.Tickets.Get(ticket.ID); ok {
+		if !h.Access.CanView(r, old.Project) {
+			return store.ErrTicketNotFound
+		}
+		if err := h.Access.CheckEdit(r, old.Project); err != nil {
+			return err
+		}
+		if project == "" || project == old.Project {
+			return nil
+		}
+	}
+	return h.Access.CheckEdit(r, project)
+}
+
+// HandleStatus returns the status of every operator on a ticket
+func (h *Handler) HandleStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		h.errorMessage(w, r, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ticket, exists := h.Tickets.Get(r.URL.Query().Get("ticket"))
+	if !exists {
+		h.error(w, r, "Ticket not found", store.ErrTicketNotFound)
+		return
+	}
+
+	statuses, err := h.sortedStatuses(r, ticket)
+	if err != nil {
+		h.error(w, r, "Invalid sort", err)
+		return
+	}
+	json.NewEncoder(w).Encode(statuses)
+}
+
+// sortedStatuses looks up the statuses of a ticket, sorted by the sort and
+// order query parameters when set
+func (h *Handler) sortedStatuses(r *http.Request, ticket store.Ticket) ([]registry.Status, error) {
+	return h.sortStatuses(r, ticket, TicketStatuses(h.Registry, ticket, h.now()))
+}
+
+// sortStatuses sorts the statuses of a ticket by the sort and order query
+// parameters when set
+func (h *Handler) sortStatuses(r *http.Request, ticket store.Ticket, statuses []registry.Status) ([]registry.Status, error) {
+	q := h.query(r)
+	column, order := q.Get("sort"), q.Get("order")
+	if order != "" && order != "asc" && order != "desc" {
+		return nil, fmt.Errorf("%w: order %q must be asc or desc", ErrInvalidColumn, order)
+	}
+	if column == "" || h.Order == nil {
+		return statuses, nil
+	}
+	if err := h.Order.Sort(ticket, statuses, column, order == "desc"); err != nil {
+		return nil, err
+	}
+	return statuses, nil
+}
+
+// TicketStatuses looks up the statuses of a ticket's operators, with the
+// details of their entries on the ticket. Expected-by dates count down from
+// now, in the timezone they are read in.
+func TicketStatuses(reg Registry, ticket store.Ticket, now time.Time) []registry.Status {
+	return withDetails(ticket, reg.GetStatuses(ticket.OperatorNames()), now)
+}
+
+// withDetails gives the statuses of a ticket's operators the details of
+// their entries on the ticket, in place
+func withDetails(ticket store.Ticket, statuses []registry.Status, now time.Time) []registry.Status {
+	for i := range statuses {
+		if op, ok := ticket.Operator(statuses[i].Name); ok {
+			statuses[i].DisplayName, statuses[i].Owner, statuses[i].Note, statuses[i].Criticality = op.DisplayName, op.Owner, op.Note, op.Criticality
+			statuses[i].Team, statuses[i].Contact, statuses[i].ExpectedBy = op.Team, op.Contact, op.ExpectedBy
+			countDown(&statuses[i], ticket, now)
+		}
+	}
+	return statuses
+}
+
+// countDown sets the days left until an operator's expected-by date, and
+// whether it has passed, unless the operator has already been rebuilt
+func countDown(status *registry.Status, ticket store.Ticket, now time.Time) {
+	if status.ExpectedBy == "" || status.Status == "OK" && status.LastUpdated.After(ticket.Added) && !ticket.AtBaseline(status.Name, status.SHA256) {
+		return
+	}
+	due, err := time.ParseInLocation(store.DateLayout, status.ExpectedBy, now.Location())
+	if err != nil {
+		return
+	}
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	days := int(math.Round(due.Sub(today).Hours() / 24))
+	status.DaysLeft, status.Overdue = &days, days < 0
+}
+
+// HandleOperator looks up a single operator, whether or not it is on a ticket
+func (h *Handler) HandleOperator(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		h.errorMessage(w, r, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		h.errorMessage(w, r, "Operator name required", http.StatusBadRequest)
+		return
+	}
+
+	status, err := h.Registry.GetOperatorStatus(name)
+	if err != nil {
+		h.error(w, r, "Failed to get operator status", err)
+		return
+	}
+	json.NewEncoder(w).Encode(status)
+}
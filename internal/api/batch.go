@@ -0,0 +1,106 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"OpTrack/internal/registry"
+	"OpTrack/internal/store"
+)
+
+// maxBatch is the most tickets and operators one batch may ask for, together
+const maxBatch = 500
+
+// BatchRequest is the body of POST /api/v1/status/batch
+type BatchRequest struct {
+	Tickets   []string `json:"tickets"`
+	Operators []string `json:"operators"` // Looked up whether or not a ticket tracks them
+}
+
+// BatchResponse has the statuses of the tickets and operators of a
+// BatchRequest, by ticket ID and operator as asked for
+type BatchResponse struct {
+	Tickets   map[string]BatchTicket     `json:"tickets"`
+	Operators map[string]registry.Status `json:"operators"`
+	Lookups   int                        `json:"lookups"` // Distinct operators looked up
+}
+
+// BatchTicket is the statuses of a ticket in a batch, sorted like those of
+// GET /api/v1/tickets/{id}/status, or why there are none
+type BatchTicket struct {
+	Statuses []registry.Status `json:"statuses"` // Null with an error
+	Error    *ErrorResponse    `json:"error,omitempty"`
+}
+
+// batchStatus answers the statuses of several tickets and operators in one
+// response, looking up each operator once however many of them track it.
+// Tickets the user can't see are answered as ticket_not_found, like unknown
+// ones, without failing the batch.
+func (h *Handler) batchStatus(w http.ResponseWriter, r *http.Request) {
+	var req BatchRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil {
+		h.errorMessage(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	switch n := len(req.Tickets) + len(req.Operators); {
+	case n == 0:
+		h.errorMessage(w, r, "tickets or operators required", http.StatusBadRequest)
+		return
+	case n > maxBatch:
+		h.errorMessage(w, r, fmt.Sprintf("at most %d tickets and operators per batch, got %d", maxBatch, n), http.StatusBadRequest)
+		return
+	}
+
+	resp := BatchResponse{Tickets: make(map[string]BatchTicket), Operators: make(map[string]registry.Status)}
+	tickets := make(map[string]store.Ticket)
+	var names []string
+	seen := make(map[string]bool)
+	add := func(name string) {
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	for _, id := range req.Tickets {
+		ticket, ok := h.Tickets.Get(id)
+		if !ok || !h.canView(r, ticket) {
+			_, code := ErrorStatus(store.ErrTicketNotFound)
+			resp.Tickets[id] = BatchTicket{Error: &ErrorResponse{Code: code, Message: store.ErrTicketNotFound.Error()}}
+			continue
+		}
+		tickets[id] = ticket
+		for _, name := range ticket.OperatorNames() {
+			add(name)
+		}
+	}
+	operators := make([]string, len(req.Operators))
+	for i, name := range req.Operators {
+		operators[i] = store.NormalizeOperator(name)
+		add(operators[i])
+	}
+
+	found := make(map[string]registry.Status, len(names))
+	for i, status := range h.Registry.GetStatuses(names) {
+		found[names[i]] = status
+	}
+	resp.Lookups = len(names)
+	now := h.now()
+	for id, ticket := range tickets {
+		statuses := make([]registry.Status, 0, len(ticket.Operators))
+		for _, name := range ticket.OperatorNames() {
+			statuses = append(statuses, found[name])
+		}
+		statuses, err := h.sortStatuses(r, ticket, withDetails(ticket, statuses, now))
+		if err != nil {
+			h.error(w, r, "Invalid sort", err)
+			return
+		}
+		resp.Tickets[id] = BatchTicket{Statuses: statuses}
+	}
+	for i, name := range req.Operators {
+		resp.Operators[name] = found[operators[i]]
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,122 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"OpTrack/internal/argocd"
+	"OpTrack/internal/bundle"
+	"OpTrack/internal/catalog"
+	"OpTrack/internal/ci"
+	"OpTrack/internal/cve"
+	"OpTrack/internal/drift"
+	"OpTrack/internal/github"
+	"OpTrack/internal/manifests"
+	"OpTrack/internal/policy"
+	"OpTrack/internal/registry"
+	"OpTrack/internal/saas"
+	"OpTrack/internal/store"
+)
+
+// ErrInvalidColumn is returned for sort, order and columns parameters naming
+// columns the status table doesn't have
+var ErrInvalidColumn = errors.New("invalid column")
+
+// ErrorResponse is the JSON body of every API error
+type ErrorResponse struct {
+	Code      string `json:"code"` // Stable, machine-readable, such as "ticket_not_found"
+	Message   string `json:"message"`
+	RequestID string `json:"requestId,omitempty"`
+}
+
+// errorCodes maps the errors of the store, registry, drift, catalog, argocd,
+// saas, ci, github, policy, manifests and bundle layers to responses.
+// Errors not listed here are internal errors.
+var errorCodes = []struct {
+	err    error
+	status int
+	code   string
+}{
+	{store.ErrTicketNotFound, http.StatusNotFound, "ticket_not_found"},
+	{store.ErrStorage, http.StatusInternalServerError, "storage_error"},
+	{store.ErrReadOnly, http.StatusForbidden, "read_only"},
+	{store.ErrOperatorNotAllowed, http.StatusBadRequest, "operator_not_allowed"},
+	{store.ErrInvalidLabel, http.StatusBadRequest, "invalid_label"},
+	{store.ErrGroupNotFound, http.StatusNotFound, "group_not_found"},
+	{store.ErrUnknownGroup, http.StatusBadRequest, "unknown_group"},
+	{store.ErrOperatorNotFound, http.StatusNotFound, "operator_not_found"},
+	{store.ErrInvalidThresholds, http.StatusBadRequest, "invalid_thresholds"},
+	{store.ErrInvalidExpectedBy, http.StatusBadRequest, "invalid_expected_by"},
+	{store.ErrTemplateNotFound, http.StatusNotFound, "template_not_found"},
+	{store.ErrTicketExists, http.StatusConflict, "ticket_exists"},
+	{store.ErrUnknownProject, http.StatusBadRequest, "unknown_project"},
+	{store.ErrProjectNotFound, http.StatusNotFound, "project_not_found"},
+	{store.ErrForbidden, http.StatusForbidden, "forbidden"},
+	{store.ErrTooManyOperators, http.StatusBadRequest, "too_many_operators"},
+	{store.ErrQuotaExceeded, http.StatusForbidden, "quota_exceeded"},
+	{cve.ErrInvalid, http.StatusBadRequest, "invalid_cve"},
+	{registry.ErrInvalidOperator, http.StatusBadRequest, "invalid_operator"},
+	{registry.ErrInvalidPin, http.StatusBadRequest, "invalid_pin"},
+	{ErrInvalidColumn, http.StatusBadRequest, "invalid_column"},
+	{registry.ErrRegistryUnavailable, http.StatusServiceUnavailable, "registry_unavailable"},
+	{drift.ErrNoClusters, http.StatusNotFound, "no_clusters"},
+	{catalog.ErrNoCatalogs, http.StatusNotFound, "no_catalogs"},
+	{argocd.ErrNotConfigured, http.StatusNotFound, "no_argocd"},
+	{saas.ErrNoSources, http.StatusNotFound, "no_saas_files"},
+	{ci.ErrNotConfigured, http.StatusNotFound, "no_pipelines"},
+	{github.ErrNotConfigured, http.StatusNotFound, "no_repositories"},
+	{policy.ErrNotConfigured, http.StatusNotFound, "no_policy"},
+	{manifests.ErrNoImages, http.StatusUnprocessableEntity, "no_images"},
+	{bundle.ErrNoCSV, http.StatusUnprocessableEntity, "no_csv"},
+}
+
+// ErrorStatus returns the HTTP status code and error code for err
+func ErrorStatus(err error) (int, string) {
+	for _, e := range errorCodes {
+		if errors.Is(err, e.err) {
+			return e.status, e.code
+		}
+	}
+	return http.StatusInternalServerError, "internal_error"
+}
+
+// CodeError returns the sentinel error for an error code from ErrorResponse,
+// so API clients can match the same errors as the server
+func CodeError(code string) error {
+	for _, e := range errorCodes {
+		if e.code == code {
+			return e.err
+		}
+	}
+	return nil
+}
+
+// WriteError writes err with the status code for its type. Internal errors
+// get a generic message so storage paths and the like don't leak.
+func WriteError(w http.ResponseWriter, requestID string, err error) {
+	status, code := ErrorStatus(err)
+	msg := err.Error()
+	if status == http.StatusInternalServerError {
+		msg = http.StatusText(status)
+	}
+	writeErrorResponse(w, status, ErrorResponse{Code: code, Message: msg, RequestID: requestID})
+}
+
+// WriteErrorMessage writes an error that doesn't come from the store or
+// registry, such as a bad request parameter, coded after its status
+func WriteErrorMessage(w http.ResponseWriter, requestID, msg string, status int) {
+	code := strings.ToLower(strings.ReplaceAll(http.StatusText(status), " ", "_"))
+	if status == http.StatusInternalServerError {
+		code = "internal_error"
+	}
+	writeErrorResponse(w, status, ErrorResponse{Code: code, Message: msg, RequestID: requestID})
+}
+
+func writeErrorResponse(w http.ResponseWriter, status int, body ErrorResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
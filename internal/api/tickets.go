@@ -0,0 +1,131 @@
+package api
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"OpTrack/internal/store"
+)
+
+// ticketFields are the JSON fields of a ticket, which ?fields= may select
+var ticketFields = func() map[string]bool {
+	fields := make(map[string]bool)
+	t := reflect.TypeOf(store.Ticket{})
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			fields[name] = true
+		}
+	}
+	return fields
+}()
+
+// selectedFields returns the ticket fields asked for with ?fields=, always
+// with the ID, or nil for every field
+func selectedFields(r *http.Request) (map[string]bool, error) {
+	names := listParameter(r.URL.Query(), "fields")
+	if len(names) == 0 {
+		return nil, nil
+	}
+	fields := map[string]bool{"id": true}
+	for _, name := range names {
+		if !ticketFields[name] {
+			return nil, fmt.Errorf("unknown ticket field %q", name)
+		}
+		fields[name] = true
+	}
+	return fields, nil
+}
+
+// wantsNDJSON reports whether a request asks for one ticket per line, with
+// ?format=ndjson or an Accept header naming application/x-ndjson
+func wantsNDJSON(r *http.Request) bool {
+	if format := r.URL.Query().Get("format"); format != "" {
+		return format == "ndjson"
+	}
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		if mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part)); err == nil && mediaType == "application/x-ndjson" {
+			return true
+		}
+	}
+	return false
+}
+
+// writeTickets writes the tickets with the given IDs, in that order, as a
+// JSON object keyed by ID, or one ticket per line for NDJSON, with only the
+// fields asked for. Tickets are encoded and sent one at a time, so large
+// lists aren't built up in memory. A ticket that fails to encode aborts the
+// response, so that clients don't take the tickets before it for all of them.
+func (h *Handler) writeTickets(w http.ResponseWriter, r *http.Request, tickets map[string]store.Ticket, ids []string) {
+	fields, err := selectedFields(r)
+	if err != nil {
+		h.errorMessage(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	ndjson := wantsNDJSON(r)
+	if ndjson {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	} else {
+		w.Header().Set("Content-Type", "application/json")
+	}
+
+	out := bufio.NewWriterSize(w, 32<<10)
+	if !ndjson {
+		out.WriteByte('{')
+	}
+	for i, id := range ids {
+		data, err := encodeTicket(tickets[id], fields)
+		if err != nil {
+			// The status may already be sent: cut the connection instead
+			h.logger(r).Error("Failed to encode ticket", "ticket", id, "error", err)
+			panic(http.ErrAbortHandler)
+		}
+		if ndjson {
+			out.Write(data)
+			err = out.WriteByte('\n')
+		} else {
+			if i > 0 {
+				out.WriteByte(',')
+			}
+			key, _ := json.Marshal(id)
+			out.Write(key)
+			out.WriteByte(':')
+			_, err = out.Write(data)
+		}
+		// Errors stick to out, so the last write of a ticket reports any
+		if err != nil {
+			h.logger(r).Warn("Failed to send tickets", "sent", i, "tickets", len(ids), "error", err)
+			return
+		}
+	}
+	if !ndjson {
+		out.WriteString("}\n")
+	}
+	if err := out.Flush(); err != nil {
+		h.logger(r).Warn("Failed to send tickets", "sent", len(ids), "tickets", len(ids), "error", err)
+	}
+}
+
+// encodeTicket encodes a ticket with only the given fields, or all of them
+// when fields is nil
+func encodeTicket(ticket store.Ticket, fields map[string]bool) ([]byte, error) {
+	data, err := json.Marshal(ticket)
+	if err != nil || fields == nil {
+		return data, err
+	}
+	var all map[string]json.RawMessage
+	if err := json.Unmarshal(data, &all); err != nil {
+		return nil, err
+	}
+	for name := range all {
+		if !fields[name] {
+			delete(all, name)
+		}
+	}
+	return json.Marshal(all)
+}
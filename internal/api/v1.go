@@ -0,0 +1,458 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"slices"
+
+	"OpTrack/internal/argocd"
+	"OpTrack/internal/bundle"
+	"OpTrack/internal/catalog"
+	"OpTrack/internal/ci"
+	"OpTrack/internal/cve"
+	"OpTrack/internal/drift"
+	"OpTrack/internal/github"
+	"OpTrack/internal/manifests"
+	"OpTrack/internal/policy"
+	"OpTrack/internal/saas"
+	"OpTrack/internal/store"
+)
+
+// Mux is where Routes registers its handlers. Patterns include the method
+// and path parameters, as accepted by http.ServeMux.
+type Mux interface {
+	HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request))
+}
+
+// Routes registers the /api/v1 resources on mux:
+//
+//	GET    /api/v1/tickets
+//	POST   /api/v1/tickets
+//	GET    /api/v1/tickets/{id}
+//	PUT    /api/v1/tickets/{id}
+//	DELETE /api/v1/tickets/{id}
+//	POST   /api/v1/tickets/{id}/import
+//	POST   /api/v1/tickets/{id}/related-images
+//	GET    /api/v1/tickets/{id}/status
+//	GET    /api/v1/tickets/{id}/drift
+//	GET    /api/v1/tickets/{id}/catalog
+//	GET    /api/v1/tickets/{id}/applications
+//	GET    /api/v1/tickets/{id}/promotion
+//	GET    /api/v1/tickets/{id}/pipelines
+//	GET    /api/v1/tickets/{id}/commits
+//	GET    /api/v1/tickets/{id}/compliance
+//	GET    /api/v1/tickets/{id}/cves
+//	GET    /api/v1/projects/{project}/tickets
+//	POST   /api/v1/projects/{project}/tickets
+//	GET    /api/v1/operators/{namespace}/{repository}
+//	POST   /api/v1/status/batch
+//	GET    /api/v1/discovery
+func (h *Handler) Routes(mux Mux) {
+	mux.HandleFunc("GET /api/v1/tickets", h.listTickets)
+	mux.HandleFunc("POST /api/v1/tickets", h.createTicket)
+	mux.HandleFunc("GET /api/v1/tickets/{id}", h.getTicket)
+	mux.HandleFunc("PUT /api/v1/tickets/{id}", h.putTicket)
+	mux.HandleFunc("DELETE /api/v1/tickets/{id}", h.deleteTicket)
+	mux.HandleFunc("POST /api/v1/tickets/{id}/archive", h.archiveTicket(true))
+	mux.HandleFunc("POST /api/v1/tickets/{id}/unarchive", h.archiveTicket(false))
+	mux.HandleFunc("POST /api/v1/tickets/{id}/import", h.importTicket)
+	mux.HandleFunc("POST /api/v1/tickets/{id}/related-images", h.addRelatedImages)
+	mux.HandleFunc("GET /api/v1/tickets/{id}/status", h.ticketStatus)
+	mux.HandleFunc("GET /api/v1/tickets/{id}/drift", h.ticketDrift)
+	mux.HandleFunc("GET /api/v1/tickets/{id}/catalog", h.ticketCatalog)
+	mux.HandleFunc("GET /api/v1/tickets/{id}/applications", h.ticketApplications)
+	mux.HandleFunc("GET /api/v1/tickets/{id}/promotion", h.ticketPromotion)
+	mux.HandleFunc("GET /api/v1/tickets/{id}/pipelines", h.ticketPipelines)
+	mux.HandleFunc("GET /api/v1/tickets/{id}/commits", h.ticketCommits)
+	mux.HandleFunc("GET /api/v1/tickets/{id}/compliance", h.ticketCompliance)
+	mux.HandleFunc("GET /api/v1/tickets/{id}/cves", h.ticketCVEs)
+	mux.HandleFunc("GET /api/v1/tickets/{id}/pins", h.ticketPins)
+	mux.HandleFunc("GET /api/v1/projects/{project}/tickets", h.listProjectTickets)
+	mux.HandleFunc("POST /api/v1/projects/{project}/tickets", h.createProjectTicket)
+	mux.HandleFunc("GET /api/v1/operators/{namespace}/{repository}", h.getOperator)
+	mux.HandleFunc("POST /api/v1/status/batch", h.batchStatus)
+	mux.HandleFunc("GET /api/v1/discovery", h.discover)
+}
+
+func (h *Handler) listTickets(w http.ResponseWriter, r *http.Request) {
+	tickets := h.Tickets.List()
+	h.writeTickets(w, r, tickets, h.filteredIDs(r, tickets))
+}
+
+// listProjectTickets lists the tickets of the project in the path, taking
+// the other filters of listTickets
+func (h *Handler) listProjectTickets(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	q.Set("project", r.PathValue("project"))
+	r = r.Clone(r.Context())
+	r.URL.RawQuery = q.Encode()
+	h.listTickets(w, r)
+}
+
+// createProjectTicket saves a ticket with the ID in its body in the project
+// in the path. A project in the body must match it.
+func (h *Handler) createProjectTicket(w http.ResponseWriter, r *http.Request) {
+	var ticket store.Ticket
+	if err := json.NewDecoder(r.Body).Decode(&ticket); err != nil {
+		h.errorMessage(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if ticket.ID == "" {
+		h.errorMessage(w, r, "Ticket ID required", http.StatusBadRequest)
+		return
+	}
+	project := r.PathValue("project")
+	if ticket.Project != "" && ticket.Project != project {
+		h.errorMessage(w, r, "Project in the body doesn't match the URL", http.StatusBadRequest)
+		return
+	}
+	ticket.Project = project
+	h.writeSaved(w, r, ticket)
+}
+
+// createTicket saves a ticket with the ID in its body, answering 201 for a
+// new ticket and 200 when it replaced one
+func (h *Handler) createTicket(w http.ResponseWriter, r *http.Request) {
+	var ticket store.Ticket
+	if err := json.NewDecoder(r.Body).Decode(&ticket); err != nil {
+		h.errorMessage(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if ticket.ID == "" {
+		h.errorMessage(w, r, "Ticket ID required", http.StatusBadRequest)
+		return
+	}
+	h.writeSaved(w, r, ticket)
+}
+
+// putTicket saves the ticket named in the path. An ID in the body must match it.
+func (h *Handler) putTicket(w http.ResponseWriter, r *http.Request) {
+	var ticket store.Ticket
+	if err := json.NewDecoder(r.Body).Decode(&ticket); err != nil {
+		h.errorMessage(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	id := r.PathValue("id")
+	if ticket.ID != "" && ticket.ID != id {
+		h.errorMessage(w, r, "Ticket ID in the body doesn't match the URL", http.StatusBadRequest)
+		return
+	}
+	ticket.ID = id
+	h.writeSaved(w, r, ticket)
+}
+
+func (h *Handler) writeSaved(w http.ResponseWriter, r *http.Request, ticket store.Ticket) {
+	saved, existed, ok := h.saveTicket(w, r, ticket)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if !existed {
+		w.WriteHeader(http.StatusCreated)
+	}
+	json.NewEncoder(w).Encode(saved)
+}
+
+// maxManifestBytes bounds the manifests an import reads
+const maxManifestBytes = 10 << 20
+
+// importTicket saves a ticket tracking the images referenced by the YAML or
+// JSON manifests in the body, on the registries given by the registry
+// parameter. With dryRun=true the ticket is returned without being saved.
+func (h *Handler) importTicket(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	res, err := manifests.Import(http.MaxBytesReader(w, r.Body, maxManifestBytes), query["registry"])
+	if err != nil && !errors.Is(err, manifests.ErrNoImages) {
+		h.errorMessage(w, r, "Invalid manifests: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		h.error(w, r, "No images to import", err)
+		return
+	}
+
+	ticket := store.Ticket{ID: r.PathValue("id"), Operators: store.OperatorsNamed(res.Operators), Pins: res.Pins, Owner: query.Get("owner")}
+	status := http.StatusOK
+	if query.Get("dryRun") != "true" {
+		saved, existed, ok := h.saveTicket(w, r, ticket)
+		if !ok {
+			return
+		}
+		ticket = saved.Ticket
+		if !existed {
+			status = http.StatusCreated
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(struct {
+		Ticket store.Ticket      `json:"ticket"`
+		Images []manifests.Image `json:"images"`
+	}{ticket, res.Images})
+}
+
+// addRelatedImages adds the images referenced by an operator's
+// ClusterServiceVersion to a ticket: the CSV of the bundle image in the
+// bundle parameter, or the CSV in the body. Operators already on the
+// ticket are kept. With dryRun=true the ticket is returned without being saved.
+func (h *Handler) addRelatedImages(w http.ResponseWriter, r *http.Request) {
+	ticket, exists := h.Tickets.Get(r.PathValue("id"))
+	if !exists {
+		h.error(w, r, "Ticket not found", store.ErrTicketNotFound)
+		return
+	}
+	query := r.URL.Query()
+	var csv io.Reader = http.MaxBytesReader(w, r.Body, maxManifestBytes)
+	if image := query.Get("bundle"); image != "" {
+		data, err := h.Bundles.CSV(r.Context(), image)
+		if errors.Is(err, bundle.ErrNoCSV) {
+			h.error(w, r, "No CSV in bundle", err)
+			return
+		}
+		if err != nil {
+			h.errorMessage(w, r, "Failed to pull "+image+": "+err.Error(), http.StatusBadGateway)
+			return
+		}
+		csv = bytes.NewReader(data)
+	}
+	res, err := manifests.Import(csv, query["registry"])
+	if err != nil && !errors.Is(err, manifests.ErrNoImages) {
+		h.errorMessage(w, r, "Invalid ClusterServiceVersion: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		h.error(w, r, "No related images", err)
+		return
+	}
+
+	_, added := manifests.Merge(ticket.OperatorNames(), res)
+	ticket.Operators = append(slices.Clone(ticket.Operators), store.OperatorsNamed(added)...)
+	if query.Get("dryRun") != "true" && len(added) > 0 {
+		saved, _, ok := h.saveTicket(w, r, ticket)
+		if !ok {
+			return
+		}
+		ticket = saved.Ticket
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Ticket store.Ticket      `json:"ticket"`
+		Added  []string          `json:"added"`
+		Images []manifests.Image `json:"images"`
+	}{ticket, append([]string{}, added...), res.Images})
+}
+
+func (h *Handler) getTicket(w http.ResponseWriter, r *http.Request) {
+	ticket, exists := h.Tickets.Get(r.PathValue("id"))
+	if !exists {
+		h.error(w, r, "Ticket not found", store.ErrTicketNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ticket)
+}
+
+func (h *Handler) deleteTicket(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if err := h.Tickets.Delete(id); err != nil {
+		h.error(w, r, "Failed to delete ticket", err)
+		return
+	}
+	h.Audit.Record(r, "ticket.delete", id, nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// archiveTicket archives or unarchives a ticket, answering with the ticket
+func (h *Handler) archiveTicket(archived bool) http.HandlerFunc {
+	action := "ticket.unarchive"
+	if archived {
+		action = "ticket.archive"
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		ticket, changed, err := h.Tickets.Archive(r.PathValue("id"), archived)
+		if err != nil {
+			h.error(w, r, "Failed to archive ticket", err)
+			return
+		}
+		if changed {
+			h.Audit.Record(r, action, ticket.ID, nil)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ticket)
+	}
+}
+
+func (h *Handler) ticketStatus(w http.ResponseWriter, r *http.Request) {
+	ticket, exists := h.Tickets.Get(r.PathValue("id"))
+	if !exists {
+		h.error(w, r, "Ticket not found", store.ErrTicketNotFound)
+		return
+	}
+	statuses, err := h.sortedStatuses(r, ticket)
+	if err != nil {
+		h.error(w, r, "Invalid sort", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(statuses)
+}
+
+// ticketDrift reports, per cluster, whether each operator on a ticket runs
+// its latest image
+func (h *Handler) ticketDrift(w http.ResponseWriter, r *http.Request) {
+	ticket, exists := h.Tickets.Get(r.PathValue("id"))
+	if !exists {
+		h.error(w, r, "Ticket not found", store.ErrTicketNotFound)
+		return
+	}
+	if h.Drift == nil {
+		h.error(w, r, "No clusters", drift.ErrNoClusters)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.Drift.Check(r.Context(), ticket.OperatorNames()))
+}
+
+// discover lists the operators running in the clusters' namespaces, with
+// images on the registries in the registry parameter
+func (h *Handler) discover(w http.ResponseWriter, r *http.Request) {
+	if h.Drift == nil {
+		h.error(w, r, "No clusters", drift.ErrNoClusters)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.Drift.Discover(r.Context(), r.URL.Query()["registry"]))
+}
+
+// ticketCatalog reports, per catalog, whether the newest bundle of each
+// operator on a ticket references its latest image
+func (h *Handler) ticketCatalog(w http.ResponseWriter, r *http.Request) {
+	ticket, exists := h.Tickets.Get(r.PathValue("id"))
+	if !exists {
+		h.error(w, r, "Ticket not found", store.ErrTicketNotFound)
+		return
+	}
+	if h.Catalog == nil {
+		h.error(w, r, "No catalogs", catalog.ErrNoCatalogs)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.Catalog.Check(r.Context(), ticket.OperatorNames()))
+}
+
+// ticketApplications reports the sync and health of the ArgoCD applications
+// linked to a ticket, and whether they deploy the latest image of each operator
+func (h *Handler) ticketApplications(w http.ResponseWriter, r *http.Request) {
+	ticket, exists := h.Tickets.Get(r.PathValue("id"))
+	if !exists {
+		h.error(w, r, "Ticket not found", store.ErrTicketNotFound)
+		return
+	}
+	if h.ArgoCD == nil {
+		h.error(w, r, "No ArgoCD", argocd.ErrNotConfigured)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.ArgoCD.Check(r.Context(), ticket.Applications, ticket.OperatorNames()))
+}
+
+// ticketPromotion reports whether the SaaS file targets deploying each
+// operator on a ticket have been promoted to its latest image
+func (h *Handler) ticketPromotion(w http.ResponseWriter, r *http.Request) {
+	ticket, exists := h.Tickets.Get(r.PathValue("id"))
+	if !exists {
+		h.error(w, r, "Ticket not found", store.ErrTicketNotFound)
+		return
+	}
+	if h.Promotion == nil {
+		h.error(w, r, "No SaaS files", saas.ErrNoSources)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.Promotion.Check(r.Context(), ticket.OperatorNames()))
+}
+
+// ticketPipelines reports the last build of each operator on a ticket that
+// has a pipeline configured
+func (h *Handler) ticketPipelines(w http.ResponseWriter, r *http.Request) {
+	ticket, exists := h.Tickets.Get(r.PathValue("id"))
+	if !exists {
+		h.error(w, r, "Ticket not found", store.ErrTicketNotFound)
+		return
+	}
+	if h.Pipelines == nil {
+		h.error(w, r, "No pipelines", ci.ErrNotConfigured)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.Pipelines.Check(r.Context(), ticket.OperatorNames()))
+}
+
+// ticketCommits reports how far the latest image of each operator on a
+// ticket that has a source repository is behind its branch and release
+func (h *Handler) ticketCommits(w http.ResponseWriter, r *http.Request) {
+	ticket, exists := h.Tickets.Get(r.PathValue("id"))
+	if !exists {
+		h.error(w, r, "Ticket not found", store.ErrTicketNotFound)
+		return
+	}
+	if h.Commits == nil {
+		h.error(w, r, "No source repositories", github.ErrNotConfigured)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.Commits.Check(r.Context(), ticket.OperatorNames()))
+}
+
+// ticketCompliance checks each operator on a ticket against the compliance
+// policy, with the reasons it fails
+func (h *Handler) ticketCompliance(w http.ResponseWriter, r *http.Request) {
+	ticket, exists := h.Tickets.Get(r.PathValue("id"))
+	if !exists {
+		h.error(w, r, "Ticket not found", store.ErrTicketNotFound)
+		return
+	}
+	if h.Policy == nil {
+		h.error(w, r, "No policy", policy.ErrNotConfigured)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.Policy.Check(r.Context(), ticket.OperatorNames()))
+}
+
+// ticketCVEs reports whether the latest image of each operator on a ticket
+// still has the ticket's CVEs, by the last scan of the image
+func (h *Handler) ticketCVEs(w http.ResponseWriter, r *http.Request) {
+	ticket, exists := h.Tickets.Get(r.PathValue("id"))
+	if !exists {
+		h.error(w, r, "Ticket not found", store.ErrTicketNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(cve.Check(h.Registry.GetStatuses(ticket.OperatorNames()), ticket.CVEs))
+}
+
+// ticketPins checks whether the digests the operators on a ticket are pinned
+// to are still tagged, or at least still in the registry
+func (h *Handler) ticketPins(w http.ResponseWriter, r *http.Request) {
+	ticket, exists := h.Tickets.Get(r.PathValue("id"))
+	if !exists {
+		h.error(w, r, "Ticket not found", store.ErrTicketNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.Registry.CheckPins(ticket.OperatorNames(), ticket.Pins))
+}
+
+func (h *Handler) getOperator(w http.ResponseWriter, r *http.Request) {
+	status, err := h.Registry.GetOperatorStatus(r.PathValue("namespace") + "/" + r.PathValue("repository"))
+	if err != nil {
+		h.error(w, r, "Failed to get operator status", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
@@ -0,0 +1,258 @@
+// Package argocd reads ArgoCD applications and compares the images they
+// deploy with the latest image of each operator on the registry
+package argocd
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"OpTrack/internal/kube"
+	"OpTrack/internal/registry"
+)
+
+var (
+	// ErrNotConfigured is returned when application status is asked for but
+	// no ArgoCD server is configured
+	ErrNotConfigured = errors.New("ArgoCD is not configured")
+	// ErrApplicationNotFound is returned for applications ArgoCD doesn't know
+	ErrApplicationNotFound = errors.New("application not found")
+)
+
+// States of an operator in an application, as in package drift
+const (
+	StateCurrent     = "current"      // The application deploys the latest image
+	StateOutdated    = "outdated"     // The application deploys an older image
+	StateNotDeployed = "not_deployed" // None of the application's images is the operator's
+	StateUnknown     = "unknown"      // ArgoCD or the registry couldn't be read, or the image is referenced by tag
+)
+
+// Client calls the ArgoCD API with a bearer token
+type Client struct {
+	url   string
+	token string
+	http  *http.Client
+}
+
+// NewClient returns a client for the ArgoCD server at baseURL, e.g.
+// https://argocd.example.com
+func NewClient(baseURL, token string, timeout time.Duration, insecure bool) *Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if insecure {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	return &Client{
+		url:   strings.TrimSuffix(baseURL, "/"),
+		token: token,
+		http:  &http.Client{Timeout: timeout, Transport: transport},
+	}
+}
+
+// Application is the part of an ArgoCD application OpTrack reads
+type Application struct {
+	Metadata struct {
+		Name      string `json:"name"`
+		Namespace string `json:"namespace"`
+	} `json:"metadata"`
+	Spec struct {
+		Project     string `json:"project"`
+		Destination struct {
+			Server    string `json:"server"`
+			Name      string `json:"name"`
+			Namespace string `json:"namespace"`
+		} `json:"destination"`
+	} `json:"spec"`
+	Status struct {
+		Sync struct {
+			Status   string `json:"status"` // Synced, OutOfSync or Unknown
+			Revision string `json:"revision"`
+		} `json:"sync"`
+		Health struct {
+			Status string `json:"status"` // Healthy, Progressing, Degraded, Suspended, Missing or Unknown
+		} `json:"health"`
+		Summary struct {
+			Images []string `json:"images"` // The images of the application's live resources
+		} `json:"summary"`
+		History []struct {
+			Revision   string    `json:"revision"`
+			DeployedAt time.Time `json:"deployedAt"`
+		} `json:"history"`
+	} `json:"status"`
+}
+
+// Application fetches an application by name, or by namespace/name for
+// applications outside ArgoCD's own namespace
+func (c *Client) Application(ctx context.Context, name string) (*Application, error) {
+	u := c.url + "/api/v1/applications/"
+	if ns, app, ok := strings.Cut(name, "/"); ok {
+		u += url.PathEscape(app) + "?appNamespace=" + url.QueryEscape(ns)
+	} else {
+		u += url.PathEscape(name)
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	// ArgoCD answers 403 rather than 404 so unauthorized users can't probe for names
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusForbidden:
+		return nil, fmt.Errorf("%s: %w", name, ErrApplicationNotFound)
+	case resp.StatusCode != http.StatusOK:
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		var e struct {
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(body, &e) == nil && e.Message != "" {
+			return nil, fmt.Errorf("%s: ArgoCD returned %d: %s", name, resp.StatusCode, e.Message)
+		}
+		return nil, fmt.Errorf("%s: ArgoCD returned %d", name, resp.StatusCode)
+	}
+	var app Application
+	if err := json.NewDecoder(resp.Body).Decode(&app); err != nil {
+		return nil, fmt.Errorf("%s: invalid response: %v", name, err)
+	}
+	return &app, nil
+}
+
+// Registry looks up the latest image of operators
+type Registry interface {
+	GetStatuses(operators []string) []registry.Status
+}
+
+// Result is an application's sync and health, and the state of each
+// operator in it
+type Result struct {
+	Application  string     `json:"application"`
+	Project      string     `json:"project,omitempty"`
+	Destination  string     `json:"destination,omitempty"` // The cluster and namespace it deploys to
+	Sync         string     `json:"sync,omitempty"`
+	Health       string     `json:"health,omitempty"`
+	Revision     string     `json:"revision,omitempty"` // The git revision it is synced to
+	LastDeployed *time.Time `json:"lastDeployed,omitempty"`
+	Images       []string   `json:"images,omitempty"`
+	Operators    []Operator `json:"operators"`
+	Error        string     `json:"error,omitempty"`
+}
+
+// Operator is the state of one operator in an application
+type Operator struct {
+	Operator string `json:"operator"`
+	State    string `json:"state"`
+	Latest   string `json:"latest,omitempty"` // sha256 of the latest image on the registry
+	Image    string `json:"image,omitempty"`  // The operator's image in the application
+	Error    string `json:"error,omitempty"`
+}
+
+// Monitor checks operators against ArgoCD applications
+type Monitor struct {
+	client   *Client
+	registry Registry
+}
+
+func New(client *Client, reg Registry) *Monitor {
+	return &Monitor{client: client, registry: reg}
+}
+
+// Check reports every application in the order given, with the state of
+// every operator in it
+func (m *Monitor) Check(ctx context.Context, applications, operators []string) []Result {
+	if len(applications) == 0 {
+		return []Result{}
+	}
+	statuses := m.registry.GetStatuses(operators)
+	results := make([]Result, len(applications))
+	var wg sync.WaitGroup
+	for i, name := range applications {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			app, err := m.client.Application(ctx, name)
+			results[i] = compare(name, app, err, statuses)
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+func compare(name string, app *Application, err error, statuses []registry.Status) Result {
+	res := Result{Application: name, Operators: []Operator{}}
+	if err != nil {
+		res.Error = err.Error()
+		for _, status := range statuses {
+			res.Operators = append(res.Operators, Operator{Operator: status.Name, State: StateUnknown})
+		}
+		return res
+	}
+
+	res.Project = app.Spec.Project
+	dest := app.Spec.Destination.Name
+	if dest == "" {
+		dest = app.Spec.Destination.Server
+	}
+	if app.Spec.Destination.Namespace != "" {
+		dest += "/" + app.Spec.Destination.Namespace
+	}
+	res.Destination = dest
+	res.Sync = app.Status.Sync.Status
+	res.Health = app.Status.Health.Status
+	res.Revision = app.Status.Sync.Revision
+	res.Images = app.Status.Summary.Images
+	if n := len(app.Status.History); n > 0 {
+		res.LastDeployed = &app.Status.History[n-1].DeployedAt
+	}
+
+	for _, status := range statuses {
+		res.Operators = append(res.Operators, compareOperator(status, app.Status.Summary.Images))
+	}
+	return res
+}
+
+func compareOperator(latest registry.Status, images []string) Operator {
+	op := Operator{Operator: latest.Name, State: StateNotDeployed}
+	var refs []kube.ImageRef
+	for _, image := range images {
+		if ref := kube.ParseImage(image); ref.Repository == latest.Name {
+			refs = append(refs, ref)
+		}
+	}
+	if len(refs) == 0 {
+		return op
+	}
+	op.Image = refs[0].String()
+	if latest.Status != "OK" {
+		op.State, op.Error = StateUnknown, latest.Status
+		return op
+	}
+	op.Latest = latest.SHA256
+
+	op.State = StateOutdated
+	for _, ref := range refs {
+		switch {
+		case ref.Digest == latest.SHA256:
+			op.State, op.Image, op.Error = StateCurrent, ref.String(), ""
+			return op
+		case ref.Digest == "":
+			op.State, op.Image = StateUnknown, ref.String()
+			op.Error = "the image is referenced by tag, so the digest it runs isn't known"
+		}
+	}
+	return op
+}
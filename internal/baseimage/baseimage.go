@@ -0,0 +1,319 @@
+// Package baseimage identifies the base image an image was built on, from
+// the base recorded in its annotations or labels or else by comparing its
+// layers with those of known base images, and whether a newer image of that
+// base has been published since
+package baseimage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"OpTrack/internal/clock"
+	"OpTrack/internal/kube"
+	"OpTrack/internal/oci"
+	"OpTrack/internal/registry"
+)
+
+// checkTimeout bounds checking the base of one image, including reading the
+// history of the bases the first time
+const checkTimeout = time.Minute
+
+// tagTTL is how long the image a tag of a base points at is reused
+const tagTTL = 10 * time.Minute
+
+// maxConfigBytes bounds the image configs read; real ones are a few KB
+const maxConfigBytes = 4 << 20
+
+// The annotations, or labels, buildah and docker buildx record the base image in
+const (
+	baseNameAnnotation   = "org.opencontainers.image.base.name"
+	baseDigestAnnotation = "org.opencontainers.image.base.digest"
+)
+
+// The platform whose image is compared when an image is multi-arch
+const (
+	platformOS   = "linux"
+	platformArch = "amd64"
+)
+
+// Options configures a Checker
+type Options struct {
+	Registry string          // The registry host operators' images are on, e.g. quay.io
+	Bases    []kube.ImageRef // Base images to look for; the tag, default latest, names the newest image
+	History  int             // How many older tags of each base are compared with images
+	Clock    clock.Clock
+}
+
+// Checker identifies the bases of images. It is a registry.BaseImageChecker.
+type Checker struct {
+	private *oci.Client // Pulls from Options.Registry
+	public  *oci.Client // Pulls from other registries
+	opts    Options
+	clock   clock.Clock
+
+	mu   sync.Mutex
+	tags map[string]cachedImage // "registry/repository:tag" -> image
+}
+
+type cachedImage struct {
+	image   *image
+	expires time.Time
+}
+
+// image is the platform image of a manifest or index
+type image struct {
+	digests []string // Of the index and the platform manifest, either of which a base digest may name
+	layers  []string
+}
+
+// NewChecker returns a Checker pulling operators' images with private and
+// images on other registries with public
+func NewChecker(private, public *oci.Client, opts Options) *Checker {
+	return &Checker{private: private, public: public, opts: opts, clock: clock.Or(opts.Clock), tags: make(map[string]cachedImage)}
+}
+
+// BaseImage identifies the base of an operator's image: the base its
+// annotations or labels name, else the newest image of a configured base whose
+// layers it starts with, else an older one among the last History tags
+func (c *Checker) BaseImage(operator, digest string) (*registry.BaseImage, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), checkTimeout)
+	defer cancel()
+
+	repo := c.repository(kube.ImageRef{Registry: c.opts.Registry, Repository: operator})
+	img, m, err := c.resolve(ctx, repo, "sha256:"+digest)
+	if err != nil {
+		return nil, err
+	}
+	name, baseDigest := m.Annotations[baseNameAnnotation], m.Annotations[baseDigestAnnotation]
+	if name == "" {
+		labels, err := c.labels(ctx, repo, m)
+		if err != nil {
+			return nil, err
+		}
+		name, baseDigest = labels[baseNameAnnotation], labels[baseDigestAnnotation]
+	}
+	if name != "" {
+		return c.named(ctx, kube.ParseImage(name), baseDigest, img)
+	}
+
+	for _, base := range c.opts.Bases {
+		latest, err := c.tag(ctx, base, newestTag(base))
+		if err != nil {
+			return nil, err
+		}
+		if latest.base(img) {
+			return &registry.BaseImage{State: registry.Current, Name: baseName(base), Digest: latest.digests[0], Latest: latest.digests[0]}, nil
+		}
+	}
+	for _, base := range c.opts.Bases {
+		tag, old, err := c.history(ctx, base, img)
+		if err != nil {
+			return nil, err
+		}
+		if old == nil {
+			continue
+		}
+		latest, err := c.tag(ctx, base, newestTag(base))
+		if err != nil {
+			return nil, err
+		}
+		return &registry.BaseImage{State: registry.Outdated, Name: baseName(base), Tag: tag, Digest: old.digests[0], Latest: latest.digests[0]}, nil
+	}
+	return &registry.BaseImage{State: registry.Unknown}, nil
+}
+
+// named judges an image against the base it records. The newest image of the
+// base is the tag of the configured base of the same repository, if any, else
+// the tag recorded. Without a recorded digest, layers are compared.
+func (c *Checker) named(ctx context.Context, ref kube.ImageRef, baseDigest string, img *image) (*registry.BaseImage, error) {
+	if baseDigest == "" && ref.Digest != "" {
+		baseDigest = "sha256:" + ref.Digest
+	}
+	ref.Digest = ""
+	for _, base := range c.opts.Bases {
+		if base.Registry == ref.Registry && base.Repository == ref.Repository {
+			ref.Tag = base.Tag
+		}
+	}
+	latest, err := c.tag(ctx, ref, newestTag(ref))
+	if err != nil {
+		return nil, err
+	}
+	result := &registry.BaseImage{State: registry.Outdated, Name: baseName(ref), Digest: baseDigest, Latest: latest.digests[0]}
+	if slices.Contains(latest.digests, baseDigest) || (baseDigest == "" && latest.base(img)) {
+		result.State = registry.Current
+	}
+	return result, nil
+}
+
+// history finds the older tag of a base an image is built on, among the last
+// History tags by version, or returns a nil image
+func (c *Checker) history(ctx context.Context, base kube.ImageRef, img *image) (string, *image, error) {
+	if c.opts.History <= 0 {
+		return "", nil, nil
+	}
+	tags, err := c.repository(base).Tags(ctx)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to list the tags of %s: %v", base.Registry+"/"+base.Repository, err)
+	}
+	tags = slices.DeleteFunc(tags, func(tag string) bool {
+		return tag == newestTag(base) || strings.HasPrefix(tag, "sha256-") // cosign signatures and attestations
+	})
+	slices.SortFunc(tags, func(a, b string) int { return compareVersions(b, a) })
+	for _, tag := range tags[:min(len(tags), c.opts.History)] {
+		old, err := c.tag(ctx, base, tag)
+		if errors.Is(err, oci.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return "", nil, err
+		}
+		if old.base(img) {
+			return tag, old, nil
+		}
+	}
+	return "", nil, nil
+}
+
+// tag reads the image a tag of a base points at, reusing it for tagTTL
+func (c *Checker) tag(ctx context.Context, base kube.ImageRef, tag string) (*image, error) {
+	key := base.Registry + "/" + base.Repository + ":" + tag
+	now := c.clock.Now()
+	c.mu.Lock()
+	entry, ok := c.tags[key]
+	c.mu.Unlock()
+	if ok && now.Before(entry.expires) {
+		return entry.image, nil
+	}
+
+	img, _, err := c.resolve(ctx, c.repository(base), tag)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read base image %s: %w", key, err)
+	}
+	c.mu.Lock()
+	c.tags[key] = cachedImage{image: img, expires: now.Add(tagTTL)}
+	for k, e := range c.tags {
+		if now.After(e.expires) {
+			delete(c.tags, k)
+		}
+	}
+	c.mu.Unlock()
+	return img, nil
+}
+
+// resolve reads the manifest at a reference, picking the linux/amd64 image,
+// or else the first, out of an index
+func (c *Checker) resolve(ctx context.Context, repo *oci.Repository, reference string) (*image, *oci.Manifest, error) {
+	m, err := repo.Manifest(ctx, reference)
+	if err != nil {
+		return nil, nil, err
+	}
+	digests := []string{m.Digest}
+	if len(m.Manifests) > 0 {
+		child := m.Manifests[0].Digest
+		for _, d := range m.Manifests {
+			if d.Platform.OS == platformOS && d.Platform.Architecture == platformArch {
+				child = d.Digest
+				break
+			}
+		}
+		if m, err = repo.Manifest(ctx, child); err != nil {
+			return nil, nil, err
+		}
+		digests = append(digests, m.Digest)
+	}
+	img := &image{digests: digests}
+	for _, l := range m.Layers {
+		img.layers = append(img.layers, l.Digest)
+	}
+	return img, m, nil
+}
+
+// labels reads the labels of an image from its config
+func (c *Checker) labels(ctx context.Context, repo *oci.Repository, m *oci.Manifest) (map[string]string, error) {
+	if m.Config.Digest == "" {
+		return nil, nil
+	}
+	blob, err := repo.Blob(ctx, m.Config.Digest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image config: %v", err)
+	}
+	defer blob.Close()
+	var config struct {
+		Config struct {
+			Labels map[string]string `json:"Labels"`
+		} `json:"config"`
+	}
+	if err := json.NewDecoder(io.LimitReader(blob, maxConfigBytes)).Decode(&config); err != nil {
+		return nil, fmt.Errorf("invalid image config: %v", err)
+	}
+	return config.Config.Labels, nil
+}
+
+func (c *Checker) repository(ref kube.ImageRef) *oci.Repository {
+	if ref.Registry == c.opts.Registry {
+		return c.private.Repository(ref)
+	}
+	return c.public.Repository(ref)
+}
+
+// base reports whether an image is built on b: whether its layers start with
+// all of b's
+func (b *image) base(img *image) bool {
+	return len(b.layers) > 0 && len(b.layers) <= len(img.layers) && slices.Equal(b.layers, img.layers[:len(b.layers)])
+}
+
+// newestTag is the tag naming the newest image of a base
+func newestTag(base kube.ImageRef) string {
+	if base.Tag == "" {
+		return "latest"
+	}
+	return base.Tag
+}
+
+// baseName is a base as reported, with the tag naming its newest image
+func baseName(base kube.ImageRef) string {
+	return kube.ImageRef{Registry: base.Registry, Repository: base.Repository, Tag: newestTag(base)}.String()
+}
+
+// compareVersions orders tags such as 9.3-1475 and 9.3-1612 by comparing
+// their runs of digits as numbers and anything else as text
+func compareVersions(a, b string) int {
+	for a != "" && b != "" {
+		ca, restA := leadingRun(a)
+		cb, restB := leadingRun(b)
+		na, errA := strconv.Atoi(ca)
+		nb, errB := strconv.Atoi(cb)
+		switch {
+		case errA == nil && errB == nil && na != nb:
+			if na < nb {
+				return -1
+			}
+			return 1
+		case (errA != nil || errB != nil) && ca != cb:
+			return strings.Compare(ca, cb)
+		}
+		a, b = restA, restB
+	}
+	return strings.Compare(a, b)
+}
+
+// leadingRun splits off the leading run of digits, or of anything else
+func leadingRun(s string) (string, string) {
+	digit := unicode.IsDigit(rune(s[0]))
+	for i, r := range s {
+		if unicode.IsDigit(r) != digit {
+			return s[:i], s[i:]
+		}
+	}
+	return s, ""
+}
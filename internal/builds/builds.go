@@ -0,0 +1,49 @@
+// Package builds finds the build that produced an image in the build
+// systems images are built with: Konflux PipelineRuns and OSBS builds
+// recorded in Koji
+package builds
+
+import (
+	"context"
+	"time"
+
+	"OpTrack/internal/registry"
+)
+
+// lookupTimeout bounds finding one image's build in one build system
+const lookupTimeout = 30 * time.Second
+
+// System is a build system that may have built an image
+type System interface {
+	Find(ctx context.Context, operator, digest string, labels map[string]string) (*registry.Build, error)
+}
+
+// Chain asks each build system in turn, and reports the first build found.
+// It is a registry.BuildLookup.
+type Chain []System
+
+func (c Chain) Build(operator, digest string, labels map[string]string) (*registry.Build, error) {
+	var firstErr error
+	for _, system := range c {
+		ctx, cancel := context.WithTimeout(context.Background(), lookupTimeout)
+		build, err := system.Find(ctx, operator, digest, labels)
+		cancel()
+		switch {
+		case err != nil && firstErr == nil:
+			firstErr = err
+		case build != nil:
+			return build, nil
+		}
+	}
+	return nil, firstErr
+}
+
+// nvr is the name-version-release of an image from its labels, as OSBS
+// sets them, or "" when a label is missing
+func nvr(labels map[string]string) string {
+	name, version, release := labels["com.redhat.component"], labels["version"], labels["release"]
+	if name == "" || version == "" || release == "" {
+		return ""
+	}
+	return name + "-" + version + "-" + release
+}
@@ -0,0 +1,79 @@
+package builds
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"time"
+
+	"OpTrack/internal/kube"
+	"OpTrack/internal/registry"
+)
+
+// konfluxBuildSelector selects the build PipelineRuns of Konflux components
+const konfluxBuildSelector = "pipelines.appstudio.openshift.io/type=build"
+
+// Konflux finds the build PipelineRun whose IMAGE_DIGEST result is the image
+type Konflux struct {
+	client     *kube.Client
+	namespaces []string // Tenant namespaces
+}
+
+func NewKonflux(client *kube.Client, namespaces []string) *Konflux {
+	return &Konflux{client: client, namespaces: namespaces}
+}
+
+// konfluxPipelineRun is the part of a build PipelineRun OpTrack reads
+type konfluxPipelineRun struct {
+	Metadata kube.ObjectMeta `json:"metadata"`
+	Status   struct {
+		CompletionTime *time.Time     `json:"completionTime"`
+		Results        []tektonResult `json:"results"`         // tekton.dev/v1
+		PipelineResult []tektonResult `json:"pipelineResults"` // tekton.dev/v1beta1
+	} `json:"status"`
+}
+
+type tektonResult struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+func (k *Konflux) Find(ctx context.Context, operator, digest string, labels map[string]string) (*registry.Build, error) {
+	query := url.Values{"labelSelector": {konfluxBuildSelector}}
+	for _, ns := range k.namespaces {
+		runs, err := kube.List[konfluxPipelineRun](ctx, k.client, "/apis/tekton.dev/v1/namespaces/"+ns+"/pipelineruns", query)
+		if errors.Is(err, kube.ErrNotFound) {
+			runs, err = kube.List[konfluxPipelineRun](ctx, k.client, "/apis/tekton.dev/v1beta1/namespaces/"+ns+"/pipelineruns", query)
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, run := range runs {
+			if !run.built(digest) {
+				continue
+			}
+			build := &registry.Build{
+				System:    "konflux",
+				ID:        ns + "/" + run.Metadata.Name,
+				NVR:       nvr(labels),
+				Component: run.Metadata.Labels["appstudio.openshift.io/component"],
+				Pipeline:  run.Metadata.Labels["tekton.dev/pipeline"],
+				Completed: run.Status.CompletionTime,
+			}
+			return build, nil
+		}
+	}
+	return nil, nil
+}
+
+// built reports whether the run pushed the image with the sha256 digest
+func (r konfluxPipelineRun) built(digest string) bool {
+	for _, results := range [][]tektonResult{r.Status.Results, r.Status.PipelineResult} {
+		for _, result := range results {
+			if result.Name == "IMAGE_DIGEST" && result.Value == "sha256:"+digest {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,137 @@
+package builds
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"OpTrack/internal/registry"
+)
+
+// OSBS finds an image's build in Koji (or Brew), where OSBS records every
+// container build under the NVR it labels the image with
+type OSBS struct {
+	hub  string // The XML-RPC hub, e.g. https://koji.example.com/kojihub
+	web  string // The web UI for build links, e.g. https://koji.example.com/koji
+	http *http.Client
+}
+
+func NewOSBS(hub, web string, timeout time.Duration) *OSBS {
+	return &OSBS{hub: hub, web: strings.TrimSuffix(web, "/"), http: &http.Client{Timeout: timeout}}
+}
+
+func (o *OSBS) Find(ctx context.Context, operator, digest string, labels map[string]string) (*registry.Build, error) {
+	nvr := nvr(labels)
+	if nvr == "" {
+		return nil, nil // Not an OSBS image, or the registry doesn't report labels
+	}
+	fields, err := o.call(ctx, "getBuild", nvr)
+	if err != nil {
+		return nil, fmt.Errorf("koji getBuild %s: %v", nvr, err)
+	}
+	if fields == nil {
+		return nil, nil
+	}
+	build := &registry.Build{
+		System:    "osbs",
+		ID:        fields["build_id"],
+		NVR:       fields["nvr"],
+		Component: fields["package_name"],
+	}
+	if task := fields["task_id"]; task != "" {
+		build.Pipeline = "task " + task
+	}
+	if ts, err := strconv.ParseFloat(fields["completion_ts"], 64); err == nil && ts > 0 {
+		sec, frac := math.Modf(ts)
+		completed := time.Unix(int64(sec), int64(frac*1e9)).UTC()
+		build.Completed = &completed
+	}
+	if o.web != "" && build.ID != "" {
+		build.URL = o.web + "/buildinfo?buildID=" + build.ID
+	}
+	return build, nil
+}
+
+// xmlValue is an XML-RPC value. Only the scalar members of structs are kept,
+// which is all a Koji build needs.
+type xmlValue struct {
+	Text   string  `xml:",chardata"` // A value without a type is a string
+	String *string `xml:"string"`
+	Int    *string `xml:"int"`
+	I4     *string `xml:"i4"`
+	I8     *string `xml:"i8"`
+	Double *string `xml:"double"`
+	Struct *struct {
+		Members []struct {
+			Name  string   `xml:"name"`
+			Value xmlValue `xml:"value"`
+		} `xml:"member"`
+	} `xml:"struct"`
+}
+
+func (v xmlValue) scalar() string {
+	for _, s := range []*string{v.String, v.Int, v.I4, v.I8, v.Double} {
+		if s != nil {
+			return *s
+		}
+	}
+	return strings.TrimSpace(v.Text)
+}
+
+// call makes an XML-RPC call with one string parameter and returns the
+// scalar members of the struct it answers, or nil when it answers nil
+func (o *OSBS) call(ctx context.Context, method, param string) (map[string]string, error) {
+	var body bytes.Buffer
+	body.WriteString(`<?xml version="1.0"?><methodCall><methodName>` + method + `</methodName><params><param><value><string>`)
+	xml.EscapeText(&body, []byte(param))
+	body.WriteString(`</string></value></param></params></methodCall>`)
+
+	req, err := http.NewRequestWithContext(ctx, "POST", o.hub, &body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "text/xml")
+	resp, err := o.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned %d", o.hub, resp.StatusCode)
+	}
+
+	var out struct {
+		Params []struct {
+			Value xmlValue `xml:"value"`
+		} `xml:"params>param"`
+		Fault *struct {
+			Value xmlValue `xml:"value"`
+		} `xml:"fault"`
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("invalid response: %v", err)
+	}
+	if out.Fault != nil {
+		return nil, fmt.Errorf("fault: %s", members(out.Fault.Value)["faultString"])
+	}
+	if len(out.Params) == 0 || out.Params[0].Value.Struct == nil {
+		return nil, nil
+	}
+	return members(out.Params[0].Value), nil
+}
+
+func members(v xmlValue) map[string]string {
+	m := make(map[string]string)
+	if v.Struct != nil {
+		for _, member := range v.Struct.Members {
+			m[member.Name] = member.Value.scalar()
+		}
+	}
+	return m
+}
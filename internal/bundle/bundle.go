@@ -0,0 +1,109 @@
+// Package bundle pulls operator bundle images from container registries and
+// reads the ClusterServiceVersion they ship
+package bundle
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"OpTrack/internal/kube"
+	"OpTrack/internal/oci"
+)
+
+// ErrNoCSV is returned for bundle images without a ClusterServiceVersion
+var ErrNoCSV = errors.New("no ClusterServiceVersion in the bundle image")
+
+// maxLayerBytes bounds the bundle layers read. Bundles are a few manifests;
+// anything bigger is not a bundle.
+const maxLayerBytes = 64 << 20
+
+// Client pulls bundle images
+type Client struct {
+	oci *oci.Client
+}
+
+func NewClient(client *oci.Client) *Client {
+	return &Client{oci: client}
+}
+
+// CSV returns the ClusterServiceVersion manifest in a bundle image such as
+// quay.io/app-sre/foo-bundle:v1.2.3
+func (c *Client) CSV(ctx context.Context, image string) ([]byte, error) {
+	ref := kube.ParseImage(image)
+	repo := c.oci.Repository(ref)
+	m, err := repo.Manifest(ctx, oci.Reference(ref))
+	if err != nil {
+		return nil, err
+	}
+	if len(m.Manifests) > 0 {
+		// Bundles are platform independent; take linux/amd64 when there is a choice
+		digest := m.Manifests[0].Digest
+		for _, d := range m.Manifests {
+			if d.Platform.OS == "linux" && d.Platform.Architecture == "amd64" {
+				digest = d.Digest
+			}
+		}
+		if m, err = repo.Manifest(ctx, digest); err != nil {
+			return nil, err
+		}
+	}
+	// Later layers win, as they would in the image's filesystem
+	for i := len(m.Layers) - 1; i >= 0; i-- {
+		csv, err := findCSV(ctx, repo, m.Layers[i])
+		if err != nil {
+			return nil, fmt.Errorf("layer %s: %v", m.Layers[i].Digest, err)
+		}
+		if csv != nil {
+			return csv, nil
+		}
+	}
+	return nil, ErrNoCSV
+}
+
+// findCSV returns the ClusterServiceVersion in a layer, or nil
+func findCSV(ctx context.Context, repo *oci.Repository, layer oci.Descriptor) ([]byte, error) {
+	blob, err := repo.Blob(ctx, layer.Digest)
+	if err != nil {
+		return nil, err
+	}
+	defer blob.Close()
+
+	body := bufio.NewReader(io.LimitReader(blob, maxLayerBytes))
+	var in io.Reader = body
+	if magic, _ := body.Peek(2); bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		in = gz
+	}
+	tr := tar.NewReader(in)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		name := strings.TrimPrefix(path.Clean("/"+hdr.Name), "/")
+		if hdr.Typeflag != tar.TypeReg || path.Dir(name) != "manifests" || !isCSVName(path.Base(name)) {
+			continue
+		}
+		return io.ReadAll(tr)
+	}
+}
+
+// isCSVName matches the file names operator-sdk and opm give CSVs
+func isCSVName(name string) bool {
+	return strings.HasSuffix(name, ".clusterserviceversion.yaml") || strings.HasSuffix(name, ".clusterserviceversion.yml")
+}
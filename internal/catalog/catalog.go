@@ -0,0 +1,237 @@
+// Package catalog compares the operator bundles published in OLM catalogs
+// with the latest image of each operator on the registry
+package catalog
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"OpTrack/internal/clock"
+	"OpTrack/internal/registry"
+)
+
+// ErrNoCatalogs is returned when a catalog comparison is asked for but no
+// catalogs are configured
+var ErrNoCatalogs = errors.New("no catalogs configured")
+
+// States of an operator in a catalog
+const (
+	StateCurrent      = "current"       // The newest bundle using the operator references the latest image
+	StateBehind       = "behind"        // The newest bundle references an older image: built but not published
+	StateNotPublished = "not_published" // No bundle in the catalog uses the operator
+	StateUnknown      = "unknown"       // The catalog or registry couldn't be read, or the bundle references a tag
+)
+
+// Source is a file-based catalog: an http(s) URL, a file or a directory
+type Source struct {
+	Name     string
+	Location string
+}
+
+// Registry looks up the latest image of operators
+type Registry interface {
+	GetStatuses(operators []string) []registry.Status
+}
+
+// Result is the state of one operator in one catalog
+type Result struct {
+	Catalog  string   `json:"catalog"`
+	Operator string   `json:"operator"`
+	State    string   `json:"state"`
+	Latest   string   `json:"latest,omitempty"`  // sha256 of the latest image on the registry
+	Package  string   `json:"package,omitempty"` // The newest bundle using the operator
+	Bundle   string   `json:"bundle,omitempty"`
+	Version  string   `json:"version,omitempty"`
+	Channels []string `json:"channels,omitempty"`
+	Image    string   `json:"image,omitempty"`  // The operator's image as the bundle references it
+	Digest   string   `json:"digest,omitempty"` // Empty when the bundle references a tag
+	// Published is how many bundles in the catalog use the operator
+	Published int    `json:"published,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// DefaultTTL is how long a catalog is reused before it is read again
+const DefaultTTL = 10 * time.Minute
+
+// Monitor checks operators against catalogs. Catalogs are large and change
+// slowly, so each is read at most once per TTL.
+type Monitor struct {
+	sources  []Source
+	registry Registry
+	clock    clock.Clock
+	ttl      time.Duration
+
+	indexes map[string]*cached // By catalog name, fixed after New
+}
+
+type cached struct {
+	mu      sync.Mutex
+	fetched time.Time
+	index   *Index
+	err     error
+}
+
+func New(sources []Source, reg Registry, clk clock.Clock, ttl time.Duration) *Monitor {
+	m := &Monitor{sources: sources, registry: reg, clock: clock.Or(clk), ttl: ttl, indexes: make(map[string]*cached)}
+	for _, s := range sources {
+		m.indexes[s.Name] = &cached{}
+	}
+	return m
+}
+
+// Catalogs returns the names of the catalogs checked
+func (m *Monitor) Catalogs() []string {
+	names := make([]string, len(m.sources))
+	for i, s := range m.sources {
+		names[i] = s.Name
+	}
+	return names
+}
+
+// Check reports the state of every operator in every catalog, ordered by
+// catalog and then by operator as given
+func (m *Monitor) Check(ctx context.Context, operators []string) []Result {
+	return m.CheckStatuses(ctx, m.registry.GetStatuses(operators))
+}
+
+// CheckStatuses is Check for operators whose latest images were already looked up
+func (m *Monitor) CheckStatuses(ctx context.Context, statuses []registry.Status) []Result {
+	indexes := make([]*Index, len(m.sources))
+	errs := make([]error, len(m.sources))
+	var wg sync.WaitGroup
+	for i, s := range m.sources {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			indexes[i], errs[i] = m.index(ctx, s)
+		}()
+	}
+	wg.Wait()
+
+	var results []Result
+	for i, s := range m.sources {
+		for _, status := range statuses {
+			results = append(results, compare(s.Name, status, indexes[i], errs[i]))
+		}
+	}
+	return results
+}
+
+// index returns a catalog's index, reading it again once it is older than
+// the TTL. Failures are cached too.
+func (m *Monitor) index(ctx context.Context, s Source) (*Index, error) {
+	c := m.indexes[s.Name]
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := m.clock.Now()
+	if c.fetched.IsZero() || now.Sub(c.fetched) >= m.ttl {
+		c.index, c.err = load(ctx, s.Location)
+		c.fetched = now
+	}
+	return c.index, c.err
+}
+
+func compare(catalog string, latest registry.Status, idx *Index, err error) Result {
+	res := Result{Catalog: catalog, Operator: latest.Name, State: StateUnknown}
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+
+	var newest *Bundle
+	for _, b := range idx.Bundles {
+		if _, ok := b.uses(latest.Name); !ok {
+			continue
+		}
+		res.Published++
+		if newest == nil || compareVersions(b.Version, newest.Version) > 0 {
+			newest = b
+		}
+	}
+	if newest == nil {
+		res.State = StateNotPublished
+		if latest.Status != "OK" {
+			res.Error = latest.Status
+		}
+		return res
+	}
+	image, _ := newest.uses(latest.Name)
+	res.Package, res.Bundle, res.Version, res.Channels = newest.Package, newest.Name, newest.Version, newest.Channels
+	res.Image, res.Digest = image.String(), image.Digest
+
+	if latest.Status != "OK" {
+		res.Error = latest.Status
+		return res
+	}
+	res.Latest = latest.SHA256
+	switch {
+	case image.Digest == "":
+		res.Error = "the bundle references a tag, not a digest"
+	case image.Digest == latest.SHA256:
+		res.State = StateCurrent
+	default:
+		res.State = StateBehind
+	}
+	return res
+}
+
+// compareVersions orders semantic versions such as 1.2.0 and 1.10.0-rc.1,
+// returning -1, 0 or 1. A release sorts after its prereleases; versions
+// that don't parse sort first.
+func compareVersions(a, b string) int {
+	pa, oka := parseVersion(a)
+	pb, okb := parseVersion(b)
+	switch {
+	case !oka && !okb:
+		return strings.Compare(a, b)
+	case !oka:
+		return -1
+	case !okb:
+		return 1
+	}
+	for i := 0; i < 3; i++ {
+		if pa.numbers[i] != pb.numbers[i] {
+			if pa.numbers[i] < pb.numbers[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	switch {
+	case pa.pre == pb.pre:
+		return 0
+	case pa.pre == "":
+		return 1
+	case pb.pre == "":
+		return -1
+	}
+	return strings.Compare(pa.pre, pb.pre)
+}
+
+type version struct {
+	numbers [3]int
+	pre     string
+}
+
+func parseVersion(s string) (version, bool) {
+	var v version
+	s = strings.TrimPrefix(s, "v")
+	s, _, _ = strings.Cut(s, "+") // Build metadata doesn't order
+	s, v.pre, _ = strings.Cut(s, "-")
+	parts := strings.Split(s, ".")
+	if len(parts) != 3 {
+		return v, false
+	}
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			return v, false
+		}
+		v.numbers[i] = n
+	}
+	return v, true
+}
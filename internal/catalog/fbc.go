@@ -0,0 +1,217 @@
+package catalog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"OpTrack/internal/kube"
+)
+
+// fetchTimeout bounds downloading a catalog, which can be tens of megabytes
+const fetchTimeout = 2 * time.Minute
+
+// Bundle is an operator bundle published in a catalog
+type Bundle struct {
+	Package  string
+	Name     string // The CSV name, e.g. foo.v1.2.0
+	Version  string
+	Image    string          // The bundle image
+	Channels []string        // The channels the bundle is in
+	Related  []kube.ImageRef // The images the bundle's operator uses
+	related  map[string]int  // Repository -> index in Related
+}
+
+// Index is the bundles of a catalog
+type Index struct {
+	Bundles []*Bundle
+}
+
+// meta is one object of a file-based catalog, as written by opm render
+type meta struct {
+	Schema  string `json:"schema"`
+	Name    string `json:"name"`
+	Package string `json:"package"`
+	Image   string `json:"image"`
+	Entries []struct {
+		Name string `json:"name"`
+	} `json:"entries"`
+	Properties []struct {
+		Type  string          `json:"type"`
+		Value json.RawMessage `json:"value"`
+	} `json:"properties"`
+	RelatedImages []struct {
+		Name  string `json:"name"`
+		Image string `json:"image"`
+	} `json:"relatedImages"`
+}
+
+// load reads a file-based catalog from an http(s) URL, a file or a
+// directory of files. JSON files may hold a stream of objects, as written
+// by "opm render -o json"; .yaml and .yml files a stream of documents.
+func load(ctx context.Context, location string) (*Index, error) {
+	var objects []meta
+	add := func(name string, data []byte) error {
+		list, err := parse(name, data)
+		if err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+		objects = append(objects, list...)
+		return nil
+	}
+
+	switch {
+	case strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://"):
+		data, err := fetch(ctx, location)
+		if err != nil {
+			return nil, err
+		}
+		if err := add(location, data); err != nil {
+			return nil, err
+		}
+	default:
+		err := filepath.WalkDir(location, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				return nil
+			}
+			// Files in a directory are catalog files by extension only
+			if ext := filepath.Ext(path); path != location && ext != ".json" && ext != ".yaml" && ext != ".yml" {
+				return nil
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			return add(path, data)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return index(objects), nil
+}
+
+func fetch(ctx context.Context, url string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, fetchTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned %d", url, resp.StatusCode)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// parse decodes the objects of one catalog file
+func parse(name string, data []byte) ([]meta, error) {
+	var objects []meta
+	if ext := filepath.Ext(name); ext == ".yaml" || ext == ".yml" {
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		for {
+			var doc interface{}
+			if err := dec.Decode(&doc); errors.Is(err, io.EOF) {
+				return objects, nil
+			} else if err != nil {
+				return nil, err
+			}
+			if doc == nil {
+				continue
+			}
+			// Go through JSON so both formats share the json field names
+			raw, err := json.Marshal(doc)
+			if err != nil {
+				return nil, err
+			}
+			var m meta
+			if err := json.Unmarshal(raw, &m); err != nil {
+				return nil, err
+			}
+			objects = append(objects, m)
+		}
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	for {
+		var m meta
+		if err := dec.Decode(&m); errors.Is(err, io.EOF) {
+			return objects, nil
+		} else if err != nil {
+			return nil, err
+		}
+		objects = append(objects, m)
+	}
+}
+
+// index puts the bundles of a catalog together with their channels
+func index(objects []meta) *Index {
+	idx := &Index{}
+	byName := make(map[string]*Bundle) // Package + "/" + bundle name
+	for _, m := range objects {
+		if m.Schema != "olm.bundle" {
+			continue
+		}
+		b := &Bundle{Package: m.Package, Name: m.Name, Image: m.Image, related: make(map[string]int)}
+		for _, p := range m.Properties {
+			if p.Type != "olm.package" {
+				continue
+			}
+			var v struct {
+				Version string `json:"version"`
+			}
+			if json.Unmarshal(p.Value, &v) == nil {
+				b.Version = v.Version
+			}
+		}
+		for _, ri := range m.RelatedImages {
+			ref := kube.ParseImage(ri.Image)
+			if _, ok := b.related[ref.Repository]; ok {
+				continue
+			}
+			b.related[ref.Repository] = len(b.Related)
+			b.Related = append(b.Related, ref)
+		}
+		byName[b.Package+"/"+b.Name] = b
+		idx.Bundles = append(idx.Bundles, b)
+	}
+	for _, m := range objects {
+		if m.Schema != "olm.channel" {
+			continue
+		}
+		for _, e := range m.Entries {
+			if b, ok := byName[m.Package+"/"+e.Name]; ok {
+				b.Channels = append(b.Channels, m.Name)
+			}
+		}
+	}
+	return idx
+}
+
+// uses returns the bundle's image of repository
+func (b *Bundle) uses(repository string) (kube.ImageRef, bool) {
+	i, ok := b.related[repository]
+	if !ok {
+		return kube.ImageRef{}, false
+	}
+	return b.Related[i], true
+}
@@ -0,0 +1,164 @@
+// Package ci reads the recent runs of the Jenkins jobs and Tekton pipelines
+// that build operators, so a stale image can be explained by a failing build
+package ci
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"OpTrack/internal/clock"
+)
+
+// ErrNotConfigured is returned when pipelines are asked for but none are configured
+var ErrNotConfigured = errors.New("no build pipelines configured")
+
+// States of a pipeline and of each of its runs
+const (
+	StatePassing = "passing" // The last finished run succeeded
+	StateFailing = "failing" // The last finished run failed or was aborted
+	StateRunning = "running" // A run is in progress
+	StateUnknown = "unknown" // The CI system couldn't be read, or nothing has run yet
+)
+
+// DefaultTTL is how long the runs of a pipeline are reused before they are read again
+const DefaultTTL = 2 * time.Minute
+
+// maxRuns is how many recent runs are read from a pipeline
+const maxRuns = 20
+
+// Run is one run of a pipeline
+type Run struct {
+	Name     string     `json:"name"`             // The Jenkins build number or the PipelineRun name
+	State    string     `json:"state"`            // passing, failing or running
+	Result   string     `json:"result,omitempty"` // As the CI system reports it, e.g. FAILURE or PipelineRunTimeout
+	Started  *time.Time `json:"started,omitempty"`
+	Finished *time.Time `json:"finished,omitempty"`
+	URL      string     `json:"url,omitempty"`
+}
+
+// Pipeline is a build pipeline of an operator
+type Pipeline interface {
+	System() string      // "jenkins" or "tekton"
+	Description() string // The job URL, or namespace and selector of the PipelineRuns
+	// Runs returns the most recent runs, newest first
+	Runs(ctx context.Context) ([]Run, error)
+}
+
+// Result is the state of the pipeline that builds an operator
+type Result struct {
+	Operator string `json:"operator"`
+	System   string `json:"system"`
+	Pipeline string `json:"pipeline"`
+	State    string `json:"state"`
+	Last     *Run   `json:"last,omitempty"` // The newest run, finished or not
+	// FailingSince is when the first of the failing runs in a row finished,
+	// while the last finished run failed, even with a new run in progress
+	FailingSince *time.Time `json:"failingSince,omitempty"`
+	Error        string     `json:"error,omitempty"`
+}
+
+// Monitor reads the pipelines of operators, each at most once per TTL
+type Monitor struct {
+	pipelines map[string]Pipeline // By operator, fixed after New
+	clock     clock.Clock
+	ttl       time.Duration
+
+	runs map[string]*cached // By operator, fixed after New
+}
+
+type cached struct {
+	mu      sync.Mutex
+	fetched time.Time
+	runs    []Run
+	err     error
+}
+
+// New returns a monitor of pipelines, keyed by the operator they build
+func New(pipelines map[string]Pipeline, clk clock.Clock, ttl time.Duration) *Monitor {
+	m := &Monitor{pipelines: pipelines, clock: clock.Or(clk), ttl: ttl, runs: make(map[string]*cached)}
+	for operator := range pipelines {
+		m.runs[operator] = &cached{}
+	}
+	return m
+}
+
+// Check reports the pipeline of every operator that has one, in the order given
+func (m *Monitor) Check(ctx context.Context, operators []string) []Result {
+	results := make([]Result, len(operators))
+	var wg sync.WaitGroup
+	for i, operator := range operators {
+		p, ok := m.pipelines[operator]
+		if !ok {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			runs, err := m.load(ctx, operator, p)
+			results[i] = summarize(Result{Operator: operator, System: p.System(), Pipeline: p.Description()}, runs, err)
+		}()
+	}
+	wg.Wait()
+
+	list := []Result{}
+	for _, r := range results {
+		if r.Operator != "" {
+			list = append(list, r)
+		}
+	}
+	return list
+}
+
+func (m *Monitor) load(ctx context.Context, operator string, p Pipeline) ([]Run, error) {
+	c := m.runs[operator]
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := m.clock.Now()
+	if c.fetched.IsZero() || now.Sub(c.fetched) >= m.ttl {
+		c.runs, c.err = p.Runs(ctx)
+		c.fetched = now
+	}
+	return c.runs, c.err
+}
+
+// summarize judges a pipeline by its newest run, and for a failing pipeline
+// finds when the failures in a row began
+func summarize(res Result, runs []Run, err error) Result {
+	res.State = StateUnknown
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	if len(runs) == 0 {
+		return res
+	}
+	res.Last = &runs[0]
+
+	// A run in progress doesn't end a failure streak, so look past it
+	finished := runs
+	for len(finished) > 0 && finished[0].State == StateRunning {
+		finished = finished[1:]
+	}
+	switch {
+	case runs[0].State == StateRunning:
+		res.State = StateRunning
+	case finished[0].State == StatePassing:
+		res.State = StatePassing
+	default:
+		res.State = StateFailing
+	}
+	for _, run := range finished {
+		if run.State != StateFailing {
+			break
+		}
+		switch {
+		case run.Finished != nil:
+			res.FailingSince = run.Finished
+		case run.Started != nil:
+			res.FailingSince = run.Started
+		}
+	}
+	return res
+}
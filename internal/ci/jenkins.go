@@ -0,0 +1,93 @@
+package ci
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Jenkins is a Jenkins job, read through its JSON API with an optional user
+// and API token
+type Jenkins struct {
+	job   string // The job URL, ending in /
+	user  string
+	token string
+	http  *http.Client
+}
+
+// NewJenkins returns the pipeline of the job at jobURL, such as
+// https://ci.example.com/job/foo-build-master/
+func NewJenkins(jobURL, user, token string, timeout time.Duration) *Jenkins {
+	return &Jenkins{
+		job:   strings.TrimSuffix(jobURL, "/") + "/",
+		user:  user,
+		token: token,
+		http:  &http.Client{Timeout: timeout},
+	}
+}
+
+func (j *Jenkins) System() string      { return "jenkins" }
+func (j *Jenkins) Description() string { return j.job }
+
+// jenkinsBuild is a build as the job's api/json lists it
+type jenkinsBuild struct {
+	Number    int     `json:"number"`
+	Result    *string `json:"result"` // Null while building
+	Building  bool    `json:"building"`
+	Timestamp int64   `json:"timestamp"` // Start, in milliseconds since the epoch
+	Duration  int64   `json:"duration"`  // In milliseconds, 0 while building
+	URL       string  `json:"url"`
+}
+
+func (j *Jenkins) Runs(ctx context.Context) ([]Run, error) {
+	u := j.job + "api/json?tree=builds[number,result,building,timestamp,duration,url]{0," + strconv.Itoa(maxRuns) + "}"
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if j.user != "" || j.token != "" {
+		req.SetBasicAuth(j.user, j.token)
+	}
+	resp, err := j.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned %d", j.job, resp.StatusCode)
+	}
+	var job struct {
+		Builds []jenkinsBuild `json:"builds"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&job); err != nil {
+		return nil, fmt.Errorf("%s: invalid response: %v", j.job, err)
+	}
+
+	runs := make([]Run, 0, len(job.Builds))
+	for _, b := range job.Builds {
+		run := Run{Name: "#" + strconv.Itoa(b.Number), URL: b.URL}
+		if b.Timestamp > 0 {
+			started := time.UnixMilli(b.Timestamp).UTC()
+			run.Started = &started
+			if !b.Building && b.Duration > 0 {
+				finished := started.Add(time.Duration(b.Duration) * time.Millisecond)
+				run.Finished = &finished
+			}
+		}
+		switch {
+		case b.Building || b.Result == nil:
+			run.State = StateRunning
+		case *b.Result == "SUCCESS":
+			run.State, run.Result = StatePassing, *b.Result
+		default: // FAILURE, UNSTABLE, ABORTED, NOT_BUILT
+			run.State, run.Result = StateFailing, *b.Result
+		}
+		runs = append(runs, run)
+	}
+	return runs, nil
+}
@@ -0,0 +1,78 @@
+package ci
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"sort"
+	"time"
+
+	"OpTrack/internal/kube"
+)
+
+// Tekton is the PipelineRuns matching a label selector in a namespace
+type Tekton struct {
+	client    *kube.Client
+	namespace string
+	selector  string // e.g. tekton.dev/pipeline=foo-build
+}
+
+func NewTekton(client *kube.Client, namespace, selector string) *Tekton {
+	return &Tekton{client: client, namespace: namespace, selector: selector}
+}
+
+func (t *Tekton) System() string { return "tekton" }
+
+func (t *Tekton) Description() string {
+	return t.namespace + "/" + t.selector
+}
+
+// pipelineRun is the part of a tekton.dev PipelineRun OpTrack reads
+type pipelineRun struct {
+	Metadata kube.ObjectMeta `json:"metadata"`
+	Status   struct {
+		StartTime      *time.Time `json:"startTime"`
+		CompletionTime *time.Time `json:"completionTime"`
+		Conditions     []struct {
+			Type   string `json:"type"`
+			Status string `json:"status"` // True, False, or Unknown while running
+			Reason string `json:"reason"`
+		} `json:"conditions"`
+	} `json:"status"`
+}
+
+func (t *Tekton) Runs(ctx context.Context) ([]Run, error) {
+	query := url.Values{"labelSelector": {t.selector}}
+	items, err := kube.List[pipelineRun](ctx, t.client, "/apis/tekton.dev/v1/namespaces/"+t.namespace+"/pipelineruns", query)
+	if errors.Is(err, kube.ErrNotFound) {
+		// Tekton Pipelines before 0.44 only serve v1beta1
+		items, err = kube.List[pipelineRun](ctx, t.client, "/apis/tekton.dev/v1beta1/namespaces/"+t.namespace+"/pipelineruns", query)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].Metadata.CreationTimestamp.After(items[j].Metadata.CreationTimestamp)
+	})
+	if len(items) > maxRuns {
+		items = items[:maxRuns]
+	}
+	runs := make([]Run, 0, len(items))
+	for _, pr := range items {
+		run := Run{Name: pr.Metadata.Name, Started: pr.Status.StartTime, Finished: pr.Status.CompletionTime, State: StateRunning}
+		for _, c := range pr.Status.Conditions {
+			if c.Type != "Succeeded" {
+				continue
+			}
+			switch c.Status {
+			case "True":
+				run.State, run.Result = StatePassing, c.Reason
+			case "False":
+				run.State, run.Result = StateFailing, c.Reason
+			}
+		}
+		runs = append(runs, run)
+	}
+	return runs, nil
+}
@@ -0,0 +1,161 @@
+// Package clock gives code the current time through an interface, so
+// freshness rules and schedules can run against a fixed, hand-advanced clock
+// instead of the wall clock
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock tells the time and makes tickers
+type Clock interface {
+	Now() time.Time
+	// NewTicker returns a ticker that sends the time on C every d, like time.NewTicker
+	NewTicker(d time.Duration) *Ticker
+	// NewTimer returns a timer that sends the time on C once d has passed, like time.NewTimer
+	NewTimer(d time.Duration) *Timer
+}
+
+// Ticker delivers ticks from a Clock
+type Ticker struct {
+	C    <-chan time.Time
+	stop func()
+}
+
+// Stop turns the ticker off. It doesn't close C.
+func (t *Ticker) Stop() {
+	t.stop()
+}
+
+// Timer delivers one tick from a Clock
+type Timer struct {
+	C    <-chan time.Time
+	stop func()
+}
+
+// Stop turns the timer off. It doesn't close C.
+func (t *Timer) Stop() {
+	t.stop()
+}
+
+// System is the wall clock
+var System Clock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+func (systemClock) NewTicker(d time.Duration) *Ticker {
+	t := time.NewTicker(d)
+	return &Ticker{C: t.C, stop: t.Stop}
+}
+
+func (systemClock) NewTimer(d time.Duration) *Timer {
+	t := time.NewTimer(d)
+	return &Timer{C: t.C, stop: func() { t.Stop() }}
+}
+
+// Or returns c, or System when c is nil, for optional Clock fields
+func Or(c Clock) Clock {
+	if c == nil {
+		return System
+	}
+	return c
+}
+
+// Fake is a Clock that only moves when told to
+type Fake struct {
+	mu      sync.Mutex
+	now     time.Time
+	tickers []*fakeTicker
+	timers  []*fakeTimer
+}
+
+type fakeTimer struct {
+	when    time.Time
+	c       chan time.Time
+	stopped bool
+}
+
+type fakeTicker struct {
+	period  time.Duration
+	next    time.Time
+	c       chan time.Time
+	stopped bool
+}
+
+// NewFake returns a clock stopped at now
+func NewFake(now time.Time) *Fake {
+	return &Fake{now: now}
+}
+
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+func (f *Fake) NewTicker(d time.Duration) *Ticker {
+	if d <= 0 {
+		panic("clock: non-positive interval for NewTicker")
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	t := &fakeTicker{period: d, next: f.now.Add(d), c: make(chan time.Time, 1)}
+	f.tickers = append(f.tickers, t)
+	return &Ticker{C: t.c, stop: func() {
+		f.mu.Lock()
+		t.stopped = true
+		f.mu.Unlock()
+	}}
+}
+
+func (f *Fake) NewTimer(d time.Duration) *Timer {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	t := &fakeTimer{when: f.now.Add(d), c: make(chan time.Time, 1)}
+	if d <= 0 {
+		t.c <- f.now
+		t.stopped = true
+	} else {
+		f.timers = append(f.timers, t)
+	}
+	return &Timer{C: t.c, stop: func() {
+		f.mu.Lock()
+		t.stopped = true
+		f.mu.Unlock()
+	}}
+}
+
+// Advance moves the clock forward by d and fires the tickers and timers that
+// come due.
+// As with time.Ticker, ticks are dropped for a receiver that falls behind.
+func (f *Fake) Advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.now = f.now.Add(d)
+	for _, t := range f.tickers {
+		for !t.stopped && !t.next.After(f.now) {
+			select {
+			case t.c <- t.next:
+			default:
+			}
+			t.next = t.next.Add(t.period)
+		}
+	}
+	timers := f.timers[:0]
+	for _, t := range f.timers {
+		switch {
+		case t.stopped:
+		case !t.when.After(f.now):
+			t.c <- t.when
+			t.stopped = true
+		default:
+			timers = append(timers, t)
+		}
+	}
+	f.timers = timers
+}
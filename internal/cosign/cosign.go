@@ -0,0 +1,316 @@
+// Package cosign verifies the cosign signatures of images, signatures made
+// with a key pair and keyless signatures whose Fulcio certificate names the
+// identity that signed, and the SLSA provenance attested for them
+package cosign
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"OpTrack/internal/kube"
+	"OpTrack/internal/oci"
+	"OpTrack/internal/registry"
+)
+
+// verifyTimeout bounds reading the signatures of one image
+const verifyTimeout = 30 * time.Second
+
+// maxPayloadBytes bounds the signed payloads read; real ones are a few hundred bytes
+const maxPayloadBytes = 1 << 20
+
+// The annotations cosign puts on the layers of a signature image
+const (
+	signatureAnnotation   = "dev.cosignproject.cosign/signature"
+	certificateAnnotation = "dev.sigstore.cosign/certificate"
+	chainAnnotation       = "dev.sigstore.cosign/chain"
+)
+
+// The Fulcio certificate extensions with the OIDC issuer of the identity,
+// as a raw string and, in newer certificates, as a DER UTF8String
+var (
+	oidIssuer   = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 1}
+	oidIssuerV2 = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 8}
+)
+
+// Key is a trusted public key
+type Key struct {
+	Name   string // Reported as the signer
+	Public crypto.PublicKey
+}
+
+// Identity is a trusted keyless signer: the subject of its certificate, an
+// email address or URI, and the OIDC issuer that vouched for it
+type Identity struct {
+	Subject       string
+	SubjectRegexp *regexp.Regexp // Used instead of Subject when set
+	Issuer        string
+}
+
+func (id Identity) matches(subject, issuer string) bool {
+	if id.Issuer != "" && id.Issuer != issuer {
+		return false
+	}
+	if id.SubjectRegexp != nil {
+		return id.SubjectRegexp.MatchString(subject)
+	}
+	return id.Subject == subject
+}
+
+// Options configures a Verifier
+type Options struct {
+	Registry   string // The registry host operators' images are on, e.g. quay.io
+	Keys       []Key
+	Roots      *x509.CertPool   // The Fulcio roots keyless certificates must chain to
+	Identities []Identity       // Keyless signers trusted; keyless signatures are ignored without any
+	Builders   []*regexp.Regexp // Builder IDs trusted in provenance; any when empty
+}
+
+// Verifier checks images against the trusted keys and identities. It is a
+// registry.SignatureVerifier and a registry.ProvenanceVerifier.
+type Verifier struct {
+	client *oci.Client
+	opts   Options
+}
+
+func NewVerifier(client *oci.Client, opts Options) *Verifier {
+	return &Verifier{client: client, opts: opts}
+}
+
+// payload is what cosign signs
+type payload struct {
+	Critical struct {
+		Image struct {
+			Digest string `json:"docker-manifest-digest"`
+		} `json:"image"`
+		Type string `json:"type"`
+	} `json:"critical"`
+}
+
+// Verify looks for the signatures cosign stores in the sha256-<digest>.sig
+// tag of the operator's repository
+func (v *Verifier) Verify(operator, digest string) (*registry.Signature, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), verifyTimeout)
+	defer cancel()
+
+	repo := v.client.Repository(kube.ImageRef{Registry: v.opts.Registry, Repository: operator})
+	m, err := repo.Manifest(ctx, "sha256-"+digest+".sig")
+	if errors.Is(err, oci.ErrNotFound) {
+		return &registry.Signature{State: registry.Unsigned}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Report why the last signature found doesn't count, if none does
+	var problem error = errors.New("no signatures in the signature image")
+	for _, layer := range m.Layers {
+		sig, err := base64.StdEncoding.DecodeString(layer.Annotations[signatureAnnotation])
+		if err != nil || len(sig) == 0 {
+			continue // Not a signature, e.g. an attestation
+		}
+		data, err := v.payload(ctx, repo, layer)
+		if err != nil {
+			return nil, err
+		}
+		var p payload
+		if err := json.Unmarshal(data, &p); err != nil {
+			problem = fmt.Errorf("invalid signed payload: %v", err)
+			continue
+		}
+		if p.Critical.Image.Digest != "sha256:"+digest {
+			problem = fmt.Errorf("signature is for %s", p.Critical.Image.Digest)
+			continue
+		}
+
+		signer, err := v.verifyLayer(layer, data, sig)
+		if err != nil {
+			problem = err
+			continue
+		}
+		return &registry.Signature{State: registry.Signed, Signer: signer}, nil
+	}
+	return &registry.Signature{State: registry.Invalid, Error: problem.Error()}, nil
+}
+
+// payload reads the signed payload of a layer, checking it is the blob the
+// manifest names
+func (v *Verifier) payload(ctx context.Context, repo *oci.Repository, layer oci.Descriptor) ([]byte, error) {
+	blob, err := repo.Blob(ctx, layer.Digest)
+	if err != nil {
+		return nil, err
+	}
+	defer blob.Close()
+	data, err := io.ReadAll(io.LimitReader(blob, maxPayloadBytes))
+	if err != nil {
+		return nil, err
+	}
+	if sum := sha256.Sum256(data); layer.Digest != fmt.Sprintf("sha256:%x", sum) {
+		return nil, fmt.Errorf("payload %s doesn't match its digest", layer.Digest)
+	}
+	return data, nil
+}
+
+// verifyLayer checks one signature against the trusted keys, or against the
+// certificate of a keyless signature, and returns who signed
+func (v *Verifier) verifyLayer(layer oci.Descriptor, data, sig []byte) (string, error) {
+	cert := layer.Annotations[certificateAnnotation]
+	if cert != "" && len(v.opts.Identities) > 0 {
+		return v.verifyKeyless(cert, layer.Annotations[chainAnnotation], data, sig)
+	}
+	for _, key := range v.opts.Keys {
+		if verifySignature(key.Public, data, sig) {
+			return key.Name, nil
+		}
+	}
+	if cert != "" {
+		return "", errors.New("keyless signature, but no identities are trusted")
+	}
+	return "", errors.New("not signed by a trusted key")
+}
+
+// verifyKeyless checks that a Fulcio certificate chains to the roots, names a
+// trusted identity and holds the key of the signature. The certificate is
+// checked as of when it was issued, as Fulcio certificates expire minutes
+// later; that the signature was made meanwhile isn't checked against a
+// transparency log.
+func (v *Verifier) verifyKeyless(certPEM, chainPEM string, data, sig []byte) (string, error) {
+	certs, err := parseCertificates([]byte(certPEM))
+	if err != nil || len(certs) == 0 {
+		return "", fmt.Errorf("invalid signing certificate: %v", err)
+	}
+	cert := certs[0]
+	intermediates := x509.NewCertPool()
+	if chain, err := parseCertificates([]byte(chainPEM)); err == nil {
+		for _, c := range chain {
+			intermediates.AddCert(c)
+		}
+	}
+	_, err = cert.Verify(x509.VerifyOptions{
+		Roots:         v.opts.Roots,
+		Intermediates: intermediates,
+		CurrentTime:   cert.NotBefore,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	})
+	if err != nil {
+		return "", fmt.Errorf("untrusted signing certificate: %v", err)
+	}
+	if !verifySignature(cert.PublicKey, data, sig) {
+		return "", errors.New("signature doesn't match its certificate")
+	}
+
+	issuer := certIssuer(cert)
+	subjects := append([]string{}, cert.EmailAddresses...)
+	for _, u := range cert.URIs {
+		subjects = append(subjects, u.String())
+	}
+	if len(subjects) == 0 {
+		return "", errors.New("signing certificate names no identity")
+	}
+	for _, subject := range subjects {
+		for _, id := range v.opts.Identities {
+			if id.matches(subject, issuer) {
+				return subject, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("signed by untrusted identity %s (%s)", strings.Join(subjects, ", "), issuer)
+}
+
+// certIssuer returns the OIDC issuer a Fulcio certificate was issued through
+func certIssuer(cert *x509.Certificate) string {
+	for _, ext := range cert.Extensions {
+		switch {
+		case ext.Id.Equal(oidIssuerV2):
+			var s string
+			if _, err := asn1.Unmarshal(ext.Value, &s); err == nil {
+				return s
+			}
+		case ext.Id.Equal(oidIssuer):
+			return string(ext.Value)
+		}
+	}
+	return ""
+}
+
+// verifySignature checks sig over data the way cosign signs with each kind of key
+func verifySignature(key crypto.PublicKey, data, sig []byte) bool {
+	digest := sha256.Sum256(data)
+	switch k := key.(type) {
+	case *ecdsa.PublicKey:
+		return ecdsa.VerifyASN1(k, digest[:], sig)
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(k, crypto.SHA256, digest[:], sig) == nil
+	case ed25519.PublicKey:
+		return ed25519.Verify(k, data, sig)
+	}
+	return false
+}
+
+// ParsePublicKey reads a PEM public key as cosign generate-key-pair writes it
+func ParsePublicKey(data []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM data")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	switch key.(type) {
+	case *ecdsa.PublicKey, *rsa.PublicKey, ed25519.PublicKey:
+		return key, nil
+	}
+	return nil, fmt.Errorf("unsupported %T", key)
+}
+
+// ParseRoots reads PEM certificates into a pool, such as the Fulcio root
+// and intermediate
+func ParseRoots(data []byte) (*x509.CertPool, error) {
+	certs, err := parseCertificates(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("no certificates")
+	}
+	pool := x509.NewCertPool()
+	for _, c := range certs {
+		pool.AddCert(c)
+	}
+	return pool, nil
+}
+
+func parseCertificates(data []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(bytes.TrimSpace(data))
+		if block == nil {
+			return certs, nil
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+}
@@ -0,0 +1,209 @@
+package cosign
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"OpTrack/internal/kube"
+	"OpTrack/internal/oci"
+	"OpTrack/internal/registry"
+)
+
+// The in-toto statements of SLSA provenance, in DSSE envelopes
+const (
+	inTotoPayloadType   = "application/vnd.in-toto+json"
+	provenancePredicate = "https://slsa.dev/provenance/"
+)
+
+// envelope is a DSSE envelope, which cosign stores attestations in
+type envelope struct {
+	PayloadType string `json:"payloadType"`
+	Payload     string `json:"payload"`
+	Signatures  []struct {
+		Sig string `json:"sig"`
+	} `json:"signatures"`
+}
+
+// statement is an in-toto statement with the parts of SLSA provenance
+// predicates, v0.2 and v1, that name the builder and source
+type statement struct {
+	PredicateType string `json:"predicateType"`
+	Subject       []struct {
+		Digest map[string]string `json:"digest"`
+	} `json:"subject"`
+	Predicate struct {
+		// v0.2
+		Builder struct {
+			ID string `json:"id"`
+		} `json:"builder"`
+		Invocation struct {
+			ConfigSource material `json:"configSource"`
+		} `json:"invocation"`
+		Materials []material `json:"materials"`
+
+		// v1
+		BuildDefinition struct {
+			ResolvedDependencies []material `json:"resolvedDependencies"`
+		} `json:"buildDefinition"`
+		RunDetails struct {
+			Builder struct {
+				ID string `json:"id"`
+			} `json:"builder"`
+		} `json:"runDetails"`
+	} `json:"predicate"`
+}
+
+// material is a source of a build, e.g. git+https://github.com/org/repo@refs/heads/main
+type material struct {
+	URI    string            `json:"uri"`
+	Digest map[string]string `json:"digest"`
+}
+
+// Provenance looks for SLSA provenance in the attestations cosign stores in
+// the sha256-<digest>.att tag of the operator's repository. Provenance counts
+// when it is signed by a trusted key or identity, is about the image and,
+// when builders are listed, names a trusted builder.
+func (v *Verifier) Provenance(operator, digest string) (*registry.Provenance, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), verifyTimeout)
+	defer cancel()
+
+	repo := v.client.Repository(kube.ImageRef{Registry: v.opts.Registry, Repository: operator})
+	m, err := repo.Manifest(ctx, "sha256-"+digest+".att")
+	if errors.Is(err, oci.ErrNotFound) {
+		return &registry.Provenance{State: registry.Missing}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Report why the last provenance found doesn't count, if none does
+	var problem error
+	for _, layer := range m.Layers {
+		data, err := v.payload(ctx, repo, layer)
+		if err != nil {
+			return nil, err
+		}
+		var env envelope
+		if err := json.Unmarshal(data, &env); err != nil || env.PayloadType != inTotoPayloadType {
+			continue // Not an attestation cosign made
+		}
+		body, err := base64.StdEncoding.DecodeString(env.Payload)
+		if err != nil {
+			problem = fmt.Errorf("invalid attestation payload: %v", err)
+			continue
+		}
+		var st statement
+		if err := json.Unmarshal(body, &st); err != nil {
+			problem = fmt.Errorf("invalid in-toto statement: %v", err)
+			continue
+		}
+		if !strings.HasPrefix(st.PredicateType, provenancePredicate) {
+			continue // Another kind of attestation, e.g. an SBOM
+		}
+		p := provenance(st)
+		if !st.about(digest) {
+			problem = errors.New("provenance is about another image")
+			continue
+		}
+
+		signer, err := v.verifyEnvelope(layer, env.PayloadType, body, env)
+		if err != nil {
+			problem = err
+			continue
+		}
+		p.Signer = signer
+		if !v.trustedBuilder(p.Builder) {
+			problem = fmt.Errorf("built by untrusted builder %s", p.Builder)
+			continue
+		}
+		p.State = registry.Verified
+		return p, nil
+	}
+	if problem == nil {
+		return &registry.Provenance{State: registry.Missing}, nil
+	}
+	return &registry.Provenance{State: registry.Invalid, Error: problem.Error()}, nil
+}
+
+// verifyEnvelope checks the signatures of a DSSE envelope, made over its
+// pre-authentication encoding, and returns who signed
+func (v *Verifier) verifyEnvelope(layer oci.Descriptor, payloadType string, body []byte, env envelope) (string, error) {
+	pae := fmt.Sprintf("DSSEv1 %d %s %d %s", len(payloadType), payloadType, len(body), body)
+	err := errors.New("attestation isn't signed")
+	for _, s := range env.Signatures {
+		sig, decodeErr := base64.StdEncoding.DecodeString(s.Sig)
+		if decodeErr != nil {
+			continue
+		}
+		var signer string
+		if signer, err = v.verifyLayer(layer, []byte(pae), sig); err == nil {
+			return signer, nil
+		}
+	}
+	return "", err
+}
+
+// trustedBuilder reports whether a builder ID matches Options.Builders, or
+// whether any builder is trusted when none are listed
+func (v *Verifier) trustedBuilder(id string) bool {
+	if len(v.opts.Builders) == 0 {
+		return true
+	}
+	for _, re := range v.opts.Builders {
+		if re.MatchString(id) {
+			return true
+		}
+	}
+	return false
+}
+
+// about reports whether the statement's subjects include the image
+func (st statement) about(digest string) bool {
+	for _, s := range st.Subject {
+		if s.Digest["sha256"] == digest {
+			return true
+		}
+	}
+	return false
+}
+
+// trimRef drops the @ref a git URI may end with, keeping the user of
+// ssh://git@host/repo
+func trimRef(uri string) string {
+	path := strings.Index(uri, "://") + 3
+	if slash := strings.Index(uri[path:], "/"); slash >= 0 {
+		path += slash
+	}
+	if at := strings.LastIndex(uri, "@"); at > path {
+		return uri[:at]
+	}
+	return uri
+}
+
+// provenance reads the builder and the source repository and commit out of
+// SLSA provenance: for v0.2 the config source, else the first git material;
+// for v1 the first git dependency
+func provenance(st statement) *registry.Provenance {
+	p := &registry.Provenance{PredicateType: st.PredicateType, Builder: st.Predicate.Builder.ID}
+	sources := append([]material{st.Predicate.Invocation.ConfigSource}, st.Predicate.Materials...)
+	if p.Builder == "" {
+		p.Builder = st.Predicate.RunDetails.Builder.ID
+		sources = st.Predicate.BuildDefinition.ResolvedDependencies
+	}
+	for _, m := range sources {
+		if !strings.HasPrefix(m.URI, "git+") {
+			continue
+		}
+		p.Source = trimRef(strings.TrimPrefix(m.URI, "git+"))
+		p.Revision = m.Digest["sha1"]
+		if p.Revision == "" {
+			p.Revision = m.Digest["gitCommit"]
+		}
+		break
+	}
+	return p
+}
@@ -0,0 +1,104 @@
+// Package cve tells whether the latest images of operators still have the
+// CVEs a ticket is about, from their vulnerability scans
+package cve
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"OpTrack/internal/registry"
+)
+
+// ErrInvalid is returned for IDs that aren't CVE IDs
+var ErrInvalid = errors.New("invalid CVE ID, expected CVE-YYYY-NNNN")
+
+// idPattern matches a CVE ID, CVE-2024-3094
+var idPattern = regexp.MustCompile(`^CVE-\d{4}-\d{4,}$`)
+
+// Fix states of a CVE in the latest image of an operator
+const (
+	Fixed     = "fixed"     // The last scan of the latest image didn't find it
+	Affected  = "affected"  // The last scan of the latest image found it
+	Unscanned = "unscanned" // The latest image hasn't been scanned
+)
+
+// Normalize upper-cases and deduplicates CVE IDs, failing with ErrInvalid
+// naming those that aren't CVE IDs
+func Normalize(ids []string) ([]string, error) {
+	var normalized, invalid []string
+	for _, id := range ids {
+		id = strings.ToUpper(strings.TrimSpace(id))
+		switch {
+		case !idPattern.MatchString(id):
+			invalid = append(invalid, id)
+		case !slices.Contains(normalized, id):
+			normalized = append(normalized, id)
+		}
+	}
+	if len(invalid) > 0 {
+		return nil, fmt.Errorf("%w: %s", ErrInvalid, strings.Join(invalid, ", "))
+	}
+	return normalized, nil
+}
+
+// Result is whether the latest image of an operator still has each CVE
+type Result struct {
+	Operator string      `json:"operator"`
+	Latest   string      `json:"latest,omitempty"`  // sha256 of the latest image
+	Scanned  *time.Time  `json:"scanned,omitempty"` // When the latest image was scanned
+	Fixed    bool        `json:"fixed"`             // Every CVE is fixed
+	CVEs     []CVEStatus `json:"cves"`
+	Error    string      `json:"error,omitempty"` // Why the latest image couldn't be determined
+}
+
+// CVEStatus is whether a CVE is in an image, with the package it was found
+// in when it is among the scan's findings
+type CVEStatus struct {
+	ID           string `json:"id"`
+	State        string `json:"state"` // One of the fix states
+	Package      string `json:"package,omitempty"`
+	Version      string `json:"version,omitempty"`
+	FixedVersion string `json:"fixedVersion,omitempty"`
+}
+
+// Check cross-references the CVEs with the scan of the latest image of each
+// operator
+func Check(statuses []registry.Status, cves []string) []Result {
+	results := make([]Result, 0, len(statuses))
+	for _, status := range statuses {
+		result := Result{Operator: status.Name, CVEs: []CVEStatus{}}
+		switch {
+		case status.Status != "OK":
+			result.Error = status.Status
+		case status.Scan != nil:
+			result.Latest = status.SHA256
+			result.Scanned = &status.Scan.Completed
+		default:
+			result.Latest = status.SHA256
+		}
+		result.Fixed = result.Scanned != nil
+		for _, id := range cves {
+			cs := CVEStatus{ID: id, State: Unscanned}
+			if result.Scanned != nil {
+				cs.State = Fixed
+				if slices.Contains(status.Scan.IDs, id) {
+					cs.State = Affected
+					result.Fixed = false
+				}
+				for _, f := range status.Scan.Findings {
+					if f.ID == id {
+						cs.Package, cs.Version, cs.FixedVersion = f.Package, f.Version, f.FixedVersion
+						break
+					}
+				}
+			}
+			result.CVEs = append(result.CVEs, cs)
+		}
+		results = append(results, result)
+	}
+	return results
+}
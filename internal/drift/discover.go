@@ -0,0 +1,77 @@
+package drift
+
+import (
+	"context"
+	"sort"
+	"strings"
+)
+
+// DefaultRegistry is the registry discovered images are tracked on unless
+// others are given
+const DefaultRegistry = "quay.io"
+
+// Discovery is the operators running in the clusters' namespaces, ready to
+// be put on a ticket
+type Discovery struct {
+	Operators []string          `json:"operators"` // Sorted
+	Workloads []Discovered      `json:"workloads"`
+	Errors    map[string]string `json:"errors,omitempty"` // By cluster, for clusters that couldn't be read
+}
+
+// Discovered is a workload running an image of an operator
+type Discovered struct {
+	Operator  string `json:"operator"`
+	Cluster   string `json:"cluster"`
+	Namespace string `json:"namespace"`
+	Kind      string `json:"kind"` // "Deployment" or "ClusterServiceVersion"
+	Name      string `json:"name"`
+	Container string `json:"container"`
+	Image     string `json:"image"`
+}
+
+// Discover lists the Deployments and OLM CSVs in the clusters' namespaces
+// whose images are on one of registries, DefaultRegistry when none are
+// given, and the namespace/repository operators those images come from
+func (m *Monitor) Discover(ctx context.Context, registries []string) *Discovery {
+	if len(registries) == 0 {
+		registries = []string{DefaultRegistry}
+	}
+	allowed := make(map[string]bool)
+	for _, r := range registries {
+		allowed[r] = true
+	}
+
+	d := &Discovery{Operators: []string{}, Workloads: []Discovered{}}
+	found := make(map[string]bool)
+	inventories, errs := m.inventoryAll(ctx)
+	for i, c := range m.clusters {
+		if errs[i] != nil {
+			if d.Errors == nil {
+				d.Errors = make(map[string]string)
+			}
+			d.Errors[c.Name] = errs[i].Error()
+			continue
+		}
+		for _, w := range inventories[i].Workloads {
+			if !allowed[w.Image.Registry] || strings.Count(w.Image.Repository, "/") != 1 {
+				continue
+			}
+			operator := strings.ToLower(w.Image.Repository)
+			d.Workloads = append(d.Workloads, Discovered{
+				Operator:  operator,
+				Cluster:   c.Name,
+				Namespace: w.Namespace,
+				Kind:      w.Kind,
+				Name:      w.Name,
+				Container: w.Container,
+				Image:     w.Image.String(),
+			})
+			if !found[operator] {
+				found[operator] = true
+				d.Operators = append(d.Operators, operator)
+			}
+		}
+	}
+	sort.Strings(d.Operators)
+	return d
+}
@@ -0,0 +1,240 @@
+// Package drift compares the images running on clusters with the latest
+// image of each operator on the registry
+package drift
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"OpTrack/internal/clock"
+	"OpTrack/internal/kube"
+	"OpTrack/internal/registry"
+)
+
+// ErrNoClusters is returned when drift is asked for but no clusters are configured
+var ErrNoClusters = errors.New("no clusters configured")
+
+// States of an operator on a cluster
+const (
+	StateCurrent     = "current"      // Some workload runs the latest image
+	StateOutdated    = "outdated"     // Workloads run the operator, none of them the latest image
+	StateNotDeployed = "not_deployed" // No workload in the watched namespaces uses the operator
+	StateUnknown     = "unknown"      // The cluster or registry couldn't be read, or no running digest is known
+)
+
+// Cluster is a cluster whose namespaces are inspected
+type Cluster struct {
+	Name       string
+	Labels     map[string]string
+	Client     *kube.Client
+	Namespaces []string
+}
+
+// Registry looks up the latest image of operators
+type Registry interface {
+	GetStatuses(operators []string) []registry.Status
+}
+
+// Result is the state of one operator on one cluster
+type Result struct {
+	Cluster  string            `json:"cluster"`
+	Labels   map[string]string `json:"labels,omitempty"` // The cluster's labels
+	Operator string            `json:"operator"`
+	State    string            `json:"state"`
+	Latest   string            `json:"latest,omitempty"` // sha256 of the latest image on the registry
+	Running  []Running         `json:"running,omitempty"`
+	// Installed are the OLM installations whose CSV uses the operator's image
+	Installed []Installed `json:"installed,omitempty"`
+	Error     string      `json:"error,omitempty"`
+}
+
+// Installed is an operator installed by OLM: its CSV and, when a
+// Subscription installed it, the package and channel it follows
+type Installed struct {
+	Namespace    string `json:"namespace"`
+	CSV          string `json:"csv"`
+	Version      string `json:"version,omitempty"`
+	Phase        string `json:"phase,omitempty"`
+	Subscription string `json:"subscription,omitempty"`
+	Package      string `json:"package,omitempty"`
+	Channel      string `json:"channel,omitempty"`
+	Source       string `json:"source,omitempty"`
+	State        string `json:"state,omitempty"`      // The subscription's state, e.g. AtLatestKnown or UpgradePending
+	CurrentCSV   string `json:"currentCSV,omitempty"` // The CSV the subscription upgrades to, when not yet installed
+}
+
+// Running is a workload that uses an operator's image
+type Running struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Container string `json:"container"`
+	Image     string `json:"image"`            // The image reference of the workload
+	Digest    string `json:"digest,omitempty"` // Empty when it can't be told from the cluster
+}
+
+// Monitor checks operators against clusters. Cluster inventories are reused
+// for TTL so that a page of tickets doesn't list every namespace per ticket.
+type Monitor struct {
+	clusters []Cluster
+	registry Registry
+	clock    clock.Clock
+	ttl      time.Duration
+
+	inventories map[string]*inventory // By cluster name, fixed after New
+}
+
+type inventory struct {
+	mu      sync.Mutex
+	fetched time.Time
+	found   *kube.Inventory
+	err     error
+}
+
+// DefaultTTL is how long a cluster's inventory is reused
+const DefaultTTL = time.Minute
+
+func New(clusters []Cluster, reg Registry, clk clock.Clock, ttl time.Duration) *Monitor {
+	m := &Monitor{clusters: clusters, registry: reg, clock: clock.Or(clk), ttl: ttl, inventories: make(map[string]*inventory)}
+	for _, c := range clusters {
+		m.inventories[c.Name] = &inventory{}
+	}
+	return m
+}
+
+// Clusters returns the names of the clusters checked
+func (m *Monitor) Clusters() []string {
+	names := make([]string, len(m.clusters))
+	for i, c := range m.clusters {
+		names[i] = c.Name
+	}
+	return names
+}
+
+// Check reports the state of every operator on every cluster, ordered by
+// cluster and then by operator as given
+func (m *Monitor) Check(ctx context.Context, operators []string) []Result {
+	return m.CheckStatuses(ctx, m.registry.GetStatuses(operators))
+}
+
+// CheckStatuses is Check for operators whose latest images were already looked up
+func (m *Monitor) CheckStatuses(ctx context.Context, statuses []registry.Status) []Result {
+	inventories, errs := m.inventoryAll(ctx)
+	var results []Result
+	for i, c := range m.clusters {
+		for _, status := range statuses {
+			res := compare(c.Name, status.Name, status, inventories[i], errs[i])
+			res.Labels = c.Labels
+			results = append(results, res)
+		}
+	}
+	return results
+}
+
+// inventoryAll returns the inventory of every cluster, in order, reading
+// them concurrently
+func (m *Monitor) inventoryAll(ctx context.Context) ([]*kube.Inventory, []error) {
+	inventories := make([]*kube.Inventory, len(m.clusters))
+	errs := make([]error, len(m.clusters))
+	var wg sync.WaitGroup
+	for i, c := range m.clusters {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			inventories[i], errs[i] = m.inventory(ctx, c)
+		}()
+	}
+	wg.Wait()
+	return inventories, errs
+}
+
+// inventory returns a cluster's inventory, listing it again once it is older
+// than the TTL. Failures are cached too, so an unreachable cluster costs one
+// timeout per TTL rather than one per request.
+func (m *Monitor) inventory(ctx context.Context, c Cluster) (*kube.Inventory, error) {
+	inv := m.inventories[c.Name]
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	now := m.clock.Now()
+	if inv.fetched.IsZero() || now.Sub(inv.fetched) >= m.ttl {
+		inv.found, inv.err = c.Client.Inventory(ctx, c.Namespaces)
+		inv.fetched = now
+	}
+	return inv.found, inv.err
+}
+
+func compare(cluster, operator string, latest registry.Status, inv *kube.Inventory, err error) Result {
+	res := Result{Cluster: cluster, Operator: operator, State: StateUnknown}
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+
+	for _, in := range inv.Installations {
+		if usesRepository(in.Images, operator) {
+			res.Installed = append(res.Installed, Installed{
+				Namespace: in.Namespace, CSV: in.CSV, Version: in.Version, Phase: in.Phase,
+				Subscription: in.Subscription, Package: in.Package, Channel: in.Channel, Source: in.Source,
+				State: in.State, CurrentCSV: in.CurrentCSV,
+			})
+		}
+	}
+	for _, w := range inv.Workloads {
+		if w.Image.Repository != operator {
+			continue
+		}
+		res.Running = append(res.Running, Running{Kind: w.Kind, Namespace: w.Namespace, Name: w.Name, Container: w.Container, Image: w.Image.String(), Digest: w.Digest})
+	}
+	sort.SliceStable(res.Running, func(i, j int) bool {
+		a, b := res.Running[i], res.Running[j]
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		return a.Name < b.Name
+	})
+
+	if latest.Status != "OK" {
+		res.Error = latest.Status
+		if len(res.Running) == 0 {
+			res.State = StateNotDeployed
+		}
+		return res
+	}
+	res.Latest = latest.SHA256
+
+	switch {
+	case len(res.Running) == 0:
+		res.State = StateNotDeployed
+	case anyDigest(res.Running, latest.SHA256):
+		res.State = StateCurrent
+	case anyDigest(res.Running, ""):
+		res.State = StateUnknown
+		res.Error = "running digest unknown: no running pod uses the image and it isn't pinned by digest"
+	default:
+		res.State = StateOutdated
+	}
+	return res
+}
+
+func usesRepository(images []kube.ImageRef, repository string) bool {
+	for _, image := range images {
+		if image.Repository == repository {
+			return true
+		}
+	}
+	return false
+}
+
+// anyDigest reports whether any workload runs digest; "" asks about
+// workloads whose digest isn't known
+func anyDigest(running []Running, digest string) bool {
+	for _, r := range running {
+		if r.Digest == digest {
+			return true
+		}
+	}
+	return false
+}
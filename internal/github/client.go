@@ -0,0 +1,130 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DefaultURL is the API of github.com. GitHub Enterprise serves it under
+// /api/v3 of its own host.
+const DefaultURL = "https://api.github.com"
+
+// errNotFound is returned for repositories, refs and releases GitHub doesn't
+// have, or the token can't see
+var errNotFound = errors.New("not found")
+
+// Client calls the GitHub REST API, with a token if one is given
+type Client struct {
+	url   string
+	token string
+	http  *http.Client
+}
+
+func NewClient(baseURL, token string, timeout time.Duration) *Client {
+	if baseURL == "" {
+		baseURL = DefaultURL
+	}
+	return &Client{url: strings.TrimSuffix(baseURL, "/"), token: token, http: &http.Client{Timeout: timeout}}
+}
+
+// get decodes the response to path, relative to the API URL, into out
+func (c *Client) get(ctx context.Context, path string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.url+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return fmt.Errorf("%s: %w", path, errNotFound)
+	case resp.StatusCode != http.StatusOK:
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		var e struct {
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(body, &e) == nil && e.Message != "" {
+			return fmt.Errorf("GitHub returned %d: %s", resp.StatusCode, e.Message)
+		}
+		return fmt.Errorf("GitHub returned %d", resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("%s: invalid response: %v", path, err)
+	}
+	return nil
+}
+
+// DefaultBranch returns the default branch of repo, given as owner/name
+func (c *Client) DefaultBranch(ctx context.Context, repo string) (string, error) {
+	var r struct {
+		DefaultBranch string `json:"default_branch"`
+	}
+	if err := c.get(ctx, "/repos/"+repo, &r); err != nil {
+		return "", err
+	}
+	return r.DefaultBranch, nil
+}
+
+// Release is a published GitHub release
+type Release struct {
+	Tag       string    `json:"tag_name"`
+	Published time.Time `json:"published_at"`
+}
+
+// LatestRelease returns the latest release of repo, or nil if it has none
+func (c *Client) LatestRelease(ctx context.Context, repo string) (*Release, error) {
+	var r Release
+	err := c.get(ctx, "/repos/"+repo+"/releases/latest", &r)
+	if errors.Is(err, errNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// Commit returns the full SHA of a ref: a branch, a tag or a possibly short SHA
+func (c *Client) Commit(ctx context.Context, repo, ref string) (string, error) {
+	var r struct {
+		SHA string `json:"sha"`
+	}
+	if err := c.get(ctx, "/repos/"+repo+"/commits/"+url.PathEscape(ref), &r); err != nil {
+		return "", err
+	}
+	return r.SHA, nil
+}
+
+// Comparison is how head relates to base
+type Comparison struct {
+	Status   string `json:"status"`    // identical, ahead, behind or diverged: head compared to base
+	AheadBy  int    `json:"ahead_by"`  // Commits in head that base doesn't have
+	BehindBy int    `json:"behind_by"` // Commits in base that head doesn't have
+}
+
+// Compare compares two refs of repo
+func (c *Client) Compare(ctx context.Context, repo, base, head string) (*Comparison, error) {
+	var r Comparison
+	// Only the counts are needed, so skip the commits and files
+	path := "/repos/" + repo + "/compare/" + url.PathEscape(base) + "..." + url.PathEscape(head) + "?per_page=1"
+	if err := c.get(ctx, path, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
@@ -0,0 +1,227 @@
+// Package github resolves the commit the latest image of an operator was
+// built from, and compares it with the head of the source repository's
+// branch and its latest release
+package github
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"sync"
+	"time"
+
+	"OpTrack/internal/clock"
+	"OpTrack/internal/registry"
+)
+
+// ErrNotConfigured is returned when commits are asked for but no source
+// repositories are configured
+var ErrNotConfigured = errors.New("no source repositories configured")
+
+// States of the latest image compared with its repository's branch
+const (
+	StateCurrent  = "current"  // Built from the head of the branch
+	StateBehind   = "behind"   // The branch has commits the image doesn't
+	StateDiverged = "diverged" // Built from a commit that isn't on the branch
+	StateUnknown  = "unknown"  // The commit couldn't be resolved, or GitHub or the registry couldn't be read
+)
+
+// DefaultTTL is how long a comparison is reused before GitHub is asked again
+const DefaultTTL = 5 * time.Minute
+
+// commitLabels are the image labels that name the source commit, in order of preference
+var commitLabels = []string{"vcs-ref", "org.opencontainers.image.revision", "io.openshift.build.commit.id"}
+
+// commitTag matches tags that are a full or abbreviated commit SHA
+var commitTag = regexp.MustCompile(`^[0-9a-f]{7,40}$`)
+
+// Repository is the source repository of an operator
+type Repository struct {
+	Operator string
+	Repo     string // owner/name
+	Branch   string // Defaults to the repository's default branch
+}
+
+// Registry looks up the latest image of operators and its labels
+type Registry interface {
+	GetStatuses(operators []string) []registry.Status
+	ManifestLabels(operator, digest string) (map[string]string, error)
+}
+
+// Result is the latest image of an operator compared with its source repository
+type Result struct {
+	Operator   string `json:"operator"`
+	Repository string `json:"repository"`
+	State      string `json:"state"`
+	Latest     string `json:"latest,omitempty"`     // sha256 of the latest image on the registry
+	Commit     string `json:"commit,omitempty"`     // The commit the image was built from
+	CommitFrom string `json:"commitFrom,omitempty"` // The label, or "tag", it was read from
+	Branch     string `json:"branch,omitempty"`
+	Head       string `json:"head,omitempty"`    // The head commit of the branch
+	Behind     int    `json:"behind"`            // Commits on the branch the image doesn't have
+	Release    string `json:"release,omitempty"` // The tag of the latest release
+	// BehindRelease is how many commits of the latest release the image
+	// doesn't have, and AheadOfRelease how many of its commits aren't released
+	BehindRelease  int        `json:"behindRelease,omitempty"`
+	AheadOfRelease int        `json:"aheadOfRelease,omitempty"`
+	Released       *time.Time `json:"released,omitempty"`
+	Error          string     `json:"error,omitempty"`
+}
+
+// Monitor compares the latest images of operators with their repositories
+type Monitor struct {
+	client   *Client
+	repos    map[string]Repository // By operator, fixed after New
+	registry Registry
+	clock    clock.Clock
+	ttl      time.Duration
+
+	mu      sync.Mutex
+	results map[string]cached // By operator and latest digest
+}
+
+type cached struct {
+	result  Result
+	fetched time.Time
+}
+
+func New(client *Client, repos []Repository, reg Registry, clk clock.Clock, ttl time.Duration) *Monitor {
+	m := &Monitor{client: client, repos: make(map[string]Repository), registry: reg, clock: clock.Or(clk), ttl: ttl, results: make(map[string]cached)}
+	for _, r := range repos {
+		m.repos[r.Operator] = r
+	}
+	return m
+}
+
+// Repositories returns how many operators have a source repository
+func (m *Monitor) Repositories() int {
+	return len(m.repos)
+}
+
+// Check compares every operator that has a source repository, in the order given
+func (m *Monitor) Check(ctx context.Context, operators []string) []Result {
+	var tracked []string
+	for _, operator := range operators {
+		if _, ok := m.repos[operator]; ok {
+			tracked = append(tracked, operator)
+		}
+	}
+	statuses := m.registry.GetStatuses(tracked)
+	results := make([]Result, len(statuses))
+	var wg sync.WaitGroup
+	for i, status := range statuses {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = m.check(ctx, m.repos[status.Name], status)
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+// check compares one operator, reusing a comparison of the same image made within the TTL
+func (m *Monitor) check(ctx context.Context, repo Repository, latest registry.Status) Result {
+	res := Result{Operator: repo.Operator, Repository: repo.Repo, Branch: repo.Branch, State: StateUnknown}
+	if latest.Status != "OK" {
+		res.Error = latest.Status
+		return res
+	}
+	res.Latest = latest.SHA256
+
+	key := repo.Operator + "@" + latest.SHA256
+	now := m.clock.Now()
+	m.mu.Lock()
+	c, ok := m.results[key]
+	m.mu.Unlock()
+	if ok && now.Sub(c.fetched) < m.ttl {
+		return c.result
+	}
+
+	res = m.compare(ctx, res, latest)
+	if res.Error == "" {
+		m.mu.Lock()
+		for k, c := range m.results {
+			if now.Sub(c.fetched) >= m.ttl {
+				delete(m.results, k)
+			}
+		}
+		m.results[key] = cached{result: res, fetched: now}
+		m.mu.Unlock()
+	}
+	return res
+}
+
+func (m *Monitor) compare(ctx context.Context, res Result, latest registry.Status) Result {
+	ref, from, err := m.commit(latest)
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	res.CommitFrom = from
+
+	if res.Branch == "" {
+		if res.Branch, err = m.client.DefaultBranch(ctx, res.Repository); err != nil {
+			res.Error = err.Error()
+			return res
+		}
+	}
+	if res.Commit, err = m.client.Commit(ctx, res.Repository, ref); err != nil {
+		res.Error = "resolving " + ref + ": " + err.Error()
+		return res
+	}
+	if res.Head, err = m.client.Commit(ctx, res.Repository, res.Branch); err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	cmp, err := m.client.Compare(ctx, res.Repository, res.Commit, res.Head)
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	res.Behind = cmp.AheadBy
+	switch cmp.Status {
+	case "identical":
+		res.State = StateCurrent
+	case "ahead":
+		res.State = StateBehind
+	default: // The image has commits the branch doesn't
+		res.State = StateDiverged
+	}
+
+	release, err := m.client.LatestRelease(ctx, res.Repository)
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	if release != nil {
+		res.Release, res.Released = release.Tag, &release.Published
+		cmp, err := m.client.Compare(ctx, res.Repository, res.Commit, release.Tag)
+		if err != nil {
+			res.Error = err.Error()
+			return res
+		}
+		res.BehindRelease, res.AheadOfRelease = cmp.AheadBy, cmp.BehindBy
+	}
+	return res
+}
+
+// commit finds the commit an image was built from in its labels or, failing
+// that, in a tag that looks like a commit SHA
+func (m *Monitor) commit(latest registry.Status) (ref, from string, err error) {
+	labels, err := m.registry.ManifestLabels(latest.Name, latest.SHA256)
+	if err != nil && !errors.Is(err, registry.ErrLabelsUnsupported) {
+		return "", "", err
+	}
+	for _, key := range commitLabels {
+		if v := labels[key]; v != "" {
+			return v, key, nil
+		}
+	}
+	for _, tag := range latest.Tags {
+		if commitTag.MatchString(tag) {
+			return tag, "tag", nil
+		}
+	}
+	return "", "", errors.New("the latest image has no vcs-ref label or commit tag")
+}
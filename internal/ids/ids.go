@@ -0,0 +1,39 @@
+// Package ids makes the unique IDs given to requests, through an interface so
+// they can be made predictable where that helps
+package ids
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// Source makes new IDs
+type Source interface {
+	New() string
+}
+
+// Random makes random 128-bit hex IDs
+var Random Source = randomSource{}
+
+type randomSource struct{}
+
+func (randomSource) New() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+// Sequence makes the IDs prefix1, prefix2 and so on
+type Sequence struct {
+	Prefix string
+	n      atomic.Uint64
+}
+
+func (s *Sequence) New() string {
+	return fmt.Sprintf("%s%d", s.Prefix, s.n.Add(1))
+}
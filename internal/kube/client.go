@@ -0,0 +1,168 @@
+// Package kube reads the workloads running on Kubernetes and OpenShift
+// clusters through the API server's REST API
+package kube
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+var (
+	// ErrNotFound is returned for objects, and APIs such as OLM's, that the
+	// cluster doesn't have
+	ErrNotFound = errors.New("not found")
+	// ErrConflict is returned for creating an object that exists, or updating
+	// one that changed since it was read
+	ErrConflict = errors.New("conflict")
+)
+
+// Client talks to one cluster's API server
+type Client struct {
+	cfg    *Config
+	server string
+	http   *http.Client
+}
+
+func NewClient(cfg *Config) *Client {
+	return &Client{cfg: cfg, server: strings.TrimSuffix(cfg.Server, "/"), http: cfg.httpClient()}
+}
+
+// Server returns the API server URL
+func (c *Client) Server() string {
+	return c.server
+}
+
+// status is the error body the API server sends
+type status struct {
+	Message string `json:"message"`
+	Reason  string `json:"reason"`
+}
+
+// Get decodes the object at path, such as /api/v1/namespaces/default, into out
+func (c *Client) Get(ctx context.Context, path string, query url.Values, out interface{}) error {
+	return c.do(ctx, "GET", path, query, nil, out)
+}
+
+// PatchStatus merges status into the status subresource of the object at
+// path, so fields the caller doesn't know about are left alone
+func (c *Client) PatchStatus(ctx context.Context, path string, status interface{}) error {
+	body, err := json.Marshal(map[string]interface{}{"status": status})
+	if err != nil {
+		return err
+	}
+	return c.do(ctx, "PATCH", path+"/status", nil, body, nil)
+}
+
+// Create posts obj to the collection at path and decodes the created object into out
+func (c *Client) Create(ctx context.Context, path string, obj, out interface{}) error {
+	body, err := json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+	return c.do(ctx, "POST", path, nil, body, out)
+}
+
+// Update replaces the object at path with obj, which fails with ErrConflict
+// unless obj has the resourceVersion the object is at
+func (c *Client) Update(ctx context.Context, path string, obj, out interface{}) error {
+	body, err := json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+	return c.do(ctx, "PUT", path, nil, body, out)
+}
+
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body []byte, out interface{}) error {
+	u := c.server + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	var reqBody io.Reader
+	if body != nil {
+		reqBody = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, reqBody)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	switch {
+	case method == "PATCH":
+		req.Header.Set("Content-Type", "application/merge-patch+json")
+	case body != nil:
+		req.Header.Set("Content-Type", "application/json")
+	}
+	token, err := c.cfg.token()
+	if err != nil {
+		return err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("%s: %w", path, ErrNotFound)
+	}
+	if resp.StatusCode == http.StatusConflict {
+		return fmt.Errorf("%s: %w", path, ErrConflict)
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		var s status
+		if json.Unmarshal(data, &s) == nil && s.Message != "" {
+			return fmt.Errorf("%s: API server returned %d: %s", path, resp.StatusCode, s.Message)
+		}
+		return fmt.Errorf("%s: API server returned %d", path, resp.StatusCode)
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("%s: invalid response: %v", path, err)
+	}
+	return nil
+}
+
+// listPageSize is how many objects are fetched per request of a List
+const listPageSize = 500
+
+// List returns every item of a list path such as /apis/apps/v1/namespaces/x/deployments,
+// following continue tokens
+func List[T any](ctx context.Context, c *Client, path string, query url.Values) ([]T, error) {
+	q := url.Values{}
+	for k, v := range query {
+		q[k] = v
+	}
+	q.Set("limit", fmt.Sprint(listPageSize))
+
+	var items []T
+	for {
+		var page struct {
+			Metadata struct {
+				Continue string `json:"continue"`
+			} `json:"metadata"`
+			Items []T `json:"items"`
+		}
+		if err := c.Get(ctx, path, q, &page); err != nil {
+			return nil, err
+		}
+		items = append(items, page.Items...)
+		if page.Metadata.Continue == "" {
+			return items, nil
+		}
+		q.Set("continue", page.Metadata.Continue)
+	}
+}
@@ -0,0 +1,244 @@
+package kube
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config is how to reach one cluster's API server
+type Config struct {
+	Server    string
+	Token     string // Bearer token, or
+	TokenFile string // a file holding one, re-read on every request so rotation works
+	TLS       *tls.Config
+	Namespace string // The context's default namespace, if any
+}
+
+// kubeconfig is the part of a kubeconfig file OpTrack understands
+type kubeconfig struct {
+	CurrentContext string `yaml:"current-context"`
+	Clusters       []struct {
+		Name    string `yaml:"name"`
+		Cluster struct {
+			Server                   string `yaml:"server"`
+			CertificateAuthority     string `yaml:"certificate-authority"`
+			CertificateAuthorityData string `yaml:"certificate-authority-data"`
+			InsecureSkipTLSVerify    bool   `yaml:"insecure-skip-tls-verify"`
+			TLSServerName            string `yaml:"tls-server-name"`
+		} `yaml:"cluster"`
+	} `yaml:"clusters"`
+	Users []struct {
+		Name string `yaml:"name"`
+		User struct {
+			Token                 string      `yaml:"token"`
+			TokenFile             string      `yaml:"tokenFile"`
+			ClientCertificate     string      `yaml:"client-certificate"`
+			ClientCertificateData string      `yaml:"client-certificate-data"`
+			ClientKey             string      `yaml:"client-key"`
+			ClientKeyData         string      `yaml:"client-key-data"`
+			Exec                  interface{} `yaml:"exec"`
+			AuthProvider          interface{} `yaml:"auth-provider"`
+		} `yaml:"user"`
+	} `yaml:"users"`
+	Contexts []struct {
+		Name    string `yaml:"name"`
+		Context struct {
+			Cluster   string `yaml:"cluster"`
+			User      string `yaml:"user"`
+			Namespace string `yaml:"namespace"`
+		} `yaml:"context"`
+	} `yaml:"contexts"`
+}
+
+// DefaultKubeconfig returns the first file in $KUBECONFIG, or ~/.kube/config
+func DefaultKubeconfig() string {
+	if env := os.Getenv("KUBECONFIG"); env != "" {
+		return filepath.SplitList(env)[0]
+	}
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".kube", "config")
+}
+
+// LoadKubeconfig reads the named context, or the current context when name
+// is empty, from a kubeconfig file. Token, client certificate and CA
+// settings are supported; exec and auth-provider credentials are not, so use
+// a service account token for those clusters.
+func LoadKubeconfig(path, name string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read kubeconfig: %v", err)
+	}
+	var kc kubeconfig
+	if err := yaml.Unmarshal(data, &kc); err != nil {
+		return nil, fmt.Errorf("failed to parse kubeconfig %s: %v", path, err)
+	}
+	dir := filepath.Dir(path)
+
+	if name == "" {
+		name = kc.CurrentContext
+	}
+	if name == "" {
+		return nil, fmt.Errorf("kubeconfig %s has no current context, set one", path)
+	}
+	var clusterName, userName, namespace string
+	found := false
+	for _, c := range kc.Contexts {
+		if c.Name == name {
+			clusterName, userName, namespace, found = c.Context.Cluster, c.Context.User, c.Context.Namespace, true
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("kubeconfig %s has no context %q", path, name)
+	}
+
+	cfg := &Config{Namespace: namespace, TLS: &tls.Config{MinVersion: tls.VersionTLS12}}
+	found = false
+	for _, c := range kc.Clusters {
+		if c.Name != clusterName {
+			continue
+		}
+		found = true
+		cfg.Server = c.Cluster.Server
+		cfg.TLS.InsecureSkipVerify = c.Cluster.InsecureSkipTLSVerify
+		cfg.TLS.ServerName = c.Cluster.TLSServerName
+		ca, err := readData(dir, c.Cluster.CertificateAuthority, c.Cluster.CertificateAuthorityData)
+		if err != nil {
+			return nil, fmt.Errorf("cluster %s certificate authority: %v", clusterName, err)
+		}
+		if ca != nil {
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(ca) {
+				return nil, fmt.Errorf("cluster %s certificate authority holds no PEM certificates", clusterName)
+			}
+			cfg.TLS.RootCAs = pool
+		}
+	}
+	if !found || cfg.Server == "" {
+		return nil, fmt.Errorf("kubeconfig %s has no server for cluster %q", path, clusterName)
+	}
+
+	for _, u := range kc.Users {
+		if u.Name != userName {
+			continue
+		}
+		if u.User.Exec != nil || u.User.AuthProvider != nil {
+			return nil, fmt.Errorf("user %s uses an exec or auth-provider plugin, which OpTrack doesn't support; use a token", userName)
+		}
+		cfg.Token = u.User.Token
+		if u.User.TokenFile != "" {
+			cfg.TokenFile = resolve(dir, u.User.TokenFile)
+		}
+		cert, err := readData(dir, u.User.ClientCertificate, u.User.ClientCertificateData)
+		if err != nil {
+			return nil, fmt.Errorf("user %s client certificate: %v", userName, err)
+		}
+		key, err := readData(dir, u.User.ClientKey, u.User.ClientKeyData)
+		if err != nil {
+			return nil, fmt.Errorf("user %s client key: %v", userName, err)
+		}
+		if cert != nil && key != nil {
+			pair, err := tls.X509KeyPair(cert, key)
+			if err != nil {
+				return nil, fmt.Errorf("user %s client certificate: %v", userName, err)
+			}
+			cfg.TLS.Certificates = []tls.Certificate{pair}
+		}
+	}
+	return cfg, nil
+}
+
+// TokenConfig reaches server with a bearer token, typically a service
+// account's, instead of a kubeconfig. caFile, if set, holds the PEM CA
+// certificates the server's certificate is checked against.
+func TokenConfig(server, token, tokenFile, caFile string, insecure bool) (*Config, error) {
+	cfg := &Config{
+		Server:    server,
+		Token:     token,
+		TokenFile: tokenFile,
+		TLS:       &tls.Config{MinVersion: tls.VersionTLS12, InsecureSkipVerify: insecure},
+	}
+	if caFile != "" {
+		ca, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read certificate authority: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("%s holds no PEM certificates", caFile)
+		}
+		cfg.TLS.RootCAs = pool
+	}
+	return cfg, nil
+}
+
+// serviceAccountDir is where Kubernetes mounts a pod's service account credentials
+const serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// InCluster reports whether OpTrack runs in a pod that can use InClusterConfig
+func InCluster() bool {
+	return os.Getenv("KUBERNETES_SERVICE_HOST") != ""
+}
+
+// InClusterConfig reaches the API server of the cluster OpTrack runs in, as
+// the pod's service account. Namespace is the pod's namespace.
+func InClusterConfig() (*Config, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, fmt.Errorf("not running in a cluster: KUBERNETES_SERVICE_HOST and KUBERNETES_SERVICE_PORT are not set")
+	}
+	cfg, err := TokenConfig("https://"+net.JoinHostPort(host, port), "", filepath.Join(serviceAccountDir, "token"), filepath.Join(serviceAccountDir, "ca.crt"), false)
+	if err != nil {
+		return nil, err
+	}
+	if ns, err := os.ReadFile(filepath.Join(serviceAccountDir, "namespace")); err == nil {
+		cfg.Namespace = strings.TrimSpace(string(ns))
+	}
+	return cfg, nil
+}
+
+// readData returns inline base64 data, or the contents of file
+func readData(dir, file, data string) ([]byte, error) {
+	if data != "" {
+		return base64.StdEncoding.DecodeString(data)
+	}
+	if file != "" {
+		return os.ReadFile(resolve(dir, file))
+	}
+	return nil, nil
+}
+
+// resolve makes paths in a kubeconfig relative to the file, as kubectl does
+func resolve(dir, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
+
+// token returns the bearer token to send, if any
+func (c *Config) token() (string, error) {
+	if c.TokenFile != "" {
+		data, err := os.ReadFile(c.TokenFile)
+		if err != nil {
+			return "", fmt.Errorf("failed to read token: %v", err)
+		}
+		return strings.TrimSpace(string(data)), nil
+	}
+	return c.Token, nil
+}
+
+func (c *Config) httpClient() *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = c.TLS
+	return &http.Client{Transport: transport, Timeout: 30 * time.Second}
+}
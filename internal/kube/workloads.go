@@ -0,0 +1,284 @@
+package kube
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ObjectMeta is the metadata OpTrack reads from every object
+type ObjectMeta struct {
+	Name              string            `json:"name"`
+	Namespace         string            `json:"namespace"`
+	Labels            map[string]string `json:"labels,omitempty"`
+	Generation        int64             `json:"generation,omitempty"`
+	CreationTimestamp time.Time         `json:"creationTimestamp"`
+}
+
+// Container is a container of a pod template
+type Container struct {
+	Name  string `json:"name"`
+	Image string `json:"image"`
+}
+
+// PodSpec holds a pod's containers
+type PodSpec struct {
+	Containers     []Container `json:"containers"`
+	InitContainers []Container `json:"initContainers"`
+}
+
+// PodTemplate is the pod template of a workload
+type PodTemplate struct {
+	Spec PodSpec `json:"spec"`
+}
+
+// Deployment is an apps/v1 Deployment
+type Deployment struct {
+	Metadata ObjectMeta `json:"metadata"`
+	Spec     struct {
+		Template PodTemplate `json:"template"`
+	} `json:"spec"`
+}
+
+// ContainerStatus reports the image a container actually runs
+type ContainerStatus struct {
+	Name    string `json:"name"`
+	Image   string `json:"image"`
+	ImageID string `json:"imageID"` // Resolved reference, usually repository@sha256:...
+}
+
+// Pod is a v1 Pod
+type Pod struct {
+	Metadata ObjectMeta `json:"metadata"`
+	Spec     PodSpec    `json:"spec"`
+	Status   struct {
+		Phase             string            `json:"phase"`
+		ContainerStatuses []ContainerStatus `json:"containerStatuses"`
+	} `json:"status"`
+}
+
+// ClusterServiceVersion is an OLM operators.coreos.com/v1alpha1 CSV, the
+// installed version of an operator
+type ClusterServiceVersion struct {
+	Metadata ObjectMeta `json:"metadata"`
+	Spec     struct {
+		Version       string `json:"version"`
+		DisplayName   string `json:"displayName"`
+		RelatedImages []struct {
+			Name  string `json:"name"`
+			Image string `json:"image"`
+		} `json:"relatedImages"`
+		Install struct {
+			Spec struct {
+				Deployments []struct {
+					Name string `json:"name"`
+					Spec struct {
+						Template PodTemplate `json:"template"`
+					} `json:"spec"`
+				} `json:"deployments"`
+			} `json:"spec"`
+		} `json:"install"`
+	} `json:"spec"`
+	Status struct {
+		Phase string `json:"phase"`
+	} `json:"status"`
+}
+
+// Subscription is an OLM operators.coreos.com/v1alpha1 Subscription, which
+// installs and upgrades an operator package from a catalog channel
+type Subscription struct {
+	Metadata ObjectMeta `json:"metadata"`
+	Spec     struct {
+		Package string `json:"name"`
+		Channel string `json:"channel"`
+		Source  string `json:"source"`
+	} `json:"spec"`
+	Status struct {
+		State        string `json:"state"`        // e.g. AtLatestKnown, UpgradePending
+		CurrentCSV   string `json:"currentCSV"`   // The CSV the subscription wants
+		InstalledCSV string `json:"installedCSV"` // The CSV that is installed
+	} `json:"status"`
+}
+
+// copiedFromLabel marks the copies OLM makes of a CSV in every namespace its
+// operator watches; only the original is an installation
+const copiedFromLabel = "olm.copiedFrom"
+
+// Installation is an operator installed through OLM: a CSV and the
+// Subscription that installed it, if any
+type Installation struct {
+	Namespace    string     `json:"namespace"`
+	CSV          string     `json:"csv"`
+	Version      string     `json:"version,omitempty"`
+	Phase        string     `json:"phase,omitempty"` // e.g. Succeeded, Installing, Failed
+	Subscription string     `json:"subscription,omitempty"`
+	Package      string     `json:"package,omitempty"`
+	Channel      string     `json:"channel,omitempty"`
+	Source       string     `json:"source,omitempty"`
+	State        string     `json:"state,omitempty"`      // The subscription's state
+	CurrentCSV   string     `json:"currentCSV,omitempty"` // Set while an upgrade to another CSV is pending
+	Images       []ImageRef `json:"images"`
+}
+
+// Inventory is what runs in a cluster's namespaces
+type Inventory struct {
+	Workloads     []Workload
+	Installations []Installation // Empty on clusters without OLM
+}
+
+// Workload is one container image referenced by a Deployment or CSV
+type Workload struct {
+	Kind      string   `json:"kind"` // "Deployment" or "ClusterServiceVersion"
+	Namespace string   `json:"namespace"`
+	Name      string   `json:"name"`
+	Container string   `json:"container"`
+	Image     ImageRef `json:"image"`
+	// Digest is the sha256 hex digest that is running: from a digest in the
+	// image reference, or else from a pod running the same image. Empty when
+	// neither is known.
+	Digest string `json:"digest,omitempty"`
+}
+
+// Inventory lists the images of every Deployment and OLM CSV in namespaces,
+// and the operators OLM installed there. Clusters without OLM only report
+// Deployments.
+func (c *Client) Inventory(ctx context.Context, namespaces []string) (*Inventory, error) {
+	inv := &Inventory{}
+	for _, ns := range namespaces {
+		if err := c.namespaceInventory(ctx, ns, inv); err != nil {
+			return nil, fmt.Errorf("namespace %s: %v", ns, err)
+		}
+	}
+	return inv, nil
+}
+
+func (c *Client) namespaceInventory(ctx context.Context, ns string, inv *Inventory) error {
+	deployments, err := List[Deployment](ctx, c, "/apis/apps/v1/namespaces/"+ns+"/deployments", nil)
+	if err != nil {
+		return err
+	}
+	pods, err := List[Pod](ctx, c, "/api/v1/namespaces/"+ns+"/pods", nil)
+	if err != nil {
+		return err
+	}
+	olm := true
+	csvs, err := List[ClusterServiceVersion](ctx, c, "/apis/operators.coreos.com/v1alpha1/namespaces/"+ns+"/clusterserviceversions", nil)
+	if errors.Is(err, ErrNotFound) {
+		olm = false
+	} else if err != nil {
+		return err
+	}
+	var subscriptions []Subscription
+	if olm {
+		subscriptions, err = List[Subscription](ctx, c, "/apis/operators.coreos.com/v1alpha1/namespaces/"+ns+"/subscriptions", nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Tags only say what was asked for; running pods say which digest it resolved to
+	running := make(map[string]string) // image as written -> digest
+	for _, pod := range pods {
+		if pod.Status.Phase != "Running" {
+			continue
+		}
+		for _, cs := range pod.Status.ContainerStatuses {
+			if digest := ParseImage(cs.ImageID).Digest; digest != "" {
+				running[cs.Image] = digest
+			}
+		}
+	}
+
+	add := func(kind, name string, containers []Container) {
+		for _, container := range containers {
+			w := Workload{Kind: kind, Namespace: ns, Name: name, Container: container.Name, Image: ParseImage(container.Image)}
+			w.Digest = w.Image.Digest
+			if w.Digest == "" {
+				w.Digest = running[container.Image]
+			}
+			inv.Workloads = append(inv.Workloads, w)
+		}
+	}
+	for _, d := range deployments {
+		add("Deployment", d.Metadata.Name, d.Spec.Template.Spec.Containers)
+	}
+
+	installedBy := make(map[string]Subscription) // CSV name -> subscription
+	for _, sub := range subscriptions {
+		if sub.Status.InstalledCSV != "" {
+			installedBy[sub.Status.InstalledCSV] = sub
+		}
+	}
+	for _, csv := range csvs {
+		if csv.Metadata.Labels[copiedFromLabel] != "" {
+			continue
+		}
+		first := len(inv.Workloads)
+		for _, d := range csv.Spec.Install.Spec.Deployments {
+			add("ClusterServiceVersion", csv.Metadata.Name, d.Spec.Template.Spec.Containers)
+		}
+		for _, image := range csv.Spec.RelatedImages {
+			add("ClusterServiceVersion", csv.Metadata.Name, []Container{{Name: image.Name, Image: image.Image}})
+		}
+
+		in := Installation{Namespace: ns, CSV: csv.Metadata.Name, Version: csv.Spec.Version, Phase: csv.Status.Phase}
+		for _, w := range inv.Workloads[first:] {
+			in.Images = append(in.Images, w.Image)
+		}
+		if sub, ok := installedBy[csv.Metadata.Name]; ok {
+			in.Subscription = sub.Metadata.Name
+			in.Package = sub.Spec.Package
+			in.Channel = sub.Spec.Channel
+			in.Source = sub.Spec.Source
+			in.State = sub.Status.State
+			if sub.Status.CurrentCSV != csv.Metadata.Name {
+				in.CurrentCSV = sub.Status.CurrentCSV
+			}
+		}
+		inv.Installations = append(inv.Installations, in)
+	}
+	return nil
+}
+
+// ImageRef is a parsed container image reference
+type ImageRef struct {
+	Registry   string `json:"registry"`   // e.g. quay.io
+	Repository string `json:"repository"` // e.g. app-sre/foo
+	Tag        string `json:"tag,omitempty"`
+	Digest     string `json:"digest,omitempty"` // sha256 hex, without the sha256: prefix
+}
+
+// ParseImage splits an image reference such as quay.io/ns/repo:tag or
+// quay.io/ns/repo@sha256:abc. Pod imageIDs with a docker-pullable:// prefix
+// are accepted too.
+func ParseImage(ref string) ImageRef {
+	ref = strings.TrimPrefix(ref, "docker-pullable://")
+	var img ImageRef
+	if name, digest, ok := strings.Cut(ref, "@"); ok {
+		ref = name
+		img.Digest = strings.TrimPrefix(digest, "sha256:")
+	}
+	if i := strings.LastIndex(ref, ":"); i > strings.LastIndex(ref, "/") {
+		ref, img.Tag = ref[:i], ref[i+1:]
+	}
+	if first, rest, ok := strings.Cut(ref, "/"); ok && (strings.ContainsAny(first, ".:") || first == "localhost") {
+		img.Registry, ref = first, rest
+	} else {
+		img.Registry = "docker.io"
+	}
+	img.Repository = ref
+	return img
+}
+
+func (i ImageRef) String() string {
+	s := i.Registry + "/" + i.Repository
+	if i.Tag != "" {
+		s += ":" + i.Tag
+	}
+	if i.Digest != "" {
+		s += "@sha256:" + i.Digest
+	}
+	return s
+}
@@ -0,0 +1,83 @@
+package leader
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"OpTrack/internal/store"
+)
+
+// staleMutexAge is how old a mutex file must be before it is taken to be
+// left over from a replica that died while updating the lock
+const staleMutexAge = 10 * time.Second
+
+// File is a lock kept in a file on storage the replicas share, such as a
+// data directory on a network volume. Updates are serialized by a mutex file
+// created exclusively next to it, which works on network file systems that
+// don't support file locking.
+type File struct {
+	path string
+	seen []byte // The contents Get last read
+}
+
+func NewFile(path string) *File {
+	return &File{path: path}
+}
+
+func (f *File) String() string {
+	return "file " + f.path
+}
+
+func (f *File) Get(ctx context.Context) (*Record, error) {
+	data, err := os.ReadFile(f.path)
+	if os.IsNotExist(err) {
+		f.seen = nil
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	f.seen = data
+	var rec Record
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return nil, fmt.Errorf("%s: %v", f.path, err)
+	}
+	return &rec, nil
+}
+
+func (f *File) Update(ctx context.Context, rec Record) error {
+	mutex := f.path + ".lock"
+	m, err := os.OpenFile(mutex, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if os.IsExist(err) {
+		if info, err := os.Stat(mutex); err == nil && time.Since(info.ModTime()) > staleMutexAge {
+			os.Remove(mutex)
+		}
+		return fmt.Errorf("%s is being updated by another replica", f.path)
+	}
+	if err != nil {
+		return err
+	}
+	m.Close()
+	defer os.Remove(mutex)
+
+	current, err := os.ReadFile(f.path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if !bytes.Equal(current, f.seen) {
+		return ErrConflict
+	}
+	data, err := json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := store.WriteFileAtomic(f.path, data, 0644); err != nil {
+		return err
+	}
+	f.seen = data
+	return nil
+}
@@ -0,0 +1,233 @@
+// Package leader elects one of several replicas sharing storage to do the
+// work only one of them should, such as polling and sending notifications.
+// The leader holds a lock, a Kubernetes Lease or a file, and keeps renewing
+// it; the other replicas take it over once it goes unrenewed for the lease
+// duration.
+package leader
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"OpTrack/internal/clock"
+	"OpTrack/internal/scheduler"
+)
+
+// ErrConflict is returned by Lock.Update when the lock changed since it was read
+var ErrConflict = errors.New("the lock changed since it was read")
+
+// Record is what a lock holds
+type Record struct {
+	Holder       string    `json:"holder"` // Empty once released
+	Acquired     time.Time `json:"acquired"`
+	Renewed      time.Time `json:"renewed"`
+	LeaseSeconds int       `json:"leaseSeconds"`
+	Transitions  int       `json:"transitions"` // How often the lock changed hands
+}
+
+func (r *Record) same(other *Record) bool {
+	return r != nil && other != nil && r.Holder == other.Holder && r.Renewed.Equal(other.Renewed) && r.Transitions == other.Transitions
+}
+
+// Lock is where the leader records itself
+type Lock interface {
+	// Get returns the record, or nil when the lock was never taken
+	Get(ctx context.Context) (*Record, error)
+	// Update writes rec, failing with ErrConflict if the lock changed since
+	// the last Get
+	Update(ctx context.Context, rec Record) error
+	// String describes the lock for logs, e.g. "lease ops/optrack"
+	String() string
+}
+
+// Elector campaigns for a lock on behalf of one replica
+type Elector struct {
+	lock     Lock
+	identity string
+	duration time.Duration
+	clock    clock.Clock
+	changed  func(leading bool)
+
+	mu         sync.Mutex
+	leading    bool
+	since      time.Time // When this replica became the leader
+	renewed    time.Time // When this replica last renewed the lock
+	observed   *Record   // The record last read
+	observedAt time.Time // When it was first read, on this replica's clock
+	lastErr    error
+}
+
+// New returns an elector for identity, which must be unique among the
+// replicas. A leader that can't renew the lock for duration is replaced.
+// changed, if set, is called whenever this replica gains or loses the lead.
+func New(lock Lock, identity string, duration time.Duration, clk clock.Clock, changed func(leading bool)) *Elector {
+	if changed == nil {
+		changed = func(bool) {}
+	}
+	return &Elector{lock: lock, identity: identity, duration: duration, clock: clock.Or(clk), changed: changed}
+}
+
+// Status is an elector's view of the election
+type Status struct {
+	Identity string     `json:"identity"`
+	Lock     string     `json:"lock"`
+	Leader   bool       `json:"leader"`
+	Holder   string     `json:"holder,omitempty"` // The current leader, as last seen
+	Since    *time.Time `json:"since,omitempty"`  // When this replica became the leader
+	Error    string     `json:"error,omitempty"`  // Why the lock couldn't be read or renewed last
+}
+
+func (e *Elector) Status() Status {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	status := Status{Identity: e.identity, Lock: e.lock.String(), Leader: e.leading}
+	if e.observed != nil {
+		status.Holder = e.observed.Holder
+	}
+	if e.leading {
+		since := e.since
+		status.Since = &since
+	}
+	if e.lastErr != nil {
+		status.Error = e.lastErr.Error()
+	}
+	return status
+}
+
+// IsLeader reports whether this replica leads
+func (e *Elector) IsLeader() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.leading
+}
+
+// Run returns a job that campaigns for the lock until stopped, running job
+// while this replica leads. job is stopped when the lead is lost, and on
+// shutdown the lock is released so another replica takes over at once.
+func (e *Elector) Run(job scheduler.Job) scheduler.Job {
+	return func(stop <-chan struct{}) {
+		// Try a few times per lease so a leader renews well before it expires
+		ticker := e.clock.NewTicker(e.duration / 3)
+		defer ticker.Stop()
+
+		var task *scheduler.Task
+		for {
+			leading := e.campaign()
+			switch {
+			case leading && task == nil:
+				slog.Info("Became the leader", "identity", e.identity, "lock", e.lock.String())
+				task = scheduler.Start(job)
+			case !leading && task != nil:
+				slog.Warn("Lost the leadership, stopping", "identity", e.identity, "lock", e.lock.String(), "leader", e.Status().Holder)
+				task.Stop(context.Background())
+				task = nil
+			}
+
+			select {
+			case <-ticker.C:
+			case <-stop:
+				if task != nil {
+					task.Stop(context.Background())
+					e.release()
+				}
+				return
+			}
+		}
+	}
+}
+
+// campaign acquires or renews the lock and returns whether this replica leads
+func (e *Elector) campaign() bool {
+	ctx, cancel := context.WithTimeout(context.Background(), e.duration/3)
+	defer cancel()
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	now := e.clock.Now()
+	rec, err := e.lock.Get(ctx)
+	if err != nil {
+		return e.failed(now, err)
+	}
+	if !rec.same(e.observed) {
+		e.observed, e.observedAt = rec, now
+	}
+
+	next := Record{Holder: e.identity, Acquired: now, Renewed: now, LeaseSeconds: int(e.duration / time.Second)}
+	if rec != nil {
+		next.Transitions = rec.Transitions
+		switch {
+		case rec.Holder == e.identity:
+			next.Acquired = rec.Acquired
+		case rec.Holder != "" && now.Before(e.observedAt.Add(rec.lease(e.duration))):
+			// Another replica holds the lock and renewed it recently. Expiry
+			// is measured from when the renewal was seen here rather than the
+			// time in the record, so clock skew between replicas doesn't matter.
+			e.lastErr = nil
+			return e.setLeading(false)
+		default:
+			next.Transitions++
+		}
+	}
+	if err := e.lock.Update(ctx, next); err != nil {
+		if errors.Is(err, ErrConflict) {
+			e.lastErr = nil
+			return e.setLeading(false) // Another replica got there first
+		}
+		return e.failed(now, err)
+	}
+	if !e.leading {
+		e.since = now
+	}
+	e.observed, e.observedAt, e.renewed, e.lastErr = &next, now, now, nil
+	return e.setLeading(true)
+}
+
+// failed keeps a leader leading through lock errors until two thirds of
+// the lease have passed, so it stops before another replica can take over
+func (e *Elector) failed(now time.Time, err error) bool {
+	if e.lastErr == nil || e.lastErr.Error() != err.Error() {
+		slog.Warn("Failed to update the leader lock", "lock", e.lock.String(), "error", err)
+	}
+	e.lastErr = err
+	return e.setLeading(e.leading && now.Before(e.renewed.Add(e.duration*2/3)))
+}
+
+func (e *Elector) setLeading(leading bool) bool {
+	if leading != e.leading {
+		e.leading = leading
+		e.changed(leading)
+	}
+	return leading
+}
+
+// release gives the lock up, so the other replicas needn't wait for it to expire
+func (e *Elector) release() {
+	ctx, cancel := context.WithTimeout(context.Background(), e.duration/3)
+	defer cancel()
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	rec, err := e.lock.Get(ctx)
+	if err == nil && rec != nil && rec.Holder == e.identity {
+		rec.Holder, rec.Renewed = "", e.clock.Now()
+		err = e.lock.Update(ctx, *rec)
+	}
+	if err != nil {
+		slog.Warn("Failed to release the leader lock", "lock", e.lock.String(), "error", err)
+	}
+	e.observed = rec
+	e.setLeading(false)
+}
+
+// lease is how long the holder's lease lasts, defaulting to fallback for
+// records without one
+func (r *Record) lease(fallback time.Duration) time.Duration {
+	if r.LeaseSeconds > 0 {
+		return time.Duration(r.LeaseSeconds) * time.Second
+	}
+	return fallback
+}
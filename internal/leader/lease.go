@@ -0,0 +1,122 @@
+package leader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"OpTrack/internal/kube"
+)
+
+// Lease is a coordination.k8s.io/v1 Lease, the lock Kubernetes controllers
+// elect their leaders with
+type Lease struct {
+	client          *kube.Client
+	namespace, name string
+	resourceVersion string // Of the lease Get last read, empty when there was none
+}
+
+func NewLease(client *kube.Client, namespace, name string) *Lease {
+	return &Lease{client: client, namespace: namespace, name: name}
+}
+
+func (l *Lease) String() string {
+	return "lease " + l.namespace + "/" + l.name
+}
+
+// lease is the Lease object
+type lease struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Metadata   struct {
+		Name            string `json:"name"`
+		Namespace       string `json:"namespace"`
+		ResourceVersion string `json:"resourceVersion,omitempty"`
+	} `json:"metadata"`
+	Spec struct {
+		HolderIdentity       string     `json:"holderIdentity,omitempty"`
+		LeaseDurationSeconds int        `json:"leaseDurationSeconds,omitempty"`
+		AcquireTime          *microTime `json:"acquireTime,omitempty"`
+		RenewTime            *microTime `json:"renewTime,omitempty"`
+		LeaseTransitions     int        `json:"leaseTransitions,omitempty"`
+	} `json:"spec"`
+}
+
+// microTime is a time in the MicroTime format Lease times must be in
+type microTime struct {
+	time.Time
+}
+
+func (t microTime) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + t.UTC().Format("2006-01-02T15:04:05.000000Z07:00") + `"`), nil
+}
+
+func (t *microTime) UnmarshalJSON(data []byte) error {
+	parsed, err := time.Parse(time.RFC3339, strings.Trim(string(data), `"`))
+	if err != nil {
+		return err
+	}
+	t.Time = parsed
+	return nil
+}
+
+func (l *Lease) collection() string {
+	return "/apis/coordination.k8s.io/v1/namespaces/" + l.namespace + "/leases"
+}
+
+func (l *Lease) Get(ctx context.Context) (*Record, error) {
+	var obj lease
+	err := l.client.Get(ctx, l.collection()+"/"+l.name, nil, &obj)
+	if errors.Is(err, kube.ErrNotFound) {
+		l.resourceVersion = ""
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	l.resourceVersion = obj.Metadata.ResourceVersion
+	rec := &Record{
+		Holder:       obj.Spec.HolderIdentity,
+		LeaseSeconds: obj.Spec.LeaseDurationSeconds,
+		Transitions:  obj.Spec.LeaseTransitions,
+	}
+	if obj.Spec.AcquireTime != nil {
+		rec.Acquired = obj.Spec.AcquireTime.Time
+	}
+	if obj.Spec.RenewTime != nil {
+		rec.Renewed = obj.Spec.RenewTime.Time
+	}
+	return rec, nil
+}
+
+func (l *Lease) Update(ctx context.Context, rec Record) error {
+	obj := lease{APIVersion: "coordination.k8s.io/v1", Kind: "Lease"}
+	obj.Metadata.Name, obj.Metadata.Namespace, obj.Metadata.ResourceVersion = l.name, l.namespace, l.resourceVersion
+	obj.Spec.HolderIdentity = rec.Holder
+	obj.Spec.LeaseDurationSeconds = rec.LeaseSeconds
+	obj.Spec.LeaseTransitions = rec.Transitions
+	if !rec.Acquired.IsZero() {
+		obj.Spec.AcquireTime = &microTime{rec.Acquired}
+	}
+	if !rec.Renewed.IsZero() {
+		obj.Spec.RenewTime = &microTime{rec.Renewed}
+	}
+
+	var out lease
+	var err error
+	if l.resourceVersion == "" {
+		err = l.client.Create(ctx, l.collection(), obj, &out)
+	} else {
+		err = l.client.Update(ctx, l.collection()+"/"+l.name, obj, &out)
+	}
+	if errors.Is(err, kube.ErrConflict) {
+		return ErrConflict
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %v", l, err)
+	}
+	l.resourceVersion = out.Metadata.ResourceVersion
+	return nil
+}
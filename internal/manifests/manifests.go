@@ -0,0 +1,193 @@
+// Package manifests finds the container images referenced by Kubernetes
+// manifests: workloads, ClusterServiceVersions and anything else with a pod
+// template, including rendered kustomize and Helm output
+package manifests
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"OpTrack/internal/kube"
+)
+
+// ErrNoImages is returned when manifests reference no image on the
+// registries asked for
+var ErrNoImages = errors.New("no images on the given registries found in the manifests")
+
+// DefaultRegistry is the registry images are tracked on unless others are given
+const DefaultRegistry = "quay.io"
+
+// relatedImagePrefix starts the names of the environment variables operators
+// read their operand images from
+const relatedImagePrefix = "RELATED_IMAGE_"
+
+// Image is one image reference found in the manifests
+type Image struct {
+	Image    string `json:"image"`
+	Source   string `json:"source"`             // Kind/name of the object it was found in
+	Line     int    `json:"line"`               // Of the reference, counted across documents
+	Operator string `json:"operator,omitempty"` // namespace/repository, when it is tracked
+	Skipped  string `json:"skipped,omitempty"`  // Why it isn't tracked
+}
+
+// Result is the images found in manifests and the operators they make up
+type Result struct {
+	Operators []string          `json:"operators"`      // In the order first referenced
+	Pins      map[string]string `json:"pins,omitempty"` // Operator -> the first digest it is pinned to, as sha256 hex
+	Images    []Image           `json:"images"`
+}
+
+// Import reads YAML or JSON manifests, any number of documents, and returns
+// every image they reference. Images on one of registries, which defaults to
+// DefaultRegistry, become operators. It fails with ErrNoImages when none do.
+func Import(r io.Reader, registries []string) (*Result, error) {
+	if len(registries) == 0 {
+		registries = []string{DefaultRegistry}
+	}
+	res := &Result{Operators: []string{}}
+	seen := make(map[string]bool) // Image references per source
+	tracked := make(map[string]bool)
+	add := func(ref, source string, line int) {
+		ref = strings.TrimSpace(ref)
+		if ref == "" || seen[source+" "+ref] {
+			return
+		}
+		seen[source+" "+ref] = true
+		img := Image{Image: ref, Source: source, Line: line}
+		parsed := kube.ParseImage(ref)
+		switch {
+		case !contains(registries, parsed.Registry):
+			img.Skipped = "registry " + parsed.Registry
+		case strings.Count(parsed.Repository, "/") != 1:
+			img.Skipped = "not namespace/repository"
+		default:
+			img.Operator = strings.ToLower(parsed.Repository)
+			if !tracked[img.Operator] {
+				tracked[img.Operator] = true
+				res.Operators = append(res.Operators, img.Operator)
+			}
+			if _, pinned := res.Pins[img.Operator]; parsed.Digest != "" && !pinned {
+				if res.Pins == nil {
+					res.Pins = make(map[string]string)
+				}
+				res.Pins[img.Operator] = parsed.Digest
+			}
+		}
+		res.Images = append(res.Images, img)
+	}
+
+	dec := yaml.NewDecoder(r)
+	for doc := 1; ; doc++ {
+		var node yaml.Node
+		err := dec.Decode(&node)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("document %d: %v", doc, err)
+		}
+		if len(node.Content) > 0 {
+			walkObject(node.Content[0], fmt.Sprintf("document %d", doc), add)
+		}
+	}
+	if len(res.Operators) == 0 {
+		return res, ErrNoImages
+	}
+	return res, nil
+}
+
+// walkObject finds the images in one object, descending into the items of
+// a List
+func walkObject(obj *yaml.Node, fallback string, add func(ref, source string, line int)) {
+	if obj.Kind != yaml.MappingNode {
+		return
+	}
+	kind := scalar(field(obj, "kind"))
+	if items := field(obj, "items"); items != nil && items.Kind == yaml.SequenceNode && strings.HasSuffix(kind, "List") {
+		for i, item := range items.Content {
+			walkObject(item, fmt.Sprintf("%s item %d", fallback, i+1), add)
+		}
+		return
+	}
+	source := fallback
+	if kind != "" {
+		source = kind + "/" + scalar(field(field(obj, "metadata"), "name"))
+	}
+	walk(obj, source, add)
+}
+
+// walk finds images in the container image fields, CSV containerImage
+// annotations, relatedImages and RELATED_IMAGE_ environment variables
+// anywhere under n, in document order
+func walk(n *yaml.Node, source string, add func(ref, source string, line int)) {
+	switch n.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key, value := n.Content[i].Value, n.Content[i+1]
+			switch {
+			case (key == "image" || key == "containerImage") && value.Kind == yaml.ScalarNode:
+				add(value.Value, source, value.Line)
+			case key == "env" && value.Kind == yaml.SequenceNode:
+				for _, e := range value.Content {
+					if strings.HasPrefix(scalar(field(e, "name")), relatedImagePrefix) {
+						if v := field(e, "value"); v != nil {
+							add(v.Value, source, v.Line)
+						}
+					}
+				}
+			default:
+				walk(value, source, add)
+			}
+		}
+	case yaml.SequenceNode:
+		for _, item := range n.Content {
+			walk(item, source, add)
+		}
+	}
+}
+
+// field returns the value of key in a mapping, or nil
+func field(n *yaml.Node, key string) *yaml.Node {
+	if n == nil || n.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			return n.Content[i+1]
+		}
+	}
+	return nil
+}
+
+func scalar(n *yaml.Node) string {
+	if n == nil || n.Kind != yaml.ScalarNode {
+		return ""
+	}
+	return n.Value
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Merge appends the operators found that aren't in operators already, and
+// returns the new list with the operators it added
+func Merge(operators []string, res *Result) (merged, added []string) {
+	merged = append([]string(nil), operators...)
+	for _, op := range res.Operators {
+		if !contains(merged, op) {
+			merged = append(merged, op)
+			added = append(added, op)
+		}
+	}
+	return merged, added
+}
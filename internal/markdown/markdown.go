@@ -0,0 +1,86 @@
+// Package markdown renders the small part of Markdown that ticket comments
+// use: paragraphs, line breaks, bullet lists, fenced code blocks, inline code,
+// bold, italics and http(s) links. Everything else is shown as written, and
+// all text is escaped, so the result is safe to put in a page.
+package markdown
+
+import (
+	"html"
+	"html/template"
+	"regexp"
+	"strings"
+)
+
+var (
+	codeSpan = regexp.MustCompile("`([^`]+)`")
+	bold     = regexp.MustCompile(`\*\*([^*]+)\*\*`)
+	italic   = regexp.MustCompile(`(^|[^*\w])\*([^*\s][^*]*)\*`)
+	link     = regexp.MustCompile(`\[([^\]]+)\]\((https?://[^\s)]+)\)`)
+)
+
+// ToHTML renders Markdown source as HTML
+func ToHTML(src string) template.HTML {
+	var b strings.Builder
+	src = strings.NewReplacer("\r\n", "\n", "\x00", "").Replace(src)
+	lines := strings.Split(src, "\n")
+	var para, items []string
+	flush := func() {
+		if len(para) > 0 {
+			b.WriteString("<p>" + strings.Join(para, "<br>") + "</p>")
+			para = nil
+		}
+		if len(items) > 0 {
+			b.WriteString("<ul>")
+			for _, item := range items {
+				b.WriteString("<li>" + item + "</li>")
+			}
+			b.WriteString("</ul>")
+			items = nil
+		}
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimRight(lines[i], " \t")
+		switch {
+		case strings.HasPrefix(line, "```"):
+			flush()
+			var code []string
+			for i++; i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), "```"); i++ {
+				code = append(code, html.EscapeString(lines[i]))
+			}
+			b.WriteString("<pre><code>" + strings.Join(code, "\n") + "</code></pre>")
+		case strings.TrimSpace(line) == "":
+			flush()
+		case strings.HasPrefix(line, "- ") || strings.HasPrefix(line, "* "):
+			if len(para) > 0 {
+				flush()
+			}
+			items = append(items, inline(line[2:]))
+		default:
+			if len(items) > 0 {
+				flush()
+			}
+			para = append(para, inline(line))
+		}
+	}
+	flush()
+	return template.HTML(b.String())
+}
+
+// inline renders the spans of one line. Code spans are set aside first, so
+// nothing inside them is formatted.
+func inline(line string) string {
+	var codes []string
+	line = codeSpan.ReplaceAllStringFunc(line, func(m string) string {
+		codes = append(codes, "<code>"+html.EscapeString(m[1:len(m)-1])+"</code>")
+		return "\x00"
+	})
+	line = html.EscapeString(line)
+	line = link.ReplaceAllString(line, `<a href="$2" rel="nofollow noopener">$1</a>`)
+	line = bold.ReplaceAllString(line, "<strong>$1</strong>")
+	line = italic.ReplaceAllString(line, "$1<em>$2</em>")
+	for _, code := range codes {
+		line = strings.Replace(line, "\x00", code, 1)
+	}
+	return line
+}
@@ -0,0 +1,131 @@
+// Package middleware composes the behaviour shared by every HTTP route
+package middleware
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"OpTrack/internal/clock"
+)
+
+// Middleware wraps a handler with behaviour that runs around it
+type Middleware func(http.Handler) http.Handler
+
+// Chain wraps h so requests pass through mws in the order given before reaching h
+func Chain(h http.Handler, mws ...Middleware) http.Handler {
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = mws[i](h)
+	}
+	return h
+}
+
+// CORS lets pages on the allowed origins call the API from a browser. "*"
+// allows any origin. Preflight requests are answered without reaching next.
+func CORS(origins []string) Middleware {
+	allowed := make(map[string]bool, len(origins))
+	for _, origin := range origins {
+		allowed[strings.TrimSuffix(origin, "/")] = true
+	}
+	return func(next http.Handler) http.Handler {
+		if len(allowed) == 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			w.Header().Add("Vary", "Origin")
+			if origin == "" || !(allowed["*"] || allowed[origin]) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Set("Access-Control-Expose-Headers", "X-Request-ID, Retry-After")
+			if r.Method == "OPTIONS" && r.Header.Get("Access-Control-Request-Method") != "" {
+				w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE")
+				w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, X-Request-ID")
+				w.Header().Set("Access-Control-Max-Age", "600")
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RateLimit lets each client make rate requests per second on average, in
+// bursts of up to burst. key names the client of a request; reject answers
+// requests over the limit, after Retry-After has been set. A rate of 0
+// disables limiting. Buckets refill by the time of clk.
+func RateLimit(rate float64, burst int, clk clock.Clock, key func(*http.Request) string, reject http.HandlerFunc) Middleware {
+	clk = clock.Or(clk)
+	return func(next http.Handler) http.Handler {
+		if rate <= 0 {
+			return next
+		}
+		limiter := newLimiter(rate, burst)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if wait := limiter.take(key(r), clk.Now()); wait > 0 {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+				reject(w, r)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// bucket is one client's token bucket
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// limiter keeps a token bucket per client, forgetting clients whose bucket has refilled
+type limiter struct {
+	rate  float64
+	burst float64
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastPrune time.Time
+}
+
+func newLimiter(rate float64, burst int) *limiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &limiter{rate: rate, burst: float64(burst), buckets: make(map[string]*bucket)}
+}
+
+// take spends a token from key's bucket, returning how long to wait when it is empty
+func (l *limiter) take(key string, now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastPrune) > time.Minute {
+		full := time.Duration(l.burst / l.rate * float64(time.Second))
+		for k, b := range l.buckets {
+			if now.Sub(b.last) > full {
+				delete(l.buckets, k)
+			}
+		}
+		l.lastPrune = now
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens < 1 {
+		return time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	}
+	b.tokens--
+	return 0
+}
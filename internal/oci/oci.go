@@ -0,0 +1,285 @@
+// Package oci reads image manifests and blobs from container registries
+// through the registry v2 API, asking for a pull token when the registry
+// wants one
+package oci
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"OpTrack/internal/kube"
+)
+
+// ErrNotFound is returned for manifests and blobs the repository doesn't have
+var ErrNotFound = errors.New("not found")
+
+// maxManifestBytes bounds the manifests read; real ones are a few KB
+const maxManifestBytes = 4 << 20
+
+// Media types of image manifests and indexes
+var manifestTypes = []string{
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+}
+
+// Pacer spaces out the requests to a registry and slows them down when it
+// says they are too many, like registry.Budget
+type Pacer interface {
+	Wait(ctx context.Context) error
+	Observe(resp *http.Response)
+}
+
+// Options configures a Client
+type Options struct {
+	// Registries are asked anonymously unless Username is set, e.g. to a
+	// Quay robot account
+	Username string
+	Password string
+	Timeout  time.Duration
+
+	Transport http.RoundTripper // Defaults to http.DefaultTransport
+	// Pacers pace the requests to some registries, by host, e.g. to share
+	// the request budget of Quay.io with its API client
+	Pacers map[string]Pacer
+}
+
+// Client pulls from registries
+type Client struct {
+	http     *http.Client
+	username string
+	password string
+	pacers   map[string]Pacer
+}
+
+func NewClient(opts Options) *Client {
+	return &Client{
+		http:     &http.Client{Timeout: opts.Timeout, Transport: opts.Transport},
+		username: opts.Username,
+		password: opts.Password,
+		pacers:   opts.Pacers,
+	}
+}
+
+// do sends a request, at the pace of its registry
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	pacer := c.pacers[req.URL.Host]
+	if pacer != nil {
+		if err := pacer.Wait(req.Context()); err != nil {
+			return nil, err
+		}
+	}
+	resp, err := c.http.Do(req)
+	if err == nil && pacer != nil {
+		pacer.Observe(resp)
+	}
+	return resp, err
+}
+
+// Manifest is an image manifest or, with Manifests set, an image index
+type Manifest struct {
+	Digest      string            `json:"-"` // e.g. sha256:abc
+	MediaType   string            `json:"mediaType"`
+	Config      Descriptor        `json:"config"`
+	Layers      []Descriptor      `json:"layers"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	Manifests   []struct {
+		Descriptor
+		Platform struct {
+			OS           string `json:"os"`
+			Architecture string `json:"architecture"`
+		} `json:"platform"`
+	} `json:"manifests"`
+}
+
+// Descriptor points at a blob or manifest
+type Descriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// Repository is one repository on a registry, with the token it was granted
+type Repository struct {
+	client *Client
+	host   string
+	name   string
+	token  string
+}
+
+// Repository returns the repository of an image reference such as
+// quay.io/app-sre/foo-bundle:v1.2.3. Docker Hub images are pulled from
+// registry-1.docker.io.
+func (c *Client) Repository(ref kube.ImageRef) *Repository {
+	repo := &Repository{client: c, host: ref.Registry, name: ref.Repository}
+	if ref.Registry == "docker.io" {
+		repo.host = "registry-1.docker.io"
+		if !strings.Contains(repo.name, "/") {
+			repo.name = "library/" + repo.name
+		}
+	}
+	return repo
+}
+
+// Reference is the tag or digest an image reference points at, "latest"
+// when it has neither
+func Reference(ref kube.ImageRef) string {
+	switch {
+	case ref.Digest != "":
+		return "sha256:" + ref.Digest
+	case ref.Tag != "":
+		return ref.Tag
+	}
+	return "latest"
+}
+
+// Manifest reads the manifest or index at a tag or digest
+func (r *Repository) Manifest(ctx context.Context, reference string) (*Manifest, error) {
+	resp, err := r.get(ctx, "/manifests/"+reference, strings.Join(manifestTypes, ", "))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxManifestBytes))
+	if err != nil {
+		return nil, err
+	}
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %v", err)
+	}
+	m.Digest = resp.Header.Get("Docker-Content-Digest")
+	if m.Digest == "" {
+		m.Digest = fmt.Sprintf("sha256:%x", sha256.Sum256(data))
+	}
+	return &m, nil
+}
+
+// Tags lists the tags of the repository
+func (r *Repository) Tags(ctx context.Context) ([]string, error) {
+	resp, err := r.get(ctx, "/tags/list", "")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var out struct {
+		Tags []string `json:"tags"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxManifestBytes)).Decode(&out); err != nil {
+		return nil, fmt.Errorf("invalid tag list: %v", err)
+	}
+	return out.Tags, nil
+}
+
+// Blob opens a blob. The caller closes it.
+func (r *Repository) Blob(ctx context.Context, digest string) (io.ReadCloser, error) {
+	resp, err := r.get(ctx, "/blobs/"+digest, "")
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// get requests a path under the repository, fetching a token when the
+// registry asks for one. Plain HTTP is only used for registries on localhost.
+func (r *Repository) get(ctx context.Context, path, accept string) (*http.Response, error) {
+	scheme := "https"
+	if host := strings.Split(r.host, ":")[0]; host == "localhost" || host == "127.0.0.1" {
+		scheme = "http"
+	}
+	u := scheme + "://" + r.host + "/v2/" + r.name + path
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+		if err != nil {
+			return nil, err
+		}
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		if r.token != "" {
+			req.Header.Set("Authorization", "Bearer "+r.token)
+		}
+		resp, err := r.client.do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode == http.StatusUnauthorized && attempt == 0 {
+			challenge := resp.Header.Get("WWW-Authenticate")
+			resp.Body.Close()
+			if r.token, err = r.authenticate(ctx, challenge); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if resp.StatusCode == http.StatusNotFound {
+			resp.Body.Close()
+			return nil, fmt.Errorf("%s: %w", u, ErrNotFound)
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, fmt.Errorf("%s returned %d", u, resp.StatusCode)
+		}
+		return resp, nil
+	}
+}
+
+// authenticate gets a pull token from the realm of a Bearer challenge
+func (r *Repository) authenticate(ctx context.Context, challenge string) (string, error) {
+	scheme, params, _ := strings.Cut(challenge, " ")
+	if !strings.EqualFold(scheme, "Bearer") {
+		return "", fmt.Errorf("%s wants %q authentication, only Bearer tokens are supported", r.host, scheme)
+	}
+	attrs := make(map[string]string)
+	for _, p := range strings.Split(params, ",") {
+		if k, v, ok := strings.Cut(strings.TrimSpace(p), "="); ok {
+			attrs[k] = strings.Trim(v, `"`)
+		}
+	}
+	realm, err := url.Parse(attrs["realm"])
+	if err != nil || realm.Host == "" {
+		return "", fmt.Errorf("%s sent an invalid token realm %q", r.host, attrs["realm"])
+	}
+	q := realm.Query()
+	if attrs["service"] != "" {
+		q.Set("service", attrs["service"])
+	}
+	q.Set("scope", "repository:"+r.name+":pull")
+	realm.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", realm.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	if r.client.username != "" {
+		req.SetBasicAuth(r.client.username, r.client.password)
+	}
+	resp, err := r.client.do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s token request returned %d", r.host, resp.StatusCode)
+	}
+	var out struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return "", fmt.Errorf("invalid token response: %v", err)
+	}
+	if out.Token == "" {
+		out.Token = out.AccessToken
+	}
+	return out.Token, nil
+}
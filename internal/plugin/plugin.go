@@ -0,0 +1,71 @@
+// Package plugin runs external programs that extend OpTrack with site-specific
+// registries and notification channels. Each call starts the program, writes
+// one JSON request to its stdin and reads one JSON response from its stdout.
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// DefaultTimeout bounds a plugin call when the command sets no timeout
+const DefaultTimeout = 10 * time.Second
+
+// maxStderr is how much of a failing plugin's stderr is kept for the error
+const maxStderr = 512
+
+// Command is an external program and the arguments it is started with
+type Command struct {
+	Path    string
+	Args    []string
+	Timeout time.Duration
+}
+
+// Call runs the command with request as JSON on stdin and decodes its stdout
+// into response, which may be nil for plugins that answer nothing. A non-zero
+// exit status is an error carrying the start of the plugin's stderr.
+func (c Command) Call(ctx context.Context, request, response interface{}) error {
+	input, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, c.Path, c.Args...)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return fmt.Errorf("plugin %s timed out after %s", c.Path, timeout)
+		}
+		msg := strings.TrimSpace(stderr.String())
+		if len(msg) > maxStderr {
+			msg = msg[:maxStderr] + "..."
+		}
+		if msg == "" {
+			return fmt.Errorf("plugin %s failed: %v", c.Path, err)
+		}
+		return fmt.Errorf("plugin %s failed: %v: %s", c.Path, err, msg)
+	}
+
+	if response == nil {
+		return nil
+	}
+	if err := json.Unmarshal(stdout.Bytes(), response); err != nil {
+		return fmt.Errorf("plugin %s returned invalid JSON: %v", c.Path, err)
+	}
+	return nil
+}
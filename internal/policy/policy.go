@@ -0,0 +1,310 @@
+// Package policy checks operators against a compliance policy: how old
+// their latest image may be, whether it must be signed and have provenance,
+// which registries it may come from, which base images are banned and how
+// many vulnerabilities it may have
+package policy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"OpTrack/internal/clock"
+	"OpTrack/internal/registry"
+)
+
+// ErrNotConfigured is returned when compliance is asked for but no policy
+// file is configured
+var ErrNotConfigured = errors.New("no policy configured")
+
+// baseImageLabel names the base image of an image, as buildah and docker
+// buildx record it
+const baseImageLabel = "org.opencontainers.image.base.name"
+
+// The checks a rule makes, as reported in violations
+const (
+	CheckStatus          = "status"
+	CheckAge             = "maxAge"
+	CheckSignature       = "signature"
+	CheckProvenance      = "provenance"
+	CheckRegistry        = "registry"
+	CheckBaseImage       = "baseImage"
+	CheckVulnerabilities = "vulnerabilities"
+)
+
+// Policy is a list of rules, each applying to the operators it matches
+type Policy struct {
+	Rules []Rule `yaml:"rules" json:"rules"`
+}
+
+// Rule is a set of requirements. Requirements left unset aren't checked.
+type Rule struct {
+	Name               string         `yaml:"name" json:"name"`
+	Operators          []string       `yaml:"operators" json:"operators,omitempty"` // Glob patterns; every operator when empty
+	MaxAge             Duration       `yaml:"maxAge" json:"maxAge,omitempty"`
+	RequireSignature   bool           `yaml:"requireSignature" json:"requireSignature,omitempty"`
+	RequireProvenance  bool           `yaml:"requireProvenance" json:"requireProvenance,omitempty"`
+	AllowedRegistries  []string       `yaml:"allowedRegistries" json:"allowedRegistries,omitempty"`   // Glob patterns of registry/namespace/repository
+	BannedBaseImages   []string       `yaml:"bannedBaseImages" json:"bannedBaseImages,omitempty"`     // Glob patterns of base image references
+	MaxVulnerabilities map[string]int `yaml:"maxVulnerabilities" json:"maxVulnerabilities,omitempty"` // By severity
+}
+
+// Duration is a Go duration, or a number of days such as "30d"
+type Duration time.Duration
+
+func (d *Duration) UnmarshalYAML(node *yaml.Node) error {
+	v, err := ParseDuration(node.Value)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// ParseDuration reads a Go duration, or a number of days such as "30d"
+func ParseDuration(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(s)
+}
+
+// Load reads and validates a policy file
+func Load(file string) (*Policy, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var p Policy
+	if err := yaml.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", file, err)
+	}
+	if err := p.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	return &p, nil
+}
+
+func (p *Policy) validate() error {
+	var problems []string
+	add := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+	for i := range p.Rules {
+		r := &p.Rules[i]
+		if r.Name == "" {
+			r.Name = fmt.Sprintf("rule %d", i+1)
+		}
+		for _, patterns := range [][]string{r.Operators, r.AllowedRegistries, r.BannedBaseImages} {
+			for _, pattern := range patterns {
+				if _, err := path.Match(pattern, ""); err != nil {
+					add("%s: invalid pattern %q", r.Name, pattern)
+				}
+			}
+		}
+		if r.MaxAge < 0 {
+			add("%s: maxAge must not be negative", r.Name)
+		}
+		for sev, n := range r.MaxVulnerabilities {
+			if !slices.Contains(registry.Severities, sev) {
+				add("%s: maxVulnerabilities: unknown severity %q, use %s", r.Name, sev, strings.Join(registry.Severities, ", "))
+			}
+			if n < 0 {
+				add("%s: maxVulnerabilities.%s must not be negative", r.Name, sev)
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// applies reports whether a rule applies to an operator
+func (r Rule) applies(operator string) bool {
+	if len(r.Operators) == 0 {
+		return true
+	}
+	return matchAny(r.Operators, operator)
+}
+
+func matchAny(patterns []string, s string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, s); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Registry looks up the latest image of operators and its labels
+type Registry interface {
+	GetStatuses(operators []string) []registry.Status
+	ManifestLabels(operator, digest string) (map[string]string, error)
+}
+
+// Result is whether an operator complies with the policy, and why not
+type Result struct {
+	Operator   string      `json:"operator"`
+	Compliant  bool        `json:"compliant"`
+	Latest     string      `json:"latest,omitempty"`    // sha256 of the latest image
+	BaseImage  string      `json:"baseImage,omitempty"` // When the image labels name it
+	Rules      []string    `json:"rules"`               // The rules that apply
+	Violations []Violation `json:"violations,omitempty"`
+}
+
+// Violation is a requirement of a rule an operator doesn't meet
+type Violation struct {
+	Rule   string `json:"rule"`
+	Check  string `json:"check"` // One of the Check constants
+	Reason string `json:"reason"`
+}
+
+// Checker checks operators against the policy in a file, which Reload reads again
+type Checker struct {
+	file     string
+	host     string // The registry operators' images are on, e.g. quay.io
+	registry Registry
+	clock    clock.Clock
+
+	mu     sync.RWMutex
+	policy *Policy
+}
+
+// New loads the policy in file. host is the registry allowedRegistries are
+// matched against, with the operator appended.
+func New(file, host string, reg Registry, clk clock.Clock) (*Checker, error) {
+	p, err := Load(file)
+	if err != nil {
+		return nil, err
+	}
+	return &Checker{file: file, host: host, registry: reg, clock: clock.Or(clk), policy: p}, nil
+}
+
+// Reload reads the policy file again. An invalid policy is rejected and the
+// current one kept.
+func (c *Checker) Reload() error {
+	p, err := Load(c.file)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.policy = p
+	c.mu.Unlock()
+	return nil
+}
+
+// Rules returns the number of rules in the policy
+func (c *Checker) Rules() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.policy.Rules)
+}
+
+// Check checks every operator against the rules that apply to it
+func (c *Checker) Check(ctx context.Context, operators []string) []Result {
+	c.mu.RLock()
+	p := c.policy
+	c.mu.RUnlock()
+
+	now := c.clock.Now()
+	statuses := c.registry.GetStatuses(operators)
+	results := make([]Result, 0, len(statuses))
+	for _, status := range statuses {
+		results = append(results, c.check(p, status, now))
+	}
+	return results
+}
+
+func (c *Checker) check(p *Policy, status registry.Status, now time.Time) Result {
+	result := Result{Operator: status.Name, Rules: []string{}}
+	if status.Status == "OK" {
+		result.Latest = status.SHA256
+	}
+	var baseRead bool
+	for _, rule := range p.Rules {
+		if !rule.applies(status.Name) {
+			continue
+		}
+		result.Rules = append(result.Rules, rule.Name)
+		violate := func(check, format string, args ...interface{}) {
+			result.Violations = append(result.Violations, Violation{Rule: rule.Name, Check: check, Reason: fmt.Sprintf(format, args...)})
+		}
+
+		if len(rule.AllowedRegistries) > 0 {
+			if image := c.host + "/" + status.Name; !matchAny(rule.AllowedRegistries, image) {
+				violate(CheckRegistry, "%s isn't on an allowed registry", image)
+			}
+		}
+		if status.Status != "OK" {
+			violate(CheckStatus, "the latest image couldn't be determined: %s", status.Status)
+			continue
+		}
+		if rule.MaxAge > 0 {
+			if age := now.Sub(status.LastUpdated); age > time.Duration(rule.MaxAge) {
+				violate(CheckAge, "the latest image is %d days old, more than %d", int(age.Hours()/24), int(time.Duration(rule.MaxAge).Hours()/24))
+			}
+		}
+		if rule.RequireSignature {
+			switch {
+			case status.Signature == nil:
+				violate(CheckSignature, "signatures aren't verified")
+			case status.Signature.State != registry.Signed:
+				violate(CheckSignature, "the latest image is %s", status.Signature.State)
+			}
+		}
+		if rule.RequireProvenance {
+			switch {
+			case status.Provenance == nil:
+				violate(CheckProvenance, "provenance isn't verified")
+			case status.Provenance.State != registry.Verified:
+				violate(CheckProvenance, "the provenance of the latest image is %s", status.Provenance.State)
+			}
+		}
+		if len(rule.BannedBaseImages) > 0 {
+			if !baseRead {
+				result.BaseImage = c.baseImage(status)
+				baseRead = true
+			}
+			if result.BaseImage != "" && matchAny(rule.BannedBaseImages, result.BaseImage) {
+				violate(CheckBaseImage, "the latest image is built on %s, which is banned", result.BaseImage)
+			}
+		}
+		if len(rule.MaxVulnerabilities) > 0 {
+			if status.Scan == nil {
+				violate(CheckVulnerabilities, "the latest image hasn't been scanned")
+			} else {
+				for _, sev := range registry.Severities {
+					if max, ok := rule.MaxVulnerabilities[sev]; ok && status.Scan.Counts[sev] > max {
+						violate(CheckVulnerabilities, "%d %s vulnerabilities, more than %d", status.Scan.Counts[sev], sev, max)
+					}
+				}
+			}
+		}
+	}
+	result.Compliant = len(result.Violations) == 0
+	return result
+}
+
+// baseImage reads the base image of the latest image from its labels, ""
+// when they don't name it
+func (c *Checker) baseImage(status registry.Status) string {
+	labels, err := c.registry.ManifestLabels(status.Name, status.SHA256)
+	if err != nil {
+		return ""
+	}
+	return labels[baseImageLabel]
+}
@@ -0,0 +1,103 @@
+package registry
+
+import (
+	"sync"
+	"time"
+
+	"OpTrack/internal/clock"
+)
+
+// Circuit breaker states
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half-open"
+)
+
+// CircuitBreaker stops calls to a failing dependency for a cooldown period
+// after too many consecutive failures, then lets a single trial call through
+type CircuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	state    string
+	failures int
+	openedAt time.Time
+	trial    bool // A half-open trial call is in flight
+
+	onChange func(state string) // Optional, called with the lock held on every state change
+	clock    clock.Clock
+}
+
+func NewCircuitBreaker(threshold int, cooldown time.Duration, onChange func(state string)) *CircuitBreaker {
+	return &CircuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		state:     BreakerClosed,
+		onChange:  onChange,
+		clock:     clock.System,
+	}
+}
+
+// Allow reports whether a call may be made now
+func (b *CircuitBreaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		if b.clock.Now().Sub(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.setState(BreakerHalfOpen)
+		b.trial = true
+		return true
+	case BreakerHalfOpen:
+		if b.trial {
+			return false
+		}
+		b.trial = true
+		return true
+	}
+	return true
+}
+
+func (b *CircuitBreaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures = 0
+	b.trial = false
+	b.setState(BreakerClosed)
+}
+
+func (b *CircuitBreaker) Failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	b.trial = false
+	if b.state == BreakerHalfOpen || b.failures >= b.threshold {
+		b.openedAt = b.clock.Now()
+		b.setState(BreakerOpen)
+	}
+}
+
+// State returns the breaker state and, when open, when it will next allow a trial
+func (b *CircuitBreaker) State() (string, time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == BreakerOpen {
+		return b.state, b.openedAt.Add(b.cooldown)
+	}
+	return b.state, time.Time{}
+}
+
+func (b *CircuitBreaker) setState(state string) {
+	b.state = state
+	if b.onChange != nil {
+		b.onChange(state)
+	}
+}
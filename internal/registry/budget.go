@@ -0,0 +1,132 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"OpTrack/internal/clock"
+)
+
+const (
+	// budgetBurst is how many requests not sent while idle may be sent at once
+	budgetBurst = 10
+	// maxBudgetWait is the longest a request waits for the budget. Later
+	// requests fail straight away rather than piling up behind it.
+	maxBudgetWait = time.Minute
+	// maxRetryAfter bounds the pause a Retry-After header asks for
+	maxRetryAfter = 15 * time.Minute
+	// budgetFloor is the share of the budget requests slow down to at most,
+	// however often Quay.io asks for fewer
+	budgetFloor = 16
+)
+
+// Budget paces requests to Quay.io within a number of requests per minute.
+// When Quay.io answers 429 Too Many Requests, or says no requests remain, the
+// rate is halved, and requests pause for as long as its Retry-After header
+// asks. Each answer that doesn't ask to slow down brings the rate back up by
+// a sixtieth of the budget. A nil Budget sends every request at once.
+type Budget struct {
+	limit    float64 // Requests per minute
+	onChange func(perMinute float64)
+	clock    clock.Clock
+
+	mu   sync.Mutex
+	rate float64   // Requests per minute allowed now
+	next time.Time // When the next request may be sent
+}
+
+// NewBudget returns a Budget of perMinute requests, or nil for no budget when
+// perMinute isn't positive. onChange, which may be nil, is called with the
+// requests per minute allowed whenever that changes.
+func NewBudget(perMinute int, onChange func(perMinute float64), clk clock.Clock) *Budget {
+	if perMinute <= 0 {
+		return nil
+	}
+	if onChange == nil {
+		onChange = func(float64) {}
+	}
+	b := &Budget{limit: float64(perMinute), rate: float64(perMinute), onChange: onChange, clock: clock.Or(clk)}
+	onChange(b.rate)
+	return b
+}
+
+// Wait blocks until a request may be sent, failing with
+// ErrRegistryUnavailable when that is more than maxBudgetWait away, or with
+// the error of ctx when it is done first
+func (b *Budget) Wait(ctx context.Context) error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	now := b.clock.Now()
+	interval := time.Duration(float64(time.Minute) / b.rate)
+	if earliest := now.Add(-budgetBurst * interval); b.next.Before(earliest) {
+		b.next = earliest
+	}
+	wait := max(b.next.Sub(now), 0)
+	if wait > maxBudgetWait {
+		b.mu.Unlock()
+		return fmt.Errorf("%w: over the request budget for %s", ErrRegistryUnavailable, wait.Round(time.Second))
+	}
+	b.next = b.next.Add(interval)
+	b.mu.Unlock()
+	if wait == 0 {
+		return ctx.Err()
+	}
+	timer := b.clock.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Observe adjusts the rate to a Quay.io response
+func (b *Budget) Observe(resp *http.Response) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	rate := b.rate
+	if resp.StatusCode == http.StatusTooManyRequests || resp.Header.Get("X-RateLimit-Remaining") == "0" {
+		b.rate = max(b.rate/2, b.limit/budgetFloor, 1)
+		if pause := retryAfter(resp.Header.Get("Retry-After"), b.clock.Now()); pause > 0 {
+			b.next = maxTime(b.next, b.clock.Now().Add(min(pause, maxRetryAfter)))
+		}
+	} else {
+		b.rate = min(b.rate+b.limit/60, b.limit)
+	}
+	changed, rate := b.rate != rate, b.rate
+	b.mu.Unlock()
+	if changed {
+		b.onChange(rate)
+	}
+}
+
+// retryAfter parses a Retry-After header, in seconds or as an HTTP date,
+// returning 0 when there is none
+func retryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return t.Sub(now)
+	}
+	return 0
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,189 @@
+package registry
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrInvalidPin is returned for pinned digests that aren't sha256 digests
+	ErrInvalidPin = errors.New("invalid pinned digest, expected sha256:<64 hex digits>")
+	// ErrPinsUnsupported is returned for pinned digests when lookups go
+	// through a Source, which only reports the latest image
+	ErrPinsUnsupported = errors.New("pinned digests can only be checked with the Quay.io API")
+)
+
+// pinPattern matches a sha256 digest in hex
+var pinPattern = regexp.MustCompile(`^[a-f0-9]{64}$`)
+
+// Pinned digest states; a pinned image that is gone is Missing
+const (
+	Tagged   = "tagged"   // Tags still point at the digest
+	Untagged = "untagged" // The image is there but every tag has moved away, so it may be garbage-collected
+)
+
+// maxPinPages bounds the pages of active tags searched for a pinned digest
+const maxPinPages = 10
+
+// Pin is whether the digest an operator is pinned to is still in the registry
+type Pin struct {
+	Operator string    `json:"operator"`
+	Digest   string    `json:"digest"`           // sha256 hex, without the "sha256:" prefix
+	State    string    `json:"state,omitempty"`  // One of the pinned digest states, unless the check failed
+	Tags     []string  `json:"tags,omitempty"`   // The active tags pointing at the digest
+	Latest   string    `json:"latest,omitempty"` // sha256 of the latest image, when it isn't the pinned one
+	Checked  time.Time `json:"checked"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// pageResponse is a page of the Quay.io tag list
+type pageResponse struct {
+	Tags          []TagInfo `json:"tags"`
+	HasAdditional bool      `json:"has_additional"`
+}
+
+// SplitPins moves the digests operators are pinned to, as in
+// namespace/repository@sha256:<digest>, into pins, keyed by operator as sha256
+// hex. Pins of operators that aren't listed are dropped, and digests that
+// aren't sha256 fail with ErrInvalidPin.
+func SplitPins(operators []string, pins map[string]string) ([]string, map[string]string, error) {
+	names := make([]string, len(operators))
+	split := make(map[string]string)
+	var invalid []string
+	for i, operator := range operators {
+		name, digest, pinned := strings.Cut(operator, "@")
+		names[i] = name
+		if !pinned {
+			digest, pinned = pins[name]
+		}
+		if !pinned {
+			continue
+		}
+		digest = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(digest)), "sha256:")
+		if !pinPattern.MatchString(digest) {
+			invalid = append(invalid, operator)
+			continue
+		}
+		split[name] = digest
+	}
+	if len(invalid) > 0 {
+		return nil, nil, fmt.Errorf("%w: %s", ErrInvalidPin, strings.Join(invalid, ", "))
+	}
+	if len(split) == 0 {
+		split = nil
+	}
+	return names, split, nil
+}
+
+// CheckPins checks the pinned digests of a ticket's operators, in the order
+// of operators. Failed checks have an Error rather than a State.
+func (c *Client) CheckPins(operators []string, pins map[string]string) []Pin {
+	results := []Pin{}
+	for _, operator := range operators {
+		digest, ok := pins[operator]
+		if !ok {
+			continue
+		}
+		pin, err := c.CheckPin(operator, digest)
+		if err != nil {
+			pin = &Pin{Operator: operator, Digest: digest, Checked: c.clock.Now(), Error: err.Error()}
+		}
+		results = append(results, *pin)
+	}
+	return results
+}
+
+// CheckPin looks for the active tags pointing at an operator's pinned digest
+// and, when there are none, whether the image is still there
+func (c *Client) CheckPin(operator, digest string) (*Pin, error) {
+	if c.source != nil {
+		return nil, ErrPinsUnsupported
+	}
+	parts := strings.Split(operator, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return nil, ErrInvalidOperator
+	}
+	pin := &Pin{Operator: operator, Digest: digest, Checked: c.clock.Now()}
+
+	base := fmt.Sprintf("%s/api/v1/repository/%s/%s", c.BaseURL, parts[0], parts[1])
+	var latest time.Time
+	for page := 1; page <= maxPinPages; page++ {
+		var tags pageResponse
+		status, err := c.getJSON(fmt.Sprintf("%s/tag/?onlyActiveTags=true&limit=100&page=%d", base, page), &tags)
+		if err != nil {
+			return nil, err
+		}
+		if status != http.StatusOK {
+			return nil, fmt.Errorf("Quay.io error: %d", status)
+		}
+		for _, tag := range tags.Tags {
+			d := strings.TrimPrefix(tag.ManifestDigest, "sha256:")
+			if d == digest {
+				pin.Tags = append(pin.Tags, tag.Name)
+			}
+			if t, err := time.Parse(time.RFC1123Z, tag.LastModified); err == nil && t.After(latest) {
+				latest, pin.Latest = t, d
+			}
+		}
+		if !tags.HasAdditional {
+			break
+		}
+	}
+	if pin.Latest == digest {
+		pin.Latest = ""
+	}
+	if len(pin.Tags) > 0 {
+		pin.State = Tagged
+		return pin, nil
+	}
+
+	status, err := c.getJSON(fmt.Sprintf("%s/manifest/sha256:%s", base, digest), nil)
+	switch {
+	case err != nil:
+		return nil, err
+	case status == http.StatusOK:
+		pin.State = Untagged
+	case status == http.StatusNotFound:
+		pin.State = Missing
+	default:
+		return nil, fmt.Errorf("Quay.io error: %d", status)
+	}
+	return pin, nil
+}
+
+// getJSON reads a Quay.io API response into v, unless v is nil, returning
+// the status of any answer; only a 200 response is read
+func (c *Client) getJSON(url string, v interface{}) (int, error) {
+	if !c.Breaker.Allow() {
+		return 0, fmt.Errorf("%w, retrying shortly", ErrRegistryUnavailable)
+	}
+	if err := c.waitBudget(); err != nil {
+		return 0, err
+	}
+	start := time.Now()
+	resp, err := c.get(url)
+	if err != nil {
+		c.recordOutcome(start, "error", false)
+		return 0, fmt.Errorf("%w: failed to connect", ErrRegistryUnavailable)
+	}
+	defer resp.Body.Close()
+	c.budget.Observe(resp)
+	answered := resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests
+	c.recordOutcome(start, strconv.Itoa(resp.StatusCode), answered)
+	if !answered {
+		return 0, fmt.Errorf("%w: error %d", ErrRegistryUnavailable, resp.StatusCode)
+	}
+	if resp.StatusCode != http.StatusOK || v == nil {
+		return resp.StatusCode, nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return 0, fmt.Errorf("invalid Quay.io response: %v", err)
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,964 @@
+// Package registry looks up the latest image of operators on Quay.io, or on
+// another registry through a Source
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+
+	"OpTrack/internal/clock"
+)
+
+var (
+	// ErrInvalidOperator is returned for operator names that aren't namespace/repository
+	ErrInvalidOperator = errors.New("invalid operator name, expected namespace/repository")
+	// ErrRegistryUnavailable is returned when Quay.io can't be reached or fails
+	// to answer, including while the circuit breaker is open
+	ErrRegistryUnavailable = errors.New("Quay.io unavailable")
+	// ErrLabelsUnsupported is returned for image labels when lookups go
+	// through a Source, which only reports the latest image
+	ErrLabelsUnsupported = errors.New("image labels can only be read from the Quay.io API")
+)
+
+// TagInfo represents a single tag in the Quay.io API response
+type TagInfo struct {
+	Name           string `json:"name"`
+	LastModified   string `json:"last_modified"`
+	ManifestDigest string `json:"manifest_digest"`
+}
+
+// TagResponse represents the Quay.io API response
+type TagResponse struct {
+	Tags []TagInfo `json:"tags"`
+}
+
+// Status represents the status of an operator in Quay.io
+type Status struct {
+	Name        string      `json:"name"`
+	LastUpdated time.Time   `json:"lastUpdated"`
+	SHA256      string      `json:"sha256"`
+	Status      string      `json:"status"`
+	Tags        []string    `json:"tags,omitempty"`       // The tags of the latest image, when the source reports them
+	Build       *Build      `json:"build,omitempty"`      // The build that produced the latest image, when one is found
+	Signature   *Signature  `json:"signature,omitempty"`  // Whether the latest image is signed, when signatures are verified
+	Scan        *Scan       `json:"scan,omitempty"`       // The vulnerabilities of the latest image, once it has been scanned
+	Provenance  *Provenance `json:"provenance,omitempty"` // How the latest image was built, when provenance is verified
+	BaseImage   *BaseImage  `json:"baseImage,omitempty"`  // What the latest image is built on, when base images are checked
+	// The details of the operator's entry on a ticket, in a ticket's statuses
+	DisplayName string `json:"displayName,omitempty"`
+	Owner       string `json:"owner,omitempty"`
+	Note        string `json:"note,omitempty"`
+	Criticality string `json:"criticality,omitempty"` // critical, normal or low, from the operator inventory
+	Team        string `json:"team,omitempty"`        // Owning team, from the operator inventory
+	Contact     string `json:"contact,omitempty"`     // How to reach the team, from the operator inventory
+	// ExpectedBy is the day a fixed build is expected, as YYYY-MM-DD. Until
+	// the operator is rebuilt, DaysLeft counts down to it and goes negative
+	// once Overdue.
+	ExpectedBy string `json:"expectedBy,omitempty"`
+	DaysLeft   *int   `json:"daysLeft,omitempty"`
+	Overdue    bool   `json:"overdue,omitempty"`
+}
+
+// Build is the build system's record of the build that produced an image
+type Build struct {
+	System    string     `json:"system"` // e.g. "konflux" or "osbs"
+	ID        string     `json:"id"`     // The PipelineRun name or Koji build ID
+	NVR       string     `json:"nvr,omitempty"`
+	Component string     `json:"component,omitempty"`
+	Pipeline  string     `json:"pipeline,omitempty"` // The pipeline or build target that ran it
+	Completed *time.Time `json:"completed,omitempty"`
+	URL       string     `json:"url,omitempty"`
+}
+
+// BuildLookup finds the build that produced an image, given the image's
+// labels when the registry reports them. A nil Build means none was found.
+type BuildLookup interface {
+	Build(operator, digest string, labels map[string]string) (*Build, error)
+}
+
+// Signature states
+const (
+	Signed   = "signed"   // Signed by a trusted key or identity
+	Unsigned = "unsigned" // Without any signature
+	Invalid  = "invalid"  // Only with signatures that aren't trusted or don't verify
+)
+
+// Signature is the verdict on the signatures of an image
+type Signature struct {
+	State  string `json:"state"`
+	Signer string `json:"signer,omitempty"` // The key or identity it was signed by
+	Error  string `json:"error,omitempty"`  // Why the signatures found don't count
+}
+
+// SignatureVerifier checks the signatures of an image. An error means the
+// signatures couldn't be read, not that they are invalid.
+type SignatureVerifier interface {
+	Verify(operator, digest string) (*Signature, error)
+}
+
+// Provenance states; provenance that doesn't verify is Invalid
+const (
+	Verified = "verified" // Signed by a trusted key or identity, and built by a trusted builder
+	Missing  = "missing"  // Without any SLSA provenance
+)
+
+// Provenance is the verdict on the SLSA provenance attested for an image
+type Provenance struct {
+	State         string `json:"state"`
+	PredicateType string `json:"predicateType,omitempty"` // e.g. https://slsa.dev/provenance/v1
+	Builder       string `json:"builder,omitempty"`       // The builder ID
+	Source        string `json:"source,omitempty"`        // The repository the image was built from
+	Revision      string `json:"revision,omitempty"`      // The commit it was built from
+	Signer        string `json:"signer,omitempty"`        // The key or identity the provenance was signed by
+	Error         string `json:"error,omitempty"`         // Why the provenance found doesn't count
+}
+
+// ProvenanceVerifier checks the provenance attested for an image. An error
+// means the attestations couldn't be read, not that they are invalid.
+type ProvenanceVerifier interface {
+	Provenance(operator, digest string) (*Provenance, error)
+}
+
+// Vulnerability severities, from the most severe
+const (
+	Critical = "critical"
+	High     = "high"
+	Medium   = "medium"
+	Low      = "low"
+	Unknown  = "unknown"
+)
+
+// Severities lists the vulnerability severities from the most severe
+var Severities = []string{Critical, High, Medium, Low, Unknown}
+
+// Scan is the result of a vulnerability scan of an image
+type Scan struct {
+	Scanner   string         `json:"scanner"` // e.g. "trivy" or "grype"
+	Completed time.Time      `json:"completed"`
+	Counts    map[string]int `json:"counts"`             // Vulnerabilities found by severity
+	Findings  []Finding      `json:"findings,omitempty"` // The most severe vulnerabilities
+	IDs       []string       `json:"-"`                  // Every vulnerability found, with the CVE IDs of those found under another ID
+}
+
+// Finding is a vulnerability of a package in an image
+type Finding struct {
+	ID           string `json:"id"` // e.g. a CVE or GHSA ID
+	Severity     string `json:"severity"`
+	Package      string `json:"package"`
+	Version      string `json:"version"`
+	FixedVersion string `json:"fixedVersion,omitempty"`
+	Title        string `json:"title,omitempty"`
+	URL          string `json:"url,omitempty"`
+}
+
+// VulnerabilityScanner scans an image for vulnerabilities. Scans may take
+// minutes, so they are run in the background.
+type VulnerabilityScanner interface {
+	Scan(operator, digest string) (*Scan, error)
+}
+
+// Base image states; a base that can't be identified is Unknown
+const (
+	Current  = "current"  // Built on the newest image of its base
+	Outdated = "outdated" // Built on an older image of its base
+)
+
+// BaseImage is the base an image was built on, and whether a newer image of
+// it has been published since
+type BaseImage struct {
+	State  string `json:"state"`
+	Name   string `json:"name,omitempty"`   // e.g. registry.access.redhat.com/ubi9/ubi-minimal:latest
+	Tag    string `json:"tag,omitempty"`    // The tag of the older base the image is built on, when known
+	Digest string `json:"digest,omitempty"` // The base image it is built on, when known
+	Latest string `json:"latest,omitempty"` // The newest image of the base
+}
+
+// BaseImageChecker identifies the base of an image. An error means the
+// images couldn't be read, not that the base is unknown.
+type BaseImageChecker interface {
+	BaseImage(operator, digest string) (*BaseImage, error)
+}
+
+// Observer is told about cache lookups and requests, for metrics and SLO tracking
+type Observer interface {
+	CacheLookup(hit bool)
+	// SharedLookup reports a cache miss answered by another caller's request
+	SharedLookup()
+	// StaleLookup reports an expired entry answered while it is looked up
+	// again in the background
+	StaleLookup()
+	// Request reports one Quay.io request. result is the HTTP status code, or
+	// "error" when no response arrived; ok is false when Quay.io itself failed.
+	Request(start time.Time, duration time.Duration, result string, ok bool)
+	BreakerState(state string)
+	// BudgetRate reports the requests per minute the Budget allows, whenever
+	// that changes
+	BudgetRate(perMinute float64)
+}
+
+// Source looks operators up on a registry other than Quay.io. Failures are
+// errors; answers such as "not found" are a Status other than "OK".
+type Source interface {
+	Lookup(operator string) (*Status, error)
+}
+
+// Options configures a Client
+type Options struct {
+	URL      string
+	Timeout  time.Duration
+	CacheTTL time.Duration
+	// StaleTTL is how long after CacheTTL an entry is still answered,
+	// straight away, while it is looked up again in the background; 0 waits
+	// for the lookup
+	StaleTTL   time.Duration
+	Source     Source             // Replaces the Quay.io API when set
+	Builds     BuildLookup        // Attaches builds to the statuses of new images when set
+	Signatures SignatureVerifier  // Attaches signature verdicts to the statuses of new images when set
+	Scanner    Scanning           // Attaches vulnerability scans to the statuses of images when set
+	Provenance ProvenanceVerifier // Attaches provenance verdicts to the statuses of new images when set
+	BaseImages BaseImageChecker   // Attaches base images to the statuses of images when set
+	Clock      clock.Clock        // Times cache entries and the breaker cooldown; defaults to the system clock
+
+	// After BreakerThreshold consecutive failures, lookups fail fast for BreakerCooldown
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+
+	// RequestsPerMinute is the Budget of requests to Quay.io, 0 for none.
+	// Budget, when set, is used instead, so clients of Quay.io other than
+	// this one can share it.
+	RequestsPerMinute int
+	Budget            *Budget
+
+	// Connections to the registry, left at Go's defaults when zero: idle
+	// connections kept per host, the TLS handshake timeout and the interval
+	// between TCP keep-alive probes
+	MaxIdleConnsPerHost int
+	TLSHandshakeTimeout time.Duration
+	KeepAlive           time.Duration
+	// Transport, when set, is used instead of one with the settings above
+	Transport http.RoundTripper
+}
+
+// Scanning is how images are scanned for vulnerabilities
+type Scanning struct {
+	Scanner     VulnerabilityScanner
+	Interval    time.Duration // How long a scan is reused before the image is scanned again
+	Concurrency int           // Scans run at once; defaults to 1
+}
+
+type cachedStatus struct {
+	status  Status
+	expires time.Time
+}
+
+// Client handles communication with Quay.io API
+type Client struct {
+	HTTPClient *http.Client
+	Breaker    *CircuitBreaker
+	BaseURL    string
+
+	budget   *Budget
+	observer Observer
+	source   Source
+	builds   BuildLookup
+	verifier SignatureVerifier
+	attested ProvenanceVerifier
+	bases    BaseImageChecker
+	scanning Scanning
+	clock    clock.Clock
+
+	// ctx is cancelled by Close, ending requests and waits for the budget
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// cacheTTL is how long a successful operator lookup is reused, so the poller
+	// and concurrent page loads don't query Quay.io for the same repository,
+	// and staleTTL how much longer it is answered while it is refreshed
+	cacheTTL time.Duration
+	staleTTL time.Duration
+	cacheMu  sync.Mutex
+	cache    map[string]cachedStatus
+
+	// lookups lets concurrent callers for the same operator share one request
+	lookups singleflight.Group
+
+	// labels holds the labels of images by digest, which never change
+	labelsMu sync.Mutex
+	labels   map[string]map[string]string
+
+	// found holds the build of each image digest; misses are retried after buildMissTTL
+	buildsMu sync.Mutex
+	found    map[string]cachedBuild
+
+	// verified holds the signature verdict of each image digest; verdicts
+	// other than signed are checked again after signatureRecheckTTL
+	verifiedMu sync.Mutex
+	verified   map[string]cachedSignature
+
+	// provenances holds the provenance verdict of each image digest; verdicts
+	// other than verified are checked again after signatureRecheckTTL
+	provenancesMu sync.Mutex
+	provenances   map[string]cachedProvenance
+
+	// baseImages holds the base image of each image digest, which is checked
+	// again after baseImageRecheckTTL as newer bases are published
+	baseImagesMu sync.Mutex
+	baseImages   map[string]cachedBaseImage
+
+	// scans holds the latest scan of each image digest, which is kept while
+	// the image is scanned again every scanning.Interval. Scans run in the
+	// background, at most scanning.Concurrency at once.
+	scansMu   sync.Mutex
+	scans     map[string]cachedScan
+	scanSlots chan struct{}
+}
+
+type cachedProvenance struct {
+	provenance *Provenance
+	expires    time.Time // Zero for verified provenance
+}
+
+type cachedBaseImage struct {
+	base    *BaseImage
+	expires time.Time
+}
+
+// baseImageRecheckTTL is how long the base of an image is reused
+const baseImageRecheckTTL = time.Hour
+
+type cachedScan struct {
+	scan     *Scan
+	expires  time.Time
+	scanning bool
+}
+
+// scanRetryTTL is how long an image whose scan failed is left alone
+const scanRetryTTL = 10 * time.Minute
+
+type cachedSignature struct {
+	signature *Signature
+	expires   time.Time // Zero for signed images
+}
+
+// signatureRecheckTTL is how long an image that isn't signed is left alone,
+// so a signature pushed after the image is picked up
+const signatureRecheckTTL = 10 * time.Minute
+
+type cachedBuild struct {
+	build   *Build
+	expires time.Time // Zero for builds that were found
+}
+
+// buildMissTTL is how long an image without a known build is left alone, so
+// build systems that record builds late still get asked again
+const buildMissTTL = 10 * time.Minute
+
+// NewTransport is Go's default transport with the connection settings of
+// opts. Its two idle connections per host make a refresh of many operators
+// open a new connection, and TLS handshake, for most lookups.
+func NewTransport(opts Options) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if opts.MaxIdleConnsPerHost > 0 {
+		transport.MaxIdleConnsPerHost = opts.MaxIdleConnsPerHost
+		transport.MaxIdleConns = max(transport.MaxIdleConns, opts.MaxIdleConnsPerHost)
+	}
+	if opts.TLSHandshakeTimeout > 0 {
+		transport.TLSHandshakeTimeout = opts.TLSHandshakeTimeout
+	}
+	if opts.KeepAlive > 0 {
+		dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: opts.KeepAlive}
+		transport.DialContext = dialer.DialContext
+	}
+	return transport
+}
+
+// New returns a client reporting to observer, which may be nil
+func New(opts Options, observer Observer) *Client {
+	if observer == nil {
+		observer = nopObserver{}
+	}
+	breaker := NewCircuitBreaker(opts.BreakerThreshold, opts.BreakerCooldown, observer.BreakerState)
+	breaker.clock = clock.Or(opts.Clock)
+	if opts.Scanner.Concurrency <= 0 {
+		opts.Scanner.Concurrency = 1
+	}
+	if opts.Budget == nil {
+		opts.Budget = NewBudget(opts.RequestsPerMinute, observer.BudgetRate, breaker.clock)
+	}
+	if opts.Transport == nil {
+		opts.Transport = NewTransport(opts)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Client{
+		HTTPClient:  &http.Client{Timeout: opts.Timeout, Transport: opts.Transport},
+		Breaker:     breaker,
+		budget:      opts.Budget,
+		ctx:         ctx,
+		cancel:      cancel,
+		BaseURL:     strings.TrimSuffix(opts.URL, "/"),
+		observer:    observer,
+		source:      opts.Source,
+		builds:      opts.Builds,
+		verifier:    opts.Signatures,
+		attested:    opts.Provenance,
+		bases:       opts.BaseImages,
+		scanning:    opts.Scanner,
+		clock:       breaker.clock,
+		cacheTTL:    opts.CacheTTL,
+		staleTTL:    opts.StaleTTL,
+		cache:       make(map[string]cachedStatus),
+		labels:      make(map[string]map[string]string),
+		found:       make(map[string]cachedBuild),
+		verified:    make(map[string]cachedSignature),
+		provenances: make(map[string]cachedProvenance),
+		baseImages:  make(map[string]cachedBaseImage),
+		scans:       make(map[string]cachedScan),
+		scanSlots:   make(chan struct{}, opts.Scanner.Concurrency),
+	}
+}
+
+// Close ends the requests to Quay.io in flight, and those waiting for the
+// budget, for shutdown. Lookups after it fail with ErrRegistryUnavailable.
+func (c *Client) Close() {
+	c.cancel()
+}
+
+// Closed reports whether Close was called, so lookups that failed since are
+// known to be cut short rather than answered by Quay.io
+func (c *Client) Closed() bool {
+	return c.ctx.Err() != nil
+}
+
+// waitBudget waits until the budget allows a request
+func (c *Client) waitBudget() error {
+	if err := c.budget.Wait(c.ctx); err != nil {
+		if c.ctx.Err() != nil {
+			return fmt.Errorf("%w: shutting down", ErrRegistryUnavailable)
+		}
+		return err
+	}
+	return nil
+}
+
+// get sends a GET request to Quay.io, ended by Close
+func (c *Client) get(url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(c.ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.HTTPClient.Do(req)
+}
+
+type nopObserver struct{}
+
+func (nopObserver) CacheLookup(bool)                               {}
+func (nopObserver) SharedLookup()                                  {}
+func (nopObserver) StaleLookup()                                   {}
+func (nopObserver) Request(time.Time, time.Duration, string, bool) {}
+func (nopObserver) BreakerState(string)                            {}
+func (nopObserver) BudgetRate(float64)                             {}
+
+// GetOperatorStatus returns the latest tag for an operator, from the cache if
+// it was looked up successfully within the cache TTL, or within the stale TTL
+// after that while it is looked up again in the background. It fails with
+// ErrInvalidOperator or ErrRegistryUnavailable; other problems, such as a
+// repository that doesn't exist, are reported in the Status.
+func (c *Client) GetOperatorStatus(operator string) (*Status, error) {
+	return c.getOperatorStatus(operator, true)
+}
+
+func (c *Client) getOperatorStatus(operator string, allowStale bool) (*Status, error) {
+	now := c.clock.Now()
+
+	c.cacheMu.Lock()
+	entry, ok := c.cache[operator]
+	c.cacheMu.Unlock()
+	if ok && now.Before(entry.expires) {
+		c.observer.CacheLookup(true)
+		status := entry.status
+		return &status, nil
+	}
+	if ok && allowStale && now.Before(entry.expires.Add(c.staleTTL)) {
+		c.observer.StaleLookup()
+		c.lookups.DoChan(operator, func() (interface{}, error) { return c.lookup(operator) })
+		status := entry.status
+		return &status, nil
+	}
+	c.observer.CacheLookup(false)
+
+	v, err, shared := c.lookups.Do(operator, func() (interface{}, error) { return c.lookup(operator) })
+	if shared {
+		c.observer.SharedLookup()
+	}
+	if err != nil {
+		return nil, err
+	}
+	status := *v.(*Status) // Each caller gets its own copy
+	return &status, nil
+}
+
+// lookup looks up the latest image of an operator with the details of the
+// image, caching it when it was found. Callers share it through c.lookups.
+func (c *Client) lookup(operator string) (*Status, error) {
+	status, err := c.fetchOperatorStatus(operator)
+	if err == nil && status.Status == "OK" && c.builds != nil {
+		status.Build = c.build(operator, status.SHA256)
+	}
+	if err == nil && status.Status == "OK" && c.verifier != nil {
+		status.Signature = c.signature(operator, status.SHA256)
+	}
+	if err == nil && status.Status == "OK" && c.attested != nil {
+		status.Provenance = c.provenance(operator, status.SHA256)
+	}
+	if err == nil && status.Status == "OK" && c.bases != nil {
+		status.BaseImage = c.baseImage(operator, status.SHA256)
+	}
+	if err == nil && status.Status == "OK" && c.scanning.Scanner != nil {
+		status.Scan = c.scan(operator, status.SHA256)
+	}
+	if err == nil && status.Status == "OK" && c.cacheTTL > 0 {
+		now := c.clock.Now()
+		c.cacheMu.Lock()
+		c.cache[operator] = cachedStatus{status: *status, expires: now.Add(c.cacheTTL)}
+		for name, e := range c.cache {
+			if now.After(e.expires.Add(c.staleTTL)) {
+				delete(c.cache, name)
+			}
+		}
+		c.cacheMu.Unlock()
+	}
+	return status, err
+}
+
+// GetStatuses looks up every operator, in order. Lookups that fail are
+// reported in the operator's Status rather than as an error.
+func (c *Client) GetStatuses(operators []string) []Status {
+	return c.getStatuses(operators, true)
+}
+
+func (c *Client) getStatuses(operators []string, allowStale bool) []Status {
+	statuses := make([]Status, 0, len(operators))
+	for _, operator := range operators {
+		status, err := c.getOperatorStatus(operator, allowStale)
+		switch {
+		case errors.Is(err, ErrInvalidOperator), errors.Is(err, ErrRegistryUnavailable):
+			status = &Status{Name: operator, Status: err.Error()}
+		case err != nil:
+			slog.Error("Failed to get operator status", "operator", operator, "error", err)
+			status = &Status{
+				Name:   operator,
+				Status: fmt.Sprintf("Error: %v", err),
+			}
+		}
+		statuses = append(statuses, *status)
+	}
+	return statuses
+}
+
+// CacheSize returns the number of cached operator statuses
+func (c *Client) CacheSize() int {
+	c.cacheMu.Lock()
+	defer c.cacheMu.Unlock()
+	return len(c.cache)
+}
+
+// CacheEntry is a cached operator status, as saved across restarts
+type CacheEntry struct {
+	Operator string    `json:"operator"`
+	Status   Status    `json:"status"`
+	Expires  time.Time `json:"expires"`
+}
+
+// CacheEntries returns the cached operator statuses, sorted by operator
+func (c *Client) CacheEntries() []CacheEntry {
+	c.cacheMu.Lock()
+	defer c.cacheMu.Unlock()
+	entries := make([]CacheEntry, 0, len(c.cache))
+	for operator, e := range c.cache {
+		entries = append(entries, CacheEntry{Operator: operator, Status: e.status, Expires: e.expires})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Operator < entries[j].Operator })
+	return entries
+}
+
+// LoadCache adds saved statuses to the cache, skipping those too old to be
+// answered even while stale and those the cache already has, returning how
+// many it added
+func (c *Client) LoadCache(entries []CacheEntry) int {
+	if c.cacheTTL <= 0 {
+		return 0
+	}
+	now := c.clock.Now()
+	c.cacheMu.Lock()
+	defer c.cacheMu.Unlock()
+	loaded := 0
+	for _, e := range entries {
+		if _, ok := c.cache[e.Operator]; ok || !now.Before(e.Expires.Add(c.staleTTL)) {
+			continue
+		}
+		c.cache[e.Operator] = cachedStatus{status: e.Status, expires: e.Expires}
+		loaded++
+	}
+	return loaded
+}
+
+// FreshClient is a Client that waits for expired entries to be looked up
+// again rather than answering them stale, for callers such as the poller
+// that must see new images as soon as the cache expires
+type FreshClient struct {
+	*Client
+}
+
+func (c FreshClient) GetOperatorStatus(operator string) (*Status, error) {
+	return c.getOperatorStatus(operator, false)
+}
+
+func (c FreshClient) GetStatuses(operators []string) []Status {
+	return c.getStatuses(operators, false)
+}
+
+// recordOutcome feeds the result of a Quay.io request to the circuit breaker
+// and the observer. Client errors such as 404 count as success since Quay.io
+// itself answered correctly.
+func (c *Client) recordOutcome(start time.Time, result string, ok bool) {
+	c.observer.Request(start, time.Since(start), result, ok)
+	if ok {
+		c.Breaker.Success()
+	} else {
+		c.Breaker.Failure()
+	}
+}
+
+func (c *Client) fetchOperatorStatus(operator string) (*Status, error) {
+	parts := strings.Split(operator, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return nil, ErrInvalidOperator
+	}
+
+	namespace, repository := parts[0], parts[1]
+	url := fmt.Sprintf("%s/api/v1/repository/%s/%s/tag/", c.BaseURL, namespace, repository)
+
+	if !c.Breaker.Allow() {
+		return nil, fmt.Errorf("%w, retrying shortly", ErrRegistryUnavailable)
+	}
+	if c.source != nil {
+		return c.lookupSource(operator)
+	}
+
+	if err := c.waitBudget(); err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	resp, err := c.get(url)
+	if err != nil {
+		c.recordOutcome(start, "error", false)
+		slog.Warn("Quay.io request failed", "operator", operator, "error", err)
+		return nil, fmt.Errorf("%w: failed to connect", ErrRegistryUnavailable)
+	}
+	defer resp.Body.Close()
+	c.budget.Observe(resp)
+	answered := resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests
+	c.recordOutcome(start, strconv.Itoa(resp.StatusCode), answered)
+
+	if !answered {
+		return nil, fmt.Errorf("%w: error %d", ErrRegistryUnavailable, resp.StatusCode)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return &Status{
+			Name:   operator,
+			Status: fmt.Sprintf("Quay.io error: %d", resp.StatusCode),
+		}, nil
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to read response: %v", ErrRegistryUnavailable, err)
+	}
+
+	slog.Debug("Received Quay.io response", "operator", operator, "bytes", len(body))
+
+	var tagResponse TagResponse
+	if err := json.Unmarshal(body, &tagResponse); err != nil {
+		slog.Warn("Failed to parse Quay.io response", "operator", operator, "error", err)
+		return &Status{
+			Name:   operator,
+			Status: fmt.Sprintf("Parse error: %v", err),
+		}, nil
+	}
+
+	if len(tagResponse.Tags) == 0 {
+		return &Status{
+			Name:   operator,
+			Status: "No tags found",
+		}, nil
+	}
+
+	// Find the most recent tag
+	var latestTag TagInfo
+	latestTime := time.Time{}
+
+	for _, tag := range tagResponse.Tags {
+		tagTime, err := time.Parse(time.RFC1123Z, tag.LastModified)
+		if err != nil {
+			slog.Warn("Failed to parse tag timestamp", "operator", operator, "tag", tag.Name, "value", tag.LastModified, "error", err)
+			continue
+		}
+		if tagTime.After(latestTime) {
+			latestTime = tagTime
+			latestTag = tag
+		}
+	}
+
+	if latestTime.IsZero() {
+		return &Status{
+			Name:   operator,
+			Status: "No valid timestamps found",
+		}, nil
+	}
+
+	var tags []string
+	for _, tag := range tagResponse.Tags {
+		if tag.ManifestDigest == latestTag.ManifestDigest {
+			tags = append(tags, tag.Name)
+		}
+	}
+
+	return &Status{
+		Name:        operator,
+		LastUpdated: latestTime,
+		SHA256:      strings.TrimPrefix(latestTag.ManifestDigest, "sha256:"),
+		Status:      "OK",
+		Tags:        tags,
+	}, nil
+}
+
+// labelResponse is the Quay.io manifest labels response
+type labelResponse struct {
+	Labels []struct {
+		Key   string `json:"key"`
+		Value string `json:"value"`
+	} `json:"labels"`
+}
+
+// ManifestLabels returns the labels of an operator's image with the given
+// sha256 digest, such as vcs-ref. It fails with ErrLabelsUnsupported when a
+// Source replaces the Quay.io API.
+func (c *Client) ManifestLabels(operator, digest string) (map[string]string, error) {
+	if c.source != nil {
+		return nil, ErrLabelsUnsupported
+	}
+	parts := strings.Split(operator, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return nil, ErrInvalidOperator
+	}
+	c.labelsMu.Lock()
+	labels, ok := c.labels[digest]
+	c.labelsMu.Unlock()
+	if ok {
+		return labels, nil
+	}
+
+	if !c.Breaker.Allow() {
+		return nil, fmt.Errorf("%w, retrying shortly", ErrRegistryUnavailable)
+	}
+	url := fmt.Sprintf("%s/api/v1/repository/%s/%s/manifest/sha256:%s/labels", c.BaseURL, parts[0], parts[1], digest)
+	if err := c.waitBudget(); err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	resp, err := c.get(url)
+	if err != nil {
+		c.recordOutcome(start, "error", false)
+		return nil, fmt.Errorf("%w: failed to connect", ErrRegistryUnavailable)
+	}
+	defer resp.Body.Close()
+	c.budget.Observe(resp)
+	answered := resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests
+	c.recordOutcome(start, strconv.Itoa(resp.StatusCode), answered)
+	if !answered {
+		return nil, fmt.Errorf("%w: error %d", ErrRegistryUnavailable, resp.StatusCode)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Quay.io error: %d", resp.StatusCode)
+	}
+
+	var body labelResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("invalid labels response: %v", err)
+	}
+	labels = make(map[string]string, len(body.Labels))
+	for _, l := range body.Labels {
+		labels[l.Key] = l.Value
+	}
+	c.labelsMu.Lock()
+	c.labels[digest] = labels
+	c.labelsMu.Unlock()
+	return labels, nil
+}
+
+// build finds the build of an image, once per digest. Lookup failures are
+// logged rather than failing the status.
+func (c *Client) build(operator, digest string) *Build {
+	now := c.clock.Now()
+	c.buildsMu.Lock()
+	entry, ok := c.found[digest]
+	c.buildsMu.Unlock()
+	if ok && (entry.expires.IsZero() || now.Before(entry.expires)) {
+		return entry.build
+	}
+
+	labels, err := c.ManifestLabels(operator, digest)
+	if err != nil && !errors.Is(err, ErrLabelsUnsupported) {
+		slog.Warn("Failed to read image labels", "operator", operator, "digest", digest, "error", err)
+	}
+	build, err := c.builds.Build(operator, digest, labels)
+	if err != nil {
+		slog.Warn("Build lookup failed", "operator", operator, "digest", digest, "error", err)
+		return nil
+	}
+	entry = cachedBuild{build: build}
+	if build == nil {
+		entry.expires = now.Add(buildMissTTL)
+	}
+	c.buildsMu.Lock()
+	c.found[digest] = entry
+	c.buildsMu.Unlock()
+	return build
+}
+
+// signature verifies the signatures of an image, once per digest for signed
+// images. Failures to read them are logged and leave the verdict out.
+func (c *Client) signature(operator, digest string) *Signature {
+	now := c.clock.Now()
+	c.verifiedMu.Lock()
+	entry, ok := c.verified[digest]
+	c.verifiedMu.Unlock()
+	if ok && (entry.expires.IsZero() || now.Before(entry.expires)) {
+		return entry.signature
+	}
+
+	signature, err := c.verifier.Verify(operator, digest)
+	if err != nil {
+		slog.Warn("Signature verification failed", "operator", operator, "digest", digest, "error", err)
+		return nil
+	}
+	entry = cachedSignature{signature: signature}
+	if signature.State != Signed {
+		entry.expires = now.Add(signatureRecheckTTL)
+	}
+	c.verifiedMu.Lock()
+	c.verified[digest] = entry
+	c.verifiedMu.Unlock()
+	return signature
+}
+
+// provenance verifies the provenance of an image, once per digest for
+// verified provenance. Failures to read it are logged and leave the verdict out.
+func (c *Client) provenance(operator, digest string) *Provenance {
+	now := c.clock.Now()
+	c.provenancesMu.Lock()
+	entry, ok := c.provenances[digest]
+	c.provenancesMu.Unlock()
+	if ok && (entry.expires.IsZero() || now.Before(entry.expires)) {
+		return entry.provenance
+	}
+
+	provenance, err := c.attested.Provenance(operator, digest)
+	if err != nil {
+		slog.Warn("Provenance verification failed", "operator", operator, "digest", digest, "error", err)
+		return nil
+	}
+	entry = cachedProvenance{provenance: provenance}
+	if provenance.State != Verified {
+		entry.expires = now.Add(signatureRecheckTTL)
+	}
+	c.provenancesMu.Lock()
+	c.provenances[digest] = entry
+	c.provenancesMu.Unlock()
+	return provenance
+}
+
+// baseImage identifies the base of an image, again every baseImageRecheckTTL.
+// Failures to read the images are logged and leave the base out.
+func (c *Client) baseImage(operator, digest string) *BaseImage {
+	now := c.clock.Now()
+	c.baseImagesMu.Lock()
+	entry, ok := c.baseImages[digest]
+	c.baseImagesMu.Unlock()
+	if ok && now.Before(entry.expires) {
+		return entry.base
+	}
+
+	base, err := c.bases.BaseImage(operator, digest)
+	if err != nil {
+		slog.Warn("Base image check failed", "operator", operator, "digest", digest, "error", err)
+		return nil
+	}
+	c.baseImagesMu.Lock()
+	c.baseImages[digest] = cachedBaseImage{base: base, expires: now.Add(baseImageRecheckTTL)}
+	c.baseImagesMu.Unlock()
+	return base
+}
+
+// scan returns the latest scan of an image, starting a scan in the background
+// when there is none yet or it is older than the scanning interval. Failed
+// scans are logged and retried after scanRetryTTL.
+func (c *Client) scan(operator, digest string) *Scan {
+	now := c.clock.Now()
+	c.scansMu.Lock()
+	defer c.scansMu.Unlock()
+	entry := c.scans[digest]
+	if entry.scanning || (!entry.expires.IsZero() && now.Before(entry.expires)) {
+		return entry.scan
+	}
+	entry.scanning = true
+	c.scans[digest] = entry
+
+	go func() {
+		c.scanSlots <- struct{}{}
+		scan, err := c.scanning.Scanner.Scan(operator, digest)
+		<-c.scanSlots
+
+		c.scansMu.Lock()
+		defer c.scansMu.Unlock()
+		entry := c.scans[digest]
+		entry.scanning = false
+		if err != nil {
+			slog.Warn("Vulnerability scan failed", "operator", operator, "digest", digest, "error", err)
+			entry.expires = c.clock.Now().Add(scanRetryTTL)
+		} else {
+			entry.scan = scan
+			entry.expires = c.clock.Now().Add(c.scanning.Interval)
+		}
+		c.scans[digest] = entry
+	}()
+	return entry.scan
+}
+
+// lookupSource asks the configured Source instead of Quay.io. Its failures
+// count towards the circuit breaker like failed Quay.io requests.
+func (c *Client) lookupSource(operator string) (*Status, error) {
+	start := time.Now()
+	status, err := c.source.Lookup(operator)
+	if err != nil {
+		c.recordOutcome(start, "error", false)
+		slog.Warn("Registry lookup failed", "operator", operator, "error", err)
+		return nil, fmt.Errorf("%w: lookup failed", ErrRegistryUnavailable)
+	}
+	c.recordOutcome(start, "source", true)
+	status.Name = operator
+	return status, nil
+}
@@ -0,0 +1,74 @@
+// Package router maps requests to handlers by method and path, with path
+// parameters such as /api/v1/tickets/{id}
+package router
+
+import "net/http"
+
+// Router is what the server registers its routes on. Patterns use the
+// net/http ServeMux syntax, "[METHOD ]/path/{param}", and handlers read
+// parameters with r.PathValue, so any router that accepts the same syntax
+// can be swapped in.
+type Router interface {
+	http.Handler
+	Handle(pattern string, handler http.Handler)
+	HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request))
+	// Route returns the pattern that matches r, or "" if none does
+	Route(r *http.Request) string
+}
+
+// ErrorHandler writes the response for a request no route takes: status is
+// 404 when no pattern matches the path and 405 when none allows the method
+type ErrorHandler func(w http.ResponseWriter, r *http.Request, status int)
+
+// New returns a Router backed by http.ServeMux. onError, if not nil, replaces
+// the mux's plain text 404 and 405 responses.
+func New(onError ErrorHandler) Router {
+	return &serveMux{ServeMux: http.NewServeMux(), onError: onError}
+}
+
+type serveMux struct {
+	*http.ServeMux
+	onError ErrorHandler
+}
+
+func (m *serveMux) Route(r *http.Request) string {
+	_, pattern := m.Handler(r)
+	return pattern
+}
+
+func (m *serveMux) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if m.onError != nil && m.Route(r) == "" {
+		w = &errorWriter{ResponseWriter: w, r: r, onError: m.onError}
+	}
+	m.ServeMux.ServeHTTP(w, r)
+}
+
+// errorWriter hands the mux's own 404 and 405 responses to an ErrorHandler,
+// keeping the Allow header the mux sets for a 405
+type errorWriter struct {
+	http.ResponseWriter
+	r       *http.Request
+	onError ErrorHandler
+	handled bool
+}
+
+func (w *errorWriter) WriteHeader(status int) {
+	if w.handled {
+		return
+	}
+	if status != http.StatusNotFound && status != http.StatusMethodNotAllowed {
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+	w.handled = true
+	w.Header().Del("Content-Type")
+	w.Header().Del("X-Content-Type-Options")
+	w.onError(w.ResponseWriter, w.r, status)
+}
+
+func (w *errorWriter) Write(p []byte) (int, error) {
+	if w.handled {
+		return len(p), nil // Drop the mux's own error text
+	}
+	return w.ResponseWriter.Write(p)
+}
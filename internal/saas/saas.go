@@ -0,0 +1,398 @@
+// Package saas reads app-interface SaaS files and compares the commits their
+// targets are promoted to with the latest image of each operator
+package saas
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"OpTrack/internal/clock"
+	"OpTrack/internal/kube"
+	"OpTrack/internal/registry"
+)
+
+// ErrNoSources is returned when promotion is asked for but no SaaS files are configured
+var ErrNoSources = errors.New("no SaaS files configured")
+
+// States of an operator in a SaaS file target
+const (
+	StatePromoted      = "promoted"       // The target's ref is the commit the latest image was built from
+	StateNotPromoted   = "not_promoted"   // The target pins an older commit: built but not promoted
+	StateFollowsBranch = "follows_branch" // The target's ref is a branch, so every build is deployed
+	StateNotDeployed   = "not_deployed"   // No SaaS file target deploys the operator
+	StateUnknown       = "unknown"        // The files or registry couldn't be read, or the latest image's tags aren't known
+)
+
+// DefaultTagLength is how many characters of a commit SHA app-interface uses as image tag
+const DefaultTagLength = 7
+
+// DefaultTTL is how long SaaS files are reused before they are read again
+const DefaultTTL = 5 * time.Minute
+
+// fetchTimeout bounds downloading a SaaS file
+const fetchTimeout = 30 * time.Second
+
+// Source is where SaaS files are read from: an http(s) URL of one file, or
+// a file or directory such as an app-interface checkout
+type Source struct {
+	Name      string
+	Location  string
+	Token     string // Sent as a bearer token with URL requests
+	TagLength int    // Characters of a commit SHA in image tags
+}
+
+// File is an app-interface SaaS file, $schema /app-sre/saas-file-2.yml
+type File struct {
+	Schema            string             `yaml:"$schema"`
+	Name              string             `yaml:"name"`
+	ImagePatterns     []string           `yaml:"imagePatterns"`
+	Parameters        Parameters         `yaml:"parameters"`
+	ResourceTemplates []ResourceTemplate `yaml:"resourceTemplates"`
+}
+
+// ResourceTemplate is a deployable template and the targets it is promoted to
+type ResourceTemplate struct {
+	Name       string     `yaml:"name"`
+	URL        string     `yaml:"url"` // The git repository the ref is in
+	Parameters Parameters `yaml:"parameters"`
+	Targets    []Target   `yaml:"targets"`
+}
+
+// Target is a namespace a resource template is deployed to at a git ref
+type Target struct {
+	Name      string `yaml:"name"`
+	Namespace struct {
+		Ref string `yaml:"$ref"`
+	} `yaml:"namespace"`
+	Ref        string     `yaml:"ref"` // A commit SHA, or a branch that is followed
+	Parameters Parameters `yaml:"parameters"`
+	Disable    bool       `yaml:"disable"`
+}
+
+// name is the target's name, or else the name of its namespace file
+func (t Target) name() string {
+	if t.Name != "" {
+		return t.Name
+	}
+	return strings.TrimSuffix(path.Base(t.Namespace.Ref), path.Ext(t.Namespace.Ref))
+}
+
+// Parameters are template parameters. Older SaaS files give them as a JSON
+// string rather than a map.
+type Parameters map[string]string
+
+func (p *Parameters) UnmarshalYAML(node *yaml.Node) error {
+	var raw map[string]interface{}
+	if node.Kind == yaml.ScalarNode {
+		if node.Value == "" {
+			return nil
+		}
+		if err := json.Unmarshal([]byte(node.Value), &raw); err != nil {
+			return fmt.Errorf("line %d: parameters: %v", node.Line, err)
+		}
+	} else if err := node.Decode(&raw); err != nil {
+		return err
+	}
+	*p = make(Parameters, len(raw))
+	for k, v := range raw {
+		(*p)[k] = fmt.Sprint(v)
+	}
+	return nil
+}
+
+// Registry looks up the latest image of operators
+type Registry interface {
+	GetStatuses(operators []string) []registry.Status
+}
+
+// Result is the state of one operator in one SaaS file target
+type Result struct {
+	Source           string   `json:"source"`
+	SaasFile         string   `json:"saasFile,omitempty"`
+	ResourceTemplate string   `json:"resourceTemplate,omitempty"`
+	Target           string   `json:"target,omitempty"`
+	Operator         string   `json:"operator"`
+	State            string   `json:"state"`
+	Ref              string   `json:"ref,omitempty"`    // The target's git ref
+	Tag              string   `json:"tag,omitempty"`    // The image tag the ref deploys
+	Latest           string   `json:"latest,omitempty"` // sha256 of the latest image on the registry
+	LatestTags       []string `json:"latestTags,omitempty"`
+	Error            string   `json:"error,omitempty"`
+}
+
+// Monitor checks operators against SaaS files, reading each source at most
+// once per TTL
+type Monitor struct {
+	sources  []Source
+	registry Registry
+	clock    clock.Clock
+	ttl      time.Duration
+
+	files map[string]*cached // By source name, fixed after New
+}
+
+type cached struct {
+	mu      sync.Mutex
+	fetched time.Time
+	files   []File
+	err     error
+}
+
+func New(sources []Source, reg Registry, clk clock.Clock, ttl time.Duration) *Monitor {
+	m := &Monitor{sources: sources, registry: reg, clock: clock.Or(clk), ttl: ttl, files: make(map[string]*cached)}
+	for _, s := range sources {
+		m.files[s.Name] = &cached{}
+	}
+	return m
+}
+
+// Sources returns the names of the sources checked
+func (m *Monitor) Sources() []string {
+	names := make([]string, len(m.sources))
+	for i, s := range m.sources {
+		names[i] = s.Name
+	}
+	return names
+}
+
+// Check reports every target deploying each operator, ordered by source and
+// then by operator as given. An operator that no target deploys gets one
+// result without a target, in state not_deployed.
+func (m *Monitor) Check(ctx context.Context, operators []string) []Result {
+	statuses := m.registry.GetStatuses(operators)
+	files := make([][]File, len(m.sources))
+	errs := make([]error, len(m.sources))
+	var wg sync.WaitGroup
+	for i, s := range m.sources {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			files[i], errs[i] = m.load(ctx, s)
+		}()
+	}
+	wg.Wait()
+
+	var results []Result
+	for i, s := range m.sources {
+		for _, status := range statuses {
+			if errs[i] != nil {
+				results = append(results, Result{Source: s.Name, Operator: status.Name, State: StateUnknown, Error: errs[i].Error()})
+				continue
+			}
+			found := compare(s, files[i], status)
+			if len(found) == 0 {
+				found = []Result{{Source: s.Name, Operator: status.Name, State: StateNotDeployed}}
+			}
+			results = append(results, found...)
+		}
+	}
+	return results
+}
+
+func (m *Monitor) load(ctx context.Context, s Source) ([]File, error) {
+	c := m.files[s.Name]
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := m.clock.Now()
+	if c.fetched.IsZero() || now.Sub(c.fetched) >= m.ttl {
+		c.files, c.err = load(ctx, s)
+		c.fetched = now
+	}
+	return c.files, c.err
+}
+
+// commitSHA matches a full git commit SHA, as opposed to a branch name
+var commitSHA = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+// compare finds the targets of the resource templates that deploy the operator
+func compare(s Source, files []File, latest registry.Status) []Result {
+	tagLength := s.TagLength
+	if tagLength <= 0 {
+		tagLength = DefaultTagLength
+	}
+	var results []Result
+	for _, f := range files {
+		for _, rt := range f.ResourceTemplates {
+			for _, target := range rt.Targets {
+				if target.Disable {
+					continue
+				}
+				params := merge(f.Parameters, rt.Parameters, target.Parameters)
+				image, ok := deploys(params, f.ImagePatterns, latest.Name)
+				if !ok {
+					continue
+				}
+				res := Result{Source: s.Name, SaasFile: f.Name, ResourceTemplate: rt.Name, Target: target.name(), Operator: latest.Name, Ref: target.Ref, State: StateUnknown}
+				results = append(results, promotion(res, image, params, latest, tagLength))
+			}
+		}
+	}
+	return results
+}
+
+// promotion judges a target by the digest it pins, the IMAGE_TAG it sets or
+// the commit its ref names, in that order
+func promotion(res Result, image kube.ImageRef, params Parameters, latest registry.Status, tagLength int) Result {
+	if latest.Status != "OK" {
+		res.Error = latest.Status
+		return res
+	}
+	res.Latest, res.LatestTags = latest.SHA256, latest.Tags
+
+	if image.Digest != "" {
+		res.State = StateNotPromoted
+		if image.Digest == latest.SHA256 {
+			res.State = StatePromoted
+		}
+		return res
+	}
+	switch {
+	case params["IMAGE_TAG"] != "":
+		res.Tag = params["IMAGE_TAG"]
+	case image.Tag != "":
+		res.Tag = image.Tag
+	case commitSHA.MatchString(res.Ref):
+		res.Tag = res.Ref[:tagLength]
+	default:
+		res.State = StateFollowsBranch
+		return res
+	}
+	if len(latest.Tags) == 0 {
+		res.Error = "the registry didn't report the latest image's tags"
+		return res
+	}
+	res.State = StateNotPromoted
+	for _, tag := range latest.Tags {
+		if tag == res.Tag || tag == res.Ref {
+			res.State = StatePromoted
+		}
+	}
+	return res
+}
+
+// merge layers the SaaS file's, resource template's and target's parameters
+func merge(layers ...Parameters) Parameters {
+	params := make(Parameters)
+	for _, layer := range layers {
+		for k, v := range layer {
+			params[k] = v
+		}
+	}
+	return params
+}
+
+// deploys reports whether a parameter names the operator's image, such as
+// REGISTRY_IMG: quay.io/app-sre/foo, and returns it. A SaaS file's
+// imagePatterns naming exactly the operator's repository count as well.
+func deploys(params Parameters, patterns []string, operator string) (kube.ImageRef, bool) {
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if !strings.Contains(params[k], "/") {
+			continue
+		}
+		if ref := kube.ParseImage(params[k]); ref.Repository == operator {
+			return ref, true
+		}
+	}
+	for _, p := range patterns {
+		if ref := kube.ParseImage(p); ref.Repository == operator {
+			return ref, true
+		}
+	}
+	return kube.ImageRef{}, false
+}
+
+// saasSchema marks SaaS files among the other app-interface data files
+var saasSchema = []byte("/saas-file-")
+
+// load reads the SaaS files of a source. In a directory, YAML files whose
+// $schema isn't a SaaS file schema are skipped.
+func load(ctx context.Context, s Source) ([]File, error) {
+	if strings.HasPrefix(s.Location, "http://") || strings.HasPrefix(s.Location, "https://") {
+		data, err := fetch(ctx, s.Location, s.Token)
+		if err != nil {
+			return nil, err
+		}
+		f, err := parse(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", s.Location, err)
+		}
+		return []File{f}, nil
+	}
+
+	var files []File
+	err := filepath.WalkDir(s.Location, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		if ext := filepath.Ext(p); p != s.Location && ext != ".yml" && ext != ".yaml" {
+			return nil
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		if p != s.Location && !bytes.Contains(data, saasSchema) {
+			return nil
+		}
+		f, err := parse(data)
+		if err != nil {
+			return fmt.Errorf("%s: %v", p, err)
+		}
+		if strings.Contains(f.Schema, string(saasSchema)) || p == s.Location {
+			files = append(files, f)
+		}
+		return nil
+	})
+	return files, err
+}
+
+func parse(data []byte) (File, error) {
+	var f File
+	err := yaml.Unmarshal(data, &f)
+	return f, err
+}
+
+func fetch(ctx context.Context, url, token string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, fetchTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned %d", url, resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 16<<20))
+}
@@ -0,0 +1,265 @@
+// Package scan scans images for vulnerabilities with Trivy or Grype, run
+// locally or, for Trivy, against a remote Trivy server
+package scan
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+
+	"OpTrack/internal/clock"
+	"OpTrack/internal/registry"
+)
+
+// The supported scanners
+const (
+	Trivy = "trivy"
+	Grype = "grype"
+)
+
+// maxStderr is how much of a failing scanner's stderr is kept for the error
+const maxStderr = 512
+
+// Options configures a Scanner
+type Options struct {
+	Scanner  string // Trivy or Grype
+	Command  string // Defaults to the scanner's name, looked up on the PATH
+	Server   string // A Trivy server to scan with, instead of scanning locally
+	Registry string // The registry host operators' images are on, e.g. quay.io
+	Username string // Pulls anonymously when empty
+	Password string
+	Timeout  time.Duration
+	Findings int         // How many of the most severe vulnerabilities are kept
+	Clock    clock.Clock // Dates scans; defaults to the system clock
+}
+
+// Scanner runs scans of images. It is a registry.VulnerabilityScanner.
+type Scanner struct {
+	opts Options
+}
+
+func New(opts Options) *Scanner {
+	if opts.Command == "" {
+		opts.Command = opts.Scanner
+	}
+	opts.Clock = clock.Or(opts.Clock)
+	return &Scanner{opts: opts}
+}
+
+// Scan scans the image of an operator at a digest
+func (s *Scanner) Scan(operator, digest string) (*registry.Scan, error) {
+	image := s.opts.Registry + "/" + operator + "@sha256:" + digest
+	var args, env []string
+	var parse func([]byte) ([]registry.Finding, []string, error)
+	switch s.opts.Scanner {
+	case Grype:
+		args = []string{"registry:" + image, "--output", "json", "--quiet"}
+		if s.opts.Username != "" {
+			env = []string{
+				"GRYPE_REGISTRY_AUTH_AUTHORITY=" + s.opts.Registry,
+				"GRYPE_REGISTRY_AUTH_USERNAME=" + s.opts.Username,
+				"GRYPE_REGISTRY_AUTH_PASSWORD=" + s.opts.Password,
+			}
+		}
+		parse = parseGrype
+	case Trivy:
+		args = []string{"image", "--format", "json", "--quiet", "--scanners", "vuln"}
+		if s.opts.Server != "" {
+			args = append(args, "--server", s.opts.Server)
+		}
+		args = append(args, image)
+		if s.opts.Username != "" {
+			env = []string{"TRIVY_USERNAME=" + s.opts.Username, "TRIVY_PASSWORD=" + s.opts.Password}
+		}
+		parse = parseTrivy
+	default:
+		return nil, fmt.Errorf("unknown scanner %q", s.opts.Scanner)
+	}
+
+	out, err := s.run(args, env)
+	if err != nil {
+		return nil, err
+	}
+	findings, aliases, err := parse(out)
+	if err != nil {
+		return nil, fmt.Errorf("%s returned invalid JSON: %v", s.opts.Scanner, err)
+	}
+	return summarize(s.opts.Scanner, findings, aliases, s.opts.Findings, s.opts.Clock.Now()), nil
+}
+
+// run runs the scanner and returns its stdout. A non-zero exit status is an
+// error carrying the start of the scanner's stderr.
+func (s *Scanner) run(args, env []string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.opts.Timeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, s.opts.Command, args...)
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, fmt.Errorf("%s timed out after %s", s.opts.Scanner, s.opts.Timeout)
+		}
+		msg := strings.TrimSpace(stderr.String())
+		if len(msg) > maxStderr {
+			msg = msg[:maxStderr] + "..."
+		}
+		if msg == "" {
+			return nil, fmt.Errorf("%s failed: %v", s.opts.Scanner, err)
+		}
+		return nil, fmt.Errorf("%s failed: %v: %s", s.opts.Scanner, err, msg)
+	}
+	return stdout.Bytes(), nil
+}
+
+// parseTrivy reads the vulnerabilities of trivy image --format json
+func parseTrivy(data []byte) ([]registry.Finding, []string, error) {
+	var report struct {
+		Results []struct {
+			Vulnerabilities []struct {
+				VulnerabilityID  string
+				PkgName          string
+				InstalledVersion string
+				FixedVersion     string
+				Severity         string
+				Title            string
+				PrimaryURL       string
+			}
+		}
+	}
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, nil, err
+	}
+	var findings []registry.Finding
+	for _, r := range report.Results {
+		for _, v := range r.Vulnerabilities {
+			findings = append(findings, registry.Finding{
+				ID:           v.VulnerabilityID,
+				Severity:     severity(v.Severity),
+				Package:      v.PkgName,
+				Version:      v.InstalledVersion,
+				FixedVersion: v.FixedVersion,
+				Title:        v.Title,
+				URL:          v.PrimaryURL,
+			})
+		}
+	}
+	return findings, nil, nil
+}
+
+// parseGrype reads the vulnerabilities of grype --output json, and the CVE
+// IDs of those it reports under another ID, such as a GHSA ID
+func parseGrype(data []byte) ([]registry.Finding, []string, error) {
+	var report struct {
+		Matches []struct {
+			Vulnerability struct {
+				ID          string `json:"id"`
+				Severity    string `json:"severity"`
+				DataSource  string `json:"dataSource"`
+				Description string `json:"description"`
+				Fix         struct {
+					Versions []string `json:"versions"`
+				} `json:"fix"`
+			} `json:"vulnerability"`
+			RelatedVulnerabilities []struct {
+				ID string `json:"id"`
+			} `json:"relatedVulnerabilities"`
+			Artifact struct {
+				Name    string `json:"name"`
+				Version string `json:"version"`
+			} `json:"artifact"`
+		} `json:"matches"`
+	}
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, nil, err
+	}
+	var findings []registry.Finding
+	var aliases []string
+	for _, m := range report.Matches {
+		for _, related := range m.RelatedVulnerabilities {
+			aliases = append(aliases, related.ID)
+		}
+		findings = append(findings, registry.Finding{
+			ID:           m.Vulnerability.ID,
+			Severity:     severity(m.Vulnerability.Severity),
+			Package:      m.Artifact.Name,
+			Version:      m.Artifact.Version,
+			FixedVersion: strings.Join(m.Vulnerability.Fix.Versions, ", "),
+			Title:        m.Vulnerability.Description,
+			URL:          m.Vulnerability.DataSource,
+		})
+	}
+	return findings, aliases, nil
+}
+
+// severity maps a scanner's severity onto registry's. Grype's "negligible"
+// counts as low.
+func severity(s string) string {
+	switch s = strings.ToLower(s); s {
+	case registry.Critical, registry.High, registry.Medium, registry.Low:
+		return s
+	case "negligible":
+		return registry.Low
+	}
+	return registry.Unknown
+}
+
+// summarize counts the findings by severity, each vulnerability of a package
+// once, and keeps the top ones: the most severe, those with a fix first. The
+// IDs of every finding, and their aliases, are kept too.
+func summarize(scanner string, findings []registry.Finding, aliases []string, top int, completed time.Time) *registry.Scan {
+	scan := &registry.Scan{Scanner: scanner, Completed: completed, Counts: make(map[string]int)}
+	for _, sev := range registry.Severities {
+		scan.Counts[sev] = 0
+	}
+	ids := make(map[string]bool)
+	for _, id := range aliases {
+		ids[id] = true
+	}
+	seen := make(map[string]bool)
+	var unique []registry.Finding
+	for _, f := range findings {
+		ids[f.ID] = true
+		key := f.ID + "\x00" + f.Package + "\x00" + f.Version
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		scan.Counts[f.Severity]++
+		unique = append(unique, f)
+	}
+
+	rank := make(map[string]int)
+	for i, sev := range registry.Severities {
+		rank[sev] = i
+	}
+	sort.SliceStable(unique, func(i, j int) bool {
+		a, b := unique[i], unique[j]
+		if rank[a.Severity] != rank[b.Severity] {
+			return rank[a.Severity] < rank[b.Severity]
+		}
+		if (a.FixedVersion != "") != (b.FixedVersion != "") {
+			return a.FixedVersion != ""
+		}
+		return a.ID < b.ID
+	})
+	if len(unique) > top {
+		unique = unique[:top]
+	}
+	scan.Findings = unique
+	for id := range ids {
+		scan.IDs = append(scan.IDs, id)
+	}
+	sort.Strings(scan.IDs)
+	return scan
+}
@@ -0,0 +1,59 @@
+// Package scheduler runs background work that can be stopped and waited for
+package scheduler
+
+import (
+	"context"
+	"time"
+
+	"OpTrack/internal/clock"
+)
+
+// Job is work that runs until stop is closed
+type Job func(stop <-chan struct{})
+
+// Task is a long-running goroutine that can be stopped and waited for
+type Task struct {
+	stop chan struct{}
+	done chan struct{}
+}
+
+// Start runs job in a goroutine until the task is stopped
+func Start(job Job) *Task {
+	t := &Task{stop: make(chan struct{}), done: make(chan struct{})}
+	go func() {
+		defer close(t.done)
+		job(t.stop)
+	}()
+	return t
+}
+
+// Stop asks the task to finish and waits for it until ctx expires
+func (t *Task) Stop(ctx context.Context) error {
+	close(t.stop)
+	select {
+	case <-t.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Every returns a job that runs cycle immediately and then on every interval
+// of clk until stopped. cycle gets the stop channel so a long cycle can give
+// up early.
+func Every(clk clock.Clock, interval time.Duration, cycle Job) Job {
+	return func(stop <-chan struct{}) {
+		ticker := clk.NewTicker(interval)
+		defer ticker.Stop()
+
+		cycle(stop)
+		for {
+			select {
+			case <-ticker.C:
+				cycle(stop)
+			case <-stop:
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package store
+
+import (
+	"cmp"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// OperatorReport is what saving a ticket did to the operators it was given:
+// entries that turned out to name an operator already on the ticket, and
+// operators whose names are close enough to be typos of each other
+type OperatorReport struct {
+	Merged  []MergedOperator `json:"merged,omitempty"`
+	Similar [][2]string      `json:"similar,omitempty"`
+}
+
+// MergedOperator is an entry that was merged into an earlier one
+type MergedOperator struct {
+	Entry    string `json:"entry"`    // As given
+	Operator string `json:"operator"` // The operator it was merged into
+}
+
+// Empty reports whether nothing was merged or looks alike
+func (r OperatorReport) Empty() bool {
+	return len(r.Merged) == 0 && len(r.Similar) == 0
+}
+
+// schemes are stripped from operators pasted as URLs or pod image IDs
+var schemes = []string{"https://", "http://", "docker://", "docker-pullable://"}
+
+// NormalizeOperator cleans up an operator as pasted: it trims it, strips a
+// URL scheme and trailing slashes, lower-cases a registry host and drops it
+// when it is quay.io, where operators are looked up. Pinned digests are kept.
+func NormalizeOperator(name string) string {
+	name = strings.TrimSpace(name)
+	for _, scheme := range schemes {
+		if len(name) > len(scheme) && strings.EqualFold(name[:len(scheme)], scheme) {
+			name = name[len(scheme):]
+			break
+		}
+	}
+	name, digest, pinned := strings.Cut(name, "@")
+	name = strings.TrimRight(name, "/")
+	if host, rest, ok := strings.Cut(name, "/"); ok && (strings.ContainsAny(host, ".:") || strings.EqualFold(host, "localhost")) {
+		host = strings.ToLower(host)
+		if host == "quay.io" {
+			name = rest
+		} else {
+			name = host + "/" + rest
+		}
+	}
+	if pinned {
+		name += "@" + strings.TrimSpace(digest)
+	}
+	return name
+}
+
+// NormalizeOperators normalizes the names of operators and merges the ones
+// that name the same operator, regardless of case, into the first. The first
+// keeps its spelling and takes the details and pinned digest it lacks from
+// those merged into it. Empty names are dropped, and the members of groups,
+// which aren't saved, are left alone.
+func NormalizeOperators(operators []Operator) ([]Operator, OperatorReport) {
+	var report OperatorReport
+	out := make([]Operator, 0, len(operators))
+	index := make(map[string]int)
+	for _, op := range operators {
+		if op.Group != "" {
+			out = append(out, op)
+			continue
+		}
+		entry := op.Name
+		op.Name = NormalizeOperator(op.Name)
+		if op.Name == "" {
+			continue
+		}
+		base, digest, pinned := strings.Cut(op.Name, "@")
+		key := strings.ToLower(base)
+		i, ok := index[key]
+		if !ok {
+			index[key] = len(out)
+			out = append(out, op)
+			continue
+		}
+		first := &out[i]
+		name, _, firstPinned := strings.Cut(first.Name, "@")
+		if pinned && !firstPinned {
+			first.Name += "@" + digest
+		}
+		first.DisplayName = cmp.Or(first.DisplayName, op.DisplayName)
+		first.Owner = cmp.Or(first.Owner, op.Owner)
+		first.Note = cmp.Or(first.Note, op.Note)
+		first.ExpectedBy = cmp.Or(first.ExpectedBy, op.ExpectedBy)
+		report.Merged = append(report.Merged, MergedOperator{Entry: entry, Operator: name})
+	}
+	report.Similar = similarOperators(out)
+	return out, report
+}
+
+// CheckExpectedBy trims the expected-by dates of operators and returns
+// ErrInvalidExpectedBy for one that isn't a valid day
+func CheckExpectedBy(operators []Operator) error {
+	for i := range operators {
+		op := &operators[i]
+		op.ExpectedBy = strings.TrimSpace(op.ExpectedBy)
+		if op.ExpectedBy == "" {
+			continue
+		}
+		if _, err := time.Parse(DateLayout, op.ExpectedBy); err != nil {
+			return fmt.Errorf("%w: %q for %s", ErrInvalidExpectedBy, op.ExpectedBy, op.Name)
+		}
+	}
+	return nil
+}
+
+// similarOperators returns the pairs of operators whose names are within a
+// couple of edits of each other, allowing fewer edits for short names
+func similarOperators(operators []Operator) [][2]string {
+	var names []string
+	for _, op := range operators {
+		if op.Group == "" {
+			name, _, _ := strings.Cut(op.Name, "@")
+			names = append(names, name)
+		}
+	}
+	var similar [][2]string
+	for i := range names {
+		for j := i + 1; j < len(names); j++ {
+			a, b := strings.ToLower(names[i]), strings.ToLower(names[j])
+			d := levenshtein(a, b)
+			if d > 0 && d <= 2 && d*4 <= min(len(a), len(b)) {
+				similar = append(similar, [2]string{names[i], names[j]})
+			}
+		}
+	}
+	return similar
+}
+
+// levenshtein returns the number of single byte insertions, deletions and
+// substitutions that turn a into b
+func levenshtein(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
@@ -0,0 +1,443 @@
+// Package store persists tickets in the data directory
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+var (
+	// ErrTicketNotFound is returned for ticket IDs that aren't stored
+	ErrTicketNotFound = errors.New("ticket not found")
+	// ErrStorage wraps failures to read or write the data directory
+	ErrStorage = errors.New("storage error")
+	// ErrReadOnly is returned for changes to tickets that are managed elsewhere
+	ErrReadOnly = errors.New("tickets are read-only")
+	// ErrOperatorNotAllowed is returned for tickets with operators outside
+	// the allowed registries and namespaces
+	ErrOperatorNotAllowed = errors.New("operators not allowed")
+	// ErrInvalidLabel is returned for labels with spaces or commas
+	ErrInvalidLabel = errors.New("invalid label")
+	// ErrGroupNotFound is returned for operator group names that aren't defined
+	ErrGroupNotFound = errors.New("operator group not found")
+	// ErrUnknownGroup is returned for tickets including groups that aren't defined
+	ErrUnknownGroup = errors.New("unknown operator group")
+	// ErrOperatorNotFound is returned for operators that were never tracked
+	ErrOperatorNotFound = errors.New("operator not in the inventory")
+	// ErrInvalidThresholds is returned for tickets with thresholds that aren't
+	// durations, or with a warning age that isn't below the stale age
+	ErrInvalidThresholds = errors.New("invalid thresholds")
+	// ErrInvalidExpectedBy is returned for operators expected to be rebuilt
+	// by something other than a date
+	ErrInvalidExpectedBy = errors.New("invalid expected-by date, use YYYY-MM-DD")
+	// ErrTemplateNotFound is returned for ticket template names that aren't defined
+	ErrTemplateNotFound = errors.New("ticket template not found")
+	// ErrTicketExists is returned for new tickets whose ID is already taken
+	ErrTicketExists = errors.New("ticket already exists")
+	// ErrUnknownProject is returned for tickets in projects that aren't configured
+	ErrUnknownProject = errors.New("unknown project")
+	// ErrProjectNotFound is returned for project names that aren't configured
+	ErrProjectNotFound = errors.New("project not found")
+	// ErrTooManyOperators is returned for tickets that would track more
+	// operators than allowed
+	ErrTooManyOperators = errors.New("too many operators")
+	// ErrQuotaExceeded is returned for tickets beyond the quota of tickets
+	// overall, per owner or per project
+	ErrQuotaExceeded = errors.New("ticket quota exceeded")
+	// ErrForbidden is returned for changes to tickets of a project the user
+	// may only see
+	ErrForbidden = errors.New("not an editor of the project")
+)
+
+// Ticket represents a JIRA ticket and its associated operators
+type Ticket struct {
+	ID        string     `json:"id"`
+	Operators []Operator `json:"operators"`
+	Added     time.Time  `json:"added"`           // Operators updated after this count as rebuilt
+	Owner     string     `json:"owner,omitempty"` // Email address notified about this ticket
+	// Project is the project the ticket belongs to, which decides who may see
+	// and change it; empty for tickets shared by everyone
+	Project string `json:"project,omitempty"`
+	// Description says what the ticket is about, for lists of tickets
+	Description string `json:"description,omitempty"`
+	// Labels group tickets, e.g. "monthly" or "osd", as on JIRA
+	Labels []string `json:"labels,omitempty"`
+	// Groups are the operator groups the ticket includes. Their members are
+	// added to Operators when the ticket is loaded, marked with the group,
+	// and left out when it is saved.
+	Groups []string `json:"groups,omitempty"`
+	// Applications are the ArgoCD applications that deploy the operators, as
+	// name or namespace/name
+	Applications []string `json:"applications,omitempty"`
+	// CVEs are the CVE IDs the ticket is about, checked against the
+	// vulnerability scans of the operators' latest images
+	CVEs []string `json:"cves,omitempty"`
+	// Pins are the digests operators are pinned to in deploy configs,
+	// operator -> sha256 hex, audited while the ticket is tracked
+	Pins map[string]string `json:"pins,omitempty"`
+	// Baselines are the digests operators had when they were renamed,
+	// operator -> sha256 hex. An image with that digest doesn't count as
+	// rebuilt, however recently it was pushed under the new name. They are
+	// dropped with Added when the ticket is replaced.
+	Baselines map[string]string `json:"baselines,omitempty"`
+	// Thresholds override the configured warning and stale ages for the
+	// ticket's operators, e.g. for a CVE rebuild that is due sooner
+	Thresholds *Thresholds `json:"thresholds,omitempty"`
+	// Updated is when the ticket last changed. Tickets saved before it was
+	// recorded have Added instead, see LastChanged.
+	Updated *time.Time `json:"updated,omitempty"`
+	// Archived is when the ticket was archived, leaving it out of lists and
+	// polling. It is only changed by archiving and unarchiving the ticket.
+	Archived *time.Time `json:"archived,omitempty"`
+	// Rollup is the state of the ticket as a whole, one of Rollups, as of the
+	// poller's last check of it; empty until it was checked. It is only
+	// changed by the poller, and dropped with Added when the ticket is
+	// replaced.
+	Rollup string `json:"rollup,omitempty"`
+}
+
+// The states of a ticket as a whole, see Ticket.Rollup
+const (
+	RollupComplete   = "complete"    // Every operator was rebuilt
+	RollupInProgress = "in-progress" // Operators are still to be rebuilt
+	RollupBlocked    = "blocked"     // An operator wasn't rebuilt by its expected-by date
+	RollupError      = "error"       // The latest image of an operator couldn't be looked up
+)
+
+// Rollups are the states of a ticket as a whole, the most urgent first
+var Rollups = []string{RollupError, RollupBlocked, RollupInProgress, RollupComplete}
+
+// Thresholds are ages such as "7d" or "36h". Empty ones fall back to the
+// configured thresholds.
+type Thresholds struct {
+	Warning string `json:"warning,omitempty"`
+	Stale   string `json:"stale,omitempty"`
+}
+
+// AtBaseline reports whether digest is the one an operator had when it was
+// renamed, see Baselines
+func (t Ticket) AtBaseline(operator, digest string) bool {
+	baseline, ok := t.Baselines[operator]
+	return ok && baseline == digest
+}
+
+// LastChanged returns when the ticket was last changed
+func (t Ticket) LastChanged() time.Time {
+	if t.Updated != nil {
+		return *t.Updated
+	}
+	return t.Added
+}
+
+// Operator is an operator on a ticket, with optional details for the people
+// following it. Operators without details are stored as their name alone,
+// as they were before details existed, and either form is read.
+type Operator struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName,omitempty"`
+	Owner       string `json:"owner,omitempty"`       // Who to ask about the operator's rebuild
+	Note        string `json:"note,omitempty"`        // e.g. "waits on konflux migration"
+	ExpectedBy  string `json:"expectedBy,omitempty"`  // Day a fixed build is expected, as DateLayout
+	Group       string `json:"group,omitempty"`       // The group it is included through, rather than listed itself
+	Criticality string `json:"criticality,omitempty"` // From the inventory, not saved with the ticket
+	Team        string `json:"team,omitempty"`        // Owning team, from the inventory like Criticality
+	Contact     string `json:"contact,omitempty"`     // How to reach the team, from the inventory like Criticality
+}
+
+// DateLayout is the layout of Operator.ExpectedBy
+const DateLayout = "2006-01-02"
+
+// operatorFields is Operator without its JSON methods
+type operatorFields Operator
+
+func (o Operator) MarshalJSON() ([]byte, error) {
+	if !o.HasDetails() {
+		return json.Marshal(o.Name)
+	}
+	return json.Marshal(operatorFields(o))
+}
+
+func (o *Operator) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		*o = Operator{}
+		return json.Unmarshal(data, &o.Name)
+	}
+	var fields operatorFields
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	if fields.Name == "" {
+		return errors.New("operator without a name")
+	}
+	*o = Operator(fields)
+	return nil
+}
+
+// HasDetails reports whether the operator has more than a name
+func (o Operator) HasDetails() bool {
+	return o.DisplayName != "" || o.Owner != "" || o.Note != "" || o.ExpectedBy != "" || o.Group != "" || o.Criticality != "" || o.Team != "" || o.Contact != ""
+}
+
+// Label is the display name of the operator, or its name
+func (o Operator) Label() string {
+	if o.DisplayName != "" {
+		return o.DisplayName
+	}
+	return o.Name
+}
+
+// OperatorsNamed returns operators with the names and no details
+func OperatorsNamed(names []string) []Operator {
+	if names == nil {
+		return nil
+	}
+	operators := make([]Operator, len(names))
+	for i, name := range names {
+		operators[i] = Operator{Name: name}
+	}
+	return operators
+}
+
+// OperatorNames returns the names of the ticket's operators, in order
+func (t Ticket) OperatorNames() []string {
+	names := make([]string, len(t.Operators))
+	for i, o := range t.Operators {
+		names[i] = o.Name
+	}
+	return names
+}
+
+// SetOperatorNames renames the ticket's operators in order, keeping their
+// details, without changing the slice the ticket shared before
+func (t *Ticket) SetOperatorNames(names []string) {
+	operators := make([]Operator, len(t.Operators))
+	for i, o := range t.Operators {
+		o.Name = names[i]
+		operators[i] = o
+	}
+	t.Operators = operators
+}
+
+// Operator returns the ticket's entry for an operator
+func (t Ticket) Operator(name string) (Operator, bool) {
+	for _, o := range t.Operators {
+		if o.Name == name {
+			return o, true
+		}
+	}
+	return Operator{}, false
+}
+
+// NormalizeLabels trims labels and drops empty and repeated ones. Labels
+// can't have spaces or commas, so lists of them stay unambiguous.
+func NormalizeLabels(labels []string) ([]string, error) {
+	var out, invalid []string
+	for _, label := range labels {
+		label = strings.TrimSpace(label)
+		switch {
+		case label == "" || slices.Contains(out, label):
+		case strings.ContainsFunc(label, func(r rune) bool { return r == ',' || unicode.IsSpace(r) }):
+			invalid = append(invalid, strconv.Quote(label))
+		default:
+			out = append(out, label)
+		}
+	}
+	if len(invalid) > 0 {
+		return nil, fmt.Errorf("%w: %s can't have spaces or commas", ErrInvalidLabel, strings.Join(invalid, ", "))
+	}
+	return out, nil
+}
+
+// Filter selects tickets by owner, labels and project. The zero Filter matches every
+// ticket that isn't archived.
+type Filter struct {
+	Owner   string   // Matched case-insensitively
+	Labels  []string // A ticket must have every one
+	Project string   // Any project when empty
+	// Archived selects archived tickets instead, and IncludeArchived both
+	Archived, IncludeArchived bool
+	// IDs, when not nil, are the only tickets matched, e.g. a user's favorites
+	IDs map[string]bool
+	// Rollups, when not empty, are the states a ticket must be in one of
+	Rollups []string
+}
+
+// Match reports whether a ticket passes the filter
+func (f Filter) Match(t Ticket) bool {
+	if !f.IncludeArchived && (t.Archived != nil) != f.Archived {
+		return false
+	}
+	if f.IDs != nil && !f.IDs[t.ID] {
+		return false
+	}
+	if f.Owner != "" && !strings.EqualFold(f.Owner, t.Owner) {
+		return false
+	}
+	if f.Project != "" && f.Project != t.Project {
+		return false
+	}
+	if len(f.Rollups) > 0 && !slices.Contains(f.Rollups, t.Rollup) {
+		return false
+	}
+	for _, label := range f.Labels {
+		if !slices.Contains(t.Labels, label) {
+			return false
+		}
+	}
+	return true
+}
+
+// Store loads and saves tickets. Callers serialize writes to the same ticket.
+// Failures wrap ErrStorage.
+type Store interface {
+	Load() (map[string]Ticket, error)
+	Save(ticket Ticket) error
+	Delete(id string) error
+}
+
+// FileStore keeps each ticket in <id>.json in the data directory
+type FileStore struct {
+	dir string
+}
+
+// OpenFileStore creates the data directory if needed and checks it is writable
+func OpenFileStore(dir string) (*FileStore, error) {
+	absPath, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve data directory path: %v", err)
+	}
+
+	slog.Info("Initializing data directory", "path", absPath)
+
+	if err := os.MkdirAll(absPath, 0755); err != nil {
+		switch {
+		case os.IsPermission(err):
+			return nil, fmt.Errorf("insufficient permissions to create data directory at %s\nPlease run with appropriate permissions or choose a different location", absPath)
+		case os.IsExist(err):
+			return nil, fmt.Errorf("data directory exists but is not accessible: %s", absPath)
+		default:
+			return nil, fmt.Errorf("failed to create data directory at %s: %v", absPath, err)
+		}
+	}
+
+	// Verify the directory is writable by attempting to create a test file
+	testFile := filepath.Join(absPath, "test.tmp")
+	if err := os.WriteFile(testFile, []byte("test"), 0644); err != nil {
+		return nil, fmt.Errorf("data directory exists but is not writable at %s: %v", absPath, err)
+	}
+	os.Remove(testFile)
+
+	slog.Info("Data directory initialized successfully", "path", absPath)
+	return &FileStore{dir: dir}, nil
+}
+
+// Dir returns the data directory as configured
+func (s *FileStore) Dir() string {
+	return s.dir
+}
+
+// Load reads every ticket file. Files that can't be read are logged and skipped.
+func (s *FileStore) Load() (map[string]Ticket, error) {
+	files, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to list tickets: %v", ErrStorage, err)
+	}
+
+	tickets := make(map[string]Ticket)
+	for _, file := range files {
+		if !file.IsDir() && strings.HasSuffix(file.Name(), ".json") {
+			ticketID := strings.TrimSuffix(file.Name(), ".json")
+			ticket, err := s.load(ticketID)
+			if err != nil {
+				slog.Error("Failed to load ticket", "ticket", ticketID, "error", err)
+				continue
+			}
+			tickets[ticketID] = ticket
+		}
+	}
+	return tickets, nil
+}
+
+func (s *FileStore) load(ticketID string) (Ticket, error) {
+	var ticket Ticket
+	data, err := os.ReadFile(filepath.Join(s.dir, ticketID+".json"))
+	if err != nil {
+		return ticket, err
+	}
+	err = json.Unmarshal(data, &ticket)
+	return ticket, err
+}
+
+func (s *FileStore) Save(ticket Ticket) error {
+	data, err := json.MarshalIndent(ticket, "", "    ")
+	if err != nil {
+		return err
+	}
+	if err := WriteFileAtomic(filepath.Join(s.dir, ticket.ID+".json"), data, 0644); err != nil {
+		return fmt.Errorf("%w: failed to save ticket %s: %v", ErrStorage, ticket.ID, err)
+	}
+	return nil
+}
+
+// Delete removes a ticket's file; deleting a ticket that doesn't exist is not an error
+func (s *FileStore) Delete(id string) error {
+	if err := os.Remove(filepath.Join(s.dir, id+".json")); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("%w: failed to delete ticket %s: %v", ErrStorage, id, err)
+	}
+	return nil
+}
+
+// CheckWritable verifies the data directory can still be written
+func (s *FileStore) CheckWritable() error {
+	f, err := os.CreateTemp(s.dir, ".health-*")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// WriteFileAtomic writes to a temporary file and renames it into place, so a
+// crash mid-write never leaves a truncated file behind
+func WriteFileAtomic(filename string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(filename), "."+filepath.Base(filename)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // No-op once renamed
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filename)
+}
+
+// SettingsDir returns the directory for non-ticket data, creating it if needed.
+// It is kept out of the data directory root so it isn't loaded as tickets.
+func SettingsDir(dataDir string) (string, error) {
+	dir := filepath.Join(dataDir, "settings")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create settings directory: %v", err)
+	}
+	return dir, nil
+}
@@ -0,0 +1,751 @@
+// URL prefix when served behind a reverse proxy, e.g. "/optrack"
+const basePath = document.body.dataset.basePath;
+
+// Timezone to show times in, chosen by the server
+const timezone = document.body.dataset.timezone;
+
+// Age thresholds in days, from the server configuration
+const staleDays = Number(document.body.dataset.staleDays);
+const warningDays = Number(document.body.dataset.warningDays);
+
+// Thresholds of the tickets listed that override the configured ones, by ticket ID
+let ticketThresholds = {};
+
+// thresholdDays converts an age such as "7d" or "36h" to days, or returns
+// fallback for an empty one
+function thresholdDays(value, fallback) {
+    const units = {d: 1, h: 1 / 24, m: 1 / 1440, s: 1 / 86400};
+    let days = 0;
+    let matched = false;
+    (value || '').replace(/(\d+(?:\.\d+)?)([dhms])/g, (_, n, unit) => {
+        days += Number(n) * units[unit];
+        matched = true;
+    });
+    return matched ? days : fallback;
+}
+
+// Set when tickets are managed by the controller, which leaves the UI read-only
+const readOnly = document.body.dataset.readOnly === 'true';
+
+// Column the status table is sorted by on the server, empty for the ticket's order
+let statusSort = {column: '', desc: false};
+
+// Sort of the user's default view, which every ticket's status table starts with
+let defaultSort = {column: '', desc: false};
+
+// IDs of the tickets the user starred
+let favorites = new Set();
+
+// statusColumns are the columns of the status table with the keys the server sorts them by
+const statusColumns = [
+    ['operator', 'Operator'],
+    ['lastUpdated', 'Last Updated'],
+    ['age', 'Days Old'],
+    ['sha256', 'SHA256'],
+    ['status', 'Status'],
+];
+
+function showAddForm() {
+    document.getElementById('addForm').classList.remove('hidden');
+    document.getElementById('statusDisplay').classList.add('hidden');
+}
+
+function addTicket() {
+    const jiraId = document.getElementById('jiraId').value;
+    const operatorsText = document.getElementById('operators').value;
+    const owner = document.getElementById('ownerEmail').value.trim();
+    const applications = document.getElementById('applications').value
+        .split(',')
+        .map(app => app.trim())
+        .filter(app => app.length > 0);
+    const cves = document.getElementById('cves').value
+        .split(',')
+        .map(cve => cve.trim())
+        .filter(cve => cve.length > 0);
+    const labels = document.getElementById('labels').value
+        .split(',')
+        .map(label => label.trim())
+        .filter(label => label.length > 0);
+    const groups = document.getElementById('groups').value
+        .split(',')
+        .map(group => group.trim())
+        .filter(group => group.length > 0);
+    
+    // Split by either commas or newlines and clean up the results
+    const operatorsList = operatorsText
+        .split(/[,\n]/)  // Split by comma or newline
+        .map(op => op.trim())  // Remove whitespace
+        .filter(op => op.length > 0);  // Remove empty entries
+    
+    fetch(basePath + '/api/tickets', {
+        method: 'POST',
+        headers: {'Content-Type': 'application/json'},
+        body: JSON.stringify({
+            id: jiraId,
+            operators: operatorsList,
+            owner: owner,
+            project: document.getElementById('project').value,
+            description: document.getElementById('description').value.trim(),
+            labels: labels,
+            groups: groups,
+            applications: applications,
+            cves: cves
+        })
+    })
+    .then(response => response.json())
+    .then(data => {
+        reportOperators(data.normalized);
+        loadTickets();
+        document.getElementById('jiraId').value = '';
+        document.getElementById('operators').value = '';
+        document.getElementById('ownerEmail').value = '';
+        document.getElementById('description').value = '';
+        document.getElementById('labels').value = '';
+        document.getElementById('groups').value = '';
+        document.getElementById('applications').value = '';
+        document.getElementById('cves').value = '';
+    });
+}
+
+// reportOperators tells the user which of the operators they entered were
+// merged into others, and which look like typos of each other
+function reportOperators(report) {
+    if (!report) {
+        return;
+    }
+    const lines = (report.merged || []).map(m => m.entry + ' is the same operator as ' + m.operator + ', tracking it once');
+    (report.similar || []).forEach(pair => lines.push(pair[0] + ' and ' + pair[1] + ' look alike, is one of them a typo?'));
+    alert(lines.join('\n'));
+}
+
+function deleteTicket(event, ticketId) {
+    event.stopPropagation();
+    if (confirm('Are you sure you want to delete this ticket?')) {
+        fetch(basePath + '/api/tickets?id=' + encodeURIComponent(ticketId), {
+            method: 'DELETE'
+        })
+        .then(response => {
+            if (response.ok) {
+                loadTickets();
+                document.getElementById('statusDisplay').innerHTML = '';
+            }
+        });
+    }
+}
+
+function archiveTicket(event, ticketId, archived) {
+    event.stopPropagation();
+    fetch(basePath + '/api/v1/tickets/' + encodeURIComponent(ticketId) + (archived ? '/archive' : '/unarchive'), {
+        method: 'POST'
+    })
+    .then(response => {
+        if (response.ok) {
+            loadTickets();
+        }
+    });
+}
+
+// loadTickets lists the tickets matching the filter box: an owner when it
+// has an email address, and otherwise comma-separated labels. Archived
+// tickets are listed instead of the others while the box below is ticked,
+// and only starred ones while the favorites box is. The project select
+// narrows the list to one project. They all start out as the user's default
+// view, so the server isn't asked to apply it again.
+function loadTickets() {
+    const filter = document.getElementById('ticketFilter').value.trim();
+    const archived = document.getElementById('showArchived').checked;
+    const query = new URLSearchParams({view: 'none'});
+    if (filter.includes('@')) {
+        query.set('owner', filter);
+    } else if (filter) {
+        query.set('label', filter);
+    }
+    const project = document.getElementById('projectFilter').value;
+    if (project) {
+        query.set('project', project);
+    }
+    if (archived) {
+        query.set('archived', 'true');
+    }
+    if (document.getElementById('showFavorites').checked) {
+        query.set('favorites', 'true');
+    }
+    fetch(basePath + '/api/tickets?' + query)
+    .then(response => response.json())
+    .then(tickets => {
+        const list = document.getElementById('ticketList');
+        list.innerHTML = '';
+        ticketThresholds = {};
+        Object.entries(tickets).forEach(([id, ticket]) => {
+            if (ticket.thresholds) {
+                ticketThresholds[id] = ticket.thresholds;
+            }
+            const div = document.createElement('div');
+            div.className = 'ticket-item';
+            
+            const nameSpan = document.createElement('span');
+            nameSpan.className = 'ticket-name';
+            nameSpan.textContent = id;
+            nameSpan.title = ticket.description || '';
+            nameSpan.onclick = () => loadStatus(id);
+            if (ticket.project) {
+                const projectSpan = document.createElement('span');
+                projectSpan.className = 'ticket-labels';
+                projectSpan.textContent = ticket.project;
+                nameSpan.appendChild(projectSpan);
+            }
+            if (ticket.labels) {
+                const labelsSpan = document.createElement('span');
+                labelsSpan.className = 'ticket-labels';
+                labelsSpan.textContent = ticket.labels.join(', ');
+                nameSpan.appendChild(labelsSpan);
+            }
+            
+            const starBtn = document.createElement('span');
+            starBtn.className = 'star-btn';
+            starBtn.textContent = favorites.has(id) ? '★' : '☆';
+            starBtn.title = favorites.has(id) ? 'Remove from favorites' : 'Add to favorites';
+            starBtn.onclick = (e) => starTicket(e, id, !favorites.has(id));
+
+            div.appendChild(starBtn);
+            div.appendChild(nameSpan);
+            if (!readOnly) {
+                const archiveBtn = document.createElement('span');
+                archiveBtn.className = 'archive-btn';
+                archiveBtn.textContent = archived ? 'unarchive' : 'archive';
+                archiveBtn.onclick = (e) => archiveTicket(e, id, !archived);
+                div.appendChild(archiveBtn);
+                const deleteBtn = document.createElement('span');
+                deleteBtn.className = 'delete-btn';
+                deleteBtn.textContent = '×';
+                deleteBtn.onclick = (e) => deleteTicket(e, id);
+                div.appendChild(deleteBtn);
+            }
+            list.appendChild(div);
+        });
+    });
+}
+
+function loadStatus(ticketId) {
+    document.getElementById('addForm').classList.add('hidden');
+    const statusDisplay = document.getElementById('statusDisplay');
+    statusDisplay.classList.remove('hidden');
+    statusDisplay.innerHTML = '<div>Loading...</div>';
+    if (statusDisplay.dataset.ticket !== ticketId) {
+        statusSort = {...defaultSort};
+    }
+    statusDisplay.dataset.ticket = ticketId;
+
+    let sort = '';
+    if (statusSort.column) {
+        sort = '&sort=' + statusSort.column + '&order=' + (statusSort.desc ? 'desc' : 'asc');
+    }
+    fetch(basePath + '/api/status?view=none&ticket=' + encodeURIComponent(ticketId) + sort)
+    .then(response => response.json())
+    .then(statuses => {
+        const ticketPath = basePath + '/ticket/' + encodeURIComponent(ticketId);
+        const csvPath = basePath + '/api/v1/tickets/' + encodeURIComponent(ticketId) + '/table?format=csv' + sort;
+        let html = '<h2>Status for ' + escapeHTML(ticketId) + ' <a class="share-link" href="' + ticketPath + '">Link</a> <a class="share-link" href="' + csvPath + '">CSV</a> <a class="share-link" href="#" onclick="shareTicket(event)">Share</a></h2>';
+        html += '<table id="statusTable" border="1" style="width: 100%; border-collapse: collapse;">';
+        html += '<tr>';
+        statusColumns.forEach(([key, title]) => {
+            let arrow = '';
+            if (statusSort.column === key) {
+                arrow = statusSort.desc ? ' &#9660;' : ' &#9650;';
+            }
+            html += '<th class="sortable" onclick="sortStatus(\'' + key + '\')">' + title + arrow + '</th>';
+        });
+        html += '</tr>';
+
+        const thresholds = ticketThresholds[ticketId] || {};
+        const ticketStaleDays = thresholdDays(thresholds.stale, staleDays);
+        const ticketWarningDays = thresholdDays(thresholds.warning, warningDays);
+        statuses.forEach(status => {
+            const statusClass = status.status === 'OK' ? 'ok' : 'error';
+            const lastUpdated = status.lastUpdated ? new Date(status.lastUpdated) : null;
+            const daysOld = lastUpdated ? 
+                Math.floor((new Date() - lastUpdated) / (1000 * 60 * 60 * 24)) : 
+                'N/A';
+            
+            const daysOldClass = daysOld >= ticketStaleDays ? 'error' : 
+                               daysOld >= ticketWarningDays ? 'warning' : 
+                               'ok';
+            
+            const daysOldText = daysOld === 'N/A' ? 'N/A' : 
+                               daysOld === 1 ? '1 day old' :
+                               daysOld + ' days old';
+            
+            html += '<tr data-operator="' + escapeHTML(status.name) + '">';
+            html += '<td>' + operatorLabel(status) + '</td>';
+            html += '<td>' + (lastUpdated ? lastUpdated.toLocaleString(undefined, {timeZone: timezone, timeZoneName: 'short'}) : 'N/A') + '</td>';
+            html += '<td class="' + daysOldClass + '">' + daysOldText + '</td>';
+            html += '<td style="font-family: monospace; word-break: break-all;">' + (status.sha256 || 'N/A') + buildNote(status.build) + signatureNote(status.signature) + provenanceNote(status.provenance) + baseImageNote(status.baseImage) + scanNote(status.scan) + '</td>';
+            html += '<td class="' + statusClass + '">' + status.status + '</td>';
+            html += '</tr>';
+        });
+        
+        html += '</table>';
+        html += '<div id="comments"></div>';
+        statusDisplay.innerHTML = html;
+        loadComments(ticketId);
+        loadDrift(ticketId, statuses);
+        loadApplications(ticketId);
+        loadCVEs(ticketId);
+        loadPipelines(ticketId);
+    });
+}
+
+// shareTicket creates a share link to the ticket shown, valid for a week,
+// for people without access to OpTrack
+function shareTicket(event) {
+    event.preventDefault();
+    const ticketId = document.getElementById('statusDisplay').dataset.ticket;
+    fetch(basePath + '/api/v1/tickets/' + encodeURIComponent(ticketId) + '/shares', {method: 'POST'})
+    .then(response => response.json().then(body => {
+        if (!response.ok) {
+            throw new Error(body.message);
+        }
+        window.prompt('Anyone with this link can see ' + ticketId + ' until ' + new Date(body.expires).toLocaleString(undefined, {timeZone: timezone, timeZoneName: 'short'}) + ':', body.url);
+    }))
+    .catch(err => alert('Failed to create a share link: ' + err.message));
+}
+
+// sortStatus sorts the status table by a column on the server, flipping the
+// order when it is already sorted by it
+function sortStatus(column) {
+    if (statusSort.column === column) {
+        statusSort.desc = !statusSort.desc;
+    } else {
+        statusSort = {column: column, desc: false};
+    }
+    loadStatus(document.getElementById('statusDisplay').dataset.ticket);
+}
+
+// operatorLabel is the display name the ticket gives an operator, or its
+// name, with a line for its criticality, unless normal, its owning team and
+// the owner and note of its entry on the ticket, and one counting down to the day a fixed
+// build is expected
+function operatorLabel(status) {
+    let html = escapeHTML(status.name);
+    if (status.displayName) {
+        html = '<span title="' + html + '">' + escapeHTML(status.displayName) + '</span>';
+    }
+    const criticality = status.criticality === 'normal' ? '' : status.criticality;
+    const team = status.team && status.contact ? status.team + ' (' + status.contact + ')' : status.team;
+    const details = [criticality, team, status.owner, status.note].filter(Boolean).map(escapeHTML).join(' - ');
+    if (details) {
+        html += '<br><small>' + details + '</small>';
+    }
+    return html + expectedByNote(status);
+}
+
+// expectedByNote is a line with the day a fixed build of an operator is
+// expected and the days left until it, marked once it is overdue
+function expectedByNote(status) {
+    if (!status.expectedBy) {
+        return '';
+    }
+    let text = 'expected by ' + escapeHTML(status.expectedBy);
+    if (status.daysLeft === 0) {
+        text += ' (today)';
+    } else if (status.overdue) {
+        text += ' (' + -status.daysLeft + ' days overdue)';
+    } else if (status.daysLeft !== undefined) {
+        text += ' (' + status.daysLeft + ' days left)';
+    }
+    return '<br><small' + (status.overdue ? ' class="error"' : '') + '>' + text + '</small>';
+}
+
+// buildNote is a line naming the build that produced an image, linked to
+// the build system when it has a page for it
+function buildNote(build) {
+    if (!build) {
+        return '';
+    }
+    let text = escapeHTML(build.nvr || build.system + ' ' + build.id);
+    if (build.url) {
+        text = '<a href="' + escapeHTML(build.url) + '">' + text + '</a>';
+    }
+    const title = [build.system, build.pipeline, build.completed ? 'completed ' + new Date(build.completed).toLocaleString(undefined, {timeZone: timezone}) : ''].filter(Boolean).join(', ');
+    return '<br><small title="' + escapeHTML(title) + '">built by ' + text + '</small>';
+}
+
+// signatureNote is a line saying whether an image is signed, and by whom
+// or why its signatures don't count
+function signatureNote(signature) {
+    if (!signature) {
+        return '';
+    }
+    const cls = signature.state === 'signed' ? 'ok' : 'error';
+    const detail = signature.signer ? ' by ' + escapeHTML(signature.signer) : '';
+    return '<br><small class="' + cls + '" title="' + escapeHTML(signature.error || '') + '">' + escapeHTML(signature.state) + detail + '</small>';
+}
+
+// provenanceNote is a line naming the builder and source of an image, from
+// its provenance, or saying why it has none that counts
+function provenanceNote(provenance) {
+    if (!provenance) {
+        return '';
+    }
+    if (provenance.state !== 'verified') {
+        const text = provenance.state === 'missing' ? 'no provenance' : 'invalid provenance';
+        return '<br><small class="error" title="' + escapeHTML(provenance.error || '') + '">' + text + '</small>';
+    }
+    let source = escapeHTML(provenance.source || '');
+    if (provenance.revision) {
+        source += '@' + escapeHTML(provenance.revision.substring(0, 12));
+    }
+    const title = [provenance.predicateType, provenance.signer ? 'signed by ' + provenance.signer : ''].filter(Boolean).join(', ');
+    return '<br><small class="ok" title="' + escapeHTML(title) + '">provenance: ' + escapeHTML(provenance.builder) + (source ? ' from ' + source : '') + '</small>';
+}
+
+// baseImageNote is a line naming the base of an image and whether a newer
+// image of the base has been published
+function baseImageNote(base) {
+    if (!base) {
+        return '';
+    }
+    if (!base.name) {
+        return '<br><small class="warning">unknown base image</small>';
+    }
+    const title = [base.digest ? 'built on ' + base.digest : '', base.latest ? 'newest ' + base.latest : ''].filter(Boolean).join(', ');
+    const text = base.state === 'current' ? 'on the newest ' + escapeHTML(base.name) :
+        'on an outdated ' + escapeHTML(base.name) + (base.tag ? ' (' + escapeHTML(base.tag) + ')' : '');
+    return '<br><small class="' + (base.state === 'current' ? 'ok' : 'error') + '" title="' + escapeHTML(title) + '">' + text + '</small>';
+}
+
+// scanNote counts the vulnerabilities of an image by severity, with its most
+// severe ones listed when expanded
+function scanNote(scan) {
+    if (!scan) {
+        return '';
+    }
+    const counts = ['critical', 'high', 'medium', 'low', 'unknown']
+        .filter(sev => scan.counts[sev] > 0)
+        .map(sev => scan.counts[sev] + ' ' + sev);
+    const cls = scan.counts.critical > 0 || scan.counts.high > 0 ? 'error' : counts.length > 0 ? 'warning' : 'ok';
+    const summary = counts.length > 0 ? counts.join(', ') : 'no vulnerabilities';
+    const scanned = 'scanned by ' + scan.scanner + ' ' + new Date(scan.completed).toLocaleString(undefined, {timeZone: timezone});
+    if (!scan.findings || scan.findings.length === 0) {
+        return '<br><small class="' + cls + '" title="' + escapeHTML(scanned) + '">' + summary + '</small>';
+    }
+    let html = '<details><summary><small class="' + cls + '" title="' + escapeHTML(scanned) + '">' + summary + '</small></summary><ul>';
+    scan.findings.forEach(f => {
+        let id = escapeHTML(f.id);
+        if (f.url) {
+            id = '<a href="' + escapeHTML(f.url) + '">' + id + '</a>';
+        }
+        const fix = f.fixedVersion ? ', fixed in ' + escapeHTML(f.fixedVersion) : '';
+        html += '<li><small title="' + escapeHTML(f.title || '') + '">' + id + ' (' + escapeHTML(f.severity) + ') ' +
+            escapeHTML(f.package + ' ' + f.version) + fix + '</small></li>';
+    });
+    return html + '</ul></details>';
+}
+
+// CSS class for each cluster drift state
+const driftClasses = {current: 'ok', outdated: 'error', not_deployed: 'warning', unknown: 'warning'};
+
+function escapeHTML(s) {
+    const div = document.createElement('div');
+    div.textContent = s;
+    return div.innerHTML.replace(/"/g, '&quot;');
+}
+
+// loadDrift adds what the configured clusters have installed next to what
+// was built, if the server has clusters configured
+function loadDrift(ticketId, statuses) {
+    fetch(basePath + '/api/v1/tickets/' + encodeURIComponent(ticketId) + '/drift')
+    .then(response => response.ok ? response.json() : [])
+    .then(results => {
+        const statusDisplay = document.getElementById('statusDisplay');
+        if (results.length === 0 || statusDisplay.dataset.ticket !== ticketId) {
+            return; // No clusters, or another ticket was opened meanwhile
+        }
+        const built = {};
+        statuses.forEach(status => built[status.name] = status);
+
+        let html = '<h3>Clusters</h3>';
+        html += '<table border="1" style="width: 100%; border-collapse: collapse;">';
+        html += '<tr><th>Operator</th><th>Built in Quay</th><th>Cluster</th><th>Installed</th><th>Running</th><th>State</th></tr>';
+        results.forEach(r => {
+            const status = built[r.operator];
+            const latest = status && status.sha256 ? status.sha256.substring(0, 12) : 'N/A';
+            const installed = (r.installed || []).map(i => {
+                let text = i.csv;
+                if (i.channel) {
+                    text += ' (' + i.channel + ')';
+                }
+                if (i.currentCSV) {
+                    text += ', upgrading to ' + i.currentCSV;
+                }
+                return escapeHTML(text);
+            }).join('<br>') || '-';
+            const running = (r.running || []).map(w =>
+                escapeHTML(w.namespace + '/' + w.name + ': ' + (w.digest ? w.digest.substring(0, 12) : '?'))
+            ).join('<br>') || '-';
+
+            html += '<tr>';
+            html += '<td>' + escapeHTML(r.operator) + '</td>';
+            html += '<td style="font-family: monospace;">' + latest + '</td>';
+            html += '<td>' + escapeHTML(r.cluster) + '</td>';
+            html += '<td>' + installed + '</td>';
+            html += '<td style="font-family: monospace;">' + running + '</td>';
+            html += '<td class="' + driftClasses[r.state] + '"' + (r.error ? ' title="' + escapeHTML(r.error) + '"' : '') + '>' + r.state.replace('_', ' ') + '</td>';
+            html += '</tr>';
+        });
+        html += '</table>';
+        statusDisplay.insertAdjacentHTML('beforeend', html);
+    });
+}
+
+// CSS class for each ArgoCD sync and health status
+const argoClasses = {Synced: 'ok', OutOfSync: 'warning', Healthy: 'ok', Progressing: 'warning', Degraded: 'error', Missing: 'error'};
+
+// loadApplications adds the ArgoCD applications linked to the ticket, if the
+// server has ArgoCD configured
+function loadApplications(ticketId) {
+    fetch(basePath + '/api/v1/tickets/' + encodeURIComponent(ticketId) + '/applications')
+    .then(response => response.ok ? response.json() : [])
+    .then(apps => {
+        const statusDisplay = document.getElementById('statusDisplay');
+        if (apps.length === 0 || statusDisplay.dataset.ticket !== ticketId) {
+            return;
+        }
+        let html = '<h3>ArgoCD Applications</h3>';
+        html += '<table border="1" style="width: 100%; border-collapse: collapse;">';
+        html += '<tr><th>Application</th><th>Sync</th><th>Health</th><th>Revision</th><th>Operator</th><th>Image</th><th>State</th></tr>';
+        apps.forEach(app => {
+            if (app.error) {
+                html += '<tr><td>' + escapeHTML(app.application) + '</td><td colspan="6" class="error">' + escapeHTML(app.error) + '</td></tr>';
+                return;
+            }
+            const revision = app.revision ? escapeHTML(app.revision.substring(0, 12)) : '-';
+            app.operators.forEach(op => {
+                html += '<tr>';
+                html += '<td>' + escapeHTML(app.application) + '</td>';
+                html += '<td class="' + (argoClasses[app.sync] || '') + '">' + escapeHTML(app.sync || '-') + '</td>';
+                html += '<td class="' + (argoClasses[app.health] || '') + '">' + escapeHTML(app.health || '-') + '</td>';
+                html += '<td style="font-family: monospace;">' + revision + '</td>';
+                html += '<td>' + escapeHTML(op.operator) + '</td>';
+                html += '<td style="font-family: monospace;">' + escapeHTML(op.image || '-') + '</td>';
+                html += '<td class="' + driftClasses[op.state] + '"' + (op.error ? ' title="' + escapeHTML(op.error) + '"' : '') + '>' + op.state.replace('_', ' ') + '</td>';
+                html += '</tr>';
+            });
+        });
+        html += '</table>';
+        statusDisplay.insertAdjacentHTML('beforeend', html);
+    });
+}
+
+// CSS class for each CVE fix state
+const cveClasses = {fixed: 'ok', affected: 'error', unscanned: 'warning'};
+
+// loadCVEs adds whether each operator's latest image still has the CVEs
+// listed on the ticket, if it lists any
+function loadCVEs(ticketId) {
+    fetch(basePath + '/api/v1/tickets/' + encodeURIComponent(ticketId) + '/cves')
+    .then(response => response.ok ? response.json() : [])
+    .then(results => {
+        const statusDisplay = document.getElementById('statusDisplay');
+        if (!results.some(r => r.cves.length > 0) || statusDisplay.dataset.ticket !== ticketId) {
+            return;
+        }
+        let html = '<h3>CVEs</h3>';
+        html += '<table border="1" style="width: 100%; border-collapse: collapse;">';
+        html += '<tr><th>Operator</th><th>CVE</th><th>State</th><th>Package</th><th>Fixed In</th></tr>';
+        results.forEach(r => {
+            if (r.error) {
+                html += '<tr><td>' + escapeHTML(r.operator) + '</td><td colspan="4" class="error">' + escapeHTML(r.error) + '</td></tr>';
+                return;
+            }
+            r.cves.forEach(c => {
+                html += '<tr>';
+                html += '<td>' + escapeHTML(r.operator) + '</td>';
+                html += '<td>' + escapeHTML(c.id) + '</td>';
+                html += '<td class="' + cveClasses[c.state] + '">' + c.state + '</td>';
+                html += '<td>' + escapeHTML(c.package ? c.package + ' ' + c.version : '-') + '</td>';
+                html += '<td>' + escapeHTML(c.fixedVersion || '-') + '</td>';
+                html += '</tr>';
+            });
+        });
+        html += '</table>';
+        statusDisplay.insertAdjacentHTML('beforeend', html);
+    });
+}
+
+// CSS class for each build pipeline state
+const pipelineClasses = {passing: 'ok', failing: 'error', running: 'warning', unknown: 'warning'};
+
+// loadPipelines adds a Build column to the status table with the last run
+// of each operator's pipeline, if the server has pipelines configured
+function loadPipelines(ticketId) {
+    fetch(basePath + '/api/v1/tickets/' + encodeURIComponent(ticketId) + '/pipelines')
+    .then(response => response.ok ? response.json() : [])
+    .then(results => {
+        const table = document.getElementById('statusTable');
+        if (results.length === 0 || !table || document.getElementById('statusDisplay').dataset.ticket !== ticketId) {
+            return;
+        }
+        const builds = {};
+        results.forEach(r => builds[r.operator] = r);
+
+        table.rows[0].insertAdjacentHTML('beforeend', '<th>Build</th>');
+        Array.from(table.rows).slice(1).forEach(row => {
+            const r = builds[row.dataset.operator];
+            if (!r) {
+                row.insertAdjacentHTML('beforeend', '<td>-</td>');
+                return;
+            }
+            let text = r.state;
+            if (r.failingSince) {
+                text = 'failing since ' + new Date(r.failingSince).toLocaleString(undefined, {timeZone: timezone, weekday: 'short', day: 'numeric', month: 'short', hour: '2-digit', minute: '2-digit'});
+                if (r.state === 'running') {
+                    text += ', new run in progress';
+                }
+            }
+            text = escapeHTML(text);
+            if (r.last && r.last.url) {
+                text = '<a href="' + escapeHTML(r.last.url) + '">' + text + '</a>';
+            }
+            const title = r.error || (r.last ? r.system + ' ' + r.last.name + (r.last.result ? ': ' + r.last.result : '') : r.system);
+            row.insertAdjacentHTML('beforeend', '<td class="' + pipelineClasses[r.state] + '" title="' + escapeHTML(title) + '">' + text + '</td>');
+        });
+    });
+}
+
+// loadComments shows the comment thread of a ticket below its status table,
+// with a box to add to it
+function loadComments(ticketId) {
+    fetch(basePath + '/api/v1/tickets/' + encodeURIComponent(ticketId) + '/comments')
+    .then(response => response.ok ? response.json() : [])
+    .then(comments => {
+        const container = document.getElementById('comments');
+        if (!container || document.getElementById('statusDisplay').dataset.ticket !== ticketId) {
+            return;
+        }
+        let html = '<h3>Comments</h3>';
+        comments.forEach(c => {
+            html += '<div class="comment">';
+            html += '<div class="comment-meta">' + escapeHTML(c.author) + ', ' + new Date(c.created).toLocaleString(undefined, {timeZone: timezone, timeZoneName: 'short'}) + '</div>';
+            html += c.html;
+            html += '</div>';
+        });
+        html += '<textarea id="commentBody" rows="3" placeholder="Add a comment (Markdown)"></textarea>';
+        html += '<button onclick="addComment()">Comment</button>';
+        container.innerHTML = html;
+    });
+}
+
+// addComment posts the comment box to the ticket shown
+function addComment() {
+    const ticketId = document.getElementById('statusDisplay').dataset.ticket;
+    const body = document.getElementById('commentBody').value.trim();
+    if (!body) {
+        return;
+    }
+    fetch(basePath + '/api/v1/tickets/' + encodeURIComponent(ticketId) + '/comments', {
+        method: 'POST',
+        headers: {'Content-Type': 'application/json'},
+        body: JSON.stringify({body: body})
+    })
+    .then(response => response.json().then(result => {
+        if (!response.ok) {
+            throw new Error(result.message);
+        }
+        loadComments(ticketId);
+    }))
+    .catch(err => alert('Failed to add comment: ' + err.message));
+}
+
+// starTicket adds a ticket to the user's favorites, or removes it
+function starTicket(event, ticketId, starred) {
+    event.stopPropagation();
+    fetch(basePath + '/api/v1/me/favorites/' + encodeURIComponent(ticketId), {
+        method: starred ? 'PUT' : 'DELETE'
+    })
+    .then(response => response.json().then(prefs => {
+        if (!response.ok) {
+            throw new Error(prefs.message);
+        }
+        favorites = new Set(prefs.favorites);
+        loadTickets();
+    }))
+    .catch(err => alert('Failed to update favorites: ' + err.message));
+}
+
+// saveView saves the filter, boxes and status table sort shown as the user's
+// default view
+function saveView(event) {
+    event.preventDefault();
+    const filter = document.getElementById('ticketFilter').value.trim();
+    const view = {
+        project: document.getElementById('projectFilter').value,
+        archived: document.getElementById('showArchived').checked ? 'true' : '',
+        favorites: document.getElementById('showFavorites').checked,
+        sort: statusSort.column,
+        order: statusSort.column && statusSort.desc ? 'desc' : '',
+    };
+    if (filter.includes('@')) {
+        view.owner = filter;
+    } else if (filter) {
+        view.labels = filter.split(',').map(label => label.trim()).filter(label => label.length > 0);
+    }
+    fetch(basePath + '/api/v1/me/preferences', {
+        method: 'PUT',
+        headers: {'Content-Type': 'application/json'},
+        body: JSON.stringify({view: view})
+    })
+    .then(response => response.json().then(prefs => {
+        if (!response.ok) {
+            throw new Error(prefs.message);
+        }
+        defaultSort = {column: prefs.view.sort || '', desc: prefs.view.order === 'desc'};
+    }))
+    .catch(err => alert('Failed to save the default view: ' + err.message));
+}
+
+// loadProjects fills the project filter and the new ticket form with the
+// projects the user can see, showing them only when there are any
+function loadProjects() {
+    return fetch(basePath + '/api/v1/projects')
+    .then(response => response.ok ? response.json() : [])
+    .then(projects => {
+        if (projects.length === 0) {
+            return;
+        }
+        projects.forEach(project => {
+            const option = document.createElement('option');
+            option.value = project.name;
+            option.textContent = project.name;
+            option.title = project.description || '';
+            document.getElementById('projectFilter').appendChild(option);
+            if (project.role === 'editor') {
+                document.getElementById('project').appendChild(option.cloneNode(true));
+            }
+        });
+        document.getElementById('projectFilter').classList.remove('hidden');
+        document.getElementById('projectGroup').classList.remove('hidden');
+    })
+    .catch(() => {});
+}
+
+// loadPreferences sets up the ticket list with the user's favorites and
+// default view, then loads it
+function loadPreferences() {
+    loadProjects()
+    .then(() => fetch(basePath + '/api/v1/me/preferences'))
+    .then(response => response.ok ? response.json() : {favorites: [], view: {}})
+    .then(prefs => {
+        const view = prefs.view || {};
+        favorites = new Set(prefs.favorites || []);
+        document.getElementById('ticketFilter').value = view.owner || (view.labels || []).join(', ');
+        document.getElementById('projectFilter').value = view.project || '';
+        document.getElementById('showArchived').checked = view.archived === 'true';
+        document.getElementById('showFavorites').checked = !!view.favorites;
+        defaultSort = {column: view.sort || '', desc: view.order === 'desc'};
+    })
+    .finally(loadTickets);
+}
+
+// Load tickets on page load
+loadPreferences();
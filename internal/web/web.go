@@ -0,0 +1,112 @@
+// Package web holds the web UI's page templates and static files
+package web
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"os"
+	"sync"
+)
+
+// embedded holds the page templates and static files compiled into the binary
+//
+//go:embed static templates
+var embedded embed.FS
+
+// Options selects where the assets are read from
+type Options struct {
+	Dir       string // Read every file from this directory instead of the binary
+	Overrides string // Files here take the place of the built-in files with the same path
+	Reload    bool   // Re-read files on every request so edits show up without a restart
+}
+
+// Assets serves the web UI templates and static files, either from the binary
+// or, in development, from a directory on disk, with optional overrides
+type Assets struct {
+	fs     fs.FS
+	reload bool
+	funcs  template.FuncMap
+
+	mu        sync.Mutex
+	templates map[string]*template.Template
+}
+
+// New returns the assets selected by opts. funcs are available to every template.
+func New(opts Options, funcs template.FuncMap) *Assets {
+	var fsys fs.FS = embedded
+	if opts.Dir != "" {
+		fsys = os.DirFS(opts.Dir)
+	}
+	if opts.Overrides != "" {
+		fsys = overlayFS{top: os.DirFS(opts.Overrides), base: fsys}
+	}
+	return &Assets{fs: fsys, reload: opts.Reload, funcs: funcs, templates: make(map[string]*template.Template)}
+}
+
+// Check parses every page template, so a broken override is found at startup
+// rather than by the first visitor of the page
+func (a *Assets) Check() error {
+	names, _ := fs.Glob(embedded, "templates/*.html") // Cannot fail for a valid pattern
+	for _, name := range names {
+		name = name[len("templates/"):]
+		if _, err := a.Template(name); err != nil {
+			return fmt.Errorf("template %s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// Template returns the parsed template from templates/<name>
+func (a *Assets) Template(name string) (*template.Template, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if t, ok := a.templates[name]; ok {
+		return t, nil
+	}
+	t, err := template.New(name).Funcs(a.funcs).ParseFS(a.fs, "templates/"+name)
+	if err != nil {
+		return nil, err
+	}
+	if !a.reload {
+		a.templates[name] = t
+	}
+	return t, nil
+}
+
+// Page returns a copy of a template with funcs replacing the shared functions
+// of the same name, for values that differ per request
+func (a *Assets) Page(name string, funcs template.FuncMap) (*template.Template, error) {
+	t, err := a.Template(name)
+	if err != nil {
+		return nil, err
+	}
+	if t, err = t.Clone(); err != nil {
+		return nil, err
+	}
+	return t.Funcs(funcs), nil
+}
+
+// StaticHandler serves files from static/
+func (a *Assets) StaticHandler() http.Handler {
+	static, _ := fs.Sub(a.fs, "static") // Cannot fail for a directory name
+	return http.FileServer(http.FS(static))
+}
+
+// overlayFS serves files from top, falling back to base for the files top
+// doesn't have
+type overlayFS struct {
+	top, base fs.FS
+}
+
+func (o overlayFS) Open(name string) (fs.File, error) {
+	f, err := o.top.Open(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return o.base.Open(name)
+	}
+	return f, err
+}
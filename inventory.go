@@ -0,0 +1,400 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"OpTrack/internal/api"
+	"OpTrack/internal/clock"
+	"OpTrack/internal/store"
+)
+
+// criticalities are the values of InventoryEntry.Criticality, besides none
+var criticalities = []string{"critical", "normal", "low"}
+
+// InventoryEntry is an operator that was tracked at some point, with what is
+// known about it besides its tickets
+type InventoryEntry struct {
+	Name             string     `json:"name"`
+	Team             string     `json:"team,omitempty"`
+	Contact          string     `json:"contact,omitempty"`          // How to reach the team, e.g. an email address or chat channel
+	SourceRepository string     `json:"sourceRepository,omitempty"` // e.g. https://github.com/openshift/foo-operator
+	Criticality      string     `json:"criticality,omitempty"`      // critical, normal or low
+	FirstSeen        time.Time  `json:"firstSeen"`
+	FirstTicket      string     `json:"firstTicket,omitempty"` // The ticket it was first seen on
+	Updated          *time.Time `json:"updated,omitempty"`     // When its details last changed
+	UpdatedBy        string     `json:"updatedBy,omitempty"`
+}
+
+// InventoryItem is an inventory entry with the tickets that track the
+// operator now, as the API returns it
+type InventoryItem struct {
+	InventoryEntry
+	Tickets []string `json:"tickets"`
+}
+
+// InventoryStore keeps the operator inventory in the settings directory: one
+// entry for every operator a ticket ever had, under a single spelling.
+// Operators on tickets that differ from an entry only in case are rewritten
+// to its spelling, so the same image isn't tracked twice.
+type InventoryStore struct {
+	mu      sync.RWMutex
+	path    string
+	entries map[string]InventoryEntry // By lower-case name
+	audit   *AuditLog
+	clock   clock.Clock
+
+	// onChange is called after an entry is renamed or its criticality or
+	// owners change, without mu held
+	onChange func()
+}
+
+func NewInventoryStore(dataDir string, audit *AuditLog, clk clock.Clock) (*InventoryStore, error) {
+	dir, err := store.SettingsDir(dataDir)
+	if err != nil {
+		return nil, err
+	}
+	s := &InventoryStore{
+		path:    filepath.Join(dir, "operator-inventory.json"),
+		entries: make(map[string]InventoryEntry),
+		audit:   audit,
+		clock:   clk,
+	}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// load reads the inventory file, picking up operators other replicas added
+func (s *InventoryStore) load() error {
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var list []InventoryEntry
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("failed to parse %s: %v", s.path, err)
+	}
+	entries := make(map[string]InventoryEntry, len(list))
+	for _, entry := range list {
+		entries[strings.ToLower(entry.Name)] = entry
+	}
+	s.mu.Lock()
+	s.entries = entries
+	s.mu.Unlock()
+	return nil
+}
+
+// Get returns the entry of an operator, whatever the case of name
+func (s *InventoryStore) Get(name string) (InventoryEntry, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	entry, ok := s.entries[strings.ToLower(name)]
+	return entry, ok
+}
+
+// List returns every entry, sorted by name
+func (s *InventoryStore) List() []InventoryEntry {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.sorted()
+}
+
+// sorted returns the entries by name. The caller holds s.mu.
+func (s *InventoryStore) sorted() []InventoryEntry {
+	list := make([]InventoryEntry, 0, len(s.entries))
+	for _, entry := range s.entries {
+		list = append(list, entry)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// canonical returns the spelling of an operator in the inventory, or name
+// itself for operators it doesn't have
+func (s *InventoryStore) canonical(name string) string {
+	if entry, ok := s.Get(name); ok {
+		return entry.Name
+	}
+	return name
+}
+
+// canonicalize returns a ticket with its operators, and the keys of its pins
+// and baselines, spelled as in the inventory. An operator that turns out to be on the ticket
+// twice is only kept the first time.
+func (s *InventoryStore) canonicalize(ticket JiraTicket) JiraTicket {
+	if s == nil {
+		return ticket
+	}
+	changed := false
+	operators := make([]store.Operator, 0, len(ticket.Operators))
+	for _, op := range ticket.Operators {
+		name := s.canonical(op.Name)
+		if name != op.Name {
+			changed = true
+			op.Name = name
+		}
+		if slices.ContainsFunc(operators, func(o store.Operator) bool { return o.Name == name }) {
+			changed = true
+			continue
+		}
+		operators = append(operators, op)
+	}
+	if !changed {
+		return ticket
+	}
+	ticket.Operators = operators
+	ticket.Pins = s.canonicalKeys(ticket.Pins)
+	ticket.Baselines = s.canonicalKeys(ticket.Baselines)
+	return ticket
+}
+
+// canonicalKeys returns digests by operator with the operators spelled as in
+// the inventory
+func (s *InventoryStore) canonicalKeys(digests map[string]string) map[string]string {
+	if len(digests) == 0 {
+		return digests
+	}
+	out := make(map[string]string, len(digests))
+	for name, digest := range digests {
+		out[s.canonical(name)] = digest
+	}
+	return out
+}
+
+// annotate returns a ticket with the criticality and owning team of its
+// operators, for published tickets; ownOperators drops them again before a
+// ticket is saved
+func (s *InventoryStore) annotate(ticket JiraTicket) JiraTicket {
+	if s == nil {
+		return ticket
+	}
+	var operators []store.Operator
+	for i, op := range ticket.Operators {
+		entry, _ := s.Get(op.Name)
+		if entry.Criticality == op.Criticality && entry.Team == op.Team && entry.Contact == op.Contact {
+			continue
+		}
+		if operators == nil {
+			operators = slices.Clone(ticket.Operators)
+		}
+		operators[i].Criticality, operators[i].Team, operators[i].Contact = entry.Criticality, entry.Team, entry.Contact
+	}
+	if operators != nil {
+		ticket.Operators = operators
+	}
+	return ticket
+}
+
+// record adds the operators of tickets the inventory doesn't have yet
+func (s *InventoryStore) record(tickets ...JiraTicket) error {
+	now := s.clock.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var added []string
+	for _, ticket := range tickets {
+		for _, name := range ticket.OperatorNames() {
+			key := strings.ToLower(name)
+			if _, ok := s.entries[key]; !ok {
+				s.entries[key] = InventoryEntry{Name: name, FirstSeen: now, FirstTicket: ticket.ID}
+				added = append(added, key)
+			}
+		}
+	}
+	if len(added) == 0 {
+		return nil
+	}
+	if err := s.save(); err != nil {
+		for _, key := range added {
+			delete(s.entries, key)
+		}
+		return err
+	}
+	return nil
+}
+
+// Update sets the details of an operator, adding it to the inventory if it
+// isn't there yet. Spelling the name differently than the inventory renames
+// the entry, and every ticket follows. It returns whether the entry existed.
+func (s *InventoryStore) Update(r *http.Request, entry InventoryEntry) (bool, error) {
+	now := s.clock.Now()
+	entry.Updated, entry.UpdatedBy = &now, requestActor(r)
+	key := strings.ToLower(entry.Name)
+
+	s.mu.Lock()
+	old, existed := s.entries[key]
+	entry.FirstSeen, entry.FirstTicket = old.FirstSeen, old.FirstTicket
+	if !existed {
+		entry.FirstSeen = now
+	}
+	s.entries[key] = entry
+	if err := s.save(); err != nil {
+		if existed {
+			s.entries[key] = old
+		} else {
+			delete(s.entries, key)
+		}
+		s.mu.Unlock()
+		return existed, err
+	}
+	s.mu.Unlock()
+
+	details := map[string]interface{}{"operator": entry.Name, "team": entry.Team, "contact": entry.Contact, "sourceRepository": entry.SourceRepository, "criticality": entry.Criticality}
+	renamed := existed && old.Name != entry.Name
+	if renamed {
+		details["renamedFrom"] = old.Name
+	}
+	s.audit.Record(r, "inventory.update", "", details)
+	if (renamed || !sameAnnotations(old, entry)) && s.onChange != nil {
+		s.onChange()
+	}
+	return existed, nil
+}
+
+// sameAnnotations reports whether two entries give the operators of tickets
+// the same criticality and owners
+func sameAnnotations(a, b InventoryEntry) bool {
+	return a.Criticality == b.Criticality && a.Team == b.Team && a.Contact == b.Contact
+}
+
+// save writes the inventory file. The caller holds s.mu.
+func (s *InventoryStore) save() error {
+	data, err := json.MarshalIndent(s.sorted(), "", "    ")
+	if err != nil {
+		return err
+	}
+	if err := store.WriteFileAtomic(s.path, data, 0644); err != nil {
+		return fmt.Errorf("%w: failed to save the operator inventory: %v", store.ErrStorage, err)
+	}
+	return nil
+}
+
+// inventoryItems returns entries with the tickets tracking each operator now,
+// including through operator groups, and the ticket it was first seen on,
+// that the user of a request may see. A nil request, from inside OpTrack,
+// sees every ticket.
+func inventoryItems(r *http.Request, entries []InventoryEntry, state *AppState) []InventoryItem {
+	items := make([]InventoryItem, len(entries))
+	for i, entry := range entries {
+		items[i] = InventoryItem{InventoryEntry: entry, Tickets: visibleIDs(r, state, state.Tracking(entry.Name))}
+		if entry.FirstTicket != "" && !canViewID(r, state, entry.FirstTicket) {
+			items[i].FirstTicket = ""
+		}
+	}
+	return items
+}
+
+// inventoryRequest is the body of PUT /api/v1/inventory/{namespace}/{repository}
+type inventoryRequest struct {
+	Team             string `json:"team"`
+	Contact          string `json:"contact"`
+	SourceRepository string `json:"sourceRepository"`
+	Criticality      string `json:"criticality"`
+}
+
+// inventoryFilter narrows down the inventory. Zero values match every entry.
+type inventoryFilter struct {
+	Team        string // Matched regardless of case
+	Criticality string
+	Unused      bool // Only operators no ticket tracks any more
+}
+
+func (f inventoryFilter) match(item InventoryItem) bool {
+	return (f.Team == "" || strings.EqualFold(item.Team, f.Team)) &&
+		(f.Criticality == "" || item.Criticality == f.Criticality) &&
+		(!f.Unused || len(item.Tickets) == 0)
+}
+
+// filterInventory returns the items that match f
+func filterInventory(items []InventoryItem, f inventoryFilter) []InventoryItem {
+	return slices.DeleteFunc(items, func(item InventoryItem) bool { return !f.match(item) })
+}
+
+// handleList lists the inventory at GET /api/v1/inventory. The team and
+// criticality parameters, and unused=true, narrow it down.
+func (s *InventoryStore) handleList(state *AppState) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		filter := inventoryFilter{Team: q.Get("team"), Criticality: q.Get("criticality"), Unused: q.Get("unused") == "true"}
+		items := filterInventory(inventoryItems(r, s.List(), state), filter)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(items)
+	}
+}
+
+// handleGet returns the entry of an operator, with its tickets, at
+// GET /api/v1/inventory/{namespace}/{repository}
+func (s *InventoryStore) handleGet(state *AppState) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		entry, ok := s.Get(r.PathValue("namespace") + "/" + r.PathValue("repository"))
+		if !ok {
+			api.WriteError(w, requestID(r), store.ErrOperatorNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(inventoryItems(r, []InventoryEntry{entry}, state)[0])
+	}
+}
+
+// handlePut sets the details of an operator at
+// PUT /api/v1/inventory/{namespace}/{repository}, answering 201 for an
+// operator new to the inventory. It is served behind requireAdminToken.
+func (s *InventoryStore) handlePut(state *AppState) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("namespace") + "/" + r.PathValue("repository")
+		var req inventoryRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			httpError(w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
+		entry := InventoryEntry{
+			Name:             name,
+			Team:             strings.TrimSpace(req.Team),
+			Contact:          strings.TrimSpace(req.Contact),
+			SourceRepository: strings.TrimSpace(req.SourceRepository),
+			Criticality:      strings.ToLower(strings.TrimSpace(req.Criticality)),
+		}
+		if entry.Criticality != "" && !slices.Contains(criticalities, entry.Criticality) {
+			httpError(w, r, fmt.Sprintf("criticality %q must be one of %s", req.Criticality, strings.Join(criticalities, ", ")), http.StatusBadRequest)
+			return
+		}
+		if entry.SourceRepository != "" {
+			if u, err := url.Parse(entry.SourceRepository); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+				httpError(w, r, fmt.Sprintf("sourceRepository %q must be an http(s) URL", req.SourceRepository), http.StatusBadRequest)
+				return
+			}
+		}
+		if _, ok := s.Get(name); !ok {
+			if err := allowedOperators.Load().check([]string{name}); err != nil {
+				api.WriteError(w, requestID(r), err)
+				return
+			}
+		}
+
+		existed, err := s.Update(r, entry)
+		if err != nil {
+			api.WriteError(w, requestID(r), err)
+			return
+		}
+		entry, _ = s.Get(name)
+		w.Header().Set("Content-Type", "application/json")
+		if !existed {
+			w.WriteHeader(http.StatusCreated)
+		}
+		json.NewEncoder(w).Encode(inventoryItems(r, []InventoryEntry{entry}, state)[0])
+	}
+}
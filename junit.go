@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// JUnit XML report of a check, one test case per operator
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Errors   int              `xml:"errors,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Errors    int             `xml:"errors,attr"`
+	Timestamp string          `xml:"timestamp,attr"`
+	Cases     []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	ClassName string        `xml:"classname,attr"`
+	Name      string        `xml:"name,attr"`
+	Failure   *junitProblem `xml:"failure,omitempty"`
+	Error     *junitProblem `xml:"error,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitProblem struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// writeJUnit writes results as JUnit XML with a test suite per ticket. Only
+// results in fail count as failures or errors; other problems are noted in
+// the test output.
+func writeJUnit(out io.Writer, results []checkResult, fail map[string]bool, maxAge time.Duration, now time.Time) error {
+	report := junitTestSuites{Name: "optrack check"}
+	suites := make(map[string]int) // ticket -> index in report.Suites
+
+	for _, r := range results {
+		i, ok := suites[r.Ticket]
+		if !ok {
+			i = len(report.Suites)
+			suites[r.Ticket] = i
+			report.Suites = append(report.Suites, junitTestSuite{Name: r.Ticket, Timestamp: now.UTC().Format(time.RFC3339)})
+		}
+		suite := &report.Suites[i]
+
+		tc := junitTestCase{ClassName: r.Ticket, Name: r.Status.Name}
+		message := checkMessage(r, maxAge, now)
+		switch {
+		case r.Result == "stale" && fail["stale"]:
+			tc.Failure = &junitProblem{Message: message, Type: "stale", Text: message}
+			suite.Failures++
+		case r.Result == "error" && fail["error"]:
+			tc.Error = &junitProblem{Message: message, Type: "error", Text: message}
+			suite.Errors++
+		case r.Result == "unsigned" && fail["unsigned"]:
+			tc.Failure = &junitProblem{Message: message, Type: "unsigned", Text: message}
+			suite.Failures++
+		case r.Result == "unattested" && fail["unattested"]:
+			tc.Failure = &junitProblem{Message: message, Type: "unattested", Text: message}
+			suite.Failures++
+		case r.Result == "outdated-base" && fail["outdated-base"]:
+			tc.Failure = &junitProblem{Message: message, Type: "outdated-base", Text: message}
+			suite.Failures++
+		default:
+			tc.SystemOut = message
+		}
+		suite.Cases = append(suite.Cases, tc)
+		suite.Tests++
+	}
+	for _, s := range report.Suites {
+		report.Tests += s.Tests
+		report.Failures += s.Failures
+		report.Errors += s.Errors
+	}
+
+	if _, err := io.WriteString(out, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(out)
+	enc.Indent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		return err
+	}
+	_, err := io.WriteString(out, "\n")
+	return err
+}
+
+// writeGitHubAnnotations prints a GitHub Actions workflow command for every
+// stale or failed operator: an error if it fails the check, otherwise a warning
+func writeGitHubAnnotations(out io.Writer, results []checkResult, fail map[string]bool, maxAge time.Duration, now time.Time) {
+	for _, r := range results {
+		if r.Result == "ok" {
+			continue
+		}
+		level := "warning"
+		if fail[r.Result] {
+			level = "error"
+		}
+		title := "Stale operator"
+		switch r.Result {
+		case "error":
+			title = "Operator check failed"
+		case "unsigned":
+			title = "Unsigned operator"
+		case "unattested":
+			title = "Operator without provenance"
+		case "outdated-base":
+			title = "Operator on an outdated base image"
+		}
+		fmt.Fprintf(out, "::%s title=%s::%s\n", level, annotationProperty.Replace(title), annotationData.Replace(checkMessage(r, maxAge, now)))
+	}
+}
+
+// checkMessage describes a result in one line
+func checkMessage(r checkResult, maxAge time.Duration, now time.Time) string {
+	switch r.Result {
+	case "error":
+		return fmt.Sprintf("%s on %s could not be checked: %s", r.Status.Name, r.Ticket, r.Status.Status)
+	case "unsigned":
+		return fmt.Sprintf("%s on %s has no trusted signature on its latest image %s: %s", r.Status.Name, r.Ticket,
+			shortDigest(r.Status.SHA256), signatureState(r.Status.Signature))
+	case "unattested":
+		return fmt.Sprintf("%s on %s has no trusted provenance for its latest image %s: %s", r.Status.Name, r.Ticket,
+			shortDigest(r.Status.SHA256), provenanceState(r.Status.Provenance))
+	case "outdated-base":
+		return fmt.Sprintf("%s on %s has its latest image %s built on an outdated base: %s", r.Status.Name, r.Ticket,
+			shortDigest(r.Status.SHA256), baseImageState(r.Status.BaseImage))
+	case "stale":
+		return fmt.Sprintf("%s on %s was last updated %s, %d days ago (max %s)", r.Status.Name, r.Ticket,
+			r.Status.LastUpdated.Format("2006-01-02"), int(now.Sub(r.Status.LastUpdated).Hours()/24), Duration(maxAge))
+	default:
+		return fmt.Sprintf("%s on %s was last updated %s", r.Status.Name, r.Ticket, r.Status.LastUpdated.Format("2006-01-02"))
+	}
+}
+
+// Escaping of the message and the properties of GitHub Actions workflow commands
+var (
+	annotationData     = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A")
+	annotationProperty = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C")
+)
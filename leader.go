@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"OpTrack/internal/clock"
+	"OpTrack/internal/kube"
+	"OpTrack/internal/leader"
+	"OpTrack/internal/scheduler"
+	"OpTrack/internal/store"
+)
+
+// LeaderElectionConfig lets several replicas share the data directory: only
+// the leader polls Quay.io, and so sends notifications, and another replica
+// takes over when it stops renewing its lease
+type LeaderElectionConfig struct {
+	Enabled       bool        `yaml:"enabled"`
+	Lock          string      `yaml:"lock"`     // "file" or "lease"
+	Identity      string      `yaml:"identity"` // Unique per replica; defaults to the host name and process ID
+	LeaseDuration Duration    `yaml:"leaseDuration"`
+	File          string      `yaml:"file"` // Defaults to settings/leader.json in the data directory
+	Lease         LeaseConfig `yaml:"lease"`
+}
+
+// LeaseConfig is the Kubernetes Lease replicas elect the leader with
+type LeaseConfig struct {
+	Name       string `yaml:"name"`
+	Namespace  string `yaml:"namespace"`  // Defaults to the pod's namespace, else the kubeconfig context's
+	Kubeconfig string `yaml:"kubeconfig"` // Defaults to the pod's service account in a cluster, else $KUBECONFIG or ~/.kube/config
+	Context    string `yaml:"context"`
+}
+
+// Leader election defaults
+const (
+	defaultLeaderLock          = "file"
+	defaultLeaseName           = "optrack"
+	defaultLeaderLeaseDuration = 15 * time.Second
+)
+
+// newElector returns nil unless leader election is enabled
+func newElector(cfg LeaderElectionConfig, dataDir string, clk clock.Clock) (*leader.Elector, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	var lock leader.Lock
+	switch cfg.Lock {
+	case "lease":
+		var kc *kube.Config
+		var err error
+		if cfg.Lease.Kubeconfig == "" && cfg.Lease.Context == "" && kube.InCluster() {
+			kc, err = kube.InClusterConfig()
+		} else {
+			path := cfg.Lease.Kubeconfig
+			if path == "" {
+				path = kube.DefaultKubeconfig()
+			}
+			kc, err = kube.LoadKubeconfig(path, cfg.Lease.Context)
+		}
+		if err != nil {
+			return nil, err
+		}
+		namespace := cfg.Lease.Namespace
+		if namespace == "" {
+			namespace = kc.Namespace
+		}
+		if namespace == "" {
+			namespace = "default"
+		}
+		lock = leader.NewLease(kube.NewClient(kc), namespace, cfg.Lease.Name)
+	default:
+		path := cfg.File
+		if path == "" {
+			dir, err := store.SettingsDir(dataDir)
+			if err != nil {
+				return nil, err
+			}
+			path = filepath.Join(dir, "leader.json")
+		}
+		lock = leader.NewFile(path)
+	}
+
+	identity := cfg.Identity
+	if identity == "" {
+		host, err := os.Hostname()
+		if err != nil {
+			return nil, fmt.Errorf("no identity set and the host name is unknown: %v", err)
+		}
+		identity = fmt.Sprintf("%s_%d", host, os.Getpid())
+	}
+	return leader.New(lock, identity, time.Duration(cfg.LeaseDuration), clk, func(leading bool) {
+		value := 0.0
+		if leading {
+			value = 1
+		}
+		leaderGauge.Set(value)
+	}), nil
+}
+
+// reloadTickets picks up the tickets saved through the other replicas
+func reloadTickets(state *AppState) scheduler.Job {
+	return func(<-chan struct{}) {
+		if err := state.Reload(); err != nil {
+			slog.Warn("Failed to reload tickets", "error", err)
+		}
+	}
+}
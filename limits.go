@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	"OpTrack/internal/store"
+)
+
+// defaultMaxOperatorsPerTicket keeps a pasted list of thousands of images
+// from being polled, well above what any real rebuild ticket tracks
+const defaultMaxOperatorsPerTicket = 500
+
+// LimitsConfig caps what tickets may track, protecting the poller and the
+// registry's rate limits. Zero means no limit.
+type LimitsConfig struct {
+	// MaxOperatorsPerTicket counts the members of the ticket's groups too
+	MaxOperatorsPerTicket int `yaml:"maxOperatorsPerTicket"`
+	// The quotas count tickets that aren't archived
+	MaxTickets           int `yaml:"maxTickets"`
+	MaxTicketsPerOwner   int `yaml:"maxTicketsPerOwner"`   // By the owner notified about them, regardless of case
+	MaxTicketsPerProject int `yaml:"maxTicketsPerProject"` // Tickets without a project don't count towards any
+}
+
+// ticketLimits is replaced by config reloads; nil leaves tickets unlimited
+var ticketLimits atomic.Pointer[LimitsConfig]
+
+// checkLimits checks a ticket about to be saved against the configured
+// limits, given the ticket it replaces, if any. Only what changes is
+// checked, so tickets over limits that were lowered can still be edited
+// as long as they don't grow: the operators when there are more of them,
+// and the quotas when the ticket is new, unarchived, or given another owner
+// or project.
+//
+// Tickets that count towards a quota are checked and saved one at a time,
+// so that tickets saved together can't exceed it: the function returned
+// lets the next one be checked, and is called once the ticket is published
+// or failed to save.
+func (s *AppState) checkLimits(ticket JiraTicket, old *JiraTicket) (func(), error) {
+	release := func() {}
+	limits := ticketLimits.Load()
+	if limits == nil {
+		return release, nil
+	}
+	if limits.MaxOperatorsPerTicket > 0 {
+		n := len(expandGroups(ticket, s.groups).Operators)
+		if n > limits.MaxOperatorsPerTicket && (old == nil || n > len(old.Operators)) {
+			return release, fmt.Errorf("%w: %s would track %d operators, at most %d are allowed", store.ErrTooManyOperators, ticket.ID, n, limits.MaxOperatorsPerTicket)
+		}
+	}
+	if ticket.Archived != nil {
+		return release, nil
+	}
+	added := old == nil || old.Archived != nil
+	newOwner := ticket.Owner != "" && (added || !strings.EqualFold(ticket.Owner, old.Owner))
+	newProject := ticket.Project != "" && (added || ticket.Project != old.Project)
+	if !(added && limits.MaxTickets > 0) && !(newOwner && limits.MaxTicketsPerOwner > 0) && !(newProject && limits.MaxTicketsPerProject > 0) {
+		return release, nil
+	}
+
+	s.quotaMu.Lock()
+
+	var total, owned, inProject int
+	for id, t := range s.List() {
+		if id == ticket.ID || t.Archived != nil {
+			continue
+		}
+		total++
+		if ticket.Owner != "" && strings.EqualFold(t.Owner, ticket.Owner) {
+			owned++
+		}
+		if ticket.Project != "" && t.Project == ticket.Project {
+			inProject++
+		}
+	}
+	var err error
+	switch {
+	case added && limits.MaxTickets > 0 && total >= limits.MaxTickets:
+		err = fmt.Errorf("%w: there already are the most tickets allowed (%d)", store.ErrQuotaExceeded, limits.MaxTickets)
+	case newOwner && limits.MaxTicketsPerOwner > 0 && owned >= limits.MaxTicketsPerOwner:
+		err = fmt.Errorf("%w: %s already owns the most tickets allowed (%d)", store.ErrQuotaExceeded, ticket.Owner, limits.MaxTicketsPerOwner)
+	case newProject && limits.MaxTicketsPerProject > 0 && inProject >= limits.MaxTicketsPerProject:
+		err = fmt.Errorf("%w: project %s already has the most tickets allowed (%d)", store.ErrQuotaExceeded, ticket.Project, limits.MaxTicketsPerProject)
+	}
+	if err != nil {
+		s.quotaMu.Unlock()
+		return release, err
+	}
+	return s.quotaMu.Unlock, nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// unixSocketMode lets a reverse proxy in the same group connect to the socket
+const unixSocketMode = 0660
+
+// systemdFirstFD is the first file descriptor passed by systemd socket activation
+const systemdFirstFD = 3
+
+// listen opens the listener for a listen setting:
+//
+//	host:port    TCP, e.g. ":8080" or "127.0.0.1:8080"
+//	unix:PATH    Unix domain socket
+//	systemd      the socket passed in by systemd socket activation
+func listen(addr string) (net.Listener, error) {
+	switch {
+	case addr == "systemd":
+		return systemdListener()
+
+	case strings.HasPrefix(addr, "unix:"):
+		path := strings.TrimPrefix(addr, "unix:")
+		// Remove a socket left behind by a previous run that didn't shut down cleanly
+		if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+			os.Remove(path)
+		}
+		l, err := net.Listen("unix", path)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.Chmod(path, unixSocketMode); err != nil {
+			l.Close()
+			return nil, fmt.Errorf("failed to set socket permissions: %v", err)
+		}
+		return l, nil
+
+	default:
+		return net.Listen("tcp", addr)
+	}
+}
+
+// systemdListener returns the first socket passed by systemd, as described in sd_listen_fds(3)
+func systemdListener() (net.Listener, error) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, fmt.Errorf("no socket passed by systemd: LISTEN_PID is not set to this process")
+	}
+	fds, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || fds < 1 {
+		return nil, fmt.Errorf("no socket passed by systemd: LISTEN_FDS is %q", os.Getenv("LISTEN_FDS"))
+	}
+
+	// Keep child processes from thinking the sockets are meant for them
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	f := os.NewFile(uintptr(systemdFirstFD), "systemd-socket")
+	defer f.Close() // FileListener dups the descriptor
+	l, err := net.FileListener(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to use socket passed by systemd: %v", err)
+	}
+	return l, nil
+}
+
+// validListen checks a listen setting without opening it
+func validListen(addr string) error {
+	switch {
+	case addr == "systemd":
+		return nil
+	case strings.HasPrefix(addr, "unix:"):
+		if strings.TrimPrefix(addr, "unix:") == "" {
+			return fmt.Errorf("%q is missing the socket path, e.g. \"unix:/run/optrack/optrack.sock\"", addr)
+		}
+		return nil
+	}
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return fmt.Errorf("%q is not a host:port address, unix:PATH or systemd, e.g. \":8080\" or \"127.0.0.1:8080\"", addr)
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"OpTrack/internal/api"
+	"OpTrack/internal/ids"
+	"OpTrack/internal/middleware"
+)
+
+// setupLogging configures the default slog logger from OPTRACK_LOG_LEVEL
+// (debug, info, warn, error), OPTRACK_LOG_FORMAT (text, json) and the sink
+// selected by OPTRACK_LOG_SINK. defaultLevel applies when no level is set.
+func setupLogging(defaultLevel slog.Level) error {
+	level := defaultLevel
+	if value := os.Getenv("OPTRACK_LOG_LEVEL"); value != "" {
+		if err := level.UnmarshalText([]byte(value)); err != nil {
+			return fmt.Errorf("invalid OPTRACK_LOG_LEVEL %q: use debug, info, warn or error", value)
+		}
+	}
+
+	out, err := openLogSink()
+	if err != nil {
+		return err
+	}
+
+	var sink *levelSink
+	if lw, ok := out.(levelWriter); ok {
+		sink = &levelSink{out: lw}
+		out = sink
+	}
+
+	opts := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	switch strings.ToLower(os.Getenv("OPTRACK_LOG_FORMAT")) {
+	case "", "text":
+		handler = slog.NewTextHandler(out, opts)
+	case "json":
+		handler = slog.NewJSONHandler(out, opts)
+	default:
+		return fmt.Errorf("invalid OPTRACK_LOG_FORMAT %q: use text or json", os.Getenv("OPTRACK_LOG_FORMAT"))
+	}
+
+	if sink != nil {
+		handler = &levelHandler{Handler: handler, sink: sink}
+	}
+
+	slog.SetDefault(slog.New(handler))
+	return nil
+}
+
+// fatal logs an error and exits, for unrecoverable startup failures
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+type loggerKey struct{}
+type requestIDKey struct{}
+
+// requestIDHeader carries the request ID in both directions so a request can be
+// followed across services
+const requestIDHeader = "X-Request-ID"
+
+// requestLogger returns the logger carrying the request's fields, falling
+// back to the default logger outside of a request
+func requestLogger(r *http.Request) *slog.Logger {
+	if logger, ok := r.Context().Value(loggerKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// requestID returns the ID assigned to the request by logRequests, or "" for
+// changes made outside of a request such as from the CLI
+func requestID(r *http.Request) string {
+	if r == nil {
+		return ""
+	}
+	id, _ := r.Context().Value(requestIDKey{}).(string)
+	return id
+}
+
+// requestIDs makes the IDs of requests that don't bring their own
+var requestIDs ids.Source = ids.Random
+
+// validRequestID accepts caller-supplied IDs that are safe to log and echo back
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+// httpError writes an error that includes the request ID, so users can quote
+// it when reporting problems. API errors are JSON, like those of the ticket API;
+// pages get plain text.
+func httpError(w http.ResponseWriter, r *http.Request, msg string, code int) {
+	if strings.HasPrefix(r.URL.Path, "/api/") {
+		api.WriteErrorMessage(w, requestID(r), msg, code)
+		return
+	}
+	if id := requestID(r); id != "" {
+		msg = fmt.Sprintf("%s (request ID: %s)", msg, id)
+	}
+	http.Error(w, msg, code)
+}
+
+// logRequests assigns every request an ID, taken from the X-Request-ID header
+// when the caller sends a valid one, attaches a request-scoped logger and
+// writes one access log line once the handler returns
+func logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID(id) {
+			id = requestIDs.New()
+		}
+		w.Header().Set(requestIDHeader, id)
+
+		logger := slog.Default().With("request_id", id, "method", r.Method, "path", r.URL.Path)
+		ctx := context.WithValue(r.Context(), requestIDKey{}, id)
+		ctx = context.WithValue(ctx, loggerKey{}, logger)
+		r = r.WithContext(ctx)
+
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+
+		logger.Info("access",
+			"status", rec.status,
+			"bytes", rec.bytes,
+			"duration_ms", float64(time.Since(start).Microseconds())/1000,
+			"remote_addr", r.RemoteAddr,
+			"user_agent", r.UserAgent(),
+		)
+	})
+}
+
+// recoverPanics turns a panicking handler into a 500 response carrying the
+// request ID, logs the stack and reports it to Sentry when configured
+func recoverPanics(reporter *SentryReporter) middleware.Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer func() {
+				recovered := recover()
+				if recovered == nil {
+					return
+				}
+				if recovered == http.ErrAbortHandler {
+					// Deliberate abort of the response, let net/http handle it
+					panic(recovered)
+				}
+
+				httpPanicsTotal.Inc()
+				requestLogger(r).Error("Panic while handling request", "panic", fmt.Sprint(recovered), "stack", string(debug.Stack()))
+
+				if reporter != nil {
+					frames := stackFrames(3)
+					go func() {
+						if err := reporter.ReportPanic(r, recovered, frames); err != nil {
+							slog.Error("Failed to report panic to Sentry", "request_id", requestID(r), "error", err)
+						}
+					}()
+				}
+
+				httpError(w, r, "Internal server error", http.StatusInternalServerError)
+			}()
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults for the rotating file sink
+const (
+	defaultLogMaxSizeMB  = 100
+	defaultLogMaxBackups = 7
+)
+
+// openLogSink returns the writer selected by OPTRACK_LOG_SINK: stderr (the
+// default), stdout, file, syslog, journald or eventlog (the default for a
+// Windows service). Syslog, journald and event log writers receive the level
+// of each record so they can set the message priority.
+func openLogSink() (io.Writer, error) {
+	sink := strings.ToLower(os.Getenv("OPTRACK_LOG_SINK"))
+	if sink == "" && isWindowsService() {
+		sink = "eventlog" // A service has no console
+	}
+	switch sink {
+	case "", "stderr":
+		return os.Stderr, nil
+	case "stdout":
+		return os.Stdout, nil
+	case "file":
+		return rotatingFileFromEnv()
+	case "syslog":
+		return newSyslogWriter(os.Getenv("OPTRACK_SYSLOG_ADDR"), logIdentifier())
+	case "journald":
+		return newJournaldWriter(logIdentifier())
+	case "eventlog":
+		return newEventLogWriter(logIdentifier())
+	default:
+		return nil, fmt.Errorf("invalid OPTRACK_LOG_SINK %q: use stderr, stdout, file, syslog, journald or eventlog", sink)
+	}
+}
+
+func logIdentifier() string {
+	if tag := os.Getenv("OPTRACK_LOG_TAG"); tag != "" {
+		return tag
+	}
+	return "optrack"
+}
+
+// levelWriter is a sink that needs to know the level of each record
+type levelWriter interface {
+	WriteLevel(level slog.Level, p []byte) error
+}
+
+// levelSink adapts a levelWriter to io.Writer for a formatting handler. The
+// level is set by levelHandler immediately before the handler writes.
+type levelSink struct {
+	mu    sync.Mutex
+	level slog.Level
+	out   levelWriter
+}
+
+func (s *levelSink) Write(p []byte) (int, error) {
+	return len(p), s.out.WriteLevel(s.level, p)
+}
+
+// levelHandler passes each record's level through to a levelSink
+type levelHandler struct {
+	slog.Handler
+	sink *levelSink
+}
+
+func (h *levelHandler) Handle(ctx context.Context, r slog.Record) error {
+	h.sink.mu.Lock()
+	defer h.sink.mu.Unlock()
+	h.sink.level = r.Level
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *levelHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &levelHandler{Handler: h.Handler.WithAttrs(attrs), sink: h.sink}
+}
+
+func (h *levelHandler) WithGroup(name string) slog.Handler {
+	return &levelHandler{Handler: h.Handler.WithGroup(name), sink: h.sink}
+}
+
+// RotatingFile is a log file that is rotated once it exceeds a size limit.
+// Rotated files older than maxAge, or beyond maxBackups, are removed.
+type RotatingFile struct {
+	path       string
+	maxSize    int64
+	maxAge     time.Duration
+	maxBackups int
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+func NewRotatingFile(path string, maxSize int64, maxAge time.Duration, maxBackups int) (*RotatingFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create log directory: %v", err)
+	}
+
+	rf := &RotatingFile{path: path, maxSize: maxSize, maxAge: maxAge, maxBackups: maxBackups}
+	if err := rf.open(); err != nil {
+		return nil, err
+	}
+	return rf, nil
+}
+
+// rotatingFileFromEnv reads OPTRACK_LOG_FILE, OPTRACK_LOG_MAX_SIZE_MB,
+// OPTRACK_LOG_MAX_AGE and OPTRACK_LOG_MAX_BACKUPS
+func rotatingFileFromEnv() (*RotatingFile, error) {
+	path := os.Getenv("OPTRACK_LOG_FILE")
+	if path == "" {
+		return nil, fmt.Errorf("OPTRACK_LOG_FILE is required when OPTRACK_LOG_SINK=file")
+	}
+
+	maxSizeMB := defaultLogMaxSizeMB
+	if value := os.Getenv("OPTRACK_LOG_MAX_SIZE_MB"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid OPTRACK_LOG_MAX_SIZE_MB %q", value)
+		}
+		maxSizeMB = n
+	}
+
+	var maxAge time.Duration
+	if value := os.Getenv("OPTRACK_LOG_MAX_AGE"); value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("invalid OPTRACK_LOG_MAX_AGE %q", value)
+		}
+		maxAge = d
+	}
+
+	maxBackups := defaultLogMaxBackups
+	if value := os.Getenv("OPTRACK_LOG_MAX_BACKUPS"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid OPTRACK_LOG_MAX_BACKUPS %q", value)
+		}
+		maxBackups = n
+	}
+
+	return NewRotatingFile(path, int64(maxSizeMB)*1024*1024, maxAge, maxBackups)
+}
+
+func (rf *RotatingFile) open() error {
+	f, err := os.OpenFile(rf.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %v", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	rf.file = f
+	rf.size = info.Size()
+	return nil
+}
+
+func (rf *RotatingFile) Write(p []byte) (int, error) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	if rf.size > 0 && rf.size+int64(len(p)) > rf.maxSize {
+		if err := rf.rotate(); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to rotate log file: %v\n", err)
+		}
+	}
+
+	n, err := rf.file.Write(p)
+	rf.size += int64(n)
+	return n, err
+}
+
+func (rf *RotatingFile) rotate() error {
+	if err := rf.file.Close(); err != nil {
+		return err
+	}
+
+	backup := rf.path + "." + time.Now().Format("20060102T150405.000")
+	if err := os.Rename(rf.path, backup); err != nil {
+		return err
+	}
+	if err := rf.open(); err != nil {
+		return err
+	}
+
+	rf.cleanup()
+	return nil
+}
+
+// cleanup removes rotated files past the age or count limits
+func (rf *RotatingFile) cleanup() {
+	backups, err := filepath.Glob(rf.path + ".*")
+	if err != nil {
+		return
+	}
+	// Timestamp suffixes sort chronologically; newest first
+	sort.Sort(sort.Reverse(sort.StringSlice(backups)))
+
+	for i, backup := range backups {
+		remove := rf.maxBackups > 0 && i >= rf.maxBackups
+		if rf.maxAge > 0 {
+			if info, err := os.Stat(backup); err == nil && time.Since(info.ModTime()) > rf.maxAge {
+				remove = true
+			}
+		}
+		if remove {
+			os.Remove(backup)
+		}
+	}
+}
+
+func (rf *RotatingFile) Close() error {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	return rf.file.Close()
+}
+
+// journaldSocket is where systemd-journald listens for native protocol messages
+const journaldSocket = "/run/systemd/journal/socket"
+
+// journaldWriter sends records to journald using its native protocol, so the
+// priority and identifier are preserved as journal fields
+type journaldWriter struct {
+	conn       net.Conn
+	identifier string
+}
+
+func newJournaldWriter(identifier string) (*journaldWriter, error) {
+	conn, err := net.Dial("unixgram", journaldSocket)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to journald: %v", err)
+	}
+	return &journaldWriter{conn: conn, identifier: identifier}, nil
+}
+
+// syslogPriority maps slog levels to syslog severities (also used by journald)
+func syslogPriority(level slog.Level) int {
+	switch {
+	case level >= slog.LevelError:
+		return 3
+	case level >= slog.LevelWarn:
+		return 4
+	case level >= slog.LevelInfo:
+		return 6
+	}
+	return 7
+}
+
+func (j *journaldWriter) WriteLevel(level slog.Level, p []byte) error {
+	var msg bytes.Buffer
+	writeJournalField(&msg, "PRIORITY", strconv.Itoa(syslogPriority(level)))
+	writeJournalField(&msg, "SYSLOG_IDENTIFIER", j.identifier)
+	writeJournalField(&msg, "MESSAGE", strings.TrimRight(string(p), "\n"))
+	_, err := j.conn.Write(msg.Bytes())
+	return err
+}
+
+// writeJournalField encodes a field, using the length-prefixed form for
+// values that contain newlines
+func writeJournalField(buf *bytes.Buffer, key, value string) {
+	if !strings.Contains(value, "\n") {
+		fmt.Fprintf(buf, "%s=%s\n", key, value)
+		return
+	}
+	buf.WriteString(key)
+	buf.WriteByte('\n')
+	binary.Write(buf, binary.LittleEndian, uint64(len(value)))
+	buf.WriteString(value)
+	buf.WriteByte('\n')
+}
+
+func (j *journaldWriter) Write(p []byte) (int, error) {
+	return len(p), j.WriteLevel(slog.LevelInfo, p)
+}
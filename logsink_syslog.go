@@ -0,0 +1,51 @@
+//go:build !windows && !plan9
+
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"log/syslog"
+	"net/url"
+)
+
+// syslogWriter sends records to a local or remote syslog daemon
+type syslogWriter struct {
+	w *syslog.Writer
+}
+
+// newSyslogWriter connects to addr, given as udp://host:port or tcp://host:port,
+// or to the local syslog daemon when addr is empty
+func newSyslogWriter(addr, tag string) (*syslogWriter, error) {
+	network, raddr := "", ""
+	if addr != "" {
+		u, err := url.Parse(addr)
+		if err != nil || u.Host == "" || (u.Scheme != "udp" && u.Scheme != "tcp") {
+			return nil, fmt.Errorf("invalid OPTRACK_SYSLOG_ADDR %q: use udp://host:port or tcp://host:port", addr)
+		}
+		network, raddr = u.Scheme, u.Host
+	}
+
+	w, err := syslog.Dial(network, raddr, syslog.LOG_INFO|syslog.LOG_DAEMON, tag)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to syslog: %v", err)
+	}
+	return &syslogWriter{w: w}, nil
+}
+
+func (s *syslogWriter) WriteLevel(level slog.Level, p []byte) error {
+	msg := string(p)
+	switch syslogPriority(level) {
+	case 3:
+		return s.w.Err(msg)
+	case 4:
+		return s.w.Warning(msg)
+	case 6:
+		return s.w.Info(msg)
+	}
+	return s.w.Debug(msg)
+}
+
+func (s *syslogWriter) Write(p []byte) (int, error) {
+	return len(p), s.WriteLevel(slog.LevelInfo, p)
+}
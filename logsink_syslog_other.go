@@ -0,0 +1,22 @@
+//go:build windows || plan9
+
+package main
+
+import (
+	"fmt"
+	"log/slog"
+)
+
+type syslogWriter struct{}
+
+func newSyslogWriter(addr, tag string) (*syslogWriter, error) {
+	return nil, fmt.Errorf("syslog is not supported on this platform")
+}
+
+func (s *syslogWriter) WriteLevel(level slog.Level, p []byte) error {
+	return nil
+}
+
+func (s *syslogWriter) Write(p []byte) (int, error) {
+	return len(p), nil
+}
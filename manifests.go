@@ -0,0 +1,106 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"OpTrack/internal/manifests"
+	"OpTrack/internal/store"
+)
+
+func newTicketImportCommand(opts *cliOptions) *cobra.Command {
+	var (
+		file       string
+		registries []string
+		owner      string
+		dryRun     bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "import <ticket>",
+		Short: "Create a ticket tracking the images referenced by Kubernetes manifests",
+		Long: `Create a ticket tracking the images referenced by Kubernetes manifests,
+replacing any existing ticket with the same ID.
+
+The manifests are YAML or JSON, any number of documents: Deployments and other
+workloads, ClusterServiceVersions, Lists, or the output of kustomize build or
+helm template. Container images, CSV containerImage annotations, relatedImages
+and RELATED_IMAGE_ environment variables are read, and the images on the
+--registry registries become the ticket's operators.`,
+		Example: "  kustomize build deploy/ | optrack ticket import OSD-1234\n  optrack ticket import OSD-1234 -f bundle/manifests/foo.clusterserviceversion.yaml --dry-run",
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			in := cmd.InOrStdin()
+			if file != "" && file != "-" {
+				f, err := os.Open(file)
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+				in = f
+			}
+
+			res, err := manifests.Import(in, registries)
+			if errors.Is(err, manifests.ErrNoImages) {
+				if len(res.Images) > 0 {
+					printImportedImages(cmd.ErrOrStderr(), res.Images)
+				}
+				return fmt.Errorf("no images on %s found in the manifests", strings.Join(registries, ", "))
+			}
+			if err != nil {
+				return fmt.Errorf("failed to read manifests: %v", err)
+			}
+
+			ticket := JiraTicket{ID: args[0], Operators: store.OperatorsNamed(res.Operators), Pins: res.Pins, Owner: owner}
+			if !dryRun {
+				backend, err := opts.backend()
+				if err != nil {
+					return err
+				}
+				if ticket, err = backend.SaveTicket(ticket); err != nil {
+					return fmt.Errorf("failed to save ticket: %v", err)
+				}
+			}
+			imported := struct {
+				Ticket JiraTicket        `json:"ticket"`
+				Images []manifests.Image `json:"images"`
+			}{ticket, res.Images}
+			return opts.printer(cmd).print(imported, func(bool) {
+				out := cmd.OutOrStdout()
+				printImportedImages(out, res.Images)
+				if dryRun {
+					fmt.Fprintf(out, "\nWould save %s with %d operators\n", ticket.ID, len(ticket.Operators))
+				} else {
+					fmt.Fprintf(out, "\nSaved %s with %d operators\n", ticket.ID, len(ticket.Operators))
+				}
+			})
+		},
+	}
+
+	cmd.Flags().StringVarP(&file, "file", "f", "", "File to read the manifests from (default stdin)")
+	cmd.Flags().StringSliceVar(&registries, "registry", []string{manifests.DefaultRegistry}, "Registry whose images are tracked; repeatable")
+	cmd.Flags().StringVar(&owner, "owner", "", "Email address notified about the ticket")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show the operators found without saving the ticket")
+	return cmd
+}
+
+// printImportedImages prints one row per image reference, with the operator
+// it was tracked as or why it was skipped
+func printImportedImages(out io.Writer, images []manifests.Image) {
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "LINE\tSOURCE\tIMAGE\tOPERATOR")
+	for _, img := range images {
+		operator := img.Operator
+		if img.Skipped != "" {
+			operator = "skipped: " + img.Skipped
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", img.Line, img.Source, img.Image, operator)
+	}
+	tw.Flush()
+}
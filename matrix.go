@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// MatrixConfig holds the Matrix bot credentials. Matrix is disabled when no
+// homeserver is set.
+type MatrixConfig struct {
+	Homeserver  string `yaml:"homeserver"`
+	AccessToken string `yaml:"accessToken"`
+	RoomID      string `yaml:"roomID"`
+}
+
+// MatrixNotifier posts events as messages to a Matrix room
+type MatrixNotifier struct {
+	homeserver  string
+	accessToken string
+	roomID      string
+	client      *http.Client
+	txnCounter  uint64
+}
+
+func NewMatrixNotifier(homeserver, accessToken, roomID string) *MatrixNotifier {
+	return &MatrixNotifier{
+		homeserver:  strings.TrimSuffix(homeserver, "/"),
+		accessToken: accessToken,
+		roomID:      roomID,
+		client:      &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (n *MatrixNotifier) Name() string {
+	return "matrix"
+}
+
+func (n *MatrixNotifier) Notify(ev Event) error {
+	plain, formatted := matrixMessage(ev)
+	payload := map[string]string{
+		"msgtype":        "m.notice",
+		"body":           plain,
+		"format":         "org.matrix.custom.html",
+		"formatted_body": formatted,
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	// Transaction IDs make retries idempotent and must be unique per access token
+	txnID := fmt.Sprintf("optrack-%d-%d", time.Now().UnixNano(), atomic.AddUint64(&n.txnCounter, 1))
+	endpoint := fmt.Sprintf("%s/_matrix/client/v3/rooms/%s/send/m.room.message/%s",
+		n.homeserver, url.PathEscape(n.roomID), url.PathEscape(txnID))
+
+	req, err := http.NewRequest("PUT", endpoint, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+n.accessToken)
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("matrix homeserver returned %d: %s", resp.StatusCode, string(body))
+	}
+	return nil
+}
+
+// matrixMessage renders an event as a plain text body and an HTML formatted body
+func matrixMessage(ev Event) (string, string) {
+	var plain, formatted strings.Builder
+
+	title := eventTitle(ev) + ": " + ev.Ticket.ID
+	fmt.Fprintf(&plain, "%s\n", title)
+	fmt.Fprintf(&formatted, "<b>%s</b><br/>", html.EscapeString(title))
+
+	switch {
+	case ev.Type == EventDigest:
+		formatted.WriteString("<ul>")
+		for _, e := range ev.Events {
+			fmt.Fprintf(&plain, "- %s: %s\n", eventTitle(e), eventSummary(e))
+			fmt.Fprintf(&formatted, "<li><b>%s</b>: %s</li>", html.EscapeString(eventTitle(e)), html.EscapeString(eventSummary(e)))
+		}
+		formatted.WriteString("</ul>")
+
+	case ev.Operator != nil:
+		fmt.Fprintf(&plain, "%s\nSHA256: %s", eventSummary(ev), ev.Operator.SHA256)
+		fmt.Fprintf(&formatted, "%s<br/>SHA256: <code>%s</code>", html.EscapeString(eventSummary(ev)), html.EscapeString(ev.Operator.SHA256))
+
+	default:
+		fmt.Fprintf(&plain, "%s\n", eventSummary(ev))
+		fmt.Fprintf(&formatted, "%s<ul>", html.EscapeString(eventSummary(ev)))
+		for _, status := range ev.Statuses {
+			fmt.Fprintf(&plain, "- %s: %s (%s)\n", status.Name, localTime(status.LastUpdated).Format("2006-01-02"), shortDigest(status.SHA256))
+			fmt.Fprintf(&formatted, "<li><code>%s</code> %s (<code>%s</code>)</li>",
+				html.EscapeString(status.Name), localTime(status.LastUpdated).Format("2006-01-02"), html.EscapeString(shortDigest(status.SHA256)))
+		}
+		formatted.WriteString("</ul>")
+	}
+
+	return strings.TrimSpace(plain.String()), formatted.String()
+}
@@ -0,0 +1,457 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"OpTrack/internal/middleware"
+	"OpTrack/internal/router"
+)
+
+// A minimal Prometheus text exposition implementation, enough for OpTrack's
+// own counters, gauges and histograms without pulling in a client library.
+
+// metricFamily is anything that can write itself in the text exposition
+// format and report its current samples to other emitters
+type metricFamily interface {
+	write(w io.Writer)
+	collect() []metricSample
+}
+
+// metricSample is one value of a metric family, used by non-Prometheus emitters
+type metricSample struct {
+	Name       string
+	Kind       string // "counter" or "gauge"
+	LabelNames []string
+	Labels     []string
+	Value      float64
+}
+
+// collect returns the samples of every registered family
+func (r *MetricsRegistry) collect() []metricSample {
+	r.mu.Lock()
+	families := append([]metricFamily(nil), r.families...)
+	r.mu.Unlock()
+
+	var samples []metricSample
+	for _, f := range families {
+		samples = append(samples, f.collect()...)
+	}
+	return samples
+}
+
+// MetricsRegistry holds the metric families exposed on /metrics
+type MetricsRegistry struct {
+	mu       sync.Mutex
+	families []metricFamily
+}
+
+var defaultRegistry = &MetricsRegistry{}
+
+func (r *MetricsRegistry) register(f metricFamily) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.families = append(r.families, f)
+}
+
+func (r *MetricsRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	families := append([]metricFamily(nil), r.families...)
+	r.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	for _, f := range families {
+		f.write(w)
+	}
+}
+
+// labelKey joins label values so they can be used as a map key
+func labelKey(values []string) string {
+	return strings.Join(values, "\xff")
+}
+
+func formatLabels(names, values []string, extra ...string) string {
+	if len(names) == 0 && len(extra) == 0 {
+		return ""
+	}
+
+	parts := make([]string, 0, len(names)+len(extra)/2)
+	for i, name := range names {
+		parts = append(parts, fmt.Sprintf("%s=%q", name, values[i]))
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		parts = append(parts, fmt.Sprintf("%s=%q", extra[i], extra[i+1]))
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// metricVec stores one float value per label combination
+type metricVec struct {
+	name       string
+	help       string
+	kind       string
+	labelNames []string
+
+	mu     sync.Mutex
+	values map[string]float64
+	labels map[string][]string
+}
+
+func newMetricVec(kind, name, help string, labelNames []string) *metricVec {
+	return &metricVec{
+		name:       name,
+		help:       help,
+		kind:       kind,
+		labelNames: labelNames,
+		values:     make(map[string]float64),
+		labels:     make(map[string][]string),
+	}
+}
+
+func (v *metricVec) update(labelValues []string, fn func(float64) float64) {
+	if len(labelValues) != len(v.labelNames) {
+		panic(fmt.Sprintf("metric %s: expected %d label values, got %d", v.name, len(v.labelNames), len(labelValues)))
+	}
+
+	key := labelKey(labelValues)
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if _, ok := v.labels[key]; !ok {
+		v.labels[key] = append([]string(nil), labelValues...)
+	}
+	v.values[key] = fn(v.values[key])
+}
+
+// Snapshot returns the current values keyed by label values
+func (v *metricVec) Snapshot() map[string]float64 {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	out := make(map[string]float64, len(v.values))
+	for k, val := range v.values {
+		out[k] = val
+	}
+	return out
+}
+
+func (v *metricVec) write(w io.Writer) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", v.name, v.help, v.name, v.kind)
+	keys := make([]string, 0, len(v.values))
+	for k := range v.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(w, "%s%s %s\n", v.name, formatLabels(v.labelNames, v.labels[k]), formatFloat(v.values[k]))
+	}
+}
+
+func (v *metricVec) collect() []metricSample {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	samples := make([]metricSample, 0, len(v.values))
+	for k, val := range v.values {
+		samples = append(samples, metricSample{Name: v.name, Kind: v.kind, LabelNames: v.labelNames, Labels: v.labels[k], Value: val})
+	}
+	return samples
+}
+
+// CounterVec is a monotonically increasing counter partitioned by labels
+type CounterVec struct{ *metricVec }
+
+func NewCounterVec(name, help string, labelNames ...string) *CounterVec {
+	c := &CounterVec{newMetricVec("counter", name, help, labelNames)}
+	defaultRegistry.register(c)
+	return c
+}
+
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+func (c *CounterVec) Add(delta float64, labelValues ...string) {
+	c.update(labelValues, func(v float64) float64 { return v + delta })
+}
+
+// GaugeVec is a value that can go up and down, partitioned by labels
+type GaugeVec struct{ *metricVec }
+
+func NewGaugeVec(name, help string, labelNames ...string) *GaugeVec {
+	g := &GaugeVec{newMetricVec("gauge", name, help, labelNames)}
+	defaultRegistry.register(g)
+	return g
+}
+
+func (g *GaugeVec) Set(value float64, labelValues ...string) {
+	g.update(labelValues, func(float64) float64 { return value })
+}
+
+func (g *GaugeVec) Add(delta float64, labelValues ...string) {
+	g.update(labelValues, func(v float64) float64 { return v + delta })
+}
+
+// Reset drops every label combination, e.g. before repopulating per-item gauges
+func (g *GaugeVec) Reset() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.values = make(map[string]float64)
+	g.labels = make(map[string][]string)
+}
+
+// LabeledValue is one sample returned by a GaugeFunc
+type LabeledValue struct {
+	Labels []string
+	Value  float64
+}
+
+// GaugeFunc is a gauge whose values are computed when metrics are scraped
+type GaugeFunc struct {
+	name       string
+	help       string
+	labelNames []string
+	fn         func() []LabeledValue
+}
+
+func NewGaugeFunc(name, help string, labelNames []string, collect func() []LabeledValue) *GaugeFunc {
+	g := &GaugeFunc{name: name, help: help, labelNames: labelNames, fn: collect}
+	defaultRegistry.register(g)
+	return g
+}
+
+func (g *GaugeFunc) write(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", g.name, g.help, g.name)
+	for _, v := range g.fn() {
+		fmt.Fprintf(w, "%s%s %s\n", g.name, formatLabels(g.labelNames, v.Labels), formatFloat(v.Value))
+	}
+}
+
+func (g *GaugeFunc) collect() []metricSample {
+	values := g.fn()
+	samples := make([]metricSample, 0, len(values))
+	for _, v := range values {
+		samples = append(samples, metricSample{Name: g.name, Kind: "gauge", LabelNames: g.labelNames, Labels: v.Labels, Value: v.Value})
+	}
+	return samples
+}
+
+// defaultBuckets are latency buckets in seconds
+var defaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+type histogramValue struct {
+	labels []string
+	counts []uint64 // Cumulative count per bucket
+	count  uint64
+	sum    float64
+}
+
+// HistogramVec tracks the distribution of observations partitioned by labels
+type HistogramVec struct {
+	name       string
+	help       string
+	labelNames []string
+	buckets    []float64
+
+	mu     sync.Mutex
+	values map[string]*histogramValue
+}
+
+func NewHistogramVec(name, help string, buckets []float64, labelNames ...string) *HistogramVec {
+	h := &HistogramVec{
+		name:       name,
+		help:       help,
+		labelNames: labelNames,
+		buckets:    buckets,
+		values:     make(map[string]*histogramValue),
+	}
+	defaultRegistry.register(h)
+	return h
+}
+
+func (h *HistogramVec) Observe(value float64, labelValues ...string) {
+	key := labelKey(labelValues)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	hv, ok := h.values[key]
+	if !ok {
+		hv = &histogramValue{
+			labels: append([]string(nil), labelValues...),
+			counts: make([]uint64, len(h.buckets)),
+		}
+		h.values[key] = hv
+	}
+
+	for i, bound := range h.buckets {
+		if value <= bound {
+			hv.counts[i]++
+		}
+	}
+	hv.count++
+	hv.sum += value
+}
+
+// ObserveSince records the time elapsed since start in seconds
+func (h *HistogramVec) ObserveSince(start time.Time, labelValues ...string) {
+	h.Observe(time.Since(start).Seconds(), labelValues...)
+}
+
+// collect reports each histogram as its observation count and sum
+func (h *HistogramVec) collect() []metricSample {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	samples := make([]metricSample, 0, 2*len(h.values))
+	for _, hv := range h.values {
+		samples = append(samples,
+			metricSample{Name: h.name + "_count", Kind: "counter", LabelNames: h.labelNames, Labels: hv.labels, Value: float64(hv.count)},
+			metricSample{Name: h.name + "_sum", Kind: "counter", LabelNames: h.labelNames, Labels: hv.labels, Value: hv.sum},
+		)
+	}
+	return samples
+}
+
+func (h *HistogramVec) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+	keys := make([]string, 0, len(h.values))
+	for k := range h.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		hv := h.values[k]
+		for i, bound := range h.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(h.labelNames, hv.labels, "le", formatFloat(bound)), hv.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(h.labelNames, hv.labels, "le", "+Inf"), hv.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, formatLabels(h.labelNames, hv.labels), formatFloat(hv.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, formatLabels(h.labelNames, hv.labels), hv.count)
+	}
+}
+
+// Application metrics
+var (
+	httpRequestsTotal = NewCounterVec("optrack_http_requests_total",
+		"HTTP requests handled, by route, method and status code.", "handler", "method", "code")
+	httpRequestDuration = NewHistogramVec("optrack_http_request_duration_seconds",
+		"HTTP request latency by route and method.", defaultBuckets, "handler", "method")
+
+	quayRequestsTotal = NewCounterVec("optrack_quay_requests_total",
+		"Requests made to the Quay.io API, by status code (\"error\" for transport failures).", "code")
+	quayRequestDuration = NewHistogramVec("optrack_quay_request_duration_seconds",
+		"Quay.io API request latency.", defaultBuckets)
+	quayCircuitOpen = NewGaugeVec("optrack_quay_circuit_open",
+		"1 while the Quay.io circuit breaker is open.")
+	quayBudgetRate = NewGaugeVec("optrack_quay_budget_requests_per_minute",
+		"Requests per minute the Quay.io request budget allows, lowered while Quay.io rate limits.")
+	quayCacheRequestsTotal = NewCounterVec("optrack_quay_cache_requests_total",
+		"Operator status lookups served from the cache (hit) or Quay.io (miss), misses that shared an in-flight request (shared), and expired entries served while they are refreshed (stale).", "result")
+
+	pollerQueueDepth = NewGaugeVec("optrack_poller_queue_depth",
+		"Tickets remaining in the current poll cycle.")
+	pollerCyclesTotal = NewCounterVec("optrack_poller_cycles_total",
+		"Completed poll cycles.")
+	pollerCycleDuration = NewHistogramVec("optrack_poller_cycle_duration_seconds",
+		"Time taken by a full poll cycle.", []float64{1, 5, 10, 30, 60, 120, 300, 600})
+	pollerLastCycle = NewGaugeVec("optrack_poller_last_cycle_timestamp_seconds",
+		"Unix time the last poll cycle finished.")
+	leaderGauge = NewGaugeVec("optrack_leader",
+		"1 while this replica polls and sends notifications: always without leader election, else while it is the leader.")
+
+	httpPanicsTotal = NewCounterVec("optrack_http_panics_total",
+		"Panics recovered while handling HTTP requests.")
+	httpRateLimitedTotal = NewCounterVec("optrack_http_rate_limited_total",
+		"Requests rejected for exceeding the per-client rate limit.")
+
+	operatorAgeSeconds = NewGaugeVec("optrack_operator_age_seconds",
+		"Age of the latest image of each tracked operator, as of the last poll.", "ticket", "operator")
+	operatorStale = NewGaugeVec("optrack_operator_stale",
+		"1 if the operator's latest image is older than the stale threshold.", "ticket", "operator")
+	operatorVulnerabilities = NewGaugeVec("optrack_operator_vulnerabilities",
+		"Vulnerabilities found in the operator's latest image by the last scan, by severity.", "ticket", "operator", "severity")
+	operatorBaseOutdated = NewGaugeVec("optrack_operator_base_outdated",
+		"1 if the operator's latest image is built on an older image of its base, when base images are checked.", "ticket", "operator")
+
+	notificationsTotal = NewCounterVec("optrack_notifications_total",
+		"Notifications sent, by channel and result.", "channel", "result")
+	eventsDroppedTotal = NewCounterVec("optrack_events_dropped_total",
+		"Events not sent to an /api/events subscriber that had fallen behind.")
+
+	ticketsGauge = NewGaugeVec("optrack_tickets",
+		"Number of tracked tickets.")
+)
+
+// statusRecorder captures the status code and body size written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	r.status = code
+	r.ResponseWriter.WriteHeader(code)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer, e.g. to flush
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += n
+	return n, err
+}
+
+// instrumentRequests records request counts and latencies for every request,
+// labelled with the pattern of mux that matches it
+func instrumentRequests(mux router.Router) middleware.Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			pattern := mux.Route(r)
+			if pattern == "" {
+				pattern = "unmatched"
+			} else if _, path, ok := strings.Cut(pattern, " "); ok {
+				pattern = path // The method is a label of its own
+			}
+
+			start := time.Now()
+			rec := &statusRecorder{ResponseWriter: w}
+			next.ServeHTTP(rec, r)
+			if rec.status == 0 {
+				rec.status = http.StatusOK
+			}
+
+			httpRequestsTotal.Inc(pattern, r.Method, strconv.Itoa(rec.status))
+			httpRequestDuration.ObserveSince(start, pattern, r.Method)
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"OpTrack/internal/clock"
+	"OpTrack/internal/middleware"
+	"OpTrack/internal/router"
+)
+
+// serverMiddleware is the stack every request passes through, outermost
+// first. mux is only used to label metrics with the route that matches.
+func serverMiddleware(cfg *Config, mux router.Router, sentry *SentryReporter, clk clock.Clock) []middleware.Middleware {
+	trusted, _ := parseProxies(cfg.HTTP.TrustedProxies) // Checked by Validate
+	return []middleware.Middleware{
+		logRequests,
+		recoverPanics(sentry),
+		stripBasePath(basePath),
+		instrumentRequests(mux),
+		middleware.CORS(cfg.HTTP.CORSOrigins),
+		middleware.RateLimit(cfg.HTTP.RateLimit, cfg.HTTP.RateBurst, clk, rateLimitKey(trusted), rejectRateLimited),
+	}
+}
+
+// requireAdminToken only lets requests with the admin token as a bearer token
+// through. The admin API is disabled while no token is configured.
+func requireAdminToken(token func() string) middleware.Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			want := token()
+			if want == "" {
+				httpError(w, r, "Admin API disabled: set auth.adminToken", http.StatusForbidden)
+				return
+			}
+			if !hasBearerToken(r, want) {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				httpError(w, r, "Invalid admin token", http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// hasBearerToken reports whether a request has token as its bearer token
+func hasBearerToken(r *http.Request, token string) bool {
+	given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(given), []byte(token)) == 1
+}
+
+// routeError answers requests that no route takes in the same format as
+// handler errors, JSON under /api/
+func routeError(w http.ResponseWriter, r *http.Request, status int) {
+	httpError(w, r, http.StatusText(status), status)
+}
+
+// rateLimitKey returns how the client of a request is identified: by the
+// user named by the actor headers when the request comes from one of the
+// trusted reverse proxies, so users behind it get their own limit, and
+// otherwise by the remote address, so a client can't dodge its limit by
+// naming another user in every request
+func rateLimitKey(trusted []netip.Prefix) func(*http.Request) string {
+	return func(r *http.Request) string {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr // Unix socket clients all share one limit
+		}
+		if addr, err := netip.ParseAddr(host); err == nil && fromProxy(addr.Unmap(), trusted) {
+			if actor := requestActor(r); actor != anonymousActor {
+				return "user:" + actor
+			}
+		}
+		return "addr:" + host
+	}
+}
+
+func fromProxy(addr netip.Addr, trusted []netip.Prefix) bool {
+	for _, prefix := range trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseProxies reads addresses, such as 10.0.0.7, and CIDR ranges, such as
+// 10.0.0.0/24
+func parseProxies(values []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(values))
+	for _, value := range values {
+		if prefix, err := netip.ParsePrefix(value); err == nil {
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(value)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not an address or CIDR range", value)
+		}
+		prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+	}
+	return prefixes, nil
+}
+
+func rejectRateLimited(w http.ResponseWriter, r *http.Request) {
+	httpRateLimitedTotal.Inc()
+	httpError(w, r, "Too many requests, retry after "+w.Header().Get("Retry-After")+"s", http.StatusTooManyRequests)
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"OpTrack/quaytest"
+)
+
+// startMockRegistry serves a fake Quay.io API on a loopback port for
+// --mock-registry mode and returns its URL
+func startMockRegistry(latency time.Duration, failureRate float64) (string, error) {
+	if failureRate < 0 || failureRate > 1 {
+		return "", fmt.Errorf("--mock-failure-rate must be between 0 and 1")
+	}
+
+	registry := quaytest.NewRegistry()
+	registry.SetLatency(latency)
+	registry.SetFailureRate(failureRate, time.Now().UnixNano())
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", fmt.Errorf("failed to start mock registry: %v", err)
+	}
+	go http.Serve(l, registry)
+
+	url := "http://" + l.Addr().String()
+	slog.Info("Using mock Quay registry with generated tags", "url", url, "latency", latency, "failure_rate", failureRate)
+	return url, nil
+}
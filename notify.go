@@ -0,0 +1,362 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"OpTrack/internal/clock"
+	"OpTrack/internal/store"
+)
+
+// staleThreshold is the age after which an operator image is considered stale.
+// It matches the red "days old" highlighting in the web UI. Set from the
+// configuration at startup and on reload.
+var staleThreshold = newDurationSetting(30 * 24 * time.Hour)
+
+// warningThreshold is the age at which the UI starts highlighting an operator
+var warningThreshold = newDurationSetting(14 * 24 * time.Hour)
+
+// ticketThresholds returns the warning and stale ages of a ticket's
+// operators: its own thresholds, or else the configured ones
+func ticketThresholds(ticket JiraTicket) (warning, stale time.Duration) {
+	warning, stale = warningThreshold.Get(), staleThreshold.Get()
+	if t := ticket.Thresholds; t != nil {
+		if d, err := parseAge(t.Warning); t.Warning != "" && err == nil {
+			warning = d
+		}
+		if d, err := parseAge(t.Stale); t.Stale != "" && err == nil {
+			stale = d
+		}
+	}
+	return warning, stale
+}
+
+// checkThresholds checks the thresholds of a ticket are positive ages with
+// the warning age below the stale age, and drops empty ones
+func checkThresholds(ticket *JiraTicket) error {
+	t := ticket.Thresholds
+	if t == nil {
+		return nil
+	}
+	t.Warning, t.Stale = strings.TrimSpace(t.Warning), strings.TrimSpace(t.Stale)
+	if t.Warning == "" && t.Stale == "" {
+		ticket.Thresholds = nil
+		return nil
+	}
+	ages := make(map[string]time.Duration)
+	for name, value := range map[string]string{"warning": t.Warning, "stale": t.Stale} {
+		if value == "" {
+			continue
+		}
+		d, err := parseAge(value)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("%w: %s %q is not an age such as 7d or 36h", store.ErrInvalidThresholds, name, value)
+		}
+		ages[name] = d
+	}
+	if warning, ok := ages["warning"]; ok {
+		if stale, ok := ages["stale"]; ok && warning >= stale {
+			return fmt.Errorf("%w: warning (%s) must be less than stale (%s)", store.ErrInvalidThresholds, t.Warning, t.Stale)
+		}
+	}
+	return nil
+}
+
+// EventType identifies the kind of notification event
+type EventType string
+
+const (
+	// EventTicketRebuilt fires when every operator on a ticket has been
+	// rebuilt since the ticket was added
+	EventTicketRebuilt EventType = "ticket_rebuilt"
+	// EventOperatorStale fires when an operator crosses the stale threshold
+	EventOperatorStale EventType = "operator_stale"
+	// EventOperatorUpdated fires when a new image digest is seen for an operator
+	EventOperatorUpdated EventType = "operator_updated"
+	// EventClusterOutdated fires when a cluster runs an operator but not its
+	// latest image
+	EventClusterOutdated EventType = "cluster_outdated"
+	// EventClusterUpdated fires when a cluster that ran an outdated image of
+	// an operator runs the latest one
+	EventClusterUpdated EventType = "cluster_updated"
+	// EventPinUntagged fires when every tag has moved away from the digest an
+	// operator is pinned to
+	EventPinUntagged EventType = "pin_untagged"
+	// EventPinMissing fires when the digest an operator is pinned to is gone
+	EventPinMissing EventType = "pin_missing"
+	// EventDigest summarizes several events for one ticket sent in a batch
+	EventDigest EventType = "digest"
+)
+
+// Event describes a change in ticket or operator state worth notifying about
+type Event struct {
+	Type     EventType
+	Ticket   JiraTicket
+	Operator *OperatorStatus // Set for operator-level and cluster events
+	Previous string          // Previous digest, set for EventOperatorUpdated
+	Reason   string          // Why the new image was built, set for EventOperatorUpdated when it was given
+	Cluster  *OperatorDrift  // Set for cluster events only
+	Pin      *PinCheck       // Set for pin events only
+	Statuses []OperatorStatus
+	Events   []Event // Batched events, set for EventDigest
+	Time     time.Time
+}
+
+// Notifier delivers events to an external channel
+type Notifier interface {
+	Name() string
+	Notify(ev Event) error
+}
+
+// Dispatcher routes events to the registered notifiers selected by the
+// notification rules. Duplicate alerts are dropped and, when a digest window
+// is set, events are batched per channel and ticket.
+type Dispatcher struct {
+	notifiersMu sync.RWMutex
+	notifiers   map[string]Notifier
+
+	rules  *RuleStore
+	dedup  *DedupStore
+	window time.Duration
+	clock  clock.Clock // Closes digest windows
+
+	mu      sync.Mutex
+	pending map[string]*digestBatch // channel + "|" + ticket ID -> queued events
+}
+
+func NewDispatcher(rules *RuleStore, dedup *DedupStore, window time.Duration, clk clock.Clock) *Dispatcher {
+	return &Dispatcher{
+		notifiers: make(map[string]Notifier),
+		rules:     rules,
+		dedup:     dedup,
+		window:    window,
+		clock:     clock.Or(clk),
+		pending:   make(map[string]*digestBatch),
+	}
+}
+
+// SetNotifiers replaces the registered notifiers, e.g. after credentials change
+func (d *Dispatcher) SetNotifiers(notifiers []Notifier) {
+	byName := make(map[string]Notifier, len(notifiers))
+	for _, n := range notifiers {
+		byName[n.Name()] = n
+	}
+
+	d.notifiersMu.Lock()
+	d.notifiers = byName
+	d.notifiersMu.Unlock()
+}
+
+// Channels returns the names of the registered notifiers
+func (d *Dispatcher) Channels() []string {
+	d.notifiersMu.RLock()
+	defer d.notifiersMu.RUnlock()
+
+	names := make([]string, 0, len(d.notifiers))
+	for name := range d.notifiers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Dispatch sends an event to the channels the rules select, except those it
+// was already sent to
+func (d *Dispatcher) Dispatch(ev Event) {
+	for _, name := range d.rules.Channels(ev, d.Channels()) {
+		if d.dedup.Sent(name, ev) {
+			continue
+		}
+		if d.window > 0 {
+			d.batch(name, ev)
+		} else {
+			d.send(name, ev)
+		}
+	}
+}
+
+func (d *Dispatcher) send(channel string, ev Event) {
+	d.notifiersMu.RLock()
+	n, ok := d.notifiers[channel]
+	d.notifiersMu.RUnlock()
+	if !ok {
+		// The channel was disabled by a reload while a digest was pending
+		slog.Warn("Dropping notification for disabled channel", "event", ev.Type, "ticket", ev.Ticket.ID, "channel", channel)
+		return
+	}
+
+	if err := n.Notify(ev); err != nil {
+		notificationsTotal.Inc(channel, "error")
+		slog.Error("Failed to send notification", "event", ev.Type, "ticket", ev.Ticket.ID, "channel", channel, "error", err)
+		return
+	}
+	notificationsTotal.Inc(channel, "success")
+	// Only delivered alerts are remembered, so failed ones are sent again
+	if ev.Type == EventDigest {
+		d.dedup.Record(channel, ev.Events...)
+	} else {
+		d.dedup.Record(channel, ev)
+	}
+}
+
+// buildNotifiers creates a notifier for every channel with credentials
+// configured and every notifier plugin
+func buildNotifiers(cfg NotificationsConfig, plugins []NotifierPluginConfig, optOuts *OptOutStore, subs *SubscriptionStore, inventory *InventoryStore) []Notifier {
+	var notifiers []Notifier
+
+	var email *EmailNotifier
+	if cfg.SMTP.Host != "" {
+		email = NewEmailNotifier(cfg.SMTP, optOuts)
+		notifiers = append(notifiers, email)
+		slog.Info("Email notifications enabled", "host", cfg.SMTP.Host, "port", cfg.SMTP.Port)
+	}
+	if cfg.Slack.WebhookURL != "" {
+		notifiers = append(notifiers, NewSlackNotifier(cfg.Slack.WebhookURL))
+		slog.Info("Slack notifications enabled")
+	}
+	if cfg.Teams.WebhookURL != "" {
+		notifiers = append(notifiers, NewTeamsNotifier(cfg.Teams.WebhookURL))
+		slog.Info("Microsoft Teams notifications enabled")
+	}
+	if cfg.Matrix.Homeserver != "" {
+		notifiers = append(notifiers, NewMatrixNotifier(cfg.Matrix.Homeserver, cfg.Matrix.AccessToken, cfg.Matrix.RoomID))
+		slog.Info("Matrix notifications enabled")
+	}
+
+	var slackDM *SlackDMClient
+	if cfg.Slack.BotToken != "" {
+		slackDM = NewSlackDMClient(cfg.Slack.BotToken)
+	}
+	if email != nil || slackDM != nil {
+		notifiers = append(notifiers, NewSubscriptionNotifier(subs, email, slackDM))
+	}
+	if len(cfg.TeamChannels) > 0 {
+		notifiers = append(notifiers, NewOwnersNotifier(cfg.TeamChannels, inventory, email))
+		slog.Info("Team notifications enabled", "teams", len(cfg.TeamChannels))
+	}
+	return append(notifiers, buildPluginNotifiers(plugins)...)
+}
+
+// postJSON sends payload to a webhook URL and treats any non-2xx reply as an error
+func postJSON(client *http.Client, url string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Post(url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("webhook returned %d: %s", resp.StatusCode, string(body))
+	}
+	return nil
+}
+
+// eventSummary is a one-line plain text description of an event
+func eventSummary(ev Event) string {
+	switch ev.Type {
+	case EventTicketRebuilt:
+		return fmt.Sprintf("%s: all %d operators have been rebuilt", ev.Ticket.ID, len(ev.Statuses))
+	case EventOperatorStale:
+		return fmt.Sprintf("%s: %s has not been updated since %s", ev.Ticket.ID, ev.Operator.Name, localTime(ev.Operator.LastUpdated).Format("2006-01-02"))
+	case EventOperatorUpdated:
+		if ev.Reason != "" {
+			return fmt.Sprintf("%s: %s has a new image (%s): %s", ev.Ticket.ID, ev.Operator.Name, shortDigest(ev.Operator.SHA256), ev.Reason)
+		}
+		return fmt.Sprintf("%s: %s has a new image (%s)", ev.Ticket.ID, ev.Operator.Name, shortDigest(ev.Operator.SHA256))
+	case EventClusterOutdated:
+		return fmt.Sprintf("%s: %s doesn't run the latest image of %s (%s)", ev.Ticket.ID, ev.Cluster.Cluster, ev.Operator.Name, shortDigest(ev.Operator.SHA256))
+	case EventClusterUpdated:
+		return fmt.Sprintf("%s: %s runs the latest image of %s (%s)", ev.Ticket.ID, ev.Cluster.Cluster, ev.Operator.Name, shortDigest(ev.Operator.SHA256))
+	case EventPinUntagged:
+		return fmt.Sprintf("%s: no tag points at the pinned digest of %s (%s) any more, so it may be garbage-collected", ev.Ticket.ID, ev.Pin.Operator, shortDigest(ev.Pin.Digest))
+	case EventPinMissing:
+		return fmt.Sprintf("%s: the pinned digest of %s (%s) is gone from the registry", ev.Ticket.ID, ev.Pin.Operator, shortDigest(ev.Pin.Digest))
+	case EventDigest:
+		return fmt.Sprintf("%s: %d changes", ev.Ticket.ID, len(ev.Events))
+	}
+	return fmt.Sprintf("%s: %s", ev.Ticket.ID, ev.Type)
+}
+
+// eventTitle is a short heading for an event
+func eventTitle(ev Event) string {
+	switch ev.Type {
+	case EventTicketRebuilt:
+		return "Ticket rebuilt"
+	case EventOperatorStale:
+		return "Operator stale"
+	case EventOperatorUpdated:
+		return "Operator updated"
+	case EventClusterOutdated:
+		return "Cluster outdated"
+	case EventClusterUpdated:
+		return "Cluster updated"
+	case EventPinUntagged:
+		return "Pin untagged"
+	case EventPinMissing:
+		return "Pin missing"
+	case EventDigest:
+		return "Ticket digest"
+	}
+	return string(ev.Type)
+}
+
+func shortDigest(digest string) string {
+	if len(digest) > 12 {
+		return digest[:12]
+	}
+	return digest
+}
+
+// isRebuilt reports whether the operator has a new image since the ticket
+// was added, other than the one it had when it was renamed
+func isRebuilt(ticket JiraTicket, status OperatorStatus) bool {
+	return status.Status == "OK" && status.LastUpdated.After(ticket.Added) && !ticket.AtBaseline(status.Name, status.SHA256)
+}
+
+// isStale reports whether the operator's latest image is older than the
+// ticket's stale threshold
+func isStale(ticket JiraTicket, status OperatorStatus, now time.Time) bool {
+	_, stale := ticketThresholds(ticket)
+	return status.Status == "OK" && now.Sub(status.LastUpdated) >= stale
+}
+
+// expectedByText describes an operator's expected-by date with the days left
+// until it, or how long it is overdue
+func expectedByText(status OperatorStatus) string {
+	switch {
+	case status.DaysLeft == nil:
+		return status.ExpectedBy
+	case *status.DaysLeft == 0:
+		return status.ExpectedBy + " (today)"
+	case status.Overdue:
+		return fmt.Sprintf("%s (%d days overdue)", status.ExpectedBy, -*status.DaysLeft)
+	}
+	return fmt.Sprintf("%s (%d days left)", status.ExpectedBy, *status.DaysLeft)
+}
+
+// ticketRebuilt reports whether every operator on the ticket has been rebuilt
+func ticketRebuilt(ticket JiraTicket, statuses []OperatorStatus) bool {
+	if len(statuses) == 0 {
+		return false
+	}
+	for _, status := range statuses {
+		if !isRebuilt(ticket, status) {
+			return false
+		}
+	}
+	return true
+}
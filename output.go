@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// outputFormats are the values accepted by -o/--output
+var outputFormats = []string{"table", "wide", "json", "yaml"}
+
+func validOutputFormat(format string) error {
+	for _, f := range outputFormats {
+		if format == f {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid --output %q: use %s", format, strings.Join(outputFormats, ", "))
+}
+
+// printer writes command results in the format chosen with -o
+type printer struct {
+	out    io.Writer
+	format string
+}
+
+// print writes data as JSON or YAML, or calls table for the table and wide formats
+func (p *printer) print(data interface{}, table func(wide bool)) error {
+	switch p.format {
+	case "json":
+		enc := json.NewEncoder(p.out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(data)
+	case "yaml":
+		return writeYAML(p.out, data)
+	default:
+		table(p.format == "wide")
+		return nil
+	}
+}
+
+// writeYAML writes data with the same field names and order as its JSON
+// encoding, which the API types already define
+func writeYAML(out io.Writer, data interface{}) error {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	// JSON is valid YAML; decoding into a node keeps the key order
+	var node yaml.Node
+	if err := yaml.Unmarshal(encoded, &node); err != nil {
+		return err
+	}
+	blockStyle(&node)
+
+	enc := yaml.NewEncoder(out)
+	enc.SetIndent(2)
+	if err := enc.Encode(&node); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// blockStyle switches a node decoded from JSON to the usual YAML layout
+func blockStyle(node *yaml.Node) {
+	node.Style &^= yaml.FlowStyle | yaml.DoubleQuotedStyle
+	for _, child := range node.Content {
+		blockStyle(child)
+	}
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"OpTrack/internal/api"
+	"OpTrack/internal/store"
+)
+
+// OwnersConfig is where the teams owning operators are imported from
+type OwnersConfig struct {
+	File string `yaml:"file"` // YAML owners file, see OwnersFile; imported at startup and on reload
+}
+
+// TeamChannels is where notifications about the operators of a team go,
+// besides the channels every notification goes to
+type TeamChannels struct {
+	Email           string `yaml:"email"` // Needs notifications.smtp
+	SlackWebhookURL string `yaml:"slackWebhookURL"`
+	TeamsWebhookURL string `yaml:"teamsWebhookURL"`
+}
+
+// OwnersFile lists the teams owning operators, as kept next to the
+// operators' code or in a CODEOWNERS-like repository:
+//
+//	teams:
+//	  - team: SRE
+//	    contact: sre@example.com
+//	    operators:
+//	      - app-sre/foo
+//	      - app-sre/bar
+//
+// Importing it sets the team and contact of each operator in the inventory.
+// Operators it doesn't list keep theirs.
+type OwnersFile struct {
+	Teams []TeamOwners `yaml:"teams" json:"teams"`
+}
+
+// TeamOwners is a team of an owners file with the operators it owns
+type TeamOwners struct {
+	Team      string   `yaml:"team" json:"team"`
+	Contact   string   `yaml:"contact" json:"contact,omitempty"` // e.g. an email address or chat channel
+	Operators []string `yaml:"operators" json:"operators"`
+}
+
+// OwnersImport is what importing an owners file changed in the inventory
+type OwnersImport struct {
+	Added   []string `json:"added"`   // Operators new to the inventory
+	Updated []string `json:"updated"` // Operators given another team or contact
+}
+
+// parseOwners reads an owners file, in YAML or JSON, normalizing the names of
+// its operators. An operator can only be owned by one team.
+func parseOwners(data []byte) (OwnersFile, error) {
+	var owners OwnersFile
+	if err := yaml.Unmarshal(data, &owners); err != nil {
+		return owners, err
+	}
+	var problems []string
+	teams := make(map[string]string) // Lower-case operator -> team
+	for i := range owners.Teams {
+		t := &owners.Teams[i]
+		t.Team, t.Contact = strings.TrimSpace(t.Team), strings.TrimSpace(t.Contact)
+		if t.Team == "" {
+			problems = append(problems, fmt.Sprintf("teams[%d].team: required", i))
+		}
+		for j, name := range t.Operators {
+			name = store.NormalizeOperator(name)
+			t.Operators[j] = name
+			key := strings.ToLower(name)
+			switch {
+			case strings.Count(name, "/") != 1 || strings.Contains(name, "@"):
+				problems = append(problems, fmt.Sprintf("teams[%d].operators: %q is not namespace/repository", i, name))
+			case teams[key] != "":
+				problems = append(problems, fmt.Sprintf("teams[%d].operators: %s is already owned by %s", i, name, teams[key]))
+			default:
+				teams[key] = t.Team
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return owners, errors.New(strings.Join(problems, "; "))
+	}
+	return owners, nil
+}
+
+// readOwnersFile reads the owners file at path, returning nil without one
+func readOwnersFile(path string) (*OwnersFile, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	owners, err := parseOwners(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+	return &owners, nil
+}
+
+// importOwnersFile imports the owners file read from path into the
+// inventory, doing nothing without one
+func importOwnersFile(inventory *InventoryStore, path string, owners *OwnersFile) error {
+	if owners == nil {
+		return nil
+	}
+	result, err := inventory.ImportOwners("owners-file", nil, *owners)
+	if err != nil {
+		return fmt.Errorf("failed to import %s: %w", path, err)
+	}
+	if len(result.Added) > 0 || len(result.Updated) > 0 {
+		slog.Info("Imported operator owners", "file", path, "added", len(result.Added), "updated", len(result.Updated))
+	}
+	return nil
+}
+
+// ImportOwners sets the team and contact of the operators of an owners file,
+// adding those the inventory doesn't have yet when they are allowed
+func (s *InventoryStore) ImportOwners(actor string, r *http.Request, owners OwnersFile) (OwnersImport, error) {
+	result := OwnersImport{Added: []string{}, Updated: []string{}}
+	var unknown []string
+	for _, t := range owners.Teams {
+		for _, name := range t.Operators {
+			if _, ok := s.Get(name); !ok {
+				unknown = append(unknown, name)
+			}
+		}
+	}
+	if err := allowedOperators.Load().check(unknown); err != nil {
+		return result, err
+	}
+
+	now := s.clock.Now()
+	s.mu.Lock()
+	old := make(map[string]InventoryEntry, len(s.entries))
+	for key, entry := range s.entries {
+		old[key] = entry
+	}
+	for _, t := range owners.Teams {
+		for _, name := range t.Operators {
+			key := strings.ToLower(name)
+			entry, ok := s.entries[key]
+			switch {
+			case !ok:
+				entry = InventoryEntry{Name: name, FirstSeen: now}
+				result.Added = append(result.Added, name)
+			case entry.Team == t.Team && entry.Contact == t.Contact:
+				continue
+			default:
+				result.Updated = append(result.Updated, entry.Name)
+			}
+			entry.Team, entry.Contact = t.Team, t.Contact
+			entry.Updated, entry.UpdatedBy = &now, actor
+			s.entries[key] = entry
+		}
+	}
+	if len(result.Added) == 0 && len(result.Updated) == 0 {
+		s.mu.Unlock()
+		return result, nil
+	}
+	if err := s.save(); err != nil {
+		s.entries = old
+		s.mu.Unlock()
+		return result, err
+	}
+	s.mu.Unlock()
+
+	sort.Strings(result.Added)
+	sort.Strings(result.Updated)
+	s.audit.RecordAs(actor, r, "inventory.import_owners", "", map[string]interface{}{"teams": len(owners.Teams), "added": result.Added, "updated": result.Updated})
+	if s.onChange != nil {
+		s.onChange()
+	}
+	return result, nil
+}
+
+// handleImportOwners imports an owners file, in YAML or JSON, at
+// POST /api/v1/inventory/owners. It is served behind requireAdminToken.
+func (s *InventoryStore) handleImportOwners(w http.ResponseWriter, r *http.Request) {
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 1<<20))
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	owners, err := parseOwners(data)
+	if err != nil {
+		httpError(w, r, "Invalid owners file: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	result, err := s.ImportOwners(requestActor(r), r, owners)
+	if err != nil {
+		api.WriteError(w, requestID(r), err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// OwnersNotifier sends events to the channels of the teams that own their
+// operators in the inventory
+type OwnersNotifier struct {
+	teams     map[string]TeamChannels // By lower-case team name
+	inventory *InventoryStore
+	email     *EmailNotifier // nil when SMTP is not configured
+	client    *http.Client
+}
+
+func NewOwnersNotifier(teams map[string]TeamChannels, inventory *InventoryStore, email *EmailNotifier) *OwnersNotifier {
+	byName := make(map[string]TeamChannels, len(teams))
+	for name, channels := range teams {
+		byName[strings.ToLower(name)] = channels
+	}
+	return &OwnersNotifier{
+		teams:     byName,
+		inventory: inventory,
+		email:     email,
+		client:    &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (n *OwnersNotifier) Name() string {
+	return "owners"
+}
+
+func (n *OwnersNotifier) Notify(ev Event) error {
+	var firstErr error
+	for _, team := range n.eventTeams(ev) {
+		channels, ok := n.teams[strings.ToLower(team)]
+		if !ok {
+			continue
+		}
+		var errs []error
+		if channels.Email != "" && n.email != nil {
+			errs = append(errs, n.email.SendTo(channels.Email, ev))
+		}
+		if channels.SlackWebhookURL != "" {
+			errs = append(errs, postJSON(n.client, channels.SlackWebhookURL, slackMessage(ev)))
+		}
+		if channels.TeamsWebhookURL != "" {
+			errs = append(errs, postJSON(n.client, channels.TeamsWebhookURL, teamsMessage(ev)))
+		}
+		if err := errors.Join(errs...); err != nil {
+			slog.Error("Failed to notify team", "team", team, "error", err)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
+
+// eventTeams returns the teams owning the operators an event is about, sorted
+func (n *OwnersNotifier) eventTeams(ev Event) []string {
+	seen := make(map[string]bool)
+	var teams []string
+	for _, name := range eventOperators(ev) {
+		entry, ok := n.inventory.Get(name)
+		if !ok || entry.Team == "" || seen[strings.ToLower(entry.Team)] {
+			continue
+		}
+		seen[strings.ToLower(entry.Team)] = true
+		teams = append(teams, entry.Team)
+	}
+	sort.Strings(teams)
+	return teams
+}
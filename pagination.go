@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// listPage is a window onto a long list: Limit entries after the first Offset
+type listPage struct {
+	Limit  int
+	Offset int
+}
+
+// parsePage reads the limit and offset query parameters, with limit
+// defaulting to def and at most maxLimit, so no request can ask for
+// everything. Only a def of 0, for downloads that have to be complete, gives
+// every entry, by default or with limit=0.
+func parsePage(r *http.Request, def, maxLimit int) (listPage, error) {
+	query := r.URL.Query()
+	page := listPage{Limit: def}
+	if value := query.Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || (n < 1 && !(n == 0 && def == 0)) || n > maxLimit {
+			return page, fmt.Errorf("invalid limit %q: must be between 1 and %d", value, maxLimit)
+		}
+		page.Limit = n
+	}
+	if value := query.Get("offset"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return page, fmt.Errorf("invalid offset %q", value)
+		}
+		page.Offset = n
+	}
+	return page, nil
+}
+
+// pageOf returns the entries of items in page
+func pageOf[T any](items []T, page listPage) []T {
+	start := min(page.Offset, len(items))
+	end := min(start+page.Limit, len(items))
+	return items[start:end]
+}
+
+// next returns the query parameters of the page after this one, or nil when
+// there are no more entries than total or the page has all of them
+func (p listPage) next(r *http.Request, total int) url.Values {
+	if p.Limit == 0 || p.Offset+p.Limit >= total {
+		return nil
+	}
+	query := r.URL.Query()
+	query.Set("limit", strconv.Itoa(p.Limit))
+	query.Set("offset", strconv.Itoa(p.Offset+p.Limit))
+	return query
+}
+
+// setPageHeaders gives the number of entries in all as X-Total-Count and,
+// when more follow this page, links to the next page. The link is relative to
+// the request so it works behind a base path.
+func setPageHeaders(w http.ResponseWriter, r *http.Request, page listPage, total int) {
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	if next := page.next(r, total); next != nil {
+		w.Header().Set("Link", fmt.Sprintf(`<?%s>; rel="next"`, next.Encode()))
+	}
+}
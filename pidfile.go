@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"OpTrack/internal/store"
+)
+
+// writePIDFile records the process ID at path, refusing to start when the file
+// names another process that is still running
+func writePIDFile(path string) error {
+	if data, err := os.ReadFile(path); err == nil {
+		if pid, err := strconv.Atoi(strings.TrimSpace(string(data))); err == nil && pid != os.Getpid() && processRunning(pid) {
+			return fmt.Errorf("already running with PID %d according to %s", pid, path)
+		}
+	}
+	if err := store.WriteFileAtomic(path, []byte(strconv.Itoa(os.Getpid())+"\n"), 0644); err != nil {
+		return fmt.Errorf("failed to write PID file: %v", err)
+	}
+	return nil
+}
+
+// removePIDFile deletes the PID file if it still names this process
+func removePIDFile(path string) {
+	data, err := os.ReadFile(path)
+	if err != nil || strings.TrimSpace(string(data)) != strconv.Itoa(os.Getpid()) {
+		return
+	}
+	os.Remove(path)
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"OpTrack/internal/clock"
+	"OpTrack/internal/registry"
+)
+
+// PinCheck is whether the digest an operator is pinned to is still in the registry
+type PinCheck = registry.Pin
+
+// pinWatcher audits the pinned digests of every ticket after each poll
+// cycle, turning pins that lose their tags or disappear into events
+type pinWatcher struct {
+	quay   *QuayClient
+	bus    *EventBus
+	clock  clock.Clock
+	states map[string]map[string]string // ticket ID -> operator + "@" + digest -> state
+}
+
+func newPinWatcher(quay *QuayClient, bus *EventBus, clk clock.Clock) *pinWatcher {
+	return &pinWatcher{quay: quay, bus: bus, clock: clk, states: make(map[string]map[string]string)}
+}
+
+// checkCycle checks the pins of every ticket the poll cycle checked.
+// pin_untagged fires when every tag has moved away from a pinned digest, and
+// pin_missing when the image is gone. Failed checks keep the last known state.
+func (w *pinWatcher) checkCycle(cycle PollCycle) {
+	seen := make(map[string]bool)
+	for _, check := range cycle.Tickets {
+		seen[check.Ticket.ID] = true
+		if len(check.Ticket.Pins) == 0 {
+			delete(w.states, check.Ticket.ID)
+			continue
+		}
+
+		prev := w.states[check.Ticket.ID]
+		states := make(map[string]string)
+		for _, pin := range w.quay.CheckPins(check.Ticket.OperatorNames(), check.Ticket.Pins) {
+			key := pin.Operator + "@" + pin.Digest
+			was := prev[key]
+			if pin.Error != "" {
+				slog.Warn("Failed to check pinned digest", "ticket", check.Ticket.ID, "operator", pin.Operator, "digest", pin.Digest, "error", pin.Error)
+				if was != "" {
+					states[key] = was
+				}
+				continue
+			}
+			states[key] = pin.State
+
+			var typ EventType
+			switch {
+			case pin.State == registry.Untagged && was != registry.Untagged:
+				slog.Warn("Every tag has moved away from a pinned digest", "ticket", check.Ticket.ID, "operator", pin.Operator, "digest", pin.Digest, "latest", pin.Latest)
+				typ = EventPinUntagged
+			case pin.State == registry.Missing && was != registry.Missing:
+				slog.Warn("Pinned digest is gone from the registry", "ticket", check.Ticket.ID, "operator", pin.Operator, "digest", pin.Digest, "latest", pin.Latest)
+				typ = EventPinMissing
+			default:
+				continue
+			}
+			var operator *OperatorStatus
+			for i := range check.Statuses {
+				if check.Statuses[i].Name == pin.Operator {
+					operator = &check.Statuses[i]
+				}
+			}
+			w.bus.PublishEvent(Event{
+				Type:     typ,
+				Ticket:   check.Ticket,
+				Operator: operator,
+				Pin:      &pin,
+				Statuses: check.Statuses,
+				Time:     w.clock.Now(),
+			})
+		}
+		w.states[check.Ticket.ID] = states
+	}
+
+	// Forget deleted tickets
+	for id := range w.states {
+		if !seen[id] {
+			delete(w.states, id)
+		}
+	}
+}
+
+func newPinsCommand(opts *cliOptions) *cobra.Command {
+	return &cobra.Command{
+		Use:   "pins <ticket>",
+		Short: "Check that the digests the operators on a ticket are pinned to are still in the registry",
+		Long: `Check that the digests the operators on a ticket are pinned to, saved as
+namespace/repository@sha256:<digest>, are still in the registry, and exit with
+status 1 if any is gone or no tag points at it any more.
+
+A pin is "tagged" while tags point at its digest, "untagged" once every tag
+has moved away, when Quay.io may garbage-collect it, and "missing" once the
+image is gone.`,
+		Example:           "  optrack pins OSD-1234",
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeFirstTicket(opts),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			backend, err := opts.backend()
+			if err != nil {
+				return err
+			}
+			pins, err := backend.TicketPins(args[0])
+			if err != nil {
+				return fmt.Errorf("failed to check the pins of %s: %v", args[0], err)
+			}
+			if err := opts.printer(cmd).print(pins, func(wide bool) {
+				printPins(cmd.OutOrStdout(), pins, wide)
+			}); err != nil {
+				return err
+			}
+			failed := 0
+			for _, p := range pins {
+				if p.State != registry.Tagged {
+					failed++
+				}
+			}
+			if failed > 0 {
+				return fmt.Errorf("%d of %d pinned digests aren't tagged", failed, len(pins))
+			}
+			return nil
+		},
+	}
+}
+
+// printPins prints one row per pinned operator, with full digests when wide is set
+func printPins(out io.Writer, pins []PinCheck, wide bool) {
+	short := shortDigest
+	if wide {
+		short = func(digest string) string { return digest }
+	}
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "OPERATOR\tPINNED\tSTATE\tTAGS\tLATEST")
+	for _, p := range pins {
+		state := p.State
+		if p.Error != "" {
+			state = "error (" + p.Error + ")"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", p.Operator, short(p.Digest), state, strings.Join(p.Tags, ","), short(p.Latest))
+	}
+	tw.Flush()
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"OpTrack/internal/ci"
+	"OpTrack/internal/clock"
+	"OpTrack/internal/kube"
+)
+
+// OperatorPipeline is the state of the pipeline that builds an operator
+type OperatorPipeline = ci.Result
+
+// CIConfig is the build pipelines of operators, whose last runs explain why
+// an image hasn't been rebuilt
+type CIConfig struct {
+	Jenkins   JenkinsConfig    `yaml:"jenkins"`
+	Pipelines []PipelineConfig `yaml:"pipelines"`
+}
+
+// JenkinsConfig is how Jenkins jobs are read
+type JenkinsConfig struct {
+	User    string   `yaml:"user"`
+	Token   string   `yaml:"token"` // An API token of user
+	Timeout Duration `yaml:"timeout"`
+}
+
+// PipelineConfig is the pipeline that builds an operator: a Jenkins job or
+// Tekton PipelineRuns
+type PipelineConfig struct {
+	Operator string          `yaml:"operator"`
+	Jenkins  string          `yaml:"jenkins"` // The job URL, e.g. https://ci.example.com/job/foo-build-master/
+	Tekton   *TektonPipeline `yaml:"tekton"`
+}
+
+// TektonPipeline is the PipelineRuns of an operator's build. The cluster is
+// reached like the controller's: through the service account in a pod, or
+// a kubeconfig context.
+type TektonPipeline struct {
+	Namespace  string `yaml:"namespace"`
+	Selector   string `yaml:"selector"` // e.g. tekton.dev/pipeline=foo-build
+	Kubeconfig string `yaml:"kubeconfig"`
+	Context    string `yaml:"context"`
+}
+
+// kubeConfig returns how to reach the cluster the PipelineRuns are on
+func (t TektonPipeline) kubeConfig() (*kube.Config, error) {
+	if t.Kubeconfig == "" && t.Context == "" && kube.InCluster() {
+		return kube.InClusterConfig()
+	}
+	path := t.Kubeconfig
+	if path == "" {
+		path = kube.DefaultKubeconfig()
+	}
+	return kube.LoadKubeconfig(path, t.Context)
+}
+
+// newPipelineMonitor returns nil when no pipelines are configured
+func newPipelineMonitor(cfg CIConfig, clk clock.Clock) (*ci.Monitor, error) {
+	if len(cfg.Pipelines) == 0 {
+		return nil, nil
+	}
+	pipelines := make(map[string]ci.Pipeline)
+	for _, p := range cfg.Pipelines {
+		if p.Jenkins != "" {
+			pipelines[p.Operator] = ci.NewJenkins(p.Jenkins, cfg.Jenkins.User, cfg.Jenkins.Token, time.Duration(cfg.Jenkins.Timeout))
+			continue
+		}
+		kc, err := p.Tekton.kubeConfig()
+		if err != nil {
+			return nil, fmt.Errorf("pipeline of %s: %v", p.Operator, err)
+		}
+		pipelines[p.Operator] = ci.NewTekton(kube.NewClient(kc), p.Tekton.Namespace, p.Tekton.Selector)
+	}
+	return ci.New(pipelines, clk, ci.DefaultTTL), nil
+}
+
+func newPipelinesCommand(opts *cliOptions) *cobra.Command {
+	return &cobra.Command{
+		Use:   "pipelines <ticket>",
+		Short: "Show the last build of every operator on a ticket",
+		Long: `Show the last build of every operator on a ticket.
+
+The recent runs of the Jenkins job or Tekton pipeline that builds each operator
+are read, so an image that hasn't been rebuilt can be explained by a failing
+build, and since when it has been failing. Pipelines are set under
+ci.pipelines: in the config file; operators without one are left out.`,
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeFirstTicket(opts),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			backend, err := opts.backend()
+			if err != nil {
+				return err
+			}
+			results, err := backend.TicketPipelines(args[0])
+			if err != nil {
+				return fmt.Errorf("failed to get the pipelines of %s: %v", args[0], err)
+			}
+			return opts.printer(cmd).print(results, func(wide bool) {
+				printPipelines(cmd.OutOrStdout(), results, wide)
+			})
+		},
+	}
+}
+
+// printPipelines prints one row per operator, with the pipeline and run URLs when wide is set
+func printPipelines(out io.Writer, results []OperatorPipeline, wide bool) {
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	header := "OPERATOR\tSYSTEM\tSTATE\tLAST RUN\tRESULT\tFAILING SINCE"
+	if wide {
+		header += "\tPIPELINE\tURL"
+	}
+	fmt.Fprintln(tw, header)
+	for _, r := range results {
+		var run, result, url, since string
+		if r.Last != nil {
+			run, result, url = r.Last.Name, r.Last.Result, r.Last.URL
+		}
+		if r.FailingSince != nil {
+			since = r.FailingSince.Local().Format("2006-01-02 15:04")
+		}
+		if r.Error != "" {
+			result = strings.TrimSpace(result + " (" + r.Error + ")")
+		}
+		row := fmt.Sprintf("%s\t%s\t%s\t%s\t%s\t%s", r.Operator, r.System, r.State, run, result, since)
+		if wide {
+			row += "\t" + r.Pipeline + "\t" + url
+		}
+		fmt.Fprintln(tw, row)
+	}
+	tw.Flush()
+}
+
+// printBuildNotes explains, below a status table, which operators have a
+// failing build
+func printBuildNotes(out io.Writer, results []OperatorPipeline, now time.Time) {
+	for _, r := range results {
+		if r.FailingSince == nil {
+			continue
+		}
+		note := fmt.Sprintf("%s: build failing since %s (%s)", r.Operator, r.FailingSince.Local().Format("Mon 2 Jan 15:04"), timeAgo(now, *r.FailingSince))
+		if r.State == ci.StateRunning {
+			note += ", a new run is in progress"
+		}
+		if r.Last != nil && r.Last.URL != "" {
+			note += " " + r.Last.URL
+		}
+		fmt.Fprintln(out, note)
+	}
+}
+
+// timeAgo is a rough duration for humans, e.g. "3d ago"
+func timeAgo(now, t time.Time) string {
+	d := now.Sub(t)
+	switch {
+	case d >= 48*time.Hour:
+		return fmt.Sprintf("%dd ago", int(d.Hours()/24))
+	case d >= time.Hour:
+		return fmt.Sprintf("%dh ago", int(d.Hours()))
+	default:
+		return fmt.Sprintf("%dm ago", int(d.Minutes()))
+	}
+}
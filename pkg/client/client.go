@@ -0,0 +1,1479 @@
+// Package client is a Go client for the OpTrack HTTP API.
+//
+//	c := client.New("https://optrack.example.com")
+//	ticket, err := c.CreateTicket(ctx, client.Ticket{ID: "OSD-1234", Operators: client.OperatorsNamed("app-sre/foo")})
+//	statuses, err := c.GetStatus(ctx, "OSD-1234")
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Ticket is a JIRA ticket and the operators being rebuilt for it
+type Ticket struct {
+	ID        string     `json:"id"`
+	Operators []Operator `json:"operators"`
+	Added     time.Time  `json:"added"`           // Set by the server; operators updated after this count as rebuilt
+	Owner     string     `json:"owner,omitempty"` // Email address notified about this ticket
+	// Project is the project the ticket belongs to, empty for tickets shared
+	// by everyone. Replacing a ticket without one keeps its project.
+	Project string `json:"project,omitempty"`
+	// Description says what the ticket is about
+	Description string `json:"description,omitempty"`
+	// Labels group tickets, e.g. "monthly"; they can't have spaces or commas
+	Labels []string `json:"labels,omitempty"`
+	// Groups are the operator groups whose members the ticket tracks, as
+	// well as its own Operators
+	Groups []string `json:"groups,omitempty"`
+	// Applications are the ArgoCD applications that deploy the operators, as
+	// name or namespace/name
+	Applications []string `json:"applications,omitempty"`
+	// CVEs are the CVE IDs the ticket is about, such as CVE-2024-3094
+	CVEs []string `json:"cves,omitempty"`
+	// Pins are the digests operators are pinned to, operator -> sha256 hex.
+	// Operators saved as namespace/repository@sha256:<digest> are pinned.
+	Pins map[string]string `json:"pins,omitempty"`
+	// Baselines are the digests operators had when they were renamed,
+	// operator -> sha256 hex; images with them don't count as rebuilt. Set
+	// by the server, see RenameOperator.
+	Baselines map[string]string `json:"baselines,omitempty"`
+	// Thresholds override the server's warning and stale ages for the
+	// ticket's operators
+	Thresholds *Thresholds `json:"thresholds,omitempty"`
+	// Updated is when the ticket last changed, set by the server
+	Updated *time.Time `json:"updated,omitempty"`
+	// Archived is when the ticket was archived, see ArchiveTicket
+	Archived *time.Time `json:"archived,omitempty"`
+	// Rollup is the state of the ticket as a whole as of the server's last
+	// check of it: complete, in-progress, blocked or error; empty until it
+	// was checked. Set by the server.
+	Rollup string `json:"rollup,omitempty"`
+	// Normalized is set in the answer to saving a ticket when operators were
+	// merged into others or look alike; it isn't stored
+	Normalized *OperatorReport `json:"normalized,omitempty"`
+}
+
+// OperatorReport is what the server did to the operators of a saved ticket
+type OperatorReport struct {
+	// Merged are entries that named an operator already on the ticket, once
+	// trimmed, stripped of a URL scheme or quay.io and compared regardless of case
+	Merged []MergedOperator `json:"merged,omitempty"`
+	// Similar are pairs of operators whose names are a typo or two apart
+	Similar [][2]string `json:"similar,omitempty"`
+}
+
+// MergedOperator is an entry that was merged into an earlier one
+type MergedOperator struct {
+	Entry    string `json:"entry"`
+	Operator string `json:"operator"`
+}
+
+// Thresholds are ages such as "7d" or "36h". Empty ones fall back to the
+// server's thresholds.
+type Thresholds struct {
+	Warning string `json:"warning,omitempty"`
+	Stale   string `json:"stale,omitempty"`
+}
+
+// Operator is an operator on a ticket, as namespace/repository and optionally
+// namespace/repository@sha256:<digest>, with optional details. It is sent as
+// its name alone when it has no details, which servers that predate details
+// also accept.
+type Operator struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName,omitempty"`
+	Owner       string `json:"owner,omitempty"`       // Who to ask about the operator's rebuild
+	Note        string `json:"note,omitempty"`        // e.g. "waits on konflux migration"
+	ExpectedBy  string `json:"expectedBy,omitempty"`  // Day a fixed build is expected, as YYYY-MM-DD
+	Group       string `json:"group,omitempty"`       // Set by the server on operators the ticket has through a group; ignored when saving
+	Criticality string `json:"criticality,omitempty"` // Set by the server from the operator inventory; ignored when saving
+	Team        string `json:"team,omitempty"`        // Set by the server from the operator inventory; ignored when saving
+	Contact     string `json:"contact,omitempty"`     // Set by the server from the operator inventory; ignored when saving
+}
+
+type operatorFields Operator
+
+func (o Operator) MarshalJSON() ([]byte, error) {
+	if o.DisplayName == "" && o.Owner == "" && o.Note == "" && o.ExpectedBy == "" && o.Group == "" {
+		return json.Marshal(o.Name)
+	}
+	return json.Marshal(operatorFields(o))
+}
+
+func (o *Operator) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		*o = Operator{}
+		return json.Unmarshal(data, &o.Name)
+	}
+	var fields operatorFields
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	*o = Operator(fields)
+	return nil
+}
+
+// OperatorsNamed returns operators with the names and no details
+func OperatorsNamed(names ...string) []Operator {
+	operators := make([]Operator, len(names))
+	for i, name := range names {
+		operators[i] = Operator{Name: name}
+	}
+	return operators
+}
+
+// OperatorStatus is the latest image of an operator on Quay.io. Status is
+// "OK" when it was found, and otherwise says what went wrong.
+type OperatorStatus struct {
+	Name        string      `json:"name"`
+	LastUpdated time.Time   `json:"lastUpdated"`
+	SHA256      string      `json:"sha256"`
+	Status      string      `json:"status"`
+	Tags        []string    `json:"tags,omitempty"`       // The tags of the latest image, when the server knows them
+	Build       *Build      `json:"build,omitempty"`      // The build that produced the latest image, when the server found it
+	Signature   *Signature  `json:"signature,omitempty"`  // Whether the latest image is signed, when the server verifies signatures
+	Scan        *Scan       `json:"scan,omitempty"`       // The vulnerabilities of the latest image, once the server has scanned it
+	Provenance  *Provenance `json:"provenance,omitempty"` // How the latest image was built, when the server verifies provenance
+	BaseImage   *BaseImage  `json:"baseImage,omitempty"`  // What the latest image is built on, when the server checks base images
+	// The details of the operator's entry on the ticket, in a ticket's statuses
+	DisplayName string `json:"displayName,omitempty"`
+	Owner       string `json:"owner,omitempty"`
+	Note        string `json:"note,omitempty"`
+	Criticality string `json:"criticality,omitempty"` // critical, normal or low, from the operator inventory
+	Team        string `json:"team,omitempty"`        // Owning team, from the operator inventory
+	Contact     string `json:"contact,omitempty"`     // How to reach the team, from the operator inventory
+	// ExpectedBy is the day a fixed build is expected, as YYYY-MM-DD. Until
+	// the operator is rebuilt, DaysLeft counts down to it and goes negative
+	// once Overdue.
+	ExpectedBy string `json:"expectedBy,omitempty"`
+	DaysLeft   *int   `json:"daysLeft,omitempty"`
+	Overdue    bool   `json:"overdue,omitempty"`
+}
+
+// BaseImage is the base an image was built on. State is "current",
+// "outdated" when a newer image of the base has been published, or "unknown".
+type BaseImage struct {
+	State  string `json:"state"`
+	Name   string `json:"name,omitempty"`   // e.g. registry.access.redhat.com/ubi9/ubi-minimal:latest
+	Tag    string `json:"tag,omitempty"`    // The tag of the older base the image is built on, when known
+	Digest string `json:"digest,omitempty"` // The base image it is built on, when known
+	Latest string `json:"latest,omitempty"` // The newest image of the base
+}
+
+// Provenance is the verdict on the SLSA provenance attested for an image.
+// State is "verified", "missing" or "invalid".
+type Provenance struct {
+	State         string `json:"state"`
+	PredicateType string `json:"predicateType,omitempty"`
+	Builder       string `json:"builder,omitempty"`  // The builder ID
+	Source        string `json:"source,omitempty"`   // The repository the image was built from
+	Revision      string `json:"revision,omitempty"` // The commit it was built from
+	Signer        string `json:"signer,omitempty"`   // The key or identity the provenance was signed by
+	Error         string `json:"error,omitempty"`    // Why the provenance found doesn't count
+}
+
+// Scan is the result of a vulnerability scan of an image
+type Scan struct {
+	Scanner   string         `json:"scanner"`
+	Completed time.Time      `json:"completed"`
+	Counts    map[string]int `json:"counts"`             // By severity: "critical", "high", "medium", "low" and "unknown"
+	Findings  []Finding      `json:"findings,omitempty"` // The most severe vulnerabilities
+}
+
+// Finding is a vulnerability of a package in an image
+type Finding struct {
+	ID           string `json:"id"`
+	Severity     string `json:"severity"`
+	Package      string `json:"package"`
+	Version      string `json:"version"`
+	FixedVersion string `json:"fixedVersion,omitempty"`
+	Title        string `json:"title,omitempty"`
+	URL          string `json:"url,omitempty"`
+}
+
+// Signature is the verdict on the signatures of an image. State is
+// "signed", "unsigned" or "invalid".
+type Signature struct {
+	State  string `json:"state"`
+	Signer string `json:"signer,omitempty"` // The key or identity it was signed by
+	Error  string `json:"error,omitempty"`  // Why the signatures found don't count
+}
+
+// Build is a build system's record of the build that produced an image
+type Build struct {
+	System    string     `json:"system"` // e.g. "konflux" or "osbs"
+	ID        string     `json:"id"`
+	NVR       string     `json:"nvr,omitempty"`
+	Component string     `json:"component,omitempty"`
+	Pipeline  string     `json:"pipeline,omitempty"`
+	Completed *time.Time `json:"completed,omitempty"`
+	URL       string     `json:"url,omitempty"`
+}
+
+// Drift is whether a cluster runs the latest image of an operator. State is
+// "current", "outdated", "not_deployed" or "unknown".
+type Drift struct {
+	Cluster  string            `json:"cluster"`
+	Labels   map[string]string `json:"labels,omitempty"` // The cluster's labels
+	Operator string            `json:"operator"`
+	State    string            `json:"state"`
+	Latest   string            `json:"latest,omitempty"` // sha256 of the latest image
+	Running  []DriftWorkload   `json:"running,omitempty"`
+	// Installed are the OLM installations whose CSV uses the operator's image
+	Installed []DriftInstallation `json:"installed,omitempty"`
+	Error     string              `json:"error,omitempty"`
+}
+
+// DriftInstallation is an operator installed by OLM, with the Subscription
+// that installed it if any
+type DriftInstallation struct {
+	Namespace    string `json:"namespace"`
+	CSV          string `json:"csv"`
+	Version      string `json:"version,omitempty"`
+	Phase        string `json:"phase,omitempty"`
+	Subscription string `json:"subscription,omitempty"`
+	Package      string `json:"package,omitempty"`
+	Channel      string `json:"channel,omitempty"`
+	Source       string `json:"source,omitempty"`
+	State        string `json:"state,omitempty"`
+	CurrentCSV   string `json:"currentCSV,omitempty"` // Set while an upgrade to another CSV is pending
+}
+
+// DriftWorkload is a Deployment or ClusterServiceVersion container using an
+// operator's image
+type DriftWorkload struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Container string `json:"container"`
+	Image     string `json:"image"`
+	Digest    string `json:"digest,omitempty"` // Empty when the cluster doesn't say which digest runs
+}
+
+// Discovery is the operators running in the namespaces of the server's
+// clusters, ready to be put on a ticket
+type Discovery struct {
+	Operators []string             `json:"operators"` // Sorted
+	Workloads []DiscoveredWorkload `json:"workloads"`
+	Errors    map[string]string    `json:"errors,omitempty"` // By cluster, for clusters that couldn't be read
+}
+
+// DiscoveredWorkload is a Deployment or ClusterServiceVersion container
+// running an image of an operator
+type DiscoveredWorkload struct {
+	Operator  string `json:"operator"`
+	Cluster   string `json:"cluster"`
+	Namespace string `json:"namespace"`
+	Kind      string `json:"kind"`
+	Name      string `json:"name"`
+	Container string `json:"container"`
+	Image     string `json:"image"`
+}
+
+// Catalog is whether an OLM catalog publishes the latest image of an
+// operator. State is "current", "behind", "not_published" or "unknown".
+type Catalog struct {
+	Catalog   string   `json:"catalog"`
+	Operator  string   `json:"operator"`
+	State     string   `json:"state"`
+	Latest    string   `json:"latest,omitempty"`  // sha256 of the latest image
+	Package   string   `json:"package,omitempty"` // The newest bundle using the operator
+	Bundle    string   `json:"bundle,omitempty"`
+	Version   string   `json:"version,omitempty"`
+	Channels  []string `json:"channels,omitempty"`
+	Image     string   `json:"image,omitempty"`  // The operator's image as the bundle references it
+	Digest    string   `json:"digest,omitempty"` // Empty when the bundle references a tag
+	Published int      `json:"published,omitempty"`
+	Error     string   `json:"error,omitempty"`
+}
+
+// Application is an ArgoCD application linked to a ticket: its sync and
+// health, and the state of each operator in it
+type Application struct {
+	Application  string                `json:"application"`
+	Project      string                `json:"project,omitempty"`
+	Destination  string                `json:"destination,omitempty"`
+	Sync         string                `json:"sync,omitempty"`   // Synced, OutOfSync or Unknown
+	Health       string                `json:"health,omitempty"` // e.g. Healthy, Progressing or Degraded
+	Revision     string                `json:"revision,omitempty"`
+	LastDeployed *time.Time            `json:"lastDeployed,omitempty"`
+	Images       []string              `json:"images,omitempty"`
+	Operators    []ApplicationOperator `json:"operators"`
+	Error        string                `json:"error,omitempty"`
+}
+
+// ApplicationOperator is whether an application deploys the latest image of
+// an operator. State is "current", "outdated", "not_deployed" or "unknown".
+type ApplicationOperator struct {
+	Operator string `json:"operator"`
+	State    string `json:"state"`
+	Latest   string `json:"latest,omitempty"`
+	Image    string `json:"image,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Promotion is whether an app-interface SaaS file target has been promoted
+// to the latest image of an operator. State is "promoted", "not_promoted",
+// "follows_branch", "not_deployed" or "unknown".
+type Promotion struct {
+	Source           string   `json:"source"`
+	SaasFile         string   `json:"saasFile,omitempty"`
+	ResourceTemplate string   `json:"resourceTemplate,omitempty"`
+	Target           string   `json:"target,omitempty"`
+	Operator         string   `json:"operator"`
+	State            string   `json:"state"`
+	Ref              string   `json:"ref,omitempty"` // The target's git ref
+	Tag              string   `json:"tag,omitempty"` // The image tag the ref deploys
+	Latest           string   `json:"latest,omitempty"`
+	LatestTags       []string `json:"latestTags,omitempty"`
+	Error            string   `json:"error,omitempty"`
+}
+
+// Pipeline is the state of the pipeline that builds an operator. State is
+// "passing", "failing", "running" or "unknown".
+type Pipeline struct {
+	Operator     string       `json:"operator"`
+	System       string       `json:"system"` // "jenkins" or "tekton"
+	Pipeline     string       `json:"pipeline"`
+	State        string       `json:"state"`
+	Last         *PipelineRun `json:"last,omitempty"`
+	FailingSince *time.Time   `json:"failingSince,omitempty"` // When the current run of failures began
+	Error        string       `json:"error,omitempty"`
+}
+
+// PipelineRun is one run of a build pipeline
+type PipelineRun struct {
+	Name     string     `json:"name"`
+	State    string     `json:"state"`
+	Result   string     `json:"result,omitempty"`
+	Started  *time.Time `json:"started,omitempty"`
+	Finished *time.Time `json:"finished,omitempty"`
+	URL      string     `json:"url,omitempty"`
+}
+
+// Commits is the latest image of an operator compared with its source
+// repository. State is "current", "behind", "diverged" or "unknown".
+type Commits struct {
+	Operator       string     `json:"operator"`
+	Repository     string     `json:"repository"`
+	State          string     `json:"state"`
+	Latest         string     `json:"latest,omitempty"`
+	Commit         string     `json:"commit,omitempty"`     // The commit the image was built from
+	CommitFrom     string     `json:"commitFrom,omitempty"` // The image label, or "tag", it was read from
+	Branch         string     `json:"branch,omitempty"`
+	Head           string     `json:"head,omitempty"`
+	Behind         int        `json:"behind"` // Commits on the branch the image doesn't have
+	Release        string     `json:"release,omitempty"`
+	BehindRelease  int        `json:"behindRelease,omitempty"`
+	AheadOfRelease int        `json:"aheadOfRelease,omitempty"`
+	Released       *time.Time `json:"released,omitempty"`
+	Error          string     `json:"error,omitempty"`
+}
+
+// Compliance is whether an operator complies with the server's policy
+type Compliance struct {
+	Operator   string      `json:"operator"`
+	Compliant  bool        `json:"compliant"`
+	Latest     string      `json:"latest,omitempty"`
+	BaseImage  string      `json:"baseImage,omitempty"` // When the image labels name it
+	Rules      []string    `json:"rules"`               // The rules that apply
+	Violations []Violation `json:"violations,omitempty"`
+}
+
+// Violation is a requirement of a policy rule an operator doesn't meet.
+// Check is "status", "maxAge", "signature", "provenance", "registry",
+// "baseImage" or "vulnerabilities".
+type Violation struct {
+	Rule   string `json:"rule"`
+	Check  string `json:"check"`
+	Reason string `json:"reason"`
+}
+
+// CVEFix is whether the latest image of an operator still has the CVEs of
+// its ticket, according to the server's vulnerability scan of it
+type CVEFix struct {
+	Operator string      `json:"operator"`
+	Latest   string      `json:"latest,omitempty"`
+	Scanned  *time.Time  `json:"scanned,omitempty"` // Unset until the latest image is scanned
+	Fixed    bool        `json:"fixed"`             // Every CVE is fixed
+	CVEs     []CVEStatus `json:"cves"`
+	Error    string      `json:"error,omitempty"` // Why the latest image couldn't be determined
+}
+
+// StatusTable is the status table of a ticket as the ticket page and the CSV
+// export show it: Columns are the column keys and Titles their headings
+type StatusTable struct {
+	Columns []string   `json:"columns"`
+	Titles  []string   `json:"titles"`
+	Rows    [][]string `json:"rows"`
+}
+
+// TableOptions selects the order and columns of a StatusTable. Zero values
+// keep the order of the ticket and the default columns.
+type TableOptions struct {
+	Sort    string // Column key, such as "age"
+	Desc    bool
+	Columns []string
+}
+
+// OperatorGroup is a named list of operators that tickets include by
+// reference, in their Groups
+type OperatorGroup struct {
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	Operators   []string  `json:"operators"`
+	Updated     time.Time `json:"updated"`
+	UpdatedBy   string    `json:"updatedBy,omitempty"`
+}
+
+// TicketTemplate is a saved starting point for recurring tickets: the
+// operators, thresholds and notification rules of every ticket created from it
+type TicketTemplate struct {
+	Name          string             `json:"name"`
+	Description   string             `json:"description,omitempty"`
+	Operators     []Operator         `json:"operators,omitempty"`
+	Groups        []string           `json:"groups,omitempty"`
+	Labels        []string           `json:"labels,omitempty"`
+	Owner         string             `json:"owner,omitempty"`
+	Project       string             `json:"project,omitempty"`
+	Applications  []string           `json:"applications,omitempty"`
+	Thresholds    *Thresholds        `json:"thresholds,omitempty"`
+	Notifications []NotificationRule `json:"notifications,omitempty"` // Added for each ticket created from the template
+	Updated       time.Time          `json:"updated"`
+	UpdatedBy     string             `json:"updatedBy,omitempty"`
+}
+
+// NotificationRule routes events to channels, "*" for every enabled channel
+type NotificationRule struct {
+	Events        []string          `json:"events,omitempty"`
+	Tickets       []string          `json:"tickets,omitempty"`
+	ClusterLabels map[string]string `json:"clusterLabels,omitempty"`
+	Channels      []string          `json:"channels"`
+}
+
+// InventoryEntry is an operator the server has tracked at some point, with
+// its details and the tickets tracking it now
+type InventoryEntry struct {
+	Name             string     `json:"name"`
+	Team             string     `json:"team,omitempty"`
+	Contact          string     `json:"contact,omitempty"` // How to reach the team
+	SourceRepository string     `json:"sourceRepository,omitempty"`
+	Criticality      string     `json:"criticality,omitempty"` // critical, normal or low
+	FirstSeen        time.Time  `json:"firstSeen"`
+	FirstTicket      string     `json:"firstTicket,omitempty"`
+	Updated          *time.Time `json:"updated,omitempty"`
+	UpdatedBy        string     `json:"updatedBy,omitempty"`
+	Tickets          []string   `json:"tickets"`
+}
+
+// OwnersFile lists the teams owning operators, for ImportOwners
+type OwnersFile struct {
+	Teams []TeamOwners `json:"teams"`
+}
+
+// TeamOwners is a team with its contact and the operators it owns
+type TeamOwners struct {
+	Team      string   `json:"team"`
+	Contact   string   `json:"contact,omitempty"`
+	Operators []string `json:"operators"`
+}
+
+// OwnersImport is what ImportOwners changed in the inventory
+type OwnersImport struct {
+	Added   []string `json:"added"`   // Operators new to the inventory
+	Updated []string `json:"updated"` // Operators given another team or contact
+}
+
+// OperatorRename is what RenameOperator changed, or would change on a dry run
+type OperatorRename struct {
+	From    string   `json:"from"`
+	To      string   `json:"to"`
+	DryRun  bool     `json:"dryRun,omitempty"`
+	Tickets []string `json:"tickets"` // Tickets tracking the operator, archived ones included
+	Groups  []string `json:"groups"`  // Groups with the operator among their members
+	// Baselines are the digests kept by ticket, for the tickets on which the
+	// operator wasn't rebuilt yet
+	Baselines map[string]string `json:"baselines"`
+	// Unbaselined are tickets without a baseline because the operator's
+	// latest digest couldn't be looked up
+	Unbaselined []string `json:"unbaselined,omitempty"`
+	// Inventory is whether the new name took over the team, contact,
+	// criticality and source repository of the old one
+	Inventory bool `json:"inventory,omitempty"`
+}
+
+// DigestAnnotation is why an image of an operator was built
+type DigestAnnotation struct {
+	Operator string    `json:"operator"`
+	Digest   string    `json:"digest"` // sha256 hex
+	Reason   string    `json:"reason"`
+	Author   string    `json:"author"`
+	Time     time.Time `json:"time"`
+}
+
+// BatchStatus is the statuses of several tickets and operators, by ticket ID
+// and operator as asked for
+type BatchStatus struct {
+	Tickets   map[string]BatchTicket    `json:"tickets"`
+	Operators map[string]OperatorStatus `json:"operators"`
+	Lookups   int                       `json:"lookups"` // Distinct operators looked up
+}
+
+// BatchTicket is the statuses of a ticket in a BatchStatus, or the error
+// looking it up, such as CodeTicketNotFound
+type BatchTicket struct {
+	Statuses []OperatorStatus `json:"statuses"`
+	Error    *Error           `json:"error,omitempty"`
+}
+
+// InventoryFilter narrows down ListInventory. Zero values match every entry.
+type InventoryFilter struct {
+	Team        string
+	Criticality string
+	Unused      bool // Only operators no ticket tracks
+}
+
+// Comment is a note on a ticket
+type Comment struct {
+	ID      string    `json:"id"`
+	Ticket  string    `json:"ticket"`
+	Author  string    `json:"author"`
+	Created time.Time `json:"created"`
+	Body    string    `json:"body"` // Markdown
+	HTML    string    `json:"html"` // Body rendered by the server
+}
+
+// TicketView is a user's default ticket list and status table, applied by
+// the server to their requests that don't give the same parameters
+type TicketView struct {
+	Owner     string   `json:"owner,omitempty"`
+	Labels    []string `json:"labels,omitempty"`
+	Archived  string   `json:"archived,omitempty"` // "true" or "all"
+	Favorites bool     `json:"favorites,omitempty"`
+	Rollups   []string `json:"rollups,omitempty"` // See Ticket.Rollup
+	Sort      string   `json:"sort,omitempty"`
+	Order     string   `json:"order,omitempty"` // "asc" or "desc"
+	Columns   []string `json:"columns,omitempty"`
+}
+
+// Project is a project tickets can belong to, with what the user can do
+// with its tickets
+type Project struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Role        string `json:"role"`    // "viewer" or "editor"
+	Tickets     int    `json:"tickets"` // Tickets in the project, archived or not
+}
+
+// Preferences are what a user has saved for themselves
+type Preferences struct {
+	User      string     `json:"user"`
+	Favorites []string   `json:"favorites"` // Starred ticket IDs
+	View      TicketView `json:"view"`
+	Updated   *time.Time `json:"updated,omitempty"`
+}
+
+// ShareLink lets anyone with its URL see the status page of a ticket until
+// it expires or is revoked
+type ShareLink struct {
+	ID        string     `json:"id"`
+	Ticket    string     `json:"ticket"`
+	Operators []string   `json:"operators,omitempty"` // The operators shown, every operator on the ticket when empty
+	Created   time.Time  `json:"created"`
+	CreatedBy string     `json:"createdBy"`
+	Expires   time.Time  `json:"expires"`
+	Revoked   *time.Time `json:"revoked,omitempty"`
+	URL       string     `json:"url,omitempty"` // Only set for links that still work
+}
+
+// Dashboard summarizes every ticket on the server
+type Dashboard struct {
+	Tickets       []TicketSummary `json:"tickets"`
+	Complete      int             `json:"complete"`            // Tickets with every operator rebuilt
+	CriticalStale int             `json:"criticalStale"`       // Stale critical operators, across the tickets
+	Overdue       int             `json:"overdue"`             // Operators past their expected-by date, across the tickets
+	LastCycle     *time.Time      `json:"lastCycle,omitempty"` // When the server last polled the registry
+	Generated     time.Time       `json:"generated"`
+}
+
+// TicketSummary is how far along a ticket is. Completion is the percentage
+// of its operators rebuilt, weighted by their criticality; Errors counts those
+// that couldn't be looked up.
+type TicketSummary struct {
+	ID            string           `json:"id"`
+	Owner         string           `json:"owner,omitempty"`
+	Description   string           `json:"description,omitempty"`
+	Labels        []string         `json:"labels,omitempty"`
+	Added         time.Time        `json:"added"`
+	Operators     int              `json:"operators"`
+	Rebuilt       int              `json:"rebuilt"`
+	Completion    float64          `json:"completion"`
+	Stale         int              `json:"stale"`
+	Critical      int              `json:"critical"`      // Operators that are critical in the inventory
+	CriticalStale int              `json:"criticalStale"` // Of those, the ones that are stale
+	Overdue       int              `json:"overdue"`       // Operators past their expected-by date
+	Errors        int              `json:"errors"`
+	Stalest       *StalestOperator `json:"stalest,omitempty"`
+	Refreshed     time.Time        `json:"refreshed"`
+}
+
+// StalestOperator is the operator of a ticket whose latest image is the oldest
+type StalestOperator struct {
+	Name        string    `json:"name"`
+	LastUpdated time.Time `json:"lastUpdated"`
+	Age         int       `json:"age"` // Days
+}
+
+// Pin is whether the digest an operator is pinned to is still in the
+// registry. State is "tagged", "untagged" once every tag has moved away from
+// it, or "missing" once the image is gone; it is empty when Error is set.
+type Pin struct {
+	Operator string    `json:"operator"`
+	Digest   string    `json:"digest"`
+	State    string    `json:"state,omitempty"`
+	Tags     []string  `json:"tags,omitempty"`   // The tags pointing at the digest
+	Latest   string    `json:"latest,omitempty"` // The latest image, when it isn't the pinned one
+	Checked  time.Time `json:"checked"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// CVEStatus is whether a CVE is in an image. State is "fixed", "affected"
+// or "unscanned"; the package is set when the scan lists the CVE among the
+// image's most severe vulnerabilities.
+type CVEStatus struct {
+	ID           string `json:"id"`
+	State        string `json:"state"`
+	Package      string `json:"package,omitempty"`
+	Version      string `json:"version,omitempty"`
+	FixedVersion string `json:"fixedVersion,omitempty"`
+}
+
+// Import is the ticket ImportManifests made from manifests, and every image
+// reference it found in them
+type Import struct {
+	Ticket Ticket          `json:"ticket"`
+	Images []ImportedImage `json:"images"`
+}
+
+// ImportedImage is an image reference found by ImportManifests
+type ImportedImage struct {
+	Image    string `json:"image"`
+	Source   string `json:"source"` // Kind/name of the object it was found in
+	Line     int    `json:"line"`
+	Operator string `json:"operator,omitempty"` // namespace/repository, when it is tracked
+	Skipped  string `json:"skipped,omitempty"`  // Why it isn't tracked
+}
+
+// ImportOptions are the optional parameters of ImportManifests
+type ImportOptions struct {
+	Registries []string // Registries whose images are tracked; the server defaults to quay.io
+	Owner      string
+	DryRun     bool // Return the ticket without saving it
+}
+
+// RelatedImages is the ticket AddRelatedImages added an operator's related
+// images to
+type RelatedImages struct {
+	Ticket Ticket          `json:"ticket"`
+	Added  []string        `json:"added"` // Operators that weren't on the ticket yet
+	Images []ImportedImage `json:"images"`
+}
+
+// RelatedImagesOptions is where AddRelatedImages reads the
+// ClusterServiceVersion from, a bundle image or a CSV, and its optional
+// parameters
+type RelatedImagesOptions struct {
+	Bundle     string    // Bundle image pulled by the server, e.g. quay.io/app-sre/foo-bundle:v1.2.3
+	CSV        io.Reader // ClusterServiceVersion YAML, when Bundle isn't set
+	Registries []string  // Registries whose images are tracked; the server defaults to quay.io
+	DryRun     bool      // Return the ticket without saving it
+}
+
+// BuildInfo identifies the build of a server
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	BuildDate string `json:"buildDate,omitempty"`
+	Modified  bool   `json:"modified,omitempty"`
+	GoVersion string `json:"goVersion"`
+	Platform  string `json:"platform"`
+}
+
+// Error codes returned by the server, see Error
+const (
+	CodeTicketNotFound      = "ticket_not_found"
+	CodeInvalidOperator     = "invalid_operator"
+	CodeOperatorNotAllowed  = "operator_not_allowed"
+	CodeInvalidCVE          = "invalid_cve"
+	CodeInvalidLabel        = "invalid_label"
+	CodeGroupNotFound       = "group_not_found"
+	CodeUnknownGroup        = "unknown_group"
+	CodeOperatorNotFound    = "operator_not_found"
+	CodeInvalidThresholds   = "invalid_thresholds"
+	CodeInvalidExpectedBy   = "invalid_expected_by"
+	CodeTemplateNotFound    = "template_not_found"
+	CodeTicketExists        = "ticket_exists"
+	CodeUnknownProject      = "unknown_project"
+	CodeProjectNotFound     = "project_not_found"
+	CodeForbidden           = "forbidden"
+	CodeTooManyOperators    = "too_many_operators"
+	CodeQuotaExceeded       = "quota_exceeded"
+	CodeInvalidPin          = "invalid_pin"
+	CodeInvalidColumn       = "invalid_column"
+	CodeRegistryUnavailable = "registry_unavailable"
+	CodeNoClusters          = "no_clusters"
+	CodeNoCatalogs          = "no_catalogs"
+	CodeNoArgoCD            = "no_argocd"
+	CodeNoSaasFiles         = "no_saas_files"
+	CodeNoPipelines         = "no_pipelines"
+	CodeNoRepositories      = "no_repositories"
+	CodeNoPolicy            = "no_policy"
+	CodeNoImages            = "no_images"
+	CodeNoCSV               = "no_csv"
+	CodeStorageError        = "storage_error"
+	CodeReadOnly            = "read_only"
+	CodeInternalError       = "internal_error"
+)
+
+// Error is an error response from the server
+type Error struct {
+	StatusCode int    `json:"-"`
+	Code       string `json:"code"`
+	Message    string `json:"message"`
+	RequestID  string `json:"requestId,omitempty"`
+}
+
+func (e *Error) Error() string {
+	if e.RequestID != "" {
+		return fmt.Sprintf("%s (request ID: %s)", e.Message, e.RequestID)
+	}
+	return e.Message
+}
+
+// IsCode reports whether err is an error response with the given code
+func IsCode(err error, code string) bool {
+	e, ok := err.(*Error)
+	return ok && e.Code == code
+}
+
+// Client talks to an OpTrack server. It is safe for concurrent use.
+type Client struct {
+	baseURL string
+	http    *http.Client
+	header  http.Header
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithHTTPClient sends requests with hc instead of a client with a 60 second timeout
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) { c.http = hc }
+}
+
+// WithHeader adds a header to every request, e.g. the user header expected by
+// an authenticating reverse proxy in front of the server
+func WithHeader(key, value string) Option {
+	return func(c *Client) { c.header.Add(key, value) }
+}
+
+// New returns a client for an http(s) URL, including any base path the server
+// is served under, or unix:PATH for a server listening on a Unix domain socket
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		http:   &http.Client{Timeout: 60 * time.Second},
+		header: make(http.Header),
+	}
+	if path, ok := strings.CutPrefix(baseURL, "unix:"); ok {
+		c.http.Transport = &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", path)
+			},
+		}
+		baseURL = "http://optrack"
+	}
+	c.baseURL = strings.TrimSuffix(baseURL, "/")
+
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// ListTickets returns every ticket, archived or not, sorted by ID
+func (c *Client) ListTickets(ctx context.Context) ([]Ticket, error) {
+	return c.FindTickets(ctx, TicketFilter{IncludeArchived: true})
+}
+
+// TicketFilter selects tickets by owner, labels, rollup state and whether
+// they are archived. The zero TicketFilter finds the tickets that aren't.
+type TicketFilter struct {
+	Owner  string   // Matched case-insensitively
+	Labels []string // A ticket must have every one
+	// Archived finds archived tickets instead of those that aren't, and
+	// IncludeArchived both
+	Archived, IncludeArchived bool
+	Favorites                 bool     // Only the tickets the user starred
+	Project                   string   // Any project the user can see when empty
+	Rollups                   []string // Tickets in any of these rollup states, see Ticket.Rollup
+	Operators                 []string // Tickets tracking any of these operators
+	// Fields are the JSON fields of each ticket to fetch, such as "added",
+	// leaving the others zero; every field when empty. The ID always is.
+	Fields []string
+}
+
+// FindTickets returns the tickets matching a filter, sorted by ID. The
+// user's default view isn't applied.
+func (c *Client) FindTickets(ctx context.Context, filter TicketFilter) ([]Ticket, error) {
+	query := url.Values{"view": {"none"}}
+	if filter.Favorites {
+		query.Set("favorites", "true")
+	}
+	if filter.Project != "" {
+		query.Set("project", filter.Project)
+	}
+	if filter.Owner != "" {
+		query.Set("owner", filter.Owner)
+	}
+	for _, label := range filter.Labels {
+		query.Add("label", label)
+	}
+	for _, rollup := range filter.Rollups {
+		query.Add("rollup", rollup)
+	}
+	for _, operator := range filter.Operators {
+		query.Add("operator", operator)
+	}
+	if len(filter.Fields) > 0 {
+		query.Set("fields", strings.Join(filter.Fields, ","))
+	}
+	switch {
+	case filter.IncludeArchived:
+		query.Set("archived", "all")
+	case filter.Archived:
+		query.Set("archived", "true")
+	}
+	var tickets map[string]Ticket
+	if err := c.do(ctx, "GET", "/api/tickets", query, nil, &tickets); err != nil {
+		return nil, err
+	}
+	list := make([]Ticket, 0, len(tickets))
+	for _, t := range tickets {
+		list = append(list, t)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list, nil
+}
+
+// CreateTicket saves a ticket, replacing any ticket with the same ID, and
+// returns it as stored
+func (c *Client) CreateTicket(ctx context.Context, ticket Ticket) (Ticket, error) {
+	var saved Ticket
+	err := c.do(ctx, "POST", "/api/tickets", nil, ticket, &saved)
+	return saved, err
+}
+
+// DeleteTicket deletes a ticket. Unknown IDs fail with CodeTicketNotFound.
+func (c *Client) DeleteTicket(ctx context.Context, id string) error {
+	return c.do(ctx, "DELETE", "/api/tickets", url.Values{"id": {id}}, nil, nil)
+}
+
+// GetStatus returns the status of every operator on a ticket, in ticket order
+func (c *Client) GetStatus(ctx context.Context, ticketID string) ([]OperatorStatus, error) {
+	var statuses []OperatorStatus
+	err := c.do(ctx, "GET", "/api/status", url.Values{"ticket": {ticketID}}, nil, &statuses)
+	return statuses, err
+}
+
+// BatchStatus returns the statuses of several tickets and operators at once,
+// looking up operators they share only once. A ticket that doesn't exist has
+// an Error rather than failing the batch.
+func (c *Client) BatchStatus(ctx context.Context, tickets, operators []string) (*BatchStatus, error) {
+	var batch BatchStatus
+	body := map[string][]string{"tickets": tickets, "operators": operators}
+	if err := c.do(ctx, "POST", "/api/v1/status/batch", nil, body, &batch); err != nil {
+		return nil, err
+	}
+	return &batch, nil
+}
+
+// GetOperator looks up one operator, whether or not it is on a ticket
+func (c *Client) GetOperator(ctx context.Context, name string) (*OperatorStatus, error) {
+	var status OperatorStatus
+	if err := c.do(ctx, "GET", "/api/operator", url.Values{"name": {name}}, nil, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// GetDrift reports, per configured cluster, whether each operator on a ticket
+// runs its latest image. Servers without clusters fail with CodeNoClusters.
+func (c *Client) GetDrift(ctx context.Context, ticketID string) ([]Drift, error) {
+	var drift []Drift
+	err := c.do(ctx, "GET", "/api/v1/tickets/"+url.PathEscape(ticketID)+"/drift", nil, nil, &drift)
+	return drift, err
+}
+
+// Discover lists the operators with images on registries, quay.io when none
+// are given, that run in the namespaces of the server's clusters. Servers
+// without clusters fail with CodeNoClusters.
+func (c *Client) Discover(ctx context.Context, registries []string) (*Discovery, error) {
+	var d Discovery
+	if err := c.do(ctx, "GET", "/api/v1/discovery", url.Values{"registry": registries}, nil, &d); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// GetCatalog reports, per configured catalog, whether the newest bundle of
+// each operator on a ticket references its latest image. Servers without
+// catalogs fail with CodeNoCatalogs.
+func (c *Client) GetCatalog(ctx context.Context, ticketID string) ([]Catalog, error) {
+	var results []Catalog
+	err := c.do(ctx, "GET", "/api/v1/tickets/"+url.PathEscape(ticketID)+"/catalog", nil, nil, &results)
+	return results, err
+}
+
+// GetApplications reports the ArgoCD applications linked to a ticket.
+// Servers without ArgoCD fail with CodeNoArgoCD.
+func (c *Client) GetApplications(ctx context.Context, ticketID string) ([]Application, error) {
+	var apps []Application
+	err := c.do(ctx, "GET", "/api/v1/tickets/"+url.PathEscape(ticketID)+"/applications", nil, nil, &apps)
+	return apps, err
+}
+
+// GetPromotion reports whether the SaaS file targets deploying each operator
+// on a ticket have been promoted to its latest image. Servers without SaaS
+// files fail with CodeNoSaasFiles.
+func (c *Client) GetPromotion(ctx context.Context, ticketID string) ([]Promotion, error) {
+	var results []Promotion
+	err := c.do(ctx, "GET", "/api/v1/tickets/"+url.PathEscape(ticketID)+"/promotion", nil, nil, &results)
+	return results, err
+}
+
+// GetPipelines returns the last build of every operator on a ticket that has
+// a pipeline configured. Servers without pipelines fail with CodeNoPipelines.
+func (c *Client) GetPipelines(ctx context.Context, ticketID string) ([]Pipeline, error) {
+	var results []Pipeline
+	err := c.do(ctx, "GET", "/api/v1/tickets/"+url.PathEscape(ticketID)+"/pipelines", nil, nil, &results)
+	return results, err
+}
+
+// GetCommits compares the latest image of every operator on a ticket that
+// has a source repository with its branch and latest release. Servers
+// without source repositories fail with CodeNoRepositories.
+func (c *Client) GetCommits(ctx context.Context, ticketID string) ([]Commits, error) {
+	var results []Commits
+	err := c.do(ctx, "GET", "/api/v1/tickets/"+url.PathEscape(ticketID)+"/commits", nil, nil, &results)
+	return results, err
+}
+
+// GetCompliance checks every operator on a ticket against the server's
+// policy. Servers without a policy fail with CodeNoPolicy.
+func (c *Client) GetCompliance(ctx context.Context, ticketID string) ([]Compliance, error) {
+	var results []Compliance
+	err := c.do(ctx, "GET", "/api/v1/tickets/"+url.PathEscape(ticketID)+"/compliance", nil, nil, &results)
+	return results, err
+}
+
+// GetCVEs reports whether the latest image of every operator on a ticket
+// still has the ticket's CVEs
+func (c *Client) GetCVEs(ctx context.Context, ticketID string) ([]CVEFix, error) {
+	var results []CVEFix
+	err := c.do(ctx, "GET", "/api/v1/tickets/"+url.PathEscape(ticketID)+"/cves", nil, nil, &results)
+	return results, err
+}
+
+// GetPins checks whether the digests the operators on a ticket are pinned to
+// are still tagged in the registry
+func (c *Client) GetPins(ctx context.Context, ticketID string) ([]Pin, error) {
+	var results []Pin
+	err := c.do(ctx, "GET", "/api/v1/tickets/"+url.PathEscape(ticketID)+"/pins", nil, nil, &results)
+	return results, err
+}
+
+// ImportManifests saves a ticket tracking the images referenced by YAML or
+// JSON Kubernetes manifests, replacing any ticket with the same ID. Manifests
+// without images on the registries fail with CodeNoImages.
+func (c *Client) ImportManifests(ctx context.Context, ticketID string, manifests io.Reader, opts ImportOptions) (*Import, error) {
+	query := url.Values{}
+	for _, r := range opts.Registries {
+		query.Add("registry", r)
+	}
+	if opts.Owner != "" {
+		query.Set("owner", opts.Owner)
+	}
+	if opts.DryRun {
+		query.Set("dryRun", "true")
+	}
+	var result Import
+	if err := c.do(ctx, "POST", "/api/v1/tickets/"+url.PathEscape(ticketID)+"/import", query, manifests, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// AddRelatedImages adds the images referenced by an operator's
+// ClusterServiceVersion to a ticket, keeping the operators already on it.
+// Bundle images without a CSV fail with CodeNoCSV, and CSVs without images
+// on the registries with CodeNoImages.
+func (c *Client) AddRelatedImages(ctx context.Context, ticketID string, opts RelatedImagesOptions) (*RelatedImages, error) {
+	query := url.Values{}
+	for _, r := range opts.Registries {
+		query.Add("registry", r)
+	}
+	var body interface{}
+	if opts.Bundle != "" {
+		query.Set("bundle", opts.Bundle)
+	} else if opts.CSV != nil {
+		body = opts.CSV
+	}
+	if opts.DryRun {
+		query.Set("dryRun", "true")
+	}
+	var result RelatedImages
+	if err := c.do(ctx, "POST", "/api/v1/tickets/"+url.PathEscape(ticketID)+"/related-images", query, body, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// GetStatusTable returns the status table of a ticket, sorted and with the
+// columns chosen by opts
+func (c *Client) GetStatusTable(ctx context.Context, ticketID string, opts TableOptions) (*StatusTable, error) {
+	query := url.Values{}
+	if opts.Sort != "" {
+		query.Set("sort", opts.Sort)
+	}
+	if opts.Desc {
+		query.Set("order", "desc")
+	}
+	if len(opts.Columns) > 0 {
+		query.Set("columns", strings.Join(opts.Columns, ","))
+	}
+	var table StatusTable
+	if err := c.do(ctx, "GET", "/api/v1/tickets/"+url.PathEscape(ticketID)+"/table", query, nil, &table); err != nil {
+		return nil, err
+	}
+	return &table, nil
+}
+
+// CreateShareLink creates a link to the status page of a ticket, limited to
+// operators when any are given, that works for expiresIn, such as "14d";
+// empty for the server's default of a week
+func (c *Client) CreateShareLink(ctx context.Context, ticketID, expiresIn string, operators []string) (*ShareLink, error) {
+	body := struct {
+		ExpiresIn string   `json:"expiresIn,omitempty"`
+		Operators []string `json:"operators,omitempty"`
+	}{expiresIn, operators}
+	var link ShareLink
+	if err := c.do(ctx, "POST", "/api/v1/tickets/"+url.PathEscape(ticketID)+"/shares", nil, body, &link); err != nil {
+		return nil, err
+	}
+	return &link, nil
+}
+
+// ListShareLinks returns the share links of a ticket, newest first
+func (c *Client) ListShareLinks(ctx context.Context, ticketID string) ([]ShareLink, error) {
+	var links []ShareLink
+	err := c.do(ctx, "GET", "/api/v1/tickets/"+url.PathEscape(ticketID)+"/shares", nil, nil, &links)
+	return links, err
+}
+
+// RevokeShareLink stops a share link of a ticket from working
+func (c *Client) RevokeShareLink(ctx context.Context, ticketID, linkID string) error {
+	return c.do(ctx, "DELETE", "/api/v1/tickets/"+url.PathEscape(ticketID)+"/shares/"+url.PathEscape(linkID), nil, nil, nil)
+}
+
+// ListGroups returns every operator group, sorted by name
+func (c *Client) ListGroups(ctx context.Context) ([]OperatorGroup, error) {
+	var groups []OperatorGroup
+	err := c.do(ctx, "GET", "/api/v1/groups", nil, nil, &groups)
+	return groups, err
+}
+
+// GetGroup returns one operator group
+func (c *Client) GetGroup(ctx context.Context, name string) (*OperatorGroup, error) {
+	var group OperatorGroup
+	if err := c.do(ctx, "GET", "/api/v1/groups/"+url.PathEscape(name), nil, nil, &group); err != nil {
+		return nil, err
+	}
+	return &group, nil
+}
+
+// PutGroup creates or replaces an operator group, which changes the
+// operators of every ticket including it. It needs the admin token, e.g.
+// WithHeader("Authorization", "Bearer "+token).
+func (c *Client) PutGroup(ctx context.Context, group OperatorGroup) (*OperatorGroup, error) {
+	body := struct {
+		Description string   `json:"description,omitempty"`
+		Operators   []string `json:"operators"`
+	}{group.Description, group.Operators}
+	var saved OperatorGroup
+	if err := c.do(ctx, "PUT", "/api/v1/groups/"+url.PathEscape(group.Name), nil, body, &saved); err != nil {
+		return nil, err
+	}
+	return &saved, nil
+}
+
+// DeleteGroup removes an operator group no ticket includes. It needs the
+// admin token, like PutGroup.
+func (c *Client) DeleteGroup(ctx context.Context, name string) error {
+	return c.do(ctx, "DELETE", "/api/v1/groups/"+url.PathEscape(name), nil, nil, nil)
+}
+
+// ListTemplates returns every ticket template, sorted by name
+func (c *Client) ListTemplates(ctx context.Context) ([]TicketTemplate, error) {
+	var templates []TicketTemplate
+	err := c.do(ctx, "GET", "/api/v1/templates", nil, nil, &templates)
+	return templates, err
+}
+
+// GetTemplate returns one ticket template
+func (c *Client) GetTemplate(ctx context.Context, name string) (*TicketTemplate, error) {
+	var t TicketTemplate
+	if err := c.do(ctx, "GET", "/api/v1/templates/"+url.PathEscape(name), nil, nil, &t); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// PutTemplate creates or replaces a ticket template. It needs the admin
+// token, like PutGroup.
+func (c *Client) PutTemplate(ctx context.Context, t TicketTemplate) (*TicketTemplate, error) {
+	var saved TicketTemplate
+	if err := c.do(ctx, "PUT", "/api/v1/templates/"+url.PathEscape(t.Name), nil, t, &saved); err != nil {
+		return nil, err
+	}
+	return &saved, nil
+}
+
+// DeleteTemplate removes a ticket template, leaving the tickets created from
+// it. It needs the admin token.
+func (c *Client) DeleteTemplate(ctx context.Context, name string) error {
+	return c.do(ctx, "DELETE", "/api/v1/templates/"+url.PathEscape(name), nil, nil, nil)
+}
+
+// CreateTicketFromTemplate creates a new ticket from a template. The ticket
+// has the ID and anything to add to the template, such as its CVEs; an ID
+// already taken fails with CodeTicketExists.
+func (c *Client) CreateTicketFromTemplate(ctx context.Context, template string, ticket Ticket) (Ticket, error) {
+	var saved Ticket
+	err := c.do(ctx, "POST", "/api/v1/templates/"+url.PathEscape(template)+"/tickets", nil, ticket, &saved)
+	return saved, err
+}
+
+// ArchiveTicket archives a ticket: it is left out of lists and no longer
+// polled, until UnarchiveTicket. It returns the ticket.
+func (c *Client) ArchiveTicket(ctx context.Context, id string) (Ticket, error) {
+	var ticket Ticket
+	err := c.do(ctx, "POST", "/api/v1/tickets/"+url.PathEscape(id)+"/archive", nil, nil, &ticket)
+	return ticket, err
+}
+
+// UnarchiveTicket undoes ArchiveTicket
+func (c *Client) UnarchiveTicket(ctx context.Context, id string) (Ticket, error) {
+	var ticket Ticket
+	err := c.do(ctx, "POST", "/api/v1/tickets/"+url.PathEscape(id)+"/unarchive", nil, nil, &ticket)
+	return ticket, err
+}
+
+// ListInventory returns the operators the server has tracked, sorted by name
+func (c *Client) ListInventory(ctx context.Context, filter InventoryFilter) ([]InventoryEntry, error) {
+	q := url.Values{}
+	if filter.Team != "" {
+		q.Set("team", filter.Team)
+	}
+	if filter.Criticality != "" {
+		q.Set("criticality", filter.Criticality)
+	}
+	if filter.Unused {
+		q.Set("unused", "true")
+	}
+	var entries []InventoryEntry
+	err := c.do(ctx, "GET", "/api/v1/inventory", q, nil, &entries)
+	return entries, err
+}
+
+// GetInventoryEntry returns the inventory entry of an operator, matched
+// regardless of case. Operators never tracked fail with CodeOperatorNotFound.
+func (c *Client) GetInventoryEntry(ctx context.Context, operator string) (*InventoryEntry, error) {
+	namespace, repository, _ := strings.Cut(operator, "/")
+	var entry InventoryEntry
+	if err := c.do(ctx, "GET", "/api/v1/inventory/"+url.PathEscape(namespace)+"/"+url.PathEscape(repository), nil, nil, &entry); err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// UpdateInventoryEntry sets the team, contact, source repository and
+// criticality of an operator, adding it to the inventory if needed. Spelling
+// its name differently renames it on every ticket. It needs the admin token,
+// like PutGroup.
+func (c *Client) UpdateInventoryEntry(ctx context.Context, entry InventoryEntry) (*InventoryEntry, error) {
+	namespace, repository, _ := strings.Cut(entry.Name, "/")
+	body := struct {
+		Team             string `json:"team,omitempty"`
+		Contact          string `json:"contact,omitempty"`
+		SourceRepository string `json:"sourceRepository,omitempty"`
+		Criticality      string `json:"criticality,omitempty"`
+	}{entry.Team, entry.Contact, entry.SourceRepository, entry.Criticality}
+	var saved InventoryEntry
+	if err := c.do(ctx, "PUT", "/api/v1/inventory/"+url.PathEscape(namespace)+"/"+url.PathEscape(repository), nil, body, &saved); err != nil {
+		return nil, err
+	}
+	return &saved, nil
+}
+
+// ImportOwners sets the team and contact of the operators of an owners file,
+// adding operators the inventory doesn't have yet. It needs the admin token,
+// like UpdateInventoryEntry.
+func (c *Client) ImportOwners(ctx context.Context, owners OwnersFile) (*OwnersImport, error) {
+	var result OwnersImport
+	if err := c.do(ctx, "POST", "/api/v1/inventory/owners", nil, owners, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// RenameOperator rewrites an operator to another name on every ticket and
+// group, after its repository was renamed or moved. Tickets keep the latest
+// digest under the old name as a baseline where the operator wasn't rebuilt
+// yet. With dryRun it only reports what would change. It needs the admin
+// token, like ImportOwners.
+func (c *Client) RenameOperator(ctx context.Context, from, to string, dryRun bool) (*OperatorRename, error) {
+	body := struct {
+		From   string `json:"from"`
+		To     string `json:"to"`
+		DryRun bool   `json:"dryRun,omitempty"`
+	}{from, to, dryRun}
+	var result OperatorRename
+	if err := c.do(ctx, "POST", "/api/v1/operators/rename", nil, body, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// ListDigestAnnotations returns the reasons given for the images of an
+// operator, newest first
+func (c *Client) ListDigestAnnotations(ctx context.Context, operator string) ([]DigestAnnotation, error) {
+	namespace, repository, _ := strings.Cut(operator, "/")
+	return listPages[DigestAnnotation](ctx, c, "/api/v1/operators/"+url.PathEscape(namespace)+"/"+url.PathEscape(repository)+"/digests", 1000)
+}
+
+// AnnotateDigest gives the reason an image of an operator was built, such as
+// "CVE-2024-1234 rebuild", replacing any earlier one. The digest is sha256
+// hex, with or without "sha256:". Notifications and feeds about the image
+// carry the reason, including when it is given before the image is seen.
+func (c *Client) AnnotateDigest(ctx context.Context, operator, digest, reason string) (*DigestAnnotation, error) {
+	namespace, repository, _ := strings.Cut(operator, "/")
+	body := struct {
+		Reason string `json:"reason"`
+	}{reason}
+	var a DigestAnnotation
+	if err := c.do(ctx, "PUT", "/api/v1/operators/"+url.PathEscape(namespace)+"/"+url.PathEscape(repository)+"/digests/"+url.PathEscape(digest), nil, body, &a); err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// DeleteDigestAnnotation removes the reason given for an image
+func (c *Client) DeleteDigestAnnotation(ctx context.Context, operator, digest string) error {
+	namespace, repository, _ := strings.Cut(operator, "/")
+	return c.do(ctx, "DELETE", "/api/v1/operators/"+url.PathEscape(namespace)+"/"+url.PathEscape(repository)+"/digests/"+url.PathEscape(digest), nil, nil, nil)
+}
+
+// ListComments returns the comments on a ticket, oldest first
+func (c *Client) ListComments(ctx context.Context, ticket string) ([]Comment, error) {
+	return listPages[Comment](ctx, c, "/api/v1/tickets/"+url.PathEscape(ticket)+"/comments", 500)
+}
+
+// listPages fetches every page of a list the server answers limit entries of
+// at a time. A page of another size is the last, so servers that answer
+// everything at once work too.
+func listPages[T any](ctx context.Context, c *Client, path string, limit int) ([]T, error) {
+	var all []T
+	for offset := 0; ; offset += limit {
+		var page []T
+		query := url.Values{"limit": {strconv.Itoa(limit)}, "offset": {strconv.Itoa(offset)}}
+		if err := c.do(ctx, "GET", path, query, nil, &page); err != nil {
+			return nil, err
+		}
+		all = append(all, page...)
+		if len(page) != limit {
+			return all, nil
+		}
+	}
+}
+
+// AddComment adds a comment with a Markdown body to a ticket, returning it
+func (c *Client) AddComment(ctx context.Context, ticket, body string) (*Comment, error) {
+	req := struct {
+		Body string `json:"body"`
+	}{body}
+	var comment Comment
+	if err := c.do(ctx, "POST", "/api/v1/tickets/"+url.PathEscape(ticket)+"/comments", nil, req, &comment); err != nil {
+		return nil, err
+	}
+	return &comment, nil
+}
+
+// DeleteComment removes a comment. Only its author can.
+func (c *Client) DeleteComment(ctx context.Context, ticket, id string) error {
+	return c.do(ctx, "DELETE", "/api/v1/tickets/"+url.PathEscape(ticket)+"/comments/"+url.PathEscape(id), nil, nil, nil)
+}
+
+// ListProjects returns the projects the user can see, sorted by name
+func (c *Client) ListProjects(ctx context.Context) ([]Project, error) {
+	var projects []Project
+	err := c.do(ctx, "GET", "/api/v1/projects", nil, nil, &projects)
+	return projects, err
+}
+
+// GetProject returns one project, failing with CodeProjectNotFound for
+// projects that don't exist or that the user can't see
+func (c *Client) GetProject(ctx context.Context, name string) (*Project, error) {
+	var project Project
+	if err := c.do(ctx, "GET", "/api/v1/projects/"+url.PathEscape(name), nil, nil, &project); err != nil {
+		return nil, err
+	}
+	return &project, nil
+}
+
+// GetPreferences returns the favorites and default view of the user the
+// client's headers name
+func (c *Client) GetPreferences(ctx context.Context) (*Preferences, error) {
+	var prefs Preferences
+	if err := c.do(ctx, "GET", "/api/v1/me/preferences", nil, nil, &prefs); err != nil {
+		return nil, err
+	}
+	return &prefs, nil
+}
+
+// PutPreferences replaces the user's default view
+func (c *Client) PutPreferences(ctx context.Context, view TicketView) (*Preferences, error) {
+	req := struct {
+		View TicketView `json:"view"`
+	}{view}
+	var prefs Preferences
+	if err := c.do(ctx, "PUT", "/api/v1/me/preferences", nil, req, &prefs); err != nil {
+		return nil, err
+	}
+	return &prefs, nil
+}
+
+// StarTicket adds a ticket to the user's favorites
+func (c *Client) StarTicket(ctx context.Context, ticket string) (*Preferences, error) {
+	var prefs Preferences
+	if err := c.do(ctx, "PUT", "/api/v1/me/favorites/"+url.PathEscape(ticket), nil, nil, &prefs); err != nil {
+		return nil, err
+	}
+	return &prefs, nil
+}
+
+// UnstarTicket removes a ticket from the user's favorites
+func (c *Client) UnstarTicket(ctx context.Context, ticket string) (*Preferences, error) {
+	var prefs Preferences
+	if err := c.do(ctx, "DELETE", "/api/v1/me/favorites/"+url.PathEscape(ticket), nil, nil, &prefs); err != nil {
+		return nil, err
+	}
+	return &prefs, nil
+}
+
+// GetDashboard summarizes every ticket: how many operators have been rebuilt,
+// are stale or failed, and the stalest operator
+func (c *Client) GetDashboard(ctx context.Context) (*Dashboard, error) {
+	var d Dashboard
+	if err := c.do(ctx, "GET", "/api/v1/dashboard", nil, nil, &d); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// Version returns the build of the server
+func (c *Client) Version(ctx context.Context) (*BuildInfo, error) {
+	var info BuildInfo
+	if err := c.do(ctx, "GET", "/api/version", nil, nil, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+func (c *Client) newRequest(ctx context.Context, method, path string, query url.Values, body interface{}) (*http.Request, error) {
+	u := c.baseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	var reqBody io.Reader
+	contentType := "application/json"
+	if r, ok := body.(io.Reader); ok {
+		reqBody, contentType = r, "application/yaml" // Sent as is
+	} else if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reqBody = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u, reqBody)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range c.header {
+		req.Header[key] = values
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+	return req, nil
+}
+
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body interface{}, out interface{}) error {
+	req, err := c.newRequest(ctx, method, path, query, body)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach OpTrack server: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return responseError(resp)
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to parse server response: %v", err)
+	}
+	return nil
+}
+
+// responseError reads an error response. Servers older than the JSON error
+// format, and proxies in front of the server, answer in plain text.
+func responseError(resp *http.Response) error {
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	e := &Error{StatusCode: resp.StatusCode}
+	if json.Unmarshal(data, e) != nil || e.Code == "" {
+		e.Code = strings.ToLower(strings.ReplaceAll(http.StatusText(resp.StatusCode), " ", "_"))
+		e.Message = fmt.Sprintf("server returned %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	return e
+}
@@ -0,0 +1,94 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Event types sent by StreamEvents
+const (
+	EventTicketRebuilt   = "ticket_rebuilt"
+	EventOperatorStale   = "operator_stale"
+	EventOperatorUpdated = "operator_updated"
+	EventClusterOutdated = "cluster_outdated"
+	EventClusterUpdated  = "cluster_updated"
+	EventPinUntagged     = "pin_untagged"
+	EventPinMissing      = "pin_missing"
+)
+
+// Event is a change in ticket or operator state seen by the server's poller
+type Event struct {
+	Type     string          `json:"type"`
+	Ticket   string          `json:"ticket"`
+	Operator *OperatorStatus `json:"operator,omitempty"` // Set for operator and cluster events
+	Previous string          `json:"previous,omitempty"` // Previous digest, for operator_updated
+	Reason   string          `json:"reason,omitempty"`   // Why the new image was built, for operator_updated when it was given
+	Cluster  string          `json:"cluster,omitempty"`  // Set for cluster events only
+	Pin      *Pin            `json:"pin,omitempty"`      // Set for pin events only
+	Time     time.Time       `json:"time"`
+}
+
+// StreamEvents calls handle for every event the server publishes until ctx is
+// cancelled, the server closes the stream or handle returns an error. It
+// returns ctx.Err() after cancellation. Events published while not connected
+// are not replayed.
+func (c *Client) StreamEvents(ctx context.Context, handle func(Event) error) error {
+	req, err := c.newRequest(ctx, "GET", "/api/events", nil, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+
+	// The stream stays open indefinitely, so only ctx may end it
+	hc := *c.http
+	hc.Timeout = 0
+	resp, err := hc.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("failed to reach OpTrack server: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return responseError(resp)
+	}
+
+	var data strings.Builder
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			// A blank line ends an event
+			if data.Len() == 0 {
+				continue
+			}
+			var ev Event
+			if err := json.Unmarshal([]byte(data.String()), &ev); err != nil {
+				return fmt.Errorf("failed to parse event: %v", err)
+			}
+			data.Reset()
+			if err := handle(ev); err != nil {
+				return err
+			}
+		case strings.HasPrefix(line, "data:"):
+			if data.Len() > 0 {
+				data.WriteByte('\n')
+			}
+			data.WriteString(strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+		// Comments (keep-alives), event names and IDs carry nothing Event doesn't
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("event stream interrupted: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"OpTrack/internal/plugin"
+	"OpTrack/internal/registry"
+)
+
+// PluginsConfig adds site-specific registries and notification channels as
+// external programs, see internal/plugin for how they are called
+type PluginsConfig struct {
+	Registry  PluginConfig           `yaml:"registry"` // Replaces the Quay.io API when command is set
+	Notifiers []NotifierPluginConfig `yaml:"notifiers"`
+}
+
+// PluginConfig is an external program and how long one call may take
+type PluginConfig struct {
+	Command string   `yaml:"command"`
+	Args    []string `yaml:"args"`
+	Timeout Duration `yaml:"timeout"`
+}
+
+// NotifierPluginConfig is a plugin notification channel. Name is the channel
+// name used by notification rules.
+type NotifierPluginConfig struct {
+	Name         string `yaml:"name"`
+	PluginConfig `yaml:",inline"`
+}
+
+func (c PluginConfig) command() plugin.Command {
+	return plugin.Command{Path: c.Command, Args: c.Args, Timeout: time.Duration(c.Timeout)}
+}
+
+// registryPluginRequest is written to a registry plugin for each lookup
+type registryPluginRequest struct {
+	Operator string `json:"operator"` // namespace/repository
+}
+
+// registryPluginResponse is a registry plugin's answer. Status is "OK" when
+// the operator was found, otherwise a short reason shown in place of its age.
+type registryPluginResponse struct {
+	Status      string    `json:"status"`
+	LastUpdated time.Time `json:"lastUpdated"`
+	SHA256      string    `json:"sha256"`
+	Tags        []string  `json:"tags"` // Optional: the tags of the latest image
+}
+
+// registryPlugin looks operators up through a plugin instead of Quay.io
+type registryPlugin struct {
+	cmd plugin.Command
+}
+
+func (p registryPlugin) Lookup(operator string) (*registry.Status, error) {
+	var resp registryPluginResponse
+	if err := p.cmd.Call(context.Background(), registryPluginRequest{Operator: operator}, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Status == "" {
+		resp.Status = "Plugin returned no status"
+	}
+	return &registry.Status{
+		LastUpdated: resp.LastUpdated,
+		SHA256:      resp.SHA256,
+		Status:      resp.Status,
+		Tags:        resp.Tags,
+	}, nil
+}
+
+// pluginEvent is the JSON form of an Event written to notifier plugins
+type pluginEvent struct {
+	Type     EventType        `json:"type"`
+	Title    string           `json:"title"`
+	Summary  string           `json:"summary"`
+	Ticket   JiraTicket       `json:"ticket"`
+	Operator *OperatorStatus  `json:"operator,omitempty"`
+	Previous string           `json:"previous,omitempty"`
+	Reason   string           `json:"reason,omitempty"`
+	Cluster  *OperatorDrift   `json:"cluster,omitempty"`
+	Pin      *PinCheck        `json:"pin,omitempty"`
+	Statuses []OperatorStatus `json:"statuses,omitempty"`
+	Events   []pluginEvent    `json:"events,omitempty"`
+	Time     time.Time        `json:"time"`
+}
+
+func newPluginEvent(ev Event) pluginEvent {
+	out := pluginEvent{
+		Type:     ev.Type,
+		Title:    eventTitle(ev),
+		Summary:  eventSummary(ev),
+		Ticket:   ev.Ticket,
+		Operator: ev.Operator,
+		Previous: ev.Previous,
+		Reason:   ev.Reason,
+		Cluster:  ev.Cluster,
+		Pin:      ev.Pin,
+		Statuses: ev.Statuses,
+		Time:     ev.Time,
+	}
+	for _, e := range ev.Events {
+		out.Events = append(out.Events, newPluginEvent(e))
+	}
+	return out
+}
+
+// PluginNotifier delivers events by running a plugin, which succeeds by
+// exiting with status 0. Its output is ignored.
+type PluginNotifier struct {
+	name string
+	cmd  plugin.Command
+}
+
+func NewPluginNotifier(cfg NotifierPluginConfig) *PluginNotifier {
+	return &PluginNotifier{name: cfg.Name, cmd: cfg.command()}
+}
+
+func (n *PluginNotifier) Name() string {
+	return n.name
+}
+
+func (n *PluginNotifier) Notify(ev Event) error {
+	return n.cmd.Call(context.Background(), newPluginEvent(ev), nil)
+}
+
+// buildPluginNotifiers creates a notifier for every configured notifier plugin
+func buildPluginNotifiers(plugins []NotifierPluginConfig) []Notifier {
+	var notifiers []Notifier
+	for _, cfg := range plugins {
+		notifiers = append(notifiers, NewPluginNotifier(cfg))
+		slog.Info("Plugin notifications enabled", "channel", cfg.Name, "command", cfg.Command)
+	}
+	return notifiers
+}
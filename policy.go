@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"OpTrack/internal/clock"
+	"OpTrack/internal/policy"
+)
+
+// OperatorCompliance is whether an operator complies with the policy
+type OperatorCompliance = policy.Result
+
+// PolicyConfig is the compliance policy operators are checked against
+type PolicyConfig struct {
+	File     string `yaml:"file"`     // YAML rules, see policy.example.yaml; read again on reload
+	Registry string `yaml:"registry"` // What allowedRegistries match with the operator appended; defaults to the host of quay.url
+}
+
+// newComplianceChecker returns nil when no policy file is configured
+func newComplianceChecker(cfg PolicyConfig, quay QuayConfig, reg policy.Registry, clk clock.Clock) (*policy.Checker, error) {
+	if cfg.File == "" {
+		return nil, nil
+	}
+	host, err := imageRegistry(cfg.Registry, quay)
+	if err != nil {
+		return nil, err
+	}
+	return policy.New(cfg.File, host, reg, clk)
+}
+
+func newComplianceCommand(opts *cliOptions) *cobra.Command {
+	return &cobra.Command{
+		Use:   "compliance <ticket>",
+		Short: "Check every operator on a ticket against the compliance policy",
+		Long: `Check every operator on a ticket against the compliance policy and exit with
+status 1 if any operator violates it, so CI pipelines can gate on it.
+
+The policy file is set with policy.file: in the config file; its rules set age
+limits, required signatures and provenance, allowed registries, banned base
+images and vulnerability limits for the operators they match.`,
+		Example:           "  optrack compliance OSD-1234",
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeFirstTicket(opts),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			backend, err := opts.backend()
+			if err != nil {
+				return err
+			}
+			results, err := backend.TicketCompliance(args[0])
+			if err != nil {
+				return fmt.Errorf("failed to check %s against the policy: %v", args[0], err)
+			}
+			if err := opts.printer(cmd).print(results, func(bool) {
+				printCompliance(cmd.OutOrStdout(), results)
+			}); err != nil {
+				return err
+			}
+			failed := 0
+			for _, r := range results {
+				if !r.Compliant {
+					failed++
+				}
+			}
+			if failed > 0 {
+				return fmt.Errorf("%d of %d operators violate the policy", failed, len(results))
+			}
+			return nil
+		},
+	}
+}
+
+// printCompliance prints one row per violation, or one row for a compliant operator
+func printCompliance(out io.Writer, results []OperatorCompliance) {
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "OPERATOR\tRESULT\tRULE\tCHECK\tREASON")
+	for _, r := range results {
+		if r.Compliant {
+			fmt.Fprintf(tw, "%s\tpass\t%s\t\t\n", r.Operator, strings.Join(r.Rules, ", "))
+			continue
+		}
+		for _, v := range r.Violations {
+			fmt.Fprintf(tw, "%s\tfail\t%s\t%s\t%s\n", r.Operator, v.Rule, v.Check, v.Reason)
+		}
+	}
+	tw.Flush()
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+
+	"OpTrack/internal/api"
+	"OpTrack/internal/registry"
+	"OpTrack/internal/scheduler"
+)
+
+// defaultPollInterval is how often the poller refreshes operator statuses
+// unless configured otherwise
+const defaultPollInterval = 15 * time.Minute
+
+// Poller periodically checks every ticket against Quay.io and publishes
+// events when a ticket or operator changes state, and every finished cycle
+type Poller struct {
+	state    *AppState
+	quay     *QuayClient
+	bus      *EventBus
+	interval time.Duration
+
+	rebuilt map[string]bool              // ticket ID -> all operators rebuilt
+	stale   map[string]map[string]bool   // ticket ID -> operator -> stale
+	digests map[string]map[string]string // ticket ID -> operator -> last seen digest
+
+	mu          sync.Mutex
+	lastCycle   time.Time // When the last poll cycle finished
+	lastSuccess time.Time // When a cycle last got at least one good answer from Quay.io
+	queueDepth  int
+}
+
+func NewPoller(state *AppState, qc *QuayClient, bus *EventBus, interval time.Duration) *Poller {
+	return &Poller{
+		state:    state,
+		quay:     qc,
+		bus:      bus,
+		interval: interval,
+		rebuilt:  make(map[string]bool),
+		stale:    make(map[string]map[string]bool),
+		digests:  make(map[string]map[string]string),
+	}
+}
+
+// Run polls immediately and then on every interval until stop is closed
+func (p *Poller) Run(stop <-chan struct{}) {
+	scheduler.Every(p.state.clock, p.interval, p.pollOnce)(stop)
+}
+
+// pollOnce archives untouched tickets and checks every other ticket that
+// isn't archived. It gives up between tickets once stop is closed, or the
+// Quay.io client is closed, without publishing the cycle, leaving the
+// metrics, rollups and alerts from the previous cycle in place.
+func (p *Poller) pollOnce(stop <-chan struct{}) {
+	archiveUntouched(p.state, p.state.clock.Now())
+	snapshot := p.state.List()
+	tickets := make([]JiraTicket, 0, len(snapshot))
+	for _, ticket := range snapshot {
+		if ticket.Archived == nil {
+			tickets = append(tickets, ticket)
+		}
+	}
+
+	cycle := PollCycle{Start: p.state.clock.Now(), Tickets: make([]TicketCheck, 0, len(tickets))}
+	ticketsGauge.Set(float64(len(tickets)))
+	pollerQueueDepth.Set(float64(len(tickets)))
+	p.setQueueDepth(len(tickets))
+
+	seen := make(map[string]bool)
+	lookups, ok := 0, 0
+	for i, ticket := range tickets {
+		select {
+		case <-stop:
+			slog.Info("Poll cycle interrupted by shutdown", "checked", i, "tickets", len(tickets))
+			p.setQueueDepth(0)
+			return
+		default:
+		}
+
+		seen[ticket.ID] = true
+		statuses := p.checkTicket(ticket)
+		if p.quay.Closed() {
+			// Its lookups failed for the shutdown, not because of Quay.io
+			slog.Info("Poll cycle interrupted by shutdown", "checked", i, "tickets", len(tickets))
+			p.setQueueDepth(0)
+			return
+		}
+		p.state.setRollup(ticket, ticketRollup(ticket, statuses))
+		for _, status := range statuses {
+			lookups++
+			if status.Status == "OK" {
+				ok++
+			}
+		}
+		cycle.Tickets = append(cycle.Tickets, TicketCheck{Ticket: ticket, Statuses: statuses})
+		pollerQueueDepth.Add(-1)
+		p.setQueueDepth(len(tickets) - i - 1)
+	}
+
+	cycle.End = p.state.clock.Now()
+	p.mu.Lock()
+	p.lastCycle = cycle.End
+	if lookups == 0 || ok > 0 {
+		p.lastSuccess = p.lastCycle
+	}
+	p.mu.Unlock()
+	p.bus.PublishCycle(cycle)
+
+	// Forget state for tickets that have been deleted or archived
+	for id := range p.rebuilt {
+		if !seen[id] {
+			delete(p.rebuilt, id)
+			delete(p.stale, id)
+			delete(p.digests, id)
+		}
+	}
+}
+
+// recordPollMetrics updates the poller and per-operator metrics after a cycle
+func recordPollMetrics(cycle PollCycle) {
+	// Replace the per-operator gauges wholesale so deleted operators disappear
+	operatorAgeSeconds.Reset()
+	operatorStale.Reset()
+	operatorVulnerabilities.Reset()
+	operatorBaseOutdated.Reset()
+	for _, check := range cycle.Tickets {
+		for _, status := range check.Statuses {
+			if status.Status != "OK" {
+				continue
+			}
+			operatorAgeSeconds.Set(cycle.End.Sub(status.LastUpdated).Seconds(), check.Ticket.ID, status.Name)
+			stale := 0.0
+			if isStale(check.Ticket, status, cycle.End) {
+				stale = 1
+			}
+			operatorStale.Set(stale, check.Ticket.ID, status.Name)
+			if status.BaseImage != nil && status.BaseImage.State != registry.Unknown {
+				outdated := 0.0
+				if status.BaseImage.State == registry.Outdated {
+					outdated = 1
+				}
+				operatorBaseOutdated.Set(outdated, check.Ticket.ID, status.Name)
+			}
+			if status.Scan != nil {
+				for _, sev := range registry.Severities {
+					operatorVulnerabilities.Set(float64(status.Scan.Counts[sev]), check.Ticket.ID, status.Name, sev)
+				}
+			}
+		}
+	}
+
+	pollerCyclesTotal.Inc()
+	pollerCycleDuration.Observe(cycle.End.Sub(cycle.Start).Seconds())
+	pollerLastCycle.Set(float64(cycle.End.Unix()))
+}
+
+func (p *Poller) setQueueDepth(n int) {
+	p.mu.Lock()
+	p.queueDepth = n
+	p.mu.Unlock()
+}
+
+// PollerStatus summarizes the poller's progress for the system status page
+type PollerStatus struct {
+	Interval    string     `json:"interval"`
+	LastCycle   *time.Time `json:"lastCycle,omitempty"`
+	LastSuccess *time.Time `json:"lastSuccess,omitempty"`
+	QueueDepth  int        `json:"queueDepth"`
+}
+
+func (p *Poller) Status() PollerStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	status := PollerStatus{Interval: p.interval.String(), QueueDepth: p.queueDepth}
+	if !p.lastCycle.IsZero() {
+		t := p.lastCycle
+		status.LastCycle = &t
+	}
+	if !p.lastSuccess.IsZero() {
+		t := p.lastSuccess
+		status.LastSuccess = &t
+	}
+	return status
+}
+
+// checkTicket fetches the ticket's statuses, publishes any state changes
+// and returns the statuses
+func (p *Poller) checkTicket(ticket JiraTicket) []OperatorStatus {
+	now := p.state.clock.Now()
+	statuses := api.TicketStatuses(registry.FreshClient{Client: p.quay}, ticket, localTime(now))
+
+	staleOps := make(map[string]bool, len(statuses))
+	digests := make(map[string]string, len(statuses))
+	for i := range statuses {
+		if statuses[i].Status != "OK" {
+			// Keep the last known state so a transient error doesn't re-fire events
+			if prev, ok := p.digests[ticket.ID][statuses[i].Name]; ok {
+				digests[statuses[i].Name] = prev
+			}
+			staleOps[statuses[i].Name] = p.stale[ticket.ID][statuses[i].Name]
+			continue
+		}
+
+		prev, known := p.digests[ticket.ID][statuses[i].Name]
+		if known && prev != statuses[i].SHA256 {
+			p.bus.PublishEvent(Event{
+				Type:     EventOperatorUpdated,
+				Ticket:   ticket,
+				Operator: &statuses[i],
+				Previous: prev,
+				Reason:   p.state.annotations.Reason(statuses[i].Name, statuses[i].SHA256),
+				Statuses: statuses,
+				Time:     now,
+			})
+		}
+		digests[statuses[i].Name] = statuses[i].SHA256
+
+		stale := isStale(ticket, statuses[i], now)
+		if stale && !p.stale[ticket.ID][statuses[i].Name] {
+			p.bus.PublishEvent(Event{
+				Type:     EventOperatorStale,
+				Ticket:   ticket,
+				Operator: &statuses[i],
+				Statuses: statuses,
+				Time:     now,
+			})
+		}
+		staleOps[statuses[i].Name] = stale
+	}
+	p.stale[ticket.ID] = staleOps
+	p.digests[ticket.ID] = digests
+
+	rebuilt := ticketRebuilt(ticket, statuses)
+	if rebuilt && !p.rebuilt[ticket.ID] {
+		p.bus.PublishEvent(Event{
+			Type:     EventTicketRebuilt,
+			Ticket:   ticket,
+			Statuses: statuses,
+			Time:     now,
+		})
+	}
+	p.rebuilt[ticket.ID] = rebuilt
+	return statuses
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"OpTrack/internal/api"
+	"OpTrack/internal/clock"
+	"OpTrack/internal/store"
+)
+
+var errNoUser = errors.New("saving preferences needs a user, from the auth.actorHeaders set by the reverse proxy")
+
+// TicketView is a user's default ticket list and status table
+type TicketView struct {
+	Owner     string   `json:"owner,omitempty"`
+	Project   string   `json:"project,omitempty"`
+	Labels    []string `json:"labels,omitempty"`
+	Archived  string   `json:"archived,omitempty"`  // "true" or "all"
+	Favorites bool     `json:"favorites,omitempty"` // Only the user's favorite tickets
+	Rollups   []string `json:"rollups,omitempty"`   // Tickets in any of these rollup states
+	Sort      string   `json:"sort,omitempty"`      // Status table column key
+	Order     string   `json:"order,omitempty"`     // "asc" or "desc"
+	Columns   []string `json:"columns,omitempty"`
+}
+
+// query returns the view as the query parameters it stands for
+func (v TicketView) query() url.Values {
+	q := url.Values{}
+	set := func(key, value string) {
+		if value != "" {
+			q.Set(key, value)
+		}
+	}
+	set("owner", v.Owner)
+	set("project", v.Project)
+	for _, label := range v.Labels {
+		q.Add("label", label)
+	}
+	set("archived", v.Archived)
+	if v.Favorites {
+		q.Set("favorites", "true")
+	}
+	for _, rollup := range v.Rollups {
+		q.Add("rollup", rollup)
+	}
+	set("sort", v.Sort)
+	set("order", v.Order)
+	set("columns", strings.Join(v.Columns, ","))
+	return q
+}
+
+// check checks the view's parameters mean something, cleaning up its labels
+func (v *TicketView) check() error {
+	labels, err := store.NormalizeLabels(v.Labels)
+	if err != nil {
+		return err
+	}
+	v.Labels = labels
+	if v.Archived != "" && v.Archived != "true" && v.Archived != "all" {
+		return fmt.Errorf("archived %q must be true or all", v.Archived)
+	}
+	for _, rollup := range v.Rollups {
+		if !slices.Contains(store.Rollups, rollup) {
+			return fmt.Errorf("rollup %q must be one of %s", rollup, strings.Join(store.Rollups, ", "))
+		}
+	}
+	_, err = parseTableOptions(v.query())
+	return err
+}
+
+// UserPreferences are what a user has saved for themselves
+type UserPreferences struct {
+	User      string     `json:"user"`
+	Favorites []string   `json:"favorites"` // Starred tickets, in the order they were starred
+	View      TicketView `json:"view"`
+	Updated   *time.Time `json:"updated,omitempty"`
+}
+
+// PreferenceStore keeps the preferences of every user in the settings
+// directory, by the actor of their requests
+type PreferenceStore struct {
+	mu    sync.RWMutex
+	path  string
+	users map[string]UserPreferences
+	clock clock.Clock
+}
+
+func NewPreferenceStore(dataDir string, clk clock.Clock) (*PreferenceStore, error) {
+	dir, err := store.SettingsDir(dataDir)
+	if err != nil {
+		return nil, err
+	}
+	s := &PreferenceStore{
+		path:  filepath.Join(dir, "user-preferences.json"),
+		users: make(map[string]UserPreferences),
+		clock: clk,
+	}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// load reads the preferences file, picking up changes other replicas made
+func (s *PreferenceStore) load() error {
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	users := make(map[string]UserPreferences)
+	if err := json.Unmarshal(data, &users); err != nil {
+		return fmt.Errorf("failed to parse %s: %v", s.path, err)
+	}
+	s.mu.Lock()
+	s.users = users
+	s.mu.Unlock()
+	return nil
+}
+
+// Get returns a user's preferences
+func (s *PreferenceStore) Get(user string) UserPreferences {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	prefs, ok := s.users[user]
+	if !ok {
+		prefs = UserPreferences{User: user}
+	}
+	prefs.Favorites = append([]string{}, prefs.Favorites...)
+	return prefs
+}
+
+// update changes a user's preferences with fn and saves them, returning them
+func (s *PreferenceStore) update(user string, fn func(*UserPreferences)) (UserPreferences, error) {
+	if user == anonymousActor {
+		return UserPreferences{}, errNoUser
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	old, existed := s.users[user]
+	prefs := old
+	prefs.User = user
+	prefs.Favorites = slices.Clone(old.Favorites)
+	fn(&prefs)
+	now := s.clock.Now()
+	prefs.Updated = &now
+	s.users[user] = prefs
+	if err := s.save(); err != nil {
+		if existed {
+			s.users[user] = old
+		} else {
+			delete(s.users, user)
+		}
+		return UserPreferences{}, err
+	}
+	return prefs, nil
+}
+
+// SetView replaces a user's default view
+func (s *PreferenceStore) SetView(user string, view TicketView) (UserPreferences, error) {
+	return s.update(user, func(p *UserPreferences) { p.View = view })
+}
+
+// Star adds a ticket to a user's favorites, or with starred unset removes it
+func (s *PreferenceStore) Star(user, ticket string, starred bool) (UserPreferences, error) {
+	return s.update(user, func(p *UserPreferences) {
+		i := slices.Index(p.Favorites, ticket)
+		switch {
+		case starred && i < 0:
+			p.Favorites = append(p.Favorites, ticket)
+		case !starred && i >= 0:
+			p.Favorites = slices.Delete(p.Favorites, i, i+1)
+		}
+	})
+}
+
+// deleteTicket removes a deleted ticket from everyone's favorites, so a
+// ticket created later with its ID isn't starred
+func (s *PreferenceStore) deleteTicket(ticket string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	old := make(map[string]UserPreferences)
+	for user, prefs := range s.users {
+		if i := slices.Index(prefs.Favorites, ticket); i >= 0 {
+			old[user] = prefs
+			prefs.Favorites = slices.Delete(slices.Clone(prefs.Favorites), i, i+1)
+			s.users[user] = prefs
+		}
+	}
+	if len(old) == 0 {
+		return nil
+	}
+	if err := s.save(); err != nil {
+		for user, prefs := range old {
+			s.users[user] = prefs
+		}
+		return err
+	}
+	return nil
+}
+
+// save writes the preferences file. The caller holds s.mu.
+func (s *PreferenceStore) save() error {
+	data, err := json.MarshalIndent(s.users, "", "    ")
+	if err != nil {
+		return err
+	}
+	if err := store.WriteFileAtomic(s.path, data, 0644); err != nil {
+		return fmt.Errorf("%w: failed to save user preferences: %v", store.ErrStorage, err)
+	}
+	return nil
+}
+
+// Favorites returns the tickets the request's user starred, for api.Handler
+func (s *PreferenceStore) Favorites(r *http.Request) []string {
+	return s.Get(requestActor(r)).Favorites
+}
+
+// DefaultView returns the query parameters of the request's user's default
+// view, for api.Handler. Anonymous requests have none.
+func (s *PreferenceStore) DefaultView(r *http.Request) url.Values {
+	user := requestActor(r)
+	if user == anonymousActor {
+		return nil
+	}
+	return s.Get(user).View.query()
+}
+
+// writePreferences answers with a user's preferences, or the error saving them
+func writePreferences(w http.ResponseWriter, r *http.Request, prefs UserPreferences, err error) {
+	switch {
+	case errors.Is(err, errNoUser):
+		httpError(w, r, err.Error(), http.StatusUnauthorized)
+	case err != nil:
+		requestLogger(r).Error("Failed to save user preferences", "error", err)
+		api.WriteError(w, requestID(r), err)
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(prefs)
+	}
+}
+
+// handleGet returns the preferences of the request's user at
+// GET /api/v1/me/preferences
+func (s *PreferenceStore) handleGet(w http.ResponseWriter, r *http.Request) {
+	writePreferences(w, r, s.Get(requestActor(r)), nil)
+}
+
+// handlePutView saves the default view of the request's user at
+// PUT /api/v1/me/preferences, from a body of {"view": {...}}
+func (s *PreferenceStore) handlePutView(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		View TicketView `json:"view"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := req.View.check(); err != nil {
+		if status, _ := api.ErrorStatus(err); status == http.StatusInternalServerError {
+			httpError(w, r, err.Error(), http.StatusBadRequest)
+		} else {
+			api.WriteError(w, requestID(r), err)
+		}
+		return
+	}
+	prefs, err := s.SetView(requestActor(r), req.View)
+	writePreferences(w, r, prefs, err)
+}
+
+// handleStar stars a ticket for the request's user at
+// PUT /api/v1/me/favorites/{id}, or unstars it with DELETE
+func (s *PreferenceStore) handleStar(state *AppState, starred bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		if _, ok := state.Get(id); !ok && starred {
+			api.WriteError(w, requestID(r), store.ErrTicketNotFound)
+			return
+		}
+		prefs, err := s.Star(requestActor(r), id, starred)
+		writePreferences(w, r, prefs, err)
+	}
+}
@@ -0,0 +1,14 @@
+//go:build plan9
+
+package main
+
+import (
+	"os"
+	"strconv"
+)
+
+// processRunning reports whether a process with the given ID exists
+func processRunning(pid int) bool {
+	_, err := os.Stat("/proc/" + strconv.Itoa(pid))
+	return err == nil
+}
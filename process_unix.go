@@ -0,0 +1,19 @@
+//go:build !windows && !plan9
+
+package main
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// processRunning reports whether a process with the given ID exists
+func processRunning(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	err = p.Signal(syscall.Signal(0))
+	return err == nil || errors.Is(err, syscall.EPERM) // EPERM: running as another user
+}
@@ -0,0 +1,372 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"OpTrack/internal/api"
+	"OpTrack/internal/router"
+	"OpTrack/internal/store"
+)
+
+// ProjectConfig is a project tickets can belong to, so teams sharing one
+// deployment only see their own tickets. Members are user names as taken from
+// auth.actorHeaders, group:<name> for a group in auth.groupsHeader, or * for
+// everyone. A project without viewers and editors is open to everyone.
+type ProjectConfig struct {
+	Name        string   `yaml:"name"`
+	Description string   `yaml:"description"`
+	Viewers     []string `yaml:"viewers"` // May see the project's tickets
+	Editors     []string `yaml:"editors"` // May also change them and add new ones
+}
+
+// projectRole is what a user may do with the tickets of a project
+type projectRole int
+
+const (
+	roleNone projectRole = iota
+	roleViewer
+	roleEditor
+)
+
+func (r projectRole) String() string {
+	switch r {
+	case roleViewer:
+		return "viewer"
+	case roleEditor:
+		return "editor"
+	}
+	return "none"
+}
+
+// projectList is the configured projects and how users and their groups are
+// read from requests
+type projectList struct {
+	projects     map[string]ProjectConfig
+	groupsHeader string
+	adminToken   string
+}
+
+// projectAccess is replaced by config reloads; nil has no projects
+var projectAccess atomic.Pointer[projectList]
+
+func newProjectList(projects []ProjectConfig, groupsHeader, adminToken string) *projectList {
+	l := &projectList{projects: make(map[string]ProjectConfig), groupsHeader: groupsHeader, adminToken: adminToken}
+	for _, p := range projects {
+		l.projects[p.Name] = p
+	}
+	return l
+}
+
+// role returns what the user of a request may do with the tickets of a
+// project. Tickets without a project, requests with the admin token and
+// requests made from inside OpTrack, with r nil, may do anything. Tickets of
+// a project that is no longer configured are only seen with the admin token.
+func (l *projectList) role(r *http.Request, project string) projectRole {
+	if project == "" || r == nil || l.isAdmin(r) {
+		return roleEditor
+	}
+	var groups []string
+	if l != nil && l.groupsHeader != "" {
+		groups = splitList(r.Header.Get(l.groupsHeader))
+	}
+	return l.roleOf(requestActor(r), groups, project)
+}
+
+// roleOf returns what a user, in groups, may do with the tickets of a project
+func (l *projectList) roleOf(user string, groups []string, project string) projectRole {
+	if project == "" {
+		return roleEditor
+	}
+	if l == nil {
+		return roleNone
+	}
+	p, ok := l.projects[project]
+	switch {
+	case !ok:
+		return roleNone
+	case len(p.Viewers) == 0 && len(p.Editors) == 0:
+		return roleEditor
+	case isMember(user, groups, p.Editors):
+		return roleEditor
+	case isMember(user, groups, p.Viewers):
+		return roleViewer
+	}
+	return roleNone
+}
+
+// isAdmin reports whether a request has the admin token as a bearer token
+func (l *projectList) isAdmin(r *http.Request) bool {
+	return l != nil && l.adminToken != "" && hasBearerToken(r, l.adminToken)
+}
+
+// isMember reports whether a user, or one of their groups, is among members
+func isMember(user string, groups []string, members []string) bool {
+	for _, member := range members {
+		if group, ok := strings.CutPrefix(member, "group:"); ok {
+			if slices.Contains(groups, group) {
+				return true
+			}
+		} else if member == "*" || (user != anonymousActor && strings.EqualFold(member, user)) {
+			return true
+		}
+	}
+	return false
+}
+
+// check fails with store.ErrUnknownProject for projects that aren't configured
+func (l *projectList) check(project string) error {
+	if project == "" {
+		return nil
+	}
+	if l != nil {
+		if _, ok := l.projects[project]; ok {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w %q, use one of: %s", store.ErrUnknownProject, project, strings.Join(l.names(), ", "))
+}
+
+// names returns the names of the configured projects, sorted
+func (l *projectList) names() []string {
+	if l == nil {
+		return nil
+	}
+	names := make([]string, 0, len(l.projects))
+	for name := range l.projects {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// checkProject checks the project a ticket is moved to, or created in, is
+// configured. Tickets staying in a project that was removed can still be
+// changed by those who can see them.
+func checkProject(ticket JiraTicket, old *JiraTicket) error {
+	if old != nil && old.Project == ticket.Project {
+		return nil
+	}
+	return projectAccess.Load().check(ticket.Project)
+}
+
+// canView reports whether the user of a request may see the tickets of a project
+func canView(r *http.Request, project string) bool {
+	return projectAccess.Load().role(r, project) >= roleViewer
+}
+
+// userCanView reports whether a user, named rather than making a request, may
+// see the tickets of a project. Groups are only known from requests, so only
+// direct membership counts.
+func userCanView(user, project string) bool {
+	return projectAccess.Load().roleOf(user, nil, project) >= roleViewer
+}
+
+// canEdit reports whether the user of a request may change the tickets of a project
+func canEdit(r *http.Request, project string) bool {
+	return projectAccess.Load().role(r, project) == roleEditor
+}
+
+// checkEdit fails unless the user of a request may change the tickets of a
+// project, with store.ErrUnknownProject when it isn't configured
+func checkEdit(r *http.Request, project string) error {
+	if canEdit(r, project) {
+		return nil
+	}
+	if err := projectAccess.Load().check(project); err != nil {
+		return err
+	}
+	return fmt.Errorf("%w %s", store.ErrForbidden, project)
+}
+
+// ticketAccess is the api.Access of the configured projects
+type ticketAccess struct{}
+
+func (ticketAccess) CanView(r *http.Request, project string) bool    { return canView(r, project) }
+func (ticketAccess) CheckEdit(r *http.Request, project string) error { return checkEdit(r, project) }
+
+// visibleTickets returns the tickets the user of a request may see
+func visibleTickets(r *http.Request, tickets map[string]JiraTicket) map[string]JiraTicket {
+	visible := make(map[string]JiraTicket, len(tickets))
+	for id, ticket := range tickets {
+		if canView(r, ticket.Project) {
+			visible[id] = ticket
+		}
+	}
+	return visible
+}
+
+// canViewID reports whether the user of a request may see the ticket with an
+// ID. The project of a ticket that was deleted is unknown, so with projects
+// configured only the admin token sees it.
+func canViewID(r *http.Request, state *AppState, id string) bool {
+	if ticket, ok := state.Get(id); ok {
+		return canView(r, ticket.Project)
+	}
+	access := projectAccess.Load()
+	return r == nil || len(access.names()) == 0 || access.isAdmin(r)
+}
+
+// visibleIDs returns the IDs of the tickets the user of a request may see
+func visibleIDs(r *http.Request, state *AppState, ids []string) []string {
+	visible := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if canViewID(r, state, id) {
+			visible = append(visible, id)
+		}
+	}
+	return visible
+}
+
+// projectRouter registers every route with a check of the ticket the request
+// names, in the id or ticket path or query parameter: tickets the user can't
+// see are answered as not found, and changes to tickets they can only see
+// are forbidden. Changes that name the ticket in their body check it themselves.
+type projectRouter struct {
+	router.Router
+	state *AppState
+}
+
+func (m projectRouter) Handle(pattern string, handler http.Handler) {
+	m.Router.Handle(pattern, guardTicket(m.state, handler))
+}
+
+func (m projectRouter) HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request)) {
+	m.Handle(pattern, http.HandlerFunc(handler))
+}
+
+// guardTicket checks the user of a request may see the ticket it names, and
+// change it unless the request only reads it
+func guardTicket(state *AppState, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ticket, ok := state.Get(requestTicket(r))
+		if ok {
+			var err error
+			switch role := projectAccess.Load().role(r, ticket.Project); {
+			case role == roleNone:
+				err = store.ErrTicketNotFound
+			case role == roleViewer && !readsTicket(r):
+				err = fmt.Errorf("%w %s", store.ErrForbidden, ticket.Project)
+			}
+			if err != nil {
+				if strings.HasPrefix(r.URL.Path, "/api/") {
+					api.WriteError(w, requestID(r), err)
+				} else {
+					status, _ := api.ErrorStatus(err)
+					httpError(w, r, err.Error(), status)
+				}
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requestTicket returns the ID of the ticket a request names, if any
+func requestTicket(r *http.Request) string {
+	for _, name := range []string{"id", "ticket"} {
+		if id := r.PathValue(name); id != "" {
+			return id
+		}
+		if id := r.URL.Query().Get(name); id != "" {
+			return id
+		}
+	}
+	return ""
+}
+
+// readsTicket reports whether a request only reads the ticket it names, or
+// changes something of the user's own, like their favorites or subscriptions
+func readsTicket(r *http.Request) bool {
+	return r.Method == "GET" || r.Method == "HEAD" ||
+		strings.HasPrefix(r.URL.Path, "/api/v1/me/") || r.URL.Path == "/api/subscriptions"
+}
+
+// projectInfo is a project as answered by /api/v1/projects
+type projectInfo struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Role        string `json:"role"`
+	Tickets     int    `json:"tickets"`
+}
+
+// projectInfos returns the projects the user of a request can see, sorted
+// by name
+func projectInfos(r *http.Request, tickets map[string]JiraTicket) []projectInfo {
+	l := projectAccess.Load()
+	counts := make(map[string]int)
+	for _, ticket := range tickets {
+		counts[ticket.Project]++
+	}
+	infos := []projectInfo{}
+	for _, name := range l.names() {
+		role := l.role(r, name)
+		if role == roleNone {
+			continue
+		}
+		p := l.projects[name]
+		infos = append(infos, projectInfo{Name: p.Name, Description: p.Description, Role: role.String(), Tickets: counts[name]})
+	}
+	return infos
+}
+
+// handleProjects lists the projects the user can see at GET /api/v1/projects
+func handleProjects(state *AppState) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(projectInfos(r, state.List()))
+	}
+}
+
+// handleProject returns one project at GET /api/v1/projects/{project}.
+// Projects the user can't see are answered as not found.
+func handleProject(state *AppState) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("project")
+		for _, info := range projectInfos(r, state.List()) {
+			if info.Name == name {
+				w.Header().Set("Content-Type", "application/json")
+				json.NewEncoder(w).Encode(info)
+				return
+			}
+		}
+		api.WriteError(w, requestID(r), store.ErrProjectNotFound)
+	}
+}
+
+func newProjectsCommand(opts *cliOptions) *cobra.Command {
+	return &cobra.Command{
+		Use:   "projects",
+		Short: "List the projects you can see, with your role in each",
+		Long: `List the projects you can see, with your role in each and how many tickets
+they have. Viewers may see a project's tickets; editors may also change them.
+Run against the local data directory, every project is listed with the editor role.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			backend, err := opts.backend()
+			if err != nil {
+				return err
+			}
+			projects, err := backend.Projects()
+			if err != nil {
+				return fmt.Errorf("failed to list projects: %v", err)
+			}
+			return opts.printer(cmd).print(projects, func(bool) {
+				tw := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+				fmt.Fprintln(tw, "PROJECT\tROLE\tTICKETS\tDESCRIPTION")
+				for _, p := range projects {
+					fmt.Fprintf(tw, "%s\t%s\t%d\t%s\n", p.Name, p.Role, p.Tickets, p.Description)
+				}
+				tw.Flush()
+			})
+		},
+	}
+}
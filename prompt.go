@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// prompter asks for missing command arguments on an interactive terminal
+type prompter struct {
+	in  *bufio.Reader
+	out io.Writer
+}
+
+func newPrompter(in io.Reader, out io.Writer) *prompter {
+	return &prompter{in: bufio.NewReader(in), out: out}
+}
+
+// isTerminal reports whether stdin or stdout is an interactive terminal rather
+// than a pipe or file
+func isTerminal(stream interface{}) bool {
+	f, ok := stream.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// ask prints label and returns the trimmed answer, asking again until
+// validate accepts it
+func (p *prompter) ask(label string, validate func(string) error) (string, error) {
+	for {
+		fmt.Fprintf(p.out, "%s: ", label)
+		line, err := p.in.ReadString('\n')
+		if err != nil && (err != io.EOF || line == "") {
+			return "", fmt.Errorf("no answer for %s", strings.ToLower(label))
+		}
+		answer := strings.TrimSpace(line)
+		if validate == nil {
+			return answer, nil
+		}
+		if err := validate(answer); err != nil {
+			fmt.Fprintf(p.out, "  %v\n", err)
+			continue
+		}
+		return answer, nil
+	}
+}
+
+// required rejects empty answers
+func required(answer string) error {
+	if answer == "" {
+		return fmt.Errorf("a value is required")
+	}
+	return nil
+}
+
+// validOperatorList accepts one or more namespace/repository names separated by commas or spaces
+func validOperatorList(answer string) error {
+	operators := splitOperators(answer)
+	if len(operators) == 0 {
+		return fmt.Errorf("enter at least one operator")
+	}
+	for _, op := range operators {
+		if parts := strings.Split(op, "/"); len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return fmt.Errorf("%q is not in namespace/repository format", op)
+		}
+	}
+	return nil
+}
+
+func splitOperators(answer string) []string {
+	return strings.FieldsFunc(answer, func(r rune) bool { return r == ',' || r == ' ' })
+}
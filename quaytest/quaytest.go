@@ -0,0 +1,255 @@
+// Package quaytest provides a fake Quay.io registry API serving canned tag
+// responses, with controllable latency and failures. OpTrack uses it for
+// --mock-registry mode, and tests can run it with NewServer.
+package quaytest
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Tag is one image tag of a repository
+type Tag struct {
+	Name         string
+	LastModified time.Time
+	Digest       string            // sha256 hex digest, without the "sha256:" prefix
+	Labels       map[string]string // Served for the digest, e.g. vcs-ref
+	Expired      bool              // The tag has moved away; only its manifest is still served
+}
+
+// Registry serves GET /api/v1/repository/<namespace>/<repository>/tag/,
+// .../manifest/sha256:<digest> and .../manifest/sha256:<digest>/labels like Quay.io. Repositories without canned tags get generated ones, unless
+// generation is switched off.
+type Registry struct {
+	mu          sync.Mutex
+	repos       map[string][]Tag
+	failures    map[string]int // repository -> HTTP status to fail with
+	generate    bool
+	latency     time.Duration
+	failureRate float64
+	rand        *rand.Rand
+	requests    int
+	now         func() time.Time
+}
+
+// NewRegistry returns a registry that generates tags for every repository
+func NewRegistry() *Registry {
+	return &Registry{
+		repos:    make(map[string][]Tag),
+		failures: make(map[string]int),
+		generate: true,
+		rand:     rand.New(rand.NewSource(1)),
+		now:      time.Now,
+	}
+}
+
+// SetTags replaces the tags of a repository, given as "namespace/repository"
+func (r *Registry) SetTags(repo string, tags ...Tag) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.repos[repo] = tags
+}
+
+// Fail makes requests for a repository return status, or succeed again when status is 0
+func (r *Registry) Fail(repo string, status int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if status == 0 {
+		delete(r.failures, repo)
+		return
+	}
+	r.failures[repo] = status
+}
+
+// SetGenerate controls whether unknown repositories get generated tags or a 404
+func (r *Registry) SetGenerate(generate bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.generate = generate
+}
+
+// SetLatency delays every response by d
+func (r *Registry) SetLatency(d time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.latency = d
+}
+
+// SetFailureRate makes a random fraction of requests, between 0 and 1, fail with a 503.
+// The sequence of failures is the same for the same seed.
+func (r *Registry) SetFailureRate(rate float64, seed int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.failureRate = rate
+	r.rand = rand.New(rand.NewSource(seed))
+}
+
+// SetClock sets the time generated tags are relative to
+func (r *Registry) SetClock(now func() time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.now = now
+}
+
+// Requests returns the number of requests served
+func (r *Registry) Requests() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.requests
+}
+
+// tagResponse is the subset of the Quay.io tag list response OpTrack reads
+type tagResponse struct {
+	Tags []tagJSON `json:"tags"`
+}
+
+type tagJSON struct {
+	Name           string `json:"name"`
+	LastModified   string `json:"last_modified"`
+	ManifestDigest string `json:"manifest_digest"`
+}
+
+// labelJSON is one label of the Quay.io manifest labels response
+type labelJSON struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	repo, digest, labels, ok := repositoryFromPath(req.URL.Path)
+	if !ok || req.Method != "GET" {
+		http.NotFound(w, req)
+		return
+	}
+
+	r.mu.Lock()
+	r.requests++
+	latency := r.latency
+	status := r.failures[repo]
+	if status == 0 && r.failureRate > 0 && r.rand.Float64() < r.failureRate {
+		status = http.StatusServiceUnavailable
+	}
+	tags, known := r.repos[repo]
+	if !known && r.generate {
+		tags, known = generatedTags(repo, r.now()), true
+	}
+	r.mu.Unlock()
+
+	if latency > 0 {
+		select {
+		case <-time.After(latency):
+		case <-req.Context().Done():
+			return
+		}
+	}
+	if status != 0 {
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+	if !known {
+		http.Error(w, `{"error_message": "Not Found"}`, http.StatusNotFound)
+		return
+	}
+
+	if labels {
+		list := []labelJSON{}
+		for _, t := range tags {
+			if t.Digest != digest {
+				continue
+			}
+			for k, v := range t.Labels {
+				list = append(list, labelJSON{Key: k, Value: v})
+			}
+			break
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string][]labelJSON{"labels": list})
+		return
+	}
+	if digest != "" {
+		for _, t := range tags {
+			if t.Digest == digest {
+				w.Header().Set("Content-Type", "application/json")
+				json.NewEncoder(w).Encode(map[string]string{"digest": "sha256:" + digest})
+				return
+			}
+		}
+		http.Error(w, `{"error_message": "Not Found"}`, http.StatusNotFound)
+		return
+	}
+
+	resp := tagResponse{Tags: []tagJSON{}}
+	for _, t := range tags {
+		if t.Expired {
+			continue
+		}
+		resp.Tags = append(resp.Tags, tagJSON{
+			Name:           t.Name,
+			LastModified:   t.LastModified.UTC().Format(time.RFC1123Z),
+			ManifestDigest: "sha256:" + t.Digest,
+		})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// repositoryFromPath extracts "namespace/repository" from a tag list path,
+// and the digest from a manifest or manifest labels path
+func repositoryFromPath(path string) (repo, digest string, labels, ok bool) {
+	rest, ok := strings.CutPrefix(path, "/api/v1/repository/")
+	if !ok {
+		return "", "", false, false
+	}
+	if name, manifest, found := strings.Cut(rest, "/manifest/sha256:"); found {
+		digest, labels = strings.CutSuffix(manifest, "/labels")
+		if digest == "" || strings.Contains(digest, "/") {
+			return "", "", false, false
+		}
+		rest = name
+	} else if rest, ok = strings.CutSuffix(rest, "/tag/"); !ok {
+		return "", "", false, false
+	}
+	parts := strings.Split(rest, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", false, false
+	}
+	return rest, digest, labels, true
+}
+
+// generatedTags returns the same plausible tags for a repository every time:
+// the latest image is between 0 and 60 days old, so a set of repositories
+// shows a mix of fresh, aging and stale operators
+func generatedTags(repo string, now time.Time) []Tag {
+	sum := sha256.Sum256([]byte(repo))
+	age := time.Duration(binary.BigEndian.Uint32(sum[:4])%(60*24)) * time.Hour
+
+	latest := now.Add(-age).Truncate(time.Hour)
+	previous := sha256.Sum256(append(sum[:], 1))
+	expired := sha256.Sum256(append(sum[:], 2))
+	return []Tag{
+		{Name: "latest", LastModified: latest, Digest: hex.EncodeToString(sum[:])},
+		{Name: "v0.1.0", LastModified: latest.Add(-14 * 24 * time.Hour), Digest: hex.EncodeToString(previous[:])},
+		{Name: "v0.0.9", LastModified: latest.Add(-28 * 24 * time.Hour), Digest: hex.EncodeToString(expired[:]), Expired: true},
+	}
+}
+
+// Server is a Registry running on a local httptest server
+type Server struct {
+	*Registry
+	*httptest.Server
+}
+
+// NewServer starts a registry for tests; point the Quay URL at its URL field
+// and Close it when done
+func NewServer() *Server {
+	registry := NewRegistry()
+	return &Server{Registry: registry, Server: httptest.NewServer(registry)}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"OpTrack/internal/bundle"
+	"OpTrack/internal/manifests"
+	"OpTrack/internal/store"
+)
+
+// BundlesConfig is how operator bundle images are pulled for their related
+// images. Registries are asked anonymously unless a username is set.
+type BundlesConfig struct {
+	Username string   `yaml:"username"` // e.g. a Quay robot account
+	Password string   `yaml:"password"`
+	Timeout  Duration `yaml:"timeout"`
+}
+
+func newBundleClient(cfg BundlesConfig, traffic quayTraffic) *bundle.Client {
+	return bundle.NewClient(traffic.ociClient(cfg.Username, cfg.Password, cfg.Timeout))
+}
+
+func newTicketRelatedCommand(opts *cliOptions) *cobra.Command {
+	var (
+		image      string
+		file       string
+		registries []string
+		dryRun     bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "related <ticket>",
+		Short: "Add the related images of an operator bundle to a ticket",
+		Long: `Add the related images of an operator bundle to a ticket, so the operand
+images are tracked alongside the operator.
+
+The ClusterServiceVersion is read from the --bundle image, or from a CSV file
+with --file. Its relatedImages, containerImage annotation, deployment images
+and RELATED_IMAGE_ environment variables on the --registry registries are
+added to the ticket; operators already on it are kept.`,
+		Example:           "  optrack ticket related OSD-1234 --bundle quay.io/app-sre/foo-bundle:v1.2.3\n  optrack ticket related OSD-1234 -f bundle/manifests/foo.clusterserviceversion.yaml --dry-run",
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeFirstTicket(opts),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var csv io.Reader
+			switch {
+			case (image == "") == (file == ""):
+				return errors.New("set either --bundle or --file")
+			case image != "":
+				data, err := newBundleClient(opts.cfg.Bundles, newQuayTraffic(opts.cfg.Quay, opts.clock)).CSV(cmd.Context(), image)
+				if err != nil {
+					return fmt.Errorf("failed to read %s: %v", image, err)
+				}
+				csv = bytes.NewReader(data)
+			case file == "-":
+				csv = cmd.InOrStdin()
+			default:
+				f, err := os.Open(file)
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+				csv = f
+			}
+
+			res, err := manifests.Import(csv, registries)
+			if errors.Is(err, manifests.ErrNoImages) {
+				return fmt.Errorf("no related images on %s found", strings.Join(registries, ", "))
+			}
+			if err != nil {
+				return fmt.Errorf("failed to read the ClusterServiceVersion: %v", err)
+			}
+
+			backend, err := opts.backend()
+			if err != nil {
+				return err
+			}
+			ticket, err := findTicket(backend, args[0])
+			if err != nil {
+				return err
+			}
+			_, added := manifests.Merge(ticket.OperatorNames(), res)
+			ticket.Operators = append(slices.Clone(ticket.Operators), store.OperatorsNamed(added)...)
+			if !dryRun && len(added) > 0 {
+				if ticket, err = backend.SaveTicket(ticket); err != nil {
+					return fmt.Errorf("failed to save ticket: %v", err)
+				}
+			}
+
+			related := struct {
+				Ticket JiraTicket        `json:"ticket"`
+				Added  []string          `json:"added"`
+				Images []manifests.Image `json:"images"`
+			}{ticket, append([]string{}, added...), res.Images}
+			return opts.printer(cmd).print(related, func(bool) {
+				out := cmd.OutOrStdout()
+				printImportedImages(out, res.Images)
+				verb := "Added"
+				if dryRun {
+					verb = "Would add"
+				}
+				fmt.Fprintf(out, "\n%s %d operators to %s, %d already tracked\n", verb, len(added), ticket.ID, len(res.Operators)-len(added))
+			})
+		},
+	}
+
+	cmd.Flags().StringVar(&image, "bundle", "", "Bundle image to read the ClusterServiceVersion from, e.g. quay.io/app-sre/foo-bundle:v1.2.3")
+	cmd.Flags().StringVarP(&file, "file", "f", "", "ClusterServiceVersion file to read instead, - for stdin")
+	cmd.Flags().StringSliceVar(&registries, "registry", []string{manifests.DefaultRegistry}, "Registry whose images are tracked; repeatable")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show the operators that would be added without saving the ticket")
+	return cmd
+}
+
+// findTicket returns one ticket through a backend that can only list them
+func findTicket(backend Backend, id string) (JiraTicket, error) {
+	tickets, err := backend.ListTickets()
+	if err != nil {
+		return JiraTicket{}, err
+	}
+	for _, t := range tickets {
+		if t.ID == id {
+			return t, nil
+		}
+	}
+	return JiraTicket{}, fmt.Errorf("ticket %s not found", id)
+}
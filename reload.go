@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"reflect"
+	"sync"
+	"syscall"
+
+	"OpTrack/internal/policy"
+)
+
+// Reloader re-reads the configuration on SIGHUP or through the admin API and
+// applies what can change at runtime: thresholds, auth settings, notification
+// rules, notification credentials, the compliance policy and the owners file.
+// Tickets and poller state are untouched.
+type Reloader struct {
+	load func() (*Config, error)
+
+	mu      sync.Mutex
+	current *Config
+
+	audit         *AuditLog
+	rules         *RuleStore
+	policy        *policy.Checker // Nil without a policy
+	dispatcher    *Dispatcher
+	optOuts       *OptOutStore
+	subscriptions *SubscriptionStore
+	inventory     *InventoryStore
+	slackCommands *SlackCommandHandler
+}
+
+// Reload loads and applies the configuration. An invalid configuration is
+// rejected as a whole and the running settings are kept.
+func (rl *Reloader) Reload() error {
+	cfg, err := rl.load()
+	if err != nil {
+		return err
+	}
+	if err := rl.rules.Reload(); err != nil {
+		return err
+	}
+	if rl.policy != nil {
+		if err := rl.policy.Reload(); err != nil {
+			return err
+		}
+	}
+	owners, err := readOwnersFile(cfg.Owners.File)
+	if err != nil {
+		return err
+	}
+
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	for _, setting := range restartRequired(rl.current, cfg) {
+		slog.Warn("Configuration change needs a restart to take effect", "setting", setting)
+	}
+
+	cfg.apply()
+	if err := importOwnersFile(rl.inventory, cfg.Owners.File, owners); err != nil {
+		slog.Error("Failed to import the owners file", "error", err)
+	}
+	rl.dispatcher.SetNotifiers(buildNotifiers(cfg.Notifications, cfg.Plugins.Notifiers, rl.optOuts, rl.subscriptions, rl.inventory))
+	rl.slackCommands.SetSigningSecret(cfg.Notifications.Slack.SigningSecret)
+	rl.current = cfg
+
+	slog.Info("Configuration reloaded", "channels", rl.dispatcher.Channels())
+	return nil
+}
+
+// restartRequired lists the settings that differ but are only read at startup
+func restartRequired(old, new *Config) []string {
+	var changed []string
+	if old.Listen != new.Listen {
+		changed = append(changed, "listen")
+	}
+	if normalizeBasePath(old.BasePath) != normalizeBasePath(new.BasePath) {
+		changed = append(changed, "basePath")
+	}
+	if old.DataDir != new.DataDir {
+		changed = append(changed, "dataDir")
+	}
+	if old.TemplatesDir != new.TemplatesDir {
+		changed = append(changed, "templatesDir")
+	}
+	if old.PollInterval != new.PollInterval {
+		changed = append(changed, "pollInterval")
+	}
+	if old.ShutdownTimeout != new.ShutdownTimeout {
+		changed = append(changed, "shutdownTimeout")
+	}
+	if old.Quay != new.Quay {
+		changed = append(changed, "quay")
+	}
+	if !reflect.DeepEqual(old.Plugins.Registry, new.Plugins.Registry) {
+		changed = append(changed, "plugins.registry")
+	}
+	if !reflect.DeepEqual(old.Clusters, new.Clusters) {
+		changed = append(changed, "clusters")
+	}
+	if !reflect.DeepEqual(old.Catalogs, new.Catalogs) {
+		changed = append(changed, "catalogs")
+	}
+	if !reflect.DeepEqual(old.SaasFiles, new.SaasFiles) {
+		changed = append(changed, "saasFiles")
+	}
+	if !reflect.DeepEqual(old.GitHub, new.GitHub) {
+		changed = append(changed, "github")
+	}
+	if !reflect.DeepEqual(old.CI, new.CI) {
+		changed = append(changed, "ci")
+	}
+	if !reflect.DeepEqual(old.Builds, new.Builds) {
+		changed = append(changed, "builds")
+	}
+	if old.Bundles != new.Bundles {
+		changed = append(changed, "bundles")
+	}
+	if !reflect.DeepEqual(old.Signatures, new.Signatures) {
+		changed = append(changed, "signatures")
+	}
+	if old.Policy != new.Policy {
+		changed = append(changed, "policy")
+	}
+	if !reflect.DeepEqual(old.BaseImages, new.BaseImages) {
+		changed = append(changed, "baseImages")
+	}
+	if old.Scans != new.Scans {
+		changed = append(changed, "scans")
+	}
+	if old.ArgoCD != new.ArgoCD {
+		changed = append(changed, "argocd")
+	}
+	if old.Controller != new.Controller {
+		changed = append(changed, "controller")
+	}
+	if old.LeaderElection != new.LeaderElection {
+		changed = append(changed, "leaderElection")
+	}
+	if !reflect.DeepEqual(old.HTTP, new.HTTP) {
+		changed = append(changed, "http")
+	}
+	return changed
+}
+
+// WatchSignals reloads the configuration whenever the process receives SIGHUP
+func (rl *Reloader) WatchSignals() {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGHUP)
+	for range sig {
+		if err := rl.Reload(); err != nil {
+			slog.Error("Failed to reload configuration", "error", err)
+			continue
+		}
+		rl.audit.RecordAs("signal:SIGHUP", nil, "config.reload", "", nil)
+	}
+}
+
+// adminToken returns the current bearer token for the admin API
+func (rl *Reloader) adminToken() string {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	return rl.current.Auth.AdminToken
+}
+
+// handleReload reloads the configuration. It is served behind requireAdminToken.
+func (rl *Reloader) handleReload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		httpError(w, r, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := rl.Reload(); err != nil {
+		requestLogger(r).Error("Failed to reload configuration", "error", err)
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	rl.audit.Record(r, "config.reload", "", nil)
+
+	json.NewEncoder(w).Encode(map[string]interface{}{"channels": rl.dispatcher.Channels()})
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+
+	"OpTrack/internal/api"
+	"OpTrack/internal/registry"
+	"OpTrack/internal/store"
+)
+
+// OperatorRename is what renaming an operator changed, or would change on
+// a dry run
+type OperatorRename struct {
+	From    string   `json:"from"`
+	To      string   `json:"to"`
+	DryRun  bool     `json:"dryRun,omitempty"`
+	Tickets []string `json:"tickets"` // Tickets tracking the operator, archived ones included
+	Groups  []string `json:"groups"`  // Groups with the operator among their members
+	// Baselines are the digests kept by ticket, for the tickets on which the
+	// operator wasn't rebuilt yet
+	Baselines map[string]string `json:"baselines"`
+	// Unbaselined are tickets without a baseline because the operator's
+	// latest digest couldn't be looked up, so images under the new name may
+	// count as rebuilt on them
+	Unbaselined []string `json:"unbaselined,omitempty"`
+	// Inventory is whether the new name takes over the team, contact,
+	// criticality and source repository of the old one in the inventory
+	Inventory bool `json:"inventory,omitempty"`
+}
+
+// renameOperator rewrites an operator to another name on every ticket and
+// group, for repositories that were renamed or moved to another namespace.
+// Tickets keep when they were added, and on those where the operator wasn't
+// rebuilt yet, its latest digest under the old name, old, becomes a
+// baseline, so the same image under the new name doesn't count as rebuilt.
+// old is nil when it couldn't be looked up. Running it again finishes a
+// rename that failed part way.
+func (s *AppState) renameOperator(r *http.Request, from, to string, old *OperatorStatus, dryRun bool) (OperatorRename, error) {
+	if s.readOnly != nil {
+		return OperatorRename{}, s.readOnly
+	}
+	from, to = s.inventory.canonical(from), s.inventory.canonical(to)
+	result := OperatorRename{From: from, To: to, DryRun: dryRun, Tickets: []string{}, Groups: []string{}, Baselines: make(map[string]string)}
+
+	tickets := s.Tracking(from)
+	var groups []OperatorGroup
+	for _, group := range s.groups.List() {
+		if indexFold(group.Operators, from) >= 0 {
+			groups = append(groups, group)
+			result.Groups = append(result.Groups, group.Name)
+		}
+	}
+	if len(tickets) == 0 && len(groups) == 0 {
+		return result, fmt.Errorf("%w: no ticket or group tracks %s", store.ErrOperatorNotFound, from)
+	}
+	if _, ok := s.inventory.Get(to); !ok {
+		if err := allowedOperators.Load().check([]string{to}); err != nil {
+			return result, err
+		}
+	}
+	oldEntry, _ := s.inventory.Get(from)
+	newEntry, _ := s.inventory.Get(to)
+	result.Inventory = hasInventoryDetails(oldEntry) && !hasInventoryDetails(newEntry)
+
+	for _, id := range tickets {
+		renamed, baseline, err := s.renameOnTicket(r, id, from, to, old, dryRun)
+		if err != nil {
+			return result, fmt.Errorf("failed to rename %s on %s: %w", from, id, err)
+		}
+		if !renamed {
+			continue // Deleted or changed meanwhile
+		}
+		result.Tickets = append(result.Tickets, id)
+		switch {
+		case baseline.digest != "":
+			result.Baselines[id] = baseline.digest
+		case baseline.unknown:
+			result.Unbaselined = append(result.Unbaselined, id)
+		}
+	}
+	if dryRun {
+		return result, nil
+	}
+
+	for _, group := range groups {
+		members := slices.Clone(group.Operators)
+		members[indexFold(members, from)] = to
+		group.Operators = dedupFold(members) // In case to already was a member
+		if _, err := s.groups.Put(r, group); err != nil {
+			return result, fmt.Errorf("failed to rename %s in group %s: %w", from, group.Name, err)
+		}
+	}
+	if result.Inventory {
+		entry := InventoryEntry{Name: to, Team: oldEntry.Team, Contact: oldEntry.Contact, SourceRepository: oldEntry.SourceRepository, Criticality: oldEntry.Criticality}
+		if _, err := s.inventory.Update(r, entry); err != nil {
+			return result, fmt.Errorf("failed to give %s the inventory details of %s: %w", to, from, err)
+		}
+	}
+	return result, nil
+}
+
+// renameBaseline is the baseline a ticket keeps for a renamed operator
+type renameBaseline struct {
+	digest  string
+	unknown bool // The operator's latest digest couldn't be looked up
+}
+
+// baselineFor returns the baseline a ticket keeps when from is renamed to
+// to: one it already has, or the latest digest of from unless it was rebuilt
+func baselineFor(ticket JiraTicket, from, to string, old *OperatorStatus) renameBaseline {
+	if digest, ok := digestFold(ticket.Baselines, from); ok {
+		return renameBaseline{digest: digest} // From an earlier rename
+	}
+	if digest, ok := ticket.Baselines[to]; ok {
+		return renameBaseline{digest: digest}
+	}
+	if old == nil || old.Status != "OK" || old.SHA256 == "" {
+		return renameBaseline{unknown: true}
+	}
+	status := *old
+	status.Name = from
+	if isRebuilt(ticket, status) {
+		return renameBaseline{}
+	}
+	return renameBaseline{digest: status.SHA256}
+}
+
+// renameOnTicket renames an operator on one ticket, returning whether the
+// ticket still tracked it and the baseline it keeps
+func (s *AppState) renameOnTicket(r *http.Request, id, from, to string, old *OperatorStatus, dryRun bool) (bool, renameBaseline, error) {
+	unlock := s.lockTicket(id)
+	defer unlock()
+
+	ticket, ok := s.Get(id)
+	if !ok || !slices.ContainsFunc(ticket.OperatorNames(), func(name string) bool { return strings.EqualFold(name, from) }) {
+		return false, renameBaseline{}, nil
+	}
+	baseline := baselineFor(ticket, from, to, old)
+
+	// Copy so the published ticket isn't changed in place
+	operators := slices.Clone(ownOperators(ticket.Operators))
+	for i := range operators {
+		if strings.EqualFold(operators[i].Name, from) {
+			operators[i].Name = to
+		}
+	}
+	ticket.Operators, _ = store.NormalizeOperators(operators)
+	ticket.Pins = renameKey(ticket.Pins, from, to)
+	ticket.Baselines = renameKey(ticket.Baselines, from, to)
+	if baseline.digest != "" {
+		ticket.Baselines = maps.Clone(ticket.Baselines)
+		if ticket.Baselines == nil {
+			ticket.Baselines = make(map[string]string)
+		}
+		ticket.Baselines[to] = baseline.digest
+	}
+	if dryRun {
+		return true, baseline, nil
+	}
+	now := s.clock.Now()
+	ticket.Updated = &now
+
+	if err := s.store.Save(ticket); err != nil {
+		return false, baseline, err
+	}
+	s.publish(id, &ticket)
+	s.recordOperators(ticket)
+	details := map[string]interface{}{"from": from, "to": to}
+	if baseline.digest != "" {
+		details["baseline"] = baseline.digest
+	}
+	s.audit.Record(r, "operator.rename", id, details)
+	return true, baseline, nil
+}
+
+// digestFold returns the digest of an operator regardless of case
+func digestFold(digests map[string]string, name string) (string, bool) {
+	for key, digest := range digests {
+		if strings.EqualFold(key, name) {
+			return digest, true
+		}
+	}
+	return "", false
+}
+
+// renameKey returns digests by operator with from's digest under to, unless
+// to has its own. digests isn't changed.
+func renameKey(digests map[string]string, from, to string) map[string]string {
+	digest, ok := digestFold(digests, from)
+	if !ok {
+		return digests
+	}
+	out := maps.Clone(digests)
+	maps.DeleteFunc(out, func(key, _ string) bool { return strings.EqualFold(key, from) })
+	if _, ok := out[to]; !ok {
+		out[to] = digest
+	}
+	return out
+}
+
+// indexFold returns the index of name in names regardless of case, or -1
+func indexFold(names []string, name string) int {
+	return slices.IndexFunc(names, func(n string) bool { return strings.EqualFold(n, name) })
+}
+
+// dedupFold drops names repeated regardless of case, keeping the first
+func dedupFold(names []string) []string {
+	var out []string
+	for _, name := range names {
+		if indexFold(out, name) < 0 {
+			out = append(out, name)
+		}
+	}
+	return out
+}
+
+// hasInventoryDetails reports whether an entry has details besides its name
+func hasInventoryDetails(entry InventoryEntry) bool {
+	return entry.Team != "" || entry.Contact != "" || entry.SourceRepository != "" || entry.Criticality != ""
+}
+
+// renameRequest is the body of POST /api/v1/operators/rename
+type renameRequest struct {
+	From   string `json:"from"`
+	To     string `json:"to"`
+	DryRun bool   `json:"dryRun"`
+}
+
+// handleRenameOperator renames an operator on every ticket and group at
+// POST /api/v1/operators/rename, after its repository was renamed or moved.
+// It is served behind requireAdminToken.
+func handleRenameOperator(state *AppState, quay *QuayClient) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req renameRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			httpError(w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
+		from, to := store.NormalizeOperator(req.From), store.NormalizeOperator(req.To)
+		for _, name := range []string{from, to} {
+			if parts := strings.Split(name, "/"); len(parts) != 2 || parts[0] == "" || parts[1] == "" || strings.Contains(name, "@") {
+				api.WriteError(w, requestID(r), fmt.Errorf("%w: %q", registry.ErrInvalidOperator, name))
+				return
+			}
+		}
+		if strings.EqualFold(from, to) {
+			httpError(w, r, "from and to only differ in case; spell the operator differently in the inventory instead", http.StatusBadRequest)
+			return
+		}
+
+		old, err := quay.GetOperatorStatus(from)
+		if err != nil {
+			requestLogger(r).Warn("Failed to look up the latest image of a renamed operator", "operator", from, "error", err)
+			old = nil
+		}
+		result, err := state.renameOperator(r, from, to, old, req.DryRun)
+		if err != nil {
+			if !errors.Is(err, store.ErrOperatorNotFound) {
+				requestLogger(r).Error("Failed to rename operator", "from", from, "to", to, "error", err)
+			}
+			api.WriteError(w, requestID(r), err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"OpTrack/internal/api"
+	"OpTrack/internal/policy"
+	"OpTrack/internal/store"
+)
+
+// ticketReport is the evidence of a ticket's state at one point in time, for
+// change records: the status page with the compliance results and the build
+// of OpTrack that produced it
+type ticketReport struct {
+	ticketPage
+	Policy     bool // Whether a compliance policy is configured
+	Compliance []OperatorCompliance
+	Compliant  int
+	Build      BuildInfo
+	Actor      string
+}
+
+// handleTicketReport renders a self-contained HTML report of a ticket, with
+// no external styles or scripts so it can be attached to a change record and
+// printed to PDF from the browser. compliance may be nil.
+func handleTicketReport(state *AppState, quay *QuayClient, compliance *policy.Checker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ticket, ok := state.Get(r.PathValue("id"))
+		if !ok {
+			api.WriteError(w, requestID(r), store.ErrTicketNotFound)
+			return
+		}
+
+		opts, err := parseTableOptions(r.URL.Query())
+		if err != nil {
+			api.WriteError(w, requestID(r), err)
+			return
+		}
+
+		now := state.clock.Now()
+		report := ticketReport{
+			ticketPage: newTicketPage(ticket, api.TicketStatuses(quay, ticket, localTime(now)), now),
+			Build:      currentBuildInfo(),
+			Actor:      requestActor(r),
+		}
+		report.Table = newStatusTable(report.ticketPage, opts, time.UTC)
+		if compliance != nil {
+			report.Policy = true
+			report.Compliance = compliance.Check(r.Context(), ticket.OperatorNames())
+			for _, c := range report.Compliance {
+				if c.Compliant {
+					report.Compliant++
+				}
+			}
+		}
+
+		filename := fmt.Sprintf("%s-report-%s.html", ticket.ID, now.UTC().Format("20060102T150405Z"))
+		w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=%q", filename))
+		w.Header().Set("Cache-Control", "no-store")
+		renderPage(w, r, "report.html", report)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"log/slog"
+	"slices"
+	"sort"
+
+	"OpTrack/internal/store"
+)
+
+// ticketRollup returns the state of a ticket as a whole from the statuses of
+// its operators: complete once every one was rebuilt, and otherwise error
+// when one couldn't be looked up, blocked when one is past its expected-by
+// date, or in progress
+func ticketRollup(ticket JiraTicket, statuses []OperatorStatus) string {
+	if ticketRebuilt(ticket, statuses) {
+		return store.RollupComplete
+	}
+	rollup := store.RollupInProgress
+	for _, status := range statuses {
+		switch {
+		case status.Status != "OK":
+			return store.RollupError
+		case status.Overdue:
+			rollup = store.RollupBlocked
+		}
+	}
+	return rollup
+}
+
+// setRollup saves the rollup state the poller found for a ticket, unless it
+// is unchanged or the ticket was replaced or deleted since it was checked.
+// It isn't a change to the ticket, so Updated is left alone.
+func (s *AppState) setRollup(checked JiraTicket, rollup string) {
+	unlock := s.lockTicket(checked.ID)
+	defer unlock()
+
+	ticket, ok := s.Get(checked.ID)
+	if !ok || ticket.Rollup == rollup || !ticket.Added.Equal(checked.Added) || !slices.Equal(ticket.OperatorNames(), checked.OperatorNames()) {
+		return
+	}
+	ticket.Rollup = rollup
+	ticket.Operators = ownOperators(ticket.Operators)
+	if err := s.store.Save(ticket); err != nil {
+		slog.Error("Failed to save the rollup state of a ticket", "ticket", ticket.ID, "rollup", rollup, "error", err)
+		return
+	}
+	s.publish(ticket.ID, &ticket)
+}
+
+// sortByRollup sorts tickets by their rollup state, the most urgent first
+// and those not checked yet last, keeping the order of tickets in the same
+// state
+func sortByRollup[T any](tickets []T, rollup func(T) string) {
+	rank := func(t T) int {
+		if i := slices.Index(store.Rollups, rollup(t)); i >= 0 {
+			return i
+		}
+		return len(store.Rollups)
+	}
+	sort.SliceStable(tickets, func(i, j int) bool { return rank(tickets[i]) < rank(tickets[j]) })
+}
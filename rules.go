@@ -0,0 +1,240 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"OpTrack/internal/store"
+)
+
+// allChannels in the channels of a rule stands for every enabled channel
+const allChannels = "*"
+
+// NotificationRule routes matching events to a set of channels
+type NotificationRule struct {
+	Events  []EventType `json:"events,omitempty"`  // Empty matches every event type
+	Tickets []string    `json:"tickets,omitempty"` // Glob patterns, empty matches every ticket
+	// ClusterLabels, when set, matches cluster events for clusters with all
+	// of these labels, e.g. {"env": "prod"}, and no other events
+	ClusterLabels map[string]string `json:"clusterLabels,omitempty"`
+	Channels      []string          `json:"channels"`
+}
+
+func (r NotificationRule) matches(ev Event) bool {
+	if len(r.Events) > 0 {
+		found := false
+		for _, t := range r.Events {
+			if t == ev.Type {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if len(r.Tickets) > 0 {
+		found := false
+		for _, pattern := range r.Tickets {
+			if ok, _ := path.Match(pattern, ev.Ticket.ID); ok {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if len(r.ClusterLabels) > 0 {
+		if ev.Cluster == nil {
+			return false
+		}
+		for key, value := range r.ClusterLabels {
+			if ev.Cluster.Labels[key] != value {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// RuleStore persists the notification rules. With no rules configured every
+// event is sent to every enabled channel.
+type RuleStore struct {
+	mu    sync.RWMutex
+	path  string
+	rules []NotificationRule
+	audit *AuditLog
+}
+
+func NewRuleStore(dataDir string, audit *AuditLog) (*RuleStore, error) {
+	dir, err := store.SettingsDir(dataDir)
+	if err != nil {
+		return nil, err
+	}
+
+	store := &RuleStore{path: filepath.Join(dir, "notification-rules.json"), audit: audit}
+	if err := store.Reload(); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// Reload re-reads the rules file, picking up changes made outside the API
+func (s *RuleStore) Reload() error {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			data = []byte("null")
+		} else {
+			return err
+		}
+	}
+
+	var rules []NotificationRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return fmt.Errorf("failed to parse %s: %v", s.path, err)
+	}
+
+	s.mu.Lock()
+	s.rules = rules
+	s.mu.Unlock()
+	return nil
+}
+
+// Channels returns the channels an event should be delivered to, limited to
+// the channels that are actually enabled
+func (s *RuleStore) Channels(ev Event, enabled []string) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if len(s.rules) == 0 {
+		return enabled
+	}
+
+	isEnabled := make(map[string]bool, len(enabled))
+	for _, name := range enabled {
+		isEnabled[name] = true
+	}
+
+	seen := make(map[string]bool)
+	var channels []string
+	for _, rule := range s.rules {
+		if !rule.matches(ev) {
+			continue
+		}
+		names := rule.Channels
+		if slices.Contains(names, allChannels) {
+			names = enabled
+		}
+		for _, name := range names {
+			if isEnabled[name] && !seen[name] {
+				seen[name] = true
+				channels = append(channels, name)
+			}
+		}
+	}
+	return channels
+}
+
+func (s *RuleStore) Rules() []NotificationRule {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]NotificationRule(nil), s.rules...)
+}
+
+func (s *RuleStore) SetRules(rules []NotificationRule) error {
+	data, err := json.MarshalIndent(rules, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := store.WriteFileAtomic(s.path, data, 0644); err != nil {
+		return err
+	}
+	s.rules = rules
+	return nil
+}
+
+// globEscaper quotes the characters ticket patterns treat specially
+var globEscaper = strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`, "[", `\[`)
+
+// AddTicketRules appends rules limited to one ticket, returning them. With no
+// rules yet every event went to every enabled channel, so a rule sending
+// every event to every channel is added first for the other tickets.
+func (s *RuleStore) AddTicketRules(ticket string, rules []NotificationRule) ([]NotificationRule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var added []NotificationRule
+	if len(s.rules) == 0 {
+		added = append(added, NotificationRule{Channels: []string{allChannels}})
+	}
+	for _, rule := range rules {
+		rule.Tickets = []string{globEscaper.Replace(ticket)}
+		added = append(added, rule)
+	}
+	next := append(slices.Clip(s.rules), added...)
+	data, err := json.MarshalIndent(next, "", "    ")
+	if err != nil {
+		return nil, err
+	}
+	if err := store.WriteFileAtomic(s.path, data, 0644); err != nil {
+		return nil, fmt.Errorf("%w: failed to save notification rules: %v", store.ErrStorage, err)
+	}
+	s.rules = next
+	return added, nil
+}
+
+// handleRules returns or replaces the notification rules
+func (s *RuleStore) handleRules(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		json.NewEncoder(w).Encode(s.Rules())
+
+	case "PUT":
+		var rules []NotificationRule
+		if err := json.NewDecoder(r.Body).Decode(&rules); err != nil {
+			httpError(w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		for _, rule := range rules {
+			if len(rule.Channels) == 0 {
+				httpError(w, r, "Every rule needs at least one channel", http.StatusBadRequest)
+				return
+			}
+			for _, pattern := range rule.Tickets {
+				if _, err := path.Match(pattern, ""); err != nil {
+					httpError(w, r, fmt.Sprintf("Invalid ticket pattern %q", pattern), http.StatusBadRequest)
+					return
+				}
+			}
+		}
+
+		if err := s.SetRules(rules); err != nil {
+			requestLogger(r).Error("Failed to save notification rules", "error", err)
+			httpError(w, r, "Failed to save rules", http.StatusInternalServerError)
+			return
+		}
+		s.audit.Record(r, "notifications.rules_update", "", map[string]interface{}{"rules": rules})
+
+		json.NewEncoder(w).Encode(rules)
+
+	default:
+		httpError(w, r, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"OpTrack/internal/clock"
+	"OpTrack/internal/saas"
+)
+
+// OperatorPromotion is whether a SaaS file target deploys the latest image of an operator
+type OperatorPromotion = saas.Result
+
+// SaasFileConfig is where app-interface SaaS files are read from: one file
+// at url, or a file or directory such as an app-interface checkout at path.
+// Directories are searched for every file with a saas-file $schema.
+type SaasFileConfig struct {
+	Name      string `yaml:"name"`
+	URL       string `yaml:"url"`       // e.g. the raw URL of a saas file in a Git forge
+	Path      string `yaml:"path"`      // A SaaS file, or a directory such as data/services/
+	Token     string `yaml:"token"`     // Bearer token for url, for private repositories
+	TagLength int    `yaml:"tagLength"` // Characters of the commit SHA in image tags, 7 by default
+}
+
+// newPromotionMonitor returns nil when no SaaS files are configured
+func newPromotionMonitor(files []SaasFileConfig, quay *QuayClient, clk clock.Clock) *saas.Monitor {
+	if len(files) == 0 {
+		return nil
+	}
+	var sources []saas.Source
+	for _, f := range files {
+		location := f.URL
+		if location == "" {
+			location = f.Path
+		}
+		sources = append(sources, saas.Source{Name: f.Name, Location: location, Token: f.Token, TagLength: f.TagLength})
+	}
+	return saas.New(sources, quay, clk, saas.DefaultTTL)
+}
+
+func newPromotionCommand(opts *cliOptions) *cobra.Command {
+	return &cobra.Command{
+		Use:   "promotion <ticket>",
+		Short: "Show whether the latest image of every operator on a ticket is promoted in app-interface",
+		Long: `Show whether the latest image of every operator on a ticket is promoted in app-interface.
+
+Every SaaS file target that deploys an operator's image is listed with the git
+ref it pins. Images are tagged with the first characters of the commit they
+were built from, so a target whose ref doesn't match the tags of the latest
+image on Quay.io was built but not promoted. SaaS files are set under
+saasFiles: in the config file.`,
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeFirstTicket(opts),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			backend, err := opts.backend()
+			if err != nil {
+				return err
+			}
+			results, err := backend.TicketPromotion(args[0])
+			if err != nil {
+				return fmt.Errorf("failed to compare %s with the SaaS files: %v", args[0], err)
+			}
+			return opts.printer(cmd).print(results, func(wide bool) {
+				printPromotion(cmd.OutOrStdout(), results, wide)
+			})
+		},
+	}
+}
+
+// printPromotion prints one row per target and operator, with full digests and refs when wide is set
+func printPromotion(out io.Writer, results []OperatorPromotion, wide bool) {
+	short := shortDigest
+	if wide {
+		short = func(digest string) string { return digest }
+	}
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "SOURCE\tSAAS FILE\tTARGET\tOPERATOR\tSTATE\tREF\tLATEST\tTAGS")
+	for _, r := range results {
+		target := r.Target
+		if r.ResourceTemplate != "" {
+			target = r.ResourceTemplate + "/" + target
+		}
+		ref := r.Ref
+		if !wide && len(ref) > 12 {
+			ref = ref[:12]
+		}
+		tags := strings.Join(r.LatestTags, ",")
+		if r.Error != "" {
+			tags = strings.TrimSpace(tags + " (" + r.Error + ")")
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", r.Source, r.SaasFile, target, r.Operator, r.State, ref, short(r.Latest), tags)
+	}
+	tw.Flush()
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"OpTrack/internal/clock"
+	"OpTrack/internal/registry"
+	"OpTrack/internal/scan"
+)
+
+// ScansConfig is how the latest image of each operator is scanned for
+// vulnerabilities, for registries without scanning of their own. Nothing is
+// scanned without a scanner.
+type ScansConfig struct {
+	Scanner     string   `yaml:"scanner"`  // "trivy" or "grype"
+	Command     string   `yaml:"command"`  // Defaults to the scanner's name, looked up on the PATH
+	Server      string   `yaml:"server"`   // A Trivy server to scan with, e.g. http://trivy:4954
+	Registry    string   `yaml:"registry"` // Defaults to the host of quay.url
+	Username    string   `yaml:"username"`
+	Password    string   `yaml:"password"`
+	Timeout     Duration `yaml:"timeout"`
+	Interval    Duration `yaml:"interval"` // How often an image is scanned again, as new vulnerabilities are published
+	Concurrency int      `yaml:"concurrency"`
+	Findings    int      `yaml:"findings"` // How many of the most severe vulnerabilities are listed per operator
+}
+
+// Scan defaults
+const (
+	defaultScanTimeout     = 10 * time.Minute
+	defaultScanInterval    = 24 * time.Hour
+	defaultScanConcurrency = 1
+	defaultScanFindings    = 10
+)
+
+// newScanning returns the scanning of the registry client, without a
+// scanner when scans are disabled
+func newScanning(cfg ScansConfig, quay QuayConfig, clk clock.Clock) (registry.Scanning, error) {
+	if cfg.Scanner == "" {
+		return registry.Scanning{}, nil
+	}
+	host, err := imageRegistry(cfg.Registry, quay)
+	if err != nil {
+		return registry.Scanning{}, err
+	}
+	scanner := scan.New(scan.Options{
+		Scanner:  cfg.Scanner,
+		Command:  cfg.Command,
+		Server:   cfg.Server,
+		Registry: host,
+		Username: cfg.Username,
+		Password: cfg.Password,
+		Timeout:  time.Duration(cfg.Timeout),
+		Findings: cfg.Findings,
+		Clock:    clk,
+	})
+	return registry.Scanning{
+		Scanner:     scanner,
+		Interval:    time.Duration(cfg.Interval),
+		Concurrency: cfg.Concurrency,
+	}, nil
+}
+
+// scanSummary is the vulnerabilities column of an operator: the number of
+// vulnerabilities of each severity found, or "" before the image is scanned
+func scanSummary(s *registry.Scan) string {
+	if s == nil {
+		return ""
+	}
+	var parts []string
+	for _, sev := range registry.Severities {
+		if n := s.Counts[sev]; n > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", n, sev))
+		}
+	}
+	if len(parts) == 0 {
+		return "none"
+	}
+	return strings.Join(parts, ", ")
+}
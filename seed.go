@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+
+	"github.com/spf13/cobra"
+
+	"OpTrack/internal/store"
+)
+
+// Name parts for generated operators, in the style of real app-sre repositories
+var (
+	seedNamespaces = []string{"app-sre", "openshift", "rh-osd", "redhat-services-prod"}
+	seedProducts   = []string{"splunk-audit", "cloud-ingress", "managed-velero", "deadmanssnitch",
+		"pagerduty", "route-monitor", "ocm-agent", "configure-alertmanager", "custom-domains",
+		"must-gather", "osd-metrics", "certman", "aws-account", "gcp-project", "addon"}
+	seedSuffixes = []string{"operator", "exporter", "operator-bundle", "operator-registry"}
+	seedOwners   = []string{"alice", "bob", "carol", "dave", "erin", ""}
+)
+
+func newSeedCommand(opts *cliOptions) *cobra.Command {
+	var (
+		tickets   int
+		operators int
+		prefix    string
+		seed      int64
+	)
+
+	cmd := &cobra.Command{
+		Use:   "seed",
+		Short: "Create fake tickets for development and demos",
+		Long: `Seed creates tickets tracking made-up operators, so the UI and CLI can be
+tried without setting up real tickets. Each ticket tracks one to five
+operators from a pool of --operators names. The same --seed always produces
+the same tickets; existing tickets with the same IDs are replaced.`,
+		Example: "  optrack seed --tickets 20 --operators 15",
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if tickets < 1 || operators < 1 {
+				return fmt.Errorf("--tickets and --operators must be at least 1")
+			}
+			backend, err := opts.backend()
+			if err != nil {
+				return err
+			}
+
+			var saved []JiraTicket
+			for _, t := range seedTickets(rand.New(rand.NewSource(seed)), prefix, tickets, operators) {
+				s, err := backend.SaveTicket(t)
+				if err != nil {
+					return fmt.Errorf("failed to save %s: %v", t.ID, err)
+				}
+				saved = append(saved, s)
+			}
+			return opts.printer(cmd).print(saved, func(bool) {
+				printTickets(cmd.OutOrStdout(), saved)
+			})
+		},
+	}
+
+	cmd.Flags().IntVar(&tickets, "tickets", 20, "Number of tickets to create")
+	cmd.Flags().IntVar(&operators, "operators", 15, "Number of distinct operators the tickets track")
+	cmd.Flags().StringVar(&prefix, "prefix", "DEMO", "Ticket ID prefix")
+	cmd.Flags().Int64Var(&seed, "seed", 1, "Random seed")
+	return cmd
+}
+
+// seedOperators returns n distinct made-up operator names
+func seedOperators(r *rand.Rand, n int) []string {
+	seen := make(map[string]bool)
+	var names []string
+	for len(names) < n {
+		name := fmt.Sprintf("%s/%s-%s",
+			seedNamespaces[r.Intn(len(seedNamespaces))],
+			seedProducts[r.Intn(len(seedProducts))],
+			seedSuffixes[r.Intn(len(seedSuffixes))])
+		// Number the names once the combinations run out
+		if len(seen) >= len(seedNamespaces)*len(seedProducts)*len(seedSuffixes) {
+			name = fmt.Sprintf("%s-%d", name, len(names))
+		}
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// seedTickets returns count tickets, each tracking a few operators from a pool of operators
+func seedTickets(r *rand.Rand, prefix string, count, operators int) []JiraTicket {
+	pool := seedOperators(r, operators)
+	tickets := make([]JiraTicket, 0, count)
+	for i := 0; i < count; i++ {
+		n := 1 + r.Intn(5)
+		if n > len(pool) {
+			n = len(pool)
+		}
+		var ops []string
+		for _, j := range r.Perm(len(pool))[:n] {
+			ops = append(ops, pool[j])
+		}
+
+		ticket := JiraTicket{ID: fmt.Sprintf("%s-%d", prefix, 1001+i), Operators: store.OperatorsNamed(ops)}
+		if owner := seedOwners[r.Intn(len(seedOwners))]; owner != "" {
+			ticket.Owner = owner + "@example.com"
+		}
+		tickets = append(tickets, ticket)
+	}
+	return tickets
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+
+	"OpTrack/internal/ids"
+)
+
+// SentryReporter sends errors to Sentry or a compatible service such as
+// GlitchTip using the envelope endpoint
+type SentryReporter struct {
+	endpoint    string
+	publicKey   string
+	dsn         string
+	environment string
+	client      *http.Client
+}
+
+// NewSentryReporter parses a DSN of the form https://<key>@<host>/<project>
+func NewSentryReporter(dsn, environment string) (*SentryReporter, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("invalid DSN: %v", err)
+	}
+	if u.User == nil || u.User.Username() == "" {
+		return nil, fmt.Errorf("invalid DSN: missing public key")
+	}
+
+	projectID := strings.Trim(u.Path, "/")
+	prefix := ""
+	if i := strings.LastIndex(projectID, "/"); i >= 0 {
+		prefix, projectID = "/"+projectID[:i], projectID[i+1:]
+	}
+	if projectID == "" {
+		return nil, fmt.Errorf("invalid DSN: missing project ID")
+	}
+
+	return &SentryReporter{
+		endpoint:    fmt.Sprintf("%s://%s%s/api/%s/envelope/", u.Scheme, u.Host, prefix, projectID),
+		publicKey:   u.User.Username(),
+		dsn:         dsn,
+		environment: environment,
+		client:      &http.Client{Timeout: 5 * time.Second},
+	}, nil
+}
+
+// SentryReporterFromEnv reads OPTRACK_SENTRY_DSN and OPTRACK_SENTRY_ENVIRONMENT.
+// It returns nil if no DSN is configured.
+func SentryReporterFromEnv() (*SentryReporter, error) {
+	dsn := os.Getenv("OPTRACK_SENTRY_DSN")
+	if dsn == "" {
+		return nil, nil
+	}
+	return NewSentryReporter(dsn, os.Getenv("OPTRACK_SENTRY_ENVIRONMENT"))
+}
+
+type sentryFrame struct {
+	Function string `json:"function"`
+	Filename string `json:"filename"`
+	Lineno   int    `json:"lineno"`
+	InApp    bool   `json:"in_app"`
+}
+
+// stackFrames captures the caller's stack, oldest frame first as Sentry expects
+func stackFrames(skip int) []sentryFrame {
+	pcs := make([]uintptr, 64)
+	n := runtime.Callers(skip+1, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+
+	var out []sentryFrame
+	for {
+		frame, more := frames.Next()
+		out = append(out, sentryFrame{
+			Function: frame.Function,
+			Filename: frame.File,
+			Lineno:   frame.Line,
+			InApp:    strings.HasPrefix(frame.Function, "main."),
+		})
+		if !more {
+			break
+		}
+	}
+
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return out
+}
+
+// ReportPanic sends a panic raised while serving r
+func (s *SentryReporter) ReportPanic(r *http.Request, recovered interface{}, frames []sentryFrame) error {
+	eventID := ids.Random.New() // Sentry requires 32 hex digits
+	hostname, _ := os.Hostname()
+
+	event := map[string]interface{}{
+		"event_id":    eventID,
+		"timestamp":   time.Now().UTC().Format(time.RFC3339Nano),
+		"platform":    "go",
+		"level":       "fatal",
+		"logger":      "optrack",
+		"server_name": hostname,
+		"environment": s.environment,
+		"exception": map[string]interface{}{
+			"values": []map[string]interface{}{
+				{
+					"type":       "panic",
+					"value":      fmt.Sprint(recovered),
+					"stacktrace": map[string]interface{}{"frames": frames},
+				},
+			},
+		},
+		"request": map[string]interface{}{
+			"url":    r.URL.String(),
+			"method": r.Method,
+		},
+		"tags": map[string]string{"request_id": requestID(r)},
+	}
+
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+	enc.Encode(map[string]string{"event_id": eventID, "dsn": s.dsn})
+	enc.Encode(map[string]string{"type": "event"})
+	enc.Encode(event)
+
+	req, err := http.NewRequest("POST", s.endpoint, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-sentry-envelope")
+	req.Header.Set("X-Sentry-Auth", fmt.Sprintf("Sentry sentry_version=7, sentry_key=%s, sentry_client=optrack/1.0", s.publicKey))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("sentry returned %d: %s", resp.StatusCode, string(msg))
+	}
+	return nil
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"OpTrack/internal/store"
+)
+
+// serviceName is the name of the Windows service and the systemd unit
+const serviceName = "optrack"
+
+const serviceDescription = "Tracks version updates of OpenShift operators on quay.io"
+
+var (
+	shutdownRequested = make(chan struct{})
+	shutdownOnce      sync.Once
+)
+
+// requestShutdown stops the server the same way SIGTERM does, for service
+// managers that don't send signals
+func requestShutdown() {
+	shutdownOnce.Do(func() { close(shutdownRequested) })
+}
+
+func newServiceCommand(opts *cliOptions) *cobra.Command {
+	service := &cobra.Command{
+		Use:   "service",
+		Short: "Run OpTrack as a system service",
+	}
+
+	var (
+		user       bool
+		socket     bool
+		executable string
+		dir        string
+	)
+	unit := &cobra.Command{
+		Use:   "systemd-unit",
+		Short: "Print a systemd unit that runs the server with the current config and data directory",
+		Long: `Print a systemd service unit, and with --socket a socket unit for socket
+activation, that runs the server with the current --config and data directory.
+
+  optrack service systemd-unit --config /etc/optrack.yaml --dir /etc/systemd/system
+  systemctl daemon-reload && systemctl enable --now optrack`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			exe, err := serviceExecutable(executable)
+			if err != nil {
+				return err
+			}
+			unitArgs, err := serviceArgs(opts, socket)
+			if err != nil {
+				return err
+			}
+			return writeSystemdUnits(cmd.OutOrStdout(), dir, systemdUnit{
+				Description: serviceDescription,
+				ExecStart:   strings.Join(append([]string{exe}, unitArgs...), " "),
+				Listen:      opts.cfg.Listen,
+				Socket:      socket,
+				User:        user,
+			})
+		},
+	}
+	unit.Flags().BoolVar(&user, "user", false, "Write a user unit, for systemctl --user")
+	unit.Flags().BoolVar(&socket, "socket", false, "Also write a socket unit so systemd opens the listen address")
+	unit.Flags().StringVar(&executable, "executable", "", "Path of the optrack binary (default this binary)")
+	unit.Flags().StringVar(&dir, "dir", "", "Write the unit files into this directory instead of printing them")
+
+	install := &cobra.Command{
+		Use:   "install",
+		Short: "Install the Windows service, starting automatically with the current config and data directory",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			exe, err := serviceExecutable(executable)
+			if err != nil {
+				return err
+			}
+			serviceArgs, err := serviceArgs(opts, false)
+			if err != nil {
+				return err
+			}
+			if err := installService(exe, serviceArgs); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Installed service %s: %s %s\n", serviceName, exe, strings.Join(serviceArgs, " "))
+			return nil
+		},
+	}
+	install.Flags().StringVar(&executable, "executable", "", "Path of the optrack binary (default this binary)")
+
+	uninstall := &cobra.Command{
+		Use:   "uninstall",
+		Short: "Stop and remove the Windows service",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := uninstallService(); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Removed service %s\n", serviceName)
+			return nil
+		},
+	}
+
+	start := &cobra.Command{
+		Use:   "start",
+		Short: "Start the Windows service",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return startService()
+		},
+	}
+
+	stop := &cobra.Command{
+		Use:   "stop",
+		Short: "Stop the Windows service, waiting for it to shut down",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// Allow for the server's own shutdown timeout plus some slack
+			return stopService(time.Duration(opts.cfg.ShutdownTimeout) + defaultShutdownTimeout)
+		},
+	}
+
+	service.AddCommand(unit, install, uninstall, start, stop)
+	return service
+}
+
+// serviceExecutable returns the absolute path of the binary a service should run
+func serviceExecutable(path string) (string, error) {
+	if path == "" {
+		exe, err := os.Executable()
+		if err != nil {
+			return "", fmt.Errorf("failed to find this binary, set --executable: %v", err)
+		}
+		path = exe
+	}
+	return filepath.Abs(path)
+}
+
+// serviceArgs are the server arguments that reproduce the current config
+// regardless of the service's working directory
+func serviceArgs(opts *cliOptions, socket bool) ([]string, error) {
+	args := []string{"serve"}
+	if opts.configPath != "" {
+		path, err := filepath.Abs(opts.configPath)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, "--config", path)
+	}
+	dataDir, err := filepath.Abs(opts.cfg.DataDir)
+	if err != nil {
+		return nil, err
+	}
+	args = append(args, "--data-dir", dataDir)
+	if socket {
+		args = append(args, "--listen", "systemd")
+	}
+	return args, nil
+}
+
+// systemdUnit holds the values for the generated unit files
+type systemdUnit struct {
+	Description string
+	ExecStart   string
+	Listen      string
+	Socket      bool
+	User        bool
+}
+
+// SocketListen converts the listen setting to a ListenStream value
+func (u systemdUnit) SocketListen() string {
+	if path, ok := strings.CutPrefix(u.Listen, "unix:"); ok {
+		return path
+	}
+	if u.Listen == "systemd" {
+		// The address is already left to systemd, so fall back to the default
+		return strings.TrimPrefix(defaultConfig().Listen, ":")
+	}
+	return strings.TrimPrefix(u.Listen, ":") // systemd takes a bare port for all addresses
+}
+
+var (
+	systemdServiceTemplate = template.Must(template.New("service").Parse(`[Unit]
+Description={{.Description}}
+After=network-online.target
+Wants=network-online.target
+{{- if .Socket}}
+Requires={{.Name}}.socket
+{{- end}}
+
+[Service]
+ExecStart={{.ExecStart}}
+ExecReload=/bin/kill -HUP $MAINPID
+Restart=on-failure
+
+[Install]
+WantedBy={{if .User}}default.target{{else}}multi-user.target{{end}}
+`))
+
+	systemdSocketTemplate = template.Must(template.New("socket").Parse(`[Unit]
+Description=OpTrack socket
+
+[Socket]
+ListenStream={{.SocketListen}}
+SocketMode=0660
+
+[Install]
+WantedBy=sockets.target
+`))
+)
+
+// writeSystemdUnits writes optrack.service, and optrack.socket with socket
+// activation, into dir, or prints them to out when dir is empty
+func writeSystemdUnits(out io.Writer, dir string, unit systemdUnit) error {
+	type unitFile struct {
+		name string
+		tmpl *template.Template
+	}
+	files := []unitFile{{serviceName + ".service", systemdServiceTemplate}}
+	if unit.Socket {
+		files = append(files, unitFile{serviceName + ".socket", systemdSocketTemplate})
+	}
+
+	data := struct {
+		systemdUnit
+		Name string
+	}{unit, serviceName}
+	for i, f := range files {
+		var buf bytes.Buffer
+		if err := f.tmpl.Execute(&buf, data); err != nil {
+			return err
+		}
+		if dir != "" {
+			path := filepath.Join(dir, f.name)
+			if err := store.WriteFileAtomic(path, buf.Bytes(), 0644); err != nil {
+				return fmt.Errorf("failed to write %s: %v", path, err)
+			}
+			fmt.Fprintf(out, "Wrote %s\n", path)
+			continue
+		}
+		if i > 0 {
+			fmt.Fprintln(out)
+		}
+		fmt.Fprintf(out, "# %s\n", f.name)
+		out.Write(buf.Bytes())
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+//go:build !windows
+
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+var errNotWindows = fmt.Errorf("Windows services are only supported on Windows; use `optrack service systemd-unit` on Linux")
+
+func isWindowsService() bool { return false }
+
+func runWindowsService(run func()) error { return errNotWindows }
+
+func installService(exe string, args []string) error { return errNotWindows }
+
+func uninstallService() error { return errNotWindows }
+
+func startService() error { return errNotWindows }
+
+func stopService(timeout time.Duration) error { return errNotWindows }
+
+type eventLogWriter struct{}
+
+func newEventLogWriter(source string) (*eventLogWriter, error) {
+	return nil, fmt.Errorf("the event log is only available on Windows")
+}
+
+func (w *eventLogWriter) WriteLevel(level slog.Level, p []byte) error { return nil }
+
+func (w *eventLogWriter) Write(p []byte) (int, error) { return len(p), nil }
@@ -0,0 +1,200 @@
+//go:build windows
+
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/eventlog"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+// isWindowsService reports whether the process was started by the service control manager
+func isWindowsService() bool {
+	ok, err := svc.IsWindowsService()
+	return err == nil && ok
+}
+
+// runWindowsService runs the server under the service control manager until
+// it asks the service to stop
+func runWindowsService(run func()) error {
+	return svc.Run(serviceName, &windowsService{run: run})
+}
+
+type windowsService struct {
+	run func()
+}
+
+func (s *windowsService) Execute(args []string, requests <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	status <- svc.Status{State: svc.StartPending}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.run()
+	}()
+
+	status <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+	for {
+		select {
+		case <-done:
+			return false, 0
+		case req := <-requests:
+			switch req.Cmd {
+			case svc.Interrogate:
+				status <- req.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				status <- svc.Status{State: svc.StopPending}
+				requestShutdown()
+				<-done
+				return false, 0
+			}
+		}
+	}
+}
+
+// installService registers the service to start automatically with args, and
+// the event log source it logs to
+func installService(exe string, args []string) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("failed to connect to the service manager: %v", err)
+	}
+	defer m.Disconnect()
+
+	if s, err := m.OpenService(serviceName); err == nil {
+		s.Close()
+		return fmt.Errorf("service %s is already installed", serviceName)
+	}
+	s, err := m.CreateService(serviceName, exe, mgr.Config{
+		DisplayName: "OpTrack",
+		Description: serviceDescription,
+		StartType:   mgr.StartAutomatic,
+	}, args...)
+	if err != nil {
+		return fmt.Errorf("failed to create service: %v", err)
+	}
+	defer s.Close()
+
+	if err := eventlog.InstallAsEventCreate(logIdentifier(), eventlog.Error|eventlog.Warning|eventlog.Info); err != nil {
+		s.Delete()
+		return fmt.Errorf("failed to register event log source: %v", err)
+	}
+	return nil
+}
+
+// uninstallService stops and removes the service
+func uninstallService() error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("failed to connect to the service manager: %v", err)
+	}
+	defer m.Disconnect()
+
+	s, err := m.OpenService(serviceName)
+	if err != nil {
+		return fmt.Errorf("service %s is not installed", serviceName)
+	}
+	defer s.Close()
+
+	s.Control(svc.Stop) // Ignore the error if it isn't running
+	if err := s.Delete(); err != nil {
+		return fmt.Errorf("failed to delete service: %v", err)
+	}
+	eventlog.Remove(logIdentifier())
+	return nil
+}
+
+// startService asks the service manager to start the service
+func startService() error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("failed to connect to the service manager: %v", err)
+	}
+	defer m.Disconnect()
+
+	s, err := m.OpenService(serviceName)
+	if err != nil {
+		return fmt.Errorf("service %s is not installed", serviceName)
+	}
+	defer s.Close()
+	return s.Start()
+}
+
+// stopService asks the service to stop and waits up to timeout for it to do so
+func stopService(timeout time.Duration) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("failed to connect to the service manager: %v", err)
+	}
+	defer m.Disconnect()
+
+	s, err := m.OpenService(serviceName)
+	if err != nil {
+		return fmt.Errorf("service %s is not installed", serviceName)
+	}
+	defer s.Close()
+
+	status, err := s.Control(svc.Stop)
+	if err != nil {
+		return fmt.Errorf("failed to stop service: %v", err)
+	}
+	deadline := time.Now().Add(timeout)
+	for status.State != svc.Stopped {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("service did not stop within %s", timeout)
+		}
+		time.Sleep(500 * time.Millisecond)
+		if status, err = s.Query(); err != nil {
+			return fmt.Errorf("failed to query service: %v", err)
+		}
+	}
+	return nil
+}
+
+// processRunning reports whether a process with the given ID exists
+func processRunning(pid int) bool {
+	h, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, uint32(pid))
+	if err != nil {
+		return false
+	}
+	defer windows.CloseHandle(h)
+
+	var code uint32
+	const stillActive = 259
+	return windows.GetExitCodeProcess(h, &code) == nil && code == stillActive
+}
+
+// eventLogWriter writes log records to the Windows event log
+type eventLogWriter struct {
+	log *eventlog.Log
+}
+
+func newEventLogWriter(source string) (*eventLogWriter, error) {
+	l, err := eventlog.Open(source)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open event log: %v", err)
+	}
+	return &eventLogWriter{log: l}, nil
+}
+
+func (w *eventLogWriter) WriteLevel(level slog.Level, p []byte) error {
+	const eventID = 1
+	msg := string(p)
+	switch {
+	case level >= slog.LevelError:
+		return w.log.Error(eventID, msg)
+	case level >= slog.LevelWarn:
+		return w.log.Warning(eventID, msg)
+	default:
+		return w.log.Info(eventID, msg)
+	}
+}
+
+func (w *eventLogWriter) Write(p []byte) (int, error) {
+	return len(p), w.WriteLevel(slog.LevelInfo, p)
+}
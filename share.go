@@ -0,0 +1,378 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"OpTrack/internal/api"
+	"OpTrack/internal/clock"
+	"OpTrack/internal/ids"
+	"OpTrack/internal/policy"
+	"OpTrack/internal/store"
+)
+
+const (
+	// defaultShareExpiry is how long a share link works unless asked otherwise
+	defaultShareExpiry = 7 * 24 * time.Hour
+	// maxShareExpiry is the longest a share link may work
+	maxShareExpiry = 90 * 24 * time.Hour
+	// shareRetention is how long expired and revoked links are kept for the
+	// list of a ticket's links
+	shareRetention = 30 * 24 * time.Hour
+)
+
+var (
+	errShareNotFound = errors.New("share link not found")
+	errShareExpired  = errors.New("share link expired")
+)
+
+// ShareLink lets anyone with its URL see the status page of a ticket,
+// without an account, until it expires or is revoked
+type ShareLink struct {
+	ID        string     `json:"id"`
+	Ticket    string     `json:"ticket"`
+	Operators []string   `json:"operators,omitempty"` // The operators shown, every operator on the ticket when empty
+	Created   time.Time  `json:"created"`
+	CreatedBy string     `json:"createdBy"`
+	Expires   time.Time  `json:"expires"`
+	Revoked   *time.Time `json:"revoked,omitempty"`
+	URL       string     `json:"url,omitempty"` // Set in API responses for links that still work
+}
+
+// ShareStore issues, checks and revokes share links. Tokens are the link ID
+// with an HMAC of the link under a key kept in the data directory, so a link
+// only works while the server still has its record.
+type ShareStore struct {
+	mu    sync.Mutex
+	path  string
+	key   []byte
+	links map[string]ShareLink
+	audit *AuditLog
+	clock clock.Clock
+}
+
+func NewShareStore(dataDir string, audit *AuditLog, clk clock.Clock) (*ShareStore, error) {
+	dir, err := store.SettingsDir(dataDir)
+	if err != nil {
+		return nil, err
+	}
+	key, err := loadShareKey(filepath.Join(dir, "share-key"))
+	if err != nil {
+		return nil, err
+	}
+
+	s := &ShareStore{
+		path:  filepath.Join(dir, "share-links.json"),
+		key:   key,
+		links: make(map[string]ShareLink),
+		audit: audit,
+		clock: clk,
+	}
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &s.links); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", s.path, err)
+	}
+	return s, nil
+}
+
+// loadShareKey reads the signing key, creating it on first use. Deleting the
+// file invalidates every link.
+func loadShareKey(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		key, err := hex.DecodeString(strings.TrimSpace(string(data)))
+		if err != nil || len(key) < 32 {
+			return nil, fmt.Errorf("invalid share link key in %s", path)
+		}
+		return key, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("failed to generate a share link key: %v", err)
+	}
+	if err := store.WriteFileAtomic(path, []byte(hex.EncodeToString(key)+"\n"), 0600); err != nil {
+		return nil, fmt.Errorf("failed to save the share link key: %v", err)
+	}
+	return key, nil
+}
+
+func (s *ShareStore) sign(link ShareLink) string {
+	mac := hmac.New(sha256.New, s.key)
+	fmt.Fprintf(mac, "%s\n%s\n%d\n%s", link.ID, link.Ticket, link.Expires.Unix(), strings.Join(link.Operators, ","))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// token is the part of a link's URL after /share/
+func (s *ShareStore) token(link ShareLink) string {
+	return link.ID + "." + s.sign(link)
+}
+
+// Create issues a link to a ticket that works for expiresIn, limited to
+// operators, normalized, when there are any
+func (s *ShareStore) Create(r *http.Request, ticket string, operators []string, expiresIn time.Duration) (ShareLink, error) {
+	now := s.clock.Now()
+	if len(operators) > 0 {
+		normalized := make([]string, len(operators))
+		for i, op := range operators {
+			normalized[i] = store.NormalizeOperator(op)
+		}
+		operators = normalized
+	}
+	link := ShareLink{
+		ID:        ids.Random.New()[:16],
+		Ticket:    ticket,
+		Operators: operators,
+		Created:   now,
+		CreatedBy: requestActor(r),
+		Expires:   now.Add(expiresIn).Truncate(time.Second),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.links[link.ID] = link
+	if err := s.save(); err != nil {
+		delete(s.links, link.ID)
+		return ShareLink{}, err
+	}
+	s.audit.Record(r, "share.create", ticket, map[string]interface{}{"id": link.ID, "operators": operators, "expires": link.Expires})
+	return link, nil
+}
+
+// List returns the links to a ticket, newest first
+func (s *ShareStore) List(ticket string) []ShareLink {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	links := []ShareLink{}
+	for _, link := range s.links {
+		if link.Ticket == ticket {
+			links = append(links, link)
+		}
+	}
+	sort.Slice(links, func(i, j int) bool { return links[i].Created.After(links[j].Created) })
+	return links
+}
+
+// Revoke stops a link to a ticket from working
+func (s *ShareStore) Revoke(r *http.Request, ticket, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	link, ok := s.links[id]
+	if !ok || link.Ticket != ticket {
+		return errShareNotFound
+	}
+	if link.Revoked == nil {
+		now := s.clock.Now()
+		link.Revoked = &now
+		s.links[id] = link
+		if err := s.save(); err != nil {
+			return err
+		}
+		s.audit.Record(r, "share.revoke", ticket, map[string]interface{}{"id": id})
+	}
+	return nil
+}
+
+// Resolve returns the link a token belongs to, as long as it works
+func (s *ShareStore) Resolve(token string) (ShareLink, error) {
+	id, sig, _ := strings.Cut(token, ".")
+
+	s.mu.Lock()
+	link, ok := s.links[id]
+	s.mu.Unlock()
+	if !ok || link.Revoked != nil || !hmac.Equal([]byte(sig), []byte(s.sign(link))) {
+		return ShareLink{}, errShareNotFound
+	}
+	if !s.clock.Now().Before(link.Expires) {
+		return ShareLink{}, errShareExpired
+	}
+	return link, nil
+}
+
+// save writes the links, dropping those that stopped working long ago. The
+// caller holds s.mu.
+func (s *ShareStore) save() error {
+	cutoff := s.clock.Now().Add(-shareRetention)
+	for id, link := range s.links {
+		if link.Expires.Before(cutoff) || (link.Revoked != nil && link.Revoked.Before(cutoff)) {
+			delete(s.links, id)
+		}
+	}
+	data, err := json.MarshalIndent(s.links, "", "    ")
+	if err != nil {
+		return err
+	}
+	return store.WriteFileAtomic(s.path, data, 0600)
+}
+
+// withURL sets the URL of a link that still works
+func (s *ShareStore) withURL(r *http.Request, link ShareLink) ShareLink {
+	if link.Revoked == nil && s.clock.Now().Before(link.Expires) {
+		link.URL = externalBaseURL(r) + "/share/" + s.token(link)
+	}
+	return link
+}
+
+// shareRequest is the body of POST /api/v1/tickets/{id}/shares
+type shareRequest struct {
+	ExpiresIn string   `json:"expiresIn"` // Such as 72h or 14d, 7d by default
+	Operators []string `json:"operators"`
+}
+
+// handleShares lists a ticket's links and creates new ones at
+// /api/v1/tickets/{id}/shares
+func (s *ShareStore) handleShares(state *AppState) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ticket, ok := state.Get(r.PathValue("id"))
+		if !ok {
+			api.WriteError(w, requestID(r), store.ErrTicketNotFound)
+			return
+		}
+
+		if r.Method == "GET" {
+			links := s.List(ticket.ID)
+			for i := range links {
+				links[i] = s.withURL(r, links[i])
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(links)
+			return
+		}
+
+		var req shareRequest
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				httpError(w, r, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		expiresIn := defaultShareExpiry
+		if req.ExpiresIn != "" {
+			d, err := policy.ParseDuration(req.ExpiresIn)
+			if err != nil || d <= 0 || d > maxShareExpiry {
+				httpError(w, r, fmt.Sprintf("expiresIn %q must be a duration such as 72h or 14d, at most %dd", req.ExpiresIn, int(maxShareExpiry.Hours()/24)), http.StatusBadRequest)
+				return
+			}
+			expiresIn = d
+		}
+		for _, op := range req.Operators {
+			if !slices.ContainsFunc(ticket.Operators, func(o store.Operator) bool { return sameOperator(o.Name, op) }) {
+				httpError(w, r, fmt.Sprintf("%s isn't on %s", op, ticket.ID), http.StatusBadRequest)
+				return
+			}
+		}
+
+		link, err := s.Create(r, ticket.ID, req.Operators, expiresIn)
+		if err != nil {
+			requestLogger(r).Error("Failed to save share link", "error", err)
+			httpError(w, r, "Failed to save share link", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(s.withURL(r, link))
+	}
+}
+
+// handleRevoke revokes a link at /api/v1/tickets/{id}/shares/{share}
+func (s *ShareStore) handleRevoke(w http.ResponseWriter, r *http.Request) {
+	if err := s.Revoke(r, r.PathValue("id"), r.PathValue("share")); err != nil {
+		if errors.Is(err, errShareNotFound) {
+			httpError(w, r, err.Error(), http.StatusNotFound)
+			return
+		}
+		requestLogger(r).Error("Failed to revoke share link", "error", err)
+		httpError(w, r, "Failed to revoke share link", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// sameOperator reports whether two operators are the same however they are
+// written, so links keep showing operators the inventory spells anew
+func sameOperator(a, b string) bool {
+	return strings.EqualFold(store.NormalizeOperator(a), store.NormalizeOperator(b))
+}
+
+// sharedTicket is what a share link shows of a ticket: when it was added, its
+// thresholds, and the operators of the link with their names, display names,
+// expected-by dates and criticality. It is built up from what may be shown,
+// rather than by clearing the rest, so nothing added to tickets later shows
+// up on shared pages by accident.
+func sharedTicket(ticket JiraTicket, link ShareLink) JiraTicket {
+	shown := JiraTicket{ID: ticket.ID, Added: ticket.Added, Thresholds: ticket.Thresholds, Archived: ticket.Archived}
+	for _, op := range ticket.Operators {
+		if len(link.Operators) > 0 && !slices.ContainsFunc(link.Operators, func(name string) bool { return sameOperator(name, op.Name) }) {
+			continue
+		}
+		shown.Operators = append(shown.Operators, store.Operator{Name: op.Name, DisplayName: op.DisplayName, ExpectedBy: op.ExpectedBy, Criticality: op.Criticality})
+		// The digests the table compares with
+		if digest, ok := ticket.Pins[op.Name]; ok {
+			if shown.Pins == nil {
+				shown.Pins = make(map[string]string)
+			}
+			shown.Pins[op.Name] = digest
+		}
+		if digest, ok := ticket.Baselines[op.Name]; ok {
+			if shown.Baselines == nil {
+				shown.Baselines = make(map[string]string)
+			}
+			shown.Baselines[op.Name] = digest
+		}
+	}
+	return shown
+}
+
+// handleView shows the status page of a ticket through a link at
+// /share/{token}, limited to the link's operators
+func (s *ShareStore) handleView(state *AppState, quay *QuayClient) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// The token is in the URL; keep it out of caches, referrers and search engines
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("Referrer-Policy", "no-referrer")
+		w.Header().Set("X-Robots-Tag", "noindex")
+		w.Header().Add("Vary", "Accept")
+		plain := prefersPlainText(r)
+
+		link, err := s.Resolve(r.PathValue("token"))
+		if errors.Is(err, errShareExpired) {
+			httpError(w, r, "This share link expired", http.StatusGone)
+			return
+		}
+		ticket, ok := state.Get(link.Ticket)
+		if err != nil || !ok {
+			httpError(w, r, errShareNotFound.Error(), http.StatusNotFound)
+			return
+		}
+
+		shown := sharedTicket(ticket, link)
+		page := newTicketPage(shown, api.TicketStatuses(quay, shown, localTime(state.clock.Now())), state.clock.Now())
+		page.Shared = &link
+		serveTicketPage(w, r, r.URL.Query(), page, plain)
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// defaultShutdownTimeout bounds how long in-flight requests and background
+// work get to finish after SIGINT or SIGTERM
+const defaultShutdownTimeout = 30 * time.Second
+
+// serve runs srv on l until SIGINT, SIGTERM or requestShutdown, then stops accepting
+// connections, waits for in-flight requests and runs cleanup, all within
+// timeout. It only returns once shutdown is complete; a server error is fatal.
+func serve(srv *http.Server, l net.Listener, timeout time.Duration, cleanup func(ctx context.Context)) {
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- srv.Serve(l)
+	}()
+
+	signals, stopSignals := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stopSignals()
+
+	select {
+	case err := <-serveErr:
+		fatal("Server stopped", "error", err)
+	case <-signals.Done():
+	case <-shutdownRequested:
+	}
+	// A second signal kills the process straight away
+	stopSignals()
+
+	slog.Info("Shutting down", "timeout", timeout)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := srv.Shutdown(ctx); err != nil {
+		slog.Warn("Requests still in flight at shutdown timeout", "error", err)
+	}
+	if err := <-serveErr; err != nil && !errors.Is(err, http.ErrServerClosed) {
+		slog.Error("Server error during shutdown", "error", err)
+	}
+
+	cleanup(ctx)
+	slog.Info("Shutdown complete")
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"OpTrack/internal/cosign"
+	"OpTrack/internal/registry"
+)
+
+// SignaturesConfig is how the cosign signatures of the latest image of each
+// operator are verified. Nothing is verified without keys or identities.
+type SignaturesConfig struct {
+	Registry string                  `yaml:"registry"` // Defaults to the host of quay.url
+	Username string                  `yaml:"username"`
+	Password string                  `yaml:"password"`
+	Timeout  Duration                `yaml:"timeout"`
+	Keys     []SignatureKeyConfig    `yaml:"keys"`
+	Keyless  KeylessSignaturesConfig `yaml:"keyless"`
+
+	Provenance ProvenanceConfig `yaml:"provenance"`
+}
+
+// ProvenanceConfig checks the SLSA provenance attested for the latest image
+// of each operator, signed by the same keys and identities as images
+type ProvenanceConfig struct {
+	Enabled  bool     `yaml:"enabled"`
+	Builders []string `yaml:"builders"` // Regular expressions of the builder IDs trusted; any builder when empty
+}
+
+// SignatureKeyConfig is a trusted cosign public key
+type SignatureKeyConfig struct {
+	Name string `yaml:"name"` // Defaults to the file name
+	Path string `yaml:"path"` // PEM file, as cosign generate-key-pair writes cosign.pub
+}
+
+// KeylessSignaturesConfig trusts keyless signatures by the identities listed
+// with a certificate issued by the Fulcio roots
+type KeylessSignaturesConfig struct {
+	Roots      string                    `yaml:"roots"` // PEM file with the Fulcio root and intermediate certificates
+	Identities []SignatureIdentityConfig `yaml:"identities"`
+}
+
+// SignatureIdentityConfig is a trusted keyless signer
+type SignatureIdentityConfig struct {
+	Subject       string `yaml:"subject"`       // Email address or URI, e.g. of a GitHub Actions workflow
+	SubjectRegexp string `yaml:"subjectRegexp"` // Instead of subject
+	Issuer        string `yaml:"issuer"`        // OIDC issuer, e.g. https://token.actions.githubusercontent.com
+}
+
+// enabled reports whether any signer is trusted
+func (c SignaturesConfig) enabled() bool {
+	return len(c.Keys) > 0 || len(c.Keyless.Identities) > 0
+}
+
+// name is how a key is reported as the signer
+func (k SignatureKeyConfig) name() string {
+	if k.Name != "" {
+		return k.Name
+	}
+	return strings.TrimSuffix(filepath.Base(k.Path), filepath.Ext(k.Path))
+}
+
+// newSignatureVerifier returns nil when no signer is trusted, and a nil
+// provenance verifier unless provenance is checked too
+func newSignatureVerifier(cfg SignaturesConfig, quay QuayConfig, traffic quayTraffic) (registry.SignatureVerifier, registry.ProvenanceVerifier, error) {
+	if !cfg.enabled() {
+		return nil, nil, nil
+	}
+	host, err := imageRegistry(cfg.Registry, quay)
+	if err != nil {
+		return nil, nil, err
+	}
+	opts := cosign.Options{Registry: host}
+	for _, k := range cfg.Keys {
+		data, err := os.ReadFile(k.Path)
+		if err != nil {
+			return nil, nil, err
+		}
+		key, err := cosign.ParsePublicKey(data)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %v", k.Path, err)
+		}
+		opts.Keys = append(opts.Keys, cosign.Key{Name: k.name(), Public: key})
+	}
+	if len(cfg.Keyless.Identities) > 0 {
+		data, err := os.ReadFile(cfg.Keyless.Roots)
+		if err != nil {
+			return nil, nil, err
+		}
+		if opts.Roots, err = cosign.ParseRoots(data); err != nil {
+			return nil, nil, fmt.Errorf("%s: %v", cfg.Keyless.Roots, err)
+		}
+		for _, id := range cfg.Keyless.Identities {
+			identity := cosign.Identity{Subject: id.Subject, Issuer: id.Issuer}
+			if id.SubjectRegexp != "" {
+				identity.SubjectRegexp = regexp.MustCompile(id.SubjectRegexp) // Checked by Validate
+			}
+			opts.Identities = append(opts.Identities, identity)
+		}
+	}
+	for _, b := range cfg.Provenance.Builders {
+		opts.Builders = append(opts.Builders, regexp.MustCompile(b)) // Checked by Validate
+	}
+	client := traffic.ociClient(cfg.Username, cfg.Password, cfg.Timeout)
+	verifier := cosign.NewVerifier(client, opts)
+	if !cfg.Provenance.Enabled {
+		return verifier, nil, nil
+	}
+	return verifier, verifier, nil
+}
+
+// provenanceState is the provenance column of an operator: its state and
+// builder or problem, or "" when provenance isn't checked
+func provenanceState(p *registry.Provenance) string {
+	switch {
+	case p == nil:
+		return ""
+	case p.Builder != "" && p.State == registry.Verified:
+		return p.State + " (" + p.Builder + ")"
+	case p.Error != "":
+		return p.State + ": " + p.Error
+	}
+	return p.State
+}
+
+// imageRegistry is the registry host the images of operators are pulled
+// from: host when set, else the host of quay.url
+func imageRegistry(host string, quay QuayConfig) (string, error) {
+	if host != "" {
+		return host, nil
+	}
+	u, err := url.Parse(quay.URL)
+	if err != nil {
+		return "", fmt.Errorf("no registry set and quay.url is invalid: %v", err)
+	}
+	return u.Host, nil
+}
+
+// signatureState is the signature column of an operator: its state and
+// signer or problem, or "" when signatures aren't verified
+func signatureState(s *registry.Signature) string {
+	switch {
+	case s == nil:
+		return ""
+	case s.Signer != "":
+		return s.State + " (" + s.Signer + ")"
+	case s.Error != "":
+		return s.State + ": " + s.Error
+	}
+	return s.State
+}
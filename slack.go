@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// SlackConfig holds the Slack credentials. Each one enables a feature: the
+// incoming webhook for channel notifications, the bot token for direct
+// messages and the signing secret for the slash command.
+type SlackConfig struct {
+	WebhookURL    string `yaml:"webhookURL"`
+	BotToken      string `yaml:"botToken"`
+	SigningSecret string `yaml:"signingSecret"`
+}
+
+// SlackNotifier posts messages to a Slack incoming webhook
+type SlackNotifier struct {
+	webhookURL string
+	client     *http.Client
+}
+
+func NewSlackNotifier(webhookURL string) *SlackNotifier {
+	return &SlackNotifier{
+		webhookURL: webhookURL,
+		client:     &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (n *SlackNotifier) Name() string {
+	return "slack"
+}
+
+func (n *SlackNotifier) Notify(ev Event) error {
+	return postJSON(n.client, n.webhookURL, slackMessage(ev))
+}
+
+func slackMessage(ev Event) map[string]interface{} {
+	var details strings.Builder
+	if ev.Type == EventDigest {
+		for _, e := range ev.Events {
+			fmt.Fprintf(&details, "• *%s* %s\n", eventTitle(e), eventSummary(e))
+		}
+	} else if ev.Operator != nil {
+		fmt.Fprintf(&details, "*Operator:* `%s`\n*Last Updated:* %s\n*SHA256:* `%s`",
+			ev.Operator.Name, localTime(ev.Operator.LastUpdated).Format(time.RFC1123), ev.Operator.SHA256)
+		if ev.Cluster != nil {
+			fmt.Fprintf(&details, "\n*Cluster:* %s", ev.Cluster.Cluster)
+		}
+	} else {
+		for _, status := range ev.Statuses {
+			fmt.Fprintf(&details, "• `%s` %s (`%s`)\n", status.Name, localTime(status.LastUpdated).Format("2006-01-02"), shortDigest(status.SHA256))
+		}
+	}
+
+	return map[string]interface{}{
+		"text": eventSummary(ev),
+		"blocks": []map[string]interface{}{
+			{
+				"type": "header",
+				"text": map[string]string{"type": "plain_text", "text": eventTitle(ev) + ": " + ev.Ticket.ID},
+			},
+			{
+				"type": "section",
+				"text": map[string]string{"type": "mrkdwn", "text": details.String()},
+			},
+		},
+	}
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"OpTrack/internal/api"
+	"OpTrack/internal/store"
+)
+
+// slackRequestMaxAge bounds how old a signed Slack request may be, to stop replays
+const slackRequestMaxAge = 5 * time.Minute
+
+// SlackCommandHandler serves the /optrack slash command. It answers 404 until a
+// signing secret is set.
+type SlackCommandHandler struct {
+	signingSecret atomic.Pointer[string]
+	state         *AppState
+	quay          *QuayClient
+	client        *http.Client
+}
+
+func NewSlackCommandHandler(state *AppState, qc *QuayClient) *SlackCommandHandler {
+	return &SlackCommandHandler{
+		state:  state,
+		quay:   qc,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// SetSigningSecret replaces the secret used to verify requests, "" to disable the command
+func (h *SlackCommandHandler) SetSigningSecret(secret string) {
+	h.signingSecret.Store(&secret)
+}
+
+// verifySlackSignature checks the X-Slack-Signature header against the raw body
+func verifySlackSignature(secret string, header http.Header, body []byte, now time.Time) error {
+	timestamp := header.Get("X-Slack-Request-Timestamp")
+	signature := header.Get("X-Slack-Signature")
+	if timestamp == "" || signature == "" {
+		return fmt.Errorf("missing signature headers")
+	}
+
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid timestamp")
+	}
+	if math.Abs(now.Sub(time.Unix(ts, 0)).Seconds()) > slackRequestMaxAge.Seconds() {
+		return fmt.Errorf("request timestamp too old")
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "v0:%s:", timestamp)
+	mac.Write(body)
+	expected := "v0=" + hex.EncodeToString(mac.Sum(nil))
+
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return fmt.Errorf("signature mismatch")
+	}
+	return nil
+}
+
+func (h *SlackCommandHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	secret := ""
+	if s := h.signingSecret.Load(); s != nil {
+		secret = *s
+	}
+	if secret == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	if r.Method != "POST" {
+		httpError(w, r, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		httpError(w, r, "Failed to read request", http.StatusBadRequest)
+		return
+	}
+
+	if err := verifySlackSignature(secret, r.Header, body, h.state.clock.Now()); err != nil {
+		requestLogger(r).Warn("Rejected Slack command", "error", err)
+		httpError(w, r, "Invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		httpError(w, r, "Invalid form body", http.StatusBadRequest)
+		return
+	}
+
+	args := strings.Fields(form.Get("text"))
+	if len(args) == 0 {
+		writeSlackResponse(w, slackText(slackUsage))
+		return
+	}
+
+	switch args[0] {
+	case "status":
+		if len(args) != 2 {
+			writeSlackResponse(w, slackText("Usage: `/optrack status <ticket>`"))
+			return
+		}
+		h.status(w, args[1], form.Get("response_url"))
+
+	case "add":
+		if len(args) < 3 {
+			writeSlackResponse(w, slackText("Usage: `/optrack add <ticket> <namespace/repository>...`"))
+			return
+		}
+		for _, operator := range args[2:] {
+			if len(strings.Split(operator, "/")) != 2 {
+				writeSlackResponse(w, slackText(fmt.Sprintf("`%s` is not in namespace/repository format", operator)))
+				return
+			}
+		}
+
+		if existing, ok := h.state.Get(args[1]); ok && slackRole(existing.Project) != roleEditor {
+			if slackRole(existing.Project) == roleNone {
+				writeSlackResponse(w, slackText(fmt.Sprintf("Ticket %s not found", args[1])))
+			} else {
+				writeSlackResponse(w, slackText(fmt.Sprintf("%s is in project %s, which can't be changed from Slack", args[1], existing.Project)))
+			}
+			return
+		}
+		ticket, err := h.state.addOperators(args[1], args[2:])
+		if errors.Is(err, store.ErrReadOnly) {
+			writeSlackResponse(w, slackText("Tickets are managed as OperatorTrackTicket resources and can't be changed from Slack"))
+			return
+		}
+		if errors.Is(err, store.ErrOperatorNotAllowed) {
+			writeSlackResponse(w, slackText(err.Error()))
+			return
+		}
+		if err != nil {
+			requestLogger(r).Error("Failed to save ticket from Slack", "ticket", args[1], "error", err)
+			writeSlackResponse(w, slackText("Failed to save ticket"))
+			return
+		}
+		requestLogger(r).Info("Operators added from Slack", "user", form.Get("user_name"), "ticket", ticket.ID, "operators", args[2:])
+		h.state.audit.RecordAs("slack:"+form.Get("user_name"), r, "ticket.add_operators", ticket.ID, map[string]interface{}{"operators": args[2:]})
+		writeSlackResponse(w, slackText(fmt.Sprintf("%s now tracks %d operators", ticket.ID, len(ticket.Operators))))
+
+	default:
+		writeSlackResponse(w, slackText(slackUsage))
+	}
+}
+
+// slackRole returns what Slack commands may do with the tickets of a
+// project. Slack users aren't the users of auth.actorHeaders, so they get
+// what everyone does: tickets without a project, and those of projects open
+// to everyone or with * as a member.
+func slackRole(project string) projectRole {
+	return projectAccess.Load().roleOf(anonymousActor, nil, project)
+}
+
+const slackUsage = "Usage:\n• `/optrack status <ticket>` - show operator freshness\n• `/optrack add <ticket> <namespace/repository>...` - track operators on a ticket"
+
+// status acknowledges immediately and posts the result to the response URL,
+// because Quay lookups can exceed Slack's three second deadline
+func (h *SlackCommandHandler) status(w http.ResponseWriter, ticketID, responseURL string) {
+	ticket, exists := h.state.Get(ticketID)
+
+	if !exists || slackRole(ticket.Project) == roleNone {
+		writeSlackResponse(w, slackText(fmt.Sprintf("Ticket %s not found", ticketID)))
+		return
+	}
+
+	if responseURL == "" {
+		writeSlackResponse(w, slackStatusMessage(ticket, api.TicketStatuses(h.quay, ticket, localTime(h.state.clock.Now())), h.state.clock.Now()))
+		return
+	}
+
+	writeSlackResponse(w, slackText(fmt.Sprintf("Checking %d operators on %s...", len(ticket.Operators), ticket.ID)))
+	go func() {
+		msg := slackStatusMessage(ticket, api.TicketStatuses(h.quay, ticket, localTime(h.state.clock.Now())), h.state.clock.Now())
+		msg["replace_original"] = true
+		if err := postJSON(h.client, responseURL, msg); err != nil {
+			slog.Error("Failed to post Slack status response", "ticket", ticket.ID, "error", err)
+		}
+	}()
+}
+
+func slackText(text string) map[string]interface{} {
+	return map[string]interface{}{
+		"response_type": "ephemeral",
+		"text":          text,
+	}
+}
+
+// slackStatusMessage formats ticket statuses as Block Kit blocks
+func slackStatusMessage(ticket JiraTicket, statuses []OperatorStatus, now time.Time) map[string]interface{} {
+	var lines bytes.Buffer
+	warning, stale := ticketThresholds(ticket)
+	for _, status := range statuses {
+		if status.Status != "OK" {
+			fmt.Fprintf(&lines, ":x: `%s` %s\n", status.Name, status.Status)
+			continue
+		}
+
+		age := now.Sub(status.LastUpdated)
+		days := int(age.Hours() / 24)
+		icon := ":white_check_mark:"
+		if age >= stale {
+			icon = ":red_circle:"
+		} else if age >= warning {
+			icon = ":warning:"
+		}
+		rebuilt := ""
+		if isRebuilt(ticket, status) {
+			rebuilt = " (rebuilt)"
+		}
+		fmt.Fprintf(&lines, "%s `%s` %d days old, `%s`%s\n", icon, status.Name, days, shortDigest(status.SHA256), rebuilt)
+	}
+	if lines.Len() == 0 {
+		lines.WriteString("No operators tracked")
+	}
+
+	return map[string]interface{}{
+		"response_type": "ephemeral",
+		"text":          fmt.Sprintf("Status for %s", ticket.ID),
+		"blocks": []map[string]interface{}{
+			{
+				"type": "header",
+				"text": map[string]string{"type": "plain_text", "text": "Status for " + ticket.ID},
+			},
+			{
+				"type": "section",
+				"text": map[string]string{"type": "mrkdwn", "text": lines.String()},
+			},
+		},
+	}
+}
+
+func writeSlackResponse(w http.ResponseWriter, msg map[string]interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(msg)
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"OpTrack/internal/clock"
+)
+
+// sloWindows are the rolling windows reported for the Quay.io dependency
+var sloWindows = []struct {
+	Name     string
+	Duration time.Duration
+}{
+	{"5m", 5 * time.Minute},
+	{"1h", time.Hour},
+	{"24h", 24 * time.Hour},
+}
+
+// sloLatencyBounds are the upper bounds of the latency buckets used to
+// estimate percentiles, in seconds
+var sloLatencyBounds = []float64{
+	0.01, 0.015, 0.02, 0.03, 0.05, 0.075, 0.1, 0.15, 0.2, 0.3, 0.5, 0.75,
+	1, 1.5, 2, 3, 5, 7.5, 10, 15, 20, 30,
+}
+
+// sloBucketCount is one bucket per minute for the longest window
+const sloBucketCount = 24 * 60
+
+type sloBucket struct {
+	minute  int64 // Unix minute this bucket holds, stale buckets are ignored
+	total   uint64
+	failed  uint64
+	latency []uint64 // Per sloLatencyBounds, plus one overflow bucket
+}
+
+// SLOTracker keeps per-minute success and latency counts for a dependency
+// so availability and latency percentiles can be computed over rolling windows
+type SLOTracker struct {
+	mu      sync.Mutex
+	buckets []sloBucket
+	clock   clock.Clock
+}
+
+func NewSLOTracker(clk clock.Clock) *SLOTracker {
+	buckets := make([]sloBucket, sloBucketCount)
+	for i := range buckets {
+		buckets[i].minute = -1
+		buckets[i].latency = make([]uint64, len(sloLatencyBounds)+1)
+	}
+	return &SLOTracker{buckets: buckets, clock: clock.Or(clk)}
+}
+
+func (t *SLOTracker) Record(at time.Time, latency time.Duration, ok bool) {
+	minute := at.Unix() / 60
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	b := &t.buckets[minute%sloBucketCount]
+	if b.minute != minute {
+		b.minute = minute
+		b.total, b.failed = 0, 0
+		for i := range b.latency {
+			b.latency[i] = 0
+		}
+	}
+
+	b.total++
+	if !ok {
+		b.failed++
+	}
+
+	seconds := latency.Seconds()
+	i := 0
+	for i < len(sloLatencyBounds) && seconds > sloLatencyBounds[i] {
+		i++
+	}
+	b.latency[i]++
+}
+
+// SLOWindow summarizes a dependency over one rolling window
+type SLOWindow struct {
+	Window       string   `json:"window"`
+	Requests     uint64   `json:"requests"`
+	Failures     uint64   `json:"failures"`
+	Availability *float64 `json:"availability,omitempty"` // Unset when there were no requests
+	P95Seconds   *float64 `json:"p95Seconds,omitempty"`
+}
+
+// Window aggregates the buckets that fall within d of now
+func (t *SLOTracker) Window(name string, now time.Time, d time.Duration) SLOWindow {
+	current := now.Unix() / 60
+	oldest := current - int64(d/time.Minute) + 1
+
+	t.mu.Lock()
+	latency := make([]uint64, len(sloLatencyBounds)+1)
+	w := SLOWindow{Window: name}
+	for _, b := range t.buckets {
+		if b.minute < oldest || b.minute > current {
+			continue
+		}
+		w.Requests += b.total
+		w.Failures += b.failed
+		for i, n := range b.latency {
+			latency[i] += n
+		}
+	}
+	t.mu.Unlock()
+
+	if w.Requests == 0 {
+		return w
+	}
+
+	availability := float64(w.Requests-w.Failures) / float64(w.Requests)
+	p95 := percentile(latency, w.Requests, 0.95)
+	w.Availability = &availability
+	w.P95Seconds = &p95
+	return w
+}
+
+// Current returns the summaries for every configured window up to now
+func (t *SLOTracker) Current() []SLOWindow {
+	return t.Windows(t.clock.Now())
+}
+
+// Windows returns the summaries for every configured window
+func (t *SLOTracker) Windows(now time.Time) []SLOWindow {
+	windows := make([]SLOWindow, 0, len(sloWindows))
+	for _, w := range sloWindows {
+		windows = append(windows, t.Window(w.Name, now, w.Duration))
+	}
+	return windows
+}
+
+// percentile estimates the q-th percentile from bucket counts by linear
+// interpolation within the bucket that contains it
+func percentile(counts []uint64, total uint64, q float64) float64 {
+	rank := q * float64(total)
+	var cumulative float64
+	for i, n := range counts {
+		if n == 0 {
+			continue
+		}
+		if cumulative+float64(n) >= rank {
+			if i >= len(sloLatencyBounds) {
+				return sloLatencyBounds[len(sloLatencyBounds)-1]
+			}
+			lower := 0.0
+			if i > 0 {
+				lower = sloLatencyBounds[i-1]
+			}
+			upper := sloLatencyBounds[i]
+			return lower + (upper-lower)*(rank-cumulative)/float64(n)
+		}
+		cumulative += float64(n)
+	}
+	return sloLatencyBounds[len(sloLatencyBounds)-1]
+}
+
+// quaySLO tracks the Quay.io API as seen by OpTrack
+var quaySLO = NewSLOTracker(clock.System)
+
+func init() {
+	NewGaugeFunc("optrack_quay_availability_ratio",
+		"Share of Quay.io API requests that succeeded (no transport error, 5xx or 429) over a rolling window.",
+		[]string{"window"}, func() []LabeledValue {
+			var values []LabeledValue
+			for _, w := range quaySLO.Current() {
+				if w.Availability != nil {
+					values = append(values, LabeledValue{Labels: []string{w.Window}, Value: *w.Availability})
+				}
+			}
+			return values
+		})
+	NewGaugeFunc("optrack_quay_latency_p95_seconds",
+		"Estimated 95th percentile Quay.io API latency over a rolling window.",
+		[]string{"window"}, func() []LabeledValue {
+			var values []LabeledValue
+			for _, w := range quaySLO.Current() {
+				if w.P95Seconds != nil {
+					values = append(values, LabeledValue{Labels: []string{w.Window}, Value: *w.P95Seconds})
+				}
+			}
+			return values
+		})
+	NewGaugeFunc("optrack_quay_window_requests",
+		"Quay.io API requests made over a rolling window.",
+		[]string{"window"}, func() []LabeledValue {
+			var values []LabeledValue
+			for _, w := range quaySLO.Current() {
+				values = append(values, LabeledValue{Labels: []string{w.Window}, Value: float64(w.Requests)})
+			}
+			return values
+		})
+}
@@ -0,0 +1,449 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"OpTrack/internal/clock"
+	"OpTrack/internal/cve"
+	"OpTrack/internal/registry"
+	"OpTrack/internal/store"
+)
+
+// AppState maintains the application's state in memory.
+//
+// Readers never wait: they get an immutable snapshot of all tickets, indexed
+// by operator, see ticketSnapshot. Writers
+// take the lock of the ticket they change for the disk write, then briefly
+// take publishMu to swap in a new snapshot, so a slow save blocks neither
+// reads nor changes to other tickets.
+//
+// Published tickets have the members of their operator groups among their
+// operators, which are saved without them, and every operator spelled as in
+// the operator inventory.
+type AppState struct {
+	snapshot    atomic.Pointer[ticketSnapshot] // Never modified once published
+	dataDir     string
+	store       *store.FileStore
+	audit       *AuditLog
+	groups      *GroupStore
+	inventory   *InventoryStore
+	comments    *CommentStore
+	annotations *AnnotationStore
+	templates   *TemplateStore
+	prefs       *PreferenceStore
+	clock       clock.Clock // Dates new tickets and is the poller's notion of now
+
+	// readOnly, when set, is returned for every change made through Put,
+	// Delete and addOperators, because something else owns the tickets. Set
+	// before the state is shared.
+	readOnly error
+
+	ticketLocks sync.Map // Ticket ID -> *sync.Mutex
+	publishMu   sync.Mutex
+	quotaMu     sync.Mutex // Held from checking a ticket against the quotas until it is published
+}
+
+func NewAppState(dataDir string, clk clock.Clock) (*AppState, error) {
+	files, err := store.OpenFileStore(dataDir)
+	if err != nil {
+		return nil, err
+	}
+
+	audit, err := NewAuditLog(dataDir, clk)
+	if err != nil {
+		return nil, err
+	}
+
+	groups, err := NewGroupStore(dataDir, audit, clk)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load operator groups: %v", err)
+	}
+
+	inventory, err := NewInventoryStore(dataDir, audit, clk)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the operator inventory: %v", err)
+	}
+
+	comments, err := NewCommentStore(dataDir, clk)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load ticket comments: %v", err)
+	}
+
+	annotations, err := NewAnnotationStore(dataDir, audit, clk)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load digest annotations: %v", err)
+	}
+
+	templates, err := NewTemplateStore(dataDir, audit, clk)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load ticket templates: %v", err)
+	}
+
+	prefs, err := NewPreferenceStore(dataDir, clk)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load user preferences: %v", err)
+	}
+
+	tickets, err := files.Load()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load tickets: %v", err)
+	}
+
+	state := &AppState{
+		dataDir:     dataDir,
+		store:       files,
+		audit:       audit,
+		groups:      groups,
+		inventory:   inventory,
+		comments:    comments,
+		annotations: annotations,
+		templates:   templates,
+		prefs:       prefs,
+		clock:       clk,
+	}
+	state.snapshot.Store(state.expandAll(tickets))
+	state.recordOperators(sortedTickets(state.List())...)
+	groups.onChange = state.refresh
+	inventory.onChange = state.refresh
+	return state, nil
+}
+
+// expandAll adds the members of their groups to the operators of tickets,
+// spells them as in the inventory and gives them their criticality and
+// owners, returning a new snapshot
+func (s *AppState) expandAll(tickets map[string]JiraTicket) *ticketSnapshot {
+	next := make(map[string]JiraTicket, len(tickets))
+	for id, ticket := range tickets {
+		next[id] = s.inventory.annotate(s.inventory.canonicalize(expandGroups(ticket, s.groups)))
+	}
+	return newTicketSnapshot(next)
+}
+
+// refresh expands every ticket again after a group changed or an operator
+// was renamed, or given another criticality or owners, in the inventory
+func (s *AppState) refresh() {
+	s.publishMu.Lock()
+	next := s.expandAll(s.List())
+	s.snapshot.Store(next)
+	s.publishMu.Unlock()
+	s.recordOperators(sortedTickets(next.all())...)
+}
+
+// recordOperators adds the operators of tickets that are new to the
+// inventory. Failing to doesn't undo the change that brought them; they are
+// added on the next reload instead.
+func (s *AppState) recordOperators(tickets ...JiraTicket) {
+	if err := s.inventory.record(tickets...); err != nil {
+		slog.Warn("Failed to add operators to the inventory", "error", err)
+	}
+}
+
+// Reload replaces the tickets with those in the data directory, picking up
+// changes other replicas sharing it have made
+func (s *AppState) Reload() error {
+	// Held across the load so a change saved meanwhile is published after
+	// the reloaded tickets rather than lost under them
+	s.publishMu.Lock()
+	defer s.publishMu.Unlock()
+
+	if err := s.groups.load(); err != nil {
+		return err
+	}
+	if err := s.inventory.load(); err != nil {
+		return err
+	}
+	if err := s.comments.load(); err != nil {
+		return err
+	}
+	if err := s.annotations.load(); err != nil {
+		return err
+	}
+	if err := s.templates.load(); err != nil {
+		return err
+	}
+	if err := s.prefs.load(); err != nil {
+		return err
+	}
+	tickets, err := s.store.Load()
+	if err != nil {
+		return err
+	}
+	next := s.expandAll(tickets)
+	s.snapshot.Store(next)
+	s.recordOperators(sortedTickets(next.all())...)
+	return nil
+}
+
+// List returns every ticket, keyed by ID. The map is shared and must not be
+// modified. After a change it is gathered again on first use, so code that
+// needs one ticket or the count should use Get or Len.
+func (s *AppState) List() map[string]JiraTicket {
+	return s.snapshot.Load().all()
+}
+
+// Tracking returns the IDs of the tickets tracking an operator, in any
+// spelling and including through groups, sorted. The slice is shared and
+// must not be modified.
+func (s *AppState) Tracking(operator string) []string {
+	return slices.Clip(s.snapshot.Load().byOperator.get(strings.ToLower(operator)))
+}
+
+// Len returns the number of tickets
+func (s *AppState) Len() int {
+	return s.snapshot.Load().count
+}
+
+func (s *AppState) Get(id string) (JiraTicket, bool) {
+	return s.snapshot.Load().get(id)
+}
+
+// Put saves a ticket, replacing any ticket with the same ID
+func (s *AppState) Put(ticket JiraTicket) (bool, error) {
+	if s.readOnly != nil {
+		return false, s.readOnly
+	}
+	return s.put(ticket)
+}
+
+// Create saves a new ticket, failing with store.ErrTicketExists when a ticket
+// with the same ID is already saved
+func (s *AppState) Create(ticket JiraTicket) error {
+	if s.readOnly != nil {
+		return s.readOnly
+	}
+	_, err := s.save(ticket, true)
+	return err
+}
+
+func (s *AppState) put(ticket JiraTicket) (bool, error) {
+	return s.save(ticket, false)
+}
+
+// save saves a ticket, unless one with the same ID is saved and onlyNew is set
+func (s *AppState) save(ticket JiraTicket, onlyNew bool) (bool, error) {
+	unlock := s.lockTicket(ticket.ID)
+	defer unlock()
+
+	old, existed := s.Get(ticket.ID)
+	if existed && onlyNew {
+		return true, fmt.Errorf("%w: %s", store.ErrTicketExists, ticket.ID)
+	}
+	var replaced *JiraTicket
+	if existed {
+		replaced = &old
+	}
+	now := s.clock.Now()
+	ticket.Updated, ticket.Archived, ticket.Rollup = &now, old.Archived, ""
+	if existed && ticket.Added.Equal(old.Added) {
+		ticket.Rollup = old.Rollup // Still tracking from the same time
+	}
+	if ticket.Project == "" {
+		ticket.Project = old.Project // Tickets only leave a project for another
+	}
+	if err := normalizeTicket(&ticket); err != nil {
+		return existed, err
+	}
+	ticket = s.inventory.canonicalize(ticket)
+	if err := checkGroups(ticket, s.groups); err != nil {
+		return existed, err
+	}
+	if err := checkNewOperators(ticket, replaced); err != nil {
+		return existed, err
+	}
+	if err := checkProject(ticket, replaced); err != nil {
+		return existed, err
+	}
+	release, err := s.checkLimits(ticket, replaced)
+	if err != nil {
+		return existed, err
+	}
+	defer release()
+	if err := s.store.Save(ticket); err != nil {
+		return existed, err
+	}
+	s.publish(ticket.ID, &ticket)
+	s.recordOperators(ticket)
+	return existed, nil
+}
+
+// normalizeTicket drops the operators a ticket has through groups, cleans
+// up and merges repeated operators, upper-cases its CVEs, cleans up its
+// labels, moves the digests its operators are pinned to into Pins and checks
+// its thresholds
+func normalizeTicket(ticket *JiraTicket) error {
+	ticket.Operators, _ = store.NormalizeOperators(ownOperators(ticket.Operators))
+	if err := store.CheckExpectedBy(ticket.Operators); err != nil {
+		return err
+	}
+	cves, err := cve.Normalize(ticket.CVEs)
+	if err != nil {
+		return err
+	}
+	labels, err := store.NormalizeLabels(ticket.Labels)
+	if err != nil {
+		return err
+	}
+	ticket.Labels = labels
+	ticket.Description = strings.TrimSpace(ticket.Description)
+	operators, pins, err := registry.SplitPins(ticket.OperatorNames(), ticket.Pins)
+	if err != nil {
+		return err
+	}
+	ticket.SetOperatorNames(operators)
+	ticket.CVEs, ticket.Pins = cves, pins
+	return checkThresholds(ticket)
+}
+
+// Delete removes a ticket, returning store.ErrTicketNotFound for unknown IDs
+func (s *AppState) Delete(id string) error {
+	if s.readOnly != nil {
+		return s.readOnly
+	}
+	return s.delete(id)
+}
+
+func (s *AppState) delete(id string) error {
+	unlock := s.lockTicket(id)
+	defer unlock()
+
+	if _, ok := s.Get(id); !ok {
+		return store.ErrTicketNotFound
+	}
+	if err := s.store.Delete(id); err != nil {
+		return err
+	}
+	s.publish(id, nil)
+	if err := s.comments.deleteTicket(id); err != nil {
+		slog.Warn("Failed to delete the comments of a deleted ticket", "ticket", id, "error", err)
+	}
+	if err := s.prefs.deleteTicket(id); err != nil {
+		slog.Warn("Failed to unstar a deleted ticket", "ticket", id, "error", err)
+	}
+	return nil
+}
+
+// addOperators appends operators to a ticket, creating the ticket if it
+// doesn't exist yet. Operators already on the ticket are skipped.
+func (s *AppState) addOperators(ticketID string, operators []string) (JiraTicket, error) {
+	if s.readOnly != nil {
+		return JiraTicket{}, s.readOnly
+	}
+	unlock := s.lockTicket(ticketID)
+	defer unlock()
+
+	old, exists := s.Get(ticketID)
+	ticket := old
+	var replaced *JiraTicket
+	if exists {
+		replaced = &old
+	} else {
+		ticket = JiraTicket{ID: ticketID, Added: s.clock.Now()}
+	}
+	operators, pins, err := registry.SplitPins(operators, nil)
+	if err != nil {
+		return JiraTicket{}, err
+	}
+	for i, operator := range operators {
+		operators[i] = s.inventory.canonical(operator)
+		if digest, ok := pins[operator]; ok {
+			delete(pins, operator)
+			pins[operators[i]] = digest
+		}
+	}
+	if err := checkNewOperators(JiraTicket{Operators: store.OperatorsNamed(operators)}, &ticket); err != nil {
+		return JiraTicket{}, err
+	}
+	// Copy so the published ticket isn't changed in place
+	ticket.Operators = slices.Clone(ownOperators(ticket.Operators))
+	if len(pins) > 0 {
+		ticket.Pins = maps.Clone(ticket.Pins)
+		if ticket.Pins == nil {
+			ticket.Pins = make(map[string]string)
+		}
+		maps.Copy(ticket.Pins, pins)
+	}
+
+	for _, operator := range operators {
+		if _, found := ticket.Operator(operator); !found {
+			ticket.Operators = append(ticket.Operators, store.Operator{Name: operator})
+			ticket.Rollup = "" // Until the poller checks the new operators
+		}
+	}
+	release, err := s.checkLimits(ticket, replaced)
+	if err != nil {
+		return JiraTicket{}, err
+	}
+	defer release()
+	now := s.clock.Now()
+	ticket.Updated = &now
+
+	if err := s.store.Save(ticket); err != nil {
+		return ticket, err
+	}
+	s.publish(ticketID, &ticket)
+	s.recordOperators(ticket)
+	return ticket, nil
+}
+
+// Archive archives or unarchives a ticket, reporting whether that changed it.
+// Unarchiving counts as a change to the ticket, so that it isn't archived
+// again straight away for being untouched.
+func (s *AppState) Archive(id string, archived bool) (JiraTicket, bool, error) {
+	if s.readOnly != nil {
+		return JiraTicket{}, false, s.readOnly
+	}
+	unlock := s.lockTicket(id)
+	defer unlock()
+
+	ticket, ok := s.Get(id)
+	if !ok {
+		return JiraTicket{}, false, store.ErrTicketNotFound
+	}
+	if (ticket.Archived != nil) == archived {
+		return ticket, false, nil
+	}
+	old := ticket
+	now := s.clock.Now()
+	if archived {
+		ticket.Archived = &now
+	} else {
+		ticket.Archived, ticket.Updated = nil, &now
+		release, err := s.checkLimits(ticket, &old)
+		if err != nil {
+			return old, false, err
+		}
+		defer release()
+	}
+	ticket.Operators = ownOperators(ticket.Operators)
+	if err := s.store.Save(ticket); err != nil {
+		return ticket, false, err
+	}
+	s.publish(id, &ticket)
+	return ticket, true, nil
+}
+
+// lockTicket serializes changes to one ticket and returns the unlock function
+func (s *AppState) lockTicket(id string) func() {
+	mu, _ := s.ticketLocks.LoadOrStore(id, &sync.Mutex{})
+	mu.(*sync.Mutex).Lock()
+	return mu.(*sync.Mutex).Unlock
+}
+
+// publish swaps in a snapshot with ticket id set, or removed when ticket is
+// nil. The ticket is expanded with its groups, spelled as in the inventory
+// and given the criticality of its operators in place.
+func (s *AppState) publish(id string, ticket *JiraTicket) {
+	s.publishMu.Lock()
+	defer s.publishMu.Unlock()
+
+	if ticket != nil {
+		*ticket = s.inventory.annotate(s.inventory.canonicalize(expandGroups(*ticket, s.groups)))
+	}
+	s.snapshot.Store(s.snapshot.Load().with(id, ticket))
+}
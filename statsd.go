@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// statsdFlushInterval is how often metrics are sent to statsd
+const statsdFlushInterval = 10 * time.Second
+
+// statsdMaxPacket keeps UDP datagrams below a typical network MTU
+const statsdMaxPacket = 1432
+
+// StatsdEmitter periodically mirrors the Prometheus registry to a statsd or
+// DogStatsD agent. Counters are sent as deltas since the previous flush.
+type StatsdEmitter struct {
+	conn      net.Conn
+	prefix    string
+	tags      []string
+	dogstatsd bool
+	registry  *MetricsRegistry
+	interval  time.Duration
+
+	last map[string]float64 // Previous counter values by metric line key
+}
+
+// StatsdEmitterFromEnv reads OPTRACK_STATSD_ADDR, OPTRACK_STATSD_PREFIX,
+// OPTRACK_STATSD_TAGS (comma separated key:value pairs) and OPTRACK_STATSD_FLAVOR
+// (dogstatsd or statsd). It returns nil if no address is configured.
+func StatsdEmitterFromEnv(registry *MetricsRegistry) (*StatsdEmitter, error) {
+	addr := os.Getenv("OPTRACK_STATSD_ADDR")
+	if addr == "" {
+		return nil, nil
+	}
+
+	dogstatsd := true
+	switch flavor := strings.ToLower(os.Getenv("OPTRACK_STATSD_FLAVOR")); flavor {
+	case "", "dogstatsd":
+	case "statsd":
+		dogstatsd = false
+	default:
+		return nil, fmt.Errorf("invalid OPTRACK_STATSD_FLAVOR %q: use dogstatsd or statsd", flavor)
+	}
+
+	var tags []string
+	for _, tag := range strings.Split(os.Getenv("OPTRACK_STATSD_TAGS"), ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	if len(tags) > 0 && !dogstatsd {
+		return nil, fmt.Errorf("OPTRACK_STATSD_TAGS requires the dogstatsd flavor")
+	}
+
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve statsd address %q: %v", addr, err)
+	}
+
+	return &StatsdEmitter{
+		conn:      conn,
+		prefix:    os.Getenv("OPTRACK_STATSD_PREFIX"),
+		tags:      tags,
+		dogstatsd: dogstatsd,
+		registry:  registry,
+		interval:  statsdFlushInterval,
+		last:      make(map[string]float64),
+	}, nil
+}
+
+// Run flushes on every interval until stop is closed
+func (e *StatsdEmitter) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			e.flush()
+		case <-stop:
+			e.flush()
+			return
+		}
+	}
+}
+
+func (e *StatsdEmitter) flush() {
+	var packet bytes.Buffer
+	send := func() {
+		if packet.Len() == 0 {
+			return
+		}
+		if _, err := e.conn.Write(packet.Bytes()); err != nil {
+			slog.Debug("Failed to send statsd packet", "error", err)
+		}
+		packet.Reset()
+	}
+
+	for _, s := range e.registry.collect() {
+		line, ok := e.format(s)
+		if !ok {
+			continue
+		}
+		if packet.Len() > 0 && packet.Len()+1+len(line) > statsdMaxPacket {
+			send()
+		}
+		if packet.Len() > 0 {
+			packet.WriteByte('\n')
+		}
+		packet.WriteString(line)
+	}
+	send()
+}
+
+// format renders a sample as a statsd line, returning false for counters
+// that have not changed since the last flush
+func (e *StatsdEmitter) format(s metricSample) (string, bool) {
+	name := e.prefix + s.Name
+	var tags []string
+	if e.dogstatsd {
+		tags = append(tags, e.tags...)
+		for i, label := range s.LabelNames {
+			tags = append(tags, label+":"+s.Labels[i])
+		}
+	} else {
+		// Plain statsd has no tags, so label values become name segments
+		for _, value := range s.Labels {
+			name += "." + sanitizeStatsdName(value)
+		}
+	}
+
+	value, kind := s.Value, "g"
+	if s.Kind == "counter" {
+		key := name + "|" + strings.Join(s.Labels, "\xff")
+		delta := s.Value - e.last[key]
+		e.last[key] = s.Value
+		if delta <= 0 {
+			return "", false
+		}
+		value, kind = delta, "c"
+	}
+
+	line := name + ":" + strconv.FormatFloat(value, 'f', -1, 64) + "|" + kind
+	if len(tags) > 0 {
+		line += "|#" + strings.Join(tags, ",")
+	}
+	return line, true
+}
+
+func sanitizeStatsdName(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-' {
+			return r
+		}
+		return '_'
+	}, s)
+}
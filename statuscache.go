@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"OpTrack/internal/registry"
+	"OpTrack/internal/store"
+)
+
+// defaultStaleTTL covers a deploy or restart, so the first page views after
+// it are answered from the saved cache rather than a lookup of every operator
+const defaultStaleTTL = 10 * time.Minute
+
+// statusCache saves the Quay.io status cache to dataDir/settings after every
+// poll cycle and on shutdown, and loads it at startup. Loaded entries have
+// usually expired, and are answered while they are stale, see
+// QuayConfig.StaleTTL, while they are looked up again in the background.
+type statusCache struct {
+	path string
+	quay *QuayClient
+}
+
+// newStatusCache loads the saved cache into quay, returning nil when entries
+// can't be answered stale so there is no point in saving them
+func newStatusCache(dataDir string, cfg QuayConfig, quay *QuayClient) (*statusCache, error) {
+	if cfg.CacheTTL <= 0 || cfg.StaleTTL <= 0 {
+		return nil, nil
+	}
+	dir, err := store.SettingsDir(dataDir)
+	if err != nil {
+		return nil, err
+	}
+	c := &statusCache{path: filepath.Join(dir, "status-cache.json"), quay: quay}
+	data, err := os.ReadFile(c.path)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entries []registry.CacheEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		// Only a cache: start without it rather than refusing to start
+		slog.Warn("Ignoring the saved status cache", "path", c.path, "error", err)
+		return c, nil
+	}
+	if n := quay.LoadCache(entries); n > 0 {
+		slog.Info("Loaded the saved status cache", "operators", n)
+	}
+	return c, nil
+}
+
+// save writes the cached statuses, logging failures since the cache is
+// rebuilt by polling anyway
+func (c *statusCache) save() {
+	if err := c.write(); err != nil {
+		slog.Warn("Failed to save the status cache", "path", c.path, "error", err)
+	}
+}
+
+func (c *statusCache) write() error {
+	data, err := json.Marshal(c.quay.CacheEntries())
+	if err != nil {
+		return err
+	}
+	if err := store.WriteFileAtomic(c.path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %v", c.path, err)
+	}
+	return nil
+}
@@ -0,0 +1,423 @@
+package main
+
+import (
+	"cmp"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"OpTrack/internal/api"
+	"OpTrack/internal/clock"
+	"OpTrack/internal/store"
+)
+
+// statusColumn is a column of the status table shared by the ticket page,
+// the report, the CSV export and the table API
+type statusColumn struct {
+	Key   string
+	Title string
+	// shown reports whether the column is in the default table, for the
+	// columns only filled in when the server checks them; nil for always
+	shown func(page ticketPage) bool
+	cell  func(row ticketPageRow, loc *time.Location) statusCell
+	// compare orders rows for sorting; nil compares the cell text
+	compare func(a, b ticketPageRow) int
+}
+
+// statusCell is one cell of the status table, with the CSS class it is shown with
+type statusCell struct {
+	Text  string
+	Class string
+}
+
+// statusColumns are the columns of the status table, in their default order.
+// Owner, Note, Team, Criticality, Expected By and Pin are shown when an
+// operator has one, and
+// Build only when asked for.
+var statusColumns = []statusColumn{
+	{Key: "operator", Title: "Operator",
+		cell: func(r ticketPageRow, _ *time.Location) statusCell {
+			if r.DisplayName != "" {
+				return statusCell{Text: r.DisplayName + " (" + r.Name + ")"}
+			}
+			return statusCell{Text: r.Name}
+		},
+		compare: func(a, b ticketPageRow) int { return strings.Compare(a.Name, b.Name) },
+	},
+	{Key: "owner", Title: "Owner",
+		shown: func(p ticketPage) bool {
+			return slices.ContainsFunc(p.Rows, func(r ticketPageRow) bool { return r.Owner != "" })
+		},
+		cell: func(r ticketPageRow, _ *time.Location) statusCell { return statusCell{Text: r.Owner} },
+	},
+	{Key: "note", Title: "Note",
+		shown: func(p ticketPage) bool {
+			return slices.ContainsFunc(p.Rows, func(r ticketPageRow) bool { return r.Note != "" })
+		},
+		cell: func(r ticketPageRow, _ *time.Location) statusCell { return statusCell{Text: r.Note} },
+	},
+	{Key: "team", Title: "Team",
+		shown: func(p ticketPage) bool {
+			return slices.ContainsFunc(p.Rows, func(r ticketPageRow) bool { return r.Team != "" })
+		},
+		cell: func(r ticketPageRow, _ *time.Location) statusCell {
+			if r.Contact != "" {
+				return statusCell{Text: r.Team + " (" + r.Contact + ")"}
+			}
+			return statusCell{Text: r.Team}
+		},
+		compare: func(a, b ticketPageRow) int { return strings.Compare(a.Team, b.Team) },
+	},
+	{Key: "criticality", Title: "Criticality",
+		shown: func(p ticketPage) bool {
+			return slices.ContainsFunc(p.Rows, func(r ticketPageRow) bool { return r.Criticality != "" })
+		},
+		cell: func(r ticketPageRow, _ *time.Location) statusCell {
+			if r.Criticality == "critical" {
+				return statusCell{Text: r.Criticality, Class: "error"}
+			}
+			return statusCell{Text: r.Criticality}
+		},
+		compare: func(a, b ticketPageRow) int {
+			return cmp.Compare(criticalityRank(a.Criticality), criticalityRank(b.Criticality))
+		},
+	},
+	{Key: "expectedBy", Title: "Expected By",
+		shown: func(p ticketPage) bool {
+			return slices.ContainsFunc(p.Rows, func(r ticketPageRow) bool { return r.ExpectedBy != "" })
+		},
+		cell: func(r ticketPageRow, _ *time.Location) statusCell {
+			if r.Overdue {
+				return statusCell{Text: expectedByText(r.OperatorStatus), Class: "error"}
+			}
+			return statusCell{Text: expectedByText(r.OperatorStatus)}
+		},
+		compare: func(a, b ticketPageRow) int {
+			// Operators without a date sort after those with one
+			if (a.ExpectedBy == "") != (b.ExpectedBy == "") {
+				return cmp.Compare(b.ExpectedBy, a.ExpectedBy)
+			}
+			return cmp.Compare(a.ExpectedBy, b.ExpectedBy)
+		},
+	},
+	{Key: "lastUpdated", Title: "Last Updated",
+		cell: func(r ticketPageRow, loc *time.Location) statusCell {
+			if r.Status != "OK" {
+				return statusCell{Text: "N/A"}
+			}
+			return statusCell{Text: r.LastUpdated.In(loc).Format("2006-01-02 15:04 MST")}
+		},
+		compare: func(a, b ticketPageRow) int { return a.LastUpdated.Compare(b.LastUpdated) },
+	},
+	{Key: "age", Title: "Days Old",
+		cell: func(r ticketPageRow, _ *time.Location) statusCell {
+			if r.Status != "OK" {
+				return statusCell{Text: "N/A"}
+			}
+			return statusCell{Text: fmt.Sprint(r.Age), Class: r.AgeClass}
+		},
+		compare: func(a, b ticketPageRow) int { return b.LastUpdated.Compare(a.LastUpdated) },
+	},
+	{Key: "rebuilt", Title: "Rebuilt",
+		cell: func(r ticketPageRow, _ *time.Location) statusCell {
+			if r.Rebuilt {
+				return statusCell{Text: "yes"}
+			}
+			return statusCell{Text: "no"}
+		},
+	},
+	{Key: "sha256", Title: "SHA256",
+		cell: func(r ticketPageRow, _ *time.Location) statusCell {
+			if r.Status != "OK" {
+				return statusCell{Text: "N/A"}
+			}
+			return statusCell{Text: r.SHA256, Class: "digest"}
+		},
+	},
+	{Key: "tags", Title: "Tags", cell: textCell(func(r ticketPageRow) string { return strings.Join(r.Tags, ", ") })},
+	{Key: "pin", Title: "Pinned Digest",
+		shown: func(p ticketPage) bool {
+			return slices.ContainsFunc(p.Rows, func(r ticketPageRow) bool { return r.Pin != "" })
+		},
+		cell: func(r ticketPageRow, _ *time.Location) statusCell {
+			return statusCell{Text: r.Pin, Class: "digest"}
+		},
+	},
+	{Key: "signature", Title: "Signature",
+		shown: func(p ticketPage) bool { return p.Signatures },
+		cell:  textCell(func(r ticketPageRow) string { return r.SignatureState }),
+	},
+	{Key: "provenance", Title: "Provenance",
+		shown: func(p ticketPage) bool { return p.Provenance },
+		cell:  textCell(func(r ticketPageRow) string { return r.ProvenanceState }),
+	},
+	{Key: "baseImage", Title: "Base Image",
+		shown: func(p ticketPage) bool { return p.BaseImages },
+		cell:  textCell(func(r ticketPageRow) string { return r.BaseImageState }),
+	},
+	{Key: "vulnerabilities", Title: "Vulnerabilities",
+		shown: func(p ticketPage) bool { return p.Scans },
+		cell:  textCell(func(r ticketPageRow) string { return r.ScanSummary }),
+	},
+	{Key: "build", Title: "Build",
+		shown: func(ticketPage) bool { return false },
+		cell:  textCell(func(r ticketPageRow) string { return buildName(r.Build) }),
+	},
+	{Key: "status", Title: "Status",
+		cell: func(r ticketPageRow, _ *time.Location) statusCell {
+			if r.Status == "OK" {
+				return statusCell{Text: r.Status, Class: "ok"}
+			}
+			return statusCell{Text: r.Status, Class: "error"}
+		},
+	},
+}
+
+// textCell is a cell left empty for operators without a status
+func textCell(text func(ticketPageRow) string) func(ticketPageRow, *time.Location) statusCell {
+	return func(r ticketPageRow, _ *time.Location) statusCell {
+		if r.Status != "OK" {
+			return statusCell{}
+		}
+		return statusCell{Text: text(r)}
+	}
+}
+
+func findStatusColumn(key string) (statusColumn, bool) {
+	for _, c := range statusColumns {
+		if c.Key == key {
+			return c, true
+		}
+	}
+	return statusColumn{}, false
+}
+
+func statusColumnKeys() string {
+	keys := make([]string, len(statusColumns))
+	for i, c := range statusColumns {
+		keys[i] = c.Key
+	}
+	return strings.Join(keys, ", ")
+}
+
+// tableOptions are the sort, order and columns query parameters
+type tableOptions struct {
+	Sort    string   // Column key, empty for the order of the ticket
+	Desc    bool     // order=desc
+	Columns []string // Column keys, empty for the default columns
+}
+
+// parseTableOptions reads ?sort=age&order=desc&columns=operator,age
+func parseTableOptions(q url.Values) (tableOptions, error) {
+	opts := tableOptions{Sort: q.Get("sort")}
+	if opts.Sort != "" {
+		if _, ok := findStatusColumn(opts.Sort); !ok {
+			return opts, fmt.Errorf("%w: can't sort by %q, use one of %s", api.ErrInvalidColumn, opts.Sort, statusColumnKeys())
+		}
+	}
+	switch q.Get("order") {
+	case "", "asc":
+	case "desc":
+		opts.Desc = true
+	default:
+		return opts, fmt.Errorf("%w: order %q must be asc or desc", api.ErrInvalidColumn, q.Get("order"))
+	}
+	if columns := q.Get("columns"); columns != "" {
+		for _, key := range splitList(columns) {
+			if _, ok := findStatusColumn(key); !ok {
+				return opts, fmt.Errorf("%w: unknown column %q, use %s", api.ErrInvalidColumn, key, statusColumnKeys())
+			}
+			opts.Columns = append(opts.Columns, key)
+		}
+	}
+	return opts, nil
+}
+
+// query returns the options as a query string, sorted by key when it is set
+func (o tableOptions) query(key string) string {
+	q := url.Values{}
+	if key != "" {
+		q.Set("sort", key)
+		// Sorting by the current column again flips the order
+		if key == o.Sort && !o.Desc {
+			q.Set("order", "desc")
+		}
+	}
+	if len(o.Columns) > 0 {
+		q.Set("columns", strings.Join(o.Columns, ","))
+	}
+	return "?" + q.Encode()
+}
+
+// sortRows sorts the rows of a ticket page by a column, keeping the order of
+// the ticket for ties. Operators without a status go last unless sorted by
+// name or status.
+func sortRows(rows []ticketPageRow, key string, desc bool) {
+	column, ok := findStatusColumn(key)
+	if !ok {
+		return
+	}
+	compare := column.compare
+	if compare == nil {
+		compare = func(a, b ticketPageRow) int {
+			return strings.Compare(column.cell(a, time.UTC).Text, column.cell(b, time.UTC).Text)
+		}
+	}
+	slices.SortStableFunc(rows, func(a, b ticketPageRow) int {
+		if key != "operator" && key != "status" {
+			if c := cmp.Compare(statusRank(a), statusRank(b)); c != 0 {
+				return c
+			}
+		}
+		if desc {
+			return compare(b, a)
+		}
+		return compare(a, b)
+	})
+}
+
+func statusRank(r ticketPageRow) int {
+	if r.Status == "OK" {
+		return 0
+	}
+	return 1
+}
+
+// statusTable is the status table of a ticket with the columns and order asked for
+type statusTable struct {
+	Options tableOptions
+	Columns []statusTableColumn
+	Rows    [][]statusCell
+}
+
+type statusTableColumn struct {
+	Key, Title string
+	Query      string // Query string sorting by the column
+	Sorted     string // "asc" or "desc" when the table is sorted by it
+}
+
+// newStatusTable sorts the rows of the page and composes their cells, with
+// times in loc
+func newStatusTable(page ticketPage, opts tableOptions, loc *time.Location) statusTable {
+	sortRows(page.Rows, opts.Sort, opts.Desc)
+
+	var columns []statusColumn
+	if len(opts.Columns) > 0 {
+		for _, key := range opts.Columns {
+			c, _ := findStatusColumn(key)
+			columns = append(columns, c)
+		}
+	} else {
+		for _, c := range statusColumns {
+			if c.shown == nil || c.shown(page) {
+				columns = append(columns, c)
+			}
+		}
+	}
+
+	table := statusTable{Options: opts}
+	for _, c := range columns {
+		col := statusTableColumn{Key: c.Key, Title: c.Title, Query: opts.query(c.Key)}
+		if c.Key == opts.Sort {
+			col.Sorted = "asc"
+			if opts.Desc {
+				col.Sorted = "desc"
+			}
+		}
+		table.Columns = append(table.Columns, col)
+	}
+	for _, row := range page.Rows {
+		cells := make([]statusCell, len(columns))
+		for i, c := range columns {
+			cells[i] = c.cell(row, loc)
+		}
+		table.Rows = append(table.Rows, cells)
+	}
+	return table
+}
+
+// statusOrder sorts the statuses of the status API by the same columns as
+// the table
+type statusOrder struct {
+	clock clock.Clock
+}
+
+func (o statusOrder) Sort(ticket store.Ticket, statuses []OperatorStatus, column string, desc bool) error {
+	if _, ok := findStatusColumn(column); !ok {
+		return fmt.Errorf("%w: can't sort by %q, use one of %s", api.ErrInvalidColumn, column, statusColumnKeys())
+	}
+	page := newTicketPage(ticket, statuses, o.clock.Now())
+	sortRows(page.Rows, column, desc)
+	for i, row := range page.Rows {
+		statuses[i] = row.OperatorStatus
+	}
+	return nil
+}
+
+// handleStatusTable serves the status table of a ticket as JSON, or as CSV
+// with ?format=csv, at /api/v1/tickets/{id}/table
+func handleStatusTable(state *AppState, quay *QuayClient) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ticket, ok := state.Get(r.PathValue("id"))
+		if !ok {
+			api.WriteError(w, requestID(r), store.ErrTicketNotFound)
+			return
+		}
+		opts, err := parseTableOptions(r.URL.Query())
+		if err != nil {
+			api.WriteError(w, requestID(r), err)
+			return
+		}
+
+		page := newTicketPage(ticket, api.TicketStatuses(quay, ticket, localTime(state.clock.Now())), state.clock.Now())
+		table := newStatusTable(page, opts, requestLocation(r))
+		if r.URL.Query().Get("format") == "csv" {
+			w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+			w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", ticket.ID+"-status.csv"))
+			writeStatusCSV(w, table)
+			return
+		}
+
+		out := struct {
+			Columns []string   `json:"columns"`
+			Titles  []string   `json:"titles"`
+			Rows    [][]string `json:"rows"`
+		}{Columns: []string{}, Titles: []string{}, Rows: [][]string{}}
+		for _, c := range table.Columns {
+			out.Columns = append(out.Columns, c.Key)
+			out.Titles = append(out.Titles, c.Title)
+		}
+		for _, row := range table.Rows {
+			out.Rows = append(out.Rows, cellTexts(row))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(out)
+	}
+}
+
+// writeStatusCSV writes the table with a header row of the column titles
+func writeStatusCSV(w http.ResponseWriter, table statusTable) {
+	out := csv.NewWriter(w)
+	header := make([]string, len(table.Columns))
+	for i, c := range table.Columns {
+		header[i] = c.Title
+	}
+	out.Write(header)
+	for _, row := range table.Rows {
+		out.Write(cellTexts(row))
+	}
+	out.Flush()
+}
+
+func cellTexts(cells []statusCell) []string {
+	texts := make([]string, len(cells))
+	for i, c := range cells {
+		texts[i] = c.Text
+	}
+	return texts
+}
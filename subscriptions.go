@@ -0,0 +1,376 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"OpTrack/internal/store"
+)
+
+// UserSubscription lists the tickets and operators a user follows and how
+// they want to be notified
+type UserSubscription struct {
+	User        string   `json:"user"`                  // Email address identifying the user
+	SlackUserID string   `json:"slackUserId,omitempty"` // Needed for Slack DMs
+	Channels    []string `json:"channels"`              // "email" and/or "slack"
+	Tickets     []string `json:"tickets,omitempty"`
+	Operators   []string `json:"operators,omitempty"`
+}
+
+func (u UserSubscription) follows(ev Event) bool {
+	for _, id := range u.Tickets {
+		if id == ev.Ticket.ID {
+			return true
+		}
+	}
+
+	for _, name := range eventOperators(ev) {
+		for _, op := range u.Operators {
+			if op == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// eventOperators returns the operators an event is about
+func eventOperators(ev Event) []string {
+	switch {
+	case ev.Type == EventDigest:
+		var names []string
+		for _, e := range ev.Events {
+			names = append(names, eventOperators(e)...)
+		}
+		return names
+	case ev.Operator != nil:
+		return []string{ev.Operator.Name}
+	default:
+		names := make([]string, 0, len(ev.Statuses))
+		for _, status := range ev.Statuses {
+			names = append(names, status.Name)
+		}
+		return names
+	}
+}
+
+// SubscriptionStore persists per-user subscriptions
+type SubscriptionStore struct {
+	mu    sync.RWMutex
+	path  string
+	users map[string]UserSubscription
+	audit *AuditLog
+}
+
+func NewSubscriptionStore(dataDir string, audit *AuditLog) (*SubscriptionStore, error) {
+	dir, err := store.SettingsDir(dataDir)
+	if err != nil {
+		return nil, err
+	}
+
+	store := &SubscriptionStore{
+		path:  filepath.Join(dir, "subscriptions.json"),
+		users: make(map[string]UserSubscription),
+		audit: audit,
+	}
+
+	data, err := os.ReadFile(store.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return store, nil
+		}
+		return nil, err
+	}
+
+	var subs []UserSubscription
+	if err := json.Unmarshal(data, &subs); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", store.path, err)
+	}
+	for _, sub := range subs {
+		store.users[normalizeEmail(sub.User)] = sub
+	}
+	return store, nil
+}
+
+// Get returns the user's subscription, or an empty one defaulting to email
+func (s *SubscriptionStore) Get(user string) UserSubscription {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.getLocked(user)
+}
+
+func (s *SubscriptionStore) getLocked(user string) UserSubscription {
+	if sub, ok := s.users[normalizeEmail(user)]; ok {
+		return sub
+	}
+	return UserSubscription{User: normalizeEmail(user), Channels: []string{"email"}}
+}
+
+func (s *SubscriptionStore) Put(sub UserSubscription) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.putLocked(sub)
+}
+
+func (s *SubscriptionStore) putLocked(sub UserSubscription) error {
+	sub.User = normalizeEmail(sub.User)
+	if len(sub.Channels) == 0 && len(sub.Tickets) == 0 && len(sub.Operators) == 0 {
+		delete(s.users, sub.User)
+	} else {
+		s.users[sub.User] = sub
+	}
+	return s.save()
+}
+
+// Update applies fn to the user's subscription and saves the result, holding
+// the lock throughout so concurrent updates don't lose each other's changes
+func (s *SubscriptionStore) Update(user string, fn func(sub *UserSubscription)) (UserSubscription, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sub := s.getLocked(user)
+	fn(&sub)
+	return sub, s.putLocked(sub)
+}
+
+// Matching returns the subscriptions that follow the event
+func (s *SubscriptionStore) Matching(ev Event) []UserSubscription {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var matches []UserSubscription
+	for _, sub := range s.users {
+		if sub.follows(ev) {
+			matches = append(matches, sub)
+		}
+	}
+	return matches
+}
+
+func (s *SubscriptionStore) save() error {
+	subs := make([]UserSubscription, 0, len(s.users))
+	for _, sub := range s.users {
+		subs = append(subs, sub)
+	}
+	sort.Slice(subs, func(i, j int) bool { return subs[i].User < subs[j].User })
+
+	data, err := json.MarshalIndent(subs, "", "    ")
+	if err != nil {
+		return err
+	}
+	return store.WriteFileAtomic(s.path, data, 0644)
+}
+
+func addUnique(list []string, value string) []string {
+	for _, v := range list {
+		if v == value {
+			return list
+		}
+	}
+	return append(list[:len(list):len(list)], value)
+}
+
+func removeValue(list []string, value string) []string {
+	var out []string
+	for _, v := range list {
+		if v != value {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// handleSubscriptions manages the subscriptions of the request's user. Only
+// the admin token may name another user with ?user= or in the body.
+//
+//	GET                 returns the user's subscriptions
+//	PUT    body         replaces the user's subscriptions and channels
+//	POST   ?ticket=     subscribes to a ticket (or &operator=)
+//	DELETE ?ticket=     unsubscribes from a ticket (or &operator=)
+func (s *SubscriptionStore) handleSubscriptions(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		user, status, message := actingUser(r, r.URL.Query().Get("user"))
+		if message != "" {
+			httpError(w, r, message, status)
+			return
+		}
+		json.NewEncoder(w).Encode(s.Get(user))
+
+	case "PUT":
+		var sub UserSubscription
+		if err := json.NewDecoder(r.Body).Decode(&sub); err != nil {
+			httpError(w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
+		user, status, message := actingUser(r, sub.User)
+		if message != "" {
+			httpError(w, r, message, status)
+			return
+		}
+		sub.User = user
+		for _, channel := range sub.Channels {
+			if channel != "email" && channel != "slack" {
+				httpError(w, r, fmt.Sprintf("Unknown channel %q", channel), http.StatusBadRequest)
+				return
+			}
+			if channel == "slack" && sub.SlackUserID == "" {
+				httpError(w, r, "slackUserId is required for Slack DMs", http.StatusBadRequest)
+				return
+			}
+		}
+
+		if err := s.Put(sub); err != nil {
+			requestLogger(r).Error("Failed to save subscriptions", "error", err)
+			httpError(w, r, "Failed to save subscriptions", http.StatusInternalServerError)
+			return
+		}
+		s.audit.Record(r, "subscriptions.update", "", map[string]interface{}{"user": sub.User, "channels": sub.Channels})
+		json.NewEncoder(w).Encode(s.Get(sub.User))
+
+	case "POST", "DELETE":
+		query := r.URL.Query()
+		user, status, message := actingUser(r, query.Get("user"))
+		if message != "" {
+			httpError(w, r, message, status)
+			return
+		}
+		ticket, operator := query.Get("ticket"), query.Get("operator")
+		if ticket == "" && operator == "" {
+			httpError(w, r, "Ticket or operator required", http.StatusBadRequest)
+			return
+		}
+
+		sub, err := s.Update(user, func(sub *UserSubscription) {
+			if ticket != "" {
+				if r.Method == "POST" {
+					sub.Tickets = addUnique(sub.Tickets, ticket)
+				} else {
+					sub.Tickets = removeValue(sub.Tickets, ticket)
+				}
+			}
+			if operator != "" {
+				if r.Method == "POST" {
+					sub.Operators = addUnique(sub.Operators, operator)
+				} else {
+					sub.Operators = removeValue(sub.Operators, operator)
+				}
+			}
+		})
+		if err != nil {
+			requestLogger(r).Error("Failed to save subscriptions", "error", err)
+			httpError(w, r, "Failed to save subscriptions", http.StatusInternalServerError)
+			return
+		}
+
+		action := "subscriptions.subscribe"
+		if r.Method == "DELETE" {
+			action = "subscriptions.unsubscribe"
+		}
+		s.audit.Record(r, action, ticket, map[string]interface{}{"user": sub.User, "operator": operator})
+		json.NewEncoder(w).Encode(sub)
+
+	default:
+		httpError(w, r, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// SubscriptionNotifier delivers events directly to the users subscribed to
+// them, leaving out users who may not see the ticket's project
+type SubscriptionNotifier struct {
+	subs    *SubscriptionStore
+	email   *EmailNotifier // nil when SMTP is not configured
+	slackDM *SlackDMClient // nil when no Slack bot token is configured
+}
+
+func NewSubscriptionNotifier(subs *SubscriptionStore, email *EmailNotifier, slackDM *SlackDMClient) *SubscriptionNotifier {
+	return &SubscriptionNotifier{subs: subs, email: email, slackDM: slackDM}
+}
+
+func (n *SubscriptionNotifier) Name() string {
+	return "subscriptions"
+}
+
+func (n *SubscriptionNotifier) Notify(ev Event) error {
+	var firstErr error
+	for _, sub := range n.subs.Matching(ev) {
+		if !userCanView(sub.User, ev.Ticket.Project) {
+			continue
+		}
+		for _, channel := range sub.Channels {
+			var err error
+			switch {
+			case channel == "email" && n.email != nil:
+				err = n.email.SendTo(sub.User, ev)
+			case channel == "slack" && n.slackDM != nil && sub.SlackUserID != "":
+				err = n.slackDM.Send(sub.SlackUserID, ev)
+			}
+			if err != nil {
+				slog.Error("Failed to notify subscriber", "user", sub.User, "channel", channel, "error", err)
+				if firstErr == nil {
+					firstErr = err
+				}
+			}
+		}
+	}
+	return firstErr
+}
+
+// SlackDMClient sends direct messages through the Slack Web API using a bot token
+type SlackDMClient struct {
+	token  string
+	apiURL string
+	client *http.Client
+}
+
+func NewSlackDMClient(token string) *SlackDMClient {
+	return &SlackDMClient{
+		token:  token,
+		apiURL: "https://slack.com/api/chat.postMessage",
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (c *SlackDMClient) Send(userID string, ev Event) error {
+	msg := slackMessage(ev)
+	msg["channel"] = userID
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", c.apiURL, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	req.Header.Set("Authorization", "Bearer "+c.token)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// The Web API reports most failures with a 200 and ok=false
+	var result struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("failed to parse Slack response (HTTP %d): %v", resp.StatusCode, err)
+	}
+	if !result.OK {
+		return fmt.Errorf("slack API error: %s", result.Error)
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"OpTrack/internal/leader"
+	"OpTrack/internal/registry"
+)
+
+// startTime is used to report uptime
+var startTime = time.Now()
+
+// SystemStatus is OpTrack's view of its own health
+type SystemStatus struct {
+	Version   string         `json:"version"`
+	Commit    string         `json:"commit,omitempty"`
+	GoVersion string         `json:"goVersion"`
+	StartedAt time.Time      `json:"startedAt"`
+	Uptime    string         `json:"uptime"`
+	Healthy   bool           `json:"healthy"`
+	Storage   StorageHealth  `json:"storage"`
+	Quay      QuayHealth     `json:"quay"`
+	Poller    PollerStatus   `json:"poller"`
+	Queues    QueueDepths    `json:"queues"`
+	Leader    *leader.Status `json:"leader,omitempty"` // With leader election only
+}
+
+// StorageHealth reports whether the data directory can be written
+type StorageHealth struct {
+	Backend string `json:"backend"`
+	Path    string `json:"path"`
+	Healthy bool   `json:"healthy"`
+	Error   string `json:"error,omitempty"`
+	Tickets int    `json:"tickets"`
+}
+
+// QuayHealth reports the state of the Quay.io client
+type QuayHealth struct {
+	CircuitBreaker string      `json:"circuitBreaker"`
+	RetryAt        *time.Time  `json:"retryAt,omitempty"`
+	CachedEntries  int         `json:"cachedEntries"`
+	SLO            []SLOWindow `json:"slo"`
+}
+
+// QueueDepths reports work waiting to be processed
+type QueueDepths struct {
+	Poller         int `json:"poller"`
+	PendingDigests int `json:"pendingDigests"`
+}
+
+// checkStorage verifies the data directory is still writable
+func (s *AppState) checkStorage() StorageHealth {
+	health := StorageHealth{Backend: "filesystem", Path: s.dataDir, Tickets: s.Len(), Healthy: true}
+	if abs, err := filepath.Abs(s.dataDir); err == nil {
+		health.Path = abs
+	}
+
+	if err := s.store.CheckWritable(); err != nil {
+		health.Healthy = false
+		health.Error = err.Error()
+	}
+	return health
+}
+
+// SystemHandler serves the self-status API and page
+type SystemHandler struct {
+	state      *AppState
+	quay       *QuayClient
+	poller     *Poller
+	dispatcher *Dispatcher
+	elector    *leader.Elector // nil without leader election
+}
+
+func NewSystemHandler(state *AppState, qc *QuayClient, poller *Poller, dispatcher *Dispatcher, elector *leader.Elector) *SystemHandler {
+	return &SystemHandler{state: state, quay: qc, poller: poller, dispatcher: dispatcher, elector: elector}
+}
+
+func (h *SystemHandler) Status() SystemStatus {
+	breakerState, retryAt := h.quay.Breaker.State()
+	quay := QuayHealth{
+		CircuitBreaker: breakerState,
+		CachedEntries:  h.quay.CacheSize(),
+		SLO:            quaySLO.Current(),
+	}
+	if !retryAt.IsZero() {
+		quay.RetryAt = &retryAt
+	}
+
+	poller := h.poller.Status()
+	build := currentBuildInfo()
+	status := SystemStatus{
+		Version:   build.Version,
+		Commit:    build.Commit,
+		GoVersion: build.GoVersion,
+		StartedAt: startTime,
+		Uptime:    time.Since(startTime).Round(time.Second).String(),
+		Storage:   h.state.checkStorage(),
+		Quay:      quay,
+		Poller:    poller,
+		Queues: QueueDepths{
+			Poller:         poller.QueueDepth,
+			PendingDigests: h.dispatcher.PendingDigests(),
+		},
+	}
+	if h.elector != nil {
+		election := h.elector.Status()
+		status.Leader = &election
+	}
+	status.Healthy = status.Storage.Healthy && breakerState != registry.BreakerOpen
+	return status
+}
+
+// handleSystemAPI returns the system status as JSON, with a 503 when unhealthy
+func (h *SystemHandler) handleSystemAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		httpError(w, r, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	status := h.Status()
+	w.Header().Set("Content-Type", "application/json")
+	if !status.Healthy {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(status)
+}
+
+// handleSystemPage renders the system status for humans
+func (h *SystemHandler) handleSystemPage(w http.ResponseWriter, r *http.Request) {
+	renderPage(w, r, "system.html", h.Status())
+}
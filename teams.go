@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// TeamsConfig holds the Microsoft Teams incoming webhook
+type TeamsConfig struct {
+	WebhookURL string `yaml:"webhookURL"`
+}
+
+// TeamsNotifier posts Adaptive Cards to a Microsoft Teams incoming webhook
+type TeamsNotifier struct {
+	webhookURL string
+	client     *http.Client
+}
+
+func NewTeamsNotifier(webhookURL string) *TeamsNotifier {
+	return &TeamsNotifier{
+		webhookURL: webhookURL,
+		client:     &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (n *TeamsNotifier) Name() string {
+	return "teams"
+}
+
+func (n *TeamsNotifier) Notify(ev Event) error {
+	return postJSON(n.client, n.webhookURL, teamsMessage(ev))
+}
+
+// teamsMessage wraps an Adaptive Card in the envelope expected by Teams webhooks
+func teamsMessage(ev Event) map[string]interface{} {
+	return map[string]interface{}{
+		"type": "message",
+		"attachments": []map[string]interface{}{
+			{
+				"contentType": "application/vnd.microsoft.card.adaptive",
+				"content":     adaptiveCard(ev),
+			},
+		},
+	}
+}
+
+func adaptiveCard(ev Event) map[string]interface{} {
+	color := "Default"
+	switch ev.Type {
+	case EventTicketRebuilt, EventOperatorUpdated, EventClusterUpdated:
+		color = "Good"
+	case EventOperatorStale, EventPinMissing:
+		color = "Attention"
+	case EventClusterOutdated, EventPinUntagged:
+		color = "Warning"
+	}
+
+	body := []map[string]interface{}{
+		{
+			"type":   "TextBlock",
+			"text":   eventTitle(ev),
+			"weight": "Bolder",
+			"size":   "Medium",
+			"color":  color,
+		},
+		{
+			"type": "TextBlock",
+			"text": eventSummary(ev),
+			"wrap": true,
+		},
+	}
+
+	if ev.Type == EventDigest {
+		for _, e := range ev.Events {
+			body = append(body, map[string]interface{}{
+				"type": "TextBlock",
+				"text": "**" + eventTitle(e) + "** " + eventSummary(e),
+				"wrap": true,
+			})
+		}
+	} else if ev.Operator != nil {
+		facts := []map[string]string{
+			{"title": "Ticket", "value": ev.Ticket.ID},
+			{"title": "Operator", "value": ev.Operator.Name},
+			{"title": "Last Updated", "value": localTime(ev.Operator.LastUpdated).Format(time.RFC1123)},
+			{"title": "SHA256", "value": ev.Operator.SHA256},
+		}
+		if ev.Previous != "" {
+			facts = append(facts, map[string]string{"title": "Previous", "value": ev.Previous})
+		}
+		if ev.Reason != "" {
+			facts = append(facts, map[string]string{"title": "Reason", "value": ev.Reason})
+		}
+		if ev.Cluster != nil {
+			facts = append(facts, map[string]string{"title": "Cluster", "value": ev.Cluster.Cluster})
+		}
+		body = append(body, map[string]interface{}{"type": "FactSet", "facts": facts})
+	} else {
+		facts := make([]map[string]string, 0, len(ev.Statuses))
+		for _, status := range ev.Statuses {
+			facts = append(facts, map[string]string{
+				"title": status.Name,
+				"value": fmt.Sprintf("%s (%s)", localTime(status.LastUpdated).Format("2006-01-02"), shortDigest(status.SHA256)),
+			})
+		}
+		body = append(body, map[string]interface{}{"type": "FactSet", "facts": facts})
+	}
+
+	return map[string]interface{}{
+		"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+		"type":    "AdaptiveCard",
+		"version": "1.4",
+		"body":    body,
+	}
+}
@@ -0,0 +1,395 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"OpTrack/internal/api"
+	"OpTrack/internal/clock"
+	"OpTrack/internal/registry"
+	"OpTrack/internal/store"
+)
+
+// TicketTemplate is a saved starting point for recurring tickets, such as
+// monthly CVE rebuilds of the same fifty operators: the operators to track,
+// thresholds and notification rules every ticket created from it gets
+type TicketTemplate struct {
+	Name         string            `json:"name"`
+	Description  string            `json:"description,omitempty"` // Given to tickets created from it
+	Operators    []store.Operator  `json:"operators,omitempty"`
+	Groups       []string          `json:"groups,omitempty"`
+	Labels       []string          `json:"labels,omitempty"`
+	Owner        string            `json:"owner,omitempty"`
+	Project      string            `json:"project,omitempty"`
+	Applications []string          `json:"applications,omitempty"`
+	Thresholds   *store.Thresholds `json:"thresholds,omitempty"`
+	// Notifications are added to the notification rules for every ticket
+	// created from the template, limited to that ticket
+	Notifications []NotificationRule `json:"notifications,omitempty"`
+	Updated       time.Time          `json:"updated"`
+	UpdatedBy     string             `json:"updatedBy,omitempty"`
+}
+
+// newTicket returns the ticket a template creates, with the ID of req and
+// what it adds: its description, owner and project replace the template's,
+// and its operators, groups, labels, applications and CVEs are added to them
+func (t TicketTemplate) newTicket(req JiraTicket) JiraTicket {
+	ticket := JiraTicket{
+		ID:           req.ID,
+		Description:  t.Description,
+		Owner:        t.Owner,
+		Project:      t.Project,
+		Operators:    append(slices.Clone(t.Operators), ownOperators(req.Operators)...),
+		Groups:       appendNew(slices.Clone(t.Groups), req.Groups...),
+		Labels:       appendNew(slices.Clone(t.Labels), req.Labels...),
+		Applications: appendNew(slices.Clone(t.Applications), req.Applications...),
+		CVEs:         req.CVEs,
+		Pins:         req.Pins,
+	}
+	if req.Description != "" {
+		ticket.Description = req.Description
+	}
+	if req.Owner != "" {
+		ticket.Owner = req.Owner
+	}
+	if req.Project != "" {
+		ticket.Project = req.Project
+	}
+	if t.Thresholds != nil || req.Thresholds != nil {
+		thresholds := store.Thresholds{}
+		if t.Thresholds != nil {
+			thresholds = *t.Thresholds
+		}
+		if req.Thresholds != nil && req.Thresholds.Warning != "" {
+			thresholds.Warning = req.Thresholds.Warning
+		}
+		if req.Thresholds != nil && req.Thresholds.Stale != "" {
+			thresholds.Stale = req.Thresholds.Stale
+		}
+		ticket.Thresholds = &thresholds
+	}
+
+	// Operators listed twice keep the details of the first
+	seen := make(map[string]bool)
+	ticket.Operators = slices.DeleteFunc(ticket.Operators, func(o store.Operator) bool {
+		dup := seen[o.Name]
+		seen[o.Name] = true
+		return dup
+	})
+	return ticket
+}
+
+// appendNew appends the values list doesn't have yet
+func appendNew(list []string, values ...string) []string {
+	for _, v := range values {
+		if !slices.Contains(list, v) {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+// TemplateStore persists ticket templates in the settings directory
+type TemplateStore struct {
+	mu        sync.RWMutex
+	path      string
+	templates map[string]TicketTemplate
+	audit     *AuditLog
+	clock     clock.Clock
+}
+
+func NewTemplateStore(dataDir string, audit *AuditLog, clk clock.Clock) (*TemplateStore, error) {
+	dir, err := store.SettingsDir(dataDir)
+	if err != nil {
+		return nil, err
+	}
+	s := &TemplateStore{
+		path:      filepath.Join(dir, "ticket-templates.json"),
+		templates: make(map[string]TicketTemplate),
+		audit:     audit,
+		clock:     clk,
+	}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// load reads the templates file, picking up changes other replicas made
+func (s *TemplateStore) load() error {
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	templates := make(map[string]TicketTemplate)
+	if err := json.Unmarshal(data, &templates); err != nil {
+		return fmt.Errorf("failed to parse %s: %v", s.path, err)
+	}
+	s.mu.Lock()
+	s.templates = templates
+	s.mu.Unlock()
+	return nil
+}
+
+// List returns every template, sorted by name
+func (s *TemplateStore) List() []TicketTemplate {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	templates := make([]TicketTemplate, 0, len(s.templates))
+	for _, t := range s.templates {
+		templates = append(templates, t)
+	}
+	sort.Slice(templates, func(i, j int) bool { return templates[i].Name < templates[j].Name })
+	return templates
+}
+
+// Get returns one template
+func (s *TemplateStore) Get(name string) (TicketTemplate, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	t, ok := s.templates[name]
+	return t, ok
+}
+
+// Put creates or replaces a template, returning whether it existed
+func (s *TemplateStore) Put(r *http.Request, t TicketTemplate) (bool, error) {
+	t.Updated = s.clock.Now()
+	t.UpdatedBy = requestActor(r)
+
+	s.mu.Lock()
+	old, existed := s.templates[t.Name]
+	s.templates[t.Name] = t
+	if err := s.save(); err != nil {
+		if existed {
+			s.templates[t.Name] = old
+		} else {
+			delete(s.templates, t.Name)
+		}
+		s.mu.Unlock()
+		return existed, err
+	}
+	s.mu.Unlock()
+
+	action := "template.create"
+	if existed {
+		action = "template.replace"
+	}
+	s.audit.Record(r, action, "", map[string]interface{}{"template": t.Name, "operators": t.Operators, "groups": t.Groups, "thresholds": t.Thresholds, "notifications": t.Notifications})
+	return existed, nil
+}
+
+// Delete removes a template. Tickets created from it are left as they are.
+func (s *TemplateStore) Delete(r *http.Request, name string) error {
+	s.mu.Lock()
+	old, ok := s.templates[name]
+	if !ok {
+		s.mu.Unlock()
+		return store.ErrTemplateNotFound
+	}
+	delete(s.templates, name)
+	if err := s.save(); err != nil {
+		s.templates[name] = old
+		s.mu.Unlock()
+		return err
+	}
+	s.mu.Unlock()
+
+	s.audit.Record(r, "template.delete", "", map[string]interface{}{"template": name})
+	return nil
+}
+
+// save writes the templates file. The caller holds s.mu.
+func (s *TemplateStore) save() error {
+	data, err := json.MarshalIndent(s.templates, "", "    ")
+	if err != nil {
+		return err
+	}
+	if err := store.WriteFileAtomic(s.path, data, 0644); err != nil {
+		return fmt.Errorf("%w: failed to save ticket templates: %v", store.ErrStorage, err)
+	}
+	return nil
+}
+
+// createFromTemplate creates a new ticket from a template and adds the
+// template's notification rules for it, returning the ticket as published.
+// The ticket is deleted again if its rules can't be added.
+func createFromTemplate(state *AppState, rules *RuleStore, name string, req JiraTicket) (JiraTicket, error) {
+	t, ok := state.templates.Get(name)
+	if !ok {
+		return JiraTicket{}, store.ErrTemplateNotFound
+	}
+	ticket := t.newTicket(req)
+	ticket.Added = state.clock.Now()
+	if err := state.Create(ticket); err != nil {
+		return ticket, err
+	}
+	if len(t.Notifications) > 0 {
+		if _, err := rules.AddTicketRules(ticket.ID, t.Notifications); err != nil {
+			if err := state.delete(ticket.ID); err != nil {
+				slog.Error("Failed to delete ticket whose notification rules weren't added", "ticket", ticket.ID, "error", err)
+			}
+			return ticket, err
+		}
+	}
+	if stored, ok := state.Get(ticket.ID); ok {
+		ticket = stored // With the members of its groups
+	}
+	return ticket, nil
+}
+
+// checkTemplate checks a template makes valid tickets, cleaning it up like a
+// ticket, and that its notification rules can be added for a ticket
+func checkTemplate(t *TicketTemplate, groups *GroupStore) error {
+	sample := JiraTicket{Operators: t.Operators, Labels: t.Labels, Groups: t.Groups, Description: t.Description, Thresholds: t.Thresholds}
+	if err := normalizeTicket(&sample); err != nil {
+		return err
+	}
+	for _, name := range sample.OperatorNames() {
+		if parts := strings.Split(name, "/"); len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return fmt.Errorf("%w: %q", registry.ErrInvalidOperator, name)
+		}
+	}
+	if len(sample.Pins) > 0 {
+		return errors.New("templates can't pin digests")
+	}
+	if err := checkGroups(sample, groups); err != nil {
+		return err
+	}
+	if err := allowedOperators.Load().check(sample.OperatorNames()); err != nil {
+		return err
+	}
+	if err := projectAccess.Load().check(t.Project); err != nil {
+		return err
+	}
+	t.Operators, t.Labels, t.Description, t.Thresholds = sample.Operators, sample.Labels, sample.Description, sample.Thresholds
+	t.Owner = strings.TrimSpace(t.Owner)
+	for _, rule := range t.Notifications {
+		if len(rule.Channels) == 0 {
+			return errors.New("every notification rule needs at least one channel")
+		}
+		if len(rule.Tickets) > 0 {
+			return errors.New("notification rules of templates can't have tickets; they are limited to each ticket created from the template")
+		}
+	}
+	return nil
+}
+
+// handleList lists the templates at GET /api/v1/templates
+func (s *TemplateStore) handleList(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.List())
+}
+
+// handleGet returns a template at GET /api/v1/templates/{name}
+func (s *TemplateStore) handleGet(w http.ResponseWriter, r *http.Request) {
+	t, ok := s.Get(r.PathValue("name"))
+	if !ok {
+		api.WriteError(w, requestID(r), store.ErrTemplateNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(t)
+}
+
+// handlePut creates or replaces a template at PUT /api/v1/templates/{name},
+// answering 201 for a new template. It is served behind requireAdminToken.
+func (s *TemplateStore) handlePut(state *AppState) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("name")
+		if !namePattern.MatchString(name) {
+			httpError(w, r, fmt.Sprintf("Invalid template name %q: use lower case letters, digits and dashes", name), http.StatusBadRequest)
+			return
+		}
+		var t TicketTemplate
+		if err := json.NewDecoder(r.Body).Decode(&t); err != nil {
+			httpError(w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
+		t.Name = name
+		if err := checkTemplate(&t, state.groups); err != nil {
+			if status, _ := api.ErrorStatus(err); status == http.StatusInternalServerError {
+				httpError(w, r, err.Error(), http.StatusBadRequest)
+			} else {
+				api.WriteError(w, requestID(r), err)
+			}
+			return
+		}
+
+		existed, err := s.Put(r, t)
+		if err != nil {
+			api.WriteError(w, requestID(r), err)
+			return
+		}
+		t, _ = s.Get(name)
+		w.Header().Set("Content-Type", "application/json")
+		if !existed {
+			w.WriteHeader(http.StatusCreated)
+		}
+		json.NewEncoder(w).Encode(t)
+	}
+}
+
+// handleDelete removes a template at DELETE /api/v1/templates/{name}. It is
+// served behind requireAdminToken.
+func (s *TemplateStore) handleDelete(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if err := s.Delete(r, name); err != nil {
+		if !errors.Is(err, store.ErrTemplateNotFound) {
+			requestLogger(r).Error("Failed to delete ticket template", "template", name, "error", err)
+		}
+		api.WriteError(w, requestID(r), err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleCreateTicket creates a ticket from a template at
+// POST /api/v1/templates/{name}/tickets. The body is a ticket with its ID and
+// anything to add to the template, such as the CVEs of this month's rebuild.
+func (s *TemplateStore) handleCreateTicket(state *AppState, rules *RuleStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req JiraTicket
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			httpError(w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
+		req.ID = strings.TrimSpace(req.ID)
+		if req.ID == "" {
+			httpError(w, r, "Ticket ID required", http.StatusBadRequest)
+			return
+		}
+
+		name := r.PathValue("name")
+		if t, ok := s.Get(name); ok {
+			if err := checkEdit(r, t.newTicket(req).Project); err != nil {
+				api.WriteError(w, requestID(r), err)
+				return
+			}
+		}
+		ticket, err := createFromTemplate(state, rules, name, req)
+		if err != nil {
+			if status, _ := api.ErrorStatus(err); status == http.StatusInternalServerError {
+				requestLogger(r).Error("Failed to create ticket from template", "template", name, "ticket", req.ID, "error", err)
+			}
+			api.WriteError(w, requestID(r), err)
+			return
+		}
+		state.audit.Record(r, "ticket.create", ticket.ID, map[string]interface{}{"template": name, "operators": ticket.Operators, "owner": ticket.Owner, "labels": ticket.Labels, "groups": ticket.Groups, "applications": ticket.Applications, "cves": ticket.CVEs, "thresholds": ticket.Thresholds, "project": ticket.Project})
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(ticket)
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"OpTrack/internal/api"
+	"OpTrack/internal/store"
+)
+
+// ticketPage is the server-rendered status of a ticket, readable without
+// JavaScript
+type ticketPage struct {
+	Ticket    JiraTicket
+	Rows      []ticketPageRow
+	Rebuilt   int
+	Generated time.Time
+
+	// Optional columns, shown when the server checks them
+	Signatures, Provenance, BaseImages, Scans bool
+
+	// Table is the status table with the sort, order and columns asked for
+	Table statusTable
+	// Shared is set for pages seen through a share link, which leave out
+	// links to the rest of OpTrack
+	Shared *ShareLink
+	// Comments are the ticket's comment thread, left out of shared pages
+	Comments []Comment
+}
+
+// ticketPageRow is one operator of the ticket page
+type ticketPageRow struct {
+	OperatorStatus
+	Age      int    // Days
+	AgeClass string // "ok", "warning" or "error", as in the web UI
+	Rebuilt  bool
+	Pin      string // The digest the operator is pinned to, if any
+
+	SignatureState, ProvenanceState, BaseImageState, ScanSummary string
+}
+
+// handleTicketPage renders the status of a ticket at /ticket/{id}, as HTML
+// or, when the request prefers it, as plain text. The status table takes the
+// sort, order and columns query parameters, falling back to the user's
+// default view.
+func handleTicketPage(state *AppState, quay *QuayClient) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept")
+		plain := prefersPlainText(r)
+		ticket, ok := state.Get(r.PathValue("id"))
+		if !ok {
+			httpError(w, r, store.ErrTicketNotFound.Error(), http.StatusNotFound)
+			return
+		}
+		page := newTicketPage(ticket, api.TicketStatuses(quay, ticket, localTime(state.clock.Now())), state.clock.Now())
+		page.Comments = state.comments.List(ticket.ID)
+		serveTicketPage(w, r, api.ApplyView(r.URL.Query(), state.prefs.DefaultView(r)), page, plain)
+	}
+}
+
+// serveTicketPage composes the status table of a page with the table options
+// in q and writes it as HTML, or as plain text when plain is set
+func serveTicketPage(w http.ResponseWriter, r *http.Request, q url.Values, page ticketPage, plain bool) {
+	opts, err := parseTableOptions(q)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	page.Table = newStatusTable(page, opts, requestLocation(r))
+	if plain {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		writeTicketText(w, page)
+		return
+	}
+	renderPage(w, r, "ticket.html", page)
+}
+
+func newTicketPage(ticket JiraTicket, statuses []OperatorStatus, now time.Time) ticketPage {
+	page := ticketPage{Ticket: ticket, Generated: now}
+	warning, stale := ticketThresholds(ticket)
+	for _, s := range statuses {
+		row := ticketPageRow{OperatorStatus: s, Pin: ticket.Pins[s.Name]}
+		if s.Status == "OK" {
+			age := now.Sub(s.LastUpdated)
+			row.Age = int(age.Hours() / 24)
+			row.AgeClass = "ok"
+			switch {
+			case age >= stale:
+				row.AgeClass = "error"
+			case age >= warning:
+				row.AgeClass = "warning"
+			}
+			row.Rebuilt = isRebuilt(ticket, s)
+			row.SignatureState = signatureState(s.Signature)
+			row.ProvenanceState = provenanceState(s.Provenance)
+			row.BaseImageState = baseImageState(s.BaseImage)
+			row.ScanSummary = scanSummary(s.Scan)
+		}
+		if row.Rebuilt {
+			page.Rebuilt++
+		}
+		page.Signatures = page.Signatures || s.Signature != nil
+		page.Provenance = page.Provenance || s.Provenance != nil
+		page.BaseImages = page.BaseImages || s.BaseImage != nil
+		page.Scans = page.Scans || s.Scan != nil
+		page.Rows = append(page.Rows, row)
+	}
+	return page
+}
+
+// writeTicketText writes the ticket page with its status table aligned in columns
+func writeTicketText(w http.ResponseWriter, page ticketPage) {
+	t := page.Ticket
+	fmt.Fprintf(w, "%s: %d of %d operators rebuilt since %s\n", t.ID, page.Rebuilt, len(page.Rows), localTime(t.Added).Format("2006-01-02 15:04 MST"))
+	if t.Description != "" {
+		fmt.Fprintln(w, t.Description)
+	}
+	if t.Owner != "" {
+		fmt.Fprintf(w, "Owner: %s\n", t.Owner)
+	}
+	if len(t.Labels) > 0 {
+		fmt.Fprintf(w, "Labels: %s\n", strings.Join(t.Labels, ", "))
+	}
+	if t.Thresholds != nil {
+		warning, stale := ticketThresholds(t)
+		fmt.Fprintf(w, "Thresholds: warning %s, stale %s\n", Duration(warning), Duration(stale))
+	}
+	if t.Archived != nil {
+		fmt.Fprintf(w, "Archived on %s, and no longer polled\n", localTime(*t.Archived).Format("2006-01-02"))
+	}
+	fmt.Fprintln(w)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	titles := make([]string, len(page.Table.Columns))
+	for i, c := range page.Table.Columns {
+		titles[i] = strings.ToUpper(c.Title)
+	}
+	fmt.Fprintln(tw, strings.Join(titles, "\t"))
+	for _, row := range page.Table.Rows {
+		fmt.Fprintln(tw, strings.Join(cellTexts(row), "\t"))
+	}
+	tw.Flush()
+	if len(page.Comments) > 0 {
+		fmt.Fprintln(w, "\nComments:")
+		for _, c := range page.Comments {
+			fmt.Fprintf(w, "\n%s, %s:\n%s\n", c.Author, localTime(c.Created).Format("2006-01-02 15:04 MST"), c.Body)
+		}
+	}
+	fmt.Fprintf(w, "\nGenerated %s\n", localTime(page.Generated).Format("2006-01-02 15:04 MST"))
+}
+
+// prefersPlainText reports whether a request asks for text/plain over HTML,
+// with ?format=text or through its Accept header. HTML wins ties, and
+// requests that accept anything get HTML.
+func prefersPlainText(r *http.Request) bool {
+	switch r.URL.Query().Get("format") {
+	case "text":
+		return true
+	case "html":
+		return false
+	}
+	html, plain := -1.0, -1.0
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, err := strconv.ParseFloat(params["q"], 64); err == nil {
+			q = v
+		}
+		switch mediaType {
+		case "text/html", "text/*", "*/*":
+			html = max(html, q)
+		case "text/plain":
+			plain = max(plain, q)
+		}
+	}
+	return plain > 0 && plain > html
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"net/http"
+	"sync/atomic"
+	"time"
+	_ "time/tzdata" // Timezones work in minimal containers without a zoneinfo database
+)
+
+// timezoneCookie holds a user's own display timezone, set by visiting any page with ?tz=
+const timezoneCookie = "optrack_tz"
+
+// displayTimezone is the timezone of times on pages, in CSV exports and in notifications
+var displayTimezone = newLocationSetting(time.UTC)
+
+// locationSetting is a timezone that a config reload can change while it is in use
+type locationSetting struct {
+	v atomic.Pointer[time.Location]
+}
+
+func newLocationSetting(loc *time.Location) *locationSetting {
+	s := &locationSetting{}
+	s.Set(loc)
+	return s
+}
+
+func (s *locationSetting) Get() *time.Location    { return s.v.Load() }
+func (s *locationSetting) Set(loc *time.Location) { s.v.Store(loc) }
+
+// localTime converts t to the display timezone
+func localTime(t time.Time) time.Time {
+	return t.In(displayTimezone.Get())
+}
+
+// requestLocation returns the timezone to show a request's times in: a valid
+// ?tz= parameter, then the timezone cookie, then the display timezone
+func requestLocation(r *http.Request) *time.Location {
+	if loc, ok := parseTimezone(r.URL.Query().Get("tz")); ok {
+		return loc
+	}
+	if c, err := r.Cookie(timezoneCookie); err == nil {
+		if loc, ok := parseTimezone(c.Value); ok {
+			return loc
+		}
+	}
+	return displayTimezone.Get()
+}
+
+// rememberTimezone stores a valid ?tz= parameter in the timezone cookie so
+// later pages use it too; ?tz= with no value goes back to the server default
+func rememberTimezone(w http.ResponseWriter, r *http.Request) {
+	if !r.URL.Query().Has("tz") {
+		return
+	}
+	cookie := &http.Cookie{Name: timezoneCookie, Path: appURL("/"), SameSite: http.SameSiteLaxMode}
+	tz := r.URL.Query().Get("tz")
+	if _, ok := parseTimezone(tz); ok {
+		cookie.Value = tz
+		cookie.MaxAge = 365 * 24 * 60 * 60
+	} else {
+		cookie.MaxAge = -1
+	}
+	http.SetCookie(w, cookie)
+}
+
+func parseTimezone(name string) (*time.Location, bool) {
+	if name == "" {
+		return nil, false
+	}
+	loc, err := time.LoadLocation(name)
+	return loc, err == nil
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+// quayNamePattern matches a Quay namespace or repository name
+var quayNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]*$`)
+
+// operatorEntry is one operator reference read from a list, and what validating it found
+type operatorEntry struct {
+	Line       int    `json:"line"`
+	Input      string `json:"input"`
+	Operator   string `json:"operator,omitempty"` // Normalized namespace/repository
+	Result     string `json:"result"`             // "ok", "duplicate", "invalid", "not allowed" or "unreachable"
+	Message    string `json:"message,omitempty"`
+	Normalized bool   `json:"normalized,omitempty"` // Operator differs from Input
+}
+
+func newValidateCommand(opts *cliOptions) *cobra.Command {
+	var (
+		file  string
+		probe bool
+		list  bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "validate",
+		Short: "Check a list of operators before putting it on a ticket, without creating anything",
+		Long: `Validate reads operator references, one or more per line separated by commas
+or spaces, with # starting a comment. Each reference is normalized to
+namespace/repository, so quay.io/ns/repo:tag, quay.io/ns/repo@sha256:... and
+https://quay.io/repository/ns/repo are all accepted, and duplicates and
+operators outside allowedOperators are reported. With --probe each operator
+is also looked up on the registry.
+
+Validate exits with status 1 if any reference is invalid or not allowed or,
+with --probe, can't be found.`,
+		Example: "  optrack validate --file operators.txt --probe\n  pbpaste | optrack validate --list",
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			in := cmd.InOrStdin()
+			if file != "" && file != "-" {
+				f, err := os.Open(file)
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+				in = f
+			}
+
+			entries, err := readOperatorList(in)
+			if err != nil {
+				return err
+			}
+
+			if probe {
+				backend, err := opts.backend()
+				if err != nil {
+					return err
+				}
+				for i := range entries {
+					probeOperator(backend, &entries[i])
+				}
+			}
+
+			out := cmd.OutOrStdout()
+			err = opts.printer(cmd).print(entries, func(bool) {
+				if list {
+					for _, e := range entries {
+						if e.Result == "ok" {
+							fmt.Fprintln(out, e.Operator)
+						}
+					}
+					return
+				}
+				printOperatorEntries(out, entries)
+			})
+			if err != nil {
+				return err
+			}
+
+			failed := 0
+			for _, e := range entries {
+				if e.Result == "invalid" || e.Result == "not allowed" || e.Result == "unreachable" {
+					failed++
+				}
+			}
+			if failed > 0 {
+				return fmt.Errorf("%d of %d operator references have problems", failed, len(entries))
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&file, "file", "f", "", "File to read the operators from (default stdin)")
+	cmd.Flags().BoolVar(&probe, "probe", false, "Look up each operator on the registry")
+	cmd.Flags().BoolVar(&list, "list", false, "Print only the normalized, deduplicated operators, ready to paste into a ticket")
+	return cmd
+}
+
+// readOperatorList parses, normalizes and deduplicates an operator list
+func readOperatorList(in io.Reader) ([]operatorEntry, error) {
+	var entries []operatorEntry
+	seen := make(map[string]int) // operator -> line first seen on
+
+	scanner := bufio.NewScanner(in)
+	for line := 1; scanner.Scan(); line++ {
+		text, _, _ := strings.Cut(scanner.Text(), "#")
+		for _, ref := range splitOperators(text) {
+			e := operatorEntry{Line: line, Input: ref, Result: "ok"}
+			operator, err := normalizeOperator(ref)
+			switch {
+			case err != nil:
+				e.Result, e.Message = "invalid", err.Error()
+			case allowedOperators.Load().check([]string{operator}) != nil:
+				e.Operator = operator
+				e.Result, e.Message = "not allowed", "matches none of allowedOperators"
+			case seen[operator] != 0:
+				e.Operator = operator
+				e.Result, e.Message = "duplicate", fmt.Sprintf("already listed on line %d", seen[operator])
+			default:
+				e.Operator = operator
+				e.Normalized = operator != ref
+				seen[operator] = line
+			}
+			entries = append(entries, e)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read operator list: %v", err)
+	}
+	return entries, nil
+}
+
+// normalizeOperator turns the usual ways of writing a Quay repository into namespace/repository
+func normalizeOperator(ref string) (string, error) {
+	name := strings.ToLower(strings.TrimSpace(ref))
+	for _, prefix := range []string{"https://", "http://", "quay.io/repository/", "quay.io/"} {
+		name = strings.TrimPrefix(name, prefix)
+	}
+	name = strings.TrimSuffix(name, "/")
+	if i := strings.Index(name, "@"); i >= 0 {
+		name = name[:i] // @sha256:... digest
+	}
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		name = name[:i] // :tag
+	}
+
+	parts := strings.Split(name, "/")
+	if len(parts) != 2 {
+		return "", fmt.Errorf("expected namespace/repository")
+	}
+	for _, part := range parts {
+		if !quayNamePattern.MatchString(part) {
+			return "", fmt.Errorf("%q is not a valid Quay name", part)
+		}
+	}
+	return name, nil
+}
+
+// probeOperator looks a valid, first-seen operator up on the registry
+func probeOperator(backend Backend, e *operatorEntry) {
+	if e.Result != "ok" {
+		return
+	}
+	status, err := backend.OperatorStatus(e.Operator)
+	switch {
+	case err != nil:
+		e.Result, e.Message = "unreachable", err.Error()
+	case status.Status != "OK":
+		e.Result, e.Message = "unreachable", status.Status
+	default:
+		e.Message = "latest image " + localTime(status.LastUpdated).Format("2006-01-02")
+	}
+}
+
+func printOperatorEntries(out io.Writer, entries []operatorEntry) {
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "LINE\tOPERATOR\tRESULT\tDETAILS")
+	for _, e := range entries {
+		operator, details := e.Operator, e.Message
+		if operator == "" {
+			operator = e.Input
+		}
+		if e.Normalized {
+			details = strings.TrimPrefix(details+"; from "+e.Input, "; ")
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", e.Line, operator, e.Result, details)
+	}
+	tw.Flush()
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+
+	"github.com/spf13/cobra"
+)
+
+// Build details, set at build time with
+//
+//	go build -ldflags "-X main.version=1.4.0 -X main.commit=$(git rev-parse HEAD) -X main.buildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// commit and buildDate fall back to the VCS information Go records in the binary.
+var (
+	version   = "dev"
+	commit    = ""
+	buildDate = ""
+)
+
+// BuildInfo identifies the exact build of OpTrack
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	BuildDate string `json:"buildDate,omitempty"`
+	Modified  bool   `json:"modified,omitempty"` // Built from a tree with uncommitted changes
+	GoVersion string `json:"goVersion"`
+	Platform  string `json:"platform"`
+}
+
+func currentBuildInfo() BuildInfo {
+	info := BuildInfo{
+		Version:   version,
+		Commit:    commit,
+		BuildDate: buildDate,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+	}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range bi.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				if info.Commit == "" {
+					info.Commit = s.Value
+				}
+			case "vcs.time":
+				if info.BuildDate == "" {
+					info.BuildDate = s.Value
+				}
+			case "vcs.modified":
+				info.Modified = s.Value == "true"
+			}
+		}
+	}
+	return info
+}
+
+// String is the one-line form used in logs and by `optrack version`
+func (b BuildInfo) String() string {
+	s := b.Version
+	if b.Commit != "" {
+		c := b.Commit
+		if len(c) > 12 {
+			c = c[:12]
+		}
+		s += " (" + c
+		if b.Modified {
+			s += ", modified"
+		}
+		s += ")"
+	}
+	if b.BuildDate != "" {
+		s += " from " + b.BuildDate
+	}
+	return s + " " + b.GoVersion + " " + b.Platform
+}
+
+// logBuildInfo records which build is running, for bug reports
+func logBuildInfo() {
+	info := currentBuildInfo()
+	slog.Info("Build info", "version", info.Version, "commit", info.Commit, "build_date", info.BuildDate,
+		"modified", info.Modified, "go_version", info.GoVersion, "platform", info.Platform)
+}
+
+// handleVersion returns the build info as JSON
+func handleVersion(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		httpError(w, r, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(currentBuildInfo())
+}
+
+func newVersionCommand(opts *cliOptions) *cobra.Command {
+	return &cobra.Command{
+		Use:   "version",
+		Short: "Show the build of this binary, and of the server when --server is set",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			versions := struct {
+				Client BuildInfo  `json:"client"`
+				Server *BuildInfo `json:"server,omitempty"`
+			}{Client: currentBuildInfo()}
+			if opts.server != "" {
+				server, err := NewAPIClient(opts.server).Version()
+				if err != nil {
+					return fmt.Errorf("failed to get server version: %v", err)
+				}
+				versions.Server = server
+			}
+
+			out := cmd.OutOrStdout()
+			return opts.printer(cmd).print(versions, func(bool) {
+				printBuildInfo(out, "Client", versions.Client)
+				if versions.Server != nil {
+					printBuildInfo(out, "Server", *versions.Server)
+				}
+			})
+		},
+	}
+}
+
+func printBuildInfo(out io.Writer, label string, info BuildInfo) {
+	fmt.Fprintf(out, "%s: %s\n", label, info)
+}
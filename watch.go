@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"OpTrack/internal/clock"
+)
+
+const (
+	ansiClearScreen = "\033[H\033[2J"
+	ansiHighlight   = "\033[1;33m"
+	ansiReset       = "\033[0m"
+)
+
+// defaultWatchInterval is how often `status --watch` refreshes. The server
+// caches Quay lookups for a minute by default, so polling faster rarely shows more.
+const defaultWatchInterval = 30 * time.Second
+
+// watchStatuses redraws the status table of a ticket every interval until
+// interrupted. Digests that changed since the watch started are highlighted.
+func watchStatuses(out io.Writer, backend Backend, ticket string, interval time.Duration, wide bool, clk clock.Clock) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	terminal := isTerminal(out)
+	first := make(map[string]string) // operator -> digest when the watch started
+	changed := make(map[string]bool)
+
+	ticker := clk.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		statuses, err := backend.TicketStatuses(ticket)
+		now := clk.Now()
+		if terminal {
+			fmt.Fprint(out, ansiClearScreen)
+		}
+		fmt.Fprintf(out, "Every %s: optrack status %s    %s\n\n", interval, ticket, now.Format("2006-01-02 15:04:05"))
+
+		if err != nil {
+			// Keep watching through transient failures, e.g. a server restart
+			fmt.Fprintf(out, "Failed to get status of %s: %v\n", ticket, err)
+		} else {
+			for _, s := range statuses {
+				if s.Status != "OK" {
+					continue
+				}
+				if digest, seen := first[s.Name]; !seen {
+					first[s.Name] = s.SHA256
+				} else if digest != s.SHA256 {
+					changed[s.Name] = true
+				}
+			}
+			printStatusTable(out, statuses, now, wide, func(s OperatorStatus, digest string) string {
+				if !changed[s.Name] {
+					return digest
+				}
+				if terminal {
+					return ansiHighlight + digest + ansiReset
+				}
+				return digest + " (changed)"
+			})
+		}
+		if !terminal {
+			fmt.Fprintln(out)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}